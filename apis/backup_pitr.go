@@ -0,0 +1,112 @@
+package apis
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/network"
+	"github.com/hanzoai/base/tools/routine"
+)
+
+// backupPITR restores the data database to a point in time by replaying a
+// shard's network archive (BASE_ARCHIVE, verified against
+// BASE_ARCHIVE_TRUSTED_KEYS).
+//
+// A dry run replays into a scratch file and answers with the seq it reached
+// and the row counts of what it produced, leaving the data directory alone. A
+// real restore runs past the reply that starts it, as a backup restore does,
+// so its outcome is at GET /backups/pitr:{shard}/restore.
+func backupPITR(e *core.RequestEvent) error {
+	if e.App.Store().Has(core.StoreKeyActiveBackup) {
+		return e.BadRequestError("Try again later - another backup/restore process has already been started.", nil)
+	}
+
+	form := new(backupPITRForm)
+
+	err := e.BindBody(form)
+	if err != nil {
+		return e.BadRequestError("An error occurred while loading the submitted data.", err)
+	}
+
+	err = form.validate()
+	if err != nil {
+		return e.BadRequestError("An error occurred while validating the submitted data.", err)
+	}
+
+	at, _ := network.ParseRestorePoint(form.At) // validated above
+
+	cfg, err := network.ConfigFromEnv()
+	if err != nil {
+		return e.BadRequestError("Invalid network configuration. Raw error: \n"+err.Error(), nil)
+	}
+
+	archive, err := network.OpenRestoreArchive(context.Background(), cfg.Archive, cfg.ArchiveTrustedKeys)
+	if err != nil {
+		return e.BadRequestError("Failed to open the network archive. Raw error: \n"+err.Error(), nil)
+	}
+
+	opts := core.PITROptions{
+		Archive: archive,
+		Shard:   form.Shard,
+		At:      at,
+		DryRun:  form.DryRun,
+	}
+
+	if form.DryRun {
+		defer archive.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		result, err := e.App.RestorePITR(ctx, opts)
+		if err != nil {
+			return e.BadRequestError("Failed to replay the network archive. Raw error: \n"+err.Error(), nil)
+		}
+
+		return e.JSON(http.StatusOK, result)
+	}
+
+	routine.FireAndForget(func() {
+		defer archive.Close()
+
+		// give some optimistic time to write the response before restarting the app
+		time.Sleep(1 * time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		if _, err := e.App.RestorePITR(ctx, opts); err != nil {
+			e.App.Logger().Error("Failed to restore from the network archive", "shard", opts.Shard, "error", err.Error())
+		}
+	})
+
+	return e.NoContent(http.StatusNoContent)
+}
+
+// -------------------------------------------------------------------
+
+type backupPITRForm struct {
+	Shard  string `form:"shard" json:"shard"`
+	At     string `form:"at" json:"at"`
+	DryRun bool   `form:"dryRun" json:"dryRun"`
+}
+
+func (form *backupPITRForm) validate() error {
+	return validation.ValidateStruct(form,
+		validation.Field(&form.Shard, validation.Required, validation.Length(1, 255)),
+		validation.Field(&form.At, validation.By(checkRestorePoint)),
+	)
+}
+
+func checkRestorePoint(value any) error {
+	v, _ := value.(string)
+
+	if _, err := network.ParseRestorePoint(v); err != nil {
+		return validation.NewError("validation_invalid_restore_point", "Must be a seq or an RFC 3339 time.")
+	}
+
+	return nil
+}
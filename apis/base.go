@@ -60,6 +60,8 @@ func NewRouter(app core.App) (*router.Router[*core.RequestEvent], error) {
 	bindSettingsApi(app, apiGroup)
 	bindCollectionApi(app, apiGroup)
 	bindRecordCrudApi(app, apiGroup)
+	bindRecordHistoryApi(app, apiGroup)
+	bindViewsApi(app, apiGroup)
 	bindRecordAuthApi(app, apiGroup)
 	bindLogsApi(app, apiGroup)
 	bindBackupApi(app, apiGroup)
@@ -70,6 +72,9 @@ func NewRouter(app core.App) (*router.Router[*core.RequestEvent], error) {
 	bindDatabaseApi(app, apiGroup)
 	bindHealthApi(app, apiGroup)
 	bindRealtimeApi(app, apiGroup)
+	bindChangesApi(app, apiGroup)
+	bindWebhooksApi(app, apiGroup)
+	bindCrdtApi(app, apiGroup)
 	bindFunctionsApi(app, apiGroup)
 	bindPrivateApi(app, apiGroup)
 
@@ -0,0 +1,283 @@
+package apis
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/router"
+	"github.com/hanzoai/base/tools/search"
+)
+
+// The record change outbox, read over HTTP.
+//
+//	GET /v1/changes?since=<seq>&limit=<n>&collection=<name,...>
+//
+// answers the changes committed after `since`, oldest first, and `next`, the
+// seq to pass as `since` to continue. A consumer that keeps the last `next` it
+// was given resumes exactly where it stopped: every change after it, each
+// once, in the order they committed.
+//
+// A change is answered only where the caller could list the record it shows,
+// by the collection's list rule and by the trash and draft filters of the
+// list: a trashed record is not answered but with ?trashed=, as the list does,
+// and a never published one only to the superusers. The record a change shows is not the one in
+// the table now, which may have changed again or be gone, so the rule is asked
+// about the state the change carries instead, by standing it in for the
+// collection's table the way the update rule's WITH CHECK does. A change is
+// answered if the caller could list the record before it or after it, and the
+// side the caller could not list is answered as null: an update that moves a
+// record out of the caller's sight, into the trash say, reads as one with no
+// after.
+//
+// `next` is the last change LOOKED AT rather than the last one answered, so a
+// caller that may read none of a long run of changes still moves past it.
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// bindChangesApi registers the change outbox endpoint.
+func bindChangesApi(app core.App, rg *router.RouterGroup[*core.RequestEvent]) {
+	rg.GET("/changes", changesList)
+}
+
+// changeItem is one change as it is answered.
+type changeItem struct {
+	Seq            int64        `json:"seq"`
+	CollectionId   string       `json:"collectionId"`
+	CollectionName string       `json:"collectionName"`
+	RecordId       string       `json:"recordId"`
+	Action         string       `json:"action"`
+	Before         *core.Record `json:"before"`
+	After          *core.Record `json:"after"`
+	Created        string       `json:"created"`
+}
+
+func changesList(e *core.RequestEvent) error {
+	query := e.Request.URL.Query()
+
+	var since int64
+	if raw := query.Get("since"); raw != "" {
+		var err error
+		since, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil || since < 0 {
+			return e.BadRequestError("Invalid since seq.", err)
+		}
+	}
+
+	limit := defaultChangesLimit
+	if raw := query.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 {
+			return e.BadRequestError("Invalid limit.", err)
+		}
+		limit = min(limit, maxChangesLimit)
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+	isSuperuser := requestInfo.HasSuperuserAuth()
+
+	var collectionIds []string
+	for _, name := range strings.Split(query.Get("collection"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		collection, err := e.App.FindCachedCollectionByNameOrId(name)
+		if err != nil {
+			return e.NotFoundError("Missing collection "+name+".", err)
+		}
+		if collection.ListRule == nil && !isSuperuser {
+			return e.ForbiddenError("Only superusers can read the changes of "+collection.Name+".", nil)
+		}
+
+		collectionIds = append(collectionIds, collection.Id)
+	}
+
+	// A since older than the oldest change held means the ones between were
+	// deleted: answering from the oldest would skip them without a word.
+	oldest, _, err := core.RecordChangesBounds(e.App)
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+	if since > 0 && oldest > since+1 {
+		return e.Error(
+			http.StatusGone,
+			"The changes after "+strconv.FormatInt(since, 10)+" are no longer kept; read the records again and continue from since=0.",
+			nil,
+		)
+	}
+
+	changes, err := core.FindRecordChanges(e.App, since, limit, collectionIds...)
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+
+	items := []*changeItem{}
+	for _, change := range changes {
+		item, err := changeItemFor(e, requestInfo, change)
+		if err != nil {
+			return firstApiError(err, e.InternalServerError("", err))
+		}
+		if item != nil {
+			items = append(items, item)
+		}
+	}
+
+	next := since
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Seq
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"items":   items,
+		"next":    next,
+		"hasMore": len(changes) == limit,
+	})
+}
+
+// changeItemFor renders change for the caller, or returns nil where the caller
+// could list neither side of it.
+func changeItemFor(e *core.RequestEvent, requestInfo *core.RequestInfo, change *core.RecordChange) (*changeItem, error) {
+	isSuperuser := requestInfo.HasSuperuserAuth()
+
+	collection, err := e.App.FindCachedCollectionByNameOrId(change.CollectionId)
+	if err != nil {
+		// Gone with its collection, and with it the rule and the fields the
+		// change would be read by.
+		return nil, nil
+	}
+	if collection.ListRule == nil && !isSuperuser {
+		return nil, nil
+	}
+
+	before, err := change.BeforeRecord(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := change.AfterRecord(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if before != nil {
+		listable, err := changeStateListable(e.App, collection, before, requestInfo)
+		if err != nil {
+			return nil, err
+		}
+		if !listable {
+			before = nil
+		}
+	}
+	if after != nil {
+		listable, err := changeStateListable(e.App, collection, after, requestInfo)
+		if err != nil {
+			return nil, err
+		}
+		if !listable {
+			after = nil
+		}
+	}
+	if before == nil && after == nil {
+		return nil, nil
+	}
+
+	states := make([]*core.Record, 0, 2)
+	for _, state := range []*core.Record{before, after} {
+		if state != nil {
+			states = append(states, state)
+		}
+	}
+	if err := EnrichRecords(e, states); err != nil {
+		return nil, err
+	}
+
+	return newChangeItem(collection, change, before, after), nil
+}
+
+func newChangeItem(collection *core.Collection, change *core.RecordChange, before *core.Record, after *core.Record) *changeItem {
+	return &changeItem{
+		Seq:            change.Seq,
+		CollectionId:   change.CollectionId,
+		CollectionName: collection.Name,
+		RecordId:       change.RecordId,
+		Action:         change.Action,
+		Before:         before,
+		After:          after,
+		Created:        change.Created.String(),
+	}
+}
+
+// changeStateListable reports whether the list of collection would answer
+// record, one state of a change, to the caller: by the list rule, and by the
+// trash and published filters listQuery ANDs next to it.
+func changeStateListable(app core.App, collection *core.Collection, record *core.Record, requestInfo *core.RequestInfo) (bool, error) {
+	isSuperuser := requestInfo.HasSuperuserAuth()
+	if collection.ListRule == nil && !isSuperuser {
+		return false, nil
+	}
+
+	filters := []string{}
+	if !isSuperuser && *collection.ListRule != "" {
+		filters = append(filters, *collection.ListRule)
+	}
+
+	trash, err := trashFilter(collection, requestInfo)
+	if err != nil {
+		return false, err
+	}
+	if trash != "" {
+		filters = append(filters, trash)
+	}
+
+	if published := publishedFilter(collection, requestInfo); published != "" {
+		filters = append(filters, published)
+	}
+
+	if len(filters) == 0 {
+		return true, nil
+	}
+
+	return recordStateMatches(app, collection, record, "(\n"+strings.Join(filters, "\n) && (\n")+"\n)", requestInfo), nil
+}
+
+// recordStateMatches reports whether filter admits record, a state of it that
+// need not be the one in the table, for requestInfo.
+func recordStateMatches(app core.App, collection *core.Collection, record *core.Record, filter string, requestInfo *core.RequestInfo) bool {
+	if filter == "" {
+		return true
+	}
+
+	shadow, withFrom, params, err := shadowRow(app, collection, record)
+	if err != nil {
+		return false
+	}
+
+	query := app.ConcurrentDB().Select("(1)").PreFragment(withFrom).From(shadow.Name).AndBind(params)
+
+	resolver := core.NewRecordFieldResolver(app, shadow, requestInfo, true)
+
+	expr, err := search.FilterData(filter).BuildExpr(resolver)
+	if err != nil {
+		return false
+	}
+	query.AndWhere(expr)
+
+	if err := resolver.UpdateQuery(query); err != nil {
+		return false
+	}
+
+	var exists int
+	err = query.Limit(1).Row(&exists)
+
+	return err == nil && exists > 0
+}
@@ -0,0 +1,771 @@
+package apis
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/crdt"
+	"github.com/hanzoai/base/tools/hook"
+	"github.com/hanzoai/base/tools/router"
+	"github.com/hanzoai/base/tools/routine"
+	"github.com/hanzoai/base/tools/subscriptions"
+	"github.com/hanzoai/dbx"
+	"github.com/hanzoai/orm/dialect"
+)
+
+// Collaborative documents: a [crdt.Document] that belongs to a record, synced
+// over the realtime stream its clients already hold.
+//
+// A document is named for the record that owns it, `{collection}:{id}`, and the
+// record's rules are the document's rules. Joining is a read, so it asks the
+// view rule; pushing ops is a write, so it asks the update rule as well. There is
+// no rule of the document's own, because a second answer to "who may edit this
+// record" is one that can disagree with the first.
+//
+// The protocol is the one [crdt.SyncManager] already speaks, carried over two
+// channels the API already has. A client POSTs each message to /v1/crdt/{doc}
+// and is answered inline; what other clients push reaches it as an event on its
+// `/v1/realtime` stream under the topic `crdt/{doc}`. Naming its realtime
+// clientId on a sync_step1 subscribes it to that topic, so joining and listening
+// are one call. ZAP reaches the same handler through the forward bridge, so it
+// needs nothing here.
+//
+// `crdt/` holds no policy and authenticates no one (docs/CRDT-PRIVACY-MODELS.md,
+// §5), which is exactly why it is never reached directly: every message passes
+// the owning record's rule here first, and every broadcast passes it again for
+// each listening client.
+
+const (
+	// crdtStoreKey names the per-Base document table in the Base's store.
+	crdtStoreKey = "__hzCrdtDocs__"
+
+	// crdtNodeID is the node the server merges as. The server relays and merges
+	// ops and never authors one, so the name only has to be stable.
+	crdtNodeID = "base"
+
+	// crdtTopicPrefix prefixes the realtime topic a document broadcasts on.
+	crdtTopicPrefix = "crdt/"
+
+	// crdtCompactEvery is how many accepted pushes a document collects in its op
+	// log before it is rewritten as one snapshot.
+	crdtCompactEvery = 128
+
+	// crdtIdleAfter is how long a document stays open without a message before
+	// it is closed. Its op log has everything, so the next message reopens it.
+	crdtIdleAfter = 10 * time.Minute
+
+	// crdtSweepEvery is how often, at most, the open documents are looked over
+	// for idle ones.
+	crdtSweepEvery = time.Minute
+)
+
+// errCrdtEnvelope is a push whose envelopes do not open on the document it
+// names. It is the client's mistake, so it is answered as one.
+var errCrdtEnvelope = errors.New("the envelopes do not open on this document")
+
+// The documents of a Base are the Base's, and a record is saved and deleted on
+// the Base it lives in, so the broadcasts and the cleanup belong to every Base.
+func init() {
+	core.AppBindings.Register(bindCrdtEvents)
+}
+
+// bindCrdtApi registers the collaborative document endpoints.
+func bindCrdtApi(app core.App, rg *router.RouterGroup[*core.RequestEvent]) {
+	// Unbound from the default limiter for the same reason the record routes are:
+	// every message counts against the owning collection and its action.
+	sub := rg.Group("/crdt").Unbind(DefaultRateLimitMiddlewareId)
+	sub.POST("/{doc...}", crdtSync)
+}
+
+// crdtDocOwner splits a document id into the collection and record that own it,
+// and the field for the document of a crdtText field (see
+// [core.CrdtTextDocumentId]), which is named `{collection}:{id}/{field}`.
+func crdtDocOwner(docId string) (collection string, recordId string, field string, ok bool) {
+	collection, recordId, ok = strings.Cut(docId, ":")
+	recordId, field, hasField := strings.Cut(recordId, "/")
+	return collection, recordId, field, ok && collection != "" && recordId != "" && (!hasField || field != "")
+}
+
+func crdtSync(e *core.RequestEvent) error {
+	docId := e.Request.PathValue("doc")
+
+	collectionName, recordId, fieldName, ok := crdtDocOwner(docId)
+	if !ok {
+		return e.NotFoundError("", nil)
+	}
+
+	// A document has one name. The collection is named by its name and never by
+	// its id, because the name is bound into every sealed envelope and two names
+	// for one record would be two documents that never merge.
+	collection, err := e.App.FindCachedCollectionByNameOrId(collectionName)
+	if err != nil || collection == nil || collection.Name != collectionName {
+		return e.NotFoundError("Missing collection context.", err)
+	}
+
+	raw, err := io.ReadAll(e.Request.Body)
+	if err != nil {
+		return e.BadRequestError("Failed to read the sync message.", err)
+	}
+
+	var msg crdt.SyncMessage
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return e.BadRequestError("Invalid sync message.", err)
+	}
+	if msg.DocID != docId {
+		return e.BadRequestError("The sync message names a different document.", nil)
+	}
+
+	// Joining reads the document; anything else writes to it.
+	action, rule := "view", collection.ViewRule
+	switch msg.Type {
+	case crdt.SyncStep1:
+	case crdt.SyncStep2, crdt.SyncUpdate:
+		action, rule = "update", collection.UpdateRule
+	default:
+		return e.BadRequestError("Unknown sync message type.", nil)
+	}
+
+	if err := checkCollectionRateLimit(e, collection, "crdt", action); err != nil {
+		return err
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+
+	if collection.ViewRule == nil && !requestInfo.HasSuperuserAuth() {
+		return e.ForbiddenError("Only superusers can perform this action.", nil)
+	}
+
+	// The document of a crdtText field is the field's value, so it is joined
+	// here and written by updating the record, which runs the record's hooks
+	// and validation as any other write to it does. A hidden field is not there
+	// for anyone but a superuser.
+	var field *core.CrdtTextField
+	if fieldName != "" {
+		field, _ = collection.Fields.GetByName(fieldName).(*core.CrdtTextField)
+		if field == nil || (field.Hidden && !requestInfo.HasSuperuserAuth()) {
+			return e.NotFoundError("", nil)
+		}
+		if action != "view" {
+			return e.BadRequestError("A crdtText field is written by updating its record.", nil)
+		}
+	}
+
+	// A record the caller may not view is a document that is not there, in the
+	// same words recordView uses.
+	record, err := e.App.FindRecordById(collection, recordId, viewGate(e.App, collection, requestInfo))
+	if err != nil || record == nil {
+		return e.NotFoundError("", err)
+	}
+
+	if action == "update" {
+		if ok, _ := e.App.CanAccessRecord(record, requestInfo, rule); !ok {
+			return e.ForbiddenError("You are not allowed to edit this document.", nil)
+		}
+	}
+
+	// The clientId is the caller's realtime stream. It is optional — a push with
+	// none is still merged and broadcast, it is just echoed back to its sender —
+	// but a named one has to be the caller's, on the same terms as
+	// realtimeSetSubscriptions, or one client could join another to a document.
+	var client subscriptions.Client
+	if msg.ClientID != "" {
+		client, err = e.App.SubscriptionsBroker().ClientById(msg.ClientID)
+		if err != nil {
+			return e.NotFoundError("Missing or invalid client id.", err)
+		}
+
+		clientAuth, _ := client.Get(RealtimeClientAuthKey).(*core.Record)
+		if clientAuth != nil && !isSameAuth(clientAuth, e.Auth) {
+			return e.ForbiddenError("The current and the previous request authorization don't match.", nil)
+		}
+	}
+
+	var reply []byte
+	if field != nil {
+		reply, err = crdtFieldJoin(record, field, msg)
+	} else {
+		reply, err = crdtDocsOf(e.App).sync(e.App, msg, raw)
+	}
+	switch {
+	case errors.Is(err, errCrdtEnvelope):
+		return e.BadRequestError(errCrdtEnvelope.Error(), err)
+	case err != nil:
+		return e.InternalServerError("Failed to sync the document.", err)
+	}
+
+	if client != nil && msg.Type == crdt.SyncStep1 {
+		client.Set(RealtimeClientAuthKey, e.Auth)
+		client.Subscribe(crdtTopicPrefix + docId)
+	}
+
+	if reply == nil {
+		return e.NoContent(http.StatusNoContent)
+	}
+
+	return e.JSON(http.StatusOK, json.RawMessage(reply))
+}
+
+// crdtDocs are the documents a Base has open, and where each one's op log has
+// got to.
+//
+// The table's lock guards the table and nothing else; it is held to find or
+// add a document and never across a read, a write or a rule. Each document has
+// a lock of its own, held across the decode, the merge and the row of one push,
+// which leaves every other document free meanwhile.
+//
+// A document nobody has sent a message for in crdtIdleAfter is closed and leaves
+// the table, so what a Base holds open is what its clients are editing, not
+// everything they ever edited.
+type crdtDocs struct {
+	mu        sync.Mutex
+	docs      map[string]*crdtDoc
+	lastSweep time.Time
+}
+
+// crdtDoc is one open document.
+//
+// Its manager has a broadcast of its own that only collects, so that what a
+// merge has to tell the other clients is sent after the document's lock is let
+// go: sending asks the record's view rule once per listening client, and none
+// of that needs the document. Two pushes may then be told in the other order
+// than they merged, which a CRDT does not mind.
+type crdtDoc struct {
+	id string
+
+	mu       sync.Mutex
+	gone     bool // dropped from the table; look the document up again
+	doc      *crdt.Document
+	sm       *crdt.SyncManager
+	seq      int
+	pending  int
+	outbox   []crdtOutgoing
+	lastUsed time.Time
+}
+
+// crdtOutgoing is one message a merge has for the other clients of a document.
+type crdtOutgoing struct {
+	excludeClient string
+	msg           []byte
+}
+
+func crdtDocsOf(app core.App) *crdtDocs {
+	return app.Store().GetOrSet(crdtStoreKey, func() any {
+		return &crdtDocs{docs: map[string]*crdtDoc{}}
+	}).(*crdtDocs)
+}
+
+// lock returns the document named docId with its lock held, adding it to the
+// table if this process has not seen it yet. It is not loaded yet if doc is nil.
+func (d *crdtDocs) lock(docId string) *crdtDoc {
+	for {
+		d.mu.Lock()
+		d.sweep()
+		entry := d.docs[docId]
+		if entry == nil {
+			entry = &crdtDoc{id: docId}
+			entry.sm = crdt.NewSyncManager(func(_ string, excludeClient string, msg []byte) {
+				entry.outbox = append(entry.outbox, crdtOutgoing{excludeClient, msg})
+			})
+			d.docs[docId] = entry
+		}
+		d.mu.Unlock()
+
+		entry.mu.Lock()
+		if !entry.gone {
+			entry.lastUsed = time.Now()
+			return entry
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// sweep closes the documents that have been idle for crdtIdleAfter, at most once
+// per crdtSweepEvery. A document in use is skipped rather than waited for: it
+// is not idle. Called with the table's lock held.
+func (d *crdtDocs) sweep() {
+	now := time.Now()
+	if now.Sub(d.lastSweep) < crdtSweepEvery {
+		return
+	}
+	d.lastSweep = now
+
+	for docId, entry := range d.docs {
+		if !entry.mu.TryLock() {
+			continue
+		}
+		if now.Sub(entry.lastUsed) >= crdtIdleAfter {
+			entry.close()
+			entry.gone = true
+			delete(d.docs, docId)
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// sync runs one message against the document it names, loading the document
+// from the Base first if this process has not opened it yet.
+//
+// What a push carries is merged first and written to the op log after, in one
+// transaction, so the log only ever holds ops that merged; the broadcast waits
+// for the commit, so nothing any client has been told about is missing from
+// disk. The envelopes are opened before anything else, so a push that cannot
+// merge is refused as the client's mistake.
+func (d *crdtDocs) sync(app core.App, msg crdt.SyncMessage, raw []byte) ([]byte, error) {
+	entry := d.lock(msg.DocID)
+
+	reply, err := entry.sync(app, msg, raw)
+	outbox := entry.outbox
+	entry.outbox = nil
+
+	entry.mu.Unlock()
+
+	for _, out := range outbox {
+		crdtBroadcast(app, msg.DocID, out.excludeClient, out.msg)
+	}
+
+	return reply, err
+}
+
+// sync is crdtDocs.sync with the document's lock held.
+func (entry *crdtDoc) sync(app core.App, msg crdt.SyncMessage, raw []byte) ([]byte, error) {
+	push := msg.Type != crdt.SyncStep1 && len(msg.Envelopes) > 0
+
+	if !push {
+		if err := entry.refresh(app); err != nil {
+			return nil, err
+		}
+		return entry.sm.HandleSync(msg.ClientID, raw)
+	}
+
+	if entry.doc == nil {
+		if err := entry.load(app); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := entry.doc.OpenOps(msg.Envelopes); err != nil {
+		return nil, fmt.Errorf("%w: %w", errCrdtEnvelope, err)
+	}
+
+	var reply []byte
+	err := app.RunInTransaction(func(txApp core.App) error {
+		// Another instance of the Base may have appended since this one last
+		// looked. Its ops are merged first, so the seq taken below follows them.
+		if err := crdtLockOps(txApp); err != nil {
+			return err
+		}
+		if err := entry.refresh(txApp); err != nil {
+			return err
+		}
+
+		var err error
+		reply, err = entry.sm.HandleSync(msg.ClientID, raw)
+		if err != nil {
+			return err
+		}
+
+		return entry.append(txApp, msg.ClientID, msg.Envelopes)
+	})
+	if err != nil {
+		// Memory may hold ops the op log does not. Closing the document makes
+		// the next message reopen it from the op log, which is the copy that
+		// is whole; nothing the rollback took back is broadcast either.
+		entry.close()
+		entry.outbox = nil
+		return nil, err
+	}
+
+	if entry.pending >= crdtCompactEvery {
+		if err := entry.compact(app); err != nil {
+			// The op log is still complete, so a failed compaction costs load
+			// time and nothing else.
+			app.Logger().Warn("base: crdt compaction failed", "doc", msg.DocID, "error", err)
+		}
+	}
+
+	return reply, nil
+}
+
+// refresh opens the document if it is not open, and reopens it if the op log has
+// moved past it — another instance of the Base accepted a push meanwhile.
+func (entry *crdtDoc) refresh(app core.App) error {
+	if entry.doc != nil {
+		seq, err := crdtLastSeq(app, entry.id)
+		if err != nil {
+			return err
+		}
+		if seq == entry.seq {
+			return nil
+		}
+		entry.close()
+	}
+
+	return entry.load(app)
+}
+
+// crdtLockOps queues the writers of the op log until each one commits, so two
+// instances of a Base never read the same last seq. SQLite runs one writer at a
+// time already; Postgres runs them concurrently, and the lock is what stops the
+// second of two pushes to a document from failing on its (doc, seq) key.
+func crdtLockOps(txApp core.App) error {
+	if _, ok := txApp.Dialect().(dialect.Postgres); !ok {
+		return nil
+	}
+
+	_, err := txApp.NonconcurrentDB().NewQuery("LOCK TABLE {{" + core.CollectionNameCrdtOps + "}} IN EXCLUSIVE MODE").Execute()
+
+	return err
+}
+
+// crdtLastSeq returns the seq of the last push the op log of docId holds,
+// counting the ones a snapshot took in.
+func crdtLastSeq(app core.App, docId string) (int, error) {
+	var seq, snapshotSeq int
+
+	err := app.ConcurrentDB().Select("COALESCE(MAX([[seq]]), 0)").
+		From(core.CollectionNameCrdtOps).
+		Where(dbx.HashExp{"doc": docId}).
+		Row(&seq)
+	if err != nil {
+		return 0, err
+	}
+
+	err = app.ConcurrentDB().Select("COALESCE(MAX([[seq]]), 0)").
+		From(core.CollectionNameCrdtDocs).
+		Where(dbx.HashExp{"doc": docId}).
+		Row(&snapshotSeq)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(seq, snapshotSeq), nil
+}
+
+// load opens the document: the last snapshot, and then every op accepted after
+// it, in order.
+func (entry *crdtDoc) load(app core.App) error {
+	docId := entry.id
+	doc := crdt.NewDocument(docId, crdtNodeID)
+	seq := 0
+
+	row, err := app.FindFirstRecordByData(core.CollectionNameCrdtDocs, "doc", docId)
+	switch {
+	case err == nil:
+		data, err := base64.StdEncoding.DecodeString(row.GetString("snapshot"))
+		if err != nil {
+			return fmt.Errorf("crdt: snapshot of %q: %w", docId, err)
+		}
+		doc, err = crdt.Decode(data, crdtNodeID)
+		if err != nil {
+			return fmt.Errorf("crdt: snapshot of %q: %w", docId, err)
+		}
+		seq = row.GetInt("seq")
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	ops, err := app.FindRecordsByFilter(
+		core.CollectionNameCrdtOps,
+		"doc = {:doc} && seq > {:seq}",
+		"seq",
+		0,
+		0,
+		dbx.Params{"doc": docId, "seq": seq},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Replayed through a manager of its own with nobody to broadcast to: these
+	// ops were told to every client when they were first accepted.
+	replay := crdt.NewSyncManager(nil)
+	replay.RegisterDocument(docId, doc)
+	for _, op := range ops {
+		var envs []crdt.OpEnvelope
+		if err := op.UnmarshalJSONField("envelopes", &envs); err != nil {
+			return fmt.Errorf("crdt: op %d of %q: %w", op.GetInt("seq"), docId, err)
+		}
+		raw, err := json.Marshal(crdt.SyncMessage{Type: crdt.SyncUpdate, DocID: docId, Envelopes: envs})
+		if err != nil {
+			return err
+		}
+		if _, err := replay.HandleSync("", raw); err != nil {
+			return fmt.Errorf("crdt: op %d of %q: %w", op.GetInt("seq"), docId, err)
+		}
+		seq = op.GetInt("seq")
+	}
+
+	entry.sm.RegisterDocument(docId, doc)
+	entry.doc = doc
+	entry.seq = seq
+	entry.pending = len(ops)
+
+	return nil
+}
+
+// append writes one merged push to the op log under the next seq the op log
+// has, which refresh has just brought the document up to.
+func (entry *crdtDoc) append(app core.App, clientId string, envs []crdt.OpEnvelope) error {
+	collection, err := app.FindCachedCollectionByNameOrId(core.CollectionNameCrdtOps)
+	if err != nil {
+		return err
+	}
+
+	last, err := crdtLastSeq(app, entry.id)
+	if err != nil {
+		return err
+	}
+	seq := last + 1
+
+	row := core.NewRecord(collection)
+	row.Set("doc", entry.id)
+	row.Set("seq", seq)
+	row.Set("client", clientId)
+	row.Set("envelopes", envs)
+	if err := app.Save(row); err != nil {
+		return err
+	}
+
+	entry.seq = seq
+	entry.pending++
+
+	return nil
+}
+
+// compact rewrites the document's snapshot as of its latest seq and drops the
+// ops it now covers, in one transaction, so a load never sees a snapshot without
+// the ops after it or the ops without the snapshot before them.
+func (entry *crdtDoc) compact(app core.App) error {
+	data, err := entry.doc.Encode()
+	if err != nil {
+		return err
+	}
+
+	docId, seq := entry.id, entry.seq
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		row, err := txApp.FindFirstRecordByData(core.CollectionNameCrdtDocs, "doc", docId)
+		if errors.Is(err, sql.ErrNoRows) {
+			collection, err := txApp.FindCachedCollectionByNameOrId(core.CollectionNameCrdtDocs)
+			if err != nil {
+				return err
+			}
+			row = core.NewRecord(collection)
+			row.Set("doc", docId)
+		} else if err != nil {
+			return err
+		}
+
+		row.Set("seq", seq)
+		row.Set("snapshot", base64.StdEncoding.EncodeToString(data))
+		if err := txApp.Save(row); err != nil {
+			return err
+		}
+
+		_, err = txApp.DB().Delete(core.CollectionNameCrdtOps, dbx.And(
+			dbx.HashExp{"doc": docId},
+			dbx.NewExp("[[seq]] <= {:seq}", dbx.Params{"seq": seq}),
+		)).Execute()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	entry.pending = 0
+
+	return nil
+}
+
+// close closes the document in this process. The next message reopens it from
+// the Base. Called with the document's lock held.
+func (entry *crdtDoc) close() {
+	if entry.doc != nil {
+		entry.doc.Close()
+	}
+	entry.sm.UnregisterDocument(entry.id)
+	entry.doc = nil
+	entry.seq = 0
+	entry.pending = 0
+}
+
+// drop deletes a document, on disk and in memory. The rows go while the
+// document's lock is held and before it leaves the table, so a push waiting on
+// it finds it gone and, looking again, opens a document with nothing in it
+// rather than the rows being deleted.
+func (d *crdtDocs) drop(app core.App, docId string) {
+	entry := d.lock(docId)
+	defer entry.mu.Unlock()
+
+	entry.close()
+
+	for _, name := range []string{core.CollectionNameCrdtOps, core.CollectionNameCrdtDocs} {
+		if _, err := app.DB().Delete(name, dbx.HashExp{"doc": docId}).Execute(); err != nil {
+			app.Logger().Warn("base: failed to drop crdt document", "doc", docId, "error", err)
+		}
+	}
+
+	d.mu.Lock()
+	delete(d.docs, docId)
+	d.mu.Unlock()
+
+	entry.gone = true
+}
+
+// crdtBroadcast delivers what one client pushed to every other client listening
+// on the document — each one asked the owning record's view rule as itself, at
+// the moment of sending, exactly as a record broadcast is.
+//
+// A topic is just a string a client subscribes to, so anyone can name
+// `crdt/{doc}` in their subscriptions. The rule is asked here rather than at
+// subscribe time for the same reason realtimeBroadcastRecord asks it per
+// message: whether a caller may read a record is a fact about now.
+func crdtBroadcast(app core.App, docId string, excludeClient string, msg []byte) {
+	collectionName, recordId, _, ok := crdtDocOwner(docId)
+	if !ok {
+		return
+	}
+
+	collection, err := app.FindCachedCollectionByNameOrId(collectionName)
+	if err != nil {
+		return
+	}
+
+	record, err := app.FindRecordById(collection, recordId)
+	if err != nil {
+		return
+	}
+
+	crdtSend(app, record, false, crdtTopicPrefix+docId, excludeClient, msg)
+}
+
+// crdtSend sends msg on topic to every client subscribed to it that may view
+// record, except excludeClient. A hidden field's ops reach superusers only, as
+// the field itself does.
+func crdtSend(app core.App, record *core.Record, hidden bool, topic string, excludeClient string, msg []byte) {
+	collection := record.Collection()
+
+	for _, chunk := range app.SubscriptionsBroker().ChunkedClients(clientsChunkSize) {
+		for _, client := range chunk {
+			if client.Id() == excludeClient || len(client.Subscriptions(topic+"?")) == 0 {
+				continue
+			}
+
+			clientAuth, _ := client.Get(RealtimeClientAuthKey).(*core.Record)
+			if hidden && (clientAuth == nil || !clientAuth.IsSuperuser()) {
+				continue
+			}
+
+			requestInfo := &core.RequestInfo{
+				Context: core.RequestInfoContextRealtime,
+				Method:  http.MethodGet,
+				Auth:    clientAuth,
+			}
+			if ok, _ := app.CanAccessRecord(record, requestInfo, collection.ViewRule); !ok {
+				continue
+			}
+
+			routine.FireAndForget(func() {
+				client.Send(subscriptions.Message{Name: topic, Data: msg})
+			})
+		}
+	}
+}
+
+// crdtBroadcastFields sends the ops a save added to each crdtText field of
+// record, on the field's own topic, `crdt/{collection}:{id}/{field}`.
+//
+// The record's own topic already carries the merged text; this is for a client
+// holding the document, which would otherwise have to diff two strings to find
+// out what somebody else typed.
+func crdtBroadcastFields(app core.App, record *core.Record) {
+	for _, field := range record.Collection().Fields {
+		f, ok := field.(*core.CrdtTextField)
+		if !ok {
+			continue
+		}
+
+		ops := f.Delta(record)
+		if len(ops) == 0 {
+			continue
+		}
+
+		docId := core.CrdtTextDocumentId(record.Collection().Name, record.Id, f.Name)
+
+		// sealed under the id clients bind to, whatever id the stored value
+		// was decoded with
+		envs, err := crdt.NewDocument(docId, crdtNodeID).SealOps(ops)
+		if err != nil {
+			app.Logger().Debug("Failed to seal crdt field ops", "doc", docId, "error", err.Error())
+			continue
+		}
+
+		msg, err := json.Marshal(crdt.SyncMessage{Type: crdt.SyncUpdate, DocID: docId, Envelopes: envs})
+		if err != nil {
+			continue
+		}
+
+		crdtSend(app, record, f.Hidden, crdtTopicPrefix+docId, "", msg)
+	}
+}
+
+// crdtFieldJoin answers a join of the document of a crdtText field with what the
+// record stores and the joining client is missing. The client is then told what
+// later writes merge on the same topic as the document's other clients.
+func crdtFieldJoin(record *core.Record, field *core.CrdtTextField, msg crdt.SyncMessage) ([]byte, error) {
+	// sealed under the id clients bind to, as crdtBroadcastFields does
+	doc := crdt.NewDocument(msg.DocID, crdtNodeID)
+	if text, ok := record.GetRaw(field.Name).(*core.CrdtText); ok && text.Document() != nil {
+		doc.Merge(text.Document())
+	}
+
+	envs, err := doc.SealOps(doc.Diff(msg.StateVector))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(crdt.SyncMessage{
+		Type:        crdt.SyncStep2,
+		DocID:       msg.DocID,
+		StateVector: doc.Version(),
+		Envelopes:   envs,
+	})
+}
+
+// bindCrdtEvents broadcasts what a write merged into a record's crdtText fields,
+// and drops a record's document along with the record, on disk and in memory, so
+// a record created later under the same id starts from nothing.
+func bindCrdtEvents(app core.App) {
+	broadcastFields := func(e *core.RecordEvent) error {
+		crdtBroadcastFields(e.App, e.Record)
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess().Bind(&hook.Handler[*core.RecordEvent]{Func: broadcastFields, Priority: -98})
+	app.OnRecordAfterUpdateSuccess().Bind(&hook.Handler[*core.RecordEvent]{Func: broadcastFields, Priority: -98})
+
+	app.OnRecordAfterDeleteSuccess().Bind(&hook.Handler[*core.RecordEvent]{
+		Func: func(e *core.RecordEvent) error {
+			collection := e.Record.Collection()
+			if collection == nil || strings.HasPrefix(collection.Name, "_crdt_") {
+				return e.Next()
+			}
+
+			crdtDocsOf(e.App).drop(e.App, collection.Name+":"+e.Record.Id)
+
+			return e.Next()
+		},
+		Priority: -99,
+	})
+}
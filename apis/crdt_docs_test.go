@@ -0,0 +1,44 @@
+package apis
+
+import (
+	"testing"
+	"time"
+)
+
+// A document nobody has sent a message for in crdtIdleAfter leaves the table at
+// the next sweep; one in use stays, idle or not.
+func TestCrdtDocsCloseIdleDocuments(t *testing.T) {
+	d := &crdtDocs{docs: map[string]*crdtDoc{}}
+
+	idle := d.lock("pads:idle")
+	idle.lastUsed = time.Now().Add(-crdtIdleAfter)
+	idle.mu.Unlock()
+
+	busy := d.lock("pads:busy")
+	busy.lastUsed = time.Now().Add(-crdtIdleAfter)
+	defer busy.mu.Unlock()
+
+	fresh := d.lock("pads:fresh")
+	fresh.mu.Unlock()
+
+	d.lastSweep = time.Time{}
+
+	d.lock("pads:other").mu.Unlock()
+
+	if _, ok := d.docs["pads:idle"]; ok || !idle.gone {
+		t.Fatal("expected the idle document to be closed")
+	}
+	if _, ok := d.docs["pads:busy"]; !ok {
+		t.Fatal("expected the document in use to stay open")
+	}
+	if _, ok := d.docs["pads:fresh"]; !ok {
+		t.Fatal("expected the recently used document to stay open")
+	}
+
+	// a message for the closed document opens it afresh
+	if reopened := d.lock("pads:idle"); reopened == idle {
+		t.Fatal("expected a closed document to be opened afresh")
+	} else {
+		reopened.mu.Unlock()
+	}
+}
@@ -0,0 +1,534 @@
+package apis_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/base/apis"
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/crdt"
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/subscriptions"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+const crdtDoc = "pads:padoneaaaaaaaaa"
+
+// pads is readable by every signed-in user and editable only by its owner, so
+// the two halves of the protocol land on two different rules.
+func seedPads(t testing.TB) *tests.TestApp {
+	t.Helper()
+
+	app, err := tests.NewTestApp()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pads := core.NewBaseCollection("pads")
+	pads.ListRule = types.Pointer(`@request.auth.id != ""`)
+	pads.ViewRule = types.Pointer(`@request.auth.id != ""`)
+	pads.UpdateRule = types.Pointer("owner = @request.auth.id")
+	pads.Fields.Add(&core.TextField{Name: "owner", Required: true})
+	if err := app.Save(pads); err != nil {
+		t.Fatal(err)
+	}
+
+	r := core.NewRecord(pads)
+	r.Id = "padoneaaaaaaaaa"
+	r.Set("owner", tests.TestUserID1)
+	if err := app.Save(r); err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+// crdtPush is a sync_update carrying "hi" typed into the body field by a client
+// of its own.
+func crdtPush(t testing.TB) string {
+	return crdtPushFrom(t, "client-a", "")
+}
+
+// crdtPushFrom is crdtPush typed on node, sent on the realtime stream clientId.
+func crdtPushFrom(t testing.TB, node crdt.NodeID, clientId string) string {
+	t.Helper()
+
+	local := crdt.NewDocument(crdtDoc, node)
+	local.GetText("body").InsertText(0, "hi")
+
+	envs, err := local.SealOps(local.Diff(crdt.StateVersion{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(crdt.SyncMessage{Type: crdt.SyncUpdate, DocID: crdtDoc, ClientID: clientId, Envelopes: envs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+// crdtEncodedText is a whole document holding text, as a crdtText column stores
+// it.
+func crdtEncodedText(t testing.TB, docId string, text string) string {
+	t.Helper()
+
+	doc := crdt.NewDocument(docId, "client-x")
+	doc.GetText("text").InsertText(0, text)
+
+	data, err := doc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func crdtJoin() string {
+	return `{"type":"sync_step1","docId":"` + crdtDoc + `"}`
+}
+
+func crdtCall(t *testing.T, app *tests.TestApp, name, token, body string, status int, want ...string) {
+	t.Helper()
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	if token != "" {
+		headers["Authorization"] = token
+	}
+
+	scenario := tests.ApiScenario{
+		Name:                  name,
+		Method:                http.MethodPost,
+		URL:                   "/v1/crdt/" + crdtDoc,
+		Body:                  strings.NewReader(body),
+		Headers:               headers,
+		TestAppFactory:        func(testing.TB) *tests.TestApp { return app },
+		DisableTestAppCleanup: true,
+		ExpectedStatus:        status,
+		ExpectedContent:       want,
+	}
+	scenario.Test(t)
+}
+
+// The owner pushes and a reader joins: the reader is answered with the op the
+// owner pushed, because joining is a read and the view rule admits them.
+func TestCrdtJoinSeesWhatTheOwnerPushed(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := tests.GetUserAuthToken(app, "users", tests.TestUserID2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "owner pushes", owner, crdtPush(t), http.StatusNoContent)
+	crdtCall(t, app, "reader joins", reader, crdtJoin(), http.StatusOK, `"type":"sync_step2"`, `"envelopes":[{`)
+}
+
+// Pushing is a write, so it asks the update rule, and a reader is refused it.
+// A guest may not even view the record, so for them the document is not there.
+func TestCrdtPushAsksTheUpdateRule(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	reader, err := tests.GetUserAuthToken(app, "users", tests.TestUserID2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "reader pushes", reader, crdtPush(t), http.StatusForbidden)
+	crdtCall(t, app, "guest joins", "", crdtJoin(), http.StatusNotFound)
+	crdtCall(t, app, "guest pushes", "", crdtPush(t), http.StatusNotFound)
+}
+
+// What was pushed is on disk before anyone is told about it, so a process that
+// has never opened the document answers a join with it.
+func TestCrdtOpsSurviveTheProcess(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "owner pushes", owner, crdtPush(t), http.StatusNoContent)
+
+	ops, err := app.FindRecordsByFilter(core.CollectionNameCrdtOps, "doc = {:doc}", "seq", 0, 0, dbx.Params{"doc": crdtDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || ops[0].GetInt("seq") != 1 {
+		t.Fatalf("expected one op at seq 1, got %d", len(ops))
+	}
+
+	// every document this Base had open is gone, as after a restart
+	app.Store().Remove("__hzCrdtDocs__")
+
+	crdtCall(t, app, "owner rejoins", owner, crdtJoin(), http.StatusOK, `"envelopes":[{`)
+}
+
+// Every crdtCompactEvery pushes the op log is folded into a snapshot, and a
+// process that has never opened the document loads it from there.
+func TestCrdtCompactsTheOpLog(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 128 {
+		crdtCall(t, app, fmt.Sprintf("push %d", i), owner, crdtPushFrom(t, fmt.Sprintf("client-%d", i), ""), http.StatusNoContent)
+	}
+
+	snapshot, err := app.FindFirstRecordByData(core.CollectionNameCrdtDocs, "doc", crdtDoc)
+	if err != nil {
+		t.Fatalf("expected a snapshot, got %v", err)
+	}
+	if seq := snapshot.GetInt("seq"); seq != 128 {
+		t.Fatalf("expected the snapshot at seq 128, got %d", seq)
+	}
+
+	ops, err := app.FindRecordsByFilter(core.CollectionNameCrdtOps, "doc = {:doc}", "", 0, 0, dbx.Params{"doc": crdtDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 0 {
+		t.Fatalf("expected the snapshot to cover every op, got %d left", len(ops))
+	}
+
+	app.Store().Remove("__hzCrdtDocs__")
+
+	crdtCall(t, app, "owner pushes after compaction", owner, crdtPushFrom(t, "client-last", ""), http.StatusNoContent)
+
+	// every push typed "hi" on a node of its own, so a join that saw them all
+	// merges into that many copies of it
+	scenario := tests.ApiScenario{
+		Name:                  "owner rejoins",
+		Method:                http.MethodPost,
+		URL:                   "/v1/crdt/" + crdtDoc,
+		Body:                  strings.NewReader(crdtJoin()),
+		Headers:               map[string]string{"Content-Type": "application/json", "Authorization": owner},
+		TestAppFactory:        func(testing.TB) *tests.TestApp { return app },
+		DisableTestAppCleanup: true,
+		ExpectedStatus:        http.StatusOK,
+		ExpectedContent:       []string{`"type":"sync_step2"`},
+		AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			raw, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			local := crdt.NewDocument(crdtDoc, "client-z")
+			sm := crdt.NewSyncManager(nil)
+			sm.RegisterDocument(crdtDoc, local)
+			if _, err := sm.HandleSync("", raw); err != nil {
+				t.Fatal(err)
+			}
+
+			if n := local.GetText("body").Length(); n != 2*129 {
+				t.Fatalf("expected all 129 pushes, got %d characters", n)
+			}
+		},
+	}
+	scenario.Test(t)
+}
+
+// What one client pushes reaches the other clients on the document that may
+// view the record, and not the client that pushed it.
+func TestCrdtBroadcastAsksTheViewRule(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listen := func(authId string) subscriptions.Client {
+		client := subscriptions.NewDefaultClient()
+		client.Subscribe("crdt/" + crdtDoc)
+		if authId != "" {
+			auth, err := app.FindRecordById("users", authId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.Set(apis.RealtimeClientAuthKey, auth)
+		}
+		app.SubscriptionsBroker().Register(client)
+		return client
+	}
+
+	sender := listen(tests.TestUserID1)
+	reader := listen(tests.TestUserID2)
+	guest := listen("")
+
+	crdtCall(t, app, "owner pushes", owner, crdtPushFrom(t, "client-a", sender.Id()), http.StatusNoContent)
+
+	select {
+	case msg := <-reader.Channel():
+		if !strings.Contains(string(msg.Data), `"type":"sync_update"`) {
+			t.Fatalf("expected the reader to be sent the push, got %s", msg.Data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the reader to be sent the push")
+	}
+
+	select {
+	case msg := <-sender.Channel():
+		t.Fatalf("expected the sender not to be sent its own push, got %s", msg.Data)
+	case msg := <-guest.Channel():
+		t.Fatalf("expected the guest not to be sent the push, got %s", msg.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Deleting the record deletes its document, so a record created later under the
+// same id starts from nothing.
+func TestCrdtDocumentGoesWithItsRecord(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "owner pushes", owner, crdtPush(t), http.StatusNoContent)
+
+	pad, err := app.FindRecordById("pads", "padoneaaaaaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(pad); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{core.CollectionNameCrdtOps, core.CollectionNameCrdtDocs} {
+		rows, err := app.FindRecordsByFilter(name, "doc = {:doc}", "", 0, 0, dbx.Params{"doc": crdtDoc})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 0 {
+			t.Fatalf("expected no %s rows left, got %d", name, len(rows))
+		}
+	}
+
+	again := core.NewRecord(pad.Collection())
+	again.Id = pad.Id
+	again.Set("owner", tests.TestUserID1)
+	if err := app.Save(again); err != nil {
+		t.Fatal(err)
+	}
+
+	scenario := tests.ApiScenario{
+		Name:                  "owner joins the new record",
+		Method:                http.MethodPost,
+		URL:                   "/v1/crdt/" + crdtDoc,
+		Body:                  strings.NewReader(crdtJoin()),
+		Headers:               map[string]string{"Content-Type": "application/json", "Authorization": owner},
+		TestAppFactory:        func(testing.TB) *tests.TestApp { return app },
+		DisableTestAppCleanup: true,
+		ExpectedStatus:        http.StatusOK,
+		ExpectedContent:       []string{`"type":"sync_step2"`},
+		NotExpectedContent:    []string{`"envelopes":[{`},
+	}
+	scenario.Test(t)
+}
+
+// A document is named by its record, and a message naming another is refused.
+func TestCrdtMessageNamesItsDocument(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "other doc", owner, `{"type":"sync_step1","docId":"pads:other"}`, http.StatusBadRequest)
+	crdtCall(t, app, "unknown type", owner, `{"type":"nope","docId":"`+crdtDoc+`"}`, http.StatusBadRequest)
+}
+
+// The document of a crdtText field is its record's: a client that knows nothing
+// about CRDTs writes it as a plain string, but never as a whole document; a
+// reader joins it under the field's own name, and pushing to it is refused,
+// because the field is written through its record.
+func TestCrdtTextFieldDocument(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	pads, err := app.FindCollectionByNameOrId("pads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pads.Fields.Add(&core.CrdtTextField{Name: "body"})
+	if err := app.Save(pads); err != nil {
+		t.Fatal(err)
+	}
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := tests.GetUserAuthToken(app, "users", tests.TestUserID2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fieldDoc := core.CrdtTextDocumentId("pads", "padoneaaaaaaaaa", "body")
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "owner replaces the text with a plain string",
+			Method:          http.MethodPatch,
+			URL:             "/v1/collections/pads/records/padoneaaaaaaaaa",
+			Body:            strings.NewReader(`{"body":"hello there"}`),
+			Headers:         map[string]string{"Authorization": owner},
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"body":"hello there"`},
+		},
+		{
+			Name:           "owner writes a whole document",
+			Method:         http.MethodPatch,
+			URL:            "/v1/collections/pads/records/padoneaaaaaaaaa",
+			Body:           strings.NewReader(`{"body":"` + crdtEncodedText(t, fieldDoc, "forged") + `"}`),
+			Headers:        map[string]string{"Authorization": owner},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:            "reader joins the field",
+			Method:          http.MethodPost,
+			URL:             "/v1/crdt/" + fieldDoc,
+			Body:            strings.NewReader(`{"type":"sync_step1","docId":"` + fieldDoc + `"}`),
+			Headers:         map[string]string{"Authorization": reader},
+			ExpectedStatus:  http.StatusOK,
+			ExpectedContent: []string{`"type":"sync_step2"`, `"envelopes":[{`},
+		},
+		{
+			Name:           "owner pushes to the field",
+			Method:         http.MethodPost,
+			URL:            "/v1/crdt/" + fieldDoc,
+			Body:           strings.NewReader(`{"type":"sync_update","docId":"` + fieldDoc + `"}`),
+			Headers:        map[string]string{"Authorization": owner},
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "reader joins a field that is not there",
+			Method:         http.MethodPost,
+			URL:            "/v1/crdt/pads:padoneaaaaaaaaa/owner",
+			Body:           strings.NewReader(`{"type":"sync_step1","docId":"pads:padoneaaaaaaaaa/owner"}`),
+			Headers:        map[string]string{"Authorization": reader},
+			ExpectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.TestAppFactory = func(testing.TB) *tests.TestApp { return app }
+		scenario.DisableTestAppCleanup = true
+		scenario.Headers["Content-Type"] = "application/json"
+		scenario.Test(t)
+	}
+}
+
+// Another instance of the Base shares the op log and not this one's memory. A
+// push after one of its pushes takes the seq after it rather than colliding on
+// the (doc, seq) key, and a join answers with both.
+func TestCrdtPushFollowsAnotherInstance(t *testing.T) {
+	t.Parallel()
+
+	app := seedPads(t)
+	defer app.Cleanup()
+
+	owner, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "owner pushes", owner, crdtPushFrom(t, "client-a", ""), http.StatusNoContent)
+
+	// what the other instance appended for a client of its own
+	var other crdt.SyncMessage
+	if err := json.Unmarshal([]byte(crdtPushFrom(t, "client-b", "")), &other); err != nil {
+		t.Fatal(err)
+	}
+	collection, err := app.FindCollectionByNameOrId(core.CollectionNameCrdtOps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := core.NewRecord(collection)
+	row.Set("doc", crdtDoc)
+	row.Set("seq", 2)
+	row.Set("envelopes", other.Envelopes)
+	if err := app.Save(row); err != nil {
+		t.Fatal(err)
+	}
+
+	crdtCall(t, app, "owner pushes again", owner, crdtPushFrom(t, "client-c", ""), http.StatusNoContent)
+
+	ops, err := app.FindRecordsByFilter(core.CollectionNameCrdtOps, "doc = {:doc}", "seq", 0, 0, dbx.Params{"doc": crdtDoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 3 || ops[2].GetInt("seq") != 3 {
+		t.Fatalf("expected the push at seq 3 after the other instance's, got %d ops", len(ops))
+	}
+
+	scenario := tests.ApiScenario{
+		Name:                  "owner joins",
+		Method:                http.MethodPost,
+		URL:                   "/v1/crdt/" + crdtDoc,
+		Body:                  strings.NewReader(crdtJoin()),
+		Headers:               map[string]string{"Content-Type": "application/json", "Authorization": owner},
+		TestAppFactory:        func(testing.TB) *tests.TestApp { return app },
+		DisableTestAppCleanup: true,
+		ExpectedStatus:        http.StatusOK,
+		AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+			raw, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			local := crdt.NewDocument(crdtDoc, "client-z")
+			sm := crdt.NewSyncManager(nil)
+			sm.RegisterDocument(crdtDoc, local)
+			if _, err := sm.HandleSync("", raw); err != nil {
+				t.Fatal(err)
+			}
+
+			if n := local.GetText("body").Length(); n != 2*3 {
+				t.Fatalf("expected all 3 pushes, got %d characters", n)
+			}
+		},
+	}
+	scenario.Test(t)
+}
@@ -58,6 +58,7 @@ func TestCronsList(t *testing.T) {
 			ExpectedContent: []string{
 				`{"id":"__hzLogsCleanup__","expression":"0 */6 * * *"}`,
 				`{"id":"__hzDBOptimize__","expression":"0 0 * * *"}`,
+				`{"id":"__hzTrashPurge__","expression":"45 */6 * * *"}`,
 			},
 			NotExpectedContent: []string{
 				// Removed in the IAM-native rip: IAM owns MFA/OTP, no
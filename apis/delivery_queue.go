@@ -0,0 +1,318 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The queued deliveries the webhooks and the function triggers are both made
+// of.
+//
+// What a queue delivers is read from the change outbox, never from a request.
+// The relay hands the outbox to the queue's sink, which writes one row per
+// change per target that wants it, and a scheduled job attempts the rows that
+// are due. Nothing is attempted from the request that made the change, so a
+// slow or dead target costs its own rows their time and no write anything, and
+// a row that was queued is one for a change that committed.
+//
+// A failed attempt is retried with an exponential backoff, from the row: the
+// attempts, the next attempt and the last error are all in it, so a restart
+// forgets nothing and the rows are what an operator reads to see how a target
+// fared. A row that ran out of attempts stays failed.
+//
+// The payload of a row is the change as `/v1/changes` answers it. Delivery is
+// at least once, as everything read from the outbox is.
+
+// deliveryQueueInterval is how often the due rows of a queue are attempted.
+const deliveryQueueInterval = "10s"
+
+// deliveryQueueBatch is how many due rows one run of a queue attempts.
+const deliveryQueueBatch = 50
+
+// deliveryQueue describes one queue: where its rows are, what they are
+// attempted with, and how often and how long they are kept at it.
+type deliveryQueue struct {
+	// sink names the change sink that queues the rows, and collection is the
+	// collection they are queued in.
+	sink       string
+	collection string
+
+	// target is the field of a row that names whom it is for, and action the
+	// field the action of its change is written to.
+	target string
+	action string
+
+	// job and cleanupJob are the ids of the cron jobs that attempt the due
+	// rows and that delete the old finished ones, on cleanupSchedule.
+	job             string
+	cleanupJob      string
+	cleanupSchedule string
+
+	// concurrency is how many rows are attempted at once.
+	concurrency int
+
+	// maxAttempts is how many times a row is attempted before it fails, the
+	// first retry retryBase after the first attempt and each one after twice
+	// as long after the one before it.
+	maxAttempts int
+	retryBase   time.Duration
+
+	// maxDays is how long a finished row is kept.
+	maxDays int
+
+	// pending, done and failed are the statuses of a row, and doneAt and
+	// failedAt the date fields set when it is done or failed, if any.
+	pending  string
+	done     string
+	failed   string
+	doneAt   string
+	failedAt string
+
+	// targets loads the targets the rows of a batch of changes are for.
+	targets func(app core.App) ([]deliveryTarget, error)
+
+	// attempt makes one attempt of row. The error of an attempt that failed
+	// and that no later attempt would fare better with comes with final.
+	attempt func(ctx context.Context, app core.App, row *core.Record) (final bool, err error)
+}
+
+// deliveryTarget is one target of a queue: a webhook or a function.
+type deliveryTarget struct {
+	id string
+
+	// wants reports whether the target is queued a change of collection.
+	wants func(app core.App, collection *core.Collection, action string, before *core.Record, after *core.Record) bool
+}
+
+// bind registers the sink of q with the relay of app, and its jobs with the
+// cron of app once it is bootstrapped.
+func (q *deliveryQueue) bind(app core.App) {
+	app.ChangeRelay().Register(&deliveryQueueSink{app: app, queue: q})
+
+	app.OnBootstrap().BindFunc(func(e *core.BootstrapEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		err := app.Cron().Add(q.job, deliveryQueueInterval, func() {
+			if err := q.run(context.Background(), app); err != nil {
+				app.Logger().Warn("Failed to attempt the due deliveries", "queue", q.collection, "error", err.Error())
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register the %s job: %w", q.job, err)
+		}
+
+		err = app.Cron().Add(q.cleanupJob, q.cleanupSchedule, func() {
+			if err := q.cleanup(app); err != nil {
+				app.Logger().Warn("Failed to delete the old deliveries", "queue", q.collection, "error", err.Error())
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to register the %s job: %w", q.cleanupJob, err)
+		}
+
+		return nil
+	})
+}
+
+// queue queues a row of q for target with payload, due now, and returns it
+// for the caller to save once it has set the fields that are its own.
+func (q *deliveryQueue) queue(app core.App, target string, payload []byte) (*core.Record, error) {
+	collection, err := app.FindCachedCollectionByNameOrId(q.collection)
+	if err != nil {
+		return nil, err
+	}
+
+	row := core.NewRecord(collection)
+	row.Set(q.target, target)
+	row.Set("payload", types.JSONRaw(payload))
+	row.Set("status", q.pending)
+	row.Set("nextAttempt", types.NowDateTime())
+
+	return row, nil
+}
+
+// run attempts the rows of q that are due.
+func (q *deliveryQueue) run(ctx context.Context, app core.App) error {
+	due, err := app.FindRecordsByFilter(
+		q.collection,
+		"status = {:pending} && nextAttempt <= {:now}",
+		"nextAttempt",
+		deliveryQueueBatch,
+		0,
+		dbx.Params{"pending": q.pending, "now": types.NowDateTime().String()},
+	)
+	if err != nil {
+		return err
+	}
+
+	sem := make(chan struct{}, q.concurrency)
+	wg := sync.WaitGroup{}
+
+	for _, row := range due {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+
+			if err := q.attemptRow(ctx, app, row); err != nil {
+				app.Logger().Warn("Failed to record a delivery attempt", "queue", q.collection, "id", row.Id, "error", err.Error())
+			}
+		})
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+// attemptRow attempts row once and records how it went.
+func (q *deliveryQueue) attemptRow(ctx context.Context, app core.App, row *core.Record) error {
+	attempts := row.GetInt("attempts") + 1
+	row.Set("attempts", attempts)
+
+	final, err := q.attempt(ctx, app, row)
+
+	switch {
+	case err == nil:
+		row.Set("status", q.done)
+		row.Set("error", "")
+		if q.doneAt != "" {
+			row.Set(q.doneAt, types.NowDateTime())
+		}
+	case final || attempts >= q.maxAttempts:
+		row.Set("status", q.failed)
+		row.Set("error", err.Error())
+		if q.failedAt != "" {
+			row.Set(q.failedAt, types.NowDateTime())
+		}
+	default:
+		row.Set("nextAttempt", types.NowDateTime().Add(q.retryDelay(attempts)))
+		row.Set("error", err.Error())
+	}
+
+	return app.SaveNoValidate(row)
+}
+
+// retryDelay is how long after its attempts-th attempt a row is attempted
+// again.
+func (q *deliveryQueue) retryDelay(attempts int) time.Duration {
+	return q.retryBase << max(attempts-1, 0)
+}
+
+// cleanup deletes the rows of q that finished more than maxDays ago.
+func (q *deliveryQueue) cleanup(app core.App) error {
+	date := types.NowDateTime().AddDate(0, 0, -q.maxDays)
+
+	_, err := app.NonconcurrentDB().Delete(q.collection, dbx.NewExp(
+		"[[status]] != {:pending} AND [[created]] < {:date}",
+		dbx.Params{"pending": q.pending, "date": date.String()},
+	)).Execute()
+
+	return err
+}
+
+// -------------------------------------------------------------------
+
+// deliveryQueueSink turns the changes of the outbox into the rows of a queue.
+type deliveryQueueSink struct {
+	app   core.App
+	queue *deliveryQueue
+}
+
+// Name implements [core.ChangeSink.Name].
+func (s *deliveryQueueSink) Name() string {
+	return s.queue.sink
+}
+
+// Deliver implements [core.ChangeSink.Deliver].
+//
+// A batch handed over again after its rows were queued finds them there and
+// queues nothing twice.
+func (s *deliveryQueueSink) Deliver(_ context.Context, changes []*core.RecordChange) error {
+	q := s.queue
+
+	targets, err := q.targets(s.app)
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		for _, change := range changes {
+			collection, err := txApp.FindCachedCollectionByNameOrId(change.CollectionId)
+			if err != nil {
+				continue // gone with its collection
+			}
+
+			before, err := change.BeforeRecord(collection)
+			if err != nil {
+				return err
+			}
+
+			after, err := change.AfterRecord(collection)
+			if err != nil {
+				return err
+			}
+
+			var payload []byte
+
+			for _, target := range targets {
+				if !target.wants(txApp, collection, change.Action, before, after) {
+					continue
+				}
+
+				_, err := txApp.FindFirstRecordByFilter(
+					q.collection,
+					q.target+" = {:target} && seq = {:seq}",
+					dbx.Params{"target": target.id, "seq": change.Seq},
+				)
+				if err == nil {
+					continue // queued by an earlier hand over of the batch
+				}
+
+				if payload == nil {
+					payload, err = json.Marshal(newChangeItem(collection, change, before, after))
+					if err != nil {
+						return err
+					}
+				}
+
+				row, err := q.queue(txApp, target.id, payload)
+				if err != nil {
+					return err
+				}
+				row.Set(q.action, change.Action)
+				row.Set("seq", change.Seq)
+				row.Set("collection", collection.Name)
+				row.Set("recordId", change.RecordId)
+
+				// written by Base from a change that was already validated, and
+				// a payload over the json field's size is still one to deliver
+				if err := txApp.SaveNoValidate(row); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// changeStateWanted reports whether filter admits the record of a change: the
+// record after it, or before it for a delete, rather than the row now in the
+// table.
+func changeStateWanted(app core.App, collection *core.Collection, filter string, before *core.Record, after *core.Record) bool {
+	state := after
+	if state == nil {
+		state = before
+	}
+
+	return recordStateMatches(app, collection, state, filter, nil)
+}
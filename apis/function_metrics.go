@@ -0,0 +1,102 @@
+package apis
+
+import (
+	"time"
+
+	"github.com/hanzoai/base/core"
+	metric "github.com/luxfi/metric"
+)
+
+// FunctionMetrics owns the collectors of the function runs, invoked and
+// triggered alike, of every Base this process serves. Callers wire it into
+// their own registry the way they wire the network [network.Metrics]:
+//
+//	base_function_invocations_total       counter  runs finished, however they ended
+//	base_function_failures_total          counter  runs that raised or could not run
+//	base_function_refusals_total          counter  runs the host turned down for their caller
+//	base_function_timeouts_total          counter  runs stopped at their time limit
+//	base_function_duration_seconds        summary  run latency, p50 and p99
+//
+// The per-function view is the invocations log, which is per Base and so per
+// org; these are the process's, and carry no function name, because the names
+// are the tenants' and a label per tenant function is a series per tenant.
+type FunctionMetrics struct {
+	Invocations metric.Counter
+	Failures    metric.Counter
+	Refusals    metric.Counter
+	Timeouts    metric.Counter
+	Duration    metric.Summary
+}
+
+// NewFunctionMetrics constructs the collectors. Register them on a
+// caller-owned registry with Register().
+func NewFunctionMetrics() *FunctionMetrics {
+	return &FunctionMetrics{
+		Invocations: metric.NewCounter(metric.CounterOpts{
+			Name: "base_function_invocations_total",
+			Help: "Function runs finished, invoked or triggered, however they ended.",
+		}),
+		Failures: metric.NewCounter(metric.CounterOpts{
+			Name: "base_function_failures_total",
+			Help: "Function runs that raised, answered too much, or could not be run.",
+		}),
+		Refusals: metric.NewCounter(metric.CounterOpts{
+			Name: "base_function_refusals_total",
+			Help: "Function runs the host turned down on their caller's behalf.",
+		}),
+		Timeouts: metric.NewCounter(metric.CounterOpts{
+			Name: "base_function_timeouts_total",
+			Help: "Function runs stopped at their time limit.",
+		}),
+		Duration: metric.NewSummary(metric.SummaryOpts{
+			Name:       "base_function_duration_seconds",
+			Help:       "Function run latency.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.99: 0.001},
+		}),
+	}
+}
+
+// Register adds every collector in m to r. Duplicate registration returns
+// the first error.
+func (m *FunctionMetrics) Register(r metric.Registerer) error {
+	if m == nil || r == nil {
+		return nil
+	}
+	for _, c := range []metric.Collector{m.Invocations, m.Failures, m.Refusals, m.Timeouts, m.Duration} {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observe counts one finished run that took d and ended in errorClass, empty
+// for a run that succeeded.
+func (m *FunctionMetrics) observe(errorClass string, d time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.Invocations.Inc()
+	m.Duration.Observe(d.Seconds())
+
+	switch errorClass {
+	case "":
+	case core.FunctionErrorRefused:
+		m.Refusals.Inc()
+	case core.FunctionErrorTimeout:
+		m.Timeouts.Inc()
+	default:
+		m.Failures.Inc()
+	}
+}
+
+// functionMetrics is the process's, since the runs of every Base it opens are
+// counted together.
+var functionMetrics = NewFunctionMetrics()
+
+// FunctionInvocationMetrics returns the collectors of the function runs, for
+// the caller to register.
+func FunctionInvocationMetrics() *FunctionMetrics {
+	return functionMetrics
+}
@@ -0,0 +1,369 @@
+package apis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/plugins/extruntime"
+	"github.com/hanzoai/base/tools/cron"
+	"github.com/hanzoai/base/tools/types"
+)
+
+// Function triggers: functions that run because something happened rather than
+// because somebody asked.
+//
+// A function declares its triggers in its hidden "triggers" field, as a list of
+//
+//	{"collection": "posts", "events": ["create", "update"], "filter": "status = 'live'"}
+//	{"cron": "*/5 * * * *"}
+//
+// where no events is every event, and the filter is asked of the record after
+// the change, or before it for a delete, the way a webhook's is.
+//
+// A record trigger is read from the change outbox, never from the request that
+// made the change: the invocations are a queue (see deliveryQueue), one
+// `_function_invocations` row per change per function that wants it, run by a
+// scheduled job and retried from the row, which is the record of how it went.
+// So a function runs only for a write that committed, a slow function holds up
+// no write, and a change of a system collection, which the outbox does not
+// carry, triggers nothing. A cron trigger queues its row when it fires and is
+// run by the same job.
+//
+// The payload is the change as `/v1/changes` answers it, or for a cron trigger
+// `{"cron": expression, "scheduled": date}`. The function runs through the same
+// host as an invoked one, in the Base whose change or schedule it was, so what
+// it reads and where its runs are billed are that org's and no other's.
+//
+// A triggered run has no caller, and it is not given one: it reads as a guest
+// in the functionTrigger request context, so it reads what the rules grant a
+// guest, and what a rule grants with `@request.context = "functionTrigger"`.
+// Which records a trigger may read is thus said by the rules of the records,
+// like any other read, rather than by whoever wrote the trigger.
+
+// functionCronJobPrefix prefixes the id of the cron job of a cron trigger.
+const functionCronJobPrefix = "__hzFunctionCron__"
+
+// functionInvocationQueue is the queue of the triggered function runs.
+//
+// A run holds a runtime for up to functionTimeout, so fewer are in flight at
+// once than webhook deliveries. From the retry base, the last of its 5
+// attempts is four minutes after the one before it.
+var functionInvocationQueue = &deliveryQueue{
+	sink:            "functions",
+	collection:      core.CollectionNameFunctionInvocations,
+	target:          "function",
+	action:          "trigger",
+	job:             "__hzFunctionInvocations__",
+	cleanupJob:      "__hzFunctionInvocationsCleanup__",
+	cleanupSchedule: "45 */6 * * *",
+	concurrency:     4,
+	maxAttempts:     5,
+	retryBase:       30 * time.Second,
+	maxDays:         30,
+	pending:         core.FunctionInvocationPending,
+	done:            core.FunctionInvocationSucceeded,
+	failed:          core.FunctionInvocationFailed,
+	doneAt:          "finishedAt",
+	failedAt:        "finishedAt",
+	targets:         functionTargets,
+	attempt:         attemptFunctionInvocation,
+}
+
+// What an invocation records as its trigger besides the action of the change
+// that queued it.
+const (
+	functionTriggerCron = "cron"
+	functionTriggerHTTP = "http" // invoked by `POST /v1/functions/{name}`
+)
+
+func init() {
+	core.AppBindings.Register(bindFunctionTriggers)
+}
+
+// functionTrigger is one entry of a function's triggers.
+type functionTrigger struct {
+	Collection string   `json:"collection,omitempty"`
+	Events     []string `json:"events,omitempty"`
+	Filter     string   `json:"filter,omitempty"`
+	Cron       string   `json:"cron,omitempty"`
+}
+
+// functionTriggers reads the triggers of function.
+func functionTriggers(function *core.Record) ([]functionTrigger, error) {
+	raw := strings.TrimSpace(function.GetString(core.FieldNameTriggers))
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+
+	var triggers []functionTrigger
+	if err := json.Unmarshal([]byte(raw), &triggers); err != nil {
+		return nil, errors.New("the triggers must be a list of trigger objects")
+	}
+
+	return triggers, nil
+}
+
+// validateFunctionTriggers reports the first trigger of function that could
+// never fire.
+func validateFunctionTriggers(app core.App, function *core.Record) error {
+	triggers, err := functionTriggers(function)
+	if err != nil {
+		return validation.NewError("validation_invalid_function_triggers", err.Error())
+	}
+
+	for i, trigger := range triggers {
+		at := "trigger " + strconv.Itoa(i) + ": "
+
+		switch {
+		case trigger.Cron != "" && trigger.Collection != "":
+			return validation.NewError("validation_invalid_function_trigger",
+				at+"a trigger is either a collection or a cron, not both")
+		case trigger.Cron != "":
+			if _, err := cron.NewSchedule(trigger.Cron); err != nil {
+				return validation.NewError("validation_invalid_function_trigger", at+err.Error())
+			}
+		case trigger.Collection != "":
+			collection, err := app.FindCachedCollectionByNameOrId(trigger.Collection)
+			if err != nil || collection == nil {
+				return validation.NewError("validation_invalid_function_trigger",
+					at+"no collection named "+strconv.Quote(trigger.Collection))
+			}
+			if collection.System || collection.IsView() {
+				// neither is in the outbox, so the trigger would never fire
+				return validation.NewError("validation_invalid_function_trigger",
+					at+"the changes of "+strconv.Quote(collection.Name)+" trigger nothing")
+			}
+			for _, event := range trigger.Events {
+				if event != core.RecordChangeCreate && event != core.RecordChangeUpdate && event != core.RecordChangeDelete {
+					return validation.NewError("validation_invalid_function_trigger",
+						at+"unknown event "+strconv.Quote(event))
+				}
+			}
+		default:
+			return validation.NewError("validation_invalid_function_trigger",
+				at+"a trigger needs a collection or a cron")
+		}
+	}
+
+	return nil
+}
+
+// bindFunctionTriggers queues the invocations of the triggered functions of app
+// and schedules their runs.
+func bindFunctionTriggers(app core.App) {
+	app.OnRecordValidate(core.CollectionNameFunctions).BindFunc(func(e *core.RecordEvent) error {
+		if err := validateFunctionTriggers(e.App, e.Record); err != nil {
+			return validation.Errors{core.FieldNameTriggers: err}
+		}
+		return e.Next()
+	})
+
+	functionInvocationQueue.bind(app)
+
+	// the cron triggers follow the functions as they are written
+	app.OnBootstrap().BindFunc(func(e *core.BootstrapEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		syncFunctionCronTriggers(app)
+		return nil
+	})
+	// app rather than e.App, which may be a transaction the jobs outlive
+	resync := func(e *core.RecordEvent) error {
+		syncFunctionCronTriggers(app)
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess(core.CollectionNameFunctions).BindFunc(resync)
+	app.OnRecordAfterUpdateSuccess(core.CollectionNameFunctions).BindFunc(resync)
+	app.OnRecordAfterDeleteSuccess(core.CollectionNameFunctions).BindFunc(resync)
+}
+
+// syncFunctionCronTriggers registers one cron job per cron trigger of the
+// functions of app, and removes the jobs of the triggers that are gone.
+func syncFunctionCronTriggers(app core.App) {
+	if _, err := app.FindCachedCollectionByNameOrId(core.CollectionNameFunctions); err != nil {
+		return // not migrated yet
+	}
+
+	functions, err := app.FindAllRecords(core.CollectionNameFunctions)
+	if err != nil {
+		app.Logger().Warn("Failed to load the function cron triggers", "error", err.Error())
+		return
+	}
+
+	wanted := map[string]string{}
+	owners := map[string]string{}
+
+	for _, function := range functions {
+		triggers, err := functionTriggers(function)
+		if err != nil {
+			continue // refused on save, so written around the validation
+		}
+		for i, trigger := range triggers {
+			if trigger.Cron == "" {
+				continue
+			}
+			id := functionCronJobPrefix + function.Id + "_" + strconv.Itoa(i)
+			wanted[id] = trigger.Cron
+			owners[id] = function.Id
+		}
+	}
+
+	for _, job := range app.Cron().Jobs() {
+		if !strings.HasPrefix(job.Id(), functionCronJobPrefix) {
+			continue
+		}
+		if expr, ok := wanted[job.Id()]; ok && expr == job.Expression() {
+			delete(wanted, job.Id()) // unchanged, and re-adding would reset it
+			continue
+		}
+		app.Cron().Remove(job.Id())
+	}
+
+	for id, expr := range wanted {
+		function := owners[id]
+		err := app.Cron().Add(id, expr, func() {
+			payload, _ := json.Marshal(map[string]string{
+				"cron":      expr,
+				"scheduled": types.NowDateTime().String(),
+			})
+			if err := queueFunctionInvocation(app, function, functionTriggerCron, payload); err != nil {
+				app.Logger().Warn("Failed to queue a function cron invocation", "function", function, "error", err.Error())
+			}
+		})
+		if err != nil {
+			app.Logger().Warn("Failed to register a function cron trigger", "function", function, "error", err.Error())
+		}
+	}
+}
+
+// queueFunctionInvocation queues a run of function, due now.
+func queueFunctionInvocation(app core.App, function string, trigger string, payload []byte) error {
+	invocation, err := functionInvocationQueue.queue(app, function, payload)
+	if err != nil {
+		return err
+	}
+	invocation.Set("trigger", trigger)
+
+	return app.SaveNoValidate(invocation)
+}
+
+// -------------------------------------------------------------------
+
+// functionTargets loads the functions with record triggers.
+func functionTargets(app core.App) ([]deliveryTarget, error) {
+	functions, err := app.FindAllRecords(core.CollectionNameFunctions)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []deliveryTarget
+	for _, function := range functions {
+		triggers, _ := functionTriggers(function)
+		triggers = slices.DeleteFunc(triggers, func(trigger functionTrigger) bool {
+			return trigger.Collection == ""
+		})
+		if len(triggers) == 0 {
+			continue
+		}
+
+		targets = append(targets, deliveryTarget{
+			id: function.Id,
+			wants: func(app core.App, collection *core.Collection, action string, before *core.Record, after *core.Record) bool {
+				return slices.ContainsFunc(triggers, func(trigger functionTrigger) bool {
+					return functionTriggerWants(app, trigger, collection, action, before, after)
+				})
+			},
+		})
+	}
+
+	return targets, nil
+}
+
+// functionTriggerWants reports whether trigger fires for a change of
+// collection.
+func functionTriggerWants(app core.App, trigger functionTrigger, collection *core.Collection, action string, before *core.Record, after *core.Record) bool {
+	if trigger.Collection != collection.Name && trigger.Collection != collection.Id {
+		return false
+	}
+
+	if len(trigger.Events) > 0 && !slices.Contains(trigger.Events, action) {
+		return false
+	}
+
+	return changeStateWanted(app, collection, trigger.Filter, before, after)
+}
+
+// attemptFunctionInvocation runs the invocation row once.
+func attemptFunctionInvocation(ctx context.Context, app core.App, row *core.Record) (bool, error) {
+	started := time.Now()
+
+	function, err := app.FindRecordById(core.CollectionNameFunctions, row.GetString("function"))
+	if err != nil {
+		err = fmt.Errorf("the function %q is gone", row.GetString("function"))
+		finishFunctionInvocation(row, nil, core.FunctionErrorFailed, err, time.Since(started))
+		return true, err
+	}
+	if extruntime.Lookup(functionLang) == nil {
+		err = errors.New("no runtime is linked for " + functionLang + " functions")
+		finishFunctionInvocation(row, nil, core.FunctionErrorFailed, err, time.Since(started))
+		return true, err
+	}
+
+	payload, _ := row.GetRaw("payload").(types.JSONRaw)
+	call, errorClass, err := runTriggeredFunction(ctx, app, function, payload)
+	finishFunctionInvocation(row, call, errorClass, err, time.Since(started))
+
+	return false, err
+}
+
+// runTriggeredFunction runs function with payload in app.
+//
+// The call is the one functionInvoke makes with no request behind it: the org
+// is the one app was opened for, and the reads are a guest's in the
+// functionTrigger context (see the top of the file). Its answer goes nowhere,
+// so only how it ended is kept: the call, for what it cost, and the error
+// class of a run that did not succeed.
+func runTriggeredFunction(ctx context.Context, app core.App, function *core.Record, payload []byte) (*invocation, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, functionTimeout)
+	defer cancel()
+
+	org, _ := app.Store().Get(StoreKeyBaseOrg).(string)
+
+	info := &core.RequestInfo{
+		Query:   map[string]string{},
+		Headers: map[string]string{},
+		Body:    map[string]any{},
+		Method:  http.MethodPost,
+		Context: core.RequestInfoContextFunctionTrigger,
+	}
+
+	call := &invocation{
+		ctx:        ctx,
+		app:        app,
+		info:       info,
+		collection: function.Collection(),
+		function:   function.Id,
+		org:        org,
+		shared:     deployment(app).Store().Get(StoreKeyBases) != nil,
+	}
+
+	_, err := extruntime.Lookup(functionLang)(ctx, function.GetString(core.FieldNameSource), payload, call.host())
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return call, core.FunctionErrorTimeout, errors.New("the function did not finish within " + functionTimeout.String())
+	case err != nil:
+		return call, core.FunctionErrorFailed, err
+	}
+
+	return call, "", nil
+}
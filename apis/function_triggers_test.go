@@ -0,0 +1,274 @@
+package apis_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	_ "github.com/hanzoai/base/plugins/gojavm" // the "js" runtime a function runs on
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/types"
+)
+
+func saveFunction(t testing.TB, app core.App, name string, source string, triggers string) *core.Record {
+	t.Helper()
+
+	functions, err := app.FindCollectionByNameOrId(core.CollectionNameFunctions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	function := core.NewRecord(functions)
+	function.Id = name
+	function.Set(core.FieldNameSource, source)
+	function.Set(core.FieldNameTriggers, types.JSONRaw(triggers))
+	if err := app.Save(function); err != nil {
+		t.Fatal(err)
+	}
+
+	return function
+}
+
+func TestFunctionRecordTriggers(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	// the jobs are run by hand below
+	app.Cron().Stop()
+
+	ctx := context.Background()
+
+	// the function sink starts at the newest change
+	if err := app.ChangeRelay().Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	saveFunction(t, app, "onpost",
+		`function handler(p, base){
+			if (p.after.title == "boom") { throw new Error("boom") }
+			return base.one({collection: "demo2", id: p.recordId})
+		}`,
+		`[{"collection":"demo2","events":["create"],"filter":"title != 'skip'"}]`,
+	)
+
+	demo2, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(title string) *core.Record {
+		record := core.NewRecord(demo2)
+		record.Set("title", title)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	created := save("triggered")
+	failing := save("boom")
+	save("skip") // filtered out
+
+	// not an event the function wants
+	created.Set("title", "triggered2")
+	if err := app.Save(created); err != nil {
+		t.Fatal(err)
+	}
+
+	// twice, as after a cursor that failed to advance
+	for range 2 {
+		if err := app.ChangeRelay().Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	invocations, err := app.FindAllRecords(core.CollectionNameFunctionInvocations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invocations) != 2 {
+		t.Fatalf("Expected 2 invocations, got %d", len(invocations))
+	}
+
+	runCronJob(t, app, "__hzFunctionInvocations__")
+
+	find := func(recordId string) *core.Record {
+		invocation, err := app.FindFirstRecordByData(core.CollectionNameFunctionInvocations, "recordId", recordId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return invocation
+	}
+
+	succeeded := find(created.Id)
+	if succeeded.GetString("status") != core.FunctionInvocationSucceeded ||
+		succeeded.GetString("function") != "onpost" ||
+		succeeded.GetString("trigger") != core.RecordChangeCreate ||
+		succeeded.GetInt("attempts") != 1 {
+		t.Fatalf("Expected a succeeded invocation, got %v", succeeded)
+	}
+
+	failed := find(failing.Id)
+	if failed.GetString("status") != core.FunctionInvocationPending || failed.GetInt("attempts") != 1 {
+		t.Fatalf("Expected a pending invocation after 1 failed attempt, got %v", failed)
+	}
+	if failed.GetString("errorClass") != core.FunctionErrorFailed || !strings.Contains(failed.GetString("error"), "boom") {
+		t.Fatalf("Expected the error of the failed run, got %q", failed.GetString("error"))
+	}
+	if !failed.GetDateTime("nextAttempt").After(types.NowDateTime()) {
+		t.Fatalf("Expected the next attempt to be later, got %v", failed.GetDateTime("nextAttempt"))
+	}
+
+	// the last attempt fails it for good
+	failed.Set("attempts", 4)
+	failed.Set("nextAttempt", types.NowDateTime().Add(-1))
+	if err := app.SaveNoValidate(failed); err != nil {
+		t.Fatal(err)
+	}
+
+	runCronJob(t, app, "__hzFunctionInvocations__")
+
+	failed = find(failing.Id)
+	if failed.GetString("status") != core.FunctionInvocationFailed || failed.GetInt("attempts") != 5 {
+		t.Fatalf("Expected a failed invocation after the last attempt, got %v", failed)
+	}
+}
+
+func TestFunctionCronTriggers(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	app.Cron().Stop()
+
+	function := saveFunction(t, app, "nightly",
+		`function handler(p){ return p.cron }`,
+		`[{"cron":"0 3 * * *"}]`,
+	)
+
+	runCronJob(t, app, "__hzFunctionCron__nightly_0")
+
+	invocation, err := app.FindFirstRecordByData(core.CollectionNameFunctionInvocations, "function", "nightly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invocation.GetString("trigger") != "cron" || !strings.Contains(invocation.GetString("payload"), `"cron":"0 3 * * *"`) {
+		t.Fatalf("Expected a queued cron invocation, got %v", invocation)
+	}
+
+	runCronJob(t, app, "__hzFunctionInvocations__")
+
+	invocation, err = app.FindRecordById(core.CollectionNameFunctionInvocations, invocation.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invocation.GetString("status") != core.FunctionInvocationSucceeded {
+		t.Fatalf("Expected the cron invocation to succeed, got %v", invocation)
+	}
+
+	if err := app.Delete(function); err != nil {
+		t.Fatal(err)
+	}
+	if app.Cron().HasJob("__hzFunctionCron__nightly_0") {
+		t.Fatal("Expected the cron job to go with its function")
+	}
+}
+
+func TestFunctionTriggerReadsInItsOwnContext(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	app.Cron().Stop()
+
+	saveFunction(t, app, "private",
+		`function handler(p, base){ return base.list({collection: "demo1"}) }`,
+		`[{"cron":"0 3 * * *"}]`,
+	)
+
+	runCronJob(t, app, "__hzFunctionCron__private_0")
+	runCronJob(t, app, "__hzFunctionInvocations__")
+
+	// demo1 lists to the superusers only, and a triggered run is not one
+	invocation, err := app.FindFirstRecordByData(core.CollectionNameFunctionInvocations, "function", "private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invocation.GetString("status") != core.FunctionInvocationPending || !strings.Contains(invocation.GetString("error"), "demo1") {
+		t.Fatalf("Expected the read of demo1 to be refused, got %v", invocation)
+	}
+
+	demo1, err := app.FindCollectionByNameOrId("demo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	demo1.ListRule = types.Pointer(`@request.context = "functionTrigger"`)
+	if err := app.Save(demo1); err != nil {
+		t.Fatal(err)
+	}
+
+	invocation.Set("nextAttempt", types.NowDateTime().Add(-1))
+	if err := app.SaveNoValidate(invocation); err != nil {
+		t.Fatal(err)
+	}
+
+	runCronJob(t, app, "__hzFunctionInvocations__")
+
+	invocation, err = app.FindRecordById(core.CollectionNameFunctionInvocations, invocation.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invocation.GetString("status") != core.FunctionInvocationSucceeded || invocation.GetInt("rows") == 0 {
+		t.Fatalf("Expected the rule of the trigger context to admit the read, got %v", invocation)
+	}
+}
+
+func TestFunctionTriggersValidation(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	functions, err := app.FindCollectionByNameOrId(core.CollectionNameFunctions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		triggers    string
+		expectError bool
+	}{
+		{`null`, false},
+		{`[]`, false},
+		{`[{"collection":"demo2"}]`, false},
+		{`[{"collection":"demo2","events":["create","delete"],"filter":"title != ''"},{"cron":"@daily"}]`, false},
+		{`{"collection":"demo2"}`, true},
+		{`[{}]`, true},
+		{`[{"collection":"missing"}]`, true},
+		{`[{"collection":"_superusers"}]`, true},
+		{`[{"collection":"demo2","events":["view"]}]`, true},
+		{`[{"cron":"nope"}]`, true},
+		{`[{"collection":"demo2","cron":"@daily"}]`, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.triggers, func(t *testing.T) {
+			function := core.NewRecord(functions)
+			function.Id = "validated"
+			function.Set(core.FieldNameSource, `function handler(){}`)
+			function.Set(core.FieldNameTriggers, types.JSONRaw(s.triggers))
+
+			err := app.Validate(function)
+
+			hasErr := err != nil && strings.Contains(err.Error(), core.FieldNameTriggers)
+			if hasErr != s.expectError {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ import (
 	"github.com/hanzoai/base/plugins/extruntime"
 	"github.com/hanzoai/base/tools/router"
 	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
 )
 
 // Functions: code a Base keeps, run inside that Base, under the authority of
@@ -90,6 +92,7 @@ func bindFunctionsApi(app core.App, rg *router.RouterGroup[*core.RequestEvent])
 	sub.DELETE("/{name}", recordDelete(true, nil))
 
 	sub.POST("/{name}", functionInvoke)
+	sub.GET("/{name}/invocations", functionInvocations).Bind(RequireSuperuserAuth())
 }
 
 // onFunctions says what every address under /v1/functions is about: the
@@ -153,45 +156,160 @@ func functionInvoke(e *core.RequestEvent) error {
 	ctx, cancel := context.WithTimeout(e.Request.Context(), functionTimeout)
 	defer cancel()
 
-	call := &invocation{ctx: ctx, e: e, info: requestInfo, collection: collection}
+	org, _ := e.Get(RequestEventKeyOrg).(string)
+
+	call := &invocation{
+		ctx:        ctx,
+		e:          e,
+		app:        e.App,
+		info:       requestInfo,
+		collection: collection,
+		function:   record.Id,
+		org:        org,
+		shared:     e.Deployment().Store().Get(StoreKeyBases) != nil,
+	}
+
+	started := time.Now()
 
 	out, err := run(ctx, record.GetString(core.FieldNameSource), payload, call.host())
+
+	var answer error
+	errorClass := ""
+
 	switch {
 	case errors.Is(err, context.DeadlineExceeded):
-		return e.Error(http.StatusGatewayTimeout,
+		errorClass = core.FunctionErrorTimeout
+		answer = e.Error(http.StatusGatewayTimeout,
 			"The function did not finish within "+functionTimeout.String()+".", nil)
 	case err != nil && call.refusal() != nil:
 		// The host turned this caller down and the function did not handle it,
 		// so what the host decided is the answer. Reporting a server failure
 		// here would describe a limit doing exactly its job as the deployment
 		// being broken.
-		return call.refusal()
+		errorClass = core.FunctionErrorRefused
+		answer = call.refusal()
 	case err != nil:
 		// The source is the deployment's, so the failure is the deployment's:
 		// it is logged whole and answered as the server error it is.
 		e.App.Logger().Error("base: function failed", "function", record.Id, "error", err)
-		return e.InternalServerError("The function failed.", nil)
+		errorClass = core.FunctionErrorFailed
+		answer = e.InternalServerError("The function failed.", nil)
+	case len(out) > functionMaxResult:
+		errorClass = core.FunctionErrorTooLarge
+		err = errors.New("the function answered with more than " + strconv.Itoa(functionMaxResult) + " bytes")
+		answer = e.InternalServerError("The function answered with more than "+
+			strconv.Itoa(functionMaxResult)+" bytes.", nil)
 	}
 
-	if len(out) > functionMaxResult {
-		return e.InternalServerError("The function answered with more than "+
-			strconv.Itoa(functionMaxResult)+" bytes.", nil)
+	logFunctionCall(e, call, requestInfo, errorClass, err, time.Since(started))
+
+	if answer != nil {
+		return answer
 	}
 
 	return e.JSON(http.StatusOK, json.RawMessage(out))
 }
 
+// logFunctionCall writes an invoked run to the invocations log, which the
+// triggered runs are already in.
+//
+// The payload is not kept. A triggered run's payload is a change the log may
+// need to run again; an invoked run is never run again, and its payload is
+// whatever its caller sent, which is the caller's and not the log's.
+//
+// The log is the deployment's record rather than part of the answer, so a row
+// that fails to write is logged and the caller is answered all the same.
+func logFunctionCall(e *core.RequestEvent, call *invocation, requestInfo *core.RequestInfo, errorClass string, err error, d time.Duration) {
+	invocations, findErr := e.App.FindCachedCollectionByNameOrId(core.CollectionNameFunctionInvocations)
+	if findErr != nil {
+		finishFunctionInvocation(nil, call, errorClass, err, d)
+		return
+	}
+
+	row := core.NewRecord(invocations)
+	row.Set("function", call.function)
+	row.Set("trigger", functionTriggerHTTP)
+	row.Set("attempts", 1)
+	row.Set("finishedAt", types.NowDateTime())
+	if requestInfo.Auth != nil {
+		row.Set("caller", requestInfo.Auth.Id)
+		row.Set("callerCollection", requestInfo.Auth.Collection().Name)
+	}
+	if errorClass == "" {
+		row.Set("status", core.FunctionInvocationSucceeded)
+	} else {
+		row.Set("status", core.FunctionInvocationFailed)
+	}
+
+	finishFunctionInvocation(row, call, errorClass, err, d)
+
+	if saveErr := e.App.SaveNoValidate(row); saveErr != nil {
+		e.App.Logger().Warn("Failed to log a function invocation", "function", call.function, "error", saveErr.Error())
+	}
+}
+
+// finishFunctionInvocation writes onto row, when there is one, how a run that
+// took d ended and what it cost, and counts it in the process's metrics.
+func finishFunctionInvocation(row *core.Record, call *invocation, errorClass string, err error, d time.Duration) {
+	functionMetrics.observe(errorClass, d)
+
+	if row == nil {
+		return
+	}
+
+	row.Set("duration", d.Milliseconds())
+	row.Set("errorClass", errorClass)
+	row.Set("error", "")
+	if err != nil {
+		row.Set("error", err.Error())
+	}
+
+	rows, runs := 0, 0
+	if call != nil {
+		rows, runs = call.cost()
+	}
+	row.Set("rows", rows)
+	row.Set("runs", runs)
+}
+
 // invocation is one call: what the function running may ask for, and the one
 // answer the host is allowed to decide on the caller's behalf.
+//
+// Everything a call needs from its request is read off it before the function
+// runs, so a run that no request made — a trigger firing — is the same call
+// with e left nil.
 type invocation struct {
 	ctx        context.Context
-	e          *core.RequestEvent
+	e          *core.RequestEvent // nil for a triggered run
+	app        core.App
 	info       *core.RequestInfo
 	collection *core.Collection
+	function   string
+
+	// org is the org the call acts in, and shared whether the deployment serves
+	// more than one; see [invocation.start].
+	org    string
+	shared bool
 
 	mu      sync.Mutex
 	refused error
 	runs    int
+	rows    int
+}
+
+// read counts the rows a host read answered with, and passes the answer on.
+func (c *invocation) read(out []byte, rows int, err error) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rows += rows
+	return out, err
+}
+
+// cost reports the rows this call read and the runs it started.
+func (c *invocation) cost() (rows int, runs int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rows, c.runs
 }
 
 // count records that this call is about to start another run, and refuses once
@@ -211,7 +329,7 @@ func (c *invocation) count() error {
 // records, read as its caller would read them, and somewhere that is not this
 // process to run work.
 //
-// Both reads resolve everything from the request — the collection from e.App,
+// Both reads resolve everything from the call — the collection from its app,
 // which the credential already moved onto this org's Base, and the rule from the
 // caller's own identity — so a function renders what its caller may see and is
 // never a way around it. The third name is about cost rather than sight: it
@@ -219,8 +337,8 @@ func (c *invocation) count() error {
 // name instead of a result.
 func (c *invocation) host() extruntime.Host {
 	return extruntime.Host{
-		"list":  func(arg []byte) ([]byte, error) { return functionListRead(c.e.App, c.info, arg) },
-		"one":   func(arg []byte) ([]byte, error) { return functionOneRead(c.e.App, c.info, arg) },
+		"list":  func(arg []byte) ([]byte, error) { return c.read(functionListRead(c.app, c.info, arg)) },
+		"one":   func(arg []byte) ([]byte, error) { return c.read(functionOneRead(c.app, c.info, arg)) },
 		"start": c.start,
 	}
 }
@@ -261,12 +379,16 @@ const reservedLabel = "hanzo.ai/"
 // What comes back is a name. The work is not waited for and its result does not
 // return through here: a function is answering a request, a run is not, and
 // pretending they are the same call would make every run as short as a request.
+//
+// A triggered run has no client to limit, so only the per-call count holds it.
 func (c *invocation) start(arg []byte) ([]byte, error) {
-	if err := checkCollectionRateLimit(c.e, c.collection, "start"); err != nil {
-		return nil, c.refuse(err)
+	if c.e != nil {
+		if err := checkCollectionRateLimit(c.e, c.collection, "start"); err != nil {
+			return nil, c.refuse(err)
+		}
 	}
 
-	sandboxes, _ := c.e.App.Store().Get(StoreKeySandboxes).(Sandboxes)
+	sandboxes, _ := c.app.Store().Get(StoreKeySandboxes).(Sandboxes)
 	if sandboxes == nil {
 		return nil, errors.New("start: this deployment has nowhere to run work")
 	}
@@ -304,15 +426,15 @@ func (c *invocation) start(arg []byte) ([]byte, error) {
 	}
 
 	// The org is read off the request, where the credential resolved it before
-	// any function ran, and passed beside what was asked for rather than folded
-	// into it.
+	// any function ran, or off the org's Base for a triggered run, and passed
+	// beside what was asked for rather than folded into it.
 	//
 	// A deployment that tells orgs apart is one where a run belongs to somebody,
 	// so an unnamed org is refused there. A Base serving one tenant names no org
 	// on any request and never has — there is nobody for a run to be confused
 	// with — so the question is asked of the deployment rather than the request.
-	org, _ := c.e.Get(RequestEventKeyOrg).(string)
-	if org == "" && c.e.Deployment().Store().Get(StoreKeyBases) != nil {
+	org := c.org
+	if org == "" && c.shared {
 		return nil, errors.New("start: a run needs an org on a Base that serves many")
 	}
 
@@ -323,8 +445,8 @@ func (c *invocation) start(arg []byte) ([]byte, error) {
 		// the run did not start. This is the rule functionInvoke already applies
 		// to a failed function, applied one call earlier — a function may catch
 		// what start raises and answer its own caller with it.
-		c.e.App.Logger().Error("base: start failed",
-			"function", c.e.Request.PathValue("name"), "org", org, "error", err)
+		c.app.Logger().Error("base: start failed",
+			"function", c.function, "org", org, "error", err)
 		return nil, errors.New("start: the run did not start")
 	}
 
@@ -333,6 +455,40 @@ func (c *invocation) start(arg []byte) ([]byte, error) {
 	}{Id: id})
 }
 
+// functionInvocations lists the invocations log of one function, newest first
+// unless asked otherwise.
+//
+// It is the record list of the log pointed at one function, so the paging,
+// the filter and the sort are the ones every list has. The log holds rows as
+// the superuser reads them, so only a superuser reads it.
+func functionInvocations(e *core.RequestEvent) error {
+	name := e.Request.PathValue("name")
+
+	if _, err := e.App.FindRecordById(core.CollectionNameFunctions, name); err != nil {
+		return e.NotFoundError("", err)
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+
+	query := e.Request.URL.Query()
+	setViewFilter(query,
+		string(search.FilterData("function = {:function}").Bind(dbx.Params{"function": name})),
+		query.Get(search.FilterQueryParam),
+	)
+	if query.Get(search.SortQueryParam) == "" {
+		query.Set(search.SortQueryParam, "-created")
+	}
+
+	e.Request.URL.RawQuery = query.Encode()
+	e.Request.SetPathValue("collection", core.CollectionNameFunctionInvocations)
+	setViewRequestInfoQuery(requestInfo, query)
+
+	return recordsList(e)
+}
+
 // readInfo is the caller, presented as the GET this read is.
 //
 // The identity and the headers carry over unchanged, because they are the
@@ -345,7 +501,10 @@ func (c *invocation) start(arg []byte) ([]byte, error) {
 func readInfo(requestInfo *core.RequestInfo, query map[string]string) *core.RequestInfo {
 	out := requestInfo.Clone()
 	out.Method = http.MethodGet
-	out.Context = core.RequestInfoContextDefault
+	// a triggered run keeps its context, which is all a rule can know it by
+	if out.Context != core.RequestInfoContextFunctionTrigger {
+		out.Context = core.RequestInfoContextDefault
+	}
 	out.Body = map[string]any{}
 	out.Query = query
 	return out
@@ -371,40 +530,41 @@ func (r functionRead) collection(app core.App) (*core.Collection, error) {
 // functionOneRead answers with one record, or with null for a record the caller
 // may not view and for a record that is not there — the same two answers
 // /v1/collections gives, and in the same words, so which one it was cannot be
-// read off the result.
-func functionOneRead(app core.App, requestInfo *core.RequestInfo, arg []byte) ([]byte, error) {
+// read off the result. The count is of the rows answered, for the log.
+func functionOneRead(app core.App, requestInfo *core.RequestInfo, arg []byte) ([]byte, int, error) {
 	var in functionRead
 	if err := json.Unmarshal(arg, &in); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	collection, err := in.collection(app)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	read := readInfo(requestInfo, nil)
 
 	record, err := app.FindRecordById(collection, in.Id, viewGate(app, collection, read))
 	if err != nil || record == nil {
-		return []byte("null"), nil
+		return []byte("null"), 0, nil
 	}
 
 	if err := functionEnrich(app, read, []*core.Record{record}); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return json.Marshal(record)
+	out, err := json.Marshal(record)
+	return out, 1, err
 }
 
 // functionListRead answers with the rows of one page, under the collection's
-// list rule.
-func functionListRead(app core.App, requestInfo *core.RequestInfo, arg []byte) ([]byte, error) {
+// list rule, and with how many there are.
+func functionListRead(app core.App, requestInfo *core.RequestInfo, arg []byte) ([]byte, int, error) {
 	var in functionRead
 	if err := json.Unmarshal(arg, &in); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	collection, err := in.collection(app)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	read := readInfo(requestInfo, map[string]string{
@@ -415,11 +575,11 @@ func functionListRead(app core.App, requestInfo *core.RequestInfo, arg []byte) (
 	// The same refusal a client meets for the same filter. A function runs as
 	// its caller, so what its caller may not filter on, it may not either.
 	if err := checkForSuperuserOnlyRuleFields(read); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if collection.ListRule == nil && !read.HasSuperuserAuth() {
-		return nil, fmt.Errorf("only superusers can list collection %q records", collection.Name)
+		return nil, 0, fmt.Errorf("only superusers can list collection %q records", collection.Name)
 	}
 
 	query := app.RecordQuery(collection)
@@ -428,11 +588,16 @@ func functionListRead(app core.App, requestInfo *core.RequestInfo, arg []byte) (
 	if !read.HasSuperuserAuth() && collection.ListRule != nil && *collection.ListRule != "" {
 		expr, err := search.FilterData(*collection.ListRule).BuildExpr(resolver)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		query.AndWhere(expr)
 	}
 
+	if err := applyTrashFilter(resolver, collection, read, query); err != nil {
+		return nil, 0, err
+	}
+	applyPublishedFilter(collection, read, query)
+
 	resolver.SetAllowHiddenFields(read.HasSuperuserAuth())
 
 	perPage := in.PerPage
@@ -456,13 +621,14 @@ func functionListRead(app core.App, requestInfo *core.RequestInfo, arg []byte) (
 
 	records := []*core.Record{}
 	if _, err := search.NewProvider(resolver).Query(query).ParseAndExec(params.Encode(), &records); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if err := functionEnrich(app, read, records); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	return json.Marshal(records)
+	out, err := json.Marshal(records)
+	return out, len(records), err
 }
 
 // functionEnrich runs what the HTTP read runs before serializing: the
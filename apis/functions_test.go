@@ -302,3 +302,85 @@ func TestFunctionManagementIsTheCollectionsRules(t *testing.T) {
 	}
 	readAll.Test(t)
 }
+
+// Every call is in the log, with who made it, how it ended and what it cost,
+// and the log is the function's to read by name — for a superuser only.
+func TestFunctionInvocationsAreLogged(t *testing.T) {
+	t.Parallel()
+
+	app := seedFunctions(t)
+	defer app.Cleanup()
+
+	token, err := tests.GetUserAuthToken(app, "users", tests.TestUserID1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invoke(t, app, "titles", token, "", 200, `"mine"`)
+	invoke(t, app, "private", token, "", 500, `"status":500`)
+
+	succeeded, err := app.FindFirstRecordByFilter(core.CollectionNameFunctionInvocations, "function = 'titles'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if succeeded.GetString("status") != core.FunctionInvocationSucceeded ||
+		succeeded.GetString("trigger") != "http" ||
+		succeeded.GetString("caller") != tests.TestUserID1 ||
+		succeeded.GetString("callerCollection") != "users" ||
+		succeeded.GetInt("rows") != 1 {
+		t.Fatalf("Expected a succeeded call that read 1 row, got %v", succeeded)
+	}
+
+	failed, err := app.FindFirstRecordByFilter(core.CollectionNameFunctionInvocations, "function = 'private'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.GetString("status") != core.FunctionInvocationFailed ||
+		failed.GetString("errorClass") != core.FunctionErrorFailed ||
+		failed.GetString("error") == "" {
+		t.Fatalf("Expected a failed call with its error, got %v", failed)
+	}
+
+	superuser, err := tests.GetSuperuserAuthToken(app, "sywbhecnh46rhm0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:            "the log as a user",
+			Method:          http.MethodGet,
+			URL:             "/v1/functions/titles/invocations",
+			Headers:         map[string]string{"Authorization": token},
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"data":{}`},
+		},
+		{
+			Name:            "the log of a function that is not there",
+			Method:          http.MethodGet,
+			URL:             "/v1/functions/nosuch/invocations",
+			Headers:         map[string]string{"Authorization": superuser},
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"data":{}`},
+		},
+		{
+			Name:           "the log as a superuser",
+			Method:         http.MethodGet,
+			URL:            "/v1/functions/titles/invocations",
+			Headers:        map[string]string{"Authorization": superuser},
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"totalItems":1`,
+				`"function":"titles"`,
+				`"caller":"` + tests.TestUserID1 + `"`,
+			},
+			NotExpectedContent: []string{`"function":"private"`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.TestAppFactory = func(testing.TB) *tests.TestApp { return app }
+		scenario.DisableTestAppCleanup = true
+		scenario.Test(t)
+	}
+}
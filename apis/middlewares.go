@@ -225,6 +225,16 @@ const (
 	// StoreKeyBases holds the [Bases] of the deployment. Set by the org plugin.
 	StoreKeyBases = "bases"
 
+	// StoreKeyBaseOrg holds, on an org's Base, the org it serves. Set by the
+	// org plugin as it opens the Base, for what runs in that Base without a
+	// request to name the org: a triggered function.
+	StoreKeyBaseOrg = "baseOrg"
+
+	// StoreKeyDeployment holds, on an org's Base, the Base the process serves
+	// from. Set by the org plugin as it opens the Base, for what runs in that
+	// Base without a request to carry it (see [deployment]).
+	StoreKeyDeployment = "deployment"
+
 	// StoreKeySandboxes holds the [Sandboxes] of the deployment — where work a
 	// function starts actually runs. A deployment that sets none runs no work
 	// and says so; see [Sandboxes].
@@ -239,6 +249,17 @@ const (
 // Base with no other Base for a request to have missed.
 type Bases func(org string) (core.App, error)
 
+// deployment is the Base the process serves from, for what runs in app with
+// no request to ask (see [core.RequestEvent.Deployment]): the one the org
+// plugin recorded on an org's Base, or app itself, which is then the only
+// Base there is.
+func deployment(app core.App) core.App {
+	if d, ok := app.Store().Get(StoreKeyDeployment).(core.App); ok && d != nil {
+		return d
+	}
+	return app
+}
+
 // refusal is what a VERIFIED token produces when Base will not serve it.
 //
 // The distinction from an ordinary validation error is the whole point. A token
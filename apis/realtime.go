@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -80,6 +82,7 @@ func realtimeConnect(e *core.RequestEvent) error {
 		ce.App.SubscriptionsBroker().Register(ce.Client)
 		defer func() {
 			e.App.SubscriptionsBroker().Unregister(ce.Client.Id())
+			realtimeForgetQueries(e.App, ce.Client.Id())
 		}()
 
 		ce.App.Logger().Debug("Realtime connection established.", "clientId", ce.Client.Id())
@@ -212,12 +215,22 @@ func realtimeSetSubscriptions(e *core.RequestEvent) error {
 		// update auth state
 		e.Client.Set(RealtimeClientAuthKey, e.Auth)
 
+		previous := e.Client.Subscriptions()
+
 		// unsubscribe from any previous existing subscriptions
 		e.Client.Unsubscribe()
 
 		// subscribe to the new subscriptions
 		e.Client.Subscribe(e.Subscriptions...)
 
+		// a list query the caller may not run is refused as the list route
+		// refuses it, and leaves the client subscribed as it was
+		if err := realtimeWatchQueries(e.RequestEvent, e.Client); err != nil {
+			e.Client.Unsubscribe()
+			e.Client.Subscribe(slices.Collect(maps.Keys(previous))...)
+			return err
+		}
+
 		e.App.Logger().Debug(
 			"Realtime subscriptions updated.",
 			"clientId", e.Client.Id(),
@@ -323,7 +336,9 @@ func bindRealtimeEvents(app core.App) {
 	app.OnModelAfterCreateSuccess().Bind(&hook.Handler[*core.ModelEvent]{
 		Func: func(e *core.ModelEvent) error {
 			record := realtimeResolveRecord(e.App, e.Model, "")
-			if record != nil {
+
+			// a drafts collection record is broadcast from its first publish
+			if record != nil && record.IsPublished() {
 				err := realtimeBroadcastRecord(e.App, "create", record, false)
 				if err != nil {
 					app.Logger().Debug(
@@ -343,8 +358,8 @@ func bindRealtimeEvents(app core.App) {
 	app.OnModelAfterUpdateSuccess().Bind(&hook.Handler[*core.ModelEvent]{
 		Func: func(e *core.ModelEvent) error {
 			record := realtimeResolveRecord(e.App, e.Model, "")
-			if record != nil {
-				err := realtimeBroadcastRecord(e.App, "update", record, false)
+			if action := realtimeUpdateAction(record); action != "" {
+				err := realtimeBroadcastRecord(e.App, action, record, false)
 				if err != nil {
 					app.Logger().Debug(
 						"Failed to broadcast record update",
@@ -491,6 +506,37 @@ type recordData struct {
 	Action string `json:"action"`
 }
 
+// realtimeUpdateAction returns the action an update of record is broadcast
+// as, or an empty string if it is not broadcast at all.
+//
+// A trashed record is gone for the subscribers, as it is for the record API,
+// so moving a record to the trash reads as its delete, taking it out as its
+// create, and a change to a record that stays in the trash as nothing. A
+// record of a drafts collection that was never published is not there yet,
+// so its first publish reads as its create.
+func realtimeUpdateAction(record *core.Record) string {
+	if record == nil {
+		return ""
+	}
+
+	hidden := func(r *core.Record) bool {
+		return r.IsTrashed() || !r.IsPublished()
+	}
+
+	wasHidden := hidden(record.Original())
+
+	switch {
+	case hidden(record) && wasHidden:
+		return ""
+	case hidden(record):
+		return "delete"
+	case wasHidden:
+		return "create"
+	default:
+		return "update"
+	}
+}
+
 // Note: the optAccessCheckApp is there in case you want the access check
 // to be performed against different db app context (e.g. out of a transaction).
 // If set, it is expected that optAccessCheckApp instance is used for read-only operations to avoid deadlocks.
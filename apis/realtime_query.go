@@ -0,0 +1,845 @@
+package apis
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/hook"
+	"github.com/hanzoai/base/tools/picker"
+	"github.com/hanzoai/base/tools/router"
+	"github.com/hanzoai/base/tools/routine"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/subscriptions"
+)
+
+// Live list queries: a page of a records list, kept current over the realtime
+// stream.
+//
+// A client subscribes to `query/{collection}` with the list route's own
+// parameters in the topic's options — filter, sort, expand, fields, page,
+// perPage, skipTotal — and is sent the page as it stands, then a diff each time
+// a committed write changes it. The page is the list route's page: it is built
+// by listQuery, so the list rule, the trash and the drafts filters and the
+// resolver are the ones a GET of the same list would have met, and a query the
+// caller may not run is refused when it is subscribed, in the same words.
+//
+// Identical queries are one query. Two subscriptions that name the same
+// collection with the same options under the same auth — every guest watching
+// a public feed, every tab of one user — share one evaluation and one result,
+// and a diff is computed once for everyone who was sent the same version
+// before it. The auth is part of what makes a query identical because the list
+// rule is evaluated as it.
+//
+// A query's page can hang on any row its rule, filter, sort or expand reaches:
+// through a relation, a back-relation, an @collection join or the auth record.
+// Working out which rows those are would be the resolver's work done a second
+// time, and a second answer to "what does this list read" is one that can
+// disagree with the first. So every committed write marks every live query of
+// its Base stale, one refresher re-runs each of them once per burst, and a page
+// that did not change sends nothing.
+//
+// Each subscriber is sent its messages by its own goroutine, in order. One that
+// reads slowly is not queued for: it is sent the diff from the version it last
+// received to the current one whenever it is ready for another message, so a
+// client that falls behind skips versions rather than the stream backing up.
+//
+// The messages, sent under the subscription's own topic, are:
+//
+//	{"action":"snapshot","version":1,"page":1,"perPage":30,"totalItems":2,"totalPages":1,"items":[...]}
+//	{"action":"diff","version":3,"from":1,"page":1,...,"changes":[...]}
+//	{"action":"error","message":"..."}
+//
+// A change is one of
+//
+//	{"op":"remove","id":"...","index":4}            index in the page at "from"
+//	{"op":"insert","id":"...","index":0,"record":{}} index in the page at "version"
+//	{"op":"move","id":"...","from":3,"index":1}      from the old page to the new
+//	{"op":"update","id":"...","index":1,"record":{}} the row's new contents
+//
+// and the new page is the old one with its removed rows dropped, the inserted
+// and moved rows at their indexes, and the rows that no insert or move names
+// filling the remaining indexes in the order they were in. An error ends the
+// subscription; the client resubscribes to start over.
+
+const (
+	// liveQueryStoreKey names the per-Base table of live queries in the Base's store.
+	liveQueryStoreKey = "__hzLiveQueries__"
+
+	// liveQueryTopicPrefix prefixes the realtime topic of a live list query.
+	liveQueryTopicPrefix = "query/"
+
+	// liveQueryMaxPerBase caps the distinct live queries of a Base. Every one of
+	// them is re-run after every write, so the cap is on that work, not on the
+	// subscribers, who share them for free.
+	liveQueryMaxPerBase = 1000
+
+	// liveQueryMaxPerClient caps the distinct live queries one client may be
+	// attached to, so that a single connection can't take the Base's whole
+	// allowance and leave every other caller with none.
+	liveQueryMaxPerClient = 50
+)
+
+var (
+	errLiveQueryLimit       = errors.New("too many distinct list queries are live on this Base")
+	errLiveQueryClientLimit = errors.New("too many distinct list queries are live on this client")
+)
+
+func init() {
+	core.AppBindings.Register(bindLiveQueryEvents)
+}
+
+// bindLiveQueryEvents marks the live queries of a Base stale after each
+// committed write. The log rows are the one write no list reads.
+func bindLiveQueryEvents(app core.App) {
+	stale := func(e *core.ModelEvent) error {
+		if e.Model.TableName() != core.LogsTableName {
+			if l := liveQueriesIn(app); l != nil {
+				l.markStale()
+			}
+		}
+
+		return e.Next()
+	}
+
+	app.OnModelAfterCreateSuccess().Bind(&hook.Handler[*core.ModelEvent]{Func: stale, Priority: -99})
+	app.OnModelAfterUpdateSuccess().Bind(&hook.Handler[*core.ModelEvent]{Func: stale, Priority: -99})
+	app.OnModelAfterDeleteSuccess().Bind(&hook.Handler[*core.ModelEvent]{Func: stale, Priority: -99})
+}
+
+// realtimeWatchQueries brings the live queries client is attached to in line
+// with its `query/` subscriptions: it attaches those it does not have yet,
+// running the queries nobody else has, and detaches the rest.
+//
+// Every new query runs before anything is attached, so on an error client is
+// still attached to what it was before, and the caller can put its
+// subscriptions back the same way.
+func realtimeWatchQueries(e *core.RequestEvent, client subscriptions.Client) error {
+	subs := client.Subscriptions(liveQueryTopicPrefix)
+
+	l := liveQueriesIn(e.App)
+	if l == nil {
+		if len(subs) == 0 {
+			return nil // nothing to attach or to detach from
+		}
+		l = liveQueriesOf(e.App)
+	}
+
+	auth, _ := client.Get(RealtimeClientAuthKey).(*core.Record)
+	chosen := make(map[string]*liveQuery, len(subs))
+	keys := make(map[string]string, len(subs))
+
+	for sub, options := range subs {
+		name, _, _ := strings.Cut(strings.TrimPrefix(sub, liveQueryTopicPrefix), "?")
+
+		collection, err := e.App.FindCachedCollectionByNameOrId(name)
+		if err != nil || collection == nil {
+			return e.NotFoundError("Missing collection context.", err)
+		}
+
+		key := liveQueryKey(collection.Id, auth, options)
+		keys[sub] = key
+		if chosen[key] != nil {
+			continue
+		}
+
+		// attach counts them again; this is so that the queries past the
+		// cap are not run first
+		if len(chosen) >= liveQueryMaxPerClient {
+			return e.TooManyRequestsError(errLiveQueryClientLimit.Error(), nil)
+		}
+		if q := l.lookup(key); q != nil {
+			chosen[key] = q
+			continue
+		}
+
+		if err := checkCollectionRateLimit(e, collection, "list"); err != nil {
+			return err
+		}
+
+		q := newLiveQuery(key, collection, auth, options)
+		gen := l.generation()
+		result, err := q.evaluate(l.app)
+		if err != nil {
+			return firstApiError(err, e.BadRequestError("", err))
+		}
+		result.gen = gen
+		q.set(result)
+		chosen[key] = q
+	}
+
+	stale, err := l.attach(client, keys, chosen)
+	if err != nil {
+		return e.TooManyRequestsError(err.Error(), nil)
+	}
+
+	// a write committed while a result was run, or while its query had nobody
+	// attached and was not refreshed, is one that result may be missing
+	if stale {
+		l.markStale()
+	}
+
+	return nil
+}
+
+// realtimeForgetQueries detaches a client that is gone from every live query.
+func realtimeForgetQueries(app core.App, clientId string) {
+	if l := liveQueriesIn(app); l != nil {
+		l.forget(clientId)
+	}
+}
+
+// liveQueries are the live list queries of a Base, by key, and the subscribers
+// attached to them, by client and topic.
+//
+// The table's lock is taken before a query's own, never after it.
+type liveQueries struct {
+	app core.App
+
+	mu      sync.Mutex
+	queries map[string]*liveQuery
+	clients map[string]map[string]*liveSubscriber
+	running bool
+
+	// gen counts the stale marks, so a result can tell whether a write has
+	// committed since the mark it was run after.
+	gen uint64
+
+	// stale holds at most one pending pass, so the writes that commit while the
+	// refresher is busy cost it one more pass, not one each.
+	stale chan struct{}
+}
+
+func liveQueriesOf(app core.App) *liveQueries {
+	return app.Store().GetOrSet(liveQueryStoreKey, func() any {
+		return &liveQueries{
+			app:     app,
+			queries: map[string]*liveQuery{},
+			clients: map[string]map[string]*liveSubscriber{},
+			stale:   make(chan struct{}, 1),
+		}
+	}).(*liveQueries)
+}
+
+// liveQueriesIn is liveQueriesOf for a Base that may have none, which is not
+// worth making a table to find out.
+func liveQueriesIn(app core.App) *liveQueries {
+	l, _ := app.Store().Get(liveQueryStoreKey).(*liveQueries)
+	return l
+}
+
+func (l *liveQueries) lookup(key string) *liveQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.queries[key]
+}
+
+func (l *liveQueries) generation() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.gen
+}
+
+// attach makes client's subscribers the ones in keys, a subscription topic to
+// the key of its query, each attached to the query chosen for its key — unless
+// the table has another one for the key by now, which wins, so that there is
+// never more than one. It reports whether any of them holds a result older
+// than the last stale mark.
+func (l *liveQueries) attach(client subscriptions.Client, keys map[string]string, chosen map[string]*liveQuery) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(chosen) > liveQueryMaxPerClient {
+		return false, errLiveQueryClientLimit
+	}
+
+	added := 0
+	for key := range chosen {
+		if l.queries[key] == nil {
+			added++
+		}
+	}
+	if added > 0 && len(l.queries)+added > liveQueryMaxPerBase {
+		return false, errLiveQueryLimit
+	}
+
+	current := l.clients[client.Id()]
+	next := make(map[string]*liveSubscriber, len(keys))
+	stale := false
+
+	for sub, key := range keys {
+		q := l.queries[key]
+		if q == nil {
+			q = chosen[key]
+			// a failed query is not run again; the subscriber is only told
+			if !q.current().failed() {
+				l.queries[key] = q
+			}
+		}
+
+		if s := current[sub]; s != nil && s.query == q {
+			next[sub] = s
+			continue
+		}
+
+		if q.current().gen != l.gen {
+			stale = true
+		}
+
+		s := &liveSubscriber{
+			client: client,
+			sub:    sub,
+			query:  q,
+			wake:   make(chan struct{}, 1),
+			done:   make(chan struct{}),
+		}
+		q.add(s)
+		next[sub] = s
+
+		routine.FireAndForget(s.run)
+		s.notify()
+	}
+
+	for sub, s := range current {
+		if next[sub] != s {
+			l.detach(s)
+		}
+	}
+
+	if len(next) == 0 {
+		delete(l.clients, client.Id())
+	} else {
+		l.clients[client.Id()] = next
+	}
+
+	return stale, nil
+}
+
+func (l *liveQueries) forget(clientId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, s := range l.clients[clientId] {
+		l.detach(s)
+	}
+	delete(l.clients, clientId)
+}
+
+// detach stops s, and drops its query once nobody is attached to it.
+// The caller holds the table's lock.
+func (l *liveQueries) detach(s *liveSubscriber) {
+	close(s.done)
+
+	if s.query.remove(s) == 0 && l.queries[s.query.key] == s.query {
+		delete(l.queries, s.query.key)
+	}
+}
+
+// markStale asks for every live query to be run again, starting the refresher
+// if it is not running.
+func (l *liveQueries) markStale() {
+	l.mu.Lock()
+	l.gen++
+	if len(l.queries) == 0 {
+		l.mu.Unlock()
+		return
+	}
+	if !l.running {
+		l.running = true
+		routine.FireAndForget(l.refresh)
+	}
+	l.mu.Unlock()
+
+	select {
+	case l.stale <- struct{}{}:
+	default:
+	}
+}
+
+// refresh runs every live query once per pending pass, and returns once a pass
+// finds none left.
+func (l *liveQueries) refresh() {
+	defer func() {
+		l.mu.Lock()
+		l.running = false
+		l.mu.Unlock()
+	}()
+
+	for range l.stale {
+		l.mu.Lock()
+		queries := slices.Collect(maps.Values(l.queries))
+		gen := l.gen
+		l.mu.Unlock()
+
+		if len(queries) == 0 {
+			return
+		}
+
+		for _, q := range queries {
+			result, err := q.evaluate(l.app)
+			if err != nil {
+				l.fail(q, err)
+				continue
+			}
+			result.gen = gen
+			q.set(result)
+		}
+	}
+}
+
+// fail ends q: its subscribers are sent the error, and the next subscription
+// to the same query runs it anew.
+func (l *liveQueries) fail(q *liveQuery, err error) {
+	l.app.Logger().Debug("Live list query failed", "collectionId", q.collectionId, "error", err)
+
+	l.mu.Lock()
+	if l.queries[q.key] == q {
+		delete(l.queries, q.key)
+	}
+	l.mu.Unlock()
+
+	q.set(&liveResult{err: firstApiError(err, router.NewBadRequestError("", err)).Message})
+}
+
+// liveQuery is one distinct list query and its latest result.
+type liveQuery struct {
+	key          string
+	collectionId string
+	auth         *core.Record
+	query        map[string]string
+	headers      map[string]string
+
+	mu          sync.Mutex
+	subscribers map[*liveSubscriber]struct{}
+	version     int
+	result      *liveResult
+}
+
+func newLiveQuery(key string, collection *core.Collection, auth *core.Record, options subscriptions.SubscriptionOptions) *liveQuery {
+	return &liveQuery{
+		key:          key,
+		collectionId: collection.Id,
+		auth:         auth,
+		query:        options.Query,
+		headers:      options.Headers,
+		subscribers:  map[*liveSubscriber]struct{}{},
+	}
+}
+
+// liveQueryKey is what two subscriptions have to share to be one query: the
+// collection, the auth they are evaluated as, and the options in full, which
+// the rules can read as @request.query.* and @request.headers.*.
+func liveQueryKey(collectionId string, auth *core.Record, options subscriptions.SubscriptionOptions) string {
+	var authRef string
+	if auth != nil {
+		authRef = auth.Collection().Id + "/" + auth.Id
+	}
+
+	// a map marshals with its keys sorted, so the order the options were
+	// written in makes no difference; an empty one is no options at all
+	orNil := func(m map[string]string) map[string]string {
+		if len(m) == 0 {
+			return nil
+		}
+		return m
+	}
+
+	raw, _ := json.Marshal([]any{collectionId, authRef, orNil(options.Query), orNil(options.Headers)})
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// evaluate runs q as the list route would, and serializes its page as the list
+// route would answer it.
+//
+// The collection and the auth record are read again each time, so a changed
+// rule or auth record is the one the query meets, and a deleted one ends it.
+func (q *liveQuery) evaluate(app core.App) (*liveResult, error) {
+	collection, err := app.FindCachedCollectionByNameOrId(q.collectionId)
+	if err != nil || collection == nil {
+		return nil, router.NewNotFoundError("Missing collection context.", err)
+	}
+
+	requestInfo := &core.RequestInfo{
+		Context: core.RequestInfoContextRealtime,
+		Method:  "GET",
+		Query:   q.query,
+		Headers: q.headers,
+	}
+
+	if q.auth != nil {
+		auth, err := app.FindRecordById(q.auth.Collection().Id, q.auth.Id)
+		if err != nil {
+			return nil, router.NewForbiddenError("The subscription's auth record is gone.", err)
+		}
+		requestInfo.Auth = auth
+	}
+
+	query, resolver, err := listQuery(app, collection, requestInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	searchProvider := search.NewProvider(resolver).Query(query)
+
+	// count over the insertion-order column where the engine has one, as
+	// recordsList does
+	if row := app.Dialect().Row(); row != "" && !collection.IsView() {
+		searchProvider.CountCol(row)
+	}
+
+	params := url.Values{}
+	for k, v := range q.query {
+		params.Set(k, v)
+	}
+
+	records := []*core.Record{}
+	page, err := searchProvider.ParseAndExec(params.Encode(), &records)
+	if err != nil {
+		return nil, err
+	}
+
+	err = triggerRecordEnrichHooks(app, requestInfo, records, func() error {
+		var expands []string
+		if param := requestInfo.Query[expandQueryParam]; param != "" {
+			expands = strings.Split(param, ",")
+		}
+
+		if err := defaultEnrichRecords(app, requestInfo, records, expands...); err != nil {
+			// only log because it is not critical
+			app.Logger().Warn("failed to apply default enriching", "error", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &liveResult{
+		livePage: livePage{
+			Page:       page.Page,
+			PerPage:    page.PerPage,
+			TotalItems: page.TotalItems,
+			TotalPages: page.TotalPages,
+		},
+		ids:  make([]string, len(records)),
+		rows: make(map[string]json.RawMessage, len(records)),
+	}
+
+	rawFields := requestInfo.Query[fieldsQueryParam]
+	for i, record := range records {
+		var data any = record
+		if rawFields != "" {
+			if data, err = picker.Pick(record, rawFields); err != nil {
+				return nil, err
+			}
+		}
+
+		row, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		result.ids[i] = record.Id
+		result.rows[record.Id] = row
+	}
+
+	return result, nil
+}
+
+// set makes result q's current one and wakes its subscribers, unless it is the
+// page q already has, which only learns that it is current as of result.
+func (q *liveQuery) set(result *liveResult) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.result != nil && q.result.equal(result) {
+		q.result.gen = max(q.result.gen, result.gen)
+		return
+	}
+
+	q.version++
+	result.version = q.version
+	q.result = result
+
+	for s := range q.subscribers {
+		s.notify()
+	}
+}
+
+func (q *liveQuery) current() *liveResult {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.result
+}
+
+func (q *liveQuery) add(s *liveSubscriber) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.subscribers[s] = struct{}{}
+}
+
+// remove detaches s and returns how many subscribers are left.
+func (q *liveQuery) remove(s *liveSubscriber) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.subscribers, s)
+
+	return len(q.subscribers)
+}
+
+// liveSubscriber is one client's subscription to a live query.
+type liveSubscriber struct {
+	client subscriptions.Client
+	sub    string
+	query  *liveQuery
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func (s *liveSubscriber) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run sends s its messages, one at a time: the snapshot first, then, each
+// time it is woken, the diff from what it was last sent to what is current.
+func (s *liveSubscriber) run() {
+	var sent *liveResult
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		current := s.query.current()
+		if current == nil || current == sent {
+			continue
+		}
+
+		s.client.Send(subscriptions.Message{
+			Name: s.sub,
+			Data: current.messageFrom(sent),
+		})
+		sent = current
+
+		if current.failed() {
+			return
+		}
+	}
+}
+
+// livePage is where a result is in the list, as the list route reports it.
+type livePage struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"perPage"`
+	TotalItems int `json:"totalItems"`
+	TotalPages int `json:"totalPages"`
+}
+
+// liveResult is one version of a live query's page: the ids in order and each
+// row as it is sent, or the error that ended the query. A result is not
+// changed once it is set, apart from gen and the messages made from it.
+type liveResult struct {
+	livePage
+
+	version int
+	gen     uint64
+	ids     []string
+	rows    map[string]json.RawMessage
+	err     string
+
+	// messages are the messages sent from this result, by the version the
+	// subscriber had before it, so everyone who had the same one shares a diff.
+	mu       sync.Mutex
+	messages map[int][]byte
+}
+
+func (r *liveResult) failed() bool {
+	return r != nil && r.err != ""
+}
+
+func (r *liveResult) equal(other *liveResult) bool {
+	if r.err != "" || other.err != "" {
+		return r.err == other.err
+	}
+
+	return r.livePage == other.livePage &&
+		slices.Equal(r.ids, other.ids) &&
+		maps.EqualFunc(r.rows, other.rows, func(a, b json.RawMessage) bool {
+			return string(a) == string(b)
+		})
+}
+
+type liveSnapshotMessage struct {
+	Action  string `json:"action"`
+	Version int    `json:"version"`
+	livePage
+	Items []json.RawMessage `json:"items"`
+}
+
+type liveDiffMessage struct {
+	Action  string `json:"action"`
+	Version int    `json:"version"`
+	From    int    `json:"from"`
+	livePage
+	Changes []liveChange `json:"changes"`
+}
+
+type liveErrorMessage struct {
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// liveChange is one row's change between two pages; see the top of the file.
+type liveChange struct {
+	Op     string          `json:"op"`
+	Id     string          `json:"id"`
+	Index  int             `json:"index"`
+	From   *int            `json:"from,omitempty"`
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// messageFrom is the message that takes a subscriber that was sent prev to r:
+// the snapshot when it was sent nothing, or nothing it can build on.
+func (r *liveResult) messageFrom(prev *liveResult) []byte {
+	from := 0
+	if prev != nil && !prev.failed() {
+		from = prev.version
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if data, ok := r.messages[from]; ok {
+		return data
+	}
+
+	var msg any
+	switch {
+	case r.failed():
+		msg = liveErrorMessage{Action: "error", Message: r.err}
+	case from == 0:
+		items := make([]json.RawMessage, len(r.ids))
+		for i, id := range r.ids {
+			items[i] = r.rows[id]
+		}
+		msg = liveSnapshotMessage{Action: "snapshot", Version: r.version, livePage: r.livePage, Items: items}
+	default:
+		msg = liveDiffMessage{Action: "diff", Version: r.version, From: from, livePage: r.livePage, Changes: liveDiff(prev, r)}
+	}
+
+	data, _ := json.Marshal(msg)
+
+	if r.messages == nil {
+		r.messages = map[int][]byte{}
+	}
+	r.messages[from] = data
+
+	return data
+}
+
+// liveDiff returns the changes that take the page prev to the page next.
+//
+// The rows in both that keep their order are the longest run of them whose
+// indexes in prev increase along next; they are left where they are, and every
+// other row in both is a move. Removes come first, last to first, then the
+// rest in the order of next.
+func liveDiff(prev, next *liveResult) []liveChange {
+	prevAt := make(map[string]int, len(prev.ids))
+	for i, id := range prev.ids {
+		prevAt[id] = i
+	}
+	nextAt := make(map[string]int, len(next.ids))
+	for i, id := range next.ids {
+		nextAt[id] = i
+	}
+
+	changes := []liveChange{}
+
+	for i := len(prev.ids) - 1; i >= 0; i-- {
+		if _, ok := nextAt[prev.ids[i]]; !ok {
+			changes = append(changes, liveChange{Op: "remove", Id: prev.ids[i], Index: i})
+		}
+	}
+
+	var kept []int
+	for _, id := range next.ids {
+		if j, ok := prevAt[id]; ok {
+			kept = append(kept, j)
+		}
+	}
+	stays := longestIncreasing(kept)
+
+	k := 0
+	for i, id := range next.ids {
+		j, ok := prevAt[id]
+		if !ok {
+			changes = append(changes, liveChange{Op: "insert", Id: id, Index: i, Record: next.rows[id]})
+			continue
+		}
+
+		if !stays[k] {
+			changes = append(changes, liveChange{Op: "move", Id: id, Index: i, From: &j})
+		}
+		k++
+
+		if string(prev.rows[id]) != string(next.rows[id]) {
+			changes = append(changes, liveChange{Op: "update", Id: id, Index: i, Record: next.rows[id]})
+		}
+	}
+
+	return changes
+}
+
+// longestIncreasing marks the elements of one longest strictly increasing
+// subsequence of seq.
+func longestIncreasing(seq []int) []bool {
+	// tails[n] is the index of the smallest last element of an increasing
+	// subsequence of length n+1 seen so far
+	tails := []int{}
+	prev := make([]int, len(seq))
+
+	for i, v := range seq {
+		n := sort.Search(len(tails), func(n int) bool { return seq[tails[n]] >= v })
+
+		prev[i] = -1
+		if n > 0 {
+			prev[i] = tails[n-1]
+		}
+
+		if n == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[n] = i
+		}
+	}
+
+	in := make([]bool, len(seq))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+			in[i] = true
+		}
+	}
+
+	return in
+}
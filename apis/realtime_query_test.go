@@ -0,0 +1,271 @@
+package apis
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/subscriptions"
+)
+
+// page builds a result from "id" or "id:contents" entries.
+func page(entries ...string) *liveResult {
+	r := &liveResult{rows: map[string]json.RawMessage{}}
+	for _, entry := range entries {
+		id, contents, _ := strings.Cut(entry, ":")
+		r.ids = append(r.ids, id)
+		r.rows[id] = json.RawMessage(`"` + contents + `"`)
+	}
+	return r
+}
+
+// applyDiff is what a client does with a diff, by the rule at the top of
+// realtime_query.go: drop the removed rows, put the inserted and moved ones at
+// their indexes, and fill the rest with the other rows in the order they were.
+func applyDiff(t *testing.T, prev *liveResult, changes []liveChange, size int) ([]string, map[string]string) {
+	t.Helper()
+
+	removed := map[string]bool{}
+	placed := map[string]bool{}
+	out := make([]string, size)
+	rows := map[string]string{}
+	for id, row := range prev.rows {
+		rows[id] = string(row)
+	}
+
+	for _, c := range changes {
+		switch c.Op {
+		case "remove":
+			if prev.ids[c.Index] != c.Id {
+				t.Fatalf("remove %s at %d, where %s was", c.Id, c.Index, prev.ids[c.Index])
+			}
+			removed[c.Id] = true
+			delete(rows, c.Id)
+		case "insert", "move":
+			if c.Op == "move" && prev.ids[*c.From] != c.Id {
+				t.Fatalf("move %s from %d, where %s was", c.Id, *c.From, prev.ids[*c.From])
+			}
+			if out[c.Index] != "" {
+				t.Fatalf("%s placed at %d, which %s already holds", c.Id, c.Index, out[c.Index])
+			}
+			out[c.Index] = c.Id
+			placed[c.Id] = true
+			if c.Record != nil {
+				rows[c.Id] = string(c.Record)
+			}
+		case "update":
+			rows[c.Id] = string(c.Record)
+		default:
+			t.Fatalf("unknown op %q", c.Op)
+		}
+	}
+
+	i := 0
+	for _, id := range prev.ids {
+		if removed[id] || placed[id] {
+			continue
+		}
+		for out[i] != "" {
+			i++
+		}
+		out[i] = id
+	}
+
+	return out, rows
+}
+
+func TestLiveDiff(t *testing.T) {
+	scenarios := []struct {
+		name  string
+		prev  *liveResult
+		next  *liveResult
+		moves int
+	}{
+		{"nothing", page("a", "b"), page("a", "b"), 0},
+		{"from empty", page(), page("a", "b"), 0},
+		{"to empty", page("a", "b"), page(), 0},
+		{"insert in the middle", page("a", "c"), page("a", "b", "c"), 0},
+		{"remove and update", page("a", "b:1", "c"), page("b:2", "c"), 0},
+		// one row from the front to the back is one move, not three
+		{"rotate", page("a", "b", "c", "d"), page("b", "c", "d", "a"), 1},
+		{"swap", page("a", "b", "c", "d"), page("a", "c", "b", "d"), 1},
+		{"reverse", page("a", "b", "c", "d"), page("d", "c", "b", "a"), 3},
+		{"everything at once", page("a", "b", "c:1", "d", "e"), page("f", "c:2", "a", "e", "g"), 1},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			changes := liveDiff(s.prev, s.next)
+
+			got, rows := applyDiff(t, s.prev, changes, len(s.next.ids))
+			if !slices.Equal(got, s.next.ids) {
+				t.Fatalf("the diff makes %v of %v, want %v", got, s.prev.ids, s.next.ids)
+			}
+			for id, row := range s.next.rows {
+				if rows[id] != string(row) {
+					t.Errorf("row %s is %s after the diff, want %s", id, rows[id], row)
+				}
+			}
+
+			moves := 0
+			for _, c := range changes {
+				if c.Op == "move" {
+					moves++
+				}
+			}
+			if moves != s.moves {
+				t.Errorf("%d moves, want %d: %+v", moves, s.moves, changes)
+			}
+		})
+	}
+}
+
+// Any page to any other, which is what a subscriber that skipped versions is
+// sent.
+func TestLiveDiffShuffled(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pool := strings.Split("abcdefghijklmnopqrst", "")
+
+	for range 500 {
+		pick := func() *liveResult {
+			ids := slices.Clone(pool)
+			rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+			entries := ids[:rng.Intn(len(ids))]
+			for i, id := range entries {
+				entries[i] = id + ":" + string(rune('0'+rng.Intn(2)))
+			}
+			return page(entries...)
+		}
+
+		prev, next := pick(), pick()
+		got, rows := applyDiff(t, prev, liveDiff(prev, next), len(next.ids))
+		if !slices.Equal(got, next.ids) {
+			t.Fatalf("the diff makes %v of %v, want %v", got, prev.ids, next.ids)
+		}
+		for id, row := range next.rows {
+			if rows[id] != string(row) {
+				t.Fatalf("row %s is %s after the diff, want %s", id, rows[id], row)
+			}
+		}
+	}
+}
+
+// Subscriptions are one query when they would list the same rows: the options
+// in any order, but the same collection and the same auth.
+func TestLiveQueryKey(t *testing.T) {
+	users := core.NewAuthCollection("users")
+	users.Id = "users_id"
+
+	alice := core.NewRecord(users)
+	alice.Id = "alice"
+	bob := core.NewRecord(users)
+	bob.Id = "bob"
+
+	options := func(query map[string]string) subscriptions.SubscriptionOptions {
+		return subscriptions.SubscriptionOptions{Query: query, Headers: map[string]string{}}
+	}
+
+	key := liveQueryKey("posts_id", alice, options(map[string]string{"sort": "-created", "filter": "a = 1"}))
+
+	if liveQueryKey("posts_id", alice, options(map[string]string{"filter": "a = 1", "sort": "-created"})) != key {
+		t.Error("the same options in another order are another query")
+	}
+	if liveQueryKey("posts_id", bob, options(map[string]string{"sort": "-created", "filter": "a = 1"})) == key {
+		t.Error("another auth is the same query")
+	}
+	if liveQueryKey("posts_id", nil, options(map[string]string{"sort": "-created", "filter": "a = 1"})) == key {
+		t.Error("a guest is the same query as a user")
+	}
+	if liveQueryKey("notes_id", alice, options(map[string]string{"sort": "-created", "filter": "a = 1"})) == key {
+		t.Error("another collection is the same query")
+	}
+	if liveQueryKey("posts_id", nil, options(nil)) != liveQueryKey("posts_id", nil, subscriptions.SubscriptionOptions{}) {
+		t.Error("no options and empty options are different queries")
+	}
+}
+
+// A client is attached to at most liveQueryMaxPerClient distinct queries, and
+// the ones it shares with another subscription of its own count once.
+func TestLiveQueriesAttachCapsAClient(t *testing.T) {
+	posts := core.NewBaseCollection("posts")
+
+	l := &liveQueries{
+		queries: map[string]*liveQuery{},
+		clients: map[string]map[string]*liveSubscriber{},
+		stale:   make(chan struct{}, 1),
+	}
+
+	watch := func(client subscriptions.Client, n int) error {
+		keys := map[string]string{}
+		chosen := map[string]*liveQuery{}
+		for i := range n {
+			options := subscriptions.SubscriptionOptions{Query: map[string]string{"page": strconv.Itoa(i)}}
+			key := liveQueryKey(posts.Id, nil, options)
+
+			q := newLiveQuery(key, posts, nil, options)
+			q.set(page())
+
+			// every query twice, under two topics
+			keys["query/posts?"+strconv.Itoa(i)] = key
+			keys["query/posts?again"+strconv.Itoa(i)] = key
+			chosen[key] = q
+		}
+
+		_, err := l.attach(client, keys, chosen)
+		return err
+	}
+
+	// discarded, so the snapshots are dropped rather than waited on
+	full := subscriptions.NewDefaultClient()
+	full.Discard()
+	defer l.forget(full.Id())
+
+	if err := watch(full, liveQueryMaxPerClient); err != nil {
+		t.Fatalf("expected %d queries to be attached, got %v", liveQueryMaxPerClient, err)
+	}
+
+	over := subscriptions.NewDefaultClient()
+	over.Discard()
+	defer l.forget(over.Id())
+
+	if err := watch(over, liveQueryMaxPerClient+1); !errors.Is(err, errLiveQueryClientLimit) {
+		t.Fatalf("expected errLiveQueryClientLimit, got %v", err)
+	}
+	if l.clients[over.Id()] != nil {
+		t.Fatal("expected the client over the cap to be attached to nothing")
+	}
+}
+
+// Subscribers that were sent the same version share the message that brings
+// them current, and one that was sent nothing is sent the snapshot.
+func TestLiveResultMessages(t *testing.T) {
+	prev, next := page("a", "b"), page("b", "c")
+	prev.version, next.version = 1, 2
+
+	diff := next.messageFrom(prev)
+	if &next.messageFrom(prev)[0] != &diff[0] {
+		t.Error("the same diff was made twice")
+	}
+
+	var got struct {
+		Action string
+		From   int
+	}
+	if err := json.Unmarshal(diff, &got); err != nil || got.Action != "diff" || got.From != 1 {
+		t.Errorf("the diff from version 1 is %s", diff)
+	}
+
+	if err := json.Unmarshal(next.messageFrom(nil), &got); err != nil || got.Action != "snapshot" {
+		t.Errorf("the message for a new subscriber is %s", next.messageFrom(nil))
+	}
+
+	failed := &liveResult{version: 3, err: "gone"}
+	if err := json.Unmarshal(failed.messageFrom(next), &got); err != nil || got.Action != "error" {
+		t.Errorf("the message for a failed query is %s", failed.messageFrom(next))
+	}
+}
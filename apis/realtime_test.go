@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"slices"
 	"strings"
 	"sync"
@@ -940,3 +941,184 @@ func TestRealtimeProcessBasePublishesOnce(t *testing.T) {
 		t.Fatalf("one write sent the subscriber %v, want one create", got)
 	}
 }
+
+// A list query is the list route's page, sent as a snapshot and then kept
+// current with diffs, and one the caller may not run is refused as the list
+// route refuses it.
+func TestRealtimeListQuery(t *testing.T) {
+	client := subscriptions.NewDefaultClient()
+
+	resetClient := func() {
+		client.Unsubscribe()
+		client.Set(apis.RealtimeClientAuthKey, nil)
+	}
+
+	// posts hides its "hidden" rows from everyone, and drafts lists for no one
+	// but the superusers
+	seed := func(t testing.TB, app *tests.TestApp) *core.Collection {
+		posts := core.NewBaseCollection("posts")
+		posts.ListRule = types.Pointer(`title != "hidden"`)
+		posts.Fields.Add(&core.TextField{Name: "title"})
+		if err := app.Save(posts); err != nil {
+			t.Fatal(err)
+		}
+
+		drafts := core.NewBaseCollection("drafts")
+		if err := app.Save(drafts); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, title := range []string{"b", "hidden"} {
+			record := core.NewRecord(posts)
+			record.Set("title", title)
+			if err := app.Save(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return posts
+	}
+
+	topic := func(collection string, query map[string]string) string {
+		options, _ := json.Marshal(map[string]any{"query": query})
+		return "query/" + collection + "?options=" + url.QueryEscape(string(options))
+	}
+
+	body := func(subs ...string) *strings.Reader {
+		raw, _ := json.Marshal(map[string]any{"clientId": client.Id(), "subscriptions": subs})
+		return strings.NewReader(string(raw))
+	}
+
+	type message struct {
+		Action  string
+		Version int
+		From    int
+		Items   []struct{ Title string }
+		Changes []struct {
+			Op     string
+			Index  int
+			Record struct{ Title string }
+		}
+	}
+
+	next := func(t testing.TB) message {
+		t.Helper()
+
+		select {
+		case msg := <-client.Channel():
+			var m message
+			if err := json.Unmarshal(msg.Data, &m); err != nil {
+				t.Fatal(err)
+			}
+			return m
+		case <-time.After(3 * time.Second):
+			t.Fatal("no message from the live query")
+		}
+		return message{}
+	}
+
+	scenarios := []tests.ApiScenario{
+		{
+			Name:   "guest query, snapshot and diffs",
+			Method: http.MethodPost,
+			URL:    "/v1/realtime",
+			Body:   body(topic("posts", map[string]string{"sort": "title"})),
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				seed(t, app)
+				app.SubscriptionsBroker().Register(client)
+			},
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				defer resetClient()
+
+				snapshot := next(t)
+				if snapshot.Action != "snapshot" || len(snapshot.Items) != 1 || snapshot.Items[0].Title != "b" {
+					t.Fatalf("want a snapshot of the one listed row, got %+v", snapshot)
+				}
+
+				posts, err := app.FindCollectionByNameOrId("posts")
+				if err != nil {
+					t.Fatal(err)
+				}
+				a := core.NewRecord(posts)
+				a.Set("title", "a")
+				if err := app.Save(a); err != nil {
+					t.Fatal(err)
+				}
+
+				diff := next(t)
+				if diff.Action != "diff" || diff.From != snapshot.Version || len(diff.Changes) != 1 ||
+					diff.Changes[0].Op != "insert" || diff.Changes[0].Index != 0 || diff.Changes[0].Record.Title != "a" {
+					t.Fatalf("want the new row inserted first, got %+v", diff)
+				}
+
+				// hiding a row by the list rule takes it out of the page
+				a.Set("title", "hidden")
+				if err := app.Save(a); err != nil {
+					t.Fatal(err)
+				}
+
+				diff = next(t)
+				if len(diff.Changes) != 1 || diff.Changes[0].Op != "remove" || diff.Changes[0].Index != 0 {
+					t.Fatalf("want the first row removed, got %+v", diff)
+				}
+			},
+			ExpectedStatus: 204,
+			ExpectedEvents: map[string]int{
+				"OnRealtimeSubscribeRequest": 1,
+			},
+		},
+		{
+			Name:   "guest query on a superusers only list",
+			Method: http.MethodPost,
+			URL:    "/v1/realtime",
+			Body:   body(topic("drafts", nil)),
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				seed(t, app)
+				client.Subscribe("test0")
+				app.SubscriptionsBroker().Register(client)
+			},
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				defer resetClient()
+
+				if !client.HasSubscription("test0") || len(client.Subscriptions()) != 1 {
+					t.Fatalf("want the previous subscriptions kept, got %v", client.Subscriptions())
+				}
+			},
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"data":{}`},
+		},
+		{
+			Name:   "guest query filtering by a superusers only field",
+			Method: http.MethodPost,
+			URL:    "/v1/realtime",
+			Body:   body(topic("posts", map[string]string{"filter": `@collection.posts.title = "hidden"`})),
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				seed(t, app)
+				app.SubscriptionsBroker().Register(client)
+			},
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				resetClient()
+			},
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"data":{}`},
+		},
+		{
+			Name:   "query on a missing collection",
+			Method: http.MethodPost,
+			URL:    "/v1/realtime",
+			Body:   body(topic("missing", nil)),
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				app.SubscriptionsBroker().Register(client)
+			},
+			AfterTestFunc: func(t testing.TB, app *tests.TestApp, res *http.Response) {
+				resetClient()
+			},
+			ExpectedStatus:  404,
+			ExpectedContent: []string{`"data":{}`},
+		},
+	}
+
+	for _, scenario := range scenarios {
+		scenario.Test(t)
+	}
+}
@@ -0,0 +1,339 @@
+package apis
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/inflector"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/dbx"
+	"github.com/spf13/cast"
+)
+
+// aggregateFuncs are the aggregates recordsAggregate computes, in the order
+// they are selected. Each is a query parameter listing the fields it applies
+// to ("sum=amount,tax"); count also takes "*".
+var aggregateFuncs = []string{"count", "sum", "avg", "min", "max"}
+
+// aggregateColumn is one column of an aggregate query: a group column when fn
+// is empty, otherwise fn over field (nil for count(*)).
+type aggregateColumn struct {
+	fn    string
+	name  string
+	field core.Field
+}
+
+// AggregateGroup is one row of an aggregate result: the values of the
+// groupBy fields and the aggregates over the records that have them, keyed by
+// function and then by field ("*" for count(*)).
+//
+// An aggregate over no values (sum, avg, min or max of an empty group) is null,
+// as it is in SQL.
+type AggregateGroup struct {
+	Group map[string]any `json:"group"`
+	Count map[string]any `json:"count,omitempty"`
+	Sum   map[string]any `json:"sum,omitempty"`
+	Avg   map[string]any `json:"avg,omitempty"`
+	Min   map[string]any `json:"min,omitempty"`
+	Max   map[string]any `json:"max,omitempty"`
+}
+
+// recordsAggregate computes grouped aggregates over the records of a
+// collection:
+//
+//	GET /v1/collections/{collection}/records/aggregate?groupBy=status&count=*&sum=amount&filter=...
+//
+// It starts from the same listQuery as recordsList, and reads the filter
+// through the same RecordFieldResolver, so the records it aggregates are
+// exactly those the caller could list. They are selected by id in a subquery — rule, filter,
+// joins and all — and aggregated outside it, because the joins a rule or a
+// filter brings in multiply rows: DISTINCT undoes that for a list, but a
+// SUM over the joined rows would already have counted them twice.
+//
+// The groups and aggregated fields are plain columns of the collection, and
+// the SQL is the same on every dialect; only the scanned values differ, and
+// they are normalized by their field.
+func recordsAggregate(e *core.RequestEvent) error {
+	collection, err := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection"))
+	if err != nil || collection == nil {
+		return e.NotFoundError("Missing collection context.", err)
+	}
+
+	err = checkCollectionRateLimit(e, collection, "list")
+	if err != nil {
+		return err
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+
+	items, err := aggregateRecords(e, collection, requestInfo, e.Request.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	return execAfterSuccessTx(true, e.App, func() error {
+		return e.JSON(http.StatusOK, map[string]any{"items": items})
+	})
+}
+
+// aggregateRecords computes the aggregate params ask for over the records of
+// collection the caller of e could list, and refuses with an API error.
+func aggregateRecords(e *core.RequestEvent, collection *core.Collection, requestInfo *core.RequestInfo, params url.Values) ([]*AggregateGroup, error) {
+	// the rule, the trash and the drafts as a list applies them
+	ids, fieldsResolver, err := listQuery(e.App, collection, requestInfo)
+	if err != nil {
+		return nil, firstApiError(err, e.BadRequestError("", err))
+	}
+
+	columns, err := aggregateColumns(collection, params, requestInfo.HasSuperuserAuth())
+	if err != nil {
+		return nil, e.BadRequestError(err.Error(), err)
+	}
+
+	if filter := params.Get(search.FilterQueryParam); filter != "" {
+		if len(filter) > search.MaxFilterLength {
+			return nil, e.BadRequestError("", search.ErrFilterLengthLimit)
+		}
+		expr, err := search.FilterData(filter).BuildExprWithLimit(fieldsResolver, search.DefaultFilterExprLimit)
+		if err != nil {
+			return nil, firstApiError(err, e.BadRequestError("", err))
+		}
+		if expr != nil {
+			ids.AndWhere(expr)
+		}
+	}
+
+	if err := fieldsResolver.UpdateQuery(ids); err != nil {
+		return nil, firstApiError(err, e.BadRequestError("", err))
+	}
+
+	table := inflector.Columnify(collection.Name)
+
+	idsQuery := ids.Select("[[" + table + ".id]]").Build()
+
+	var selects, groupBy []string
+	for _, col := range columns {
+		var identifier string
+		if col.field != nil {
+			identifier = "[[" + table + "." + inflector.Columnify(col.field.GetName()) + "]]"
+		}
+
+		switch {
+		case col.fn == "":
+			groupBy = append(groupBy, identifier)
+			selects = append(selects, identifier)
+		case col.field == nil:
+			selects = append(selects, "COUNT(*)")
+		default:
+			selects = append(selects, strings.ToUpper(col.fn)+"("+identifier+")")
+		}
+	}
+
+	query := e.App.ConcurrentDB().Select(selects...).
+		From(collection.Name).
+		Where(dbx.NewExp("[["+table+".id]] IN ("+idsQuery.SQL()+")", idsQuery.Params())).
+		Limit(int64(search.MaxPerPage) + 1)
+	if len(groupBy) > 0 {
+		query.GroupBy(groupBy...).OrderBy(groupBy...)
+	}
+
+	rows, err := query.Build().WithContext(e.Request.Context()).Rows()
+	if err != nil {
+		return nil, firstApiError(err, e.BadRequestError("", err))
+	}
+	defer rows.Close()
+
+	items := []*AggregateGroup{}
+	for rows.Next() {
+		if len(items) >= search.MaxPerPage {
+			return nil, e.BadRequestError(fmt.Sprintf("The aggregate has more than %d groups, narrow it with a filter.", search.MaxPerPage), nil)
+		}
+
+		raw := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range raw {
+			dest[i] = &raw[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, e.InternalServerError("", err)
+		}
+
+		item, err := aggregateRow(columns, raw)
+		if err != nil {
+			return nil, e.InternalServerError("", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, e.InternalServerError("", err)
+	}
+
+	return items, nil
+}
+
+// aggregateColumns reads the groupBy and aggregate parameters into the columns
+// of the aggregate query, group columns first. Without any aggregate, it
+// counts.
+func aggregateColumns(collection *core.Collection, params map[string][]string, superuser bool) ([]aggregateColumn, error) {
+	var columns []aggregateColumn
+
+	for _, name := range splitAggregateParam(params["groupBy"]) {
+		field, err := aggregateField(collection, name, superuser)
+		if err != nil {
+			return nil, err
+		}
+		if !isGroupableField(field) {
+			return nil, fmt.Errorf("cannot group by %s field %q", field.Type(), name)
+		}
+		columns = append(columns, aggregateColumn{name: name, field: field})
+	}
+
+	groups := len(columns)
+
+	for _, fn := range aggregateFuncs {
+		for _, name := range splitAggregateParam(params[fn]) {
+			if fn == "count" && name == "*" {
+				columns = append(columns, aggregateColumn{fn: fn, name: name})
+				continue
+			}
+
+			field, err := aggregateField(collection, name, superuser)
+			if err != nil {
+				return nil, err
+			}
+
+			switch fn {
+			case "sum", "avg":
+				if field.Type() != core.FieldTypeNumber {
+					return nil, fmt.Errorf("cannot %s %s field %q", fn, field.Type(), name)
+				}
+			case "min", "max":
+				if field.Type() == core.FieldTypeBool || !isGroupableField(field) {
+					return nil, fmt.Errorf("cannot take the %s of %s field %q", fn, field.Type(), name)
+				}
+			}
+
+			columns = append(columns, aggregateColumn{fn: fn, name: name, field: field})
+		}
+	}
+
+	if len(columns) == groups {
+		columns = append(columns, aggregateColumn{fn: "count", name: "*"})
+	}
+
+	return columns, nil
+}
+
+// aggregateField returns the field of collection a group or an aggregate
+// names, refusing the ones the caller could not filter by either.
+func aggregateField(collection *core.Collection, name string, superuser bool) (core.Field, error) {
+	field := collection.Fields.GetByName(name)
+	if field == nil {
+		return nil, fmt.Errorf("unknown field %q", name)
+	}
+
+	if !superuser {
+		if field.GetHidden() {
+			return nil, fmt.Errorf("non-filterable field %q", name)
+		}
+
+		// grouping by email would list the addresses the records keep private
+		if collection.IsAuth() && field.GetName() == core.FieldNameEmail {
+			return nil, fmt.Errorf("non-aggregatable field %q", name)
+		}
+	}
+
+	return field, nil
+}
+
+// isGroupableField reports whether field holds a single scalar per record,
+// which is what a group or a min/max needs.
+func isGroupableField(field core.Field) bool {
+	if multi, ok := field.(core.MultiValuer); ok && multi.IsMultiple() {
+		return false
+	}
+
+	switch field.Type() {
+	case core.FieldTypeText, core.FieldTypeEmail, core.FieldTypeURL, core.FieldTypeSelect,
+		core.FieldTypeBool, core.FieldTypeNumber, core.FieldTypeDate, core.FieldTypeAutodate,
+		core.FieldTypeRelation:
+		return true
+	}
+
+	return false
+}
+
+// aggregateRow turns one scanned row into an AggregateGroup.
+func aggregateRow(columns []aggregateColumn, raw []any) (*AggregateGroup, error) {
+	item := &AggregateGroup{Group: map[string]any{}}
+
+	for i, col := range columns {
+		v := raw[i]
+		if b, ok := v.([]byte); ok {
+			v = string(b) // e.g. a numeric from Postgres
+		}
+
+		var err error
+		switch {
+		case v == nil:
+			// stays null
+		case col.fn == "count":
+			v = cast.ToInt64(v)
+		case col.fn == "sum" || col.fn == "avg":
+			v = cast.ToFloat64(v)
+		default:
+			v, err = col.field.PrepareValue(nil, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		switch col.fn {
+		case "":
+			item.Group[col.name] = v
+		case "count":
+			item.Count = setAggregate(item.Count, col.name, v)
+		case "sum":
+			item.Sum = setAggregate(item.Sum, col.name, v)
+		case "avg":
+			item.Avg = setAggregate(item.Avg, col.name, v)
+		case "min":
+			item.Min = setAggregate(item.Min, col.name, v)
+		case "max":
+			item.Max = setAggregate(item.Max, col.name, v)
+		default:
+			return nil, errors.New("unknown aggregate " + col.fn)
+		}
+	}
+
+	return item, nil
+}
+
+func setAggregate(m map[string]any, name string, v any) map[string]any {
+	if m == nil {
+		m = map[string]any{}
+	}
+	m[name] = v
+	return m
+}
+
+// splitAggregateParam splits the comma separated field lists of a parameter,
+// which may also be repeated.
+func splitAggregateParam(values []string) []string {
+	var names []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
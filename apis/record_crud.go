@@ -1,6 +1,7 @@
 package apis
 
 import (
+	"context"
 	cryptoRand "crypto/rand"
 	"errors"
 	"fmt"
@@ -18,6 +19,7 @@ import (
 	"github.com/hanzoai/base/tools/search"
 	"github.com/hanzoai/base/tools/security"
 	"github.com/hanzoai/dbx"
+	"github.com/spf13/cast"
 )
 
 // bindRecordCrudApi registers the record crud api endpoints and
@@ -27,10 +29,15 @@ import (
 func bindRecordCrudApi(app core.App, rg *router.RouterGroup[*core.RequestEvent]) {
 	subGroup := rg.Group("/collections/{collection}/records").Unbind(DefaultRateLimitMiddlewareId)
 	subGroup.GET("", recordsList)
+	subGroup.GET("/aggregate", recordsAggregate)
 	subGroup.GET("/{id}", recordView)
 	subGroup.POST("", recordCreate(true, nil)).Bind(dynamicCollectionBodyLimit(""))
 	subGroup.PATCH("/{id}", recordUpdate(true, nil)).Bind(dynamicCollectionBodyLimit(""))
 	subGroup.DELETE("/{id}", recordDelete(true, nil))
+	subGroup.POST("/{id}/restore", recordRestore)
+	subGroup.GET("/{id}/draft", recordDraftView)
+	subGroup.DELETE("/{id}/draft", recordDraftDiscard)
+	subGroup.POST("/{id}/publish", recordPublish)
 }
 
 func recordsList(e *core.RequestEvent) error {
@@ -49,34 +56,11 @@ func recordsList(e *core.RequestEvent) error {
 		return firstApiError(err, e.BadRequestError("", err))
 	}
 
-	if collection.ListRule == nil && !requestInfo.HasSuperuserAuth() {
-		return e.ForbiddenError("Only superusers can perform this action.", nil)
-	}
-
-	// forbid users and guests to query special filter/sort fields
-	err = checkForSuperuserOnlyRuleFields(requestInfo)
+	query, fieldsResolver, err := listQuery(e.App, collection, requestInfo)
 	if err != nil {
-		return err
-	}
-
-	query := e.App.RecordQuery(collection)
-
-	fieldsResolver := core.NewRecordFieldResolver(e.App, collection, requestInfo, true)
-
-	if !requestInfo.HasSuperuserAuth() && collection.ListRule != nil && *collection.ListRule != "" {
-		expr, err := search.FilterData(*collection.ListRule).BuildExpr(fieldsResolver)
-		if err != nil {
-			return err
-		}
-		query.AndWhere(expr)
-
-		// will be applied by the search provider right before executing the query
-		// fieldsResolver.UpdateQuery(query)
+		return firstApiError(err, e.BadRequestError("", err))
 	}
 
-	// hidden fields are searchable only by superusers
-	fieldsResolver.SetAllowHiddenFields(requestInfo.HasSuperuserAuth())
-
 	// The PostgREST door carries its predicates as DATA rather than as a filter
 	// string, so they bind here against this collection's own resolver: the
 	// column becomes a resolved identifier and the value a bound parameter,
@@ -93,6 +77,11 @@ func recordsList(e *core.RequestEvent) error {
 
 	searchProvider := search.NewProvider(fieldsResolver).Query(query)
 
+	// an offset off a page boundary can't be said with page/perPage
+	if c := restCallOf(e); c != nil && c.offset > 0 {
+		searchProvider.Offset(c.offset)
+	}
+
 	// count over the insertion-order column where the engine has one, so the
 	// count doesn't need a covering index on "id"
 	if row := e.App.Dialect().Row(); row != "" && !collection.IsView() {
@@ -423,6 +412,18 @@ func recordCreate(responseWriteAfterTx bool, optFinalizer func(data any) error)
 }
 
 func recordUpdate(responseWriteAfterTx bool, optFinalizer func(data any) error) func(e *core.RequestEvent) error {
+	return recordUpdateWith(responseWriteAfterTx, optFinalizer, recordDataFromRequest)
+}
+
+// recordUpdateWith is recordUpdate with the data to update the record with
+// read by dataFunc rather than from the request body, so an update made from
+// something other than the submitted data (eg. a history restore) still goes
+// through the update rule and its WITH CHECK.
+func recordUpdateWith(
+	responseWriteAfterTx bool,
+	optFinalizer func(data any) error,
+	dataFunc func(e *core.RequestEvent, record *core.Record) (map[string]any, error),
+) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		collection, err := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection"))
 		if err != nil || collection == nil {
@@ -460,7 +461,7 @@ func recordUpdate(responseWriteAfterTx bool, optFinalizer func(data any) error)
 			return firstApiError(err, e.NotFoundError("", err))
 		}
 
-		data, err := recordDataFromRequest(e, record)
+		data, err := dataFunc(e, record)
 		if err != nil {
 			return firstApiError(err, e.BadRequestError("Failed to read the submitted data.", err))
 		}
@@ -470,22 +471,23 @@ func recordUpdate(responseWriteAfterTx bool, optFinalizer func(data any) error)
 		requestInfo.Body = data
 
 		ruleFunc := func(q *dbx.SelectQuery) error {
-			if !hasSuperuserAuth && collection.UpdateRule != nil && *collection.UpdateRule != "" {
-				resolver := core.NewRecordFieldResolver(e.App, collection, requestInfo, true)
+			resolver := core.NewRecordFieldResolver(e.App, collection, requestInfo, true)
+
+			// a trashed record is updated only by being restored
+			if err := applyTrashFilter(resolver, collection, &core.RequestInfo{Auth: requestInfo.Auth}, q); err != nil {
+				return err
+			}
 
+			if !hasSuperuserAuth && collection.UpdateRule != nil && *collection.UpdateRule != "" {
 				expr, err := search.FilterData(*collection.UpdateRule).BuildExpr(resolver)
 				if err != nil {
 					return err
 				}
 
 				q.AndWhere(expr)
-
-				err = resolver.UpdateQuery(q)
-				if err != nil {
-					return err
-				}
 			}
-			return nil
+
+			return resolver.UpdateQuery(q)
 		}
 
 		// refetch with access checks
@@ -494,7 +496,16 @@ func recordUpdate(responseWriteAfterTx bool, optFinalizer func(data any) error)
 			return firstApiError(err, e.NotFoundError("", err))
 		}
 
+		// the update of a drafts collection record edits its draft
+		if collection.Drafts {
+			record, err = core.LoadRecordDraft(e.App, record)
+			if err != nil {
+				return firstApiError(err, e.BadRequestError("Failed to load the record draft.", err))
+			}
+		}
+
 		form := forms.NewRecordUpsert(e.App, record)
+		form.SetContext(core.WithRecordActor(context.Background(), requestInfo.Auth))
 		if hasSuperuserAuth {
 			form.GrantSuperuserAccess()
 		}
@@ -554,7 +565,12 @@ func recordUpdate(responseWriteAfterTx bool, optFinalizer func(data any) error)
 			form.SetApp(e.App)
 			form.SetRecord(e.Record)
 
-			err := form.Submit()
+			var err error
+			if e.Collection.Drafts {
+				err = form.SubmitDraft()
+			} else {
+				err = form.Submit()
+			}
 			if err != nil {
 				return firstApiError(err, e.BadRequestError("Failed to update record.", err))
 			}
@@ -631,27 +647,28 @@ func recordDelete(responseWriteAfterTx bool, optFinalizer func(data any) error)
 		}
 
 		ruleFunc := func(q *dbx.SelectQuery) error {
-			if !requestInfo.HasSuperuserAuth() && collection.DeleteRule != nil && *collection.DeleteRule != "" {
-				resolver := core.NewRecordFieldResolver(e.App, collection, requestInfo, true)
+			resolver := core.NewRecordFieldResolver(e.App, collection, requestInfo, true)
 
+			// with ?trashed=only a trashed record is found, and purged
+			if err := applyTrashFilter(resolver, collection, requestInfo, q); err != nil {
+				return err
+			}
+
+			if !requestInfo.HasSuperuserAuth() && collection.DeleteRule != nil && *collection.DeleteRule != "" {
 				expr, err := search.FilterData(*collection.DeleteRule).BuildExpr(resolver)
 				if err != nil {
 					return err
 				}
 
 				q.AndWhere(expr)
-
-				err = resolver.UpdateQuery(q)
-				if err != nil {
-					return err
-				}
 			}
-			return nil
+
+			return resolver.UpdateQuery(q)
 		}
 
 		record, err := e.App.FindRecordById(collection, recordId, ruleFunc)
 		if err != nil || record == nil {
-			return e.NotFoundError("", err)
+			return firstApiError(err, e.NotFoundError("", err))
 		}
 
 		var isOptFinalizerCalled bool
@@ -662,7 +679,13 @@ func recordDelete(responseWriteAfterTx bool, optFinalizer func(data any) error)
 		event.Record = record
 
 		hookErr := e.App.OnRecordDeleteRequest().Trigger(event, func(e *core.RecordRequestEvent) error {
-			if err := e.App.Delete(e.Record); err != nil {
+			ctx := core.WithRecordActor(context.Background(), requestInfo.Auth)
+
+			if e.Record.Collection().SoftDelete && !e.Record.IsTrashed() {
+				if err := core.TrashRecord(ctx, e.App, e.Record); err != nil {
+					return firstApiError(err, e.BadRequestError("Failed to delete record.", err))
+				}
+			} else if err := e.App.DeleteWithContext(ctx, e.Record); err != nil {
 				return firstApiError(err, e.BadRequestError("Failed to delete record. Make sure that the record is not part of a required relation reference.", err))
 			}
 
@@ -752,6 +775,29 @@ func recordDataFromRequest(e *core.RequestEvent, record *core.Record) (map[strin
 		}
 	}
 
+	// a crdtText field takes the new text or sealed ops from a request, never a
+	// whole document, which is not bound to the record it would be merged into
+	for _, f := range record.Collection().Fields {
+		if _, ok := f.(*core.CrdtTextField); !ok {
+			continue
+		}
+		if v, ok := result[f.GetName()]; ok {
+			if _, isOps := v.(map[string]any); !isOps {
+				result[f.GetName()] = core.CrdtTextInput(cast.ToString(v))
+			}
+		}
+	}
+
+	// the tombstone is set by a delete and cleared by a restore, and by nothing else
+	if record.Collection().SoftDelete {
+		delete(result, core.FieldNameDeleted)
+	}
+
+	// and the published date by a publish
+	if record.Collection().Drafts {
+		delete(result, core.FieldNamePublished)
+	}
+
 	return result, nil
 }
 
@@ -64,6 +64,46 @@ func TestRecordCrudList(t *testing.T) {
 			ExpectedContent: []string{`"data":{}`},
 			ExpectedEvents:  map[string]int{"*": 0},
 		},
+		{
+			Name:            "public collection but with superuser only field hidden behind a @request.query field",
+			Method:          http.MethodGet,
+			URL:             "/v1/collections/demo2/records?filter=title=@request.query.@request.auth.title",
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"data":{}`},
+			ExpectedEvents:  map[string]int{"*": 0},
+		},
+		{
+			Name:            "public collection with @request.query filter param outside of vectorDistance",
+			Method:          http.MethodGet,
+			URL:             "/v1/collections/demo2/records?filter=title=@request.query.t&t=test1",
+			ExpectedStatus:  403,
+			ExpectedContent: []string{`"data":{}`},
+			ExpectedEvents:  map[string]int{"*": 0},
+		},
+		{
+			Name:   "public collection with @request.query vectorDistance sort param",
+			Method: http.MethodGet,
+			URL:    "/v1/collections/demo2/records?sort=vectorDistance(embedding,%20@request.query.q),title&q=[1,1]",
+			BeforeTestFunc: func(t testing.TB, app *tests.TestApp, e *core.ServeEvent) {
+				collection, err := app.FindCollectionByNameOrId("demo2")
+				if err != nil {
+					t.Fatal(err)
+				}
+				collection.Fields.Add(&core.VectorField{Name: "embedding", Dimensions: 2})
+				if err := app.Save(collection); err != nil {
+					t.Fatal(err)
+				}
+			},
+			ExpectedStatus: 200,
+			ExpectedContent: []string{
+				`"totalItems":3`,
+			},
+			ExpectedEvents: map[string]int{
+				"*":                    0,
+				"OnRecordsListRequest": 1,
+				"OnRecordEnrich":       3,
+			},
+		},
 		{
 			Name:            "public collection but with ENCODED superuser only filter/sort (aka. @collection)",
 			Method:          http.MethodGet,
@@ -0,0 +1,216 @@
+package apis
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The draft/publish workflow of the base collections with the "drafts" option.
+//
+//	PATCH  /v1/collections/{collection}/records/{id}            edits the draft
+//	GET    /v1/collections/{collection}/records/{id}/draft      reads the draft
+//	DELETE /v1/collections/{collection}/records/{id}/draft      discards the draft
+//	POST   /v1/collections/{collection}/records/{id}/publish    publishes the draft
+//
+// All of them are allowed to whoever may update the record, by the update
+// rule: the editors. The list and view rules keep answering the published
+// copy, and hide the records that were never published from everyone but the
+// superusers.
+//
+// A publish with a future {"publishAt": date} body schedules the draft
+// instead, for the scheduler plugin to publish at that time; discarding the
+// draft cancels it.
+
+// applyPublishedFilter ANDs to q the filter that hides the never published
+// rows of a drafts collection from the non-superusers.
+func applyPublishedFilter(collection *core.Collection, requestInfo *core.RequestInfo, q *dbx.SelectQuery) {
+	if !collection.Drafts || requestInfo.HasSuperuserAuth() {
+		return
+	}
+
+	q.AndWhere(dbx.Not(dbx.HashExp{collection.Name + "." + core.FieldNamePublished: ""}))
+}
+
+// publishedFilter is applyPublishedFilter as a filter, for the checks that
+// ask a rule about a record state rather than query the table.
+func publishedFilter(collection *core.Collection, requestInfo *core.RequestInfo) string {
+	if !collection.Drafts || requestInfo.HasSuperuserAuth() {
+		return ""
+	}
+
+	return core.FieldNamePublished + ` != ""`
+}
+
+// recordDraftResponse is how the draft of a record is answered.
+type recordDraftResponse struct {
+	// Record is the record as its draft has it, or as its row does when
+	// it has no draft.
+	Record *core.Record `json:"record"`
+
+	// Draft reports whether the record has a draft.
+	Draft bool `json:"draft"`
+
+	PublishAt types.DateTime `json:"publishAt"`
+	Updated   types.DateTime `json:"updated"`
+}
+
+func recordDraftView(e *core.RequestEvent) error {
+	record, _, err := recordDraftFor(e)
+	if err != nil {
+		return err
+	}
+
+	return recordDraftRespond(e, http.StatusOK, record)
+}
+
+func recordDraftDiscard(e *core.RequestEvent) error {
+	record, _, err := recordDraftFor(e)
+	if err != nil {
+		return err
+	}
+
+	if err := core.DiscardRecordDraft(e.App, record); err != nil {
+		return firstApiError(err, e.BadRequestError("Failed to discard the record draft.", err))
+	}
+
+	return e.NoContent(http.StatusNoContent)
+}
+
+func recordPublish(e *core.RequestEvent) error {
+	record, requestInfo, err := recordDraftFor(e)
+	if err != nil {
+		return err
+	}
+
+	body := struct {
+		PublishAt string `json:"publishAt" form:"publishAt"`
+	}{}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("An error occurred while loading the submitted data.", err)
+	}
+
+	ctx := core.WithRecordActor(context.Background(), requestInfo.Auth)
+
+	if body.PublishAt != "" {
+		publishAt, err := types.ParseDateTime(body.PublishAt)
+		if err != nil || publishAt.IsZero() {
+			return e.BadRequestError("Invalid publishAt date.", err)
+		}
+
+		if publishAt.Time().After(time.Now()) {
+			err = core.ScheduleRecordDraft(ctx, e.App, record, publishAt)
+			if err != nil {
+				return firstApiError(err, e.BadRequestError("Failed to schedule the record draft.", err))
+			}
+
+			return recordDraftRespond(e, http.StatusAccepted, record)
+		}
+	}
+
+	published, err := core.PublishRecordDraft(ctx, e.App, record)
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("Failed to publish the record.", err))
+	}
+
+	if err := EnrichRecord(e, published); err != nil {
+		return firstApiError(err, e.InternalServerError("Failed to enrich record", err))
+	}
+
+	return e.JSON(http.StatusOK, published)
+}
+
+// recordDraftRespond answers the draft of record with status.
+func recordDraftRespond(e *core.RequestEvent, status int, record *core.Record) error {
+	response := recordDraftResponse{Record: record}
+
+	draft, err := core.FindRecordDraft(e.App, record.Collection(), record.Id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return e.InternalServerError("", err)
+	default:
+		response.Draft = true
+		response.PublishAt = draft.PublishAt
+		response.Updated = draft.Updated
+
+		response.Record, err = draft.Record(record)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+	}
+
+	if err := EnrichRecord(e, response.Record); err != nil {
+		return firstApiError(err, e.InternalServerError("Failed to enrich record", err))
+	}
+
+	return e.JSON(status, response)
+}
+
+// recordDraftFor resolves the drafts collection record of the request,
+// as its row holds it, checking that the caller may update it.
+func recordDraftFor(e *core.RequestEvent) (*core.Record, *core.RequestInfo, error) {
+	collection, err := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection"))
+	if err != nil || collection == nil {
+		return nil, nil, e.NotFoundError("Missing collection context.", err)
+	}
+
+	if !collection.Drafts {
+		return nil, nil, e.BadRequestError("The collection has no drafts.", nil)
+	}
+
+	err = checkCollectionRateLimit(e, collection, "update")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recordId := e.Request.PathValue("id")
+	if recordId == "" {
+		return nil, nil, e.NotFoundError("", nil)
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return nil, nil, firstApiError(err, e.BadRequestError("", err))
+	}
+
+	hasSuperuserAuth := requestInfo.HasSuperuserAuth()
+
+	if !hasSuperuserAuth && collection.UpdateRule == nil {
+		return nil, nil, e.ForbiddenError("Only superusers can perform this action.", nil)
+	}
+
+	ruleFunc := func(q *dbx.SelectQuery) error {
+		resolver := core.NewRecordFieldResolver(e.App, collection, requestInfo, true)
+
+		// a trashed record is neither edited nor published
+		if err := applyTrashFilter(resolver, collection, &core.RequestInfo{Auth: requestInfo.Auth}, q); err != nil {
+			return err
+		}
+
+		if !hasSuperuserAuth && *collection.UpdateRule != "" {
+			expr, err := search.FilterData(*collection.UpdateRule).BuildExpr(resolver)
+			if err != nil {
+				return err
+			}
+
+			q.AndWhere(expr)
+		}
+
+		return resolver.UpdateQuery(q)
+	}
+
+	record, err := e.App.FindRecordById(collection, recordId, ruleFunc)
+	if err != nil || record == nil {
+		return nil, nil, firstApiError(err, e.NotFoundError("", err))
+	}
+
+	return record, requestInfo, nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
 
 	"github.com/hanzoai/base/core"
@@ -337,39 +338,98 @@ func autoResolveRecordsFlags(app core.App, records []*core.Record, requestInfo *
 // view route, the expand fetch and now the function host all ask here.
 //
 // A superuser reads everything and an empty rule admits everyone, which is what
-// each of those says. A nil rule is not a permissive rule — it means nobody but
-// a superuser — so it refuses rather than matching nothing, and a caller who
+// each of those says, except for the trashed rows of a soft delete collection,
+// which stay hidden from both unless the request asks for the trash, and the
+// never published rows of a drafts collection, which stay hidden from the
+// latter. A nil rule is not a permissive rule — it means nobody but a
+// superuser — so it refuses rather than matching nothing, and a caller who
 // forgets to check for it still cannot read the row.
 func viewGate(app core.App, collection *core.Collection, requestInfo *core.RequestInfo) func(*dbx.SelectQuery) error {
 	return func(q *dbx.SelectQuery) error {
+		resolver := core.NewRecordFieldResolver(app, collection, requestInfo, true)
+
+		if err := applyTrashFilter(resolver, collection, requestInfo, q); err != nil {
+			return err
+		}
+		applyPublishedFilter(collection, requestInfo, q)
+
 		if requestInfo.HasSuperuserAuth() {
-			return nil
+			return resolver.UpdateQuery(q)
 		}
 
 		if collection.ViewRule == nil {
 			return fmt.Errorf("only superusers can view collection %q records", collection.Name)
 		}
 
-		if *collection.ViewRule == "" {
-			return nil
+		if *collection.ViewRule != "" {
+			expr, err := search.FilterData(*collection.ViewRule).BuildExpr(resolver)
+			if err != nil {
+				return err
+			}
+
+			q.AndWhere(expr)
 		}
 
-		resolver := core.NewRecordFieldResolver(app, collection, requestInfo, true)
+		return resolver.UpdateQuery(q)
+	}
+}
 
-		expr, err := search.FilterData(*collection.ViewRule).BuildExpr(resolver)
+// listQuery is the query a list of collection starts from for requestInfo: the
+// list rule, the trash and published filters, and the resolver they were
+// resolved with. The caller's filter, sort and page are the search provider's
+// to add, and the resolver is what it updates the query with before running it.
+//
+// It is what viewGate is for a single row. The records list and the realtime
+// list queries both start here, so what a subscription is told is in its
+// result is what the same request to the list route would have listed.
+func listQuery(app core.App, collection *core.Collection, requestInfo *core.RequestInfo) (*dbx.SelectQuery, *core.RecordFieldResolver, error) {
+	if collection.ListRule == nil && !requestInfo.HasSuperuserAuth() {
+		return nil, nil, router.NewForbiddenError("Only superusers can perform this action.", nil)
+	}
+
+	// forbid users and guests to query special filter/sort fields
+	if err := checkForSuperuserOnlyRuleFields(requestInfo); err != nil {
+		return nil, nil, err
+	}
+
+	query := app.RecordQuery(collection)
+
+	resolver := core.NewRecordFieldResolver(app, collection, requestInfo, true)
+
+	if !requestInfo.HasSuperuserAuth() && collection.ListRule != nil && *collection.ListRule != "" {
+		expr, err := search.FilterData(*collection.ListRule).BuildExpr(resolver)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
+		query.AndWhere(expr)
 
-		q.AndWhere(expr)
+		// will be applied by the search provider right before executing the query
+		// resolver.UpdateQuery(query)
+	}
 
-		return resolver.UpdateQuery(q)
+	if err := applyTrashFilter(resolver, collection, requestInfo, query); err != nil {
+		return nil, nil, err
 	}
+	applyPublishedFilter(collection, requestInfo, query)
+
+	// hidden fields are searchable only by superusers
+	resolver.SetAllowHiddenFields(requestInfo.HasSuperuserAuth())
+
+	return query, resolver, nil
 }
 
 var ruleQueryParams = []string{search.FilterQueryParam, search.SortQueryParam}
 var superuserOnlyRuleFields = []string{"@collection.", "@request."}
 
+// vectorQueryArg matches a vectorDistance() call with a @request.query.*
+// query vector, the only place a non-superuser may use a @request.* field.
+//
+// The query vector is the request's own query parameter, which reveals nothing
+// that the client didn't send, and is how a value too large for the
+// filter/sort itself is passed. Anywhere else a @request.query.* field would
+// be read as a rule field and is left to the superusers like the rest.
+var vectorQueryArg = regexp.MustCompile(`vectorDistance\(\s*([\w.]+)\s*,\s*@request\.query\.\w+\s*\)`)
+
 // checkForSuperuserOnlyRuleFields loosely checks and returns an error if
 // the provided RequestInfo contains rule fields that only the superuser can use.
 func checkForSuperuserOnlyRuleFields(requestInfo *core.RequestInfo) error {
@@ -383,6 +443,8 @@ func checkForSuperuserOnlyRuleFields(requestInfo *core.RequestInfo) error {
 			continue
 		}
 
+		v = vectorQueryArg.ReplaceAllString(v, "vectorDistance($1)")
+
 		for _, field := range superuserOnlyRuleFields {
 			if strings.Contains(v, field) {
 				return router.NewForbiddenError("Only superusers can filter by "+field, nil)
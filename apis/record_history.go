@@ -0,0 +1,295 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/router"
+)
+
+// The revision history of a record, for the base collections with the
+// "history" option.
+//
+//	GET  /v1/collections/{collection}/records/{id}/history
+//	GET  /v1/collections/{collection}/records/{id}/history/diff?from=<rev>&to=<rev>
+//	POST /v1/collections/{collection}/records/{id}/history/{rev}/restore
+//
+// The history of a record is read by whoever may view the record, by the
+// collection's view rule. A deleted record has no row to ask the rule about,
+// so the rule is asked about its last version instead, the way the change
+// outbox asks it about a state that is no longer in the table.
+//
+// The revisions are answered the way the record itself would be, hidden fields
+// and all, so reading the history shows nothing reading the record would not
+// have shown when it was current.
+//
+// A restore is an update of the record with the fields of the revision, and
+// goes through the update rule and its WITH CHECK as any other update: the
+// restore is allowed where submitting those values by hand would be. The id,
+// the files and the autodate fields are left as they are, since the files of
+// an earlier version are not kept and the dates are the record's own. It
+// leaves a revision of its own, so a restore can be undone as well.
+
+// bindRecordHistoryApi registers the record history endpoints.
+func bindRecordHistoryApi(app core.App, rg *router.RouterGroup[*core.RequestEvent]) {
+	// note: the collection rate limits are checked by the handlers, as in the record crud
+	subGroup := rg.Group("/collections/{collection}/records/{id}/history").Unbind(DefaultRateLimitMiddlewareId)
+	subGroup.GET("", recordHistoryList)
+	subGroup.GET("/diff", recordHistoryDiff)
+	subGroup.POST("/{rev}/restore", recordUpdateWith(true, nil, recordRevisionData))
+}
+
+// revisionItem is one revision as it is answered.
+type revisionItem struct {
+	Rev             int          `json:"rev"`
+	Action          string       `json:"action"`
+	Actor           string       `json:"actor"`
+	ActorCollection string       `json:"actorCollection"`
+	Created         string       `json:"created"`
+	Record          *core.Record `json:"record"`
+}
+
+// fieldDiff is one changed field between two versions of a record.
+type fieldDiff struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+func recordHistoryList(e *core.RequestEvent) error {
+	collection, _, revisions, err := recordHistoryFor(e)
+	if err != nil {
+		return err
+	}
+
+	records := make([]*core.Record, len(revisions))
+	for i, revision := range revisions {
+		records[i], err = revision.Record(collection)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+	}
+
+	if err := EnrichRecords(e, records); err != nil {
+		return firstApiError(err, e.InternalServerError("Failed to enrich the revisions.", err))
+	}
+
+	items := make([]*revisionItem, len(revisions))
+	for i, revision := range revisions {
+		items[i] = &revisionItem{
+			Rev:             revision.Rev,
+			Action:          revision.Action,
+			Actor:           revision.Actor,
+			ActorCollection: revision.ActorCollection,
+			Created:         revision.Created.String(),
+			Record:          records[i],
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"items": items,
+	})
+}
+
+func recordHistoryDiff(e *core.RequestEvent) error {
+	collection, current, revisions, err := recordHistoryFor(e)
+	if err != nil {
+		return err
+	}
+
+	query := e.Request.URL.Query()
+
+	fromRev, err := strconv.Atoi(query.Get("from"))
+	if err != nil {
+		return e.BadRequestError("Invalid or missing from revision.", err)
+	}
+
+	from, err := revisionRecord(collection, revisions, fromRev)
+	if err != nil || from == nil {
+		return e.BadRequestError("Invalid or missing from revision.", err)
+	}
+
+	// the current record, unless another revision is asked for
+	var toRev *int
+	to := current
+	if raw := query.Get("to"); raw != "" {
+		rev, err := strconv.Atoi(raw)
+		if err != nil {
+			return e.BadRequestError("Invalid to revision.", err)
+		}
+
+		to, err = revisionRecord(collection, revisions, rev)
+		if err != nil || to == nil {
+			return e.BadRequestError("Invalid to revision.", err)
+		}
+
+		toRev = &rev
+	}
+	if to == nil {
+		return e.BadRequestError("The record was deleted; the to revision is required.", nil)
+	}
+
+	if err := EnrichRecords(e, []*core.Record{from, to}); err != nil {
+		return firstApiError(err, e.InternalServerError("Failed to enrich the revisions.", err))
+	}
+
+	fromData, err := exportedRecordData(from)
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+
+	toData, err := exportedRecordData(to)
+	if err != nil {
+		return e.InternalServerError("", err)
+	}
+
+	fields := map[string]*fieldDiff{}
+	for _, field := range collection.Fields {
+		name := field.GetName()
+
+		fromValue, inFrom := fromData[name]
+		toValue, inTo := toData[name]
+		if !inFrom && !inTo {
+			continue // hidden
+		}
+
+		if !reflect.DeepEqual(fromValue, toValue) {
+			fields[name] = &fieldDiff{From: fromValue, To: toValue}
+		}
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"from":   fromRev,
+		"to":     toRev,
+		"fields": fields,
+	})
+}
+
+// recordRevisionData reads the revision a restore asks for as the data to
+// update record with.
+func recordRevisionData(e *core.RequestEvent, record *core.Record) (map[string]any, error) {
+	rev, err := strconv.Atoi(e.Request.PathValue("rev"))
+	if err != nil {
+		return nil, e.NotFoundError("", err)
+	}
+
+	collection := record.Collection()
+
+	revision, err := core.FindRecordRevision(e.App, collection, record.Id, rev)
+	if err != nil {
+		return nil, e.NotFoundError("", err)
+	}
+
+	version, err := revision.Record(collection)
+	if err != nil {
+		return nil, e.InternalServerError("", err)
+	}
+
+	data := make(map[string]any, len(collection.Fields))
+	for _, field := range collection.Fields {
+		if field.GetName() == core.FieldNameId ||
+			(collection.SoftDelete && field.GetName() == core.FieldNameDeleted) ||
+			(collection.Drafts && field.GetName() == core.FieldNamePublished) {
+			continue
+		}
+
+		switch field.Type() {
+		case core.FieldTypeFile, core.FieldTypeAutodate:
+			continue
+		}
+
+		data[field.GetName()] = version.GetRaw(field.GetName())
+	}
+
+	return data, nil
+}
+
+// recordHistoryFor resolves the collection and the record of the request,
+// checks that the caller may read its history and returns the record, or nil
+// if it was deleted, and its revisions, newest first.
+func recordHistoryFor(e *core.RequestEvent) (*core.Collection, *core.Record, []*core.RecordRevision, error) {
+	collection, err := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection"))
+	if err != nil || collection == nil {
+		return nil, nil, nil, e.NotFoundError("Missing collection context.", err)
+	}
+
+	if !collection.IsBase() {
+		return nil, nil, nil, e.BadRequestError("Unsupported collection type.", nil)
+	}
+
+	if err := checkCollectionRateLimit(e, collection, "view"); err != nil {
+		return nil, nil, nil, err
+	}
+
+	recordId := e.Request.PathValue("id")
+	if recordId == "" {
+		return nil, nil, nil, e.NotFoundError("", nil)
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return nil, nil, nil, firstApiError(err, e.BadRequestError("", err))
+	}
+
+	if collection.ViewRule == nil && !requestInfo.HasSuperuserAuth() {
+		return nil, nil, nil, e.ForbiddenError("Only superusers can perform this action.", nil)
+	}
+
+	revisions, err := core.FindRecordRevisions(e.App, collection, recordId)
+	if err != nil {
+		return nil, nil, nil, e.InternalServerError("", err)
+	}
+
+	record, err := e.App.FindRecordById(collection, recordId, viewGate(e.App, collection, requestInfo))
+	if err == nil {
+		return collection, record, revisions, nil
+	}
+
+	// there, but not for the caller
+	if _, existsErr := e.App.FindRecordById(collection, recordId); existsErr == nil {
+		return nil, nil, nil, e.NotFoundError("", err)
+	}
+
+	// deleted, and read by its last version
+	if len(revisions) == 0 {
+		return nil, nil, nil, e.NotFoundError("", err)
+	}
+
+	last, err := revisions[0].Record(collection)
+	if err != nil {
+		return nil, nil, nil, e.InternalServerError("", err)
+	}
+
+	if !requestInfo.HasSuperuserAuth() && !recordStateMatches(e.App, collection, last, *collection.ViewRule, requestInfo) {
+		return nil, nil, nil, e.NotFoundError("", nil)
+	}
+
+	return collection, nil, revisions, nil
+}
+
+// revisionRecord loads the revision rev from revisions into a record of
+// collection, or returns nil if there is none such.
+func revisionRecord(collection *core.Collection, revisions []*core.RecordRevision, rev int) (*core.Record, error) {
+	for _, revision := range revisions {
+		if revision.Rev == rev {
+			return revision.Record(collection)
+		}
+	}
+
+	return nil, nil
+}
+
+// exportedRecordData returns record as it is answered, as plain values.
+func exportedRecordData(record *core.Record) (map[string]any, error) {
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]any{}
+	err = json.Unmarshal(raw, &data)
+
+	return data, err
+}
@@ -0,0 +1,174 @@
+package apis
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/router"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/dbx"
+)
+
+// The trash of the base collections with the "softDelete" option.
+//
+//	DELETE /v1/collections/{collection}/records/{id}                 moves the record to the trash
+//	DELETE /v1/collections/{collection}/records/{id}?trashed=only    purges a trashed record
+//	POST   /v1/collections/{collection}/records/{id}/restore         takes it out of the trash
+//
+// A trashed row is hidden by the same reads that apply the list and view
+// rules, ANDed into the query next to the rule, so there is no read that
+// applies the rule and forgets the trash. A rule or filter that joins another
+// collection with a trash (by a relation, a back-relation or an @collection
+// reference) never finds its trashed rows either. ?trashed=only answers the
+// trash and ?trashed=with both, to the superusers or to the callers the
+// collection's trash rule admits, and the trash rule is asked in addition to
+// the list or view rule of the read, never instead of it.
+//
+// A restore is allowed to whoever could read the trashed record with
+// ?trashed=only and update it, by the trash rule and the update rule, and it
+// runs through the OnRecordUpdateRequest hooks like any other update.
+
+const trashedQueryParam = "trashed"
+
+// The ?trashed= modes.
+const (
+	trashedOnly = "only"
+	trashedWith = "with"
+)
+
+// trashFilter returns the filter that keeps the rows of collection the
+// ?trashed= mode of the request asks for, or an empty string when the
+// collection has no trash.
+func trashFilter(collection *core.Collection, requestInfo *core.RequestInfo) (string, error) {
+	if !collection.SoftDelete {
+		return "", nil
+	}
+
+	live := core.FieldNameDeleted + ` = ""`
+	trashed := core.FieldNameDeleted + ` != ""`
+
+	mode := requestInfo.Query[trashedQueryParam]
+	switch mode {
+	case "":
+		return live, nil
+	case trashedOnly, trashedWith:
+	default:
+		return "", router.NewBadRequestError("Invalid trashed mode; expected only or with.", nil)
+	}
+
+	if !requestInfo.HasSuperuserAuth() {
+		if collection.TrashRule == nil {
+			return "", router.NewForbiddenError("Only superusers can read the trash of this collection.", nil)
+		}
+
+		if *collection.TrashRule != "" {
+			trashed = "(" + trashed + " && (\n" + *collection.TrashRule + "\n))"
+		}
+	}
+
+	if mode == trashedOnly {
+		return trashed, nil
+	}
+
+	return live + " || " + trashed, nil
+}
+
+// applyTrashFilter ANDs the trashFilter of the request to q, resolved with
+// resolver.
+//
+// NB! The caller is expected to update q with the resolver afterwards, as it
+// does for the rule next to it.
+func applyTrashFilter(resolver *core.RecordFieldResolver, collection *core.Collection, requestInfo *core.RequestInfo, q *dbx.SelectQuery) error {
+	filter, err := trashFilter(collection, requestInfo)
+	if err != nil || filter == "" {
+		return err
+	}
+
+	expr, err := search.FilterData(filter).BuildExpr(resolver)
+	if err != nil {
+		return err
+	}
+
+	q.AndWhere(expr)
+
+	return nil
+}
+
+func recordRestore(e *core.RequestEvent) error {
+	collection, err := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection"))
+	if err != nil || collection == nil {
+		return e.NotFoundError("Missing collection context.", err)
+	}
+
+	if !collection.SoftDelete {
+		return e.BadRequestError("The collection has no trash.", nil)
+	}
+
+	err = checkCollectionRateLimit(e, collection, "update")
+	if err != nil {
+		return err
+	}
+
+	recordId := e.Request.PathValue("id")
+	if recordId == "" {
+		return e.NotFoundError("", nil)
+	}
+
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+
+	hasSuperuserAuth := requestInfo.HasSuperuserAuth()
+
+	if !hasSuperuserAuth && (collection.TrashRule == nil || collection.UpdateRule == nil) {
+		return e.ForbiddenError("Only superusers can perform this action.", nil)
+	}
+
+	// read as the trash
+	trashInfo := *requestInfo
+	trashInfo.Query = map[string]string{trashedQueryParam: trashedOnly}
+
+	ruleFunc := func(q *dbx.SelectQuery) error {
+		resolver := core.NewRecordFieldResolver(e.App, collection, &trashInfo, true)
+
+		if err := applyTrashFilter(resolver, collection, &trashInfo, q); err != nil {
+			return err
+		}
+
+		if !hasSuperuserAuth && *collection.UpdateRule != "" {
+			expr, err := search.FilterData(*collection.UpdateRule).BuildExpr(resolver)
+			if err != nil {
+				return err
+			}
+
+			q.AndWhere(expr)
+		}
+
+		return resolver.UpdateQuery(q)
+	}
+
+	record, err := e.App.FindRecordById(collection, recordId, ruleFunc)
+	if err != nil || record == nil {
+		return firstApiError(err, e.NotFoundError("", err))
+	}
+
+	event := new(core.RecordRequestEvent)
+	event.RequestEvent = e
+	event.Collection = collection
+	event.Record = record
+
+	return e.App.OnRecordUpdateRequest().Trigger(event, func(e *core.RecordRequestEvent) error {
+		err := core.RestoreTrashedRecord(core.WithRecordActor(context.Background(), requestInfo.Auth), e.App, e.Record)
+		if err != nil {
+			return firstApiError(err, e.BadRequestError("Failed to restore the record.", err))
+		}
+
+		if err := EnrichRecord(e.RequestEvent, e.Record); err != nil {
+			return firstApiError(err, e.InternalServerError("Failed to enrich record", err))
+		}
+
+		return e.JSON(http.StatusOK, e.Record)
+	})
+}
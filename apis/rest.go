@@ -9,11 +9,13 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/dbutils"
 	"github.com/hanzoai/base/tools/router"
 	"github.com/hanzoai/base/tools/search"
 	"github.com/hanzoai/orm/query"
@@ -72,6 +74,14 @@ type restWireKey struct{}
 type restCall struct {
 	preds []restPredicate
 
+	// offset is a window start the page/perPage translation cannot say — one
+	// off a page boundary — handed to the search provider as it was asked.
+	offset int
+
+	// embeds are the related tables select=…,author(…) nests into each row,
+	// bound to the relations (and so the view rules) they expand through.
+	embeds []*restEmbed
+
 	// hold suppresses the per-record response write so a filtered write that
 	// touches N rows answers ONCE. Base's write handlers are by-id and each
 	// writes its own response; This wire's PATCH and DELETE are filtered, so the
@@ -107,14 +117,25 @@ func restCount(e *core.RequestEvent) bool {
 }
 
 func restList(e *core.RequestEvent) error {
-	q, preds, err := restQuery(e.Request.URL.Query(), restCount(e))
+	q, call, err := restQuery(e.Request.URL.Query(), restCount(e))
 	if err != nil {
 		return restError(e, http.StatusBadRequest, "bad_query", err.Error(), "")
 	}
 
+	// An embed names a relation, and only the collection knows which. A missing
+	// collection is left for recordsList to refuse, so both doors 404 alike.
+	if len(call.embeds) > 0 {
+		if collection, _ := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection")); collection != nil {
+			expand, err := restBindEmbeds(e.App, collection, call.embeds, "")
+			if err != nil {
+				return restError(e, http.StatusBadRequest, "bad_query", err.Error(), "")
+			}
+			q.Set("expand", strings.Join(expand, ","))
+		}
+	}
+
 	e.Request.URL.RawQuery = q.Encode()
-	e.Request = e.Request.WithContext(
-		context.WithValue(e.Request.Context(), restWireKey{}, &restCall{preds: preds}))
+	e.Request = e.Request.WithContext(context.WithValue(e.Request.Context(), restWireKey{}, call))
 
 	return restFail(e, recordsList(e))
 }
@@ -124,8 +145,12 @@ func restList(e *core.RequestEvent) error {
 // gets `*/*` — the honest answer, since the total was never computed. Ranges are
 // inclusive and zero-based, so an empty page is `*/N` and not `0--1/N`.
 func restRender(e *core.RequestEvent, records []*core.Record, total int, counted bool) error {
+	call := restCallOf(e)
+
 	from := 0
-	if p, per := restPaging(e); per > 0 {
+	if call != nil && call.offset > 0 {
+		from = call.offset
+	} else if p, per := restPaging(e); per > 0 {
 		from = per * (p - 1)
 	}
 
@@ -145,6 +170,14 @@ func restRender(e *core.RequestEvent, records []*core.Record, total int, counted
 		return e.NoContent(http.StatusOK)
 	}
 
+	if call != nil && len(call.embeds) > 0 {
+		rows := make([]map[string]any, len(records))
+		for i, r := range records {
+			rows[i] = restEmbedRow(r, call.embeds)
+		}
+		return e.JSON(http.StatusOK, rows)
+	}
+
 	if records == nil {
 		records = []*core.Record{}
 	}
@@ -153,7 +186,8 @@ func restRender(e *core.RequestEvent, records []*core.Record, total int, counted
 
 // restPaging recovers the page/perPage this request was translated into, so the
 // Content-Range offset is derived from what actually ran rather than from a
-// second reading of the original query.
+// second reading of the original query. An offset off a page boundary is not
+// a page at all; restRender takes that one from the call instead.
 func restPaging(e *core.RequestEvent) (page int, perPage int) {
 	q := e.Request.URL.Query()
 	page, _ = strconv.Atoi(q.Get("page"))
@@ -170,11 +204,19 @@ func restPaging(e *core.RequestEvent) (page int, perPage int) {
 // value in the params map, never spliced into the expression text — the filter
 // DSL is an expression language, so concatenating a caller's string into it is
 // injection into the WHERE clause, not merely a quoting bug.
-func restQuery(in url.Values, counted bool) (url.Values, []restPredicate, error) {
+func restQuery(in url.Values, counted bool) (url.Values, *restCall, error) {
 	out := url.Values{}
+	call := &restCall{}
 
 	if sel := in.Get("select"); sel != "" && sel != "*" {
-		out.Set("fields", sel)
+		fields, embeds, err := restSelect(sel, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(fields) != 1 || fields[0] != "*" {
+			out.Set("fields", strings.Join(fields, ","))
+		}
+		call.embeds = embeds
 	}
 
 	if order := in.Get("order"); order != "" {
@@ -201,17 +243,16 @@ func restQuery(in url.Values, counted bool) (url.Values, []restPredicate, error)
 		offset = n
 	}
 	// Base pages; the wire takes an arbitrary offset. Where the two agree the
-	// translation is exact. Where they do not, this REFUSES rather than rounding
-	// to the nearest page — a silently shifted window returns real rows for the
-	// wrong range, which reads as data corruption and not as a paging bug.
+	// translation is a page. Where they do not, the offset travels to the search
+	// provider as it was asked rather than being rounded to the nearest page — a
+	// silently shifted window returns real rows for the wrong range, which reads
+	// as data corruption and not as a paging bug.
 	if limit > 0 {
 		out.Set("perPage", strconv.Itoa(limit))
+		out.Set("page", strconv.Itoa(offset/limit+1))
 		if offset%limit != 0 {
-			return nil, nil, fmt.Errorf(
-				"offset %d is not a multiple of limit %d; this store pages, so it can only start a window on a page boundary",
-				offset, limit)
+			call.offset = offset
 		}
-		out.Set("page", strconv.Itoa(offset/limit+1))
 	} else if offset > 0 {
 		return nil, nil, fmt.Errorf("offset needs a limit, otherwise there is no window to move")
 	}
@@ -224,8 +265,9 @@ func restQuery(in url.Values, counted bool) (url.Values, []restPredicate, error)
 	if err != nil {
 		return nil, nil, err
 	}
+	call.preds = preds
 
-	return out, preds, nil
+	return out, call, nil
 }
 
 // restPredicate is one column comparison, still as the caller wrote it. The
@@ -241,6 +283,12 @@ type restPredicate struct {
 	// and the table editor offers exactly that, so rejecting the prefix would
 	// leave a filter the grid can build and the server cannot answer.
 	Negate bool
+
+	// Group is "and" or "or" for a logical group — `or=(a.eq.1,b.eq.2)` — and
+	// empty for a comparison. A group compares nothing itself: Col, Op and Vals
+	// stay empty and its members are Preds, which may be groups in turn.
+	Group string
+	Preds []restPredicate
 }
 
 // restReserved are the query params that steer the read rather than filter it.
@@ -283,38 +331,124 @@ func restPredicates(in url.Values) ([]restPredicate, error) {
 	preds := []restPredicate{}
 	for _, col := range cols {
 		for _, raw := range in[col] {
-			negate := false
-			if rest, ok := strings.CutPrefix(raw, "not."); ok {
-				negate, raw = true, rest
+			var p restPredicate
+			var err error
+			if group, negate, ok := restGroupKey(col); ok {
+				p, err = restGroup(group, negate, raw)
+			} else {
+				p, err = restComparison(col, raw)
 			}
-			op, val, has := strings.Cut(raw, ".")
-			if !has {
-				return nil, fmt.Errorf("filter %s=%q needs an operator, e.g. %s=eq.%s", col, raw, col, raw)
+			if err != nil {
+				return nil, err
 			}
-			switch op {
-			case "is":
-				if val != "null" && val != "true" && val != "false" {
-					return nil, fmt.Errorf("filter %s=is.%s: is takes null, true or false", col, val)
-				}
-				preds = append(preds, restPredicate{Col: col, Op: op, Vals: []string{val}, Negate: negate})
-			case "in":
-				vals := restValues(val)
-				if len(vals) == 0 {
-					return nil, fmt.Errorf("filter %s=in.%s names no values", col, val)
-				}
-				preds = append(preds, restPredicate{Col: col, Op: op, Vals: vals, Negate: negate})
-			case "like", "ilike":
-				// This wire spells the wildcard *, SQL spells it %.
-				preds = append(preds, restPredicate{Col: col, Op: op, Vals: []string{strings.ReplaceAll(val, "*", "%")}, Negate: negate})
-			default:
-				if _, ok := restOps[op]; !ok {
-					return nil, fmt.Errorf("filter %s=%s.%s: unknown operator %q", col, op, val, op)
+			preds = append(preds, p)
+		}
+	}
+	return preds, nil
+}
+
+// restComparison reads one `[not.]op.value` against a column.
+func restComparison(col, raw string) (restPredicate, error) {
+	negate := false
+	if rest, ok := strings.CutPrefix(raw, "not."); ok {
+		negate, raw = true, rest
+	}
+	op, val, has := strings.Cut(raw, ".")
+	if !has {
+		return restPredicate{}, fmt.Errorf("filter %s=%q needs an operator, e.g. %s=eq.%s", col, raw, col, raw)
+	}
+	switch op {
+	case "is":
+		if val != "null" && val != "true" && val != "false" {
+			return restPredicate{}, fmt.Errorf("filter %s=is.%s: is takes null, true or false", col, val)
+		}
+		return restPredicate{Col: col, Op: op, Vals: []string{val}, Negate: negate}, nil
+	case "in", "cs", "cd":
+		vals := restValues(val)
+		// An empty list is meaningful for containment — every array contains {}
+		// — but IN () is not SQL, so only `in` insists on a value.
+		if len(vals) == 0 && op == "in" {
+			return restPredicate{}, fmt.Errorf("filter %s=in.%s names no values", col, val)
+		}
+		return restPredicate{Col: col, Op: op, Vals: vals, Negate: negate}, nil
+	case "like", "ilike":
+		// This wire spells the wildcard *, SQL spells it %.
+		return restPredicate{Col: col, Op: op, Vals: []string{strings.ReplaceAll(val, "*", "%")}, Negate: negate}, nil
+	case "fts", "plfts":
+		// The field's searchable index decides how the text is matched; both
+		// spellings reach the same plain-words search, which is what plfts
+		// means and the nearest thing this store has to fts.
+		return restPredicate{Col: col, Op: "fts", Vals: []string{val}, Negate: negate}, nil
+	default:
+		if strings.HasPrefix(op, "fts(") || strings.HasPrefix(op, "plfts(") {
+			// The store indexes a field with one configuration. Accepting a
+			// different one and searching with ours would answer for a
+			// language the caller did not ask about.
+			return restPredicate{}, fmt.Errorf("filter %s=%s.%s: a text search configuration cannot be chosen per query here; drop the parentheses", col, op, val)
+		}
+		if _, ok := restOps[op]; !ok {
+			return restPredicate{}, fmt.Errorf("filter %s=%s.%s: unknown operator %q", col, op, val, op)
+		}
+		return restPredicate{Col: col, Op: op, Vals: []string{val}, Negate: negate}, nil
+	}
+}
+
+// restGroupKey reports whether a query key (or a group member's head) opens a
+// logical group: `or`, `and`, or either behind the `not.` prefix.
+func restGroupKey(key string) (group string, negate bool, ok bool) {
+	if rest, cut := strings.CutPrefix(key, "not."); cut {
+		negate, key = true, rest
+	}
+	if key == "or" || key == "and" {
+		return key, negate, true
+	}
+	return "", false, false
+}
+
+// restGroup reads a logical group, `(a.eq.1,b.not.in.(2,3),and(c.gt.4,d.is.null))`.
+//
+// A member is a column, then its comparison — the query string's `a=eq.1` with
+// the `=` turned into a dot — or a nested group. A value holding a comma or a
+// parenthesis is double-quoted, and the quotes are the wire's, not the value's.
+func restGroup(group string, negate bool, raw string) (restPredicate, error) {
+	inner, open := strings.CutPrefix(raw, "(")
+	inner, closed := strings.CutSuffix(inner, ")")
+	if !open || !closed {
+		return restPredicate{}, fmt.Errorf("%s=%s: a logical group is a parenthesised list, e.g. %s=(a.eq.1,b.eq.2)", group, raw, group)
+	}
+
+	members := restSplit(inner)
+	if len(members) == 0 {
+		return restPredicate{}, fmt.Errorf("%s=%s names no conditions", group, raw)
+	}
+
+	p := restPredicate{Group: group, Negate: negate, Preds: make([]restPredicate, 0, len(members))}
+	for _, member := range members {
+		if head, body, ok := strings.Cut(member, "("); ok {
+			if subGroup, subNegate, isGroup := restGroupKey(head); isGroup {
+				sub, err := restGroup(subGroup, subNegate, "("+body)
+				if err != nil {
+					return restPredicate{}, err
 				}
-				preds = append(preds, restPredicate{Col: col, Op: op, Vals: []string{val}, Negate: negate})
+				p.Preds = append(p.Preds, sub)
+				continue
 			}
 		}
+
+		col, cond, has := strings.Cut(member, ".")
+		if !has || col == "" {
+			return restPredicate{}, fmt.Errorf("%s=%s: %q needs a column and an operator, e.g. %s.eq.1", group, raw, member, member)
+		}
+		sub, err := restComparison(col, cond)
+		if err != nil {
+			return restPredicate{}, err
+		}
+		if len(sub.Vals) == 1 && sub.Op != "in" && sub.Op != "cs" && sub.Op != "cd" {
+			sub.Vals[0] = restUnquote(sub.Vals[0])
+		}
+		p.Preds = append(p.Preds, sub)
 	}
-	return preds, nil
+	return p, nil
 }
 
 // restWhere turns the predicates into ONE bound expression.
@@ -332,73 +466,175 @@ func restWhere(resolver search.FieldResolver, preds []restPredicate) (query.Expr
 		return nil, nil
 	}
 
-	exprs := make([]query.Expression, 0, len(preds))
 	n := 0
+	next := func() string {
+		key := "rp" + strconv.Itoa(n)
+		n++
+		return key
+	}
 
+	return restBind(resolver, "and", preds, next)
+}
+
+// restBind joins a list of predicates with the group's connective. The top
+// level of a query is an implicit `and`, the same as a group spelled out.
+func restBind(resolver search.FieldResolver, group string, preds []restPredicate, next func() string) (query.Expression, error) {
+	exprs := make([]query.Expression, 0, len(preds))
 	for _, p := range preds {
-		// The COLUMN is caller-supplied too. Resolving it is what proves it names
-		// a real field on this collection and yields an identifier safe to place
-		// in SQL; splicing p.Col directly would be injection through the other
-		// half of the predicate.
-		left, err := resolver.Resolve(p.Col)
+		expr, err := restBindOne(resolver, p, next)
 		if err != nil {
-			return nil, fmt.Errorf("filter %s: %w", p.Col, err)
-		}
-
-		switch p.Op {
-		case "is":
-			switch p.Vals[0] {
-			case "null":
-				exprs = append(exprs, query.NewExp(left.Identifier+" IS NULL", left.Params))
-			default:
-				key := "rp" + strconv.Itoa(n)
-				n++
-				params := query.Params{key: p.Vals[0] == "true"}
-				exprs = append(exprs, query.NewExp(left.Identifier+" = {:"+key+"}", mergeRestParams(left.Params, params)))
-			}
-		case "in":
-			slots := make([]string, 0, len(p.Vals))
-			params := query.Params{}
-			for _, v := range p.Vals {
-				key := "rp" + strconv.Itoa(n)
-				n++
-				params[key] = v
-				slots = append(slots, "{:"+key+"}")
-			}
-			exprs = append(exprs, query.NewExp(
-				left.Identifier+" IN ("+strings.Join(slots, ", ")+")",
-				mergeRestParams(left.Params, params)))
-		case "like", "ilike":
-			key := "rp" + strconv.Itoa(n)
-			n++
-			params := query.Params{key: p.Vals[0]}
-			sql := left.Identifier + " LIKE {:" + key + "} ESCAPE '\\'"
-			if p.Op == "ilike" {
-				// Case-insensitivity stated in the query rather than inherited
-				// from the engine's collation, which differs between the two
-				// this store runs on.
-				sql = "LOWER(" + left.Identifier + ") LIKE LOWER({:" + key + "}) ESCAPE '\\'"
-			}
-			exprs = append(exprs, query.NewExp(sql, mergeRestParams(left.Params, params)))
-		default:
-			key := "rp" + strconv.Itoa(n)
-			n++
-			params := query.Params{key: p.Vals[0]}
-			exprs = append(exprs, query.NewExp(
-				left.Identifier+" "+restOps[p.Op]+" {:"+key+"}",
-				mergeRestParams(left.Params, params)))
+			return nil, err
 		}
+		exprs = append(exprs, expr)
+	}
+
+	if group == "or" {
+		return query.Or(exprs...), nil
+	}
+	return query.And(exprs...), nil
+}
 
+func restBindOne(resolver search.FieldResolver, p restPredicate, next func() string) (query.Expression, error) {
+	if p.Group != "" {
+		expr, err := restBind(resolver, p.Group, p.Preds, next)
+		if err != nil {
+			return nil, err
+		}
 		if p.Negate {
-			exprs[len(exprs)-1] = query.Not(exprs[len(exprs)-1])
+			expr = query.Not(expr)
+		}
+		return expr, nil
+	}
+
+	// The COLUMN is caller-supplied too. Resolving it is what proves it names
+	// a real field on this collection and yields an identifier safe to place
+	// in SQL; splicing p.Col directly would be injection through the other
+	// half of the predicate.
+	left, err := resolver.Resolve(p.Col)
+	if err != nil {
+		return nil, fmt.Errorf("filter %s: %w", p.Col, err)
+	}
+
+	var expr query.Expression
+
+	switch p.Op {
+	case "is":
+		switch p.Vals[0] {
+		case "null":
+			expr = query.NewExp(left.Identifier+" IS NULL", left.Params)
+		default:
+			key := next()
+			params := query.Params{key: p.Vals[0] == "true"}
+			expr = query.NewExp(left.Identifier+" = {:"+key+"}", mergeRestParams(left.Params, params))
+		}
+	case "in":
+		slots, params := restSlots(p.Vals, next)
+		expr = query.NewExp(
+			left.Identifier+" IN ("+strings.Join(slots, ", ")+")",
+			mergeRestParams(left.Params, params))
+	case "cs", "cd":
+		expr, err = restContainment(resolver, left, p, next)
+		if err != nil {
+			return nil, err
+		}
+	case "like", "ilike":
+		key := next()
+		params := query.Params{key: p.Vals[0]}
+		sql := left.Identifier + " LIKE {:" + key + "} ESCAPE '\\'"
+		if p.Op == "ilike" {
+			// Case-insensitivity stated in the query rather than inherited
+			// from the engine's collation, which differs between the two
+			// this store runs on.
+			sql = "LOWER(" + left.Identifier + ") LIKE LOWER({:" + key + "}) ESCAPE '\\'"
+		}
+		expr = query.NewExp(sql, mergeRestParams(left.Params, params))
+	case "fts":
+		if left.FullText == nil {
+			return nil, fmt.Errorf("filter %s=fts: %s is not a searchable field", p.Col, p.Col)
 		}
+		// The text is handed over already bound, the same shape fts() in a
+		// filter resolves its query argument to.
+		key := next()
+		matched, err := left.FullText(&search.ResolverResult{
+			Identifier: "{:" + key + "}",
+			Params:     query.Params{key: p.Vals[0]},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("filter %s=fts: %w", p.Col, err)
+		}
+		expr = query.NewExp(matched.Identifier, matched.Params)
+	default:
+		key := next()
+		params := query.Params{key: p.Vals[0]}
+		expr = query.NewExp(
+			left.Identifier+" "+restOps[p.Op]+" {:"+key+"}",
+			mergeRestParams(left.Params, params))
+	}
+
+	if p.Negate {
+		expr = query.Not(expr)
+	}
+
+	if left.AfterBuild != nil {
+		expr = left.AfterBuild(expr)
+	}
+
+	return expr, nil
+}
+
+// restColumn matches an identifier that is a stored column, as opposed to an
+// extracted or computed value.
+var restColumn = regexp.MustCompile(`^\[\[([\w.]+)\]\]$`)
 
-		if left.AfterBuild != nil {
-			exprs[len(exprs)-1] = left.AfterBuild(exprs[len(exprs)-1])
+// restContainment binds `cs` (the column contains every listed element) and
+// `cd` (every element of the column is listed), the wire's array operators,
+// against a column holding a json array — a multiple select or relation, or a
+// json field.
+//
+// The elements are compared as the text the wire sent, which is exact for the
+// ids and options those fields hold; a json array of numbers is not what these
+// operators are for here.
+func restContainment(resolver search.FieldResolver, left *search.ResolverResult, p restPredicate, next func() string) (query.Expression, error) {
+	column := restColumn.FindStringSubmatch(left.Identifier)
+	if column == nil || len(left.Params) > 0 {
+		return nil, fmt.Errorf("filter %s=%s: containment compares a stored column, and %s is not one", p.Col, p.Op, p.Col)
+	}
+	each := dbutils.JSONEach(resolver.Dialect(), column[1])
+
+	if p.Op == "cs" {
+		exprs := make([]query.Expression, 0, len(p.Vals))
+		for _, v := range p.Vals {
+			key := next()
+			exprs = append(exprs, query.NewExp(
+				"EXISTS (SELECT 1 FROM "+each+" [[__rcs]] WHERE [[__rcs.value]] = {:"+key+"})",
+				query.Params{key: v}))
+		}
+		if len(exprs) == 0 {
+			return query.NewExp("1=1"), nil
 		}
+		return query.And(exprs...), nil
 	}
 
-	return query.And(exprs...), nil
+	if len(p.Vals) == 0 {
+		return query.NewExp("NOT EXISTS (SELECT 1 FROM " + each + " [[__rcd]])"), nil
+	}
+	slots, params := restSlots(p.Vals, next)
+	return query.NewExp(
+		"NOT EXISTS (SELECT 1 FROM "+each+" [[__rcd]] WHERE [[__rcd.value]] NOT IN ("+strings.Join(slots, ", ")+"))",
+		params), nil
+}
+
+// restSlots binds each value as its own parameter and returns the
+// placeholders, in order.
+func restSlots(vals []string, next func() string) ([]string, query.Params) {
+	slots := make([]string, 0, len(vals))
+	params := query.Params{}
+	for _, v := range vals {
+		key := next()
+		params[key] = v
+		slots = append(slots, "{:"+key+"}")
+	}
+	return slots, params
 }
 
 func mergeRestParams(sets ...query.Params) query.Params {
@@ -413,21 +649,65 @@ func mergeRestParams(sets ...query.Params) query.Params {
 
 // restValues splits the wire's `in.(a,b,c)` list, tolerating the parentheses
 // being present or absent and stripping the quotes it uses around a value that
-// contains a comma.
+// contains a comma. The array operators write the same list in braces,
+// `cs.{a,b}`, and read the same way.
 func restValues(val string) []string {
-	val = strings.TrimPrefix(strings.TrimSuffix(val, ")"), "(")
-	parts := strings.Split(val, ",")
+	switch {
+	case strings.HasPrefix(val, "(") && strings.HasSuffix(val, ")"),
+		strings.HasPrefix(val, "{") && strings.HasSuffix(val, "}"):
+		val = val[1 : len(val)-1]
+	}
+	parts := restSplit(val)
 	out := make([]string, 0, len(parts))
 	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		p = strings.TrimPrefix(strings.TrimSuffix(p, `"`), `"`)
-		if p != "" {
+		if p = restUnquote(p); p != "" {
 			out = append(out, p)
 		}
 	}
 	return out
 }
 
+// restSplit splits a list on its top-level commas: one inside parentheses,
+// braces or double quotes belongs to the member and not to the list. Members come back
+// trimmed, and empty ones are dropped.
+func restSplit(list string) []string {
+	var out []string
+	depth, quoted, start := 0, false, 0
+	flush := func(end int) {
+		if member := strings.TrimSpace(list[start:end]); member != "" {
+			out = append(out, member)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(list); i++ {
+		switch c := list[i]; {
+		case c == '\\' && quoted:
+			i++ // an escaped character inside quotes is never structure
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			flush(i)
+		}
+	}
+	flush(len(list))
+	return out
+}
+
+// restUnquote strips the double quotes the wire puts around a value holding
+// a reserved character, and the backslashes escaping quotes inside it.
+func restUnquote(val string) string {
+	val = strings.TrimSpace(val)
+	if len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"' {
+		val = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(val[1 : len(val)-1])
+	}
+	return val
+}
+
 func sortStrings(s []string) {
 	for i := 1; i < len(s); i++ {
 		for j := i; j > 0 && s[j] < s[j-1]; j-- {
@@ -465,6 +745,166 @@ func restSort(order string) (string, error) {
 	return strings.Join(terms, ","), nil
 }
 
+// --- embedding --------------------------------------------------------------
+//
+// `select=*,author(name)` nests the related row into each row it points at.
+// The wire finds the relationship through foreign keys; here it is a relation
+// field, so an embed is Base's own expand under the wire's spelling — and an
+// expand applies the related collection's VIEW rule to every row it nests. An
+// embed that answered from the related table directly would be a read the
+// related collection never agreed to.
+
+// restEmbed is one related table nested into the rows, as select named it.
+type restEmbed struct {
+	// Name is what the caller wrote: a relation field of this collection, or
+	// a collection with a relation field pointing back at it. It is also the
+	// key the nested rows are rendered under.
+	Name string
+
+	// Hint names the relation field of a back-related collection, the wire's
+	// `name!field(...)`, for when more than one of its fields points back.
+	Hint string
+
+	// Embeds are the tables nested one level further in.
+	Embeds []*restEmbed
+
+	// expand is the relation this embed resolved to, in expand's spelling,
+	// and many whether it nests a list rather than one row or null. Both are
+	// set by restBindEmbeds.
+	expand string
+	many   bool
+}
+
+var (
+	restColumnName = regexp.MustCompile(`^\w+$`)
+	restEmbedTerm  = regexp.MustCompile(`^(\w+)(?:!(\w+))?\((.*)\)$`)
+)
+
+// restSelect reads a select list into the fields picker's paths and the
+// embeds it names, with prefix being the path of the embed being read.
+//
+// Only what both ends can honour is accepted: columns, `*` and embeds. An
+// alias, a cast or a json path is refused rather than dropped, since a
+// column the caller renamed would otherwise come back under a name they
+// did not ask for.
+func restSelect(sel string, prefix string) ([]string, []*restEmbed, error) {
+	terms := restSplit(sel)
+	if len(terms) == 0 {
+		return nil, nil, fmt.Errorf("select %q names no columns", sel)
+	}
+
+	fields := make([]string, 0, len(terms))
+	var embeds []*restEmbed
+	for _, term := range terms {
+		if term == "*" || restColumnName.MatchString(term) {
+			fields = append(fields, prefix+term)
+			continue
+		}
+
+		m := restEmbedTerm.FindStringSubmatch(term)
+		if m == nil {
+			return nil, nil, fmt.Errorf("select term %q: only columns, * and embedded tables, e.g. author(*), are supported", term)
+		}
+
+		if strings.TrimSpace(m[3]) == "" {
+			return nil, nil, fmt.Errorf("select term %q names no columns of %s, e.g. %s(*)", term, m[1], m[1])
+		}
+		subFields, subEmbeds, err := restSelect(m[3], prefix+m[1]+".")
+		if err != nil {
+			return nil, nil, err
+		}
+		fields = append(fields, subFields...)
+		embeds = append(embeds, &restEmbed{Name: m[1], Hint: m[2], Embeds: subEmbeds})
+	}
+	return fields, embeds, nil
+}
+
+// restBindEmbeds resolves each embed against the collection it nests into and
+// returns the expand paths that load them, prefixed with the path of the
+// embed being bound.
+//
+// A relation field is the forward direction and nests what it points at, one
+// row or a list as the field holds. A collection with a relation field
+// pointing back nests the rows pointing here, a list — unless the field is
+// unique, in which case there is at most one.
+func restBindEmbeds(app core.App, collection *core.Collection, embeds []*restEmbed, prefix string) ([]string, error) {
+	var paths []string
+	for _, em := range embeds {
+		var related *core.Collection
+
+		if field, ok := collection.Fields.GetByName(em.Name).(*core.RelationField); ok && em.Hint == "" {
+			related, _ = app.FindCachedCollectionByNameOrId(field.CollectionId)
+			if related == nil {
+				return nil, fmt.Errorf("select %s(...): the collection %s points at no longer exists", em.Name, em.Name)
+			}
+			em.expand, em.many = em.Name, field.IsMultiple()
+		} else {
+			related, _ = app.FindCachedCollectionByNameOrId(em.Name)
+			if related == nil {
+				return nil, fmt.Errorf("select %s(...): %s is neither a relation field of %s nor a table", em.Name, em.Name, collection.Name)
+			}
+
+			var back []*core.RelationField
+			for _, f := range related.Fields {
+				if rf, ok := f.(*core.RelationField); ok && rf.CollectionId == collection.Id && (em.Hint == "" || rf.Name == em.Hint) {
+					back = append(back, rf)
+				}
+			}
+			switch {
+			case len(back) == 0 && em.Hint != "":
+				return nil, fmt.Errorf("select %s!%s(...): %s.%s is not a relation to %s", em.Name, em.Hint, em.Name, em.Hint, collection.Name)
+			case len(back) == 0:
+				return nil, fmt.Errorf("select %s(...): no relation between %s and %s", em.Name, collection.Name, em.Name)
+			case len(back) > 1:
+				return nil, fmt.Errorf("select %s(...): %s relates to %s through more than one field; name it, e.g. %s!%s(...)",
+					em.Name, em.Name, collection.Name, em.Name, back[0].Name)
+			}
+
+			_, unique := dbutils.FindSingleColumnUniqueIndex(related.Indexes, back[0].Name)
+			em.expand, em.many = related.Name+"_via_"+back[0].Name, !unique
+		}
+
+		path := prefix + em.expand
+		if len(em.Embeds) == 0 {
+			paths = append(paths, path)
+			continue
+		}
+		sub, err := restBindEmbeds(app, related, em.Embeds, path+".")
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+	return paths, nil
+}
+
+// restEmbedRow renders a record with its embeds nested in place: under the
+// name the caller used, never in Base's `expand` envelope, and as null or []
+// when the relation is empty or the view rule hid what it points at.
+func restEmbedRow(record *core.Record, embeds []*restEmbed) map[string]any {
+	row := record.PublicExport()
+	delete(row, core.FieldNameExpand)
+
+	for _, em := range embeds {
+		related := record.ExpandedAll(em.expand)
+		if !em.many {
+			if len(related) == 0 {
+				row[em.Name] = nil
+			} else {
+				row[em.Name] = restEmbedRow(related[0], em.Embeds)
+			}
+			continue
+		}
+
+		nested := make([]map[string]any, len(related))
+		for i, r := range related {
+			nested[i] = restEmbedRow(r, em.Embeds)
+		}
+		row[em.Name] = nested
+	}
+	return row
+}
+
 // --- writes -----------------------------------------------------------------
 //
 // The wire's writes are FILTERED where Base's are by-id: PATCH /posts?id=eq.7
@@ -488,6 +928,8 @@ const restWriteCeiling = 500
 // failure rolls the whole thing back, and looping would half-apply it and report
 // success for the rows that landed. Base's own batch plane is the honest home
 // for that, and it ships disabled.
+//
+// `Prefer: resolution=merge-duplicates` makes it an upsert (see restUpsert).
 func restCreate(e *core.RequestEvent) error {
 	body, err := io.ReadAll(io.LimitReader(e.Request.Body, 1<<20))
 	if err != nil {
@@ -503,8 +945,17 @@ func restCreate(e *core.RequestEvent) error {
 	call := &restCall{hold: true}
 	e.Request = e.Request.WithContext(context.WithValue(e.Request.Context(), restWireKey{}, call))
 
-	if err := recordCreate(true, nil)(e); err != nil {
-		return restFail(e, err)
+	apply := recordCreate(true, nil)
+	if resolution := restResolution(e); resolution != "" {
+		apply, err = restUpsert(e, body, resolution)
+		if err != nil {
+			return restFail(e, err)
+		}
+	}
+	if apply != nil {
+		if err := apply(e); err != nil {
+			return restFail(e, err)
+		}
 	}
 
 	if restWantsObject(e) && len(call.rows) != 1 {
@@ -518,9 +969,97 @@ func restCreate(e *core.RequestEvent) error {
 	if restWantsObject(e) {
 		return e.JSON(http.StatusCreated, call.rows[0])
 	}
+	if call.rows == nil {
+		call.rows = []*core.Record{}
+	}
 	return e.JSON(http.StatusCreated, call.rows)
 }
 
+// restResolution reads how the caller wants an insert that collides with an
+// existing row resolved: "merge-duplicates", "ignore-duplicates", or "" for a
+// plain insert.
+func restResolution(e *core.RequestEvent) string {
+	for _, raw := range e.Request.Header.Values("Prefer") {
+		for _, part := range strings.Split(raw, ",") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(part), "resolution="); ok {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// restUpsert decides what an insert under a resolution preference does, and
+// returns the handler that does it — nil when there is nothing to do.
+//
+// The conflict target is `on_conflict=col,...`, the primary key when absent,
+// and the row it selects is looked up with the body's values for those
+// columns, through the same list rule a GET obeys. No row is an insert; one
+// row is an update of it by Base's own handler, under its update rule, or
+// nothing at all for ignore-duplicates. The wire leans on a unique index to
+// make more than one row impossible; nothing guarantees that here, so a target
+// selecting several is refused rather than merged into an arbitrary one.
+//
+// A row the caller cannot see is not found, and the insert then collides with
+// it as a plain insert would: 23505, which says no more than the row exists.
+func restUpsert(e *core.RequestEvent, body []byte, resolution string) (func(*core.RequestEvent) error, error) {
+	if resolution != "merge-duplicates" && resolution != "ignore-duplicates" {
+		return nil, e.BadRequestError(fmt.Sprintf(
+			"Prefer: resolution=%s is not a resolution; use merge-duplicates or ignore-duplicates", resolution), nil)
+	}
+
+	collection, err := e.App.FindCachedCollectionByNameOrId(e.Request.PathValue("collection"))
+	if err != nil || collection == nil {
+		return nil, e.NotFoundError("Missing collection context.", err)
+	}
+
+	data := map[string]any{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, e.BadRequestError("An upsert needs a JSON object body.", err)
+	}
+
+	target := []string{core.FieldNameId}
+	if raw := e.Request.URL.Query().Get("on_conflict"); raw != "" {
+		target = restSplit(raw)
+	}
+
+	preds := make([]restPredicate, 0, len(target))
+	for _, col := range target {
+		switch v := data[col].(type) {
+		case nil:
+			// a target the body leaves out (or nulls) cannot collide, since
+			// a unique index does not compare NULLs
+			return recordCreate(true, nil), nil
+		case bool:
+			preds = append(preds, restPredicate{Col: col, Op: "is", Vals: []string{strconv.FormatBool(v)}})
+		case string, float64:
+			preds = append(preds, restPredicate{Col: col, Op: "eq", Vals: []string{fmt.Sprint(v)}})
+		default:
+			return nil, e.BadRequestError(fmt.Sprintf("on_conflict column %s must hold a scalar value", col), nil)
+		}
+	}
+
+	ids, err := restMatchingIDs(e, collection, preds)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(ids) == 0:
+		return recordCreate(true, nil), nil
+	case len(ids) > 1:
+		return nil, e.BadRequestError(fmt.Sprintf(
+			"on_conflict (%s) selects %d rows; it has to name a unique key", strings.Join(target, ","), len(ids)), nil)
+	case resolution == "ignore-duplicates":
+		return nil, nil
+	}
+
+	return func(e *core.RequestEvent) error {
+		e.Request.SetPathValue("id", ids[0])
+		return recordUpdate(true, nil)(e)
+	}, nil
+}
+
 // restUpdate applies one patch to every row a filter selects.
 func restUpdate(e *core.RequestEvent) error {
 	return restWriteOverRows(e, func(e *core.RequestEvent, id string) error {
@@ -561,7 +1100,7 @@ func restWriteOverRows(e *core.RequestEvent, apply func(*core.RequestEvent, stri
 
 	ids, err := restMatchingIDs(e, collection, preds)
 	if err != nil {
-		return err
+		return restFail(e, err)
 	}
 
 	call := &restCall{preds: preds, hold: true}
@@ -578,6 +1117,10 @@ func restWriteOverRows(e *core.RequestEvent, apply func(*core.RequestEvent, stri
 
 // restMatchingIDs resolves a filter to the ids of the rows it selects, through
 // the same list rule a GET obeys.
+//
+// It answers nothing itself: a refusal comes back as an error for the caller
+// to render with restFail, so a write cannot carry on past one that was
+// already written to the response.
 func restMatchingIDs(e *core.RequestEvent, collection *core.Collection, preds []restPredicate) ([]string, error) {
 	requestInfo, err := e.RequestInfo()
 	if err != nil {
@@ -603,9 +1146,14 @@ func restMatchingIDs(e *core.RequestEvent, collection *core.Collection, preds []
 		q.AndWhere(expr)
 	}
 
+	if err := applyTrashFilter(resolver, collection, requestInfo, q); err != nil {
+		return nil, firstApiError(err, e.BadRequestError("", err))
+	}
+	applyPublishedFilter(collection, requestInfo, q)
+
 	where, err := restWhere(resolver, preds)
 	if err != nil {
-		return nil, restError(e, http.StatusBadRequest, "bad_query", err.Error(), "")
+		return nil, e.BadRequestError(err.Error(), err)
 	}
 	if where != nil {
 		q.AndWhere(where)
@@ -619,9 +1167,8 @@ func restMatchingIDs(e *core.RequestEvent, collection *core.Collection, preds []
 		return nil, firstApiError(err, e.InternalServerError("Failed to resolve the affected rows.", err))
 	}
 	if len(records) > restWriteCeiling {
-		return nil, restError(e, http.StatusBadRequest, "bad_query",
-			fmt.Sprintf("this filter selects more than %d rows", restWriteCeiling),
-			"narrow the filter, or make the change in batches")
+		return nil, e.BadRequestError(fmt.Sprintf(
+			"this filter selects more than %d rows; narrow the filter, or make the change in batches", restWriteCeiling), nil)
 	}
 
 	ids := make([]string, 0, len(records))
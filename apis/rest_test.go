@@ -24,6 +24,12 @@ func TestRestQueryTranslates(t *testing.T) {
 		name: "select becomes fields",
 		in:   "select=id,name",
 		want: map[string]string{"fields": "id,name", "skipTotal": "1"},
+	}, {
+		// An embed is a path into the nested rows, which is how the fields
+		// picker reads it; the relation itself is bound later, by restList.
+		name: "an embedded table's columns become nested fields",
+		in:   "select=id,author(name,org(*))",
+		want: map[string]string{"fields": "id,author.name,author.org.*", "skipTotal": "1"},
 	}, {
 		name: "select=* asks for everything, which is the default",
 		in:   "select=*",
@@ -40,6 +46,12 @@ func TestRestQueryTranslates(t *testing.T) {
 		name: "limit and a page-aligned offset become page/perPage",
 		in:   "limit=25&offset=50",
 		want: map[string]string{"perPage": "25", "page": "3", "skipTotal": "1"},
+	}, {
+		// The page it falls in, so the provider reports a page that holds it;
+		// the exact start travels on the call (TestRestQueryCarriesTheOffset).
+		name: "an offset off a page boundary still names its page",
+		in:   "limit=25&offset=30",
+		want: map[string]string{"perPage": "25", "page": "2", "skipTotal": "1"},
 	}, {
 		name:    "asking for a count drops skipTotal",
 		in:      "limit=10",
@@ -97,6 +109,18 @@ func TestRestPredicates(t *testing.T) {
 		name: "the wildcard this wire spells with a star becomes SQL's",
 		in:   "name=like.*ace*",
 		want: []restPredicate{{Col: "name", Op: "like", Vals: []string{"%ace%"}}},
+	}, {
+		name: "the array operators read a braced list",
+		in:   "tags=cs.{a,\"b,c\"}",
+		want: []restPredicate{{Col: "tags", Op: "cs", Vals: []string{"a", "b,c"}}},
+	}, {
+		name: "an empty list is a real answer for containment",
+		in:   "tags=cd.{}",
+		want: []restPredicate{{Col: "tags", Op: "cd"}},
+	}, {
+		name: "plfts is fts",
+		in:   "title=plfts.quick fox",
+		want: []restPredicate{{Col: "title", Op: "fts", Vals: []string{"quick fox"}}},
 	}, {
 		name: "select and paging are not predicates",
 		in:   "select=id&limit=5&offset=0&order=id",
@@ -121,12 +145,32 @@ func TestRestPredicates(t *testing.T) {
 	}
 }
 
-// A window or an operator this store cannot honour is REFUSED. Rounding an
-// unaligned offset would answer with real rows for the wrong range, which is
-// indistinguishable from correct data at the call site.
+// An offset off a page boundary is carried exactly rather than rounded: a
+// window shifted to the nearest page would answer with real rows for the wrong
+// range, which is indistinguishable from correct data at the call site.
+func TestRestQueryCarriesTheOffset(t *testing.T) {
+	for _, s := range []struct {
+		in   string
+		want int
+	}{
+		{"limit=25&offset=30", 30},
+		{"limit=25&offset=50", 0}, // a page says it exactly
+		{"limit=25", 0},
+	} {
+		in, _ := url.ParseQuery(s.in)
+		_, call, err := restQuery(in, false)
+		if err != nil {
+			t.Fatalf("restQuery(%q) errored: %v", s.in, err)
+		}
+		if call.offset != s.want {
+			t.Errorf("restQuery(%q) carried offset %d, want %d", s.in, call.offset, s.want)
+		}
+	}
+}
+
+// A window or an operator this store cannot honour is REFUSED.
 func TestRestQueryRefusesWhatItCannotHonour(t *testing.T) {
 	for _, s := range []struct{ name, in, wants string }{
-		{"offset off a page boundary", "limit=25&offset=30", "page boundary"},
 		{"offset with no limit", "offset=30", "needs a limit"},
 		{"a negative limit", "limit=-1", "non-negative"},
 		{"an unparseable limit", "limit=many", "non-negative"},
@@ -134,6 +178,12 @@ func TestRestQueryRefusesWhatItCannotHonour(t *testing.T) {
 		{"a predicate with no operator", "status=active", "needs an operator"},
 		{"is with something that is not a literal", "x=is.7", "null, true or false"},
 		{"an order direction this store cannot express", "order=a.desc.nullsfirst", "asc and desc"},
+		{"a renamed column", "select=id,name:title", "only columns"},
+		{"a cast", "select=id::text", "only columns"},
+		{"an embed with no columns", "select=id,author()", "names no columns"},
+		{"a logical group without its parentheses", "or=a.eq.1,b.eq.2", "parenthesised list"},
+		{"a group member with no operator", "or=(a,b.eq.2)", "needs a column and an operator"},
+		{"a text search configuration", "title=fts(english).fox", "configuration"},
 	} {
 		t.Run(s.name, func(t *testing.T) {
 			in, _ := url.ParseQuery(s.in)
@@ -149,6 +199,40 @@ func TestRestQueryRefusesWhatItCannotHonour(t *testing.T) {
 	}
 }
 
+// A logical group is a predicate whose members are predicates, nested as
+// deep as the caller wrote them.
+func TestRestPredicatesLogicalGroups(t *testing.T) {
+	in, _ := url.ParseQuery(`not.or=(a.eq.1,and(b.not.in.("x,y",z),c.eq."d,e"))`)
+
+	preds, err := restPredicates(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preds) != 1 {
+		t.Fatalf("want one group, got %+v", preds)
+	}
+
+	or := preds[0]
+	if or.Group != "or" || !or.Negate || len(or.Preds) != 2 {
+		t.Fatalf("want a negated or of two members, got %+v", or)
+	}
+	if a := or.Preds[0]; a.Col != "a" || a.Op != "eq" || a.Vals[0] != "1" {
+		t.Errorf("first member = %+v, want a=eq.1", a)
+	}
+
+	and := or.Preds[1]
+	if and.Group != "and" || and.Negate || len(and.Preds) != 2 {
+		t.Fatalf("want a nested and of two members, got %+v", and)
+	}
+	if b := and.Preds[0]; b.Col != "b" || b.Op != "in" || !b.Negate || strings.Join(b.Vals, "|") != "x,y|z" {
+		t.Errorf("nested in = %+v, want b=not.in.(\"x,y\",z)", b)
+	}
+	// The quotes are the wire's, around a value holding a comma.
+	if c := and.Preds[1]; c.Col != "c" || c.Vals[0] != "d,e" {
+		t.Errorf("nested eq = %+v, want c=eq.d,e", c)
+	}
+}
+
 // The predicate order is stable for one request. url.Values iterates randomly,
 // so without an explicit order the same query yields a different expression run
 // to run, which cannot be reproduced from a log.
@@ -0,0 +1,421 @@
+package apis
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/router"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/dbx"
+	"github.com/spf13/cast"
+)
+
+// Saved views, executed on the server.
+//
+//	GET /v1/views/{id}/records   the records the view selects, in its order
+//	GET /v1/views/{id}/groups    the group-by buckets of the view, with their counts
+//
+// A saved view is a _views record and its _view_filters, _view_sorts and
+// _view_groups rows (see migrations/1780000000_views_metadata.go). They are
+// compiled here into Base's own ?filter= and ?sort= expressions and handed to
+// recordsList and the aggregate, pointed at the view's collection, the same
+// way the /rest door hands over its query: so a view reads exactly what its
+// caller could list with the same filter by hand — the list rule, the trash
+// and the drafts all apply — and there is no second query engine. The
+// records read also takes the usual list params (page, perPage, expand,
+// fields, skipTotal), a ?filter= ANDed with the view's and a ?sort= in place
+// of it, and ?group=<value> for the records of one bucket.
+//
+// The view itself is read under the _views view rule, and only the filter,
+// sort and group rows of the view's owner are compiled, since anyone signed
+// in may create a row naming someone else's view.
+//
+// The filter rows are grouped by their group index. With the view's
+// filter_logic "and" (the default) the rows of a group are ANDed and the
+// groups ORed; with "or" the rows of a group are ORed and the groups ANDed.
+// Either way a view whose rows are all in one group joins them with its
+// filter_logic.
+
+const (
+	viewsCollection       = "_views"
+	viewFiltersCollection = "_view_filters"
+	viewSortsCollection   = "_view_sorts"
+	viewGroupsCollection  = "_view_groups"
+)
+
+// viewGroupQueryParam selects the records of one bucket of a grouped view.
+const viewGroupQueryParam = "group"
+
+// viewFilterOperators maps the _view_filters operators that compare with a
+// value to the filter operators they compile to.
+var viewFilterOperators = map[string]string{
+	"eq":    "=",
+	"neq":   "!=",
+	"gt":    ">",
+	"gte":   ">=",
+	"lt":    "<",
+	"lte":   "<=",
+	"like":  "~",
+	"nlike": "!~",
+}
+
+// viewFieldPattern is what a view may name as a field: a field of the
+// collection or a path through its relations, never a macro or an @ field.
+var viewFieldPattern = regexp.MustCompile(`^\w+(\.\w+)*$`)
+
+func bindViewsApi(app core.App, rg *router.RouterGroup[*core.RequestEvent]) {
+	// Unbound from the default limiter for the same reason the record routes
+	// are: the reads count against the view's collection.
+	sub := rg.Group("/views/{id}").Unbind(DefaultRateLimitMiddlewareId)
+	sub.GET("/records", viewRecords)
+	sub.GET("/groups", viewGroups)
+}
+
+// savedView is a _views record compiled for its collection.
+type savedView struct {
+	collection *core.Collection
+
+	filter  string
+	sort    string
+	groupBy string
+
+	// groups are the view's _view_groups rows, by position.
+	groups []*core.Record
+}
+
+// viewGroupBucket is one bucket of a grouped view.
+type viewGroupBucket struct {
+	Value     any  `json:"value"`
+	Count     int  `json:"count"`
+	Collapsed bool `json:"collapsed"`
+}
+
+func viewRecords(e *core.RequestEvent) error {
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+
+	view, err := loadSavedView(e, requestInfo)
+	if err != nil {
+		return err
+	}
+
+	query := e.Request.URL.Query()
+
+	filters := []string{view.filter, query.Get(search.FilterQueryParam)}
+	if query.Has(viewGroupQueryParam) {
+		if view.groupBy == "" {
+			return e.BadRequestError("The view has no group-by field.", nil)
+		}
+
+		// the bucket value is compared as what the field holds
+		var group any = query.Get(viewGroupQueryParam)
+		if field := view.collection.Fields.GetByName(view.groupBy); field != nil {
+			switch field.Type() {
+			case core.FieldTypeBool:
+				group = cast.ToBool(group)
+			case core.FieldTypeNumber:
+				group = cast.ToFloat64(group)
+			}
+		}
+
+		filters = append(filters, string(search.FilterData(view.groupBy+" = {:group}").Bind(dbx.Params{
+			"group": group,
+		})))
+		query.Del(viewGroupQueryParam)
+	}
+	setViewFilter(query, filters...)
+
+	if query.Get(search.SortQueryParam) == "" && view.sort != "" {
+		query.Set(search.SortQueryParam, view.sort)
+	}
+
+	e.Request.URL.RawQuery = query.Encode()
+	e.Request.SetPathValue("collection", view.collection.Id)
+	setViewRequestInfoQuery(requestInfo, query)
+
+	return recordsList(e)
+}
+
+func viewGroups(e *core.RequestEvent) error {
+	requestInfo, err := e.RequestInfo()
+	if err != nil {
+		return firstApiError(err, e.BadRequestError("", err))
+	}
+
+	view, err := loadSavedView(e, requestInfo)
+	if err != nil {
+		return err
+	}
+
+	if view.groupBy == "" {
+		return e.BadRequestError("The view has no group-by field.", nil)
+	}
+
+	params := url.Values{}
+	setViewFilter(params, view.filter, e.Request.URL.Query().Get(search.FilterQueryParam))
+	params.Set("groupBy", view.groupBy)
+	params.Set("count", "*")
+
+	setViewRequestInfoQuery(requestInfo, params)
+
+	items, err := aggregateRecords(e, view.collection, requestInfo, params)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int, len(items))
+	values := make([]any, 0, len(items))
+	for _, item := range items {
+		value := item.Group[view.groupBy]
+		counts[cast.ToString(value)] = cast.ToInt(item.Count["*"])
+		values = append(values, value)
+	}
+
+	// the view's own buckets first, in its order, then the values it has no
+	// bucket for, in the aggregate's
+	buckets := make([]*viewGroupBucket, 0, len(view.groups)+len(items))
+	seen := make(map[string]bool, len(view.groups))
+	for _, group := range view.groups {
+		value := group.GetString("field_value")
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+
+		buckets = append(buckets, &viewGroupBucket{
+			Value:     value,
+			Count:     counts[value],
+			Collapsed: group.GetBool("collapsed"),
+		})
+	}
+	for _, value := range values {
+		if seen[cast.ToString(value)] {
+			continue
+		}
+
+		buckets = append(buckets, &viewGroupBucket{
+			Value: value,
+			Count: counts[cast.ToString(value)],
+		})
+	}
+
+	return execAfterSuccessTx(true, e.App, func() error {
+		return e.JSON(http.StatusOK, map[string]any{
+			"field": view.groupBy,
+			"items": buckets,
+		})
+	})
+}
+
+// loadSavedView reads the view of the request, as its caller may see it,
+// and compiles it.
+func loadSavedView(e *core.RequestEvent, requestInfo *core.RequestInfo) (*savedView, error) {
+	viewsCol, err := e.App.FindCachedCollectionByNameOrId(viewsCollection)
+	if err != nil || viewsCol == nil {
+		return nil, e.NotFoundError("Missing views collection.", err)
+	}
+
+	record, err := e.App.FindRecordById(viewsCol, e.Request.PathValue("id"), viewGate(e.App, viewsCol, requestInfo))
+	if err != nil || record == nil {
+		return nil, firstApiError(err, e.NotFoundError("", err))
+	}
+
+	collection, err := e.App.FindCachedCollectionByNameOrId(record.GetString("collection"))
+	if err != nil || collection == nil {
+		return nil, e.NotFoundError("Missing view collection.", err)
+	}
+
+	err = checkCollectionRateLimit(e, collection, "list")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := func(collectionName string) ([]*core.Record, error) {
+		return e.App.FindRecordsByFilter(
+			collectionName,
+			"view = {:view} && owner = {:owner}",
+			"position",
+			0,
+			0,
+			dbx.Params{"view": record.Id, "owner": record.GetString("owner")},
+		)
+	}
+
+	view := &savedView{
+		collection: collection,
+		groupBy:    record.GetString("group_by_field"),
+	}
+
+	if view.groupBy != "" && !viewFieldPattern.MatchString(view.groupBy) {
+		return nil, e.BadRequestError(fmt.Sprintf("Invalid view group-by field %q.", view.groupBy), nil)
+	}
+
+	filterRows, err := rows(viewFiltersCollection)
+	if err != nil {
+		return nil, e.InternalServerError("", err)
+	}
+
+	view.filter, err = compileViewFilter(record.GetString("filter_logic"), filterRows)
+	if err != nil {
+		return nil, e.BadRequestError("Invalid view filter.", err)
+	}
+
+	sortRows, err := rows(viewSortsCollection)
+	if err != nil {
+		return nil, e.InternalServerError("", err)
+	}
+
+	view.sort, err = compileViewSort(sortRows)
+	if err != nil {
+		return nil, e.BadRequestError("Invalid view sort.", err)
+	}
+
+	if view.groupBy != "" {
+		view.groups, err = rows(viewGroupsCollection)
+		if err != nil {
+			return nil, e.InternalServerError("", err)
+		}
+	}
+
+	return view, nil
+}
+
+// compileViewFilter compiles the _view_filters rows of a view into a filter
+// expression, with its values bound in place.
+func compileViewFilter(logic string, rows []*core.Record) (string, error) {
+	params := dbx.Params{}
+	groups := map[int][]string{}
+
+	for i, row := range rows {
+		field := row.GetString("field")
+		if !viewFieldPattern.MatchString(field) {
+			return "", fmt.Errorf("invalid field %q", field)
+		}
+
+		var condition string
+
+		switch op := row.GetString("operator"); op {
+		case "empty":
+			condition = field + ` = ""`
+		case "nempty":
+			condition = field + ` != ""`
+		default:
+			sign, ok := viewFilterOperators[op]
+			if !ok {
+				return "", fmt.Errorf("invalid operator %q of field %q", op, field)
+			}
+
+			var value any
+			if raw := row.GetString("value"); raw != "" {
+				if err := json.Unmarshal([]byte(raw), &value); err != nil {
+					return "", fmt.Errorf("invalid value of field %q: %w", field, err)
+				}
+			}
+
+			// a list is any of its values, or none of them
+			values, isList := value.([]any)
+			if !isList {
+				values = []any{value}
+			} else if op != "eq" && op != "neq" {
+				return "", fmt.Errorf("operator %q of field %q takes a single value", op, field)
+			}
+			if len(values) == 0 {
+				continue
+			}
+
+			parts := make([]string, len(values))
+			for j, v := range values {
+				key := fmt.Sprintf("v%d_%d", i, j)
+				params[key] = v
+				parts[j] = field + " " + sign + " {:" + key + "}"
+			}
+
+			join := " || "
+			if op == "neq" {
+				join = " && "
+			}
+			condition = "(" + strings.Join(parts, join) + ")"
+		}
+
+		group := row.GetInt("group")
+		groups[group] = append(groups[group], condition)
+	}
+
+	if len(groups) == 0 {
+		return "", nil
+	}
+
+	inner, outer := " && ", " || "
+	if logic == "or" {
+		inner, outer = " || ", " && "
+	}
+
+	keys := make([]int, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	clauses := make([]string, len(keys))
+	for i, k := range keys {
+		clauses[i] = "(" + strings.Join(groups[k], inner) + ")"
+	}
+
+	return string(search.FilterData(strings.Join(clauses, outer)).Bind(params)), nil
+}
+
+// compileViewSort compiles the _view_sorts rows of a view into a sort
+// expression.
+func compileViewSort(rows []*core.Record) (string, error) {
+	fields := make([]string, 0, len(rows))
+
+	for _, row := range rows {
+		field := row.GetString("field")
+		if !viewFieldPattern.MatchString(field) {
+			return "", fmt.Errorf("invalid field %q", field)
+		}
+
+		if row.GetString("direction") == "desc" {
+			field = "-" + field
+		}
+
+		fields = append(fields, field)
+	}
+
+	return strings.Join(fields, ","), nil
+}
+
+// setViewFilter sets the ?filter= of query to the AND of the non-empty filters.
+func setViewFilter(query url.Values, filters ...string) {
+	var parts []string
+	for _, f := range filters {
+		if f != "" {
+			parts = append(parts, "("+f+")")
+		}
+	}
+
+	if len(parts) == 0 {
+		query.Del(search.FilterQueryParam)
+		return
+	}
+
+	query.Set(search.FilterQueryParam, strings.Join(parts, " && "))
+}
+
+// setViewRequestInfoQuery makes the (cached) request info of a view read say
+// the query the read is handed over with, since recordsList and the aggregate
+// check the filter they run through it.
+func setViewRequestInfoQuery(requestInfo *core.RequestInfo, query url.Values) {
+	clear(requestInfo.Query)
+	for k := range query {
+		requestInfo.Query[k] = query.Get(k)
+	}
+}
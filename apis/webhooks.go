@@ -0,0 +1,198 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/router"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// Outgoing webhooks.
+//
+// A webhook is a `_webhooks` row, and its deliveries are a queue (see
+// deliveryQueue): one `_webhook_deliveries` row per change per webhook that
+// wants it, sent by a scheduled job and retried from the row. A delivery that
+// ran out of attempts stays failed until it is replayed, which queues a copy
+// and keeps the original.
+//
+// The body is the change as `/v1/changes` answers it, and it is signed the way
+// Standard Webhooks signs: an HMAC-SHA256 under the webhook's secret of
+// `<id>.<timestamp>.<body>`, sent as
+//
+//	Webhook-Id:        the delivery id, to deduplicate on
+//	Webhook-Timestamp: unix seconds, to refuse a replayed request with
+//	Webhook-Signature: v1,<base64 signature>
+
+// The headers a delivery is signed with.
+const (
+	WebhookIdHeader        = "Webhook-Id"
+	WebhookTimestampHeader = "Webhook-Timestamp"
+	WebhookSignatureHeader = "Webhook-Signature"
+)
+
+var webhookClient = &http.Client{Timeout: 30 * time.Second}
+
+// webhookDeliveryQueue is the queue of the webhook deliveries.
+//
+// A delivery mostly waits on the network, so more are in flight at once than
+// function runs. From the retry base, the last of its 10 attempts is a little
+// over two hours after the one before it and about four after the first.
+var webhookDeliveryQueue = &deliveryQueue{
+	sink:            "webhooks",
+	collection:      core.CollectionNameWebhookDeliveries,
+	target:          "webhook",
+	action:          "action",
+	job:             "__hzWebhookDeliveries__",
+	cleanupJob:      "__hzWebhookDeliveriesCleanup__",
+	cleanupSchedule: "15 */6 * * *",
+	concurrency:     8,
+	maxAttempts:     10,
+	retryBase:       30 * time.Second,
+	maxDays:         30,
+	pending:         core.WebhookDeliveryPending,
+	done:            core.WebhookDeliveryDelivered,
+	failed:          core.WebhookDeliveryFailed,
+	doneAt:          "deliveredAt",
+	targets:         webhookTargets,
+	attempt:         attemptWebhookDelivery,
+}
+
+func init() {
+	core.AppBindings.Register(webhookDeliveryQueue.bind)
+}
+
+// bindWebhooksApi registers the webhook delivery endpoints.
+func bindWebhooksApi(app core.App, rg *router.RouterGroup[*core.RequestEvent]) {
+	sub := rg.Group("/webhooks").Bind(RequireSuperuserAuth())
+	sub.POST("/deliveries/{id}/replay", webhookDeliveryReplay)
+}
+
+// webhookDeliveryReplay queues a copy of a delivery to be sent again, whatever
+// became of the original.
+func webhookDeliveryReplay(e *core.RequestEvent) error {
+	original, err := e.App.FindRecordById(core.CollectionNameWebhookDeliveries, e.Request.PathValue("id"))
+	if err != nil {
+		return e.NotFoundError("", err)
+	}
+
+	replay := core.NewRecord(original.Collection())
+	for _, field := range []string{"webhook", "seq", "collection", "recordId", "action", "payload"} {
+		replay.Set(field, original.GetRaw(field))
+	}
+	replay.Set("status", core.WebhookDeliveryPending)
+	replay.Set("nextAttempt", types.NowDateTime())
+	replay.Set("replayOf", original.Id)
+
+	if err := e.App.Save(replay); err != nil {
+		return e.BadRequestError("Failed to queue the replay.", err)
+	}
+
+	return e.JSON(http.StatusOK, replay)
+}
+
+// -------------------------------------------------------------------
+
+// webhookTargets loads the active webhooks.
+func webhookTargets(app core.App) ([]deliveryTarget, error) {
+	webhooks, err := app.FindAllRecords(core.CollectionNameWebhooks, dbx.HashExp{"active": true})
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]deliveryTarget, len(webhooks))
+	for i, webhook := range webhooks {
+		targets[i] = deliveryTarget{
+			id: webhook.Id,
+			wants: func(app core.App, collection *core.Collection, action string, before *core.Record, after *core.Record) bool {
+				return webhookWants(app, webhook, collection, action, before, after)
+			},
+		}
+	}
+
+	return targets, nil
+}
+
+// webhookWants reports whether webhook is sent a change of collection.
+func webhookWants(app core.App, webhook *core.Record, collection *core.Collection, action string, before *core.Record, after *core.Record) bool {
+	if names := webhook.GetStringSlice("collections"); len(names) > 0 &&
+		!slices.Contains(names, collection.Name) && !slices.Contains(names, collection.Id) {
+		return false
+	}
+
+	if actions := webhook.GetStringSlice("actions"); len(actions) > 0 && !slices.Contains(actions, action) {
+		return false
+	}
+
+	return changeStateWanted(app, collection, webhook.GetString("filter"), before, after)
+}
+
+// attemptWebhookDelivery sends delivery once.
+func attemptWebhookDelivery(ctx context.Context, app core.App, delivery *core.Record) (bool, error) {
+	webhook, err := app.FindRecordById(core.CollectionNameWebhooks, delivery.GetString("webhook"))
+	if err != nil {
+		delivery.Set("responseStatus", 0)
+		return true, fmt.Errorf("the webhook %q is gone", delivery.GetString("webhook"))
+	}
+	if !webhook.GetBool("active") {
+		delivery.Set("responseStatus", 0)
+		return true, fmt.Errorf("the webhook %q is not active", webhook.Id)
+	}
+
+	payload, _ := delivery.GetRaw("payload").(types.JSONRaw)
+	status, err := sendWebhook(ctx, webhook.GetString("url"), webhook.GetString("secret"), delivery.Id, payload)
+	delivery.Set("responseStatus", status)
+
+	return false, err
+}
+
+// sendWebhook POSTs body to url signed with secret, and returns the status it
+// was answered with; any answer but a 2xx is an error.
+func sendWebhook(ctx context.Context, url string, secret string, id string, body []byte) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIdHeader, id)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "v1,"+WebhookSignature(secret, id, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drained, so the connection is reused, but not past what is worth reading
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the endpoint answered %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// WebhookSignature returns the signature of a webhook delivery, for a receiver
+// to compare with the one after "v1," in its Webhook-Signature header.
+func WebhookSignature(secret string, id string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/network"
+	"github.com/spf13/cobra"
+)
+
+// NewRestoreCommand creates and returns new command responsible for restoring
+// the data database to a point in time from a shard's network archive.
+//
+// It swaps the database in without restarting anything, so it is meant to be
+// run while the server is stopped; start it again afterwards.
+func NewRestoreCommand(app core.App) *cobra.Command {
+	var shard string
+	var at string
+	var archiveURL string
+	var dryRun bool
+	var timeout time.Duration
+
+	command := &cobra.Command{
+		Use:   "restore",
+		Args:  cobra.NoArgs,
+		Short: "Restores the data database to a point in time from the network archive",
+		Long: `Replays a shard's archived WAL frames into a fresh database, verifying
+every segment's signature against BASE_ARCHIVE_TRUSTED_KEYS, and swaps it in
+for the data database. Stop the server first.
+
+--at is a seq or an RFC 3339 time; without it the whole archive is replayed.
+--dry-run replays and reports the final seq and row counts without replacing
+anything.`,
+		SilenceUsage: true,
+		RunE: func(command *cobra.Command, args []string) error {
+			point, err := network.ParseRestorePoint(at)
+			if err != nil {
+				return err
+			}
+
+			cfg, err := network.ConfigFromEnv()
+			if err != nil {
+				return err
+			}
+			if archiveURL == "" {
+				archiveURL = cfg.Archive
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			archive, err := network.OpenRestoreArchive(ctx, archiveURL, cfg.ArchiveTrustedKeys)
+			if err != nil {
+				return err
+			}
+			defer archive.Close()
+
+			result, err := app.RestorePITR(ctx, core.PITROptions{
+				Archive:   archive,
+				Shard:     shard,
+				At:        point,
+				DryRun:    dryRun,
+				NoRestart: true,
+			})
+			if err != nil {
+				return err
+			}
+
+			printRestoreResult(command, result)
+
+			return nil
+		},
+	}
+
+	command.Flags().StringVar(&shard, "shard", "", "the shard to restore (the default shard is \"_\")")
+	command.Flags().StringVar(&at, "at", "", "restore up to this seq or RFC 3339 time (default the end of the archive)")
+	command.Flags().StringVar(&archiveURL, "archive", "", "archive URL, scheme://bucket[/prefix]/svc (default $BASE_ARCHIVE)")
+	command.Flags().BoolVar(&dryRun, "dry-run", false, "replay and report without replacing the data database")
+	command.Flags().DurationVar(&timeout, "timeout", 30*time.Minute, "overall deadline")
+	_ = command.MarkFlagRequired("shard")
+
+	return command
+}
+
+func printRestoreResult(command *cobra.Command, result *core.PITRResult) {
+	out := command.OutOrStdout()
+
+	verb := "restored"
+	if result.DryRun {
+		verb = "dry run: would restore"
+	}
+
+	fmt.Fprintf(out, "%s shard %q to seq %d (%s), %d frames, %d pages\n",
+		verb, result.Shard, result.Seq, result.Timestamp.Format(time.RFC3339), result.Frames, result.Pages)
+
+	names := make([]string, 0, len(result.Tables))
+	for name := range result.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-40s %d\n", name, result.Tables[name])
+	}
+}
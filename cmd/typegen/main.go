@@ -203,6 +203,10 @@ func fieldToTS(f field, idToName map[string]string) (tsType string, comment stri
 	case "text", "email", "url", "editor", "password":
 		return "string", ""
 
+	// read back as the merged text; written as ops
+	case "crdtText":
+		return "string", "crdt text"
+
 	case "number":
 		return "number", ""
 
@@ -218,6 +222,9 @@ func fieldToTS(f field, idToName map[string]string) (tsType string, comment stri
 	case "geoPoint":
 		return "{ lon: number; lat: number }", ""
 
+	case "vector":
+		return "number[]", "vector"
+
 	case "select":
 		return selectType(f), ""
 
@@ -88,6 +88,8 @@ func TestFieldToTS(t *testing.T) {
 		{"autodate", field{Type: "autodate"}, "string", ""},
 		{"json", field{Type: "json"}, "unknown", ""},
 		{"geoPoint", field{Type: "geoPoint"}, "{ lon: number; lat: number }", ""},
+		{"vector", field{Type: "vector"}, "number[]", "vector"},
+		{"crdtText", field{Type: "crdtText"}, "string", "crdt text"},
 		{"password", field{Type: "password"}, "string", ""},
 		{"file single", field{Type: "file", MaxSelect: 0}, "string", ""},
 		{"file multi", field{Type: "file", MaxSelect: 3}, "string[]", ""},
@@ -99,6 +99,10 @@ type App interface {
 	// SubscriptionsBroker returns the app realtime subscriptions broker instance.
 	SubscriptionsBroker() *subscriptions.Broker
 
+	// ChangeRelay returns the app record change relay instance, which
+	// delivers the committed record changes to the registered sinks.
+	ChangeRelay() *ChangeRelay
+
 	// NewMailClient creates and returns a new SMTP or Sendmail client
 	// based on the current app settings.
 	NewMailClient() mailer.Mailer
@@ -141,6 +145,16 @@ type App interface {
 	// NB! This feature is experimental and currently is expected to work only on UNIX based systems.
 	RestoreBackup(ctx context.Context, name string) error
 
+	// RestorePITR replays a shard's network archive into a fresh data database
+	// up to a seq or a time and, unless it is a dry run, swaps it in and
+	// restarts the current running application process.
+	//
+	// Please refer to the godoc of the specific core.App implementation
+	// for details on the restore procedures.
+	//
+	// NB! This feature is experimental and currently is expected to work only on UNIX based systems.
+	RestorePITR(ctx context.Context, opts PITROptions) (*PITRResult, error)
+
 	// Restart restarts (aka. replaces) the current running application process.
 	//
 	// NB! It relies on execve which is supported only on UNIX based systems.
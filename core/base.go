@@ -97,6 +97,7 @@ type BaseApp struct {
 	tasks               *tasks.Client
 	settings            *Settings
 	subscriptionsBroker *subscriptions.Broker
+	changeRelay         *ChangeRelay
 	logger              *slog.Logger
 	concurrentDB        dbx.Builder
 	nonconcurrentDB     dbx.Builder
@@ -256,6 +257,7 @@ func NewBaseApp(config BaseAppConfig) *BaseApp {
 		subscriptionsBroker: subscriptions.NewBroker(),
 		config:              &config,
 	}
+	app.changeRelay = newChangeRelay(app)
 
 	// apply config defaults
 	if app.config.DBConnect == nil {
@@ -279,7 +281,7 @@ func NewBaseApp(config BaseAppConfig) *BaseApp {
 
 	app.initHooks()
 	app.registerBaseHooks()
-	registerNATSHooks(app)
+	registerChangeRelay(app)
 	AppBindings.Apply(app)
 
 	return app
@@ -487,6 +489,10 @@ func (app *BaseApp) Bootstrap() error {
 			return err
 		}
 
+		// the local cron schedules pick up from where they got to
+		// before the app was last stopped
+		app.Tasks().SetLastRuns(newCronLastRuns(app))
+
 		// try to cleanup the data temp directory (if any)
 		_ = os.RemoveAll(filepath.Join(app.DataDir(), LocalTempDirName))
 
@@ -510,6 +516,7 @@ type closer interface {
 // (closing db connections, stopping cron ticker, etc.).
 func (app *BaseApp) ResetBootstrapState() error {
 	app.Cron().Stop()
+	app.changeRelay.Stop()
 
 	var errs []error
 
@@ -708,6 +715,11 @@ func (app *BaseApp) SubscriptionsBroker() *subscriptions.Broker {
 	return app.subscriptionsBroker
 }
 
+// ChangeRelay returns the app record change relay instance.
+func (app *BaseApp) ChangeRelay() *ChangeRelay {
+	return app.changeRelay
+}
+
 // NewMailClient creates and returns a new SMTP or Sendmail client
 // based on the current app settings.
 func (app *BaseApp) NewMailClient() mailer.Mailer {
@@ -1477,10 +1489,18 @@ func (app *BaseApp) registerBaseHooks() {
 		}
 	})
 
+	// purge the records trashed before their collection's retention
+	app.Cron().Add("__hzTrashPurge__", "45 */6 * * *", func() {
+		if err := PurgeTrashedRecords(app, time.Now()); err != nil {
+			app.Logger().Warn("Failed to purge trashed records", "error", err)
+		}
+	})
+
 	app.registerSettingsHooks()
 	app.registerAutobackupHooks()
 	app.registerCollectionHooks()
 	app.registerRecordHooks()
+	app.registerVectorIndexHooks()
 	app.registerSuperuserHooks()
 	app.registerNotifyWatcherHooks()
 }
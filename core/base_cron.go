@@ -0,0 +1,91 @@
+package core
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// paramsKeyCronLastRunPrefix prefixes the _params rows of [cronLastRuns],
+// one per schedule.
+const paramsKeyCronLastRunPrefix = "cronLastRun:"
+
+// cronLastRuns keeps how far each local cron schedule of the app got in the
+// _params table, so that after a restart the schedules catch up on the moments
+// the app was down for, as the cron catch-up policy says (see
+// [tasks.LastRuns]).
+//
+// Each schedule has a row of its own, so two writers never undo each other,
+// and the rows are written straight to the db rather than saved as models,
+// since they are the scheduler's own bookkeeping and not a change anyone
+// hooks into. A schedule moves on at most once a minute.
+type cronLastRuns struct {
+	app App
+}
+
+func newCronLastRuns(app App) *cronLastRuns {
+	return &cronLastRuns{app: app}
+}
+
+// Load implements [tasks.LastRuns].
+func (s *cronLastRuns) Load(name string) time.Time {
+	param := &Param{}
+	err := s.app.ModelQuery(param).Model(paramsKeyCronLastRunPrefix+name, param)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}
+	}
+
+	var last time.Time
+	if err == nil {
+		err = json.Unmarshal(param.Value, &last)
+	}
+	if err != nil {
+		s.app.Logger().Warn("Failed to load the cron job last run", "job", name, "error", err.Error())
+		return time.Time{}
+	}
+
+	return last
+}
+
+// Save implements [tasks.LastRuns].
+func (s *cronLastRuns) Save(name string, t time.Time) {
+	if err := s.save(name, t); err != nil {
+		s.app.Logger().Warn("Failed to save the cron job last run", "job", name, "error", err.Error())
+	}
+}
+
+func (s *cronLastRuns) save(name string, t time.Time) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	id := paramsKeyCronLastRunPrefix + name
+	now := types.NowDateTime().String()
+
+	result, err := s.app.NonconcurrentDB().Update(
+		paramsTable,
+		dbx.Params{"value": types.JSONRaw(raw), "updated": now},
+		dbx.HashExp{"id": id},
+	).Execute()
+	if err != nil {
+		return err
+	}
+
+	if updated, _ := result.RowsAffected(); updated > 0 {
+		return nil
+	}
+
+	_, err = s.app.NonconcurrentDB().Insert(paramsTable, dbx.Params{
+		"id":      id,
+		"value":   types.JSONRaw(raw),
+		"created": now,
+		"updated": now,
+	}).Execute()
+
+	return err
+}
@@ -0,0 +1,38 @@
+package core_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+)
+
+func TestCronLastRunsSurviveTheApp(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	if last := core.NewCronLastRuns(app).Load("test"); !last.IsZero() {
+		t.Fatalf("Expected no last run yet, got %v", last)
+	}
+
+	first := time.Date(2026, 3, 10, 3, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	lastRuns := core.NewCronLastRuns(app)
+	lastRuns.Save("test", first)
+	lastRuns.Save("other", first)
+	lastRuns.Save("test", second)
+
+	// read anew, as by the next process
+	reloaded := core.NewCronLastRuns(app)
+
+	if last := reloaded.Load("test"); !last.Equal(second) {
+		t.Fatalf("Expected %v, got %v", second, last)
+	}
+	if last := reloaded.Load("other"); !last.Equal(first) {
+		t.Fatalf("Expected %v, got %v", first, last)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/hanzoai/base/network"
 	"github.com/hanzoai/dbx"
@@ -24,13 +26,33 @@ type baseNetwork = network.Network
 // default shard ("_") so baseline replication works; multi-shard
 // registration is driven by per-request shard resolution upstream.
 func (app *BaseApp) attachNetwork(ctx context.Context) error {
-	net, err := network.FromEnv()
+	cfg, err := network.ConfigFromEnv()
 	if err != nil {
 		return fmt.Errorf("network from env: %w", err)
 	}
+	// Replicas of the shards this member holds live with the rest of its
+	// data unless BASE_REPLICA_DIR says otherwise.
+	if cfg.ReplicaDir == "" {
+		cfg.ReplicaDir = filepath.Join(app.DataDir(), "replicas")
+	}
+	net, err := network.New(cfg)
+	if err != nil {
+		return fmt.Errorf("network: %w", err)
+	}
 	if !net.Enabled() {
 		return nil
 	}
+	// A member catching up on a shard no other member can serve replays
+	// the archive. It needs the trusted segment keys a restore needs;
+	// without them the archive is left out and catch-up relies on members.
+	if !strings.EqualFold(cfg.Archive, "off") && len(cfg.ArchiveTrustedKeys) > 0 {
+		archive, err := network.OpenRestoreArchive(ctx, cfg.Archive, cfg.ArchiveTrustedKeys)
+		if err != nil {
+			app.Logger().Warn("network: the archive is not available to catch-up", "error", err)
+		} else {
+			network.SetArchive(net, archive)
+		}
+	}
 	if err := net.Start(ctx); err != nil {
 		return fmt.Errorf("network start: %w", err)
 	}
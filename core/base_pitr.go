@@ -0,0 +1,254 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/hanzoai/base/network"
+	"github.com/hanzoai/base/tools/security"
+	"github.com/hanzoai/base/tools/types"
+)
+
+// PITROptions describes a point-in-time restore of the data database from a
+// shard's network archive.
+type PITROptions struct {
+	// Archive is where the shard's frames are read from, with the trusted
+	// segment keys already configured (see [network.OpenRestoreArchive]).
+	Archive network.Archive
+
+	// Shard is the shard whose frames are replayed.
+	Shard string
+
+	// At is where the replay stops. The zero value is the end of the archive.
+	At network.RestorePoint
+
+	// DryRun replays and inspects the database and then discards it.
+	DryRun bool
+
+	// NoRestart swaps the database in without restarting the process, for a
+	// caller that is not serving it (the restore command, which exits after).
+	NoRestart bool
+}
+
+// PITRResult is what a point-in-time restore replayed and what the database it
+// produced holds.
+type PITRResult struct {
+	network.RestoreResult
+
+	// Tables is the number of rows in each table of the restored database.
+	Tables map[string]int64 `json:"tables"`
+
+	DryRun bool `json:"dryRun"`
+}
+
+// PITRRestoreName is the name a point-in-time restore of shard runs under, in
+// [StoreKeyActiveBackup] while it runs and in [StoreKeyRestoreFailure] if it
+// stops — the same two keys a backup restore reports through.
+func PITRRestoreName(shard string) string {
+	return "pitr:" + shard
+}
+
+// RestorePITR replays a shard's archived frames into a fresh database file and,
+// unless opts.DryRun, swaps it in for the data database and restarts the
+// process.
+//
+// The replay is checked twice before anything is replaced: the archive verifies
+// every segment's signature and refuses a replay with a missing seq (see
+// [network.Restore]), and the file it produces has to open and pass SQLite's
+// own integrity check. A dry run stops after both, reporting the seq reached
+// and the row counts, and leaves the data directory as it was.
+//
+// The swap is the one [BaseApp.RestoreBackup] makes, narrowed to the data
+// database: the current file and its write-ahead log move to a temp location
+// that is removed on the next start, the restored file takes their place, and
+// the process restarts. The auxiliary database and uploaded files are not part
+// of a shard and are left alone. If the restart fails, the move is reverted.
+func (app *BaseApp) RestorePITR(ctx context.Context, opts PITROptions) (*PITRResult, error) {
+	name := PITRRestoreName(opts.Shard)
+
+	if app.Store().Has(StoreKeyActiveBackup) {
+		return nil, errors.New("try again later - another backup/restore operation has already been started")
+	}
+
+	app.Store().Set(StoreKeyActiveBackup, name)
+	defer app.Store().Remove(StoreKeyActiveBackup)
+
+	result, err := app.restorePITR(ctx, opts)
+	if opts.DryRun {
+		return result, err
+	}
+
+	if err != nil {
+		app.Store().Set(StoreKeyRestoreFailure, RestoreFailure{
+			Time:  types.NowDateTime(),
+			Name:  name,
+			Error: err.Error(),
+		})
+	} else {
+		app.Store().Remove(StoreKeyRestoreFailure)
+	}
+
+	return result, err
+}
+
+func (app *BaseApp) restorePITR(ctx context.Context, opts PITROptions) (*PITRResult, error) {
+	if opts.Shard == "" {
+		return nil, errors.New("a point-in-time restore needs a shard")
+	}
+
+	if !opts.DryRun && runtime.GOOS == "windows" {
+		return nil, errors.New("restore is not supported on Windows")
+	}
+
+	if err := checkLocalDatabase(app.Dialect()); err != nil {
+		return nil, err
+	}
+
+	// note: it needs to be inside the current data to avoid "cross-device link" errors
+	localTempDir := filepath.Join(app.DataDir(), LocalTempDirName)
+	restoredDir := filepath.Join(localTempDir, "hz_pitr_"+security.PseudorandomString(8))
+	if err := os.MkdirAll(restoredDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create a temp dir: %w", err)
+	}
+	defer os.RemoveAll(restoredDir)
+
+	restoredDB := filepath.Join(restoredDir, dataFile)
+
+	replay, err := network.Restore(ctx, opts.Archive, opts.Shard, opts.At, restoredDB)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := app.inspectRestoredDB(restoredDB)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PITRResult{RestoreResult: *replay, Tables: tables, DryRun: opts.DryRun}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	oldTempDataDir := filepath.Join(localTempDir, "old_data_"+security.PseudorandomString(8))
+	if err := os.MkdirAll(oldTempDataDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create a temp dir: %w", err)
+	}
+
+	replaceErr := app.RunInTransaction(func(txApp App) error {
+		return txApp.AuxRunInTransaction(func(txApp App) error {
+			if err := moveDatabaseFiles(txApp.DataDir(), oldTempDataDir); err != nil {
+				return fmt.Errorf("failed to move the current database to a temp location: %w", err)
+			}
+
+			if err := moveDatabaseFiles(restoredDir, txApp.DataDir()); err != nil {
+				if revertErr := moveDatabaseFiles(oldTempDataDir, txApp.DataDir()); revertErr != nil {
+					panic(revertErr)
+				}
+				return fmt.Errorf("failed to move the restored database to the data dir: %w", err)
+			}
+
+			return nil
+		})
+	})
+	if replaceErr != nil {
+		return nil, replaceErr
+	}
+
+	if opts.NoRestart {
+		return result, nil
+	}
+
+	if err := app.Restart(); err != nil {
+		revertErr := app.RunInTransaction(func(txApp App) error {
+			return txApp.AuxRunInTransaction(func(txApp App) error {
+				if err := moveDatabaseFiles(txApp.DataDir(), restoredDir); err != nil {
+					return fmt.Errorf("failed to revert the restored database change: %w", err)
+				}
+
+				if err := moveDatabaseFiles(oldTempDataDir, txApp.DataDir()); err != nil {
+					return fmt.Errorf("failed to revert the old database change: %w", err)
+				}
+
+				return nil
+			})
+		})
+		if revertErr != nil {
+			panic(revertErr)
+		}
+
+		return nil, fmt.Errorf("failed to restart the app process: %w", err)
+	}
+
+	return result, nil
+}
+
+// inspectRestoredDB opens a restored database the way the app opens its own,
+// checks its integrity and counts the rows of each of its tables.
+//
+// An empty file, or one without a table, passes SQLite's integrity check but
+// is no Base database, and swapping it in would wipe the data it replaces; it
+// is what a replay of frames without pages leaves, so it is refused here as
+// well as in the replay.
+func (app *BaseApp) inspectRestoredDB(path string) (map[string]int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("the restored database does not open: %w", err)
+	}
+	if info.Size() == 0 {
+		return nil, errors.New("the restored database is empty")
+	}
+
+	db, err := app.config.DBConnect(path)
+	if err != nil {
+		return nil, fmt.Errorf("the restored database does not open: %w", err)
+	}
+	defer db.Close()
+
+	var check string
+	if err := db.NewQuery("PRAGMA quick_check").Row(&check); err != nil {
+		return nil, fmt.Errorf("the restored database does not open: %w", err)
+	}
+	if check != "ok" {
+		return nil, fmt.Errorf("the restored database failed its integrity check: %s", check)
+	}
+
+	var names []string
+	err = db.NewQuery("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Column(&names)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("the restored database has no tables")
+	}
+
+	tables := make(map[string]int64, len(names))
+	for _, name := range names {
+		var total int64
+		if err := db.Select("count(*)").From(name).Row(&total); err != nil {
+			return nil, fmt.Errorf("failed to count the rows of %q: %w", name, err)
+		}
+		tables[name] = total
+	}
+
+	return tables, nil
+}
+
+// moveDatabaseFiles moves the data database, with its write-ahead log and index
+// if there are any, from one directory to another. The log goes with the file
+// it belongs to: one left behind would be replayed into the other database.
+func moveDatabaseFiles(fromDir, toDir string) error {
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		from := filepath.Join(fromDir, dataFile+suffix)
+		if _, err := os.Stat(from); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(from, filepath.Join(toDir, dataFile+suffix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
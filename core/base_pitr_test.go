@@ -0,0 +1,194 @@
+package core_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"iter"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/network"
+	"github.com/hanzoai/base/tests"
+)
+
+// pitrArchive is an archive holding one frame: every page of a database file.
+type pitrArchive struct {
+	frame network.Frame
+}
+
+func (a *pitrArchive) Append(context.Context, string, uint64, []byte) error {
+	return errors.New("read only")
+}
+
+func (a *pitrArchive) Range(_ context.Context, shardID string, fromSeq, toSeq uint64) (iter.Seq2[network.Frame, error], error) {
+	return func(yield func(network.Frame, error) bool) {
+		if a.frame.ShardID == shardID && fromSeq <= 1 && toSeq >= 1 {
+			yield(a.frame, nil)
+		}
+	}, nil
+}
+
+func (a *pitrArchive) Close() error { return nil }
+
+// newPITRArchive archives the app's data database, as it is now, as the one
+// frame of shard "_".
+func newPITRArchive(t *testing.T, app *tests.TestApp) *pitrArchive {
+	t.Helper()
+
+	if _, err := app.DB().NewQuery("PRAGMA wal_checkpoint(TRUNCATE)").Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	return newPITRArchiveOf(t, filepath.Join(app.DataDir(), "data.db"))
+}
+
+// newPITRArchiveOf archives the database file at path as the one frame of
+// shard "_".
+func newPITRArchiveOf(t *testing.T, path string) *pitrArchive {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pageSize := uint32(binary.BigEndian.Uint16(data[16:]))
+	if pageSize == 1 {
+		pageSize = 65536
+	}
+	pages := uint32(len(data)) / pageSize
+
+	payload := binary.BigEndian.AppendUint32(nil, pageSize)
+	payload = binary.BigEndian.AppendUint32(payload, pages)
+	for pgno := uint32(1); pgno <= pages; pgno++ {
+		payload = binary.BigEndian.AppendUint32(payload, pgno)
+		payload = append(payload, data[(pgno-1)*pageSize:pgno*pageSize]...)
+	}
+
+	f := network.Frame{ShardID: "_", Seq: 1, Timestamp: 1, Payload: payload}
+
+	// the checksum Frame.Valid recomputes: shardID || seq || prev || salt || payload
+	h := sha256.New()
+	h.Write([]byte(f.ShardID))
+	h.Write(binary.BigEndian.AppendUint64(nil, f.Seq))
+	h.Write(binary.BigEndian.AppendUint64(nil, f.PrevSeq))
+	h.Write(f.Salt[:])
+	h.Write(f.Payload)
+	copy(f.Cksm[:], h.Sum(nil))
+
+	return &pitrArchive{frame: f}
+}
+
+func TestRestorePITRDryRun(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	archive := newPITRArchive(t, app)
+
+	users, err := app.CountRecords("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := os.Stat(filepath.Join(app.DataDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := app.RestorePITR(context.Background(), core.PITROptions{
+		Archive: archive,
+		Shard:   "_",
+		DryRun:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Seq != 1 || result.Frames != 1 || !result.DryRun {
+		t.Fatalf("Expected a dry run to seq 1, got %+v", result)
+	}
+
+	if result.Tables["users"] != users {
+		t.Fatalf("Expected %d users in the restored database, got %d", users, result.Tables["users"])
+	}
+
+	after, err := os.Stat(filepath.Join(app.DataDir(), "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Fatal("Expected a dry run to leave the data database in place")
+	}
+
+	if app.Store().Has(core.StoreKeyActiveBackup) {
+		t.Fatal("Expected the restore to release the backup lock")
+	}
+}
+
+func TestRestorePITRRecordsWhatStopped(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	// pending
+	app.Store().Set(core.StoreKeyActiveBackup, "")
+	if _, err := app.RestorePITR(context.Background(), core.PITROptions{Shard: "_", Archive: newPITRArchive(t, app)}); err == nil {
+		t.Fatal("Expected pending error, got nil")
+	}
+	app.Store().Remove(core.StoreKeyActiveBackup)
+
+	// a dry run reports its error rather than recording it
+	if _, err := app.RestorePITR(context.Background(), core.PITROptions{Shard: "other", Archive: newPITRArchive(t, app), DryRun: true}); err == nil {
+		t.Fatal("Expected an empty shard to fail")
+	}
+	if app.Store().Has(core.StoreKeyRestoreFailure) {
+		t.Fatal("Expected a dry run not to record a failure")
+	}
+
+	// a shard the archive holds nothing for
+	if _, err := app.RestorePITR(context.Background(), core.PITROptions{Shard: "other", Archive: newPITRArchive(t, app)}); err == nil {
+		t.Fatal("Expected an empty shard to fail")
+	}
+
+	failure, ok := app.Store().Get(core.StoreKeyRestoreFailure).(core.RestoreFailure)
+	if !ok || failure.Name != core.PITRRestoreName("other") || failure.Error == "" {
+		t.Fatalf("Expected the stopped restore to be recorded, got %+v", failure)
+	}
+}
+
+func TestRestorePITRRefusesADatabaseWithoutTables(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	// a valid SQLite file that holds nothing
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	db, err := core.DefaultDBConnect(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.NewQuery("PRAGMA user_version = 1").Execute(); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	users, err := app.CountRecords("users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = app.RestorePITR(context.Background(), core.PITROptions{
+		Archive:   newPITRArchiveOf(t, empty),
+		Shard:     "_",
+		NoRestart: true,
+	})
+	if err == nil {
+		t.Fatal("Expected a database without tables to be refused")
+	}
+
+	if total, err := app.CountRecords("users"); err != nil || total != users {
+		t.Fatalf("Expected the data database to be left in place, got %d users (%v)", total, err)
+	}
+}
@@ -380,6 +380,7 @@ type baseCollection struct {
 // Collection defines the table, fields and various options related to a set of records.
 type Collection struct {
 	baseCollection
+	collectionBaseOptions
 	collectionAuthOptions
 	collectionViewOptions
 }
@@ -507,6 +508,8 @@ func (m *Collection) unmarshalRawOptions() error {
 	}
 
 	switch m.Type {
+	case CollectionTypeBase:
+		return json.Unmarshal(raw, &m.collectionBaseOptions)
 	case CollectionTypeView:
 		return json.Unmarshal(raw, &m.collectionViewOptions)
 	case CollectionTypeAuth:
@@ -564,6 +567,11 @@ func (m *Collection) UnmarshalJSON(b []byte) error {
 // (ex. for "view" collections the "auth" fields are skipped).
 func (m Collection) MarshalJSON() ([]byte, error) {
 	switch m.Type {
+	case CollectionTypeBase:
+		return json.Marshal(struct {
+			baseCollection
+			collectionBaseOptions
+		}{m.baseCollection, m.collectionBaseOptions})
 	case CollectionTypeView:
 		return json.Marshal(struct {
 			baseCollection
@@ -621,6 +629,12 @@ func (m *Collection) DBExport(app App) (map[string]any, error) {
 	}
 
 	switch m.Type {
+	case CollectionTypeBase:
+		if raw, err := types.ParseJSONRaw(m.collectionBaseOptions); err == nil {
+			result["options"] = raw
+		} else {
+			return nil, err
+		}
 	case CollectionTypeView:
 		if raw, err := types.ParseJSONRaw(m.collectionViewOptions); err == nil {
 			result["options"] = raw
@@ -731,6 +745,18 @@ func onCollectionDeleteExecute(e *CollectionEvent) error {
 			if err := txApp.DeleteTable(e.Collection.Name); err != nil {
 				return err
 			}
+
+			if err := txApp.DeleteTable(fullTextTableName(e.Collection)); err != nil {
+				return err
+			}
+
+			if err := txApp.DeleteTable(recordHistoryTableName(e.Collection)); err != nil {
+				return err
+			}
+
+			if err := txApp.DeleteTable(recordDraftsTableName(e.Collection)); err != nil {
+				return err
+			}
 		}
 
 		if !e.Collection.disableIntegrityChecks {
@@ -746,6 +772,12 @@ func onCollectionDeleteExecute(e *CollectionEvent) error {
 
 	e.App = originalApp
 
+	if txErr == nil && !e.Collection.IsView() {
+		if err := dropVectorIndexes(e.App, e.Collection); err != nil {
+			e.App.Logger().Warn("Failed to delete the collection vector indexes", "collection", e.Collection.Name, "error", err.Error())
+		}
+	}
+
 	return txErr
 }
 
@@ -923,6 +955,12 @@ func (c *Collection) initDefaultFields() {
 	switch c.Type {
 	case CollectionTypeBase:
 		c.initIdField()
+		if c.SoftDelete {
+			c.initDeletedField()
+		}
+		if c.Drafts {
+			c.initPublishedField()
+		}
 	case CollectionTypeAuth:
 		c.initIdField()
 		c.initTokenKeyField()
@@ -963,6 +1001,46 @@ func (c *Collection) initIdField() {
 	}
 }
 
+func (c *Collection) initDeletedField() {
+	existing := c.Fields.GetByName(FieldNameDeleted)
+	if existing != nil && existing.Type() != FieldTypeDate {
+		return // kept for the validator to refuse rather than replaced
+	}
+
+	field, _ := existing.(*DateField)
+	if field == nil {
+		// load default field
+		c.Fields.Add(&DateField{
+			Name:   FieldNameDeleted,
+			System: true,
+		})
+	} else {
+		// enforce system defaults
+		field.System = true
+		field.Required = false
+	}
+}
+
+func (c *Collection) initPublishedField() {
+	existing := c.Fields.GetByName(FieldNamePublished)
+	if existing != nil && existing.Type() != FieldTypeDate {
+		return // kept for the validator to refuse rather than replaced
+	}
+
+	field, _ := existing.(*DateField)
+	if field == nil {
+		// load default field
+		c.Fields.Add(&DateField{
+			Name:   FieldNamePublished,
+			System: true,
+		})
+	} else {
+		// enforce system defaults
+		field.System = true
+		field.Required = false
+	}
+}
+
 func (c *Collection) initTokenKeyField() {
 	field, _ := c.Fields.GetByName(FieldNameTokenKey).(*TextField)
 	if field == nil {
@@ -1,11 +1,42 @@
 package core
 
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
 var _ optionsValidator = (*collectionBaseOptions)(nil)
 
 // collectionBaseOptions defines the options for the "base" type collection.
 type collectionBaseOptions struct {
+	// History keeps the previous version of a record on every update and
+	// delete, in a history table of the collection (see [RecordRevision]).
+	History bool `form:"history" json:"history"`
+
+	// SoftDelete turns the API deletes of the collection records into a
+	// tombstone in their "deleted" field, hiding them until they are
+	// restored or purged (see [TrashRecord]).
+	SoftDelete bool `form:"softDelete" json:"softDelete"`
+
+	// TrashRule lets the non-superusers it admits read (with ?trashed=only|with)
+	// and restore the trashed records of a SoftDelete collection.
+	//
+	// Set it to nil to leave the trash to the superusers.
+	TrashRule *string `form:"trashRule" json:"trashRule"`
+
+	// TrashRetention is how many days a trashed record is kept before it
+	// is purged ([DefaultTrashRetention] if zero).
+	TrashRetention int `form:"trashRetention" json:"trashRetention"`
+
+	// Drafts makes the API updates of the collection records write a draft
+	// that is published over the record with POST .../publish, leaving the
+	// record as the list and view rules see it until then, and keeps their
+	// history (see [PublishRecordDraft]).
+	Drafts bool `form:"drafts" json:"drafts"`
 }
 
 func (o *collectionBaseOptions) validate(cv *collectionValidator) error {
-	return nil
+	return validation.ValidateStruct(o,
+		validation.Field(&o.TrashRule, validation.By(cv.checkRule)),
+		validation.Field(&o.TrashRetention, validation.Min(0), validation.Max(maxTrashRetention)),
+	)
 }
@@ -42,7 +42,19 @@ func (app *BaseApp) SyncRecordTableSchema(newCollection *Collection, oldCollecti
 				return err
 			}
 
-			return createCollectionIndexes(txApp, newCollection)
+			if err := createCollectionIndexes(txApp, newCollection); err != nil {
+				return err
+			}
+
+			if err := syncFullTextTable(txApp, newCollection, oldCollection); err != nil {
+				return err
+			}
+
+			if err := syncRecordHistoryTable(txApp, newCollection); err != nil {
+				return err
+			}
+
+			return syncRecordDraftsTable(txApp, newCollection)
 		}
 
 		// update
@@ -132,10 +144,20 @@ func (app *BaseApp) SyncRecordTableSchema(newCollection *Collection, oldCollecti
 		}
 
 		if needIndexesUpdate {
-			return createCollectionIndexes(txApp, newCollection)
+			if err := createCollectionIndexes(txApp, newCollection); err != nil {
+				return err
+			}
 		}
 
-		return nil
+		if err := syncFullTextTable(txApp, newCollection, oldCollection); err != nil {
+			return err
+		}
+
+		if err := syncRecordHistoryTable(txApp, newCollection); err != nil {
+			return err
+		}
+
+		return syncRecordDraftsTable(txApp, newCollection)
 	})
 	if txErr != nil {
 		return txErr
@@ -374,6 +374,23 @@ func (cv *collectionValidator) checkMinFields(value any) error {
 		}
 
 		return nil
+	case CollectionTypeBase:
+		if cv.new.SoftDelete {
+			if field, _ := fields.GetByName(FieldNameDeleted).(*DateField); field == nil {
+				return validation.Errors{FieldNameDeleted: validation.NewError(
+					"validation_invalid_deleted_field",
+					`A collection with soft delete keeps the trash in a "deleted" date field; rename the field named "deleted".`,
+				)}
+			}
+		}
+		if cv.new.Drafts {
+			if field, _ := fields.GetByName(FieldNamePublished).(*DateField); field == nil {
+				return validation.Errors{FieldNamePublished: validation.NewError(
+					"validation_invalid_published_field",
+					`A collection with drafts keeps the publish date in a "published" date field; rename the field named "published".`,
+				)}
+			}
+		}
 	}
 
 	return nil
@@ -645,6 +662,8 @@ func (cv *collectionValidator) checkIndexes(value any) error {
 
 func (validator *collectionValidator) validateOptions() error {
 	switch validator.new.Type {
+	case CollectionTypeBase:
+		return validator.new.collectionBaseOptions.validate(validator)
 	case CollectionTypeAuth:
 		return validator.new.collectionAuthOptions.validate(validator)
 	case CollectionTypeView:
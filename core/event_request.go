@@ -188,6 +188,11 @@ const (
 	RequestInfoContextOAuth2        = "oauth2"
 	RequestInfoContextOTP           = "otp"
 	RequestInfoContextPasswordAuth  = "password"
+
+	// RequestInfoContextFunctionTrigger is the context of the reads of a
+	// function run by its trigger rather than by a request. It has no auth,
+	// so a rule admits it by the context alone.
+	RequestInfoContextFunctionTrigger = "functionTrigger"
 )
 
 // RequestInfo defines a HTTP request data struct, usually used
@@ -16,18 +16,31 @@ import (
 
 // NATSPublisher publishes record lifecycle events to NATS JetStream.
 // Opt-in: only active when NATS_URL env var is set.
+//
+// It is a [ChangeSink]: the events of the application's records are the
+// committed changes of the outbox, published by the relay, so one that fails
+// to publish is published again rather than lost. Consumers deduplicate on the
+// seq. The writes the outbox does not record, of the system collections and
+// of the other models, are still published from the model hooks, as before
+// the outbox, and with no such promise (see registerNATSModelHooks).
 type NATSPublisher struct {
 	url  string
 	mu   sync.Mutex
 	conn *nats.Conn
 }
 
-// RecordEvent is the JSON payload published to NATS.
+// RecordLifecycleEvent is the JSON payload published to NATS.
+//
+// Seq, Before and After are set for the events of the change outbox; Before
+// and After are the record's fields before and after the change.
 type RecordLifecycleEvent struct {
-	Collection string `json:"collection"`
-	Action     string `json:"action"`
-	RecordID   string `json:"record_id"`
-	Timestamp  int64  `json:"timestamp"`
+	Collection string          `json:"collection"`
+	Action     string          `json:"action"`
+	RecordID   string          `json:"record_id"`
+	Timestamp  int64           `json:"timestamp"`
+	Seq        int64           `json:"seq,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
 }
 
 // newNATSPublisher returns a publisher if NATS_URL is set, nil otherwise.
@@ -84,28 +97,56 @@ func (p *NATSPublisher) Publish(_ context.Context, collection, action, recordID
 	return conn.Publish(subject, data)
 }
 
-// Close drains and closes the NATS connection.
-func (p *NATSPublisher) Close() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// Name implements [ChangeSink.Name].
+func (p *NATSPublisher) Name() string {
+	return "nats"
+}
 
-	if p.conn != nil {
-		p.conn.Close()
-		p.conn = nil
+// Deliver implements [ChangeSink.Deliver], publishing each change on
+// base.{collection}.{action}.
+func (p *NATSPublisher) Deliver(_ context.Context, changes []*RecordChange) error {
+	conn, err := p.connect()
+	if err != nil {
+		return err
 	}
-}
 
-// registerNATSHooks wires the NATS publisher into model lifecycle hooks.
-// Does nothing if NATS_URL is not set.
-func registerNATSHooks(app *BaseApp) {
-	pub := newNATSPublisher()
-	if pub == nil {
-		return
+	for _, change := range changes {
+		data, err := json.Marshal(RecordLifecycleEvent{
+			Collection: change.CollectionName,
+			Action:     change.Action,
+			RecordID:   change.RecordId,
+			Timestamp:  change.Created.Time().UnixMilli(),
+			Seq:        change.Seq,
+			Before:     json.RawMessage(change.Before),
+			After:      json.RawMessage(change.After),
+		})
+		if err != nil {
+			return fmt.Errorf("marshal event: %w", err)
+		}
+
+		subject := fmt.Sprintf("base.%s.%s", change.CollectionName, change.Action)
+		if err := conn.Publish(subject, data); err != nil {
+			return err
+		}
 	}
 
-	app.Logger().Info("NATS event publisher enabled", "url", pub.url)
+	// a publish only queues the message; the flush is what says it was sent
+	return conn.Flush()
+}
 
+// registerNATSModelHooks publishes, from the model hooks, the writes the
+// outbox does not record: those of the system collections and of the models
+// that are not records, such as the collections themselves. They go out on
+// base.{table}.{action} as they always did, best effort and without a seq; a
+// publish that fails is logged and lost.
+func registerNATSModelHooks(app *BaseApp, pub *NATSPublisher) {
 	publishEvent := func(e *ModelEvent, action string) {
+		if re, ok := newRecordEventFromModelEvent(e); ok {
+			if collection := re.Record.Collection(); !collection.System && !collection.IsView() {
+				return // relayed from the outbox
+			}
+		}
+
 		table := e.Model.TableName()
 		id := fmt.Sprintf("%v", e.Model.PK())
 		if err := pub.Publish(e.Context, table, action, id); err != nil {
@@ -117,22 +158,28 @@ func registerNATSHooks(app *BaseApp) {
 	}
 
 	app.OnModelAfterCreateSuccess().BindFunc(func(e *ModelEvent) error {
-		publishEvent(e, "create")
+		publishEvent(e, RecordChangeCreate)
 		return e.Next()
 	})
 
 	app.OnModelAfterUpdateSuccess().BindFunc(func(e *ModelEvent) error {
-		publishEvent(e, "update")
+		publishEvent(e, RecordChangeUpdate)
 		return e.Next()
 	})
 
 	app.OnModelAfterDeleteSuccess().BindFunc(func(e *ModelEvent) error {
-		publishEvent(e, "delete")
+		publishEvent(e, RecordChangeDelete)
 		return e.Next()
 	})
+}
 
-	app.OnTerminate().BindFunc(func(e *TerminateEvent) error {
-		pub.Close()
-		return e.Next()
-	})
+// Close drains and closes the NATS connection.
+func (p *NATSPublisher) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
 }
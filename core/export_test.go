@@ -1,6 +1,46 @@
 package core
 
+import (
+	"context"
+	"time"
+)
+
 // NotifyDebounce lets the external test package assert against the same window
 // the watcher actually uses, instead of restating 50ms and drifting from it.
 // This file is a _test.go, so it widens no public API.
 const NotifyDebounce = notifyDebounce
+
+// BuildVectorIndex builds the index of a vector field right away, so that the
+// tests don't need a collection large enough for it to be built in the background.
+func BuildVectorIndex(app App, collection *Collection, field *VectorField) error {
+	state := vectorIndexStateOf(app, collection, field)
+	if !state.startBuilding() {
+		return nil
+	}
+	return state.build(context.Background(), app, collection, field)
+}
+
+// BuildVectorIndexInBackground starts building the index of a vector field
+// the way a search past the index threshold does.
+func BuildVectorIndexInBackground(app App, collection *Collection, field *VectorField) {
+	vectorIndexStateOf(app, collection, field).buildInBackground(app, collection, field)
+}
+
+// IsVectorIndexBuilding reports whether the index of a vector field is being built.
+func IsVectorIndexBuilding(app App, collection *Collection, field *VectorField) bool {
+	state := vectorIndexStateOf(app, collection, field)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	return state.building
+}
+
+// NewCronLastRuns returns the store the app's local cron schedules keep their
+// last runs in, as a fresh app would read it.
+func NewCronLastRuns(app App) interface {
+	Load(name string) time.Time
+	Save(name string, t time.Time)
+} {
+	return newCronLastRuns(app)
+}
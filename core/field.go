@@ -26,6 +26,9 @@ const (
 	FieldNameVerified        = "verified"
 	FieldNameTokenKey        = "tokenKey"
 	FieldNameSource          = "source"
+	FieldNameDeleted         = "deleted"
+	FieldNamePublished       = "published"
+	FieldNameTriggers        = "triggers"
 )
 
 // SystemFields returns special internal field names that are usually readonly.
@@ -166,6 +169,13 @@ type MultiValuer interface {
 	IsMultiple() bool
 }
 
+// FullTextSearcher defines a field interface for the fields whose value
+// could be indexed for full-text search (see the fts() filter function).
+type FullTextSearcher interface {
+	// IsSearchable checks whether the field value is indexed for full-text search.
+	IsSearchable() bool
+}
+
 // RecordInterceptor defines a field interface for reacting to various
 // Record related operations (create, delete, validate, etc.).
 type RecordInterceptor interface {
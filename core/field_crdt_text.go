@@ -0,0 +1,611 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hanzoai/base/core/validators"
+	"github.com/hanzoai/base/crdt"
+	"github.com/hanzoai/base/tools/security"
+	"github.com/hanzoai/dbx"
+	"github.com/hanzoai/orm/dialect"
+	"github.com/spf13/cast"
+)
+
+func init() {
+	Fields[FieldTypeCrdtText] = func() Field {
+		return &CrdtTextField{}
+	}
+}
+
+const FieldTypeCrdtText = "crdtText"
+
+// crdtTextNodeID is the node a Base merges field documents as. Merging authors
+// no ops, so it only has to be stable.
+//
+// The one write the Base does author, replacing the text with a plain string,
+// is made as a node of its own per write (see [CrdtTextField.replaceText]).
+const crdtTextNodeID = "base"
+
+// crdtTextKey is the text inside a field's document. A field is one text, so the
+// document holds one.
+const crdtTextKey = "text"
+
+// crdtTextPrevVersionPrefix keeps, for the length of one save, what the Base had
+// stored before that save merged into it.
+const crdtTextPrevVersionPrefix = internalCustomFieldKeyPrefix + "_crdtTextPrevVersion_"
+
+// crdtTextLocksStoreKey is the app store key of the Base's [crdtTextLocks].
+const crdtTextLocksStoreKey = "@crdtTextLocks"
+
+var (
+	_ Field             = (*CrdtTextField)(nil)
+	_ DriverValuer      = (*CrdtTextField)(nil)
+	_ RecordInterceptor = (*CrdtTextField)(nil)
+)
+
+// CrdtTextField defines "crdtText" type field for storing collaborative text
+// as a [crdt.Document], so that concurrent writes merge instead of the last one
+// winning.
+//
+// The column holds the encoded document. Reads render the merged plain text, so
+// a client that knows nothing about CRDTs reads the field as a string.
+//
+// Writes never replace the value, they merge into it:
+//   - an object `{"envelopes": [...]}` carries sealed ops (the output of
+//     [crdt.Document.SealOps] over [crdt.Document.Diff]) for the document named
+//     by [CrdtTextDocumentId];
+//   - a string is a whole document as encoded by [crdt.Document.Encode] and
+//     base64 encoded, which is also what the column stores;
+//   - any other string is the new text, applied as the ops that turn the
+//     current text into it, so a client that knows nothing about CRDTs can
+//     still write the field;
+//   - a [*CrdtText] is merged as it is;
+//   - a [CrdtTextInput] is a write from a request: sealed ops or the new text,
+//     and never a whole document.
+//
+// A document is only ever merged into, so text removed by one client is removed
+// by an op, never by writing a shorter value. The column is an encoding rather
+// than text, so the field is not meaningful to filter or sort on.
+//
+// Examples of updating a record's CrdtTextField value programmatically:
+//
+//	record.Set("body", map[string]any{"envelopes": envs})
+//	record.Set("body", base64.StdEncoding.EncodeToString(encoded))
+//	record.Set("body", "the new text")
+type CrdtTextField struct {
+	// Name (required) is the unique name of the field.
+	Name string `form:"name" json:"name"`
+
+	// Id is the unique stable field identifier.
+	//
+	// It is automatically generated from the name when adding to a collection FieldsList.
+	Id string `form:"id" json:"id"`
+
+	// System prevents the renaming and removal of the field.
+	System bool `form:"system" json:"system"`
+
+	// Hidden hides the field from the API response.
+	Hidden bool `form:"hidden" json:"hidden"`
+
+	// Presentable hints the Dashboard UI to use the underlying
+	// field record value in the relation preview label.
+	Presentable bool `form:"presentable" json:"presentable"`
+
+	// ---
+
+	// Max specifies the maximum allowed characters of the merged text.
+	//
+	// If zero, no limit is applied beyond the request body limit.
+	Max int `form:"max" json:"max"`
+
+	// Required will require the merged text to be non-empty.
+	Required bool `form:"required" json:"required"`
+}
+
+// CrdtTextDocumentId returns the id of the document a record's crdtText field
+// holds, which is the id sealed ops for it have to be bound to.
+//
+// It names the record as well as the field, so an op sealed for one record does
+// not open on another.
+func CrdtTextDocumentId(collectionName string, recordId string, fieldName string) string {
+	return collectionName + ":" + recordId + "/" + fieldName
+}
+
+// Type implements [Field.Type] interface method.
+func (f *CrdtTextField) Type() string {
+	return FieldTypeCrdtText
+}
+
+// GetId implements [Field.GetId] interface method.
+func (f *CrdtTextField) GetId() string {
+	return f.Id
+}
+
+// SetId implements [Field.SetId] interface method.
+func (f *CrdtTextField) SetId(id string) {
+	f.Id = id
+}
+
+// GetName implements [Field.GetName] interface method.
+func (f *CrdtTextField) GetName() string {
+	return f.Name
+}
+
+// SetName implements [Field.SetName] interface method.
+func (f *CrdtTextField) SetName(name string) {
+	f.Name = name
+}
+
+// GetSystem implements [Field.GetSystem] interface method.
+func (f *CrdtTextField) GetSystem() bool {
+	return f.System
+}
+
+// SetSystem implements [Field.SetSystem] interface method.
+func (f *CrdtTextField) SetSystem(system bool) {
+	f.System = system
+}
+
+// GetHidden implements [Field.GetHidden] interface method.
+func (f *CrdtTextField) GetHidden() bool {
+	return f.Hidden
+}
+
+// SetHidden implements [Field.SetHidden] interface method.
+func (f *CrdtTextField) SetHidden(hidden bool) {
+	f.Hidden = hidden
+}
+
+// ColumnType implements [Field.ColumnType] interface method.
+func (f *CrdtTextField) ColumnType(app App) string {
+	return "TEXT DEFAULT '' NOT NULL"
+}
+
+// PrepareValue implements [Field.PrepareValue] interface method.
+//
+// The result is always a new [*CrdtText]: the current value merged with raw.
+// Values are never changed in place, because a record's original and its
+// clones share them.
+func (f *CrdtTextField) PrepareValue(record *Record, raw any) (any, error) {
+	current, _ := record.GetRaw(f.Name).(*CrdtText)
+
+	switch v := raw.(type) {
+	case nil:
+		return current.merge(nil), nil
+	case *CrdtText:
+		return current.merge(v), nil
+	case CrdtText:
+		return current.merge(&v), nil
+	case map[string]any:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return raw, err
+		}
+		return f.applyDelta(record, current, encoded)
+	case CrdtTextInput:
+		return f.prepareString(record, current, string(v), false)
+	case []byte:
+		return f.prepareString(record, current, string(v), true)
+	default:
+		return f.prepareString(record, current, cast.ToString(v), true)
+	}
+}
+
+// prepareString merges a string into current. Only a trusted write may carry a
+// whole document; for any other the string is the new text.
+func (f *CrdtTextField) prepareString(record *Record, current *CrdtText, str string, trusted bool) (any, error) {
+	trimmed := strings.TrimSpace(str)
+
+	switch {
+	case trimmed == "":
+		return current.merge(nil), nil
+	case trimmed[0] == '{':
+		// a delta sent as a multipart/form-data value
+		return f.applyDelta(record, current, []byte(trimmed))
+	}
+
+	// An encoded document is gob behind base64, which no text a person typed
+	// decodes as; whatever does not is the text itself.
+	if data, err := base64.StdEncoding.DecodeString(trimmed); err == nil {
+		if doc, err := crdt.Decode(data, crdtTextNodeID); err == nil {
+			if !trusted {
+				return str, errors.New("a whole crdt document can only be written by the Base itself")
+			}
+			return current.merge(&CrdtText{doc: doc}), nil
+		}
+	}
+
+	return f.replaceText(record, current, str), nil
+}
+
+// replaceText returns current with its text changed to text.
+//
+// A record that is being created has no id yet, so its document is named when
+// it is saved (see [CrdtTextField.Intercept]).
+//
+// Only the span between what the two have in common at either end is deleted
+// and inserted, so a concurrent write to the rest of the text still merges.
+//
+// The ops are authored as a node of this write alone. Two writes replacing the
+// same stored text as one shared node would number their characters the same,
+// and a merge would keep only one of each pair.
+func (f *CrdtTextField) replaceText(record *Record, current *CrdtText, text string) *CrdtText {
+	var docId string
+	if current != nil && current.doc != nil {
+		docId = current.doc.ID()
+	}
+
+	next := crdt.NewDocument(docId, crdtTextNodeID+"-"+security.PseudorandomString(10))
+	if current != nil && current.doc != nil {
+		next.Merge(current.doc)
+	}
+
+	rga := next.GetText(crdtTextKey)
+
+	from := []rune(rga.ToString())
+	to := []rune(text)
+
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	for range len(from) - prefix - suffix {
+		// the span is in range, so the delete cannot fail
+		_, _ = rga.Delete(prefix)
+	}
+
+	// rune by rune rather than InsertText, which positions by byte offset
+	for i, ch := range to[prefix : len(to)-suffix] {
+		rga.Insert(prefix-1+i, ch)
+	}
+
+	return &CrdtText{doc: next}
+}
+
+// applyDelta opens sealed ops against the record's document and merges them in.
+//
+// The envelopes are bound to the record, so they can only be opened once the
+// record has an id: a delta is a write to a document that exists.
+func (f *CrdtTextField) applyDelta(record *Record, current *CrdtText, raw []byte) (any, error) {
+	var delta struct {
+		Envelopes []crdt.OpEnvelope `json:"envelopes"`
+	}
+	if err := json.Unmarshal(raw, &delta); err != nil {
+		return raw, err
+	}
+
+	if record.Id == "" {
+		return raw, errors.New("crdt ops can only be applied to an existing record")
+	}
+
+	docId := CrdtTextDocumentId(record.Collection().Name, record.Id, f.Name)
+
+	next := crdt.NewDocument(docId, crdtTextNodeID)
+	if current != nil && current.doc != nil {
+		next.Merge(current.doc)
+	}
+
+	if len(delta.Envelopes) == 0 {
+		return &CrdtText{doc: next}, nil
+	}
+
+	msg, err := json.Marshal(crdt.SyncMessage{Type: crdt.SyncUpdate, DocID: docId, Envelopes: delta.Envelopes})
+	if err != nil {
+		return raw, err
+	}
+
+	// A manager of its own with nobody to broadcast to: the only listener of a
+	// record write is the realtime broadcast that follows the save.
+	sm := crdt.NewSyncManager(nil)
+	sm.RegisterDocument(docId, next)
+	if _, err := sm.HandleSync("", msg); err != nil {
+		return raw, err
+	}
+
+	return &CrdtText{doc: next}, nil
+}
+
+// ValidateValue implements [Field.ValidateValue] interface method.
+func (f *CrdtTextField) ValidateValue(ctx context.Context, app App, record *Record) error {
+	val, ok := record.GetRaw(f.Name).(*CrdtText)
+	if !ok {
+		return validators.ErrUnsupportedValueType
+	}
+
+	text := val.String()
+
+	if f.Required && text == "" {
+		return validation.ErrRequired
+	}
+
+	if f.Max > 0 && len([]rune(text)) > f.Max {
+		return validation.NewError("validation_max_text_constraint", "Must be less than {{.max}} character(s).").
+			SetParams(map[string]any{"max": f.Max})
+	}
+
+	return nil
+}
+
+// ValidateSettings implements [Field.ValidateSettings] interface method.
+func (f *CrdtTextField) ValidateSettings(ctx context.Context, app App, collection *Collection) error {
+	return validation.ValidateStruct(f,
+		validation.Field(&f.Id, validation.By(DefaultFieldIdValidationRule)),
+		validation.Field(&f.Name, validation.By(DefaultFieldNameValidationRule)),
+		validation.Field(&f.Max, validation.Min(0)),
+	)
+}
+
+// DriverValue implements the [DriverValuer] interface.
+func (f *CrdtTextField) DriverValue(record *Record) (driver.Value, error) {
+	val, ok := record.GetRaw(f.Name).(*CrdtText)
+	if !ok || val.doc == nil {
+		return "", nil
+	}
+
+	data, err := val.doc.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// Intercept implements the [RecordInterceptor] interface.
+//
+// This is where concurrent writes stop clobbering each other. Two requests that
+// read the same row each merged into what they read, so whichever saves second
+// would otherwise write back a document without the first one's ops in it.
+// Right before the write the row is read again and merged in, so what is written
+// is always a superset of what is stored.
+//
+// That only holds if no other write lands between the read and the write, so
+// the two are made one step. A transaction already is one on SQLite, which lets
+// it write alone from its first write to its commit, and is made one on Postgres
+// by reading the row FOR UPDATE. A save outside of a transaction holds a lock of
+// the record's field from the read to the write, which keeps out the other saves
+// of this Base. Writers of a Postgres database from several processes must save
+// a crdtText field in a transaction.
+func (f *CrdtTextField) Intercept(
+	ctx context.Context,
+	app App,
+	record *Record,
+	actionName string,
+	actionFunc func() error,
+) error {
+	switch actionName {
+	case InterceptorActionCreateExecute, InterceptorActionUpdateExecute:
+		value, _ := record.GetRaw(f.Name).(*CrdtText)
+
+		prev := crdt.StateVersion{}
+
+		if !record.IsNew() {
+			if !app.IsTransactional() {
+				unlock := crdtTextLocksOf(app).lock(record.Collection().Id + "/" + cast.ToString(record.LastSavedPK()) + "/" + f.Id)
+				defer unlock()
+			}
+
+			stored, err := f.readStored(ctx, app, record)
+			if err != nil {
+				return fmt.Errorf("failed to read the stored %q document: %w", f.Name, err)
+			}
+			if stored != nil {
+				prev = stored.doc.Version()
+				value = stored.merge(value)
+				record.SetRaw(f.Name, value)
+			}
+		}
+
+		// The document is bound to its record by its id, which a record being
+		// created did not have when its value was prepared.
+		docId := CrdtTextDocumentId(record.Collection().Name, record.Id, f.Name)
+		if value != nil && value.doc != nil && value.doc.ID() != docId {
+			value = value.bind(docId)
+			record.SetRaw(f.Name, value)
+		}
+
+		record.SetRaw(crdtTextPrevVersionPrefix+f.Name, prev)
+
+		return actionFunc()
+	case InterceptorActionAfterCreate, InterceptorActionAfterUpdate,
+		InterceptorActionAfterCreateError, InterceptorActionAfterUpdateError:
+		err := actionFunc()
+		record.SetRaw(crdtTextPrevVersionPrefix+f.Name, nil)
+		return err
+	default:
+		return actionFunc()
+	}
+}
+
+// readStored reads the field's document as the row stores it now, or nil if it
+// has none.
+//
+// It reads through the database the write goes to, so it waits for a write in
+// progress rather than reading around it.
+func (f *CrdtTextField) readStored(ctx context.Context, app App, record *Record) (*CrdtText, error) {
+	sql := "SELECT [[" + f.Name + "]] FROM {{" + record.Collection().Name + "}} WHERE [[id]] = {:id}"
+	if _, ok := app.Dialect().(dialect.Postgres); ok && app.IsTransactional() {
+		sql += " FOR UPDATE"
+	}
+
+	var encoded string
+	err := app.NonconcurrentDB().NewQuery(sql).
+		Bind(dbx.Params{"id": record.LastSavedPK()}).
+		WithContext(ctx).
+		Row(&encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded == "" {
+		return nil, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := crdt.Decode(data, crdtTextNodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CrdtText{doc: doc}, nil
+}
+
+// Delta returns the ops the last save of record added to the field's document
+// — what a client that had the stored document before that save is missing.
+//
+// It is only meaningful from the save's own hooks, up to and including its
+// after-success ones; outside them it returns nil.
+func (f *CrdtTextField) Delta(record *Record) []crdt.Operation {
+	prev, ok := record.GetRaw(crdtTextPrevVersionPrefix + f.Name).(crdt.StateVersion)
+	if !ok {
+		return nil
+	}
+
+	value, ok := record.GetRaw(f.Name).(*CrdtText)
+	if !ok || value.doc == nil {
+		return nil
+	}
+
+	return value.doc.Diff(prev)
+}
+
+// -------------------------------------------------------------------
+
+// CrdtTextInput is a write to a [CrdtTextField] from outside the Base, such as
+// a request body: the new text, or sealed ops as a JSON object.
+//
+// It is never a whole document. A document is bound to no record and merges as
+// it is, so accepting one from a client would let it write ops that were never
+// sealed for the record, under any node it likes.
+type CrdtTextInput string
+
+// -------------------------------------------------------------------
+
+// CrdtText is the value of a [CrdtTextField]: a collaborative document that
+// renders as its merged text.
+//
+// A CrdtText is never changed after it is built; merging one into another
+// builds a third.
+type CrdtText struct {
+	doc *crdt.Document
+}
+
+// String returns the merged text.
+func (t *CrdtText) String() string {
+	if t == nil || t.doc == nil {
+		return ""
+	}
+	return t.doc.GetText(crdtTextKey).ToString()
+}
+
+// Document returns the underlying document. It is for reading — diffing and
+// sealing ops — and must not be written to.
+func (t *CrdtText) Document() *crdt.Document {
+	if t == nil {
+		return nil
+	}
+	return t.doc
+}
+
+// MarshalJSON implements the [json.Marshaler] interface, rendering the text
+// rather than the document.
+func (t *CrdtText) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.String())
+}
+
+// bind returns a new value holding t under the document id docId.
+func (t *CrdtText) bind(docId string) *CrdtText {
+	next := crdt.NewDocument(docId, crdtTextNodeID)
+	if t != nil && t.doc != nil {
+		next.Merge(t.doc)
+	}
+
+	return &CrdtText{doc: next}
+}
+
+// merge returns a new value holding both t and other.
+func (t *CrdtText) merge(other *CrdtText) *CrdtText {
+	var id string
+	switch {
+	case t != nil && t.doc != nil:
+		id = t.doc.ID()
+	case other != nil && other.doc != nil:
+		id = other.doc.ID()
+	}
+
+	next := crdt.NewDocument(id, crdtTextNodeID)
+	if t != nil && t.doc != nil {
+		next.Merge(t.doc)
+	}
+	if other != nil && other.doc != nil {
+		next.Merge(other.doc)
+	}
+
+	return &CrdtText{doc: next}
+}
+
+// -------------------------------------------------------------------
+
+// crdtTextLocks are the locks a save outside of a transaction holds from reading
+// a field's stored document to writing it, one per record field.
+type crdtTextLocks struct {
+	mu   sync.Mutex
+	held map[string]*crdtTextLock
+}
+
+type crdtTextLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+func crdtTextLocksOf(app App) *crdtTextLocks {
+	locks, _ := app.Store().GetOrSet(crdtTextLocksStoreKey, func() any {
+		return &crdtTextLocks{held: map[string]*crdtTextLock{}}
+	}).(*crdtTextLocks)
+
+	return locks
+}
+
+// lock locks key and returns its unlock. A key is forgotten once nobody holds
+// or waits for it, so the locks grow with the saves in progress only.
+func (l *crdtTextLocks) lock(key string) func() {
+	l.mu.Lock()
+	entry := l.held[key]
+	if entry == nil {
+		entry = &crdtTextLock{}
+		l.held[key] = entry
+	}
+	entry.waiters++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+
+	return func() {
+		entry.mu.Unlock()
+
+		l.mu.Lock()
+		entry.waiters--
+		if entry.waiters == 0 {
+			delete(l.held, key)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,251 @@
+package core_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/crdt"
+	"github.com/hanzoai/base/tests"
+)
+
+func TestCrdtTextFieldBaseMethods(t *testing.T) {
+	testFieldBaseMethods(t, core.FieldTypeCrdtText)
+}
+
+func TestCrdtTextFieldColumnType(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	f := &core.CrdtTextField{}
+
+	expected := "TEXT DEFAULT '' NOT NULL"
+
+	if v := f.ColumnType(app); v != expected {
+		t.Fatalf("Expected\n%q\ngot\n%q", expected, v)
+	}
+}
+
+// crdtTextDelta is what a client holding its own copy of the document sends
+// after typing text at the start of it.
+func crdtTextDelta(t *testing.T, docId string, node string, text string) map[string]any {
+	t.Helper()
+
+	local := crdt.NewDocument(docId, node)
+	local.GetText("text").InsertText(0, text)
+
+	envs, err := local.SealOps(local.Diff(crdt.StateVersion{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]any{"envelopes": envs}
+}
+
+func TestCrdtTextFieldPrepareValue(t *testing.T) {
+	collection := core.NewBaseCollection("test")
+	f := &core.CrdtTextField{Name: "body"}
+	collection.Fields.Add(f)
+
+	record := core.NewRecord(collection)
+	record.Id = "abc"
+
+	docId := core.CrdtTextDocumentId("test", "abc", "body")
+
+	// two clients, neither of which has seen the other's write
+	record.Set("body", crdtTextDelta(t, docId, "a", "left"))
+	record.Set("body", crdtTextDelta(t, docId, "b", "right"))
+
+	text := record.GetRaw("body").(*core.CrdtText).String()
+	if len(text) != len("leftright") {
+		t.Fatalf("Expected both writes merged, got %q", text)
+	}
+
+	// the stored form loads back to the same text
+	stored, err := f.DriverValue(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := core.NewRecord(collection)
+	v, err := f.PrepareValue(loaded, stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := v.(*core.CrdtText).String(); got != text {
+		t.Fatalf("Expected %q after a round trip, got %q", text, got)
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected, _ := json.Marshal(text); string(raw) != string(expected) {
+		t.Fatalf("Expected reads to render %s, got %s", expected, raw)
+	}
+
+	// a plain string is the new text, merged as the ops that make it so
+	for _, text := range []string{"hello world", "hello there", "héllo ✓ there", "✓"} {
+		record.Set("body", text)
+		if got := record.GetRaw("body").(*core.CrdtText).String(); got != text {
+			t.Fatalf("Expected a plain string to replace the text with %q, got %q", text, got)
+		}
+	}
+
+	// a request writes the text or ops, never a whole document
+	if _, err := f.PrepareValue(record, core.CrdtTextInput(stored.(string))); err == nil {
+		t.Fatal("Expected a whole document from a request to be refused")
+	}
+	if v, err := f.PrepareValue(record, core.CrdtTextInput("typed")); err != nil || v.(*core.CrdtText).String() != "typed" {
+		t.Fatalf("Expected plain text from a request to replace the text, got %v", err)
+	}
+
+	// envelopes sealed for another record do not open on this one
+	if _, err := f.PrepareValue(record, crdtTextDelta(t, core.CrdtTextDocumentId("test", "other", "body"), "c", "x")); err == nil {
+		t.Fatal("Expected an envelope bound to another record to be refused")
+	}
+
+	// a delta is a write to a document that exists
+	if _, err := f.PrepareValue(core.NewRecord(collection), crdtTextDelta(t, docId, "c", "x")); err == nil {
+		t.Fatal("Expected a delta to a record without an id to be refused")
+	}
+}
+
+func TestCrdtTextFieldValidateValue(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("test_collection")
+
+	record := core.NewRecord(collection)
+	record.SetRaw("test", 123)
+	if err := (&core.CrdtTextField{Name: "test"}).ValidateValue(context.Background(), app, record); err == nil {
+		t.Fatal("Expected an invalid raw value to fail")
+	}
+
+	f := &core.CrdtTextField{Name: "test", Required: true, Max: 3}
+
+	empty, _ := f.PrepareValue(core.NewRecord(collection), nil)
+	record.SetRaw("test", empty)
+	if err := f.ValidateValue(context.Background(), app, record); err == nil {
+		t.Fatal("Expected an empty required value to fail")
+	}
+
+	doc := crdt.NewDocument("x", "a")
+	doc.GetText("text").InsertText(0, "toolong")
+	encoded, err := doc.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, _ := f.PrepareValue(core.NewRecord(collection), base64.StdEncoding.EncodeToString(encoded))
+	record.SetRaw("test", long)
+	if err := f.ValidateValue(context.Background(), app, record); err == nil {
+		t.Fatal("Expected a value over Max to fail")
+	}
+}
+
+// A record being created has no id when its text is written, so its document is
+// named for it when it is saved.
+func TestCrdtTextFieldBindsTheDocumentOnCreate(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("pads")
+	collection.Fields.Add(&core.CrdtTextField{Name: "body"})
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("body", "hello")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := app.FindRecordById(collection, record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := stored.GetRaw("body").(*core.CrdtText)
+	if id, expected := text.Document().ID(), core.CrdtTextDocumentId("pads", record.Id, "body"); id != expected {
+		t.Fatalf("Expected the document %q, got %q", expected, id)
+	}
+	if text.String() != "hello" {
+		t.Fatalf("Expected %q, got %q", "hello", text.String())
+	}
+}
+
+// Writers that each read the record before any of the others saved. Every save
+// after the first would write back a document without the earlier ones' text in
+// it; the field reads the row again right before writing, so all of them survive.
+func TestCrdtTextFieldConcurrentSavesMerge(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("pads")
+	collection.Fields.Add(&core.CrdtTextField{Name: "body"})
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Id = "padaaaaaaaaaaa1"
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	docId := core.CrdtTextDocumentId("pads", record.Id, "body")
+
+	const writers = 8
+
+	var expected int
+	loaded := make([]*core.Record, writers)
+	for i := range loaded {
+		var err error
+		loaded[i], err = app.FindRecordById(collection, record.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		text := fmt.Sprintf("writer%d", i)
+		expected += len(text)
+		loaded[i].Set("body", crdtTextDelta(t, docId, fmt.Sprintf("node%d", i), text))
+	}
+
+	start := make(chan struct{})
+	errs := make(chan error, writers)
+
+	var wg sync.WaitGroup
+	for _, r := range loaded {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- app.Save(r)
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	latest, err := app.FindRecordById(collection, record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text := latest.GetRaw("body").(*core.CrdtText).String(); len(text) != expected {
+		t.Fatalf("Expected all %d saves merged, got %q", writers, text)
+	}
+}
@@ -21,6 +21,7 @@ const DefaultEditorFieldMaxSize int64 = 5 << 20
 var (
 	_ Field                 = (*EditorField)(nil)
 	_ MaxBodySizeCalculator = (*EditorField)(nil)
+	_ FullTextSearcher      = (*EditorField)(nil)
 )
 
 // EditorField defines "editor" type field to store HTML formatted text.
@@ -61,6 +62,12 @@ type EditorField struct {
 
 	// Required will require the field value to be non-empty string.
 	Required bool `form:"required" json:"required"`
+
+	// Searchable indexes the field text (without its markup) for full-text
+	// search, making it usable with the fts() filter function and the @rank sort.
+	//
+	// It is omitted when false so that existing schemas are unchanged.
+	Searchable bool `form:"searchable" json:"searchable,omitempty"`
 }
 
 // Type implements [Field.Type] interface method.
@@ -108,6 +115,11 @@ func (f *EditorField) SetHidden(hidden bool) {
 	f.Hidden = hidden
 }
 
+// IsSearchable implements [FullTextSearcher.IsSearchable] interface method.
+func (f *EditorField) IsSearchable() bool {
+	return f.Searchable
+}
+
 // ColumnType implements [Field.ColumnType] interface method.
 func (f *EditorField) ColumnType(app App) string {
 	return "TEXT DEFAULT '' NOT NULL"
@@ -149,6 +161,7 @@ func (f *EditorField) ValidateSettings(ctx context.Context, app App, collection
 		validation.Field(&f.Id, validation.By(DefaultFieldIdValidationRule)),
 		validation.Field(&f.Name, validation.By(DefaultFieldNameValidationRule)),
 		validation.Field(&f.MaxSize, validation.Min(0), validation.Max(maxSafeJSONInt)),
+		validation.Field(&f.Searchable, validation.When(collection.IsView(), validation.Empty)),
 	)
 }
 
@@ -29,6 +29,7 @@ var (
 	_ Field             = (*TextField)(nil)
 	_ SetterFinder      = (*TextField)(nil)
 	_ RecordInterceptor = (*TextField)(nil)
+	_ FullTextSearcher  = (*TextField)(nil)
 )
 
 var forbiddenPKCharacters = []string{
@@ -107,6 +108,12 @@ type TextField struct {
 	//
 	// A single collection can have only 1 field marked as primary key.
 	PrimaryKey bool `form:"primaryKey" json:"primaryKey"`
+
+	// Searchable indexes the field value for full-text search,
+	// making it usable with the fts() filter function and the @rank sort.
+	//
+	// It is omitted when false so that existing schemas are unchanged.
+	Searchable bool `form:"searchable" json:"searchable,omitempty"`
 }
 
 // Type implements [Field.Type] interface method.
@@ -154,6 +161,11 @@ func (f *TextField) SetHidden(hidden bool) {
 	f.Hidden = hidden
 }
 
+// IsSearchable implements [FullTextSearcher.IsSearchable] interface method.
+func (f *TextField) IsSearchable() bool {
+	return f.Searchable
+}
+
 // ColumnType implements [Field.ColumnType] interface method.
 func (f *TextField) ColumnType(app App) string {
 	if f.PrimaryKey {
@@ -290,6 +302,7 @@ func (f *TextField) ValidateSettings(ctx context.Context, app App, collection *C
 		validation.Field(&f.Hidden, validation.When(f.PrimaryKey, validation.Empty)),
 		validation.Field(&f.Required, validation.When(f.PrimaryKey, validation.Required)),
 		validation.Field(&f.AutogeneratePattern, validation.By(validators.IsRegex), validation.By(f.checkAutogeneratePattern)),
+		validation.Field(&f.Searchable, validation.When(f.PrimaryKey || collection.IsView(), validation.Empty)),
 	)
 }
 
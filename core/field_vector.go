@@ -0,0 +1,226 @@
+package core
+
+import (
+	"context"
+	"math"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hanzoai/base/core/validators"
+	"github.com/hanzoai/base/tools/types"
+)
+
+func init() {
+	Fields[FieldTypeVector] = func() Field {
+		return &VectorField{}
+	}
+}
+
+const FieldTypeVector = "vector"
+
+// MaxVectorDimensions is the max allowed VectorField.Dimensions.
+const MaxVectorDimensions = 16000
+
+// vector distance metrics
+const (
+	VectorMetricCosine = "cosine"
+	VectorMetricL2     = "l2"
+	VectorMetricDot    = "dot"
+)
+
+var (
+	_ Field = (*VectorField)(nil)
+)
+
+// VectorField defines "vector" type field for storing a fixed number of
+// float32 components, usually an embedding of the record content.
+//
+// The respective zero record field value is nil [types.Vector].
+//
+// You can set the record field value as [types.Vector], float slice or
+// serialized json array. The value is stored as a blob of float32 values
+// and returned as a json array.
+//
+// The records could be ordered by their distance to a query vector with the
+// vectorDistance() filter function, eg.:
+//
+//	?sort=vectorDistance(embedding,@request.query.q)&q=[0.1,0.2,...]
+//
+// Examples of updating a record's VectorField value programmatically:
+//
+//	record.Set("embedding", types.Vector{0.1, 0.2, 0.3})
+//	record.Set("embedding", []float64{0.1, 0.2, 0.3})
+//	record.Set("embedding", "[0.1, 0.2, 0.3]")
+type VectorField struct {
+	// Name (required) is the unique name of the field.
+	Name string `form:"name" json:"name"`
+
+	// Id is the unique stable field identifier.
+	//
+	// It is automatically generated from the name when adding to a collection FieldsList.
+	Id string `form:"id" json:"id"`
+
+	// System prevents the renaming and removal of the field.
+	System bool `form:"system" json:"system"`
+
+	// Hidden hides the field from the API response.
+	Hidden bool `form:"hidden" json:"hidden"`
+
+	// Presentable hints the Dashboard UI to use the underlying
+	// field record value in the relation preview label.
+	Presentable bool `form:"presentable" json:"presentable"`
+
+	// ---
+
+	// Dimensions (required) is the exact number of components of a non-empty field value.
+	Dimensions int `form:"dimensions" json:"dimensions"`
+
+	// Metric specifies how the distance between 2 vectors is measured:
+	//   - "cosine" (default) - 1 minus the cosine of the angle between them (0 to 2)
+	//   - "l2" - the euclidean distance
+	//   - "dot" - the negated dot product (for normalized vectors it orders as "cosine")
+	Metric string `form:"metric" json:"metric"`
+
+	// Required will require the field value to be non-empty.
+	Required bool `form:"required" json:"required"`
+}
+
+// Type implements [Field.Type] interface method.
+func (f *VectorField) Type() string {
+	return FieldTypeVector
+}
+
+// GetId implements [Field.GetId] interface method.
+func (f *VectorField) GetId() string {
+	return f.Id
+}
+
+// SetId implements [Field.SetId] interface method.
+func (f *VectorField) SetId(id string) {
+	f.Id = id
+}
+
+// GetName implements [Field.GetName] interface method.
+func (f *VectorField) GetName() string {
+	return f.Name
+}
+
+// SetName implements [Field.SetName] interface method.
+func (f *VectorField) SetName(name string) {
+	f.Name = name
+}
+
+// GetSystem implements [Field.GetSystem] interface method.
+func (f *VectorField) GetSystem() bool {
+	return f.System
+}
+
+// SetSystem implements [Field.SetSystem] interface method.
+func (f *VectorField) SetSystem(system bool) {
+	f.System = system
+}
+
+// GetHidden implements [Field.GetHidden] interface method.
+func (f *VectorField) GetHidden() bool {
+	return f.Hidden
+}
+
+// SetHidden implements [Field.SetHidden] interface method.
+func (f *VectorField) SetHidden(hidden bool) {
+	f.Hidden = hidden
+}
+
+// ColumnType implements [Field.ColumnType] interface method.
+func (f *VectorField) ColumnType(app App) string {
+	return app.Dialect().Bytes() + " DEFAULT NULL"
+}
+
+// PrepareValue implements [Field.PrepareValue] interface method.
+func (f *VectorField) PrepareValue(record *Record, raw any) (any, error) {
+	vector := types.Vector{}
+	err := vector.Scan(raw)
+	return vector, err
+}
+
+// ValidateValue implements [Field.ValidateValue] interface method.
+func (f *VectorField) ValidateValue(ctx context.Context, app App, record *Record) error {
+	val, ok := record.GetRaw(f.Name).(types.Vector)
+	if !ok {
+		return validators.ErrUnsupportedValueType
+	}
+
+	if len(val) == 0 {
+		if f.Required {
+			return validation.ErrRequired
+		}
+		return nil
+	}
+
+	if len(val) != f.Dimensions {
+		return validation.NewError(
+			"validation_vector_dimensions",
+			"The vector must have exactly {{.dimensions}} components.",
+		).SetParams(map[string]any{"dimensions": f.Dimensions})
+	}
+
+	var isZero = true
+	for _, c := range val {
+		if math.IsNaN(float64(c)) || math.IsInf(float64(c), 0) {
+			return validation.NewError("validation_vector_invalid_component", "The vector components must be finite numbers.")
+		}
+		if c != 0 {
+			isZero = false
+		}
+	}
+
+	// the angle to a zero vector is undefined
+	if isZero && f.metric() == VectorMetricCosine {
+		return validation.NewError("validation_vector_zero", "The vector must have at least one non-zero component.")
+	}
+
+	return nil
+}
+
+// ValidateSettings implements [Field.ValidateSettings] interface method.
+func (f *VectorField) ValidateSettings(ctx context.Context, app App, collection *Collection) error {
+	return validation.ValidateStruct(f,
+		validation.Field(&f.Id, validation.By(DefaultFieldIdValidationRule)),
+		validation.Field(&f.Name, validation.By(DefaultFieldNameValidationRule)),
+		validation.Field(&f.Dimensions, validation.Required, validation.Min(1), validation.Max(MaxVectorDimensions)),
+		validation.Field(&f.Metric, validation.In(VectorMetricCosine, VectorMetricL2, VectorMetricDot)),
+	)
+}
+
+// Distance returns the distance between a and b measured by the field metric
+// (the smaller, the nearer).
+//
+// Both vectors are expected to have the same length.
+func (f *VectorField) Distance(a, b types.Vector) float64 {
+	var dot, normA, normB, l2 float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		normA += x * x
+		normB += y * y
+		l2 += (x - y) * (x - y)
+	}
+
+	switch f.metric() {
+	case VectorMetricL2:
+		return math.Sqrt(l2)
+	case VectorMetricDot:
+		return -dot
+	default:
+		if normA == 0 || normB == 0 {
+			return 1 // orthogonal to everything
+		}
+		return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+	}
+}
+
+func (f *VectorField) metric() string {
+	if f.Metric == "" {
+		return VectorMetricCosine
+	}
+
+	return f.Metric
+}
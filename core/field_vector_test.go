@@ -0,0 +1,178 @@
+package core_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/types"
+)
+
+func TestVectorFieldBaseMethods(t *testing.T) {
+	testFieldBaseMethods(t, core.FieldTypeVector)
+}
+
+func TestVectorFieldColumnType(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	f := &core.VectorField{}
+
+	expected := "BLOB DEFAULT NULL"
+
+	if v := f.ColumnType(app); v != expected {
+		t.Fatalf("Expected\n%q\ngot\n%q", expected, v)
+	}
+}
+
+func TestVectorFieldPrepareValue(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	f := &core.VectorField{}
+	record := core.NewRecord(core.NewBaseCollection("test"))
+
+	scenarios := []struct {
+		raw      any
+		expected string
+	}{
+		{nil, `[]`},
+		{"", `[]`},
+		{[]byte{}, `[]`},
+		{types.Vector{1, 2}, `[1,2]`},
+		{[]float64{1, 0.5}, `[1,0.5]`},
+		{"[1, 2.5]", `[1,2.5]`},
+		{types.Vector{3, -1}.Bytes(), `[3,-1]`},
+	}
+
+	for i, s := range scenarios {
+		t.Run(fmt.Sprintf("%d_%#v", i, s.raw), func(t *testing.T) {
+			v, err := f.PrepareValue(record, s.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			raw, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rawStr := string(raw)
+
+			if rawStr != s.expected {
+				t.Fatalf("Expected\n%s\ngot\n%s", s.expected, rawStr)
+			}
+		})
+	}
+}
+
+func TestVectorFieldValidateValue(t *testing.T) {
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("test_collection")
+
+	scenarios := []struct {
+		name        string
+		field       *core.VectorField
+		value       any
+		expectError bool
+	}{
+		{"invalid raw value", &core.VectorField{Name: "test", Dimensions: 2}, 123, true},
+		{"empty (non-required)", &core.VectorField{Name: "test", Dimensions: 2}, types.Vector{}, false},
+		{"empty (required)", &core.VectorField{Name: "test", Dimensions: 2, Required: true}, types.Vector{}, true},
+		{"less dimensions", &core.VectorField{Name: "test", Dimensions: 2}, types.Vector{1}, true},
+		{"more dimensions", &core.VectorField{Name: "test", Dimensions: 2}, types.Vector{1, 2, 3}, true},
+		{"NaN component", &core.VectorField{Name: "test", Dimensions: 2}, types.Vector{1, float32(math.NaN())}, true},
+		{"Inf component", &core.VectorField{Name: "test", Dimensions: 2}, types.Vector{float32(math.Inf(1)), 1}, true},
+		{"zero vector (cosine)", &core.VectorField{Name: "test", Dimensions: 2}, types.Vector{0, 0}, true},
+		{"zero vector (l2)", &core.VectorField{Name: "test", Dimensions: 2, Metric: core.VectorMetricL2}, types.Vector{0, 0}, false},
+		{"valid", &core.VectorField{Name: "test", Dimensions: 2, Required: true}, types.Vector{1, -2}, false},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			record := core.NewRecord(collection)
+			record.SetRaw("test", s.value)
+
+			err := s.field.ValidateValue(context.Background(), app, record)
+
+			hasErr := err != nil
+			if hasErr != s.expectError {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+		})
+	}
+}
+
+func TestVectorFieldValidateSettings(t *testing.T) {
+	testDefaultFieldIdValidation(t, core.FieldTypeVector)
+	testDefaultFieldNameValidation(t, core.FieldTypeVector)
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("test_collection")
+
+	scenarios := []struct {
+		name         string
+		field        *core.VectorField
+		expectErrors []string
+	}{
+		{"zero dimensions", &core.VectorField{Name: "test"}, []string{"dimensions"}},
+		{"negative dimensions", &core.VectorField{Name: "test", Dimensions: -1}, []string{"dimensions"}},
+		{"too many dimensions", &core.VectorField{Name: "test", Dimensions: core.MaxVectorDimensions + 1}, []string{"dimensions"}},
+		{"unknown metric", &core.VectorField{Name: "test", Dimensions: 3, Metric: "manhattan"}, []string{"metric"}},
+		{"valid", &core.VectorField{Name: "test", Dimensions: 3, Metric: core.VectorMetricDot}, []string{}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			errs, _ := s.field.ValidateSettings(context.Background(), app, collection).(validation.Errors)
+
+			if len(errs) != len(s.expectErrors) {
+				t.Fatalf("Expected errors %v, got %v", s.expectErrors, errs)
+			}
+			for _, k := range s.expectErrors {
+				if errs[k] == nil {
+					t.Fatalf("Expected error %q, got %v", k, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestVectorFieldDistance(t *testing.T) {
+	t.Parallel()
+
+	a := types.Vector{1, 0}
+	b := types.Vector{0, 2}
+
+	scenarios := []struct {
+		metric   string
+		a        types.Vector
+		b        types.Vector
+		expected float64
+	}{
+		{"", a, a, 0},
+		{core.VectorMetricCosine, a, b, 1},
+		{core.VectorMetricCosine, a, types.Vector{-3, 0}, 2},
+		{core.VectorMetricCosine, a, types.Vector{0, 0}, 1},
+		{core.VectorMetricL2, a, b, math.Sqrt(5)},
+		{core.VectorMetricDot, types.Vector{1, 2}, types.Vector{3, 4}, -11},
+	}
+
+	for i, s := range scenarios {
+		t.Run(fmt.Sprintf("%d_%s", i, s.metric), func(t *testing.T) {
+			f := &core.VectorField{Metric: s.metric}
+
+			if d := f.Distance(s.a, s.b); math.Abs(d-s.expected) > 1e-9 {
+				t.Fatalf("Expected distance %v, got %v", s.expected, d)
+			}
+		})
+	}
+}
@@ -59,12 +59,17 @@ func (app *BaseApp) installNetworkMiddleware(se *ServeEvent) error {
 
 	se.Router.GET("/-/base/members", func(e *RequestEvent) error {
 		// Cheap health / membership probe; monitoring dashboards
-		// hit this to see scale events.
+		// hit this to see scale events, and how far this member's
+		// replicas have got — a member catching up on a shard does not
+		// vote on it until it is level.
 		members := app.network.MembersFor("")
+		m := app.network.Metrics()
 		return e.JSON(http.StatusOK, map[string]any{
 			"shardKey": shardKey,
 			"members":  members,
 			"nodeID":   os.Getenv("BASE_NODE_ID"),
+			"applied":  m.AppliedSeqs(),
+			"catchUp":  m.CatchUps(),
 		})
 	})
 	return nil
@@ -0,0 +1,293 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+	"github.com/hanzoai/orm/dialect"
+)
+
+// The record change outbox.
+//
+// Every committed write of a record leaves one row in `_changes`, inserted by
+// the transaction that made the write. That is the whole guarantee: a change
+// is recorded if and only if it committed, so nothing that reads the outbox
+// can see a write that rolled back or miss one that did not, whatever crashes
+// in between. Publishing from an after-success hook cannot promise either,
+// because the process can die between the commit and the publish.
+//
+// A row carries the record as it was before the write and as it is after it,
+// so a consumer never has to fetch the record back, and by the time it would,
+// the record may have changed again or be gone.
+//
+// The seq is the order the writes committed in. Writers take it inside their
+// transaction, after their own write, so a transaction holding seq n has
+// already serialized behind every transaction holding a smaller one: a reader
+// that has seen n has seen everything before it, and resuming after n loses
+// nothing. An autoincrement or a sequence would not promise that on every
+// engine: it hands out numbers in the order the writers asked, not the order
+// they committed.
+
+const (
+	// RecordChangesTable is the table of the record change outbox.
+	RecordChangesTable = "_changes"
+
+	// RecordChangeCursorsTable is the table of the change sink cursors.
+	RecordChangeCursorsTable = "_changeCursors"
+)
+
+// The actions a [RecordChange] records.
+const (
+	RecordChangeCreate = "create"
+	RecordChangeUpdate = "update"
+	RecordChangeDelete = "delete"
+)
+
+// RecordChange is one committed record write, as the outbox holds it.
+type RecordChange struct {
+	Seq            int64          `db:"seq" json:"seq"`
+	CollectionId   string         `db:"collectionId" json:"collectionId"`
+	CollectionName string         `db:"collectionName" json:"collectionName"`
+	RecordId       string         `db:"recordId" json:"recordId"`
+	Action         string         `db:"action" json:"action"`
+	Before         types.JSONRaw  `db:"before" json:"before"`
+	After          types.JSONRaw  `db:"after" json:"after"`
+	Created        types.DateTime `db:"created" json:"created"`
+}
+
+// BeforeRecord loads the record as it was before the change into collection,
+// or returns nil for a create.
+func (c *RecordChange) BeforeRecord(collection *Collection) (*Record, error) {
+	return loadRecordChangeState(collection, c.Before)
+}
+
+// AfterRecord loads the record as it is after the change into collection, or
+// returns nil for a delete.
+func (c *RecordChange) AfterRecord(collection *Collection) (*Record, error) {
+	return loadRecordChangeState(collection, c.After)
+}
+
+// loadRecordChangeState loads a state written by recordChangeState back into
+// a record of collection.
+//
+// The collection is the current one, so a field added since the change has
+// its zero value and a field removed since is dropped. So has a hidden field
+// the outbox left out.
+func loadRecordChangeState(collection *Collection, state types.JSONRaw) (*Record, error) {
+	if len(state) == 0 || state.String() == "null" {
+		return nil, nil
+	}
+
+	data := map[string]any{}
+	if err := json.Unmarshal(state, &data); err != nil {
+		return nil, err
+	}
+
+	record := NewRecord(collection)
+	for _, field := range collection.Fields {
+		if v, ok := data[field.GetName()]; ok {
+			record.Set(field.GetName(), v)
+		}
+	}
+
+	if err := record.PostScan(); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// recordChangeState is the state of record a change carries.
+//
+// The hidden fields are left out. The outbox is read by /v1/changes and handed
+// as it is to the sinks, a webhook or a file outside of Base among them, and
+// a password hash or a token key has no business in either; a state loaded
+// back has them zero.
+func recordChangeState(record *Record) (types.JSONRaw, error) {
+	if record == nil {
+		return nil, nil
+	}
+
+	data := record.FieldsData()
+	for _, field := range record.Collection().Fields {
+		if field.GetHidden() {
+			delete(data, field.GetName())
+		}
+	}
+
+	return json.Marshal(data)
+}
+
+// writeRecordChange adds the change from before to after to the outbox.
+// Either is nil where the record did not exist.
+//
+// NB! It is expected to run in the transaction that made the change.
+//
+// The changes of system collections are Base's own bookkeeping rather than
+// the application's data, and a view has no writes of its own, so neither is
+// recorded.
+func writeRecordChange(app App, action string, before *Record, after *Record) error {
+	record := after
+	if record == nil {
+		record = before
+	}
+	if record == nil {
+		return errors.New("a record change needs a record")
+	}
+
+	collection := record.Collection()
+	if collection.System || collection.IsView() {
+		return nil
+	}
+
+	beforeState, err := recordChangeState(before)
+	if err != nil {
+		return err
+	}
+
+	afterState, err := recordChangeState(after)
+	if err != nil {
+		return err
+	}
+
+	db := app.NonconcurrentDB()
+
+	// SQLite runs one writer at a time, so the MAX below is always the last
+	// committed seq. Postgres runs them concurrently: two writers would read
+	// the same MAX and the second would fail on the key, or worse, a writer
+	// could take a seq and commit after one that took a bigger seq. The lock
+	// queues the writers of the outbox until each commits, which keeps seq
+	// order and commit order the same, and leaves readers alone.
+	if _, ok := app.Dialect().(dialect.Postgres); ok {
+		_, err = db.NewQuery("LOCK TABLE {{" + RecordChangesTable + "}} IN EXCLUSIVE MODE").Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	var seq int64
+	err = db.Select("COALESCE(MAX([[seq]]), 0) + 1").From(RecordChangesTable).Row(&seq)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Insert(RecordChangesTable, dbx.Params{
+		"seq":            seq,
+		"collectionId":   collection.Id,
+		"collectionName": collection.Name,
+		"recordId":       record.Id,
+		"action":         action,
+		"before":         beforeState,
+		"after":          afterState,
+		"created":        types.NowDateTime().String(),
+	}).Execute()
+
+	return err
+}
+
+// FindRecordChanges returns at most limit changes committed after the change
+// since, in the order they committed, optionally only those of the collections
+// with the given ids.
+func FindRecordChanges(app App, since int64, limit int, collectionIds ...string) ([]*RecordChange, error) {
+	query := app.ConcurrentDB().
+		Select("*").
+		From(RecordChangesTable).
+		AndWhere(dbx.NewExp("[[seq]] > {:since}", dbx.Params{"since": since})).
+		OrderBy("seq ASC").
+		Limit(int64(limit))
+
+	if len(collectionIds) > 0 {
+		ids := make([]any, len(collectionIds))
+		for i, id := range collectionIds {
+			ids[i] = id
+		}
+		query.AndWhere(dbx.In("collectionId", ids...))
+	}
+
+	changes := []*RecordChange{}
+	if err := query.All(&changes); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// RecordChangesBounds returns the seq of the oldest change the outbox still
+// holds and of the newest one, or zeros while it holds none.
+func RecordChangesBounds(app App) (oldest int64, newest int64, err error) {
+	row := struct {
+		Oldest int64 `db:"oldest"`
+		Newest int64 `db:"newest"`
+	}{}
+
+	err = app.ConcurrentDB().
+		Select("COALESCE(MIN([[seq]]), 0) AS [[oldest]]", "COALESCE(MAX([[seq]]), 0) AS [[newest]]").
+		From(RecordChangesTable).
+		One(&row)
+
+	return row.Oldest, row.Newest, err
+}
+
+// DeleteOldRecordChanges deletes the changes committed before createdBefore
+// that every one of sinks has been delivered.
+//
+// The cursors of any other sink are deleted first. A sink that is no longer
+// registered is never delivered again, and its cursor would hold the outbox
+// back for good; registered again later, it starts at the newest change as a
+// sink seen for the first time does.
+//
+// The newest change is always kept, even when it is old: the next seq is taken
+// from it, and a seq that restarted would be read by a consumer resuming after
+// it as a change already seen.
+func DeleteOldRecordChanges(app App, createdBefore time.Time, sinks ...string) error {
+	names := make([]any, len(sinks))
+	for i, sink := range sinks {
+		names[i] = sink
+	}
+
+	_, err := app.NonconcurrentDB().Delete(
+		RecordChangeCursorsTable,
+		dbx.Not(dbx.HashExp{"sink": names}),
+	).Execute()
+	if err != nil {
+		return err
+	}
+
+	_, newest, err := RecordChangesBounds(app)
+	if err != nil || newest == 0 {
+		return err
+	}
+
+	keepFrom := newest
+
+	var slowest struct {
+		Seq   int64 `db:"seq"`
+		Total int   `db:"total"`
+	}
+	err = app.ConcurrentDB().
+		Select("COALESCE(MIN([[seq]]), 0) AS [[seq]]", "COUNT(*) AS [[total]]").
+		From(RecordChangeCursorsTable).
+		One(&slowest)
+	if err != nil {
+		return err
+	}
+	if slowest.Total > 0 && slowest.Seq < keepFrom {
+		// keep what the slowest sink has not been delivered yet
+		keepFrom = slowest.Seq + 1
+	}
+
+	date, err := types.ParseDateTime(createdBefore)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.NonconcurrentDB().Delete(RecordChangesTable, dbx.NewExp(
+		"[[seq]] < {:keepFrom} AND [[created]] < {:date}",
+		dbx.Params{"keepFrom": keepFrom, "date": date.String()},
+	)).Execute()
+
+	return err
+}
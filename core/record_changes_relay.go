@@ -0,0 +1,409 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// ChangeSink receives the committed record changes, in seq order.
+//
+// Delivery is at least once. A batch is delivered whole or not at all as far
+// as the relay knows, so a sink that fails halfway through one is handed all
+// of it again, and a sink that must not repeat itself deduplicates on the seq.
+type ChangeSink interface {
+	// Name identifies the sink's cursor. A sink renamed is a new sink.
+	Name() string
+
+	// Deliver delivers changes. An error leaves the cursor where it was and
+	// the same changes are delivered again on the next attempt.
+	Deliver(ctx context.Context, changes []*RecordChange) error
+}
+
+const (
+	// changeRelayBatch is how many changes a sink is delivered at once.
+	changeRelayBatch = 100
+
+	// changeRelayInterval is how often the relay looks for changes it was not
+	// told about: the ones committed by another process, and the ones a sink
+	// failed to take the last time.
+	changeRelayInterval = 5 * time.Second
+
+	// defaultChangesMaxDays is how long a delivered change is kept for the
+	// consumers that read the outbox over HTTP.
+	defaultChangesMaxDays = 7
+)
+
+// ChangeRelay delivers the record change outbox to the registered sinks.
+//
+// Each sink has its own cursor in the main db, advanced only after a batch was
+// delivered, so a sink that is down catches up from where it stopped when it
+// comes back, and one that is slow holds back no other. A sink starts at the
+// change that was newest when it was first seen rather than at the oldest
+// retained one: a sink added to a Base with a week of history is not handed
+// the week.
+type ChangeRelay struct {
+	app App
+
+	mu      sync.Mutex
+	sinks   []ChangeSink
+	cancel  context.CancelFunc
+	done    chan struct{}
+	flushMu sync.Mutex
+	wake    chan struct{}
+}
+
+func newChangeRelay(app App) *ChangeRelay {
+	return &ChangeRelay{
+		app:  app,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Register adds sink to the relay.
+func (r *ChangeRelay) Register(sink ChangeSink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sinks = append(r.sinks, sink)
+}
+
+// Sinks returns the registered sinks.
+func (r *ChangeRelay) Sinks() []ChangeSink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]ChangeSink(nil), r.sinks...)
+}
+
+// Notify tells the relay that a change committed, so that it delivers before
+// its next tick. It never blocks.
+func (r *ChangeRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the relay in the background until Stop. It is a no-op while the
+// relay runs.
+func (r *ChangeRelay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go r.run(ctx, r.done)
+}
+
+// Stop stops the relay and waits for the delivery in flight, if any.
+func (r *ChangeRelay) Stop() {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func (r *ChangeRelay) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(changeRelayInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			r.app.Logger().Warn("Failed to relay the record changes", "error", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// Flush delivers every pending change to every sink and returns when they all
+// took them or failed to. A sink that fails is logged and left for the next
+// flush; the error returned is the outbox's own.
+func (r *ChangeRelay) Flush(ctx context.Context) error {
+	sinks := r.Sinks()
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	// one flush at a time, or two would deliver the same batch
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	for _, sink := range sinks {
+		if err := r.flushSink(ctx, sink); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var sinkErr *changeSinkError
+			if !errors.As(err, &sinkErr) {
+				return err
+			}
+			r.app.Logger().Warn("Failed to deliver the record changes", "sink", sink.Name(), "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// changeSinkError is a sink refusing a batch, as opposed to the outbox failing
+// to produce one.
+type changeSinkError struct {
+	err error
+}
+
+func (e *changeSinkError) Error() string {
+	return e.err.Error()
+}
+
+func (e *changeSinkError) Unwrap() error {
+	return e.err
+}
+
+func (r *ChangeRelay) flushSink(ctx context.Context, sink ChangeSink) error {
+	cursor, err := r.cursor(sink.Name())
+	if err != nil {
+		return err
+	}
+
+	for {
+		changes, err := FindRecordChanges(r.app, cursor, changeRelayBatch)
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+
+		if err := sink.Deliver(ctx, changes); err != nil {
+			return &changeSinkError{err}
+		}
+
+		cursor = changes[len(changes)-1].Seq
+
+		_, err = r.app.NonconcurrentDB().Update(
+			RecordChangeCursorsTable,
+			dbx.Params{"seq": cursor, "updated": types.NowDateTime().String()},
+			dbx.HashExp{"sink": sink.Name()},
+		).Execute()
+		if err != nil {
+			return err
+		}
+
+		if len(changes) < changeRelayBatch {
+			return nil
+		}
+	}
+}
+
+// cursor returns the seq the sink was last delivered, starting a sink seen for
+// the first time at the newest change.
+func (r *ChangeRelay) cursor(sink string) (int64, error) {
+	var seq int64
+
+	err := r.app.ConcurrentDB().
+		Select("seq").
+		From(RecordChangeCursorsTable).
+		Where(dbx.HashExp{"sink": sink}).
+		Row(&seq)
+	if err == nil {
+		return seq, nil
+	}
+
+	_, seq, err = RecordChangesBounds(r.app)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = r.app.NonconcurrentDB().Insert(RecordChangeCursorsTable, dbx.Params{
+		"sink":    sink,
+		"seq":     seq,
+		"updated": types.NowDateTime().String(),
+	}).Execute()
+
+	return seq, err
+}
+
+// -------------------------------------------------------------------
+
+// WebhookChangeSink POSTs each batch of changes as `{"changes": [...]}` to a
+// URL; any answer but a 2xx is a failed delivery.
+type WebhookChangeSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Name implements [ChangeSink.Name].
+func (s *WebhookChangeSink) Name() string {
+	return "webhook:" + s.URL
+}
+
+// Deliver implements [ChangeSink.Deliver].
+func (s *WebhookChangeSink) Deliver(ctx context.Context, changes []*RecordChange) error {
+	body, err := json.Marshal(map[string]any{"changes": changes})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the webhook answered %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// FileChangeSink appends each change to a file as one line of JSON.
+type FileChangeSink struct {
+	Path string
+}
+
+// Name implements [ChangeSink.Name].
+func (s *FileChangeSink) Name() string {
+	return "file:" + s.Path
+}
+
+// Deliver implements [ChangeSink.Deliver].
+//
+// The batch is synced before it counts as delivered, so a crash can repeat
+// lines but never lose them.
+func (s *FileChangeSink) Deliver(_ context.Context, changes []*RecordChange) error {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, change := range changes {
+		if err := enc.Encode(change); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// registerChangeRelay registers the sinks configured by the environment and
+// runs the relay while the app is bootstrapped.
+//
+//	NATS_URL                  publish to NATS (see [NATSPublisher])
+//	BASE_CHANGES_WEBHOOK_URL  POST to a webhook
+//	BASE_CHANGES_FILE         append to a JSON lines file
+//	BASE_CHANGES_MAX_DAYS     days a delivered change is kept (default 7)
+//
+// The outbox is written whether or not any sink is configured: /v1/changes
+// reads it too.
+func registerChangeRelay(app *BaseApp) {
+	relay := app.changeRelay
+
+	pub := newNATSPublisher()
+	if pub != nil {
+		app.Logger().Info("NATS event publisher enabled", "url", pub.url)
+		relay.Register(pub)
+		registerNATSModelHooks(app, pub)
+	}
+	if url := os.Getenv("BASE_CHANGES_WEBHOOK_URL"); url != "" {
+		relay.Register(&WebhookChangeSink{URL: url})
+	}
+	if path := os.Getenv("BASE_CHANGES_FILE"); path != "" {
+		relay.Register(&FileChangeSink{Path: path})
+	}
+
+	// after the commit, or the relay would look before the change is there
+	notify := func(e *RecordEvent) error {
+		relay.Notify()
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess().BindFunc(notify)
+	app.OnRecordAfterUpdateSuccess().BindFunc(notify)
+	app.OnRecordAfterDeleteSuccess().BindFunc(notify)
+
+	// on every bootstrapped Base rather than on the one that serves: an org's
+	// Base is bootstrapped and never served, and its changes are relayed too
+	app.OnBootstrap().BindFunc(func(e *BootstrapEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		relay.Start()
+		return nil
+	})
+
+	app.OnTerminate().BindFunc(func(e *TerminateEvent) error {
+		relay.Stop()
+		if pub != nil {
+			pub.Close()
+		}
+		return e.Next()
+	})
+
+	app.Cron().Add("__hzChangesCleanup__", "30 */6 * * *", func() {
+		maxDays := defaultChangesMaxDays
+		if raw := os.Getenv("BASE_CHANGES_MAX_DAYS"); raw != "" {
+			if days, err := strconv.Atoi(raw); err == nil && days >= 0 {
+				maxDays = days
+			}
+		}
+
+		sinks := relay.Sinks()
+		names := make([]string, len(sinks))
+		for i, sink := range sinks {
+			names[i] = sink.Name()
+		}
+
+		if err := DeleteOldRecordChanges(app, time.Now().AddDate(0, 0, -maxDays), names...); err != nil {
+			app.Logger().Warn("Failed to delete old record changes", "error", err)
+		}
+	})
+}
@@ -0,0 +1,445 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+)
+
+func TestRecordChangesOutbox(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	_, start, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("title", "outbox")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	record.Set("title", "outbox2")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	// rolled back, so never recorded
+	err = app.RunInTransaction(func(txApp core.App) error {
+		record.Set("title", "rolled back")
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction to fail")
+	}
+
+	// a system collection is not recorded
+	superuser, err := app.FindAuthRecordByEmail(core.CollectionNameSuperusers, "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	superuser.SetEmailVisibility(!superuser.EmailVisibility())
+	if err := app.Save(superuser); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := app.FindRecordById(collection, record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := core.FindRecordChanges(app, start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		action string
+		before string
+		after  string
+	}{
+		{core.RecordChangeCreate, "", "outbox"},
+		{core.RecordChangeUpdate, "outbox", "outbox2"},
+		{core.RecordChangeDelete, "outbox2", ""},
+	}
+
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected %d changes, got %d", len(expected), len(changes))
+	}
+
+	for i, change := range changes {
+		if change.Seq != start+int64(i)+1 {
+			t.Fatalf("[%d] Expected seq %d, got %d", i, start+int64(i)+1, change.Seq)
+		}
+		if change.Action != expected[i].action || change.RecordId != record.Id || change.CollectionName != "demo2" {
+			t.Fatalf("[%d] Unexpected change %+v", i, change)
+		}
+
+		before, err := change.BeforeRecord(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := change.AfterRecord(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, s := range []struct {
+			name     string
+			record   *core.Record
+			expected string
+		}{{"before", before, expected[i].before}, {"after", after, expected[i].after}} {
+			if s.expected == "" {
+				if s.record != nil {
+					t.Fatalf("[%d] Expected no %s state, got %v", i, s.name, s.record)
+				}
+				continue
+			}
+			if s.record == nil {
+				t.Fatalf("[%d] Expected a %s state", i, s.name)
+			}
+			if s.record.Id != record.Id || s.record.GetString("title") != s.expected {
+				t.Fatalf("[%d] Expected the %s title %q, got %q", i, s.name, s.expected, s.record.GetString("title"))
+			}
+		}
+	}
+
+	// only the listed collections
+	changes, err = core.FindRecordChanges(app, start, 100, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("Expected no changes of a missing collection, got %d", len(changes))
+	}
+}
+
+func TestRecordChangesCascade(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	_, start, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// cascades to demo1 84nmscqy84lsi1t
+	record, err := app.FindRecordById("users", "oap640cot4yru2s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delete(record); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := core.FindRecordChanges(app, start, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) < 2 {
+		t.Fatalf("Expected the delete and the changes it cascaded to, got %d changes", len(changes))
+	}
+	if changes[0].CollectionName != "users" || changes[0].RecordId != record.Id || changes[0].Action != core.RecordChangeDelete {
+		t.Fatalf("Expected the delete to be recorded first, got %+v", changes[0])
+	}
+
+	var cascaded bool
+	for _, change := range changes[1:] {
+		if change.CollectionName == "demo1" && change.RecordId == "84nmscqy84lsi1t" && change.Action == core.RecordChangeDelete {
+			cascaded = true
+		}
+	}
+	if !cascaded {
+		t.Fatal("Expected the cascaded delete of demo1 84nmscqy84lsi1t to be recorded")
+	}
+}
+
+func TestRecordChangesLeaveOutHiddenFields(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	sink := &core.FileChangeSink{Path: filepath.Join(t.TempDir(), "changes.jsonl")}
+	app.ChangeRelay().Register(sink)
+
+	ctx := context.Background()
+
+	// the sink starts at the newest change
+	if err := app.ChangeRelay().Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	_, start, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the auth records are mirrors of IAM and have no password of their own,
+	// so the collection keeps one as a hidden field, next to the tokenKey
+	collection := core.NewAuthCollection("outbox_members")
+	collection.Fields.Add(&core.TextField{Name: "password", Hidden: true})
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	record := core.NewRecord(collection)
+	record.SetEmail("outbox@example.com")
+	record.Set("password", "hash-1234567890")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	secrets := []string{record.TokenKey(), "hash-1234567890"}
+
+	record.Set("password", "hash-0987654321")
+	record.RefreshTokenKey()
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+	secrets = append(secrets, record.TokenKey(), "hash-0987654321")
+
+	if err := app.Delete(record); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := core.FindRecordChanges(app, start, 10, collection.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %d", len(changes))
+	}
+
+	if err := app.ChangeRelay().Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := os.ReadFile(sink.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outbox := ""
+	for _, change := range changes {
+		outbox += change.Before.String() + change.After.String()
+	}
+
+	for name, content := range map[string]string{"outbox": outbox, "sink": string(delivered)} {
+		if !strings.Contains(content, "outbox@example.com") {
+			t.Fatalf("Expected the %s to hold the record, got %s", name, content)
+		}
+		for _, field := range []string{`"password"`, `"tokenKey"`} {
+			if strings.Contains(content, field) {
+				t.Fatalf("Expected the %s to leave out %s, got %s", name, field, content)
+			}
+		}
+		for _, secret := range secrets {
+			if strings.Contains(content, secret) {
+				t.Fatalf("Expected the %s to leave out %q, got %s", name, secret, content)
+			}
+		}
+	}
+}
+
+// recordingSink is shared with the relay the test app runs in the background.
+type recordingSink struct {
+	name string
+
+	mu        sync.Mutex
+	fail      bool
+	delivered []int64
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Deliver(_ context.Context, changes []*core.RecordChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail {
+		return errors.New("unavailable")
+	}
+	for _, change := range changes {
+		s.delivered = append(s.delivered, change.Seq)
+	}
+	return nil
+}
+
+func (s *recordingSink) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fail = fail
+}
+
+func (s *recordingSink) seqs() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int64(nil), s.delivered...)
+}
+
+func TestChangeRelay(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := func(title string) {
+		record := core.NewRecord(collection)
+		record.Set("title", title)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// history from before the sink was seen
+	save("before")
+
+	ok := &recordingSink{name: "ok"}
+	down := &recordingSink{name: "down", fail: true}
+	app.ChangeRelay().Register(ok)
+	app.ChangeRelay().Register(down)
+
+	ctx := context.Background()
+
+	if err := app.ChangeRelay().Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivered := ok.seqs(); len(delivered) != 0 {
+		t.Fatalf("Expected a new sink to start at the newest change, got %v", delivered)
+	}
+
+	_, start, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save("a")
+	save("b")
+
+	if err := app.ChangeRelay().Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivered := ok.seqs(); len(delivered) != 2 || delivered[0] != start+1 || delivered[1] != start+2 {
+		t.Fatalf("Expected seqs %d and %d, got %v", start+1, start+2, delivered)
+	}
+
+	// the sink that was down is handed everything it missed
+	down.setFail(false)
+	save("c")
+
+	if err := app.ChangeRelay().Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if delivered := down.seqs(); len(delivered) != 3 || delivered[0] != start+1 {
+		t.Fatalf("Expected the 3 missed changes from %d, got %v", start+1, delivered)
+	}
+	if delivered := ok.seqs(); len(delivered) != 3 {
+		t.Fatalf("Expected each change once, got %v", delivered)
+	}
+}
+
+func TestDeleteOldRecordChanges(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, title := range []string{"a", "b", "c"} {
+		record := core.NewRecord(collection)
+		record.Set("title", title)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, newest, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a sink that was delivered up to the first of the three, and one that
+	// was never delivered anything and is no longer registered
+	cursors := map[string]int64{"slow": newest - 2, "gone": 0}
+	for sink, seq := range cursors {
+		_, err = app.NonconcurrentDB().Insert(core.RecordChangeCursorsTable, map[string]any{
+			"sink":    sink,
+			"seq":     seq,
+			"updated": "",
+		}).Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := core.DeleteOldRecordChanges(app, time.Now().Add(time.Hour), "slow"); err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining []string
+	err = app.ConcurrentDB().Select("sink").From(core.RecordChangeCursorsTable).Column(&remaining)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0] != "slow" {
+		t.Fatalf("Expected only the cursor of the registered sink to be kept, got %v", remaining)
+	}
+
+	oldest, _, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest != newest-1 {
+		t.Fatalf("Expected the changes the slow sink was not delivered to be kept from %d, got %d", newest-1, oldest)
+	}
+
+	// with no sink registered, no cursor holds anything back
+	if err := core.DeleteOldRecordChanges(app, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	oldest, after, err := core.RecordChangesBounds(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldest != newest || after != newest {
+		t.Fatalf("Expected only the newest change %d to be kept, got %d-%d", newest, oldest, after)
+	}
+}
@@ -0,0 +1,492 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/hanzoai/base/tools/inflector"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The draft/publish workflow of a base collection with the "drafts" option.
+//
+// The records table holds the published copy of every record, so the list and
+// view rules, the realtime subscriptions, the outbox and everything else that
+// reads the table only ever see published state. The draft copy lives next to
+// it, in a drafts table named by the collection id like the history, one row
+// per record that has unpublished changes.
+//
+// An API update of a record writes its draft instead of the row: the update
+// rule decides who may edit, the submitted data is applied over the current
+// draft (or the published copy when there is none) and validated as a save
+// would, and nothing else sees it. Publishing copies the draft over the row
+// with an ordinary save, in one transaction with the removal of the draft, so
+// the save leaves its revision (the history is always on for the collection)
+// and the outbox change, and a publish either happens whole or not at all.
+//
+// A record created through the API is a draft until it is first published:
+// its "published" date, the field the option adds, stays empty and the reads
+// that apply a list or a view rule skip it for everyone but the superusers.
+//
+// A draft may carry a publishAt date, after which the scheduler plugin
+// publishes it (see [PublishDueRecordDrafts]), so content goes live at the
+// planned time without anyone online to press the button.
+//
+// The files of a record are not drafted: a draft holds every field but the
+// id, the file and the autodate fields and the system dates, and an update
+// that would change a file of a drafts collection record is refused.
+
+// publishBatchSize is how many due drafts are read at once when publishing.
+const publishBatchSize = 100
+
+// ErrNothingToPublish is returned when publishing a published record
+// that has no draft.
+var ErrNothingToPublish = errors.New("the record has no draft to publish")
+
+// RecordDraft is the unpublished copy of a record.
+type RecordDraft struct {
+	RecordId string `db:"recordId" json:"recordId"`
+
+	// Data is the drafted fields, as a JSON object keyed by field name.
+	Data types.JSONRaw `db:"data" json:"data"`
+
+	// PublishAt is when the draft is to be published, if it was scheduled.
+	PublishAt types.DateTime `db:"publishAt" json:"publishAt"`
+
+	// Actor and ActorCollection name the auth record that last saved or
+	// scheduled the draft, and are empty when it was not done on behalf of one.
+	Actor           string `db:"actor" json:"actor"`
+	ActorCollection string `db:"actorCollection" json:"actorCollection"`
+
+	Updated types.DateTime `db:"updated" json:"updated"`
+}
+
+// Record returns a copy of published, the record as its row holds it, with
+// the draft applied over it.
+func (d *RecordDraft) Record(published *Record) (*Record, error) {
+	data := map[string]any{}
+	if err := json.Unmarshal(d.Data, &data); err != nil {
+		return nil, err
+	}
+
+	record := published.Clone()
+	for _, field := range published.Collection().Fields {
+		if !recordFieldDrafted(published.Collection(), field) {
+			continue
+		}
+
+		if v, ok := data[field.GetName()]; ok {
+			record.Set(field.GetName(), v)
+		}
+	}
+
+	return record, nil
+}
+
+// IsPublished reports whether the record of a drafts collection was ever
+// published. A record of any other collection always is.
+func (m *Record) IsPublished() bool {
+	collection := m.Collection()
+	if collection == nil || !collection.Drafts {
+		return true
+	}
+
+	return !m.GetDateTime(FieldNamePublished).IsZero()
+}
+
+// recordDraftsTableName returns the name of the collection's drafts table.
+func recordDraftsTableName(collection *Collection) string {
+	return "_drafts_" + inflector.Columnify(collection.Id)
+}
+
+// recordDraftsEnabled reports whether the records of collection are drafted.
+func recordDraftsEnabled(collection *Collection) bool {
+	return collection != nil && collection.IsBase() && !collection.System && collection.Drafts
+}
+
+// recordFieldDrafted reports whether the draft of a collection record holds field.
+func recordFieldDrafted(collection *Collection, field Field) bool {
+	switch field.GetName() {
+	case FieldNameId, FieldNamePublished:
+		return false
+	case FieldNameDeleted:
+		if collection.SoftDelete {
+			return false
+		}
+	}
+
+	switch field.Type() {
+	case FieldTypeFile, FieldTypeAutodate:
+		return false
+	}
+
+	return true
+}
+
+// syncRecordDraftsTable creates the drafts table of newCollection, if its
+// drafts are on and the table isn't there yet.
+//
+// The records that exist when the drafts are turned on for the first time
+// are published as they are, so turning the option on hides nothing.
+//
+// NB! This method is expected to be called from inside of a transaction.
+func syncRecordDraftsTable(app App, newCollection *Collection) error {
+	if !recordDraftsEnabled(newCollection) {
+		return nil
+	}
+
+	tableName := recordDraftsTableName(newCollection)
+	if app.HasTable(tableName) {
+		return nil
+	}
+
+	_, err := app.DB().CreateTable(tableName, map[string]string{
+		"recordId":        "TEXT PRIMARY KEY NOT NULL",
+		"data":            app.Dialect().Json() + " NOT NULL",
+		"publishAt":       "TEXT DEFAULT '' NOT NULL",
+		"actor":           "TEXT DEFAULT '' NOT NULL",
+		"actorCollection": "TEXT DEFAULT '' NOT NULL",
+		"updated":         "TEXT DEFAULT '' NOT NULL",
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to create the drafts of %s: %w", newCollection.Name, err)
+	}
+
+	_, err = app.DB().NewQuery(fmt.Sprintf(
+		"CREATE INDEX [[idx_%s_publishAt]] ON {{%s}} ([[publishAt]])",
+		tableName,
+		tableName,
+	)).Execute()
+	if err != nil {
+		return err
+	}
+
+	_, err = app.DB().Update(
+		newCollection.Name,
+		dbx.Params{FieldNamePublished: types.NowDateTime().String()},
+		dbx.HashExp{FieldNamePublished: ""},
+	).Execute()
+
+	return err
+}
+
+// FindRecordDraft returns the draft of the collection record with the given
+// id, or [sql.ErrNoRows] if it has none.
+func FindRecordDraft(app App, collection *Collection, recordId string) (*RecordDraft, error) {
+	if !collection.IsBase() || !app.HasTable(recordDraftsTableName(collection)) {
+		return nil, sql.ErrNoRows
+	}
+
+	draft := &RecordDraft{}
+
+	err := app.ConcurrentDB().
+		Select("*").
+		From(recordDraftsTableName(collection)).
+		Where(dbx.HashExp{"recordId": recordId}).
+		Limit(1).
+		One(draft)
+	if err != nil {
+		return nil, err
+	}
+
+	return draft, nil
+}
+
+// LoadRecordDraft returns record, as its row holds it, with its draft
+// applied over it, or record itself when it has no draft.
+func LoadRecordDraft(app App, record *Record) (*Record, error) {
+	draft, err := FindRecordDraft(app, record.Collection(), record.Id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return record, nil
+		}
+		return nil, err
+	}
+
+	return draft.Record(record)
+}
+
+// SaveRecordDraft validates record as a save would and keeps its drafted
+// fields as the draft of the record, leaving its row as it is.
+//
+// A scheduled publishAt of the draft it replaces is kept.
+func SaveRecordDraft(ctx context.Context, app App, record *Record) error {
+	collection := record.Collection()
+	if !recordDraftsEnabled(collection) {
+		return fmt.Errorf("the %s collection has no drafts", collection.Name)
+	}
+
+	if record.IsNew() {
+		return errors.New("a new record has no row to draft")
+	}
+
+	original := record.Original()
+	for _, field := range collection.Fields {
+		if field.Type() != FieldTypeFile {
+			continue
+		}
+
+		name := field.GetName()
+		if len(record.GetUnsavedFiles(name)) > 0 ||
+			!slices.Equal(record.GetStringSlice(name), original.GetStringSlice(name)) {
+			return validation.Errors{
+				name: validation.NewError("validation_files_not_drafted", "The files of a drafts collection record are not drafted."),
+			}
+		}
+	}
+
+	if err := app.ValidateWithContext(ctx, record); err != nil {
+		return err
+	}
+
+	data := make(map[string]any, len(collection.Fields))
+	for _, field := range collection.Fields {
+		if recordFieldDrafted(collection, field) {
+			data[field.GetName()] = record.GetRaw(field.GetName())
+		}
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	params := dbx.Params{
+		"data":    string(raw),
+		"updated": types.NowDateTime().String(),
+	}
+	withRecordDraftActor(ctx, params)
+
+	return upsertRecordDraft(app, collection, record.Id, params)
+}
+
+// ScheduleRecordDraft sets the time at which the draft of record is to be
+// published, drafting record as it is when it has no draft yet.
+//
+// A zero at cancels the schedule.
+func ScheduleRecordDraft(ctx context.Context, app App, record *Record, at types.DateTime) error {
+	collection := record.Collection()
+	if !recordDraftsEnabled(collection) {
+		return fmt.Errorf("the %s collection has no drafts", collection.Name)
+	}
+
+	params := dbx.Params{
+		"publishAt": at.String(),
+		"updated":   types.NowDateTime().String(),
+	}
+	withRecordDraftActor(ctx, params)
+
+	_, err := FindRecordDraft(app, collection, record.Id)
+	if errors.Is(err, sql.ErrNoRows) {
+		if record.IsPublished() {
+			return ErrNothingToPublish
+		}
+
+		// the first draft of a record is its row
+		data := make(map[string]any, len(collection.Fields))
+		for _, field := range collection.Fields {
+			if recordFieldDrafted(collection, field) {
+				data[field.GetName()] = record.GetRaw(field.GetName())
+			}
+		}
+
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		params["data"] = string(raw)
+	} else if err != nil {
+		return err
+	}
+
+	return upsertRecordDraft(app, collection, record.Id, params)
+}
+
+// DiscardRecordDraft deletes the draft of record, and its schedule with it.
+func DiscardRecordDraft(app App, record *Record) error {
+	return deleteRecordDraft(app, record.Collection(), record.Id)
+}
+
+// PublishRecordDraft publishes the draft of record over its row and returns
+// the published record.
+//
+// The draft is applied to the row and saved, with the record validations and
+// hooks, in the transaction that removes the draft, so the publish and the
+// revision it leaves are committed together. A record that was never
+// published is published as its row holds it when it has no draft.
+func PublishRecordDraft(ctx context.Context, app App, record *Record) (*Record, error) {
+	collection := record.Collection()
+	if !recordDraftsEnabled(collection) {
+		return nil, fmt.Errorf("the %s collection has no drafts", collection.Name)
+	}
+
+	var published *Record
+
+	err := app.RunInTransaction(func(txApp App) error {
+		row, err := txApp.FindRecordById(collection, record.Id)
+		if err != nil {
+			return err
+		}
+
+		published = row
+
+		draft, err := FindRecordDraft(txApp, collection, record.Id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			if row.IsPublished() {
+				return ErrNothingToPublish
+			}
+		case err != nil:
+			return err
+		default:
+			published, err = draft.Record(row)
+			if err != nil {
+				return err
+			}
+		}
+
+		published.SetRaw(FieldNamePublished, types.NowDateTime())
+
+		if err := txApp.SaveWithContext(ctx, published); err != nil {
+			return err
+		}
+
+		return deleteRecordDraft(txApp, collection, record.Id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return published, nil
+}
+
+// PublishDueRecordDrafts publishes the drafts scheduled to be published by
+// now, on behalf of whoever scheduled them.
+//
+// A draft that fails to be published (eg. because it stopped being valid, or
+// its record is in the trash) loses its schedule, so that it is not retried
+// on every call, and stays a draft for its editors to fix and publish.
+func PublishDueRecordDrafts(app App, now time.Time) error {
+	collections, err := app.FindAllCollections(CollectionTypeBase)
+	if err != nil {
+		return err
+	}
+
+	due, err := types.ParseDateTime(now)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, collection := range collections {
+		if !recordDraftsEnabled(collection) || !app.HasTable(recordDraftsTableName(collection)) {
+			continue
+		}
+
+		drafts := []*RecordDraft{}
+
+		err := app.ConcurrentDB().
+			Select("*").
+			From(recordDraftsTableName(collection)).
+			AndWhere(dbx.NewExp("[[publishAt]] != ''")).
+			AndWhere(dbx.NewExp("[[publishAt]] <= {:now}", dbx.Params{"now": due.String()})).
+			OrderBy("publishAt ASC").
+			Limit(publishBatchSize).
+			All(&drafts)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, draft := range drafts {
+			record, err := app.FindRecordById(collection, draft.RecordId)
+			if err == nil && record.IsTrashed() {
+				err = errors.New("the record is trashed")
+			}
+			if err == nil {
+				ctx := context.Background()
+				if draft.Actor != "" {
+					if actor, _ := app.FindRecordById(draft.ActorCollection, draft.Actor); actor != nil {
+						ctx = WithRecordActor(ctx, actor)
+					}
+				}
+
+				_, err = PublishRecordDraft(ctx, app, record)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to publish %s record %s: %w", collection.Name, draft.RecordId, err))
+
+				_, err = app.NonconcurrentDB().Update(
+					recordDraftsTableName(collection),
+					dbx.Params{"publishAt": ""},
+					dbx.HashExp{"recordId": draft.RecordId},
+				).Execute()
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// withRecordDraftActor names the actor of ctx in the draft params.
+func withRecordDraftActor(ctx context.Context, params dbx.Params) {
+	params["actor"] = ""
+	params["actorCollection"] = ""
+
+	if auth := recordActor(ctx); auth != nil {
+		params["actor"] = auth.Id
+		params["actorCollection"] = auth.Collection().Id
+	}
+}
+
+// upsertRecordDraft updates the draft of the collection record with the
+// given id with params, inserting it when there is none.
+func upsertRecordDraft(app App, collection *Collection, recordId string, params dbx.Params) error {
+	tableName := recordDraftsTableName(collection)
+
+	return app.RunInTransaction(func(txApp App) error {
+		result, err := txApp.NonconcurrentDB().Update(tableName, params, dbx.HashExp{"recordId": recordId}).Execute()
+		if err != nil {
+			return err
+		}
+
+		if rows, err := result.RowsAffected(); err != nil || rows > 0 {
+			return err
+		}
+
+		insert := dbx.Params{"recordId": recordId, "publishAt": ""}
+		for k, v := range params {
+			insert[k] = v
+		}
+
+		_, err = txApp.NonconcurrentDB().Insert(tableName, insert).Execute()
+
+		return err
+	})
+}
+
+// deleteRecordDraft deletes the draft of the collection record with the
+// given id, if there is one.
+func deleteRecordDraft(app App, collection *Collection, recordId string) error {
+	if !collection.IsBase() || !app.HasTable(recordDraftsTableName(collection)) {
+		return nil
+	}
+
+	_, err := app.NonconcurrentDB().Delete(
+		recordDraftsTableName(collection),
+		dbx.HashExp{"recordId": recordId},
+	).Execute()
+
+	return err
+}
@@ -0,0 +1,191 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/types"
+)
+
+func TestRecordDrafts(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection.Drafts = true
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	field, _ := collection.Fields.GetByName(core.FieldNamePublished).(*core.DateField)
+	if field == nil || !field.System {
+		t.Fatalf("Expected a system %q date field, got %v", core.FieldNamePublished, field)
+	}
+
+	record, err := app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.IsPublished() {
+		t.Fatal("Expected the existing records to be published when the drafts are turned on")
+	}
+
+	record.Set("title", "draft")
+	if err := core.SaveRecordDraft(context.Background(), app, record); err != nil {
+		t.Fatal(err)
+	}
+
+	// the row keeps the published copy
+	row, err := app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := row.GetString("title"); title != "test2" {
+		t.Fatalf("Expected the published title test2, got %q", title)
+	}
+
+	draft, err := core.LoadRecordDraft(app, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := draft.GetString("title"); title != "draft" {
+		t.Fatalf("Expected the draft title, got %q", title)
+	}
+
+	published, err := core.PublishRecordDraft(context.Background(), app, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := published.GetString("title"); title != "draft" {
+		t.Fatalf("Expected the published draft title, got %q", title)
+	}
+
+	row, err = app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title := row.GetString("title"); title != "draft" {
+		t.Fatalf("Expected the draft to be published, got %q", title)
+	}
+
+	if _, err := core.FindRecordDraft(app, collection, row.Id); err == nil {
+		t.Fatal("Expected the published draft to be removed")
+	}
+
+	revisions, err := core.FindRecordRevisions(app, collection, row.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Fatalf("Expected the publish to leave 1 revision, got %d", len(revisions))
+	}
+
+	if _, err := core.PublishRecordDraft(context.Background(), app, row); !errors.Is(err, core.ErrNothingToPublish) {
+		t.Fatalf("Expected ErrNothingToPublish, got %v", err)
+	}
+
+	// a new record is a draft until its first publish
+	created := core.NewRecord(collection)
+	created.Set("title", "unpublished")
+	if err := app.Save(created); err != nil {
+		t.Fatal(err)
+	}
+	if created.IsPublished() {
+		t.Fatal("Expected a new record not to be published")
+	}
+
+	if _, err := core.PublishRecordDraft(context.Background(), app, created); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err = app.FindRecordById(collection, created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.IsPublished() {
+		t.Fatal("Expected the new record to be published")
+	}
+}
+
+func TestPublishDueRecordDrafts(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection.Drafts = true
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	schedule := func(id string, title string, at time.Time) {
+		record, err := app.FindRecordById(collection, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record.Set("title", title)
+		if err := core.SaveRecordDraft(context.Background(), app, record); err != nil {
+			t.Fatal(err)
+		}
+
+		publishAt, err := types.ParseDateTime(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := core.ScheduleRecordDraft(context.Background(), app, record, publishAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	schedule("llvuca81nly1qls", "due", now.Add(-time.Minute))
+	schedule("achvryl401bhse3", "later", now.Add(time.Hour))
+
+	if err := core.PublishDueRecordDrafts(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		id    string
+		title string
+		draft bool
+	}{
+		{"llvuca81nly1qls", "due", false},
+		{"achvryl401bhse3", "test2", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.id, func(t *testing.T) {
+			record, err := app.FindRecordById(collection, s.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title := record.GetString("title"); title != s.title {
+				t.Fatalf("Expected title %q, got %q", s.title, title)
+			}
+
+			_, err = core.FindRecordDraft(app, collection, s.id)
+			if hasDraft := err == nil; hasDraft != s.draft {
+				t.Fatalf("Expected draft %v, got %v (%v)", s.draft, hasDraft, err)
+			}
+		})
+	}
+}
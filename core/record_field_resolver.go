@@ -31,8 +31,11 @@ type ruleJoin struct {
 	tableAlias string
 }
 
-// ensure that `search.FieldResolver` interface is implemented
-var _ search.FieldResolver = (*RecordFieldResolver)(nil)
+// ensure that `search.FieldResolver` and `search.Ranker` interfaces are implemented
+var (
+	_ search.FieldResolver = (*RecordFieldResolver)(nil)
+	_ search.Ranker        = (*RecordFieldResolver)(nil)
+)
 
 // RecordFieldResolver defines a custom search resolver struct for
 // managing Record model search fields.
@@ -55,6 +58,9 @@ type RecordFieldResolver struct {
 	staticRequestInfo map[string]any
 	allowedFields     []string
 	joins             []*search.Join
+	fullTextJoins     []*search.Join
+	vectorJoins       []*vectorDistanceJoin
+	vectorScan        bool // set while the vector distance candidates are scanned
 	allowHiddenFields bool
 	// ---
 	listRuleJoins       []ruleJoin
@@ -150,6 +156,15 @@ func (r *RecordFieldResolver) UpdateQuery(query *dbx.SelectQuery) error {
 		}
 	}
 
+	// a record has at most one full-text index row so,
+	// unlike the joins above, these need no deduplication
+	for _, join := range r.fullTextJoins {
+		query.LeftJoin(
+			(join.TableName + " " + join.TableAlias),
+			join.Condition(),
+		)
+	}
+
 	// note: for now the joins are not applied for multi-match conditions to avoid excessive checks
 	if len(r.listRuleJoins) > 0 {
 		for _, join := range r.listRuleJoins {
@@ -160,6 +175,14 @@ func (r *RecordFieldResolver) UpdateQuery(query *dbx.SelectQuery) error {
 		}
 	}
 
+	// last, since the distances are looked up among the rows
+	// that everything above selects (one per record, as the full-text ones)
+	if len(r.vectorJoins) > 0 {
+		if err := r.joinVectorDistances(query); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -170,6 +193,8 @@ func (r *RecordFieldResolver) updateQueryWithCollectionListRule(c *Collection, t
 
 	cloneR := *r
 	cloneR.joins = []*search.Join{}
+	cloneR.fullTextJoins = nil
+	cloneR.vectorJoins = nil
 	cloneR.baseCollection = c
 	cloneR.baseCollectionAlias = tableAlias
 	cloneR.allowHiddenFields = true
@@ -403,11 +428,29 @@ func (r *RecordFieldResolver) loadCollection(collectionNameOrId string) (*Collec
 	return getCollectionByModelOrIdentifier(r.app, collectionNameOrId)
 }
 
+// liveJoinCondition returns on extended to leave out the trashed rows of
+// tableName when it is a collection with the "softDelete" option, so that
+// a trashed record is as missing to a join as a purged one.
+func (r *RecordFieldResolver) liveJoinCondition(tableName string, tableAlias string, on dbx.Expression) dbx.Expression {
+	// ignore non-collections (see registerJoin)
+	c, _ := r.loadCollection(tableName)
+	if c == nil || !c.SoftDelete {
+		return on
+	}
+
+	live := dbx.NewExp(fmt.Sprintf("[[%s.%s]] = ''", tableAlias, FieldNameDeleted))
+	if on == nil {
+		return live
+	}
+
+	return dbx.And(on, live)
+}
+
 func (r *RecordFieldResolver) registerJoin(tableName string, tableAlias string, on dbx.Expression) error {
 	newJoin := &search.Join{
 		TableName:  tableName,
 		TableAlias: tableAlias,
-		On:         on,
+		On:         r.liveJoinCondition(tableName, tableAlias, on),
 	}
 
 	// (see updateQueryWithCollectionListRule)
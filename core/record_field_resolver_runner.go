@@ -189,6 +189,7 @@ func (r *runner) processCollectionField() (*search.ResolverResult, error) {
 	r.multiMatch.Joins = append(r.multiMatch.Joins, &search.Join{
 		TableName:  inflector.Columnify(collection.Name),
 		TableAlias: r.multiMatchActiveTableAlias,
+		On:         r.resolver.liveJoinCondition(collection.Name, r.multiMatchActiveTableAlias, nil),
 	})
 
 	// leave only the collection fields
@@ -620,7 +621,12 @@ func (r *runner) processActiveProps() (*search.ResolverResult, error) {
 					&search.Join{
 						TableName:  newCollectionName,
 						TableAlias: newTableAlias2,
-						On:         dbx.NewExp(fmt.Sprintf("[[%s.%s]] = [[%s.id]]", newTableAlias2, cleanBackFieldName, r.multiMatchActiveTableAlias)),
+						On: r.resolver.liveJoinCondition(newCollectionName, newTableAlias2, dbx.NewExp(fmt.Sprintf(
+							"[[%s.%s]] = [[%s.id]]",
+							newTableAlias2,
+							cleanBackFieldName,
+							r.multiMatchActiveTableAlias,
+						))),
 					},
 				)
 			} else {
@@ -630,13 +636,13 @@ func (r *runner) processActiveProps() (*search.ResolverResult, error) {
 					&search.Join{
 						TableName:  newCollectionName,
 						TableAlias: newTableAlias2,
-						On: dbx.NewExp(fmt.Sprintf(
+						On: r.resolver.liveJoinCondition(newCollectionName, newTableAlias2, dbx.NewExp(fmt.Sprintf(
 							"[[%s.id]] IN (SELECT [[%s.value]] FROM %s {{%s}})",
 							r.multiMatchActiveTableAlias,
 							jeAlias2,
 							dbutils.JSONEach(r.resolver.app.Dialect(), newTableAlias2+"."+cleanBackFieldName),
 							jeAlias2,
-						)),
+						))),
 					},
 				)
 			}
@@ -724,7 +730,7 @@ func (r *runner) processActiveProps() (*search.ResolverResult, error) {
 				&search.Join{
 					TableName:  inflector.Columnify(newCollectionName),
 					TableAlias: newTableAlias2,
-					On:         dbx.NewExp(fmt.Sprintf("[[%s.id]] = [[%s]]", newTableAlias2, prefixedFieldName2)),
+					On:         r.resolver.liveJoinCondition(newCollectionName, newTableAlias2, dbx.NewExp(fmt.Sprintf("[[%s.id]] = [[%s]]", newTableAlias2, prefixedFieldName2))),
 				},
 			)
 		} else {
@@ -738,7 +744,7 @@ func (r *runner) processActiveProps() (*search.ResolverResult, error) {
 				&search.Join{
 					TableName:  inflector.Columnify(newCollectionName),
 					TableAlias: newTableAlias2,
-					On:         dbx.NewExp(fmt.Sprintf("[[%s.id]] = [[%s.value]]", newTableAlias2, jeAlias2)),
+					On:         r.resolver.liveJoinCondition(newCollectionName, newTableAlias2, dbx.NewExp(fmt.Sprintf("[[%s.id]] = [[%s.value]]", newTableAlias2, jeAlias2))),
 				},
 			)
 		}
@@ -847,6 +853,26 @@ func (r *runner) finalizeActivePropsProcessing(collection *Collection, prop stri
 		}
 	}
 
+	// the full-text matches and the vector distances are joined on the base
+	// table, so they are available only for the fields of the searched collection
+	// (not through relations or aliases)
+	isBaseField := modifier == "" &&
+		r.resolver.baseCollectionAlias == "" &&
+		collection.Id == r.resolver.baseCollection.Id &&
+		r.activeTableAlias == inflector.Columnify(collection.Name)
+
+	if fts, ok := field.(FullTextSearcher); ok && fts.IsSearchable() && isBaseField {
+		result.FullText = func(query *search.ResolverResult) (*search.ResolverResult, error) {
+			return r.resolver.resolveFullText(field, query)
+		}
+	}
+
+	if vf, ok := field.(*VectorField); ok && isBaseField {
+		result.VectorDistance = func(query *search.ResolverResult) (*search.ResolverResult, error) {
+			return r.resolver.resolveVectorDistance(vf, query)
+		}
+	}
+
 	// wrap in json_extract to ensure that top-level primitives
 	// stored as json work correctly when compared to their SQL equivalent
 	// (https://github.com/hanzoai/base/issues/4068)
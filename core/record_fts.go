@@ -0,0 +1,395 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hanzoai/base/tools/inflector"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/security"
+	"github.com/hanzoai/dbx"
+	"github.com/hanzoai/orm/dialect"
+)
+
+// The searchable fields of a collection are indexed in a shadow table next to
+// its records table: an FTS5 virtual table on SQLite, and a table of tsvector
+// columns with GIN indexes elsewhere (that is, on Postgres).
+//
+// The shadow table has the record id and one column per searchable field,
+// named by the field position ("f0", "f1", ...) rather than by its name,
+// since a field name could be anything FTS5 reserves (eg. "rank"). The table
+// itself is named by the collection id, so renaming a collection or a field
+// leaves the index as it is and only adding, removing or reordering
+// searchable fields rebuilds it.
+//
+// The index is written in the same transaction as the record, from the
+// record save and delete execute hooks, so it never lists a record that
+// isn't there or misses one that is.
+
+// fullTextBatchSize is how many records are read at once when rebuilding an index.
+const fullTextBatchSize = 1000
+
+// fullTextConfig is the Postgres text search configuration the documents and
+// the queries are parsed with. "simple" only lowercases, which is closest to
+// what the FTS5 unicode61 tokenizer does.
+const fullTextConfig = "'simple'"
+
+var htmlTagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// fullTextTableName returns the name of the collection's full-text index table.
+func fullTextTableName(collection *Collection) string {
+	return "_fts_" + inflector.Columnify(collection.Id)
+}
+
+// fullTextColumn returns the index column of the i-th searchable field.
+func fullTextColumn(i int) string {
+	return "f" + strconv.Itoa(i)
+}
+
+// searchableFields returns the collection fields indexed for full-text search, in order.
+func searchableFields(collection *Collection) []Field {
+	if collection == nil || collection.IsView() {
+		return nil
+	}
+
+	var result []Field
+	for _, field := range collection.Fields {
+		if f, ok := field.(FullTextSearcher); ok && f.IsSearchable() {
+			result = append(result, field)
+		}
+	}
+
+	return result
+}
+
+// syncFullTextTable creates, rebuilds or drops the full-text index of
+// newCollection to match its searchable fields.
+//
+// NB! This method is expected to be called from inside of a transaction
+// and after the record table changes are applied.
+func syncFullTextTable(app App, newCollection *Collection, oldCollection *Collection) error {
+	if newCollection.IsView() {
+		return nil
+	}
+
+	tableName := fullTextTableName(newCollection)
+
+	fields := searchableFields(newCollection)
+	oldFields := searchableFields(oldCollection)
+
+	if len(fields) == 0 && len(oldFields) == 0 {
+		return nil // nothing is or was indexed
+	}
+
+	if len(oldFields) > 0 && app.HasTable(tableName) {
+		sameFields := slices.EqualFunc(oldFields, fields, func(a, b Field) bool {
+			return a.GetId() == b.GetId() && a.Type() == b.Type()
+		})
+		if sameFields {
+			return nil // the index is up to date
+		}
+	}
+
+	if err := app.DeleteTable(tableName); err != nil {
+		return err
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if err := createFullTextTable(app, tableName, len(fields)); err != nil {
+		return fmt.Errorf("failed to create the full-text index of %s: %w", newCollection.Name, err)
+	}
+
+	if err := rebuildFullTextTable(app, newCollection); err != nil {
+		return fmt.Errorf("failed to rebuild the full-text index of %s: %w", newCollection.Name, err)
+	}
+
+	return nil
+}
+
+func createFullTextTable(app App, tableName string, totalFields int) error {
+	if _, ok := app.Dialect().(dialect.SQLite); ok {
+		// note: the column names are plain words and are left unquoted
+		// because the FTS5 arguments are not regular column definitions
+		cols := make([]string, 0, totalFields+2)
+		cols = append(cols, "id UNINDEXED")
+		for i := range totalFields {
+			cols = append(cols, fullTextColumn(i))
+		}
+		cols = append(cols, "tokenize = 'unicode61 remove_diacritics 2'")
+
+		_, err := app.DB().NewQuery(fmt.Sprintf(
+			"CREATE VIRTUAL TABLE {{%s}} USING fts5(%s)",
+			tableName,
+			strings.Join(cols, ", "),
+		)).Execute()
+
+		return err
+	}
+
+	cols := make(map[string]string, totalFields+1)
+	cols["id"] = "TEXT PRIMARY KEY NOT NULL"
+	for i := range totalFields {
+		cols[fullTextColumn(i)] = "TSVECTOR"
+	}
+
+	if _, err := app.DB().CreateTable(tableName, cols).Execute(); err != nil {
+		return err
+	}
+
+	for i := range totalFields {
+		_, err := app.DB().NewQuery(fmt.Sprintf(
+			"CREATE INDEX [[idx_%s_%s]] ON {{%s}} USING GIN ([[%s]])",
+			tableName,
+			fullTextColumn(i),
+			tableName,
+			fullTextColumn(i),
+		)).Execute()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebuildFullTextTable indexes all existing records of the collection.
+func rebuildFullTextTable(app App, collection *Collection) error {
+	fields := searchableFields(collection)
+
+	idColumn := inflector.Columnify(collection.Name) + ".id"
+
+	var lastId string
+	for {
+		records := make([]*Record, 0, fullTextBatchSize)
+
+		err := app.RecordQuery(collection).
+			AndWhere(dbx.NewExp("[["+idColumn+"]] > {:lastId}", dbx.Params{"lastId": lastId})).
+			OrderBy("[[" + idColumn + "]] ASC").
+			Limit(fullTextBatchSize).
+			All(&records)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err := insertFullTextRow(app, collection, fields, record); err != nil {
+				return err
+			}
+		}
+
+		if len(records) < fullTextBatchSize {
+			return nil
+		}
+
+		lastId = records[len(records)-1].Id
+	}
+}
+
+// indexRecordFullText replaces the record row in its collection's
+// full-text index (if the collection has one).
+//
+// oldId is the id the record was last saved with (empty for new records).
+func indexRecordFullText(app App, record *Record, oldId string) error {
+	collection := record.Collection()
+
+	fields := searchableFields(collection)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if oldId != "" {
+		if err := unindexRecordFullText(app, collection, oldId); err != nil {
+			return err
+		}
+	}
+
+	return insertFullTextRow(app, collection, fields, record)
+}
+
+// unindexRecordFullText removes the record with the specified id
+// from its collection's full-text index (if the collection has one).
+func unindexRecordFullText(app App, collection *Collection, id string) error {
+	if len(searchableFields(collection)) == 0 {
+		return nil
+	}
+
+	_, err := app.NonconcurrentDB().Delete(fullTextTableName(collection), dbx.HashExp{"id": id}).Execute()
+
+	return err
+}
+
+func insertFullTextRow(app App, collection *Collection, fields []Field, record *Record) error {
+	_, isSQLite := app.Dialect().(dialect.SQLite)
+
+	cols := make([]string, 0, len(fields)+1)
+	values := make([]string, 0, len(fields)+1)
+	params := make(dbx.Params, len(fields)+1)
+
+	cols = append(cols, "[[id]]")
+	values = append(values, "{:id}")
+	params["id"] = record.Id
+
+	for i, field := range fields {
+		col := fullTextColumn(i)
+
+		text := record.GetString(field.GetName())
+		if field.Type() == FieldTypeEditor {
+			text = plainText(text)
+		}
+
+		cols = append(cols, "[["+col+"]]")
+		params[col] = text
+		if isSQLite {
+			values = append(values, "{:"+col+"}")
+		} else {
+			values = append(values, "to_tsvector("+fullTextConfig+", {:"+col+"})")
+		}
+	}
+
+	_, err := app.NonconcurrentDB().NewQuery(fmt.Sprintf(
+		"INSERT INTO {{%s}} (%s) VALUES (%s)",
+		fullTextTableName(collection),
+		strings.Join(cols, ", "),
+		strings.Join(values, ", "),
+	)).Bind(params).Execute()
+
+	return err
+}
+
+// plainText strips the markup of an editor field value.
+func plainText(str string) string {
+	return html.UnescapeString(htmlTagRegex.ReplaceAllString(str, " "))
+}
+
+// fullTextQuery converts a plain text search query into an FTS5 query
+// matching the records whose column contains every word of it.
+//
+// Each word is quoted as a phrase so that the query syntax characters in it
+// (eg. "*", "-", "NEAR") are matched as text rather than interpreted.
+//
+// It returns an empty string if the text has no words.
+func fullTextQuery(column string, text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		if !strings.ContainsFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) {
+			continue // nothing that the tokenizer would index
+		}
+		terms = append(terms, column+` : "`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(terms, " AND ")
+}
+
+// boundText returns the text of a resolved search query
+// (a NULL identifier, eg. a missing @request.query.* field, is an empty query).
+func boundText(query *search.ResolverResult) (string, bool) {
+	if strings.EqualFold(query.Identifier, "NULL") {
+		return "", true
+	}
+
+	for key, value := range query.Params {
+		if query.Identifier != "{:"+key+"}" {
+			continue
+		}
+
+		text, ok := value.(string)
+		return text, ok
+	}
+
+	return "", false
+}
+
+// resolveFullText resolves fts(field, query) for a searchable field of the
+// resolver's base collection.
+//
+// The matching index rows are left joined with their rank, which makes the
+// function a check of whether the join found one and leaves the rank to be
+// sorted by (see [RecordFieldResolver.Rank]).
+func (r *RecordFieldResolver) resolveFullText(field Field, query *search.ResolverResult) (*search.ResolverResult, error) {
+	text, ok := boundText(query)
+	if !ok {
+		return nil, errors.New("expects the query to be a string")
+	}
+
+	fields := searchableFields(r.baseCollection)
+
+	index := slices.IndexFunc(fields, func(f Field) bool { return f.GetId() == field.GetId() })
+	if index < 0 {
+		return nil, fmt.Errorf("%q is not indexed for full-text search", field.GetName())
+	}
+
+	d := r.app.Dialect()
+
+	tableName := fullTextTableName(r.baseCollection)
+	column := fullTextColumn(index)
+	placeholder := "fts" + security.PseudorandomString(8)
+
+	var subquery string
+	var value string
+	if _, ok := d.(dialect.SQLite); ok {
+		value = fullTextQuery(column, text)
+		subquery = fmt.Sprintf(
+			"(SELECT [[id]], -bm25({{%s}}) AS [[rank]] FROM {{%s}} WHERE {{%s}} MATCH {:%s})",
+			tableName, tableName, tableName, placeholder,
+		)
+	} else {
+		value = strings.TrimSpace(text)
+		tsquery := "plainto_tsquery(" + fullTextConfig + ", {:" + placeholder + "})"
+		subquery = fmt.Sprintf(
+			"(SELECT [[id]], ts_rank([[%s]], %s) AS [[rank]] FROM {{%s}} WHERE [[%s]] @@ %s)",
+			column, tsquery, tableName, column, tsquery,
+		)
+	}
+
+	// an empty query matches nothing
+	if value == "" {
+		return &search.ResolverResult{
+			Identifier:   d.Bool(false),
+			NullFallback: search.NullFallbackDisabled,
+		}, nil
+	}
+
+	alias := "__fts" + strconv.Itoa(len(r.fullTextJoins)) + "_" + inflector.Columnify(field.GetName())
+
+	// note: the query param is bound with the join condition
+	// because the join table expression can't have params of its own
+	r.fullTextJoins = append(r.fullTextJoins, &search.Join{
+		TableName:  subquery,
+		TableAlias: alias,
+		On: dbx.NewExp(
+			fmt.Sprintf("[[%s.id]] = [[%s.id]]", alias, inflector.Columnify(r.baseCollection.Name)),
+			dbx.Params{placeholder: value},
+		),
+	})
+
+	return &search.ResolverResult{
+		Identifier:   "([[" + alias + ".id]] IS NOT NULL)",
+		NullFallback: search.NullFallbackDisabled,
+	}, nil
+}
+
+// Rank implements [search.Ranker].
+//
+// It is the sum of the ranks of the fts() matches of the resolved
+// filters and rules, 0 for the ones that a record didn't match.
+func (r *RecordFieldResolver) Rank() (string, error) {
+	if len(r.fullTextJoins) == 0 {
+		return "", errors.New("no fts() filter to rank by")
+	}
+
+	ranks := make([]string, len(r.fullTextJoins))
+	for i, join := range r.fullTextJoins {
+		ranks[i] = "COALESCE([[" + join.TableAlias + ".rank]], 0)"
+	}
+
+	return strings.Join(ranks, " + "), nil
+}
@@ -0,0 +1,186 @@
+package core_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/types"
+)
+
+func TestRecordFullTextSearch(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("fts_test")
+	collection.ListRule = types.Pointer("")
+	collection.Fields.Add(
+		&core.TextField{Name: "title", Searchable: true},
+		&core.EditorField{Name: "body", Searchable: true},
+		&core.TextField{Name: "other"},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	newRecord := func(title, body, other string) *core.Record {
+		record := core.NewRecord(collection)
+		record.Set("title", title)
+		record.Set("body", body)
+		record.Set("other", other)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	a := newRecord("The quick brown fox", "<p>jumps over</p>", "")
+	b := newRecord("quick quick", "<p>lazy &amp; dog</p>", "")
+	newRecord("nothing", "", "quick")
+
+	find := func(filter string, sort string) (string, error) {
+		records := []*core.Record{}
+
+		provider := search.NewProvider(core.NewRecordFieldResolver(app, collection, nil, false)).
+			Query(app.RecordQuery(collection)).
+			Filter([]search.FilterData{search.FilterData(filter)})
+		if sort != "" {
+			provider.Sort(search.ParseSortFromString(sort))
+		} else {
+			provider.Sort([]search.SortField{{Name: "title", Direction: search.SortAsc}})
+		}
+
+		if _, err := provider.Exec(&records); err != nil {
+			return "", err
+		}
+
+		titles := make([]string, len(records))
+		for i, r := range records {
+			titles[i] = r.GetString("title")
+		}
+
+		return strings.Join(titles, "|"), nil
+	}
+
+	scenarios := []struct {
+		name        string
+		filter      string
+		sort        string
+		expected    string
+		expectError bool
+	}{
+		{"single word", "fts(title, 'quick') = true", "", "The quick brown fox|quick quick", false},
+		{"case insensitive", "fts(title, 'QUICK Fox') = true", "", "The quick brown fox", false},
+		{"every word", "fts(title, 'quick dog') = true", "", "", false},
+		{"negated", "fts(title, 'quick') = false", "", "nothing", false},
+		{"empty query", "fts(title, ' ') = true", "", "", false},
+		{"query syntax is matched as text", "fts(title, 'quick*') = true || fts(title, 'NOT') = true", "", "The quick brown fox|quick quick", false},
+		{"editor markup is not indexed", "fts(body, 'p') = true", "", "", false},
+		{"editor entities are decoded", "fts(body, 'lazy &') = true", "", "quick quick", false},
+		{"combined with other filters", "fts(title, 'quick') = true && fts(body, 'jumps') = true", "", "The quick brown fox", false},
+		{"ranked", "fts(title, 'quick') = true", "-@rank", "quick quick|The quick brown fox", false},
+		{"ranked with another sort", "fts(title, 'quick') = true", "-@rank,title", "quick quick|The quick brown fox", false},
+		{"rank without fts", "title != ''", "-@rank", "", true},
+		{"non-searchable field", "fts(other, 'quick') = true", "", "", true},
+		{"missing field", "fts(missing, 'quick') = true", "", "", true},
+		{"non-identifier field", "fts('title', 'quick') = true", "", "", true},
+		{"column query", "fts(title, other) = true", "", "", true},
+		{"invalid number of arguments", "fts(title) = true", "", "", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result, err := find(s.filter, s.sort)
+
+			hasErr := err != nil
+			if hasErr != s.expectError {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if result != s.expected {
+				t.Fatalf("Expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+
+	t.Run("update and delete", func(t *testing.T) {
+		b.Set("title", "slow")
+		if err := app.Save(b); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := app.Delete(a); err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := find("fts(title, 'quick') = true || fts(title, 'slow') = true", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != "slow" {
+			t.Fatalf("Expected only the updated record, got %q", result)
+		}
+	})
+
+	t.Run("schema changes", func(t *testing.T) {
+		// renaming keeps the index
+		collection.Fields.GetByName("title").SetName("heading")
+		if err := app.Save(collection); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := app.FindRecordsByFilter(collection, "fts(heading, 'slow') = true", "", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record after the rename, got %d", len(records))
+		}
+
+		// enabling another field rebuilds the index from the existing records
+		collection.Fields.GetByName("other").(*core.TextField).Searchable = true
+		collection.Fields.GetByName("heading").(*core.TextField).Searchable = false
+		if err := app.Save(collection); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err = app.FindRecordsByFilter(collection, "fts(other, 'quick') = true", "", 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("Expected 1 record matched by the newly indexed field, got %d", len(records))
+		}
+
+		if _, err := app.FindRecordsByFilter(collection, "fts(heading, 'slow') = true", "", 0, 0); err == nil {
+			t.Fatal("Expected the no longer indexed field to fail")
+		}
+
+		// disabling every searchable field drops the index
+		tableName := "_fts_" + collection.Id
+		if !app.HasTable(tableName) {
+			t.Fatalf("Expected %s to exist", tableName)
+		}
+		collection.Fields.GetByName("other").(*core.TextField).Searchable = false
+		collection.Fields.GetByName("body").(*core.EditorField).Searchable = false
+		if err := app.Save(collection); err != nil {
+			t.Fatal(err)
+		}
+		if app.HasTable(tableName) {
+			t.Fatalf("Expected %s to be dropped", tableName)
+		}
+
+		tables, err := app.TableColumns(collection.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(tables, "heading") {
+			t.Fatalf("Expected the records table to be intact, got %v", tables)
+		}
+	})
+}
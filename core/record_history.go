@@ -0,0 +1,223 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hanzoai/base/tools/inflector"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The revision history of a base collection with the "history" option.
+//
+// Every update and delete of one of its records keeps the version it replaced
+// in a history table next to the records table, together with who replaced it
+// and when. The table is named by the collection id, like the full-text index,
+// so renaming the collection keeps its history.
+//
+// The revision is written in the transaction of the write, from the record
+// save and delete execute hooks, for the same reason the outbox is: a write
+// that commits always leaves its revision, and one that rolls back never
+// does. An after-success hook could lose one to a crash.
+//
+// A revision holds the fields as the record stored them, as a JSON object
+// keyed by field name, so a field added or removed since is read back the way
+// the outbox reads a change (see [RecordChange.BeforeRecord]).
+//
+// Turning the option off stops new revisions and keeps the table, so turning
+// it back on resumes the same history. It is dropped with the collection.
+
+// RecordRevision is one earlier version of a record, as its history keeps it.
+type RecordRevision struct {
+	Id       string `db:"id" json:"id"`
+	RecordId string `db:"recordId" json:"recordId"`
+
+	// Rev numbers the revisions of a record from 1, in the order they were written.
+	Rev int `db:"rev" json:"rev"`
+
+	// Action is the write that replaced this version: an update or a delete.
+	Action string `db:"action" json:"action"`
+
+	// Data is the record fields as they were.
+	Data types.JSONRaw `db:"data" json:"data"`
+
+	// Actor and ActorCollection name the auth record that made the write,
+	// and are empty when it was not made on behalf of one.
+	Actor           string `db:"actor" json:"actor"`
+	ActorCollection string `db:"actorCollection" json:"actorCollection"`
+
+	// Created is when the version was replaced.
+	Created types.DateTime `db:"created" json:"created"`
+}
+
+// Record loads the version into a record of collection.
+func (r *RecordRevision) Record(collection *Collection) (*Record, error) {
+	return loadRecordChangeState(collection, r.Data)
+}
+
+type recordActorKey struct{}
+
+// WithRecordActor returns a copy of ctx that names auth as the one on whose
+// behalf the writes saved or deleted with it are made (eg. with
+// [App.SaveWithContext]), for the revisions they leave.
+func WithRecordActor(ctx context.Context, auth *Record) context.Context {
+	if auth == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, recordActorKey{}, auth)
+}
+
+// recordActor returns the auth record set with [WithRecordActor], if any.
+func recordActor(ctx context.Context) *Record {
+	if ctx == nil {
+		return nil
+	}
+
+	auth, _ := ctx.Value(recordActorKey{}).(*Record)
+
+	return auth
+}
+
+// recordHistoryTableName returns the name of the collection's history table.
+func recordHistoryTableName(collection *Collection) string {
+	return "_history_" + inflector.Columnify(collection.Id)
+}
+
+// recordHistoryEnabled reports whether the writes of collection records
+// leave revisions, which they always do in a drafts collection, for its
+// publishes.
+func recordHistoryEnabled(collection *Collection) bool {
+	return collection != nil && collection.IsBase() && !collection.System && (collection.History || collection.Drafts)
+}
+
+// syncRecordHistoryTable creates the history table of newCollection, if its
+// history is on and the table isn't there yet.
+//
+// NB! This method is expected to be called from inside of a transaction.
+func syncRecordHistoryTable(app App, newCollection *Collection) error {
+	if !recordHistoryEnabled(newCollection) {
+		return nil
+	}
+
+	tableName := recordHistoryTableName(newCollection)
+	if app.HasTable(tableName) {
+		return nil
+	}
+
+	_, err := app.DB().CreateTable(tableName, map[string]string{
+		"id":              "TEXT PRIMARY KEY NOT NULL",
+		"recordId":        "TEXT NOT NULL",
+		"rev":             "INTEGER NOT NULL",
+		"action":          "TEXT NOT NULL",
+		"data":            app.Dialect().Json() + " NOT NULL",
+		"actor":           "TEXT DEFAULT '' NOT NULL",
+		"actorCollection": "TEXT DEFAULT '' NOT NULL",
+		"created":         "TEXT DEFAULT '' NOT NULL",
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("failed to create the history of %s: %w", newCollection.Name, err)
+	}
+
+	_, err = app.DB().NewQuery(fmt.Sprintf(
+		"CREATE UNIQUE INDEX [[idx_%s_rev]] ON {{%s}} ([[recordId]], [[rev]])",
+		tableName,
+		tableName,
+	)).Execute()
+
+	return err
+}
+
+// writeRecordRevision keeps before, the version a write of action replaced,
+// in the history of its collection.
+//
+// NB! It is expected to run in the transaction that made the write.
+func writeRecordRevision(app App, ctx context.Context, action string, before *Record) error {
+	if before == nil || !recordHistoryEnabled(before.Collection()) {
+		return nil
+	}
+
+	data, err := json.Marshal(before.FieldsData())
+	if err != nil {
+		return err
+	}
+
+	tableName := recordHistoryTableName(before.Collection())
+
+	db := app.NonconcurrentDB()
+
+	var rev int
+	err = db.Select("COALESCE(MAX([[rev]]), 0) + 1").
+		From(tableName).
+		Where(dbx.HashExp{"recordId": before.Id}).
+		Row(&rev)
+	if err != nil {
+		return err
+	}
+
+	var actor, actorCollection string
+	if auth := recordActor(ctx); auth != nil {
+		actor = auth.Id
+		actorCollection = auth.Collection().Id
+	}
+
+	_, err = db.Insert(tableName, dbx.Params{
+		"id":              GenerateDefaultRandomId(),
+		"recordId":        before.Id,
+		"rev":             rev,
+		"action":          action,
+		"data":            string(data),
+		"actor":           actor,
+		"actorCollection": actorCollection,
+		"created":         types.NowDateTime().String(),
+	}).Execute()
+
+	return err
+}
+
+// FindRecordRevisions returns the revisions of the collection record with
+// the given id, newest first.
+func FindRecordRevisions(app App, collection *Collection, recordId string) ([]*RecordRevision, error) {
+	if !collection.IsBase() || !app.HasTable(recordHistoryTableName(collection)) {
+		return []*RecordRevision{}, nil
+	}
+
+	revisions := []*RecordRevision{}
+
+	err := app.ConcurrentDB().
+		Select("*").
+		From(recordHistoryTableName(collection)).
+		Where(dbx.HashExp{"recordId": recordId}).
+		OrderBy("rev DESC").
+		All(&revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// FindRecordRevision returns the revision rev of the collection record with
+// the given id.
+func FindRecordRevision(app App, collection *Collection, recordId string, rev int) (*RecordRevision, error) {
+	if !collection.IsBase() || !app.HasTable(recordHistoryTableName(collection)) {
+		return nil, errors.New("the collection has no history")
+	}
+
+	revision := &RecordRevision{}
+
+	err := app.ConcurrentDB().
+		Select("*").
+		From(recordHistoryTableName(collection)).
+		Where(dbx.HashExp{"recordId": recordId, "rev": rev}).
+		Limit(1).
+		One(revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
@@ -0,0 +1,142 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+)
+
+func TestRecordHistory(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no history yet
+	record := core.NewRecord(collection)
+	record.Set("title", "before_history")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	collection.History = true
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	superuser, err := app.FindAuthRecordByEmail(core.CollectionNameSuperusers, "test@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := core.WithRecordActor(context.Background(), superuser)
+
+	record.Set("title", "history1")
+	if err := app.SaveWithContext(ctx, record); err != nil {
+		t.Fatal(err)
+	}
+
+	// rolled back, so never kept
+	err = app.RunInTransaction(func(txApp core.App) error {
+		record.Set("title", "rolled back")
+		if err := txApp.Save(record); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("Expected the transaction to fail")
+	}
+
+	record.Set("title", "history2")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Delete(record); err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := core.FindRecordRevisions(app, collection, record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		rev    int
+		action string
+		title  string
+		actor  string
+	}{
+		{3, core.RecordChangeDelete, "history2", ""},
+		{2, core.RecordChangeUpdate, "history1", ""},
+		{1, core.RecordChangeUpdate, "before_history", superuser.Id},
+	}
+
+	if len(revisions) != len(expected) {
+		t.Fatalf("Expected %d revisions, got %d", len(expected), len(revisions))
+	}
+
+	for i, e := range expected {
+		revision := revisions[i]
+
+		if revision.Rev != e.rev || revision.Action != e.action || revision.Actor != e.actor {
+			t.Fatalf("[%d] Expected rev %d %s by %q, got rev %d %s by %q", i, e.rev, e.action, e.actor, revision.Rev, revision.Action, revision.Actor)
+		}
+
+		version, err := revision.Record(collection)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version.GetString("title") != e.title {
+			t.Fatalf("[%d] Expected title %q, got %q", i, e.title, version.GetString("title"))
+		}
+	}
+
+	if revisions[2].ActorCollection != superuser.Collection().Id {
+		t.Fatalf("Expected the actor collection %q, got %q", superuser.Collection().Id, revisions[2].ActorCollection)
+	}
+
+	revision, err := core.FindRecordRevision(app, collection, record.Id, 2)
+	if err != nil || revision.Rev != 2 {
+		t.Fatalf("Expected to find rev 2, got %v (%v)", revision, err)
+	}
+}
+
+func TestRecordHistoryOff(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record.Set("title", "no_history")
+	if err := app.Save(record); err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := core.FindRecordRevisions(app, collection, record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 0 {
+		t.Fatalf("Expected no revisions, got %d", len(revisions))
+	}
+}
@@ -1504,8 +1504,15 @@ func onRecordSaveExecute(e *RecordEvent) error {
 		}
 	}
 
-	err := e.Next()
+	oldId := cast.ToString(e.Record.LastSavedPK())
+
+	err := saveRecordInTransaction(e, oldId)
 	if err == nil {
+		// the vector indexes are in the aux db and are only approximate,
+		// so failing to update them doesn't fail the already saved record
+		if err := indexRecordVectors(e.App, e.Record, oldId); err != nil {
+			e.App.Logger().Warn("Failed to update the record vector indexes", "id", e.Record.Id, "error", err.Error())
+		}
 		return nil
 	}
 
@@ -1516,6 +1523,65 @@ func onRecordSaveExecute(e *RecordEvent) error {
 	)
 }
 
+// saveRecordInTransaction continues the record save execution and, in the
+// same transaction, records the change in the outbox, keeps the replaced
+// version if the record collection has history and, if it has searchable
+// fields, updates its full-text index.
+//
+// oldId is the id the record was last saved with (empty for new records).
+func saveRecordInTransaction(e *RecordEvent, oldId string) error {
+	action := RecordChangeCreate
+	var before *Record
+	if !e.Record.IsNew() {
+		action = RecordChangeUpdate
+		before = lastSavedRecord(e.App, e.Record, oldId)
+	}
+
+	originalApp := e.App
+	txErr := e.App.RunInTransaction(func(txApp App) error {
+		e.App = txApp
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if len(searchableFields(e.Record.Collection())) > 0 {
+			if err := indexRecordFullText(txApp, e.Record, oldId); err != nil {
+				return err
+			}
+		}
+
+		if err := writeRecordRevision(txApp, e.Context, action, before); err != nil {
+			return err
+		}
+
+		return writeRecordChange(txApp, action, before, e.Record)
+	})
+	e.App = originalApp
+
+	return txErr
+}
+
+// lastSavedRecord returns record as the database holds it under id, for the
+// before state of its change.
+//
+// Original() is the record as it was loaded, which is no longer what is saved
+// once the same instance has been saved before, so the row is read back. The
+// read is outside of the write transaction, like the other selects here, and
+// Original() stands in when it fails.
+func lastSavedRecord(app App, record *Record, id string) *Record {
+	if record.Collection().System || record.Collection().IsView() {
+		return nil // not recorded anyway
+	}
+
+	saved, err := app.FindRecordById(record.Collection(), id)
+	if err != nil {
+		return record.Original()
+	}
+
+	return saved
+}
+
 func onRecordDeleteExecute(e *RecordEvent) error {
 	// fetch rel references (if any)
 	//
@@ -1526,6 +1592,8 @@ func onRecordDeleteExecute(e *RecordEvent) error {
 		return err
 	}
 
+	before := lastSavedRecord(e.App, e.Record, e.Record.Id)
+
 	originalApp := e.App
 	txErr := e.App.RunInTransaction(func(txApp App) error {
 		e.App = txApp
@@ -1536,10 +1604,33 @@ func onRecordDeleteExecute(e *RecordEvent) error {
 			return err
 		}
 
+		if err := unindexRecordFullText(txApp, e.Record.Collection(), e.Record.Id); err != nil {
+			return err
+		}
+
+		if err := writeRecordRevision(txApp, e.Context, RecordChangeDelete, before); err != nil {
+			return err
+		}
+
+		if err := deleteRecordDraft(txApp, e.Record.Collection(), e.Record.Id); err != nil {
+			return err
+		}
+
+		// before the cascade, so the changes it makes follow the one that made them
+		if err := writeRecordChange(txApp, RecordChangeDelete, before, nil); err != nil {
+			return err
+		}
+
 		return cascadeRecordDelete(txApp, e.Record, refs)
 	})
 	e.App = originalApp
 
+	if txErr == nil {
+		if err := unindexRecordVectors(e.App, e.Record.Collection(), e.Record.Id); err != nil {
+			e.App.Logger().Warn("Failed to update the record vector indexes", "id", e.Record.Id, "error", err.Error())
+		}
+	}
+
 	return txErr
 }
 
@@ -0,0 +1,9 @@
+package core
+
+// CollectionNameCrdtDocs is where a Base keeps the compacted state of each
+// collaborative document it serves. One row is one document.
+const CollectionNameCrdtDocs = "_crdt_docs"
+
+// CollectionNameCrdtOps is where a Base keeps the ops a collaborative document
+// accepted since it was last compacted, one row per accepted push.
+const CollectionNameCrdtOps = "_crdt_ops"
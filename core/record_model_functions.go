@@ -3,3 +3,33 @@ package core
 // CollectionNameFunctions is where a Base keeps the functions it runs. One row
 // is one function: its id is its name and its source is its body.
 const CollectionNameFunctions = "_functions"
+
+// CollectionNameFunctionInvocations is the log of the triggered function runs.
+// One row is one trigger firing for one function, and it stays after the last
+// attempt as the record of how it went.
+const CollectionNameFunctionInvocations = "_function_invocations"
+
+// The statuses of a [CollectionNameFunctionInvocations] row.
+const (
+	FunctionInvocationPending   = "pending"
+	FunctionInvocationSucceeded = "succeeded"
+	FunctionInvocationFailed    = "failed"
+)
+
+// The error classes of a [CollectionNameFunctionInvocations] row that did not
+// succeed.
+const (
+	// FunctionErrorTimeout is a run stopped at its time limit.
+	FunctionErrorTimeout = "timeout"
+
+	// FunctionErrorRefused is a run the host turned down on its caller's
+	// behalf, as over a rate limit.
+	FunctionErrorRefused = "refused"
+
+	// FunctionErrorFailed is a run that raised, or that could not be run.
+	FunctionErrorFailed = "failed"
+
+	// FunctionErrorTooLarge is a run that answered with more than an answer
+	// may be.
+	FunctionErrorTooLarge = "tooLarge"
+)
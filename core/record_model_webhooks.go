@@ -0,0 +1,18 @@
+package core
+
+// CollectionNameWebhooks is where a Base keeps its outgoing webhooks. One row
+// is one endpoint: the URL, the collections and actions it is sent, an
+// optional filter on the record, and the secret its deliveries are signed with.
+const CollectionNameWebhooks = "_webhooks"
+
+// CollectionNameWebhookDeliveries is the delivery log of the outgoing webhooks.
+// One row is one change on its way to one webhook, and it stays after the last
+// attempt as the record of how it went.
+const CollectionNameWebhookDeliveries = "_webhook_deliveries"
+
+// The statuses of a [CollectionNameWebhookDeliveries] row.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The trash of a base collection with the "softDelete" option.
+//
+// A delete through the record API doesn't remove the row: it sets the
+// tombstone, the "deleted" date field the option adds to the collection, and
+// the API hides the row from then on the way a rule would, everywhere a list
+// or a view rule is applied. The trash is read with ?trashed=only|with, by the
+// superusers or by whoever the collection's trash rule admits, and a trashed
+// record is restored by clearing its tombstone.
+//
+// Trashing is an update of the tombstone rather than a delete, so nothing a
+// delete does to the things around a record happens yet: its files stay in the
+// storage, the records relating to it keep the relation, and the cascades are
+// left for later. They all happen when the trashed record is purged, which is
+// an ordinary delete of it, after the collection's trash retention or when a
+// trashed record is deleted again.
+
+// DefaultTrashRetention is how many days a trashed record is kept when its
+// collection does not say.
+const DefaultTrashRetention = 30
+
+const maxTrashRetention = 3650
+
+// trashPurgeBatchSize is how many trashed records are read at once when purging.
+const trashPurgeBatchSize = 100
+
+// IsTrashed reports whether the record is in the trash of its soft delete collection.
+func (m *Record) IsTrashed() bool {
+	collection := m.Collection()
+	if collection == nil || !collection.SoftDelete {
+		return false
+	}
+
+	return !m.GetDateTime(FieldNameDeleted).IsZero()
+}
+
+// TrashRecord moves record to the trash of its soft delete collection.
+//
+// The tombstone is saved without the record validations, since a record that
+// stopped being valid after a schema change can still be deleted.
+func TrashRecord(ctx context.Context, app App, record *Record) error {
+	if !record.Collection().SoftDelete {
+		return fmt.Errorf("the %s collection has no trash", record.Collection().Name)
+	}
+
+	if record.IsTrashed() {
+		return nil
+	}
+
+	record.SetRaw(FieldNameDeleted, types.NowDateTime())
+
+	return app.SaveNoValidateWithContext(ctx, record)
+}
+
+// RestoreTrashedRecord takes record out of the trash of its collection.
+func RestoreTrashedRecord(ctx context.Context, app App, record *Record) error {
+	if !record.IsTrashed() {
+		return errors.New("the record is not trashed")
+	}
+
+	record.SetRaw(FieldNameDeleted, types.DateTime{})
+
+	return app.SaveNoValidateWithContext(ctx, record)
+}
+
+// PurgeTrashedRecords deletes the records trashed before the trash retention
+// of their collection, counting back from now.
+//
+// A record that fails to be deleted (eg. because a required relation still
+// references it) is left in the trash, passed over by the rest of the purge
+// and retried on the next one.
+func PurgeTrashedRecords(app App, now time.Time) error {
+	collections, err := app.FindAllCollections(CollectionTypeBase)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, collection := range collections {
+		if !collection.SoftDelete {
+			continue
+		}
+
+		retention := collection.TrashRetention
+		if retention <= 0 {
+			retention = DefaultTrashRetention
+		}
+
+		before, err := types.ParseDateTime(now.AddDate(0, 0, -retention))
+		if err != nil {
+			return err
+		}
+
+		// The batches are read past the last record of the one before, in
+		// (deleted, id) order, so the records that failed to be deleted are
+		// not read again and cannot fill a batch for good.
+		filter := FieldNameDeleted + " != '' && " + FieldNameDeleted + " < {:before}"
+		params := dbx.Params{"before": before.String()}
+
+		for {
+			records, err := app.FindRecordsByFilter(
+				collection,
+				filter,
+				FieldNameDeleted+",id",
+				trashPurgeBatchSize,
+				0,
+				params,
+			)
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+
+			for _, record := range records {
+				if err := app.Delete(record); err != nil {
+					errs = append(errs, fmt.Errorf("failed to purge %s record %s: %w", collection.Name, record.Id, err))
+				}
+			}
+
+			if len(records) < trashPurgeBatchSize {
+				break
+			}
+
+			last := records[len(records)-1]
+			filter = FieldNameDeleted + " < {:before} && (" +
+				FieldNameDeleted + " > {:lastDeleted} || (" + FieldNameDeleted + " = {:lastDeleted} && id > {:lastId}))"
+			params = dbx.Params{
+				"before":      before.String(),
+				"lastDeleted": last.GetDateTime(FieldNameDeleted).String(),
+				"lastId":      last.Id,
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
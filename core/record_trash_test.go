@@ -0,0 +1,279 @@
+package core_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+func TestRecordTrash(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := core.TrashRecord(context.Background(), app, record); err == nil {
+		t.Fatal("Expected a collection without soft delete to have no trash")
+	}
+
+	collection.SoftDelete = true
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	field, _ := collection.Fields.GetByName(core.FieldNameDeleted).(*core.DateField)
+	if field == nil || !field.System {
+		t.Fatalf("Expected a system %q date field, got %v", core.FieldNameDeleted, field)
+	}
+
+	record, err = app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.IsTrashed() {
+		t.Fatal("Expected the record not to be trashed")
+	}
+
+	if err := core.TrashRecord(context.Background(), app, record); err != nil {
+		t.Fatal(err)
+	}
+
+	// still there, with its tombstone
+	record, err = app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !record.IsTrashed() {
+		t.Fatal("Expected the record to be trashed")
+	}
+
+	if err := core.RestoreTrashedRecord(context.Background(), app, record); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err = app.FindRecordById(collection, "achvryl401bhse3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.IsTrashed() {
+		t.Fatal("Expected the record to be restored")
+	}
+
+	if err := core.RestoreTrashedRecord(context.Background(), app, record); err == nil {
+		t.Fatal("Expected a record that is not trashed to fail to be restored")
+	}
+}
+
+func TestSoftDeleteRefusesAnotherDeletedField(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("trash_clash")
+	collection.Fields.Add(&core.TextField{Name: core.FieldNameDeleted})
+	collection.SoftDelete = true
+
+	err := app.Save(collection)
+	if err == nil || !strings.Contains(err.Error(), "soft delete keeps the trash") {
+		t.Fatalf("Expected the deleted text field to be refused, got %v", err)
+	}
+
+	// kept as it was rather than replaced by the trash's
+	if _, ok := collection.Fields.GetByName(core.FieldNameDeleted).(*core.TextField); !ok {
+		t.Fatalf("Expected the deleted text field to be kept, got %v", collection.Fields.GetByName(core.FieldNameDeleted))
+	}
+}
+
+func TestPurgeTrashedRecords(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection.SoftDelete = true
+	collection.TrashRetention = 10
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	trash := func(id string, at time.Time) {
+		record, err := app.FindRecordById(collection, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deleted, err := types.ParseDateTime(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record.SetRaw(core.FieldNameDeleted, deleted)
+		if err := app.SaveNoValidate(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trash("llvuca81nly1qls", now.AddDate(0, 0, -11)) // past the retention
+	trash("achvryl401bhse3", now.AddDate(0, 0, -9))  // not yet
+
+	if err := core.PurgeTrashedRecords(app, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.FindRecordById(collection, "llvuca81nly1qls"); err == nil {
+		t.Fatal("Expected the record trashed past the retention to be purged")
+	}
+
+	for _, id := range []string{"achvryl401bhse3", "0yxhwia2amd8gec"} {
+		if _, err := app.FindRecordById(collection, id); err != nil {
+			t.Fatalf("Expected record %s to be kept, got %v", id, err)
+		}
+	}
+}
+
+func TestPurgeTrashedRecordsPassesOverFailures(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection, err := app.FindCollectionByNameOrId("demo2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collection.SoftDelete = true
+	collection.TrashRetention = 10
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+
+	// more stuck records than a purge batch, all trashed before the one
+	// that can go
+	stuck := map[string]bool{}
+	for i := 0; i < 150; i++ {
+		record := core.NewRecord(collection)
+		record.Set("title", "stuck"+strconv.Itoa(i))
+		record.SetRaw(core.FieldNameDeleted, types.NowDateTime().AddDate(0, 0, -20))
+		if err := app.SaveNoValidate(record); err != nil {
+			t.Fatal(err)
+		}
+		stuck[record.Id] = true
+	}
+
+	record, err := app.FindRecordById(collection, "llvuca81nly1qls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.SetRaw(core.FieldNameDeleted, types.NowDateTime().AddDate(0, 0, -11))
+	if err := app.SaveNoValidate(record); err != nil {
+		t.Fatal(err)
+	}
+
+	app.OnRecordDelete(collection.Name).BindFunc(func(e *core.RecordEvent) error {
+		if stuck[e.Record.Id] {
+			return errors.New("stuck")
+		}
+		return e.Next()
+	})
+
+	err = core.PurgeTrashedRecords(app, now)
+	if err == nil {
+		t.Fatal("Expected the stuck records to be reported")
+	}
+
+	if _, err := app.FindRecordById(collection, "llvuca81nly1qls"); err == nil {
+		t.Fatal("Expected the record behind the stuck ones to be purged")
+	}
+}
+
+func TestTrashedRecordsAreLeftOutOfJoins(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	demo4, err := app.FindCollectionByNameOrId("demo4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	demo4.SoftDelete = true
+	if err := app.Save(demo4); err != nil {
+		t.Fatal(err)
+	}
+
+	referencing, err := app.FindRecordsByFilter(demo4, "rel_one_cascade != ''", "", 1, 0)
+	if err != nil || len(referencing) == 0 {
+		t.Fatalf("Expected a demo4 record with rel_one_cascade, got %v", err)
+	}
+	target := referencing[0].GetString("rel_one_cascade")
+	trashedId := referencing[0].Id
+
+	filters := []string{
+		"id = {:target} && demo4_via_rel_one_cascade.id != ''",
+		"id = {:target} && @collection.demo4.id ?= {:trashed}",
+	}
+
+	count := func(filter string) int {
+		records, err := app.FindRecordsByFilter("demo3", filter, "", 0, 0, dbx.Params{
+			"target":  target,
+			"trashed": trashedId,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", filter, err)
+		}
+		return len(records)
+	}
+
+	for _, filter := range filters {
+		if n := count(filter); n != 1 {
+			t.Fatalf("Expected %q to match before the trash, got %d", filter, n)
+		}
+	}
+
+	// trash every demo4 record that references the target
+	all, err := app.FindRecordsByFilter(demo4, "rel_one_cascade = {:target}", "", 0, 0, dbx.Params{"target": target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range all {
+		if err := core.TrashRecord(context.Background(), app, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, filter := range filters {
+		if n := count(filter); n != 0 {
+			t.Fatalf("Expected %q to not match a trashed record, got %d", filter, n)
+		}
+	}
+}
@@ -0,0 +1,982 @@
+package core
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hanzoai/base/tools/hook"
+	"github.com/hanzoai/base/tools/inflector"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The records are ordered by their distance to a query vector in Go rather
+// than in SQL: neither engine ships the vector math and the SQLite driver
+// has no way to register it as a function.
+//
+// A vectorDistance() call is resolved to a join that is filled in last, when
+// the resolver updates the query: the rows the query selects (its joins, the
+// API rules and the filter) are scanned, the vectorCandidateLimit nearest of
+// them keep their distances and those are joined to the query as a list of
+// values. So the candidates are always rows the query could return, and the
+// records are ordered right as deep as the candidates go; the records that
+// aren't among them have no distance and sort after all of the ones that are.
+//
+// The scan can't evaluate a condition on the distance it is looking for, so
+// while it runs the vectorDistance() conditions of the filter are true (the
+// filter grammar has no negation, so that only ever selects more rows).
+//
+// Once the scanned rows have more than vectorIndexThreshold values an inverted
+// file index is built in the aux db in the background: the vectors are
+// clustered around about sqrt(n) centroids and the query is compared only
+// with the vectors of the cells nearest to it (the scan then reads just the
+// ids it may return). This is an approximation - a near record in a cell that
+// isn't probed is missed.
+//
+// The index is kept up to date from the record save and delete hooks and is
+// rebuilt once as many records were changed as it had when it was built (the
+// cells drift as the vectors do). It is written outside of the record
+// transaction, so a rolled back save may leave a row behind, which is
+// harmless since the distances are joined by the record id.
+
+const (
+	// vectorCandidateLimit is the max number of nearest records that
+	// a vectorDistance() call has distances for.
+	vectorCandidateLimit = 1000
+
+	// vectorIndexThreshold is the number of field values past which
+	// the nearest records are searched with an index.
+	vectorIndexThreshold = 10000
+
+	// vectorIndexMaxCells is the max number of cells (centroids) of an index.
+	vectorIndexMaxCells = 4096
+
+	// vectorIndexMinProbes is the min number of cells a search looks into.
+	vectorIndexMinProbes = 4
+
+	// vectorIndexSampleSize is how many vectors per cell the centroids are trained on.
+	vectorIndexSampleSize = 16
+
+	// vectorIndexRounds is the number of k-means rounds of the centroids training.
+	vectorIndexRounds = 5
+
+	// vectorFarDistance is the distance of the records that aren't among the
+	// candidates (and of the ones whose distance isn't a finite number).
+	//
+	// It is past any distance two float32 vectors can have and far enough from
+	// the float64 max that a filter doing arithmetic with it stays finite.
+	vectorFarDistance = "1e100"
+)
+
+const (
+	vectorIndexesTable = "_vectorIndexes"
+	vectorCellsTable   = "_vectorCells"
+
+	vectorIndexStoreKeyPrefix = "@vectorIndex/"
+	vectorIndexBuildsStoreKey = "@vectorIndexBuilds"
+)
+
+const systemHookIdVectorIndex = "__hzVectorIndexSystemHook__"
+
+// vectorDistanceJoin is a resolved vectorDistance() call, joined to the
+// query by joinVectorDistances.
+type vectorDistanceJoin struct {
+	field  *VectorField
+	vector types.Vector
+	alias  string
+}
+
+// vectorCondition is a filter condition on a vectorDistance(), which builds
+// as true while the resolver scans for the distance candidates.
+type vectorCondition struct {
+	resolver *RecordFieldResolver
+	expr     dbx.Expression
+}
+
+var _ dbx.Expression = (*vectorCondition)(nil)
+
+// Build implements [dbx.Expression] interface.
+func (e *vectorCondition) Build(db *dbx.DB, params dbx.Params) string {
+	if e.resolver.vectorScan {
+		return "1=1"
+	}
+
+	return e.expr.Build(db, params)
+}
+
+// resolveVectorDistance resolves vectorDistance(field, query) for a vector
+// field of the resolver's base collection.
+func (r *RecordFieldResolver) resolveVectorDistance(field *VectorField, query *search.ResolverResult) (*search.ResolverResult, error) {
+	text, ok := boundText(query)
+	if !ok {
+		return nil, errors.New("expects the query vector to be a string")
+	}
+
+	vector := types.Vector{}
+	if err := vector.Scan(text); err != nil {
+		return nil, fmt.Errorf("expects the query vector to be a json array of numbers: %w", err)
+	}
+
+	if len(vector) != field.Dimensions {
+		return nil, fmt.Errorf("expects a query vector with %d components, got %d", field.Dimensions, len(vector))
+	}
+
+	alias := "__vd" + strconv.Itoa(len(r.vectorJoins)) + "_" + inflector.Columnify(field.Name)
+
+	r.vectorJoins = append(r.vectorJoins, &vectorDistanceJoin{
+		field:  field,
+		vector: vector,
+		alias:  alias,
+	})
+
+	return &search.ResolverResult{
+		Identifier:   "COALESCE([[" + alias + ".distance]], " + vectorFarDistance + ")",
+		NullFallback: search.NullFallbackDisabled,
+		AfterBuild: func(expr dbx.Expression) dbx.Expression {
+			return &vectorCondition{resolver: r, expr: expr}
+		},
+	}, nil
+}
+
+// joinVectorDistances joins the distances of the resolved vectorDistance()
+// calls to query, which is expected to have all of its other joins and
+// conditions already.
+func (r *RecordFieldResolver) joinVectorDistances(query *dbx.SelectQuery) error {
+	for _, join := range r.vectorJoins {
+		neighbours, err := r.findNearestVectors(query, join.field, join.vector, vectorCandidateLimit)
+		if err != nil {
+			return fmt.Errorf("failed to find the nearest %q vectors: %w", join.field.Name, err)
+		}
+
+		// no candidates, but the alias must still be there for the
+		// identifier (and an empty VALUES list isn't valid SQL)
+		table := "(SELECT '' AS [[id]], 0 AS [[distance]] WHERE 1=0)"
+
+		if len(neighbours) > 0 {
+			// note: the values are inlined (the record ids can't have quotes but they
+			// are escaped anyway) because a sort expression can't have bound params
+			values := make([]string, len(neighbours))
+			for i, n := range neighbours {
+				values[i] = "('" + strings.ReplaceAll(n.id, "'", "''") + "', " + strconv.FormatFloat(n.distance, 'g', -1, 64) + ")"
+			}
+			table = "(SELECT [[column1]] AS [[id]], [[column2]] AS [[distance]] FROM (VALUES " + strings.Join(values, ", ") + ") AS [[__values]])"
+		}
+
+		query.LeftJoin(
+			table+" "+join.alias,
+			dbx.NewExp(fmt.Sprintf("[[%s.id]] = [[%s.id]]", join.alias, inflector.Columnify(r.baseCollection.Name))),
+		)
+	}
+
+	return nil
+}
+
+// scanVectorRows calls fn with the id (and the field value, if field isn't
+// nil) of every row that query selects, with its vectorDistance()
+// conditions taken as true.
+func (r *RecordFieldResolver) scanVectorRows(query *dbx.SelectQuery, field *VectorField, fn func(id string, vector types.Vector) error) error {
+	table := inflector.Columnify(r.baseCollection.Name)
+
+	cols := []string{"[[" + table + ".id]]"}
+	if field != nil {
+		cols = append(cols, "[["+table+"."+inflector.Columnify(field.Name)+"]]")
+	}
+
+	r.vectorScan = true
+	defer func() { r.vectorScan = false }()
+
+	// note: query is shallow cloned and slice/map in-place modifications should be avoided
+	scan := *query
+	rows, err := scan.Distinct(true).
+		Select(cols...).
+		OrderBy( /* reset */ ).
+		Build().
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var vector types.Vector
+		if field != nil {
+			err = rows.Scan(&id, &vector)
+		} else {
+			err = rows.Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(id, vector); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+type vectorNeighbour struct {
+	id       string
+	distance float64
+}
+
+// nearestVectors keeps the limit nearest of the added neighbours
+// (it is a max-heap on the distance, so the farthest one is replaced first).
+type nearestVectors struct {
+	limit int
+	items []vectorNeighbour
+}
+
+func (h *nearestVectors) Len() int           { return len(h.items) }
+func (h *nearestVectors) Less(i, j int) bool { return h.items[i].distance > h.items[j].distance }
+func (h *nearestVectors) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *nearestVectors) Push(x any)         { h.items = append(h.items, x.(vectorNeighbour)) }
+func (h *nearestVectors) Pop() any {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
+
+func (h *nearestVectors) add(id string, distance float64) {
+	// a non-finite distance is no distance at all (and can't be written as SQL)
+	if math.IsNaN(distance) || math.IsInf(distance, 0) {
+		return
+	}
+
+	if len(h.items) < h.limit {
+		heap.Push(h, vectorNeighbour{id, distance})
+		return
+	}
+
+	if len(h.items) > 0 && distance < h.items[0].distance {
+		h.items[0] = vectorNeighbour{id, distance}
+		heap.Fix(h, 0)
+	}
+}
+
+// sorted returns the kept neighbours, the nearest first.
+func (h *nearestVectors) sorted() []vectorNeighbour {
+	result := slices.Clone(h.items)
+	slices.SortFunc(result, func(a, b vectorNeighbour) int {
+		if c := cmp.Compare(a.distance, b.distance); c != 0 {
+			return c
+		}
+		return strings.Compare(a.id, b.id)
+	})
+	return result
+}
+
+// findNearestVectors returns the ids and distances of the limit records
+// that query selects whose field value is nearest to vector, the nearest first.
+func (r *RecordFieldResolver) findNearestVectors(query *dbx.SelectQuery, field *VectorField, vector types.Vector, limit int) ([]vectorNeighbour, error) {
+	state := vectorIndexStateOf(r.app, r.baseCollection, field)
+	if index := state.get(r.app, field); index != nil {
+		selected := map[string]struct{}{}
+		err := r.scanVectorRows(query, nil, func(id string, _ types.Vector) error {
+			selected[id] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return index.search(r.app, field, vector, limit, selected)
+	}
+
+	nearest := &nearestVectors{limit: limit}
+
+	var total int
+	err := r.scanVectorRows(query, field, func(id string, v types.Vector) error {
+		// the values saved before a dimensions change are skipped
+		if len(v) != field.Dimensions {
+			return nil
+		}
+		nearest.add(id, field.Distance(vector, v))
+		total++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if total > vectorIndexThreshold {
+		state.buildInBackground(r.app, r.baseCollection, field)
+	}
+
+	return nearest.sorted(), nil
+}
+
+// Index
+// -------------------------------------------------------------------
+
+// vectorIndex is the inverted file index of a vector field.
+type vectorIndex struct {
+	collectionId string
+	fieldId      string
+	dimensions   int
+	metric       string
+	total        int
+	centroids    []types.Vector
+}
+
+// search returns the limit nearest records to vector from the index cells
+// with the nearest centroids, out of the selected record ids.
+func (index *vectorIndex) search(app App, field *VectorField, vector types.Vector, limit int, selected map[string]struct{}) ([]vectorNeighbour, error) {
+	probes := max(vectorIndexMinProbes, len(index.centroids)/8)
+
+	cells := make([]int, len(index.centroids))
+	distances := make([]float64, len(index.centroids))
+	for i, centroid := range index.centroids {
+		cells[i] = i
+		distances[i] = field.Distance(vector, centroid)
+	}
+	slices.SortFunc(cells, func(a, b int) int {
+		return cmp.Compare(distances[a], distances[b])
+	})
+
+	probed := make([]any, 0, probes)
+	for _, cell := range cells[:min(probes, len(cells))] {
+		probed = append(probed, cell)
+	}
+
+	rows, err := app.AuxDB().Select("recordId", "vector").
+		From(vectorCellsTable).
+		Where(dbx.HashExp{"collectionId": index.collectionId, "fieldId": index.fieldId}).
+		AndWhere(dbx.In("cell", probed...)).
+		Build().
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nearest := &nearestVectors{limit: limit}
+	for rows.Next() {
+		var id string
+		var v types.Vector
+		if err := rows.Scan(&id, &v); err != nil {
+			return nil, err
+		}
+		if _, ok := selected[id]; !ok {
+			continue
+		}
+		nearest.add(id, field.Distance(vector, v))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return nearest.sorted(), nil
+}
+
+// cell returns the position of the centroid nearest to vector.
+func (index *vectorIndex) cell(field *VectorField, vector types.Vector) int {
+	return nearestCentroid(field, index.centroids, vector)
+}
+
+func nearestCentroid(field *VectorField, centroids []types.Vector, vector types.Vector) int {
+	result := 0
+	nearest := math.Inf(1)
+	for i, centroid := range centroids {
+		if d := field.Distance(vector, centroid); d < nearest {
+			result, nearest = i, d
+		}
+	}
+	return result
+}
+
+// loadVectorIndex loads the index of the specified collection field
+// (it returns nil if there is none).
+func loadVectorIndex(app App, collectionId string, fieldId string) (*vectorIndex, error) {
+	row := struct {
+		Dimensions int    `db:"dimensions"`
+		Metric     string `db:"metric"`
+		Total      int    `db:"total"`
+		Centroids  []byte `db:"centroids"`
+	}{}
+
+	err := app.AuxDB().Select("dimensions", "metric", "total", "centroids").
+		From(vectorIndexesTable).
+		Where(dbx.HashExp{"collectionId": collectionId, "fieldId": fieldId}).
+		One(&row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	all := types.Vector{}
+	if err := all.Scan(row.Centroids); err != nil {
+		return nil, err
+	}
+	if row.Dimensions <= 0 || len(all)%row.Dimensions != 0 {
+		return nil, fmt.Errorf("invalid %d dimensional centroids of length %d", row.Dimensions, len(all))
+	}
+
+	index := &vectorIndex{
+		collectionId: collectionId,
+		fieldId:      fieldId,
+		dimensions:   row.Dimensions,
+		metric:       row.Metric,
+		total:        row.Total,
+	}
+	for chunk := range slices.Chunk(all, row.Dimensions) {
+		index.centroids = append(index.centroids, chunk)
+	}
+
+	return index, nil
+}
+
+// kmeans clusters the vectors around k centroids with a few rounds of
+// Lloyd's algorithm, starting from k vectors spread over the list.
+//
+// It stops early (with the centroids of the last full round) once ctx is done.
+func kmeans(ctx context.Context, field *VectorField, vectors []types.Vector, k int) []types.Vector {
+	k = min(k, len(vectors))
+	if k == 0 {
+		return nil
+	}
+
+	centroids := make([]types.Vector, k)
+	for i := range centroids {
+		centroids[i] = slices.Clone(vectors[i*len(vectors)/k])
+	}
+
+	dimensions := len(centroids[0])
+
+	for range vectorIndexRounds {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+
+		for _, v := range vectors {
+			c := nearestCentroid(field, centroids, v)
+			if sums[c] == nil {
+				sums[c] = make([]float64, dimensions)
+			}
+			for j, x := range v {
+				sums[c][j] += float64(x)
+			}
+			counts[c]++
+		}
+
+		// note: a centroid that was nearest to none of the vectors is left as it is
+		for c, sum := range sums {
+			if counts[c] == 0 {
+				continue
+			}
+			for j := range centroids[c] {
+				centroids[c][j] = float32(sum[j] / float64(counts[c]))
+			}
+		}
+	}
+
+	return centroids
+}
+
+// buildVectorIndex clusters the current values of the collection field and
+// replaces the field index with the cells they were assigned to.
+//
+// It returns the new index (nil if the field has no values).
+func buildVectorIndex(ctx context.Context, app App, collection *Collection, field *VectorField) (*vectorIndex, error) {
+	var total int
+	err := app.DB().Select("COUNT(*)").
+		From(collection.Name).
+		Where(dbx.NewExp("[[" + field.Name + "]] IS NOT NULL")).
+		Row(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	cells := min(vectorIndexMaxCells, max(1, int(math.Sqrt(float64(total)))))
+	sampleEvery := max(1, total/(cells*vectorIndexSampleSize))
+
+	var sample []types.Vector
+	var i int
+	err = eachFieldVector(app, collection, field, func(id string, vector types.Vector) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i%sampleEvery == 0 {
+			sample = append(sample, vector)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index := &vectorIndex{
+		collectionId: collection.Id,
+		fieldId:      field.Id,
+		dimensions:   field.Dimensions,
+		metric:       field.metric(),
+		centroids:    kmeans(ctx, field, sample, cells),
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	err = app.AuxRunInTransaction(func(txApp App) error {
+		if err := deleteVectorIndex(txApp, collection.Id, field.Id); err != nil {
+			return err
+		}
+
+		if len(index.centroids) == 0 {
+			return nil
+		}
+
+		err := eachFieldVector(app, collection, field, func(id string, vector types.Vector) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			index.total++
+			return insertVectorCell(txApp, index, id, index.cell(field, vector), vector)
+		})
+		if err != nil {
+			return err
+		}
+
+		all := make(types.Vector, 0, len(index.centroids)*index.dimensions)
+		for _, centroid := range index.centroids {
+			all = append(all, centroid...)
+		}
+
+		_, err = txApp.AuxNonconcurrentDB().Insert(vectorIndexesTable, dbx.Params{
+			"collectionId": index.collectionId,
+			"fieldId":      index.fieldId,
+			"dimensions":   index.dimensions,
+			"metric":       index.metric,
+			"total":        index.total,
+			"centroids":    all.Bytes(),
+		}).Execute()
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(index.centroids) == 0 {
+		return nil, nil
+	}
+
+	return index, nil
+}
+
+// eachFieldVector calls fn with every value of the collection field
+// that has the field dimensions (the values saved before a dimensions
+// change are skipped).
+func eachFieldVector(app App, collection *Collection, field *VectorField, fn func(id string, vector types.Vector) error) error {
+	rows, err := app.DB().Select("id", field.Name).
+		From(collection.Name).
+		Where(dbx.NewExp("[[" + field.Name + "]] IS NOT NULL")).
+		Build().
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var vector types.Vector
+		if err := rows.Scan(&id, &vector); err != nil {
+			return err
+		}
+
+		if len(vector) != field.Dimensions {
+			continue
+		}
+
+		if err := fn(id, vector); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func upsertVectorCell(app App, index *vectorIndex, recordId string, cell int, vector types.Vector) error {
+	if err := deleteVectorCell(app, index.collectionId, index.fieldId, recordId); err != nil {
+		return err
+	}
+
+	return insertVectorCell(app, index, recordId, cell, vector)
+}
+
+func insertVectorCell(app App, index *vectorIndex, recordId string, cell int, vector types.Vector) error {
+	_, err := app.AuxNonconcurrentDB().Insert(vectorCellsTable, dbx.Params{
+		"collectionId": index.collectionId,
+		"fieldId":      index.fieldId,
+		"recordId":     recordId,
+		"cell":         cell,
+		"vector":       vector.Bytes(),
+	}).Execute()
+
+	return err
+}
+
+func deleteVectorCell(app App, collectionId string, fieldId string, recordId string) error {
+	_, err := app.AuxNonconcurrentDB().Delete(vectorCellsTable, dbx.HashExp{
+		"collectionId": collectionId,
+		"fieldId":      fieldId,
+		"recordId":     recordId,
+	}).Execute()
+
+	return err
+}
+
+// deleteVectorIndex deletes the index of the specified collection field
+// (or of all of the collection fields if fieldId is empty).
+func deleteVectorIndex(app App, collectionId string, fieldId string) error {
+	where := dbx.HashExp{"collectionId": collectionId}
+	if fieldId != "" {
+		where["fieldId"] = fieldId
+	}
+
+	if _, err := app.AuxNonconcurrentDB().Delete(vectorCellsTable, where).Execute(); err != nil {
+		return err
+	}
+
+	_, err := app.AuxNonconcurrentDB().Delete(vectorIndexesTable, where).Execute()
+
+	return err
+}
+
+// Index state
+// -------------------------------------------------------------------
+
+// vectorIndexState is the in-memory state of a vector field index
+// (shared through the app store).
+type vectorIndexState struct {
+	collectionId string
+	fieldId      string
+
+	mu       sync.Mutex
+	loaded   bool
+	index    *vectorIndex
+	changes  int
+	building bool
+	// the ids of the records changed while building
+	pending map[string]struct{}
+}
+
+func vectorIndexStateOf(app App, collection *Collection, field *VectorField) *vectorIndexState {
+	key := vectorIndexStoreKeyPrefix + collection.Id + "/" + field.Id
+
+	state, _ := app.Store().GetOrSet(key, func() any {
+		return &vectorIndexState{collectionId: collection.Id, fieldId: field.Id}
+	}).(*vectorIndexState)
+
+	return state
+}
+
+// get returns the field index if there is one that matches
+// the current field dimensions and metric.
+func (s *vectorIndexState) get(app App, field *VectorField) *vectorIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.current(app, field)
+}
+
+// current is get without the locking.
+//
+// NB! It expects s.mu to be held.
+func (s *vectorIndexState) current(app App, field *VectorField) *vectorIndex {
+	if !s.loaded {
+		index, err := loadVectorIndex(app, s.collectionId, s.fieldId)
+		if err != nil {
+			app.Logger().Warn("Failed to load a vector index", "field", field.Name, "error", err.Error())
+			return nil
+		}
+		s.index = index
+		s.loaded = true
+	}
+
+	if s.index == nil || s.index.dimensions != field.Dimensions || s.index.metric != field.metric() {
+		return nil
+	}
+
+	return s.index
+}
+
+// buildInBackground starts building the field index
+// (unless it is being built already or the app isn't running).
+func (s *vectorIndexState) buildInBackground(app App, collection *Collection, field *VectorField) {
+	if !s.startBuilding() {
+		return
+	}
+
+	builds, _ := app.Store().Get(vectorIndexBuildsStoreKey).(*vectorIndexBuilds)
+
+	started := builds != nil && builds.start(func(ctx context.Context) {
+		err := s.build(ctx, app, collection, field)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			app.Logger().Warn("Failed to build a vector index", "collection", collection.Name, "field", field.Name, "error", err.Error())
+		}
+	})
+	if !started {
+		s.mu.Lock()
+		s.building = false
+		s.pending = nil
+		s.mu.Unlock()
+	}
+}
+
+// startBuilding marks the index as being built
+// (it returns false if it is being built already).
+func (s *vectorIndexState) startBuilding() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.building {
+		return false
+	}
+
+	s.building = true
+	s.pending = map[string]struct{}{}
+
+	return true
+}
+
+// build builds the field index and indexes the records changed meanwhile.
+//
+// NB! It expects the state to be marked with startBuilding.
+func (s *vectorIndexState) build(ctx context.Context, app App, collection *Collection, field *VectorField) error {
+	index, err := buildVectorIndex(ctx, app, collection, field)
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.building = false
+	if err == nil {
+		s.index = index
+		s.loaded = true
+		s.changes = 0
+	}
+	s.mu.Unlock()
+
+	if err != nil || index == nil {
+		return err
+	}
+
+	for id := range pending {
+		var vector types.Vector
+		err := app.DB().Select(field.Name).
+			From(collection.Name).
+			Where(dbx.HashExp{"id": id}).
+			Row(&vector)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if err := s.update(app, collection, field, id, vector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// update writes (or removes if the vector is empty) the index cell of
+// a record changed since the index was built.
+func (s *vectorIndexState) update(app App, collection *Collection, field *VectorField, recordId string, vector types.Vector) error {
+	s.mu.Lock()
+
+	if s.building {
+		s.pending[recordId] = struct{}{}
+		s.mu.Unlock()
+		return nil
+	}
+
+	index := s.current(app, field)
+	if index == nil {
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.changes++
+	drifted := s.changes > index.total
+
+	s.mu.Unlock()
+
+	var err error
+	if len(vector) == index.dimensions {
+		err = upsertVectorCell(app, index, recordId, index.cell(field, vector), vector)
+	} else {
+		err = deleteVectorCell(app, collection.Id, field.Id, recordId)
+	}
+	if err != nil {
+		return err
+	}
+
+	if drifted {
+		s.buildInBackground(app, collection, field)
+	}
+
+	return nil
+}
+
+// Background builds
+// -------------------------------------------------------------------
+
+// vectorIndexBuilds tracks the index builds running in the background, so
+// that they are stopped before the app closes the dbs they are reading.
+type vectorIndexBuilds struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// start runs fn in a new goroutine with the context of the running app
+// (it returns false without running fn if the app isn't running).
+func (b *vectorIndexBuilds) start(fn func(ctx context.Context)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ctx == nil || b.ctx.Err() != nil {
+		return false
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+	}()
+
+	return true
+}
+
+// run allows new builds to start.
+func (b *vectorIndexBuilds) run() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+}
+
+// stop cancels the running builds and waits for them to return.
+func (b *vectorIndexBuilds) stop() {
+	b.mu.Lock()
+	if b.cancel != nil {
+		b.cancel()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+}
+
+// registerVectorIndexHooks runs the background index builds of app while it
+// is bootstrapped and stops them when it terminates or is bootstrapped again.
+func (app *BaseApp) registerVectorIndexHooks() {
+	builds := &vectorIndexBuilds{}
+	app.Store().Set(vectorIndexBuildsStoreKey, builds)
+
+	app.OnBootstrap().Bind(&hook.Handler[*BootstrapEvent]{
+		Id: systemHookIdVectorIndex,
+		Func: func(e *BootstrapEvent) error {
+			// the dbs of the previous bootstrap are about to be closed
+			builds.stop()
+
+			if err := e.Next(); err != nil {
+				return err
+			}
+
+			builds.run()
+
+			return nil
+		},
+		Priority: -99,
+	})
+
+	app.OnTerminate().Bind(&hook.Handler[*TerminateEvent]{
+		Id: systemHookIdVectorIndex,
+		Func: func(e *TerminateEvent) error {
+			builds.stop()
+
+			return e.Next()
+		},
+		Priority: -99,
+	})
+}
+
+// Record hooks
+// -------------------------------------------------------------------
+
+// indexRecordVectors updates the indexes of the record vector fields
+// (if they have any).
+//
+// oldId is the id the record was last saved with (empty for new records).
+func indexRecordVectors(app App, record *Record, oldId string) error {
+	collection := record.Collection()
+
+	for _, f := range collection.Fields {
+		field, ok := f.(*VectorField)
+		if !ok {
+			continue
+		}
+
+		state := vectorIndexStateOf(app, collection, field)
+
+		if oldId != "" && oldId != record.Id {
+			if err := state.update(app, collection, field, oldId, nil); err != nil {
+				return err
+			}
+		}
+
+		vector, _ := record.GetRaw(field.Name).(types.Vector)
+		if err := state.update(app, collection, field, record.Id, vector); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unindexRecordVectors removes the record with the specified id
+// from the indexes of its collection vector fields (if they have any).
+func unindexRecordVectors(app App, collection *Collection, id string) error {
+	for _, f := range collection.Fields {
+		field, ok := f.(*VectorField)
+		if !ok {
+			continue
+		}
+
+		if err := vectorIndexStateOf(app, collection, field).update(app, collection, field, id, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropVectorIndexes deletes the indexes of all of the collection vector fields.
+func dropVectorIndexes(app App, collection *Collection) error {
+	for key := range app.Store().GetAll() {
+		if strings.HasPrefix(key, vectorIndexStoreKeyPrefix+collection.Id+"/") {
+			app.Store().Remove(key)
+		}
+	}
+
+	return deleteVectorIndex(app, collection.Id, "")
+}
@@ -0,0 +1,288 @@
+package core_test
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tests"
+	"github.com/hanzoai/base/tools/search"
+	"github.com/hanzoai/base/tools/types"
+)
+
+func TestRecordVectorDistance(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("vector_test")
+	collection.ListRule = types.Pointer("")
+	collection.Fields.Add(
+		&core.TextField{Name: "title"},
+		&core.VectorField{Name: "embedding", Dimensions: 2, Metric: core.VectorMetricL2},
+		&core.TextField{Name: "other"},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	newRecord := func(title string, embedding types.Vector) *core.Record {
+		record := core.NewRecord(collection)
+		record.Set("title", title)
+		record.Set("embedding", embedding)
+		if err := app.Save(record); err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+
+	newRecord("a", types.Vector{0, 0})
+	newRecord("b", types.Vector{3, 4})
+	c := newRecord("c", types.Vector{1, 1})
+	newRecord("empty", nil)
+
+	find := func(filter string, sort string, query string) (string, error) {
+		records := []*core.Record{}
+
+		requestInfo := &core.RequestInfo{Query: map[string]string{"q": query}}
+
+		provider := search.NewProvider(core.NewRecordFieldResolver(app, collection, requestInfo, false)).
+			Query(app.RecordQuery(collection)).
+			Sort(search.ParseSortFromString(sort))
+		if filter != "" {
+			provider.Filter([]search.FilterData{search.FilterData(filter)})
+		}
+
+		if _, err := provider.Exec(&records); err != nil {
+			return "", err
+		}
+
+		titles := make([]string, len(records))
+		for i, r := range records {
+			titles[i] = r.GetString("title")
+		}
+
+		return strings.Join(titles, "|"), nil
+	}
+
+	scenarios := []struct {
+		name        string
+		filter      string
+		sort        string
+		query       string
+		expected    string
+		expectError bool
+	}{
+		{"nearest first", "", "vectorDistance(embedding, @request.query.q),title", "[3,3]", "b|c|a|empty", false},
+		{"farthest first", "", "-vectorDistance(embedding, @request.query.q),title", "[3,3]", "empty|a|c|b", false},
+		{"literal query", "", "vectorDistance(embedding, '[0,0.1]'),title", "", "a|c|b|empty", false},
+		{"with other filters", "title != 'a'", "vectorDistance(embedding, @request.query.q)", "[0,0]", "c|b|empty", false},
+		{"as a filter", "vectorDistance(embedding, @request.query.q) < 2", "title", "[0,0]", "a|c", false},
+		{"missing query", "", "vectorDistance(embedding, @request.query.missing)", "[0,0]", "", true},
+		{"invalid query", "", "vectorDistance(embedding, @request.query.q)", "[0,", "", true},
+		{"wrong dimensions", "", "vectorDistance(embedding, @request.query.q)", "[0,0,0]", "", true},
+		{"non-vector field", "", "vectorDistance(other, @request.query.q)", "[0,0]", "", true},
+		{"missing field", "", "vectorDistance(missing, @request.query.q)", "[0,0]", "", true},
+		{"invalid number of arguments", "", "vectorDistance(embedding)", "[0,0]", "", true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result, err := find(s.filter, s.sort, s.query)
+
+			hasErr := err != nil
+			if hasErr != s.expectError {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if result != s.expected {
+				t.Fatalf("Expected %q, got %q", s.expected, result)
+			}
+		})
+	}
+
+	t.Run("index", func(t *testing.T) {
+		for i := range 50 {
+			newRecord(fmt.Sprintf("r%d", i), types.Vector{float32(10 + i), float32(i % 7)})
+		}
+
+		field := collection.Fields.GetByName("embedding").(*core.VectorField)
+		if err := core.BuildVectorIndex(app, collection, field); err != nil {
+			t.Fatal(err)
+		}
+
+		var total int
+		err := app.AuxDB().Select("COUNT(*)").From("_vectorCells").Row(&total)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 53 {
+			t.Fatalf("Expected 53 indexed vectors, got %d", total)
+		}
+
+		first := func(query string) string {
+			result, err := find("", "vectorDistance(embedding, @request.query.q)", query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			title, _, _ := strings.Cut(result, "|")
+			return title
+		}
+
+		if title := first("[30,6]"); title != "r20" {
+			t.Fatalf("Expected r20 to be the nearest, got %q", title)
+		}
+
+		// saved after the index was built
+		newRecord("new", types.Vector{100, 100})
+		if title := first("[99,99]"); title != "new" {
+			t.Fatalf("Expected the new record to be the nearest, got %q", title)
+		}
+
+		// moved and deleted after the index was built
+		c.Set("embedding", types.Vector{-50, -50})
+		if err := app.Save(c); err != nil {
+			t.Fatal(err)
+		}
+		if title := first("[-49,-49]"); title != "c" {
+			t.Fatalf("Expected the moved record to be the nearest, got %q", title)
+		}
+
+		if err := app.Delete(c); err != nil {
+			t.Fatal(err)
+		}
+		if title := first("[-49,-49]"); title != "a" {
+			t.Fatalf("Expected the deleted record to be skipped, got %q", title)
+		}
+
+		// deleting the collection drops its index
+		if err := app.Delete(collection); err != nil {
+			t.Fatal(err)
+		}
+		err = app.AuxDB().Select("COUNT(*)").From("_vectorCells").Row(&total)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 0 {
+			t.Fatalf("Expected the index to be dropped, got %d vectors", total)
+		}
+	})
+}
+
+func TestRecordVectorDistanceAmongTheFilteredRecords(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+	defer app.Cleanup()
+
+	collection := core.NewBaseCollection("vector_test")
+	collection.ListRule = types.Pointer("")
+	collection.Fields.Add(
+		&core.TextField{Name: "title"},
+		&core.TextField{Name: "group"},
+		&core.VectorField{Name: "embedding", Dimensions: 2, Metric: core.VectorMetricL2},
+	)
+	if err := app.Save(collection); err != nil {
+		t.Fatal(err)
+	}
+
+	// more records than there are distance candidates, all of them
+	// nearer to the query than any of the filtered ones
+	err := app.RunInTransaction(func(txApp core.App) error {
+		for i := range 1001 {
+			record := core.NewRecord(collection)
+			record.Set("title", fmt.Sprintf("crowd%d", i))
+			record.Set("group", "crowd")
+			record.Set("embedding", types.Vector{0, float32(i) / 1000})
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+
+		for i, title := range []string{"near", "far"} {
+			record := core.NewRecord(collection)
+			record.Set("title", title)
+			record.Set("group", "kept")
+			record.Set("embedding", types.Vector{float32(5 * (i + 1)), 0})
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+		}
+
+		// saved past the validation, its distance isn't a number
+		broken := core.NewRecord(collection)
+		broken.Set("title", "broken")
+		broken.Set("group", "kept")
+		broken.Set("embedding", types.Vector{float32(math.Inf(1)), 0})
+
+		return txApp.SaveNoValidate(broken)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := []*core.Record{}
+
+	requestInfo := &core.RequestInfo{Query: map[string]string{"q": "[0,0]"}}
+
+	_, err = search.NewProvider(core.NewRecordFieldResolver(app, collection, requestInfo, false)).
+		Query(app.RecordQuery(collection)).
+		Filter([]search.FilterData{"group = 'kept'"}).
+		Sort(search.ParseSortFromString("vectorDistance(embedding, @request.query.q),-title")).
+		Exec(&records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	titles := make([]string, len(records))
+	for i, r := range records {
+		titles[i] = r.GetString("title")
+	}
+
+	if result := strings.Join(titles, "|"); result != "near|far|broken" {
+		t.Fatalf("Expected %q, got %q", "near|far|broken", result)
+	}
+}
+
+func TestVectorIndexBuildStopsOnTerminate(t *testing.T) {
+	t.Parallel()
+
+	app, _ := tests.NewTestApp()
+
+	field := &core.VectorField{Name: "embedding", Dimensions: 2}
+
+	collection := core.NewBaseCollection("vector_test")
+	collection.Fields.Add(field)
+	if err := app.Save(collection); err != nil {
+		app.Cleanup()
+		t.Fatal(err)
+	}
+
+	for i := range 100 {
+		record := core.NewRecord(collection)
+		record.Set("embedding", types.Vector{float32(i), 1})
+		if err := app.Save(record); err != nil {
+			app.Cleanup()
+			t.Fatal(err)
+		}
+	}
+
+	core.BuildVectorIndexInBackground(app, collection, field)
+
+	// waits for the build before the dbs are closed
+	app.Cleanup()
+
+	if core.IsVectorIndexBuilding(app, collection, field) {
+		t.Fatal("Expected the build to be done once the app terminated")
+	}
+
+	// and no other build starts after that
+	core.BuildVectorIndexInBackground(app, collection, field)
+
+	if core.IsVectorIndexBuilding(app, collection, field) {
+		t.Fatal("Expected no build to start once the app terminated")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/hanzoai/base/plugins/ghupdate"
 	_ "github.com/hanzoai/base/plugins/gojavm" // the "js" runtime a function runs on
 	"github.com/hanzoai/base/plugins/jsvm"
+	"github.com/hanzoai/base/plugins/messaging"
 	"github.com/hanzoai/base/plugins/migratecmd"
 	"github.com/hanzoai/base/plugins/org"
 	"github.com/hanzoai/base/plugins/waitlist"
@@ -157,6 +158,12 @@ func main() {
 	// Mounts under /v1/calendar. Opt-in via CALENDAR_ENABLED=true.
 	calendar.MustRegister(app, calendar.ConfigFromEnv())
 
+	// Messaging — syncs connected IMAP mailboxes into the messaging collections
+	// and sends through their SMTP servers. Mounts under /v1/messaging. Opt-in
+	// via MESSAGING_ENABLED=true, with the 32 byte MESSAGING_TOKEN_KEY the
+	// account passwords are encrypted under.
+	messaging.MustRegister(app, messaging.ConfigFromEnv())
+
 	// Hanzo Cloud SQL — serverless PostgreSQL (per-base database provisioning)
 	cloudsql.MustRegister(app, cloudsql.Config{
 		MetaURL:       os.Getenv("CLOUD_SQL_META_URL"),
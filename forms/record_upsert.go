@@ -221,3 +221,15 @@ func (form *RecordUpsert) Submit() error {
 	// run record validations and persist in db
 	return form.app.SaveWithContext(form.ctx, form.record)
 }
+
+// SubmitDraft validates the form and saves the record as the draft of its
+// drafts collection record, leaving the record itself unchanged
+// (see [core.SaveRecordDraft]).
+func (form *RecordUpsert) SubmitDraft() error {
+	err := form.validateFormFields()
+	if err != nil {
+		return err
+	}
+
+	return core.SaveRecordDraft(form.ctx, form.app, form.record)
+}
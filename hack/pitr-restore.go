@@ -1,12 +1,15 @@
-// Command pitr-restore reads archived WAL frames out of S3 or GCS and
+// Command pitr-restore reads archived WAL frames out of S3 or a directory and
 // replays them into a fresh SQLite file for point-in-time recovery.
 //
 // Usage:
 //
-//	pitr-restore --archive gs://bucket/svc --shard <id> --to-seq <n> --out <file.db>
+//	pitr-restore --archive s3://bucket/svc --shard <id> --to-seq <n> --out <file.db>
 //
 // Think of it as `restic restore` for Base. No mutation of the remote
 // archive; the tool is read-only on the cold store and writes locally.
+// It is a smoke test of the archive round trip; the supported restore is
+// `base restore --shard` (or POST /v1/backups/pitr), which rebuilds the
+// database itself.
 //
 // The tool opens a fresh SQLite database at --out (fails if it already
 // exists unless --force). Each frame's Payload is written into a
@@ -34,7 +37,7 @@ import (
 
 func main() {
 	var (
-		archiveURL = flag.String("archive", "", "archive URL (s3://bucket/svc | gs://bucket/svc)")
+		archiveURL = flag.String("archive", "", "archive URL (s3://bucket/svc | file:///path/svc)")
 		shard      = flag.String("shard", "", "shard ID to restore")
 		toSeq      = flag.Uint64("to-seq", 0, "restore frames up to and including this seq (0 = all)")
 		out        = flag.String("out", "", "path to the target SQLite file")
@@ -51,7 +54,7 @@ func main() {
 	}
 
 	// The archive URL may encode both the bucket and the service:
-	//   gs://bucket/svc  → bucket=bucket, svc=svc
+	//   s3://bucket/svc  → bucket=bucket, svc=svc
 	// We pass the full URL straight to network.NewArchive and let it
 	// split the path, but NewArchive needs an svc arg. Simplest: treat
 	// --svc as override, otherwise derive from the last path segment.
@@ -145,53 +148,11 @@ func main() {
 }
 
 // splitArchiveURL accepts scheme://bucket[/prefix/.../svc]. If the
-// caller passed --svc we honour it verbatim; otherwise the last
-// non-empty path segment is taken as the service name and the URL is
-// trimmed to "scheme://bucket/<prefix-without-svc>".
+// caller passed --svc we honour it verbatim; otherwise the URL is split
+// the way `base restore` splits BASE_ARCHIVE.
 func splitArchiveURL(raw, svcOverride string) (bucketURL, svc string, err error) {
 	if svcOverride != "" {
 		return raw, svcOverride, nil
 	}
-	// Locate the scheme separator.
-	const sep = "://"
-	i := indexOf(raw, sep)
-	if i < 0 {
-		return "", "", fmt.Errorf("archive url missing scheme: %q", raw)
-	}
-	scheme := raw[:i]
-	tail := raw[i+len(sep):]
-	// First path segment is the bucket; the rest forms the prefix.
-	slash := indexOf(tail, "/")
-	if slash < 0 {
-		return "", "", fmt.Errorf("archive url %q has no service suffix; pass --svc", raw)
-	}
-	bucket := tail[:slash]
-	path := tail[slash+1:]
-	// Last segment of path = svc.
-	lastSlash := lastIndexOf(path, "/")
-	if lastSlash < 0 {
-		// path IS the svc.
-		return scheme + sep + bucket, path, nil
-	}
-	svc = path[lastSlash+1:]
-	prefix := path[:lastSlash]
-	return scheme + sep + bucket + "/" + prefix, svc, nil
-}
-
-func indexOf(s, sub string) int {
-	for i := 0; i+len(sub) <= len(s); i++ {
-		if s[i:i+len(sub)] == sub {
-			return i
-		}
-	}
-	return -1
-}
-
-func lastIndexOf(s, sub string) int {
-	for i := len(s) - len(sub); i >= 0; i-- {
-		if s[i:i+len(sub)] == sub {
-			return i
-		}
-	}
-	return -1
+	return network.SplitArchiveURL(raw)
 }
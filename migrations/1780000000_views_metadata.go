@@ -11,9 +11,10 @@ import (
 //
 // Persisted as SYSTEM COLLECTIONS (not new Go field types), so they ride the
 // existing record CRUD + rules + realtime with zero core changes — one way to
-// store metadata: a collection. The client translates saved _view_filters rows
-// into Base's own `?filter=` query DSL at read time (tools/search/filter.go), so
-// there is no second query engine either.
+// store metadata: a collection. Saved _view_filters rows are translated into
+// Base's own `?filter=` query DSL at read time (tools/search/filter.go), by the
+// client or by `GET /v1/views/{id}/records|groups` (apis/views.go), so there is
+// no second query engine either.
 //
 //	_views          one saved view of a target collection (type, name, group-by)
 //	_view_fields    per-view column visibility + order + width
@@ -106,7 +107,7 @@ func createViewFiltersCollection(txApp core.App) error {
 	c.Fields.Add(&core.TextField{Name: "view", Required: true})
 	c.Fields.Add(&core.TextField{Name: "field", Required: true})
 	// operator mirrors the Base filter DSL surface (=,!=,>,>=,<,<=,~,!~) plus the
-	// empty/not-empty predicates the UI exposes; the client compiles it to ?filter=.
+	// empty/not-empty predicates the UI exposes; it is compiled to ?filter=.
 	c.Fields.Add(&core.SelectField{Name: "operator", MaxSelect: 1, Values: []string{
 		"eq", "neq", "gt", "gte", "lt", "lte", "like", "nlike", "empty", "nempty",
 	}})
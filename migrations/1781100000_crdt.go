@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"github.com/hanzoai/base/core"
+)
+
+// Collaborative documents are kept in the Base whose record owns them.
+//
+// Two collections, because a document is two things on disk: the state it had
+// when it was last compacted, and every op accepted since. A snapshot alone
+// would have to be rewritten whole on every keystroke; an op log alone would
+// have to be replayed from the first keystroke on every load.
+//
+//	_crdt_docs  one row per document: its id, the seq it was compacted at, and
+//	            the encoded document as of that seq
+//	_crdt_ops   the sealed envelopes accepted after that seq, in seq order
+//
+// Both are SYSTEM collections with nil rules, and that is the whole access
+// story for the raw rows: nobody reads them through /v1/collections but a
+// superuser. Who may join a document and who may push to it is the owning
+// record's view and update rule, asked by /v1/crdt on every call, so there is
+// no second rule here to disagree with it.
+func init() {
+	core.SystemMigrations.Register(func(txApp core.App) error {
+		if _, err := txApp.FindCollectionByNameOrId(core.CollectionNameCrdtDocs); err != nil {
+			docs := core.NewBaseCollection(core.CollectionNameCrdtDocs)
+			docs.System = true
+			docs.Fields.Add(
+				&core.TextField{Name: "doc", Required: true, Max: 512},
+				&core.NumberField{Name: "seq", OnlyInt: true},
+				&core.TextField{Name: "snapshot", Hidden: true, Max: 16 << 20},
+				&core.AutodateField{Name: "created", OnCreate: true},
+				&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+			)
+			docs.AddIndex("idx_crdt_docs_doc", true, "doc", "")
+			if err := txApp.Save(docs); err != nil {
+				return err
+			}
+		}
+
+		if _, err := txApp.FindCollectionByNameOrId(core.CollectionNameCrdtOps); err != nil {
+			ops := core.NewBaseCollection(core.CollectionNameCrdtOps)
+			ops.System = true
+			ops.Fields.Add(
+				&core.TextField{Name: "doc", Required: true, Max: 512},
+				&core.NumberField{Name: "seq", OnlyInt: true, Required: true},
+				&core.TextField{Name: "client", Max: 255},
+				&core.JSONField{Name: "envelopes", MaxSize: 4 << 20},
+				&core.AutodateField{Name: "created", OnCreate: true},
+			)
+			ops.AddIndex("idx_crdt_ops_doc_seq", true, "doc, seq", "")
+			if err := txApp.Save(ops); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(txApp core.App) error {
+		for _, name := range []string{core.CollectionNameCrdtOps, core.CollectionNameCrdtDocs} {
+			c, err := txApp.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			// a system collection refuses an ordinary delete
+			c.System = false
+			if err := txApp.Delete(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
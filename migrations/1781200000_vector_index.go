@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/hanzoai/base/core"
+)
+
+// The nearest-neighbour index of the large vector fields lives in the aux db,
+// next to the logs: it is derived from the records, rebuilt from them whenever
+// it drifts too far, and losing it only makes the vectorDistance() sort fall
+// back to scanning the field.
+//
+//	_vectorIndexes  one row per indexed field: the vectors' dimensions and
+//	                metric and the centroids they were clustered around
+//	_vectorCells    one row per indexed record: its vector and the cell
+//	                (the centroid position) it was assigned to
+func init() {
+	core.SystemMigrations.Add(&core.Migration{
+		Up: func(txApp core.App) error {
+			d := txApp.Dialect()
+
+			_, execErr := txApp.AuxDB().NewQuery(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS {{_vectorIndexes}} (
+					[[collectionId]] TEXT NOT NULL,
+					[[fieldId]]      TEXT NOT NULL,
+					[[dimensions]]   INTEGER NOT NULL,
+					[[metric]]       TEXT NOT NULL,
+					[[total]]        INTEGER NOT NULL,
+					[[centroids]]    %s NOT NULL,
+					[[created]]      TEXT DEFAULT (%s) NOT NULL,
+					PRIMARY KEY ([[collectionId]], [[fieldId]])
+				);
+
+				CREATE TABLE IF NOT EXISTS {{_vectorCells}} (
+					[[collectionId]] TEXT NOT NULL,
+					[[fieldId]]      TEXT NOT NULL,
+					[[recordId]]     TEXT NOT NULL,
+					[[cell]]         INTEGER NOT NULL,
+					[[vector]]       %s NOT NULL,
+					PRIMARY KEY ([[collectionId]], [[fieldId]], [[recordId]])
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_vectorCells_cell on {{_vectorCells}} ([[collectionId]], [[fieldId]], [[cell]]);
+			`, d.Bytes(), d.Now(), d.Bytes())).Execute()
+
+			return execErr
+		},
+		Down: func(txApp core.App) error {
+			if _, err := txApp.AuxDB().DropTable("_vectorCells").Execute(); err != nil {
+				return err
+			}
+
+			_, err := txApp.AuxDB().DropTable("_vectorIndexes").Execute()
+			return err
+		},
+		ReapplyCondition: func(txApp core.App, runner *core.MigrationsRunner, fileName string) (bool, error) {
+			exists := txApp.AuxHasTable("_vectorIndexes") && txApp.AuxHasTable("_vectorCells")
+			return !exists, nil
+		},
+	})
+}
@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/hanzoai/base/core"
+)
+
+// The record change outbox lives in the main db, next to the records it
+// describes, because it is written in the transaction that writes them: a
+// change is in the outbox if and only if it was committed.
+//
+//	_changes        one row per committed record write: its seq, the record
+//	                it touched, and the record's state before and after it
+//	_changeCursors  one row per change sink: the last seq it was delivered
+func init() {
+	core.SystemMigrations.Add(&core.Migration{
+		Up: func(txApp core.App) error {
+			d := txApp.Dialect()
+
+			_, execErr := txApp.DB().NewQuery(fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS {{_changes}} (
+					[[seq]]            INTEGER PRIMARY KEY NOT NULL,
+					[[collectionId]]   TEXT NOT NULL,
+					[[collectionName]] TEXT NOT NULL,
+					[[recordId]]       TEXT NOT NULL,
+					[[action]]         TEXT NOT NULL,
+					[[before]]         %s,
+					[[after]]          %s,
+					[[created]]        TEXT DEFAULT (%s) NOT NULL
+				);
+
+				CREATE INDEX IF NOT EXISTS idx_changes_collection_seq on {{_changes}} ([[collectionId]], [[seq]]);
+				CREATE INDEX IF NOT EXISTS idx_changes_created on {{_changes}} ([[created]]);
+
+				CREATE TABLE IF NOT EXISTS {{_changeCursors}} (
+					[[sink]]    TEXT PRIMARY KEY NOT NULL,
+					[[seq]]     INTEGER NOT NULL,
+					[[updated]] TEXT DEFAULT (%s) NOT NULL
+				);
+			`, d.Json(), d.Json(), d.Now(), d.Now())).Execute()
+
+			return execErr
+		},
+		Down: func(txApp core.App) error {
+			if _, err := txApp.DB().DropTable("_changeCursors").Execute(); err != nil {
+				return err
+			}
+
+			_, err := txApp.DB().DropTable("_changes").Execute()
+			return err
+		},
+		ReapplyCondition: func(txApp core.App, runner *core.MigrationsRunner, fileName string) (bool, error) {
+			exists := txApp.HasTable("_changes") && txApp.HasTable("_changeCursors")
+			return !exists, nil
+		},
+	})
+}
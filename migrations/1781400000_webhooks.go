@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"github.com/hanzoai/base/core"
+)
+
+// Outgoing webhooks, as two system collections.
+//
+//	_webhooks             one endpoint: where to send, which changes, the secret
+//	_webhook_deliveries   one change on its way to one endpoint, and how it went
+//
+// Both are system collections with nil rules: an endpoint and its secret are
+// the deployment's to configure, and a delivery's payload is a record as the
+// superuser reads it, so neither is a row any other caller may list.
+//
+// A delivery names its webhook by id in a text field, the way the view
+// metadata names its view, rather than by a relation: the log outlives the
+// endpoint, and a deleted webhook's deliveries are still what was sent.
+func init() {
+	core.SystemMigrations.Register(func(txApp core.App) error {
+		if err := createWebhooksCollection(txApp); err != nil {
+			return err
+		}
+		return createWebhookDeliveriesCollection(txApp)
+	}, func(txApp core.App) error {
+		for _, name := range []string{core.CollectionNameWebhookDeliveries, core.CollectionNameWebhooks} {
+			c, err := txApp.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue // already gone
+			}
+			if err := txApp.Delete(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func createWebhooksCollection(txApp core.App) error {
+	c := core.NewBaseCollection(core.CollectionNameWebhooks)
+	c.System = true
+	c.Fields.Add(&core.TextField{Name: "name"})
+	c.Fields.Add(&core.URLField{Name: "url", Required: true})
+	c.Fields.Add(&core.JSONField{Name: "collections"}) // collection names or ids; empty is every collection
+	c.Fields.Add(&core.SelectField{Name: "actions", MaxSelect: 3, Values: []string{
+		core.RecordChangeCreate, core.RecordChangeUpdate, core.RecordChangeDelete,
+	}}) // empty is every action
+	c.Fields.Add(&core.TextField{Name: "filter"}) // a record filter, as in a rule
+	c.Fields.Add(&core.TextField{
+		Name:                "secret",
+		Required:            true,
+		Hidden:              true,
+		AutogeneratePattern: `[a-zA-Z0-9]{40}`,
+	})
+	c.Fields.Add(&core.BoolField{Name: "active"})
+	addTimestamps(c)
+	return txApp.Save(c)
+}
+
+func createWebhookDeliveriesCollection(txApp core.App) error {
+	c := core.NewBaseCollection(core.CollectionNameWebhookDeliveries)
+	c.System = true
+	c.Fields.Add(&core.TextField{Name: "webhook", Required: true}) // parent _webhooks id
+	c.Fields.Add(&core.NumberField{Name: "seq", OnlyInt: true})    // the change, in the outbox
+	c.Fields.Add(&core.TextField{Name: "collection"})
+	c.Fields.Add(&core.TextField{Name: "recordId"})
+	c.Fields.Add(&core.TextField{Name: "action"})
+	c.Fields.Add(&core.JSONField{Name: "payload"})
+	c.Fields.Add(&core.SelectField{Name: "status", MaxSelect: 1, Values: []string{
+		core.WebhookDeliveryPending, core.WebhookDeliveryDelivered, core.WebhookDeliveryFailed,
+	}})
+	c.Fields.Add(&core.NumberField{Name: "attempts", OnlyInt: true})
+	c.Fields.Add(&core.DateField{Name: "nextAttempt"})
+	c.Fields.Add(&core.NumberField{Name: "responseStatus", OnlyInt: true})
+	c.Fields.Add(&core.TextField{Name: "error"})
+	c.Fields.Add(&core.DateField{Name: "deliveredAt"})
+	c.Fields.Add(&core.TextField{Name: "replayOf"}) // the delivery this one replays
+	addTimestamps(c)
+	c.AddIndex("idx_webhook_deliveries_due", false, "status, nextAttempt", "")
+	c.AddIndex("idx_webhook_deliveries_webhook_seq", false, "webhook, seq", "")
+	return txApp.Save(c)
+}
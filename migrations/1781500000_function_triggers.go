@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"github.com/hanzoai/base/core"
+)
+
+// Function triggers: when a function runs without anybody calling it.
+//
+// The triggers are a field of the function rather than a collection beside it,
+// because a trigger is part of what a function is — a function and its triggers
+// are written, read and deleted together, and a trigger left behind by a
+// deleted function would be a schedule for nothing.
+//
+// The field is hidden for the same reason the source is. A triggered run has no
+// caller, so it runs as the Base; saying when code runs as the Base is the same
+// authority as writing the code, and it stays with whoever may write the code.
+//
+// The invocations log is a system collection with nil rules, the way the webhook
+// deliveries are: a row holds a record as the superuser reads it.
+func init() {
+	core.SystemMigrations.Register(func(txApp core.App) error {
+		functions, err := txApp.FindCollectionByNameOrId(core.CollectionNameFunctions)
+		if err != nil {
+			return err
+		}
+		if functions.Fields.GetByName(core.FieldNameTriggers) == nil {
+			functions.Fields.Add(&core.JSONField{Name: core.FieldNameTriggers, Hidden: true})
+			if err := txApp.Save(functions); err != nil {
+				return err
+			}
+		}
+
+		return createFunctionInvocationsCollection(txApp)
+	}, func(txApp core.App) error {
+		if c, err := txApp.FindCollectionByNameOrId(core.CollectionNameFunctionInvocations); err == nil {
+			if err := txApp.Delete(c); err != nil {
+				return err
+			}
+		}
+
+		functions, err := txApp.FindCollectionByNameOrId(core.CollectionNameFunctions)
+		if err != nil {
+			return nil // already gone
+		}
+		functions.Fields.RemoveByName(core.FieldNameTriggers)
+		return txApp.Save(functions)
+	})
+}
+
+func createFunctionInvocationsCollection(txApp core.App) error {
+	c := core.NewBaseCollection(core.CollectionNameFunctionInvocations)
+	c.System = true
+	c.Fields.Add(&core.TextField{Name: "function", Required: true}) // parent _functions id
+	c.Fields.Add(&core.TextField{Name: "trigger"})                  // create, update, delete or cron
+	c.Fields.Add(&core.NumberField{Name: "seq", OnlyInt: true})     // the change, in the outbox
+	c.Fields.Add(&core.TextField{Name: "collection"})
+	c.Fields.Add(&core.TextField{Name: "recordId"})
+	c.Fields.Add(&core.JSONField{Name: "payload"})
+	c.Fields.Add(&core.SelectField{Name: "status", MaxSelect: 1, Values: []string{
+		core.FunctionInvocationPending, core.FunctionInvocationSucceeded, core.FunctionInvocationFailed,
+	}})
+	c.Fields.Add(&core.NumberField{Name: "attempts", OnlyInt: true})
+	c.Fields.Add(&core.DateField{Name: "nextAttempt"})
+	c.Fields.Add(&core.NumberField{Name: "duration", OnlyInt: true}) // of the last attempt, in ms
+	c.Fields.Add(&core.TextField{Name: "error"})
+	c.Fields.Add(&core.DateField{Name: "finishedAt"})
+	addTimestamps(c)
+	c.AddIndex("idx_function_invocations_due", false, "status, nextAttempt", "")
+	c.AddIndex("idx_function_invocations_function_seq", false, "function, seq", "")
+	return txApp.Save(c)
+}
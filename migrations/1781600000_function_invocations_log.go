@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"github.com/hanzoai/base/core"
+)
+
+// The function invocations log covers the invoked runs as well as the triggered
+// ones, so it says who called, how the run ended, and what it cost.
+//
+// The caller is named by id and collection in text fields rather than by a
+// relation, the way a delivery names its webhook: the log outlives the caller,
+// and a deleted user's calls are still what ran.
+func init() {
+	core.SystemMigrations.Register(func(txApp core.App) error {
+		c, err := txApp.FindCollectionByNameOrId(core.CollectionNameFunctionInvocations)
+		if err != nil {
+			return err
+		}
+
+		if c.Fields.GetByName("caller") != nil {
+			return nil
+		}
+
+		c.Fields.Add(&core.TextField{Name: "caller"})           // the auth record id, empty for a guest or a trigger
+		c.Fields.Add(&core.TextField{Name: "callerCollection"}) // the auth record collection name
+		c.Fields.Add(&core.SelectField{Name: "errorClass", MaxSelect: 1, Values: []string{
+			core.FunctionErrorTimeout, core.FunctionErrorRefused, core.FunctionErrorFailed, core.FunctionErrorTooLarge,
+		}})
+		c.Fields.Add(&core.NumberField{Name: "rows", OnlyInt: true}) // read through the host
+		c.Fields.Add(&core.NumberField{Name: "runs", OnlyInt: true}) // started through the host
+		c.AddIndex("idx_function_invocations_function_created", false, "function, created", "")
+
+		return txApp.Save(c)
+	}, func(txApp core.App) error {
+		c, err := txApp.FindCollectionByNameOrId(core.CollectionNameFunctionInvocations)
+		if err != nil {
+			return nil // already gone
+		}
+
+		for _, name := range []string{"caller", "callerCollection", "errorClass", "rows", "runs"} {
+			c.Fields.RemoveByName(name)
+		}
+		c.RemoveIndex("idx_function_invocations_function_created")
+
+		return txApp.Save(c)
+	})
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"github.com/hanzoai/base/core"
+)
+
+// An imap_smtp_caldav account has no provider to discover its servers from, so
+// it says where they are in connectionParameters:
+//
+//	{"imap": {"host": "imap.example.com", "port": 993, "tls": true, "folders": ["INBOX", "Sent"]},
+//	 "smtp": {"host": "smtp.example.com", "port": 465, "tls": true}}
+//
+// where a missing username is the account's handle. The password stays in
+// accessTokenEnc, as ciphertext only; these are the addresses, which the owner
+// may read, so the field is not hidden.
+func init() {
+	core.SystemMigrations.Register(func(txApp core.App) error {
+		c, err := txApp.FindCollectionByNameOrId("connectedAccount")
+		if err != nil {
+			return err
+		}
+
+		if c.Fields.GetByName("connectionParameters") != nil {
+			return nil
+		}
+
+		c.Fields.Add(&core.JSONField{Name: "connectionParameters"})
+
+		return txApp.Save(c)
+	}, func(txApp core.App) error {
+		c, err := txApp.FindCollectionByNameOrId("connectedAccount")
+		if err != nil {
+			return nil // already gone
+		}
+
+		c.Fields.RemoveByName("connectionParameters")
+
+		return txApp.Save(c)
+	})
+}
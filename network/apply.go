@@ -1,13 +1,22 @@
 package network
 
-import "context"
+import (
+	"context"
+	"crypto/ed25519"
+)
 
 // Envelope is what the transport ships between nodes: a shardID header +
-// the serialisable frame. Signing and transport security live at the
-// transport layer; this struct is the minimal contract.
+// the serialisable frame, signed by the sending member when it holds an
+// identity key (see identity.go). Transports carry all four fields as they
+// are; signing and verifying is the node's.
 type Envelope struct {
 	ShardID string
 	Frame   Frame
+
+	// Key is the sender's Ed25519 public key and Sig its signature over
+	// ShardID and the encoded Frame. Both are empty when unsigned.
+	Key ed25519.PublicKey
+	Sig []byte
 }
 
 // Transport is the peer-to-peer plane. Production implementations carry
@@ -1,8 +1,9 @@
 // Package network archive layer.
 //
-// Archive writes quasar-finalised WAL frames to object storage (S3)
-// as per-shard segment files. Each segment is a length-prefixed list of
-// PQ-signed frames that can be replayed for point-in-time recovery.
+// Archive writes quasar-finalised WAL frames to object storage (S3) or a
+// local directory as per-shard segment files. Each segment is a
+// length-prefixed list of PQ-signed frames that can be replayed for
+// point-in-time recovery.
 //
 // Segment format: magic "LBN2" (authenticated — body+crc+pubkey signed by
 // Ed25519). Version 1 ("LBN1") existed only during dev and is rejected
@@ -11,9 +12,10 @@
 // never overload an existing magic — forwards compatibility only.
 //
 // This file defines the Archive interface and the URL-based backend
-// dispatcher. The consensus-side wiring (witness validator, frame feed)
-// is owned by the core network package; archive is a dumb consumer of
-// already-finalised data.
+// dispatcher. Backends register their scheme from their own files. The
+// consensus-side wiring (witness validator, frame feed) is owned by the
+// core network package; archive is a dumb consumer of already-finalised
+// data.
 package network
 
 import (
@@ -23,6 +25,7 @@ import (
 	"fmt"
 	"iter"
 	"net/url"
+	"slices"
 	"strings"
 	"time"
 )
@@ -49,8 +52,9 @@ type Archive interface {
 // ArchiveConfig controls segment size + flush cadence. Zero values
 // fall back to defaults (8 MiB, 10 s).
 type ArchiveConfig struct {
-	// URL is the backend destination: s3://bucket/prefix or
-	// at the bucket root.
+	// URL is the backend destination: s3://bucket/prefix, or
+	// file:///path for a directory on this machine. Objects land under
+	// the prefix, or at the bucket root without one.
 	URL string
 
 	// SegmentTargetBytes is the size at which an in-memory segment
@@ -156,10 +160,29 @@ func BindArchiveMetrics(m *Metrics) *ArchiveMetrics {
 	}
 }
 
-// NewArchive dispatches on the URL scheme. s3:// is the only one — every
-// Hanzo and Lux deploy ships S3 (hanzoai/s3) for storage.
-// Currently supported:
+// archiveBackend opens the storage an archive URL names: the uploader the
+// shared writer ships segments through, and the key prefix the URL spells
+// within it. Everything above the uploader — signing, backlog caps, retries,
+// Range — is the writer's, so a backend is storage and nothing else.
+type archiveBackend func(ctx context.Context, u *url.URL) (up uploader, prefix string, err error)
+
+// archiveBackends maps a URL scheme to its backend. Each backend registers
+// from an init in its own file, so a new scheme is a new file.
+var archiveBackends = map[string]archiveBackend{}
+
+// registerArchiveBackend makes NewArchive open scheme:// URLs with open. It
+// panics on a scheme registered twice, which is two files claiming it.
+func registerArchiveBackend(scheme string, open archiveBackend) {
+	scheme = strings.ToLower(scheme)
+	if _, dup := archiveBackends[scheme]; dup {
+		panic("archive: backend registered twice for scheme " + scheme)
+	}
+	archiveBackends[scheme] = open
+}
+
+// NewArchive dispatches on the URL scheme to a registered backend:
 // s3://   → S3 (hanzoai/s3 self-hosted or AWS).
+// file:// → a local directory, for single-box and air-gapped deployments.
 // off     → nil Archive, disabled (call sites treat as no-op).
 // Anything else is a config error.
 func NewArchive(ctx context.Context, cfg ArchiveConfig, svc string, m *ArchiveMetrics) (Archive, error) {
@@ -171,23 +194,27 @@ func NewArchive(ctx context.Context, cfg ArchiveConfig, svc string, m *ArchiveMe
 	if err != nil {
 		return nil, fmt.Errorf("archive: parse %q: %w", cfg.URL, err)
 	}
-	if u.Host == "" {
-		return nil, fmt.Errorf("archive: url %q has no bucket", cfg.URL)
-	}
-	prefix := strings.Trim(u.Path, "/")
 	if svc == "" {
 		return nil, errors.New("archive: svc is required")
 	}
+	open, ok := archiveBackends[strings.ToLower(u.Scheme)]
+	if !ok {
+		schemes := make([]string, 0, len(archiveBackends))
+		for s := range archiveBackends {
+			schemes = append(schemes, s+"://")
+		}
+		slices.Sort(schemes)
+		return nil, fmt.Errorf("archive: unsupported scheme %q (want %s)", u.Scheme, strings.Join(schemes, " or "))
+	}
+	up, prefix, err := open(ctx, u)
+	if err != nil {
+		return nil, err
+	}
 	// Service name prefixes every object: <svc>/<shard>/<seq-prefix>/<segment>.lbn
 	// If the URL already carries a path prefix, compose them.
 	objPrefix := svc
 	if prefix != "" {
 		objPrefix = prefix + "/" + svc
 	}
-	switch strings.ToLower(u.Scheme) {
-	case "s3":
-		return newS3Archive(ctx, u.Host, objPrefix, cfg, m)
-	default:
-		return nil, fmt.Errorf("archive: unsupported scheme %q (want s3://)", u.Scheme)
-	}
+	return newArchiveWriter(up, objPrefix, cfg, m), nil
 }
@@ -0,0 +1,162 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func init() { registerArchiveBackend("file", openFile) }
+
+// fileUpload keeps segments as files under a directory on this machine, for
+// deployments with no object store: a single box, or an air-gapped site. An
+// object key is a path below root, so the layout on disk is the layout in a
+// bucket, and a directory copied into one (or back) reads the same.
+//
+// A segment is written to a temporary file, synced, and renamed into place,
+// so a crash leaves either the whole segment or none of it — Range never
+// meets half of one. Nothing is ever deleted: a restore replays from seq 1,
+// so the archive is only as useful as its oldest segment, and the same holds
+// for every backend. Disk space is the operator's to watch.
+//
+// What this does not give is a second machine. Segments on the disk the
+// database lives on go down with it; point root at a mount that does not.
+type fileUpload struct {
+	root string
+}
+
+// openFile opens file:///path. The directory must exist, the way a bucket
+// must, so a typo fails at startup rather than creating an archive nobody
+// reads.
+func openFile(_ context.Context, u *url.URL) (uploader, string, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, "", fmt.Errorf("archive: url %q names host %q; file:// is this machine only", u.Redacted(), u.Host)
+	}
+	if u.Opaque != "" || !filepath.IsAbs(filepath.FromSlash(u.Path)) {
+		return nil, "", fmt.Errorf("archive: url %q is not an absolute path (want file:///path)", u.Redacted())
+	}
+	root := filepath.Clean(filepath.FromSlash(u.Path))
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, "", fmt.Errorf("archive file: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, "", fmt.Errorf("archive file: %s is not a directory", root)
+	}
+	return &fileUpload{root: root}, "", nil
+}
+
+// --- uploader impl ---
+
+func (u *fileUpload) put(_ context.Context, key string, body []byte) error {
+	p, err := u.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("file put %s: %w", key, err)
+	}
+
+	tmp := p + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("file put %s: %w", key, err)
+	}
+	if _, err := f.Write(body); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("file put %s: %w", key, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("file put %s: %w", key, err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("file put %s: %w", key, err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("file put %s: %w", key, err)
+	}
+	return nil
+}
+
+func (u *fileUpload) get(_ context.Context, key string) ([]byte, error) {
+	p, err := u.path(key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("file get %s: %w", key, err)
+	}
+	return b, nil
+}
+
+// list walks the directory the prefix ends in, or whose name it begins, and
+// returns every file whose key starts with prefix. A prefix with nothing
+// under it lists nothing, as an empty bucket prefix does.
+func (u *fileUpload) list(ctx context.Context, prefix string) ([]string, error) {
+	dir := "."
+	if i := strings.LastIndexByte(prefix, '/'); i > 0 {
+		dir = prefix[:i]
+	}
+	start, err := u.path(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	err = filepath.WalkDir(start, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(p, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(u.root, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			out = append(out, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("file list %s: %w", prefix, err)
+	}
+	return out, nil
+}
+
+// path maps key to its file below root. Keys carry the shard ID, which is
+// whatever the shard key resolved to, so a key with a "." or ".." in it — one
+// that could name another shard's files, or leave root — is refused rather
+// than cleaned into somewhere else.
+func (u *fileUpload) path(key string) (string, error) {
+	if key == "." {
+		return u.root, nil
+	}
+	if key != path.Clean(key) || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("archive file: key %q is not below the archive root", key)
+	}
+	return filepath.Join(u.root, filepath.FromSlash(key)), nil
+}
+
+func (u *fileUpload) close() error { return nil }
+
+func (u *fileUpload) scheme() string { return "file" }
@@ -5,7 +5,6 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"iter"
 	"net/url"
 	"os"
 	"strings"
@@ -14,7 +13,9 @@ import (
 	"github.com/hanzos3/go/pkg/credentials"
 )
 
-// s3Archive speaks the S3 API. It works against hanzoai/s3 self-hosted,
+func init() { registerArchiveBackend("s3", openS3) }
+
+// s3Upload speaks the S3 API. It works against hanzoai/s3 self-hosted,
 // AWS S3, and any other S3-compatible endpoint.
 //
 // Credential resolution order (first match wins):
@@ -26,21 +27,20 @@ import (
 //   - AWS_ENDPOINT_URL unset    → s3.<region>.amazonaws.com default.
 //
 // Both paths honour AWS_REGION (defaults to us-east-1).
-type s3Archive struct {
-	*archiveWriter
-	client *s3.Client
-	bucket string
-}
-
 type s3Upload struct {
 	client *s3.Client
 	bucket string
 }
 
-func newS3Archive(ctx context.Context, bucket, svcPrefix string, cfg ArchiveConfig, m *ArchiveMetrics) (*s3Archive, error) {
+// openS3 opens s3://bucket/prefix, checking the bucket exists.
+func openS3(ctx context.Context, u *url.URL) (uploader, string, error) {
+	bucket := u.Host
+	if bucket == "" {
+		return nil, "", fmt.Errorf("archive: url %q has no bucket", u.Redacted())
+	}
 	endpoint, secure, err := resolveS3Endpoint()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	region := os.Getenv("AWS_REGION")
 	if region == "" {
@@ -48,7 +48,7 @@ func newS3Archive(ctx context.Context, bucket, svcPrefix string, cfg ArchiveConf
 	}
 	creds, err := resolveS3Creds()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	client, err := s3.New(endpoint, &s3.Options{
 		Creds:  creds,
@@ -56,36 +56,18 @@ func newS3Archive(ctx context.Context, bucket, svcPrefix string, cfg ArchiveConf
 		Region: region,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("archive s3: new client: %w", err)
+		return nil, "", fmt.Errorf("archive s3: new client: %w", err)
 	}
 	ok, err := client.BucketExists(ctx, bucket)
 	if err != nil {
-		return nil, fmt.Errorf("archive s3: bucket check %s: %w", bucket, err)
+		return nil, "", fmt.Errorf("archive s3: bucket check %s: %w", bucket, err)
 	}
 	if !ok {
-		return nil, fmt.Errorf("archive s3: bucket %q does not exist", bucket)
+		return nil, "", fmt.Errorf("archive s3: bucket %q does not exist", bucket)
 	}
-	up := &s3Upload{client: client, bucket: bucket}
-	return &s3Archive{
-		archiveWriter: newArchiveWriter(up, svcPrefix, cfg, m),
-		client:        client,
-		bucket:        bucket,
-	}, nil
+	return &s3Upload{client: client, bucket: bucket}, strings.Trim(u.Path, "/"), nil
 }
 
-// Append satisfies Archive.
-func (a *s3Archive) Append(ctx context.Context, shardID string, seq uint64, frame []byte) error {
-	return a.archiveWriter.Append(ctx, shardID, seq, frame)
-}
-
-// Range satisfies Archive.
-func (a *s3Archive) Range(ctx context.Context, shardID string, fromSeq, toSeq uint64) (iter.Seq2[Frame, error], error) {
-	return a.archiveWriter.Range(ctx, shardID, fromSeq, toSeq)
-}
-
-// Close satisfies Archive.
-func (a *s3Archive) Close() error { return a.archiveWriter.Close() }
-
 // --- uploader impl ---
 
 func (u *s3Upload) put(ctx context.Context, key string, body []byte) error {
@@ -323,7 +323,8 @@ func TestAttack_NilFrameFields(t *testing.T) {
 // transport. The no-op is reachable only by a caller that names it.
 //
 // This says nothing about whether a peer is AUTHENTICATED — that is
-// TestAttack_PeerImpersonation, and it is a marker.
+// TestAttack_ForgedEnvelopeRejected for what a peer sends, and
+// TestAttack_PeerImpersonation, a marker, for who it says it is.
 func TestAttack_NoTransportFallback(t *testing.T) {
 	cfg := Config{
 		Enabled:     true,
@@ -382,6 +383,12 @@ func TestAttack_ReplayOldFrame(t *testing.T) {
 // operator makes it: a cluster-internal port whose reachability is a
 // NetworkPolicy question.
 //
+// What a peer SENDS is attested under a peer key set — envelopes and catch-up
+// messages carry an Ed25519 signature (identity.go), and
+// TestAttack_ForgedEnvelopeRejected holds that. The key says a member signed
+// the frame; it does not say that member is the NodeID at the other end of
+// the connection, nor hide the frame from whoever can read the wire.
+//
 // This file used to carry an mTLS surface with SAN pinning that nothing
 // constructed. It was deleted rather than wired, because it could not be wired
 // here. The transport is a luxfi/zap node, which takes ONE *tls.Config and
@@ -402,6 +409,65 @@ func TestAttack_PeerImpersonation(t *testing.T) {
 	t.Skip(blockedReason)
 }
 
+// TestAttack_ForgedEnvelopeRejected — an envelope not signed by a member is
+// dropped before it reaches a shard.
+//
+// Threat: anything that can reach BASE_LISTEN_P2P publishes a well-formed
+// frame for a shard it names, unsigned or signed with a key of its own.
+// Invariant: under a peer key set, onPeerFrame drops both and counts them;
+// neither ingests, and the shard's seq does not move. The same frame signed
+// by a member lands.
+func TestAttack_ForgedEnvelopeRejected(t *testing.T) {
+	rng := seededRand(t)
+	_, member, _ := ed25519.GenerateKey(rng)
+	_, forger, _ := ed25519.GenerateKey(rng)
+	cfg := Config{
+		Enabled:     true,
+		ShardKey:    "user_id",
+		Replication: 2,
+		Peers:       []string{"member"},
+		NodeID:      "victim",
+		NodeKey:     member,
+		PeerKeys:    []ed25519.PublicKey{member.Public().(ed25519.PublicKey)},
+		Role:        RoleValidator,
+		Archive:     "off",
+		ListenHTTP:  ":0",
+		ListenP2P:   ":0",
+	}
+	n, err := newNodeWithTransport(cfg, nopTransport{})
+	if err != nil {
+		t.Fatalf("node: %v", err)
+	}
+	if err := n.Start(context.Background()); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	t.Cleanup(func() { _ = n.Stop(context.Background()) })
+	sh, err := n.shard("shard-forged")
+	if err != nil {
+		t.Fatalf("shard: %v", err)
+	}
+
+	env := Envelope{ShardID: "shard-forged", Frame: newFrame("shard-forged", 1, 0, []byte("forged"))}
+	n.onPeerFrame(env)
+	forged, _ := newIdentity(forger, nil)
+	n.onPeerFrame(forged.seal(env))
+
+	if got := n.metrics.FramesRejectedUnsigned.Get(); got != 1 {
+		t.Fatalf("unsigned envelope: FramesRejectedUnsigned = %v, want 1", got)
+	}
+	if got := n.metrics.FramesRejectedSignature.Get(); got != 1 {
+		t.Fatalf("envelope signed by a non-member: FramesRejectedSignature = %v, want 1", got)
+	}
+	if got := n.metrics.FramesIngested.Get(); got != 0 || sh.LocalSeq() != 0 {
+		t.Fatalf("forged envelopes reached the shard: ingested %v, seq %d", got, sh.LocalSeq())
+	}
+
+	n.onPeerFrame(n.identity.Load().seal(env))
+	if got := n.metrics.FramesIngested.Get(); got != 1 {
+		t.Fatalf("member-signed envelope: FramesIngested = %v, want 1", got)
+	}
+}
+
 // TestAttack_QuasarFloodDOS — rate-limit / backpressure on peer submits.
 //
 // Threat: attacker floods the node with valid-looking frames; the apply
@@ -684,9 +750,9 @@ func TestAttack_PITRReplayCrossShard(t *testing.T) {
 
 // TestAttack_ArchiveBucketPermissionLeak — BASE_ARCHIVE names any bucket.
 //
-// MARKER. NewArchive dispatches on scheme and accepts whatever host follows
-// it, so where a pod ships its frames is settled entirely by the value of an
-// environment variable. There is no allowlist here and this package is the
+// MARKER. NewArchive dispatches on scheme and accepts whatever bucket, or
+// file:// directory, follows it, so where a pod ships its frames is settled
+// entirely by the value of an environment variable. There is no allowlist here and this package is the
 // wrong place for one: it knows a URL, not which buckets the deployment owns.
 // That belongs to whatever writes the variable — the operator validating a
 // spec against the buckets it provisioned.
@@ -0,0 +1,654 @@
+package network
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+)
+
+// Catch-up: how a member that is behind on a shard gets level before it votes.
+//
+// A member is behind when it is handed a shard it never held — membership
+// changed and the router now names it — or comes back from being down. Quasar
+// carries only the frames broadcast while a member is listening, so without
+// this the member would wait, unbounded, in pending for frames nobody sends
+// again. Instead, the first peer frame that shows a gap on a shard it has just
+// opened, or a gap wider than catchUpLag on any shard, starts a catch-up:
+//
+//  1. The shard stops voting. Peer frames are held rather than submitted,
+//     and local commits are refused.
+//  2. The member asks the shard's other members, in router order, for what
+//     follows its applied seq. A member whose recent frames reach back that
+//     far answers with them (the tail); one whose do not answers with a
+//     snapshot — a copy of its replica as of one seq, sent in chunks with a
+//     SHA-256 digest of the whole. Frames are checked as apply checks them,
+//     and a snapshot against its digest before it replaces the replica.
+//     Rounds repeat until the member reports nothing newer.
+//  3. Failing every member, the archive is read from the applied seq on; its
+//     segments are signed, so what it yields is verified by the keys the
+//     operator trusts.
+//  4. The shard votes again from the replica's seq, and the frames held since
+//     step 1 are submitted to its engine in seq order.
+//
+// A snapshot is as trustworthy as the member that sent it: the digest catches
+// damage in transit, not a member that lies. Members are trusted the way
+// BASE_PEERS trusts them; the archive is the source to use when that is not
+// enough.
+//
+// Catch-up needs a replica to fill (ReplicaDir) and a transport that can ask
+// one peer a question (StateTransport); without them a shard waits for frames
+// as it always did.
+
+const (
+	// catchUpLag is how far ahead of the shard a peer frame must be for a
+	// shard already open to catch up rather than wait; a smaller gap is
+	// frames arriving out of order, which pending absorbs.
+	catchUpLag = 64
+
+	// catchUpRetry is how soon after one catch-up a shard may start
+	// another.
+	catchUpRetry = 30 * time.Second
+
+	// catchUpRounds bounds the requests made to one member. A member
+	// writing faster than its tail can be followed is left at that; the
+	// frames held since the catch-up began cover what came after.
+	catchUpRounds = 16
+
+	// stateChunkSize bounds the snapshot bytes, and the tail payload
+	// bytes, of one answer — well inside the transport's message limit.
+	stateChunkSize = 4 << 20
+
+	// stateRequestTimeout bounds one request to a member.
+	stateRequestTimeout = 30 * time.Second
+)
+
+// StateTransport is implemented by transports that can put a question to one
+// peer and wait for its answer, which catch-up needs and frame fan-out does
+// not. A transport without it still replicates; its members just cannot catch
+// up from each other.
+type StateTransport interface {
+	// Request sends req to peer and returns its answer. A peer that
+	// refuses answers with an error.
+	Request(ctx context.Context, peer NodeID, req StateRequest) (StateChunk, error)
+
+	// ServeState installs the handler that answers peers' requests. It is
+	// called before Start.
+	ServeState(func(StateRequest) (StateChunk, error))
+}
+
+// StateRequest asks a member for what follows From on a shard.
+type StateRequest struct {
+	ShardID string
+	// From is the requester's applied seq.
+	From uint64
+	// Snapshot and Offset continue reading a snapshot: the seq it is as of,
+	// from the first answer, and the byte to read from. Zero asks afresh.
+	Snapshot uint64
+	Offset   int64
+
+	// Key and Sig are the requester's identity and its signature over the
+	// rest; see identity.go.
+	Key ed25519.PublicKey
+	Sig []byte
+}
+
+// StateChunk is a member's answer: the frames after the requested seq, or one
+// chunk of a snapshot.
+type StateChunk struct {
+	ShardID string
+	// Seq is the member's applied seq, or for a snapshot the seq it is as
+	// of. A Seq at or below the requested From is a member with nothing
+	// newer.
+	Seq uint64
+
+	// Tail are the frames after From, in seq order. A long tail comes in
+	// parts; the last frame is where the next request starts.
+	Tail []Frame
+
+	// Snapshot is set when Data is part of a snapshot. Size, PageSize and
+	// Digest describe the whole of it and repeat in every chunk.
+	Snapshot bool
+	Size     int64
+	PageSize uint32
+	Digest   [32]byte
+	Offset   int64
+	Data     []byte
+
+	// Key and Sig are the answering member's identity and its signature
+	// over the rest.
+	Key ed25519.PublicKey
+	Sig []byte
+}
+
+// CatchUpProgress is where a shard's catch-up stands, as /-/base/members
+// reports it.
+type CatchUpProgress struct {
+	Shard string `json:"shard"`
+	// Phase is one of the CatchUp* phases.
+	Phase string `json:"phase"`
+	// Source is the member being read, or "archive".
+	Source string `json:"source,omitempty"`
+	// FromSeq is the replica's seq when the catch-up started, AppliedSeq
+	// where it is now, and TargetSeq the source's seq as last reported.
+	FromSeq    uint64 `json:"fromSeq"`
+	AppliedSeq uint64 `json:"appliedSeq"`
+	TargetSeq  uint64 `json:"targetSeq"`
+	// Bytes of a snapshot of TotalBytes received so far.
+	Bytes      int64     `json:"bytes"`
+	TotalBytes int64     `json:"totalBytes"`
+	StartedAt  time.Time `json:"startedAt"`
+	EndedAt    time.Time `json:"endedAt,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// The phases of a catch-up.
+const (
+	CatchUpStarted  = "started"
+	CatchUpTail     = "tail"
+	CatchUpSnapshot = "snapshot"
+	CatchUpArchive  = "archive"
+	CatchUpDone     = "done"
+	CatchUpFailed   = "failed"
+)
+
+// lagging reports whether a peer frame at seq shows the shard far enough
+// behind to catch up rather than wait for the frames in between: by more than
+// catchUpLag, or by any gap at all on a shard this member has only just opened
+// — one it never held, or held before a restart.
+func lagging(s *Shard, seq uint64, opened bool) bool {
+	local := s.LocalSeq()
+	if seq <= local+1 {
+		return false
+	}
+	return opened || seq > local+catchUpLag
+}
+
+// startCatchUp begins a catch-up of s into rep, unless one is running or ran
+// too recently.
+func (n *node) startCatchUp(s *Shard, rep *replica) {
+	if !s.beginCatchUp() {
+		return
+	}
+
+	n.mu.RLock()
+	ctx := n.ctx
+	n.mu.RUnlock()
+	if ctx == nil {
+		s.endCatchUp(rep.Seq())
+		return
+	}
+
+	n.metrics.CatchUpsStarted.Inc()
+	n.metrics.CatchUpsActive.Inc()
+	go n.catchUp(ctx, s, rep)
+}
+
+// catchUp fills rep from the shard's members, else the archive, then lets the
+// shard vote again.
+func (n *node) catchUp(ctx context.Context, s *Shard, rep *replica) {
+	defer n.metrics.CatchUpsActive.Dec()
+
+	progress := &CatchUpProgress{
+		Shard:      s.ID,
+		Phase:      CatchUpStarted,
+		FromSeq:    rep.Seq(),
+		AppliedSeq: rep.Seq(),
+		StartedAt:  time.Now().UTC(),
+	}
+	n.metrics.setCatchUp(*progress)
+
+	n.mu.RLock()
+	archive := n.archive
+	n.mu.RUnlock()
+
+	err := n.catchUpFromPeers(ctx, s.ID, rep, progress)
+	if err != nil && archive != nil {
+		if aerr := catchUpFromArchive(ctx, archive, n.metrics, rep, progress); aerr != nil {
+			err = errors.Join(err, fmt.Errorf("archive: %w", aerr))
+		} else {
+			err = nil
+		}
+	}
+
+	progress.AppliedSeq = rep.Seq()
+	progress.EndedAt = time.Now().UTC()
+	progress.Phase = CatchUpDone
+	if err != nil {
+		progress.Phase = CatchUpFailed
+		progress.Error = err.Error()
+		n.metrics.CatchUpFailures.Inc()
+	}
+	n.metrics.setCatchUp(*progress)
+
+	for _, f := range s.endCatchUp(rep.Seq()) {
+		if err := s.ingestRemote(f); err != nil {
+			n.metrics.ApplyErrors.Inc()
+		}
+	}
+}
+
+// catchUpFromPeers asks the shard's other members in router order until one
+// has nothing newer than the replica. It fails when none could be asked or
+// every one failed.
+func (n *node) catchUpFromPeers(ctx context.Context, shardID string, rep *replica, progress *CatchUpProgress) error {
+	st, ok := n.transport.(StateTransport)
+	if !ok {
+		return errors.New("the transport cannot address a single member")
+	}
+
+	var errs []error
+	for _, peer := range n.router.membersFor(shardID) {
+		if peer == n.id {
+			continue
+		}
+		err := n.catchUpFromPeer(ctx, st, peer, rep, progress)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", peer, err))
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("shard %q has no other member to catch up from", shardID)
+	}
+	return errors.Join(errs...)
+}
+
+// catchUpFromPeer reads from one member until it reports nothing newer than
+// the replica, or catchUpRounds runs out.
+func (n *node) catchUpFromPeer(ctx context.Context, st StateTransport, peer NodeID, rep *replica, progress *CatchUpProgress) error {
+	for range catchUpRounds {
+		from := rep.Seq()
+		chunk, err := n.requestState(ctx, st, peer, StateRequest{ShardID: rep.shardID, From: from})
+		if err != nil {
+			return err
+		}
+		if chunk.Seq <= from {
+			return nil
+		}
+
+		progress.Source = string(peer)
+		progress.TargetSeq = chunk.Seq
+
+		switch {
+		case chunk.Snapshot:
+			progress.Phase = CatchUpSnapshot
+			if err := n.fetchSnapshot(ctx, st, peer, rep, chunk, progress); err != nil {
+				return err
+			}
+		case len(chunk.Tail) > 0:
+			progress.Phase = CatchUpTail
+			for _, f := range chunk.Tail {
+				if err := rep.apply(f); err != nil {
+					return err
+				}
+				n.metrics.CatchUpFrames.Inc()
+			}
+		default:
+			return fmt.Errorf("reports seq %d and sends neither frames nor a snapshot", chunk.Seq)
+		}
+
+		progress.AppliedSeq = rep.Seq()
+		n.metrics.setCatchUp(*progress)
+	}
+	return nil
+}
+
+// fetchSnapshot reads the rest of the snapshot first begins, checks it against
+// its digest, and installs it in rep.
+func (n *node) fetchSnapshot(ctx context.Context, st StateTransport, peer NodeID, rep *replica, first StateChunk, progress *CatchUpProgress) (err error) {
+	if first.Size < 0 || (first.Size > 0 && !validPageSize(first.PageSize)) || (first.PageSize > 0 && first.Size%int64(first.PageSize) != 0) {
+		return fmt.Errorf("snapshot as of seq %d: %d bytes of %d-byte pages is not a database", first.Seq, first.Size, first.PageSize)
+	}
+
+	path := rep.path + ".incoming"
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+		if err != nil {
+			_ = os.Remove(path)
+		}
+	}()
+
+	progress.Bytes, progress.TotalBytes = 0, first.Size
+	n.metrics.setCatchUp(*progress)
+
+	h := sha256.New()
+	chunk := first
+	var off int64
+	for {
+		if chunk.Seq != first.Seq || chunk.Size != first.Size || chunk.Digest != first.Digest || chunk.Offset != off {
+			return fmt.Errorf("snapshot as of seq %d changed while it was read", first.Seq)
+		}
+		if off+int64(len(chunk.Data)) > first.Size {
+			return fmt.Errorf("snapshot as of seq %d runs past its %d bytes", first.Seq, first.Size)
+		}
+		if _, err := file.Write(chunk.Data); err != nil {
+			return err
+		}
+		h.Write(chunk.Data)
+		off += int64(len(chunk.Data))
+
+		n.metrics.CatchUpBytes.Add(float64(len(chunk.Data)))
+		progress.Bytes = off
+		n.metrics.setCatchUp(*progress)
+
+		if off == first.Size {
+			break
+		}
+		if len(chunk.Data) == 0 {
+			return fmt.Errorf("snapshot as of seq %d ends at %d of %d bytes", first.Seq, off, first.Size)
+		}
+
+		chunk, err = n.requestState(ctx, st, peer, StateRequest{
+			ShardID:  rep.shardID,
+			From:     rep.Seq(),
+			Snapshot: first.Seq,
+			Offset:   off,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if [32]byte(h.Sum(nil)) != first.Digest {
+		return fmt.Errorf("snapshot as of seq %d does not match its digest", first.Seq)
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return rep.install(path, first.Seq, first.PageSize)
+}
+
+// catchUpFromArchive applies the archived frames after the replica's seq.
+func catchUpFromArchive(ctx context.Context, archive Archive, m *Metrics, rep *replica, progress *CatchUpProgress) error {
+	progress.Source = "archive"
+	progress.Phase = CatchUpArchive
+	m.setCatchUp(*progress)
+
+	it, err := archive.Range(ctx, rep.shardID, rep.Seq()+1, math.MaxUint64)
+	if err != nil {
+		return err
+	}
+	for f, ferr := range it {
+		if ferr != nil {
+			return ferr
+		}
+		if f.Seq <= rep.Seq() {
+			continue
+		}
+		if err := rep.apply(f); err != nil {
+			return err
+		}
+		m.CatchUpFrames.Inc()
+
+		progress.AppliedSeq = f.Seq
+		progress.TargetSeq = max(progress.TargetSeq, f.Seq)
+		m.setCatchUp(*progress)
+	}
+	return nil
+}
+
+// serveState answers a member catching up on a shard this member holds, if
+// its request verifies against the peer key set, and signs the answer.
+func (n *node) serveState(req StateRequest) (StateChunk, error) {
+	id := n.identity.Load()
+	if err := id.check(stateRequestSigDomain, stateRequestBody(req), req.Key, req.Sig); err != nil {
+		n.metrics.StateRejectedSignature.Inc()
+		return StateChunk{}, fmt.Errorf("state request %w", err)
+	}
+	chunk, err := n.stateFor(req)
+	if err != nil {
+		return StateChunk{}, err
+	}
+	chunk.Key, chunk.Sig = id.sign(stateAnswerSigDomain, stateChunkBody(chunk))
+	return chunk, nil
+}
+
+func (n *node) stateFor(req StateRequest) (StateChunk, error) {
+	n.mu.RLock()
+	rep := n.replicas[req.ShardID]
+	n.mu.RUnlock()
+	if rep == nil {
+		return StateChunk{}, fmt.Errorf("no replica of shard %q here", req.ShardID)
+	}
+
+	if req.Snapshot == 0 {
+		if frames, seq, ok := rep.framesAfter(req.From, stateChunkSize); ok {
+			return StateChunk{ShardID: req.ShardID, Seq: seq, Tail: frames}, nil
+		}
+		snap, err := rep.snapshot(req.From)
+		if err != nil {
+			return StateChunk{}, err
+		}
+		req.Snapshot, req.Offset = snap.seq, 0
+	}
+
+	snap, data, err := rep.readSnapshot(req.Snapshot, req.Offset, stateChunkSize)
+	if err != nil {
+		return StateChunk{}, err
+	}
+	return StateChunk{
+		ShardID:  req.ShardID,
+		Seq:      snap.seq,
+		Snapshot: true,
+		Size:     snap.size,
+		PageSize: snap.pageSize,
+		Digest:   snap.digest,
+		Offset:   req.Offset,
+		Data:     data,
+	}, nil
+}
+
+// requestState signs req, asks peer, and checks the answer's signature.
+func (n *node) requestState(ctx context.Context, st StateTransport, peer NodeID, req StateRequest) (StateChunk, error) {
+	ctx, cancel := context.WithTimeout(ctx, stateRequestTimeout)
+	defer cancel()
+
+	id := n.identity.Load()
+	req.Key, req.Sig = id.sign(stateRequestSigDomain, stateRequestBody(req))
+	chunk, err := st.Request(ctx, peer, req)
+	if err != nil {
+		return StateChunk{}, err
+	}
+	if err := id.check(stateAnswerSigDomain, stateChunkBody(chunk), chunk.Key, chunk.Sig); err != nil {
+		n.metrics.StateRejectedSignature.Inc()
+		return StateChunk{}, fmt.Errorf("answer %w", err)
+	}
+	if chunk.ShardID != req.ShardID {
+		return StateChunk{}, fmt.Errorf("answered for shard %q, not %q", chunk.ShardID, req.ShardID)
+	}
+	return chunk, nil
+}
+
+func validPageSize(size uint32) bool {
+	return size >= minPageSize && size <= maxPageSize && size&(size-1) == 0
+}
+
+// Wire forms, for transports that carry bytes. Both lead with a version byte
+// and end with the sender's key and signature (see identity.go), each
+// length-prefixed and empty when unsigned.
+//
+//	request  [ver:1][shardIDLen:2][shardID][from:8][snapshot:8][offset:8]
+//	         [keyLen:1][key][sigLen:1][sig]
+//	answer   [ver:1][errLen:2][err][shardIDLen:2][shardID][seq:8][snapshot:1]
+//	         [size:8][pageSize:4][digest:32][offset:8][dataLen:4][data]
+//	         [frames:4] repeat [frameLen:4][frame]
+//	         [keyLen:1][key][sigLen:1][sig]
+//
+// A frame is Frame.encode's output. An answer with a non-empty err carries
+// nothing else and decodes to that error. A signature covers what lies
+// between the version (in an answer, the err) and the key.
+
+const stateWireVersion = 2
+
+// stateRequestBody is the signed part of a request's wire form.
+func stateRequestBody(req StateRequest) []byte {
+	b := appendU16(nil, uint16(len(req.ShardID)))
+	b = append(b, req.ShardID...)
+	b = appendU64(b, req.From)
+	b = appendU64(b, req.Snapshot)
+	return appendU64(b, uint64(req.Offset))
+}
+
+func encodeStateRequest(req StateRequest) []byte {
+	b := append([]byte{stateWireVersion}, stateRequestBody(req)...)
+	return appendKeySig(b, req.Key, req.Sig)
+}
+
+func decodeStateRequest(b []byte) (StateRequest, error) {
+	r := wireReader{b: b}
+	if v := r.u8(); r.err == nil && v != stateWireVersion {
+		return StateRequest{}, fmt.Errorf("state request: unknown version %d", v)
+	}
+	req := StateRequest{
+		ShardID:  string(r.bytes(int(r.u16()))),
+		From:     r.u64(),
+		Snapshot: r.u64(),
+		Offset:   int64(r.u64()),
+	}
+	req.Key, req.Sig = r.keySig()
+	if r.err == nil && len(r.b) > 0 {
+		r.err = errors.New("trailing bytes")
+	}
+	if r.err != nil {
+		return StateRequest{}, fmt.Errorf("state request: %w", r.err)
+	}
+	return req, nil
+}
+
+// stateChunkBody is the signed part of an answer's wire form.
+func stateChunkBody(chunk StateChunk) []byte {
+	b := appendU16(nil, uint16(len(chunk.ShardID)))
+	b = append(b, chunk.ShardID...)
+	b = appendU64(b, chunk.Seq)
+	if chunk.Snapshot {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = appendU64(b, uint64(chunk.Size))
+	b = appendU32(b, chunk.PageSize)
+	b = append(b, chunk.Digest[:]...)
+	b = appendU64(b, uint64(chunk.Offset))
+	b = appendU32(b, uint32(len(chunk.Data)))
+	b = append(b, chunk.Data...)
+	b = appendU32(b, uint32(len(chunk.Tail)))
+	for _, f := range chunk.Tail {
+		enc := f.encode()
+		b = appendU32(b, uint32(len(enc)))
+		b = append(b, enc...)
+	}
+	return b
+}
+
+// encodeStateAnswer encodes chunk, or err when it is not nil.
+func encodeStateAnswer(chunk StateChunk, err error) []byte {
+	b := []byte{stateWireVersion}
+	if err != nil {
+		msg := err.Error()
+		if len(msg) > math.MaxUint16 {
+			msg = msg[:math.MaxUint16]
+		}
+		b = appendU16(b, uint16(len(msg)))
+		return append(b, msg...)
+	}
+	b = appendU16(b, 0)
+	b = append(b, stateChunkBody(chunk)...)
+	return appendKeySig(b, chunk.Key, chunk.Sig)
+}
+
+func decodeStateAnswer(b []byte) (StateChunk, error) {
+	r := wireReader{b: b}
+	if v := r.u8(); r.err == nil && v != stateWireVersion {
+		return StateChunk{}, fmt.Errorf("state answer: unknown version %d", v)
+	}
+	if msg := r.bytes(int(r.u16())); r.err == nil && len(msg) > 0 {
+		return StateChunk{}, fmt.Errorf("refused: %s", msg)
+	}
+
+	chunk := StateChunk{
+		ShardID:  string(r.bytes(int(r.u16()))),
+		Seq:      r.u64(),
+		Snapshot: r.u8() == 1,
+		Size:     int64(r.u64()),
+		PageSize: r.u32(),
+		Digest:   [32]byte(r.bytes(32)),
+		Offset:   int64(r.u64()),
+	}
+	chunk.Data = append([]byte(nil), r.bytes(int(r.u32()))...)
+
+	count := r.u32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		f, err := decodeFrame(r.bytes(int(r.u32())))
+		if err != nil && r.err == nil {
+			r.err = err
+		}
+		chunk.Tail = append(chunk.Tail, f)
+	}
+	chunk.Key, chunk.Sig = r.keySig()
+	if r.err == nil && len(r.b) > 0 {
+		r.err = errors.New("trailing bytes")
+	}
+	if r.err != nil {
+		return StateChunk{}, fmt.Errorf("state answer: %w", r.err)
+	}
+	return chunk, nil
+}
+
+func appendKeySig(b []byte, key ed25519.PublicKey, sig []byte) []byte {
+	b = append(b, byte(len(key)))
+	b = append(b, key...)
+	b = append(b, byte(len(sig)))
+	return append(b, sig...)
+}
+
+// wireReader reads big-endian fields off b, remembering the first overrun so a
+// decoder checks once at the end. Past an overrun a fixed-size field reads as
+// zeros and a variable one as nothing — never a buffer as long as a length
+// the input claimed.
+type wireReader struct {
+	b   []byte
+	err error
+}
+
+func (r *wireReader) bytes(n int) []byte {
+	if r.err == nil && (n < 0 || n > len(r.b)) {
+		r.err = errors.New("truncated")
+	}
+	if r.err != nil {
+		if n >= 0 && n <= 32 {
+			return make([]byte, n)
+		}
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *wireReader) u8() uint8   { return r.bytes(1)[0] }
+func (r *wireReader) u16() uint16 { return binary.BigEndian.Uint16(r.bytes(2)) }
+func (r *wireReader) u32() uint32 { return binary.BigEndian.Uint32(r.bytes(4)) }
+func (r *wireReader) u64() uint64 { return binary.BigEndian.Uint64(r.bytes(8)) }
+
+// keySig reads a key and signature as appendKeySig writes them, each nil when
+// empty.
+func (r *wireReader) keySig() (ed25519.PublicKey, []byte) {
+	var key, sig []byte
+	if n := int(r.u8()); n > 0 {
+		key = append([]byte(nil), r.bytes(n)...)
+	}
+	if n := int(r.u8()); n > 0 {
+		sig = append([]byte(nil), r.bytes(n)...)
+	}
+	return key, sig
+}
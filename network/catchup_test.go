@@ -0,0 +1,427 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Request and ServeState make memoryTransport a StateTransport. The request
+// and the answer go through their wire forms, as they do between processes.
+func (t *memoryTransport) Request(_ context.Context, peer NodeID, req StateRequest) (StateChunk, error) {
+	t.hub.mu.RLock()
+	p := t.hub.nodes[peer]
+	t.hub.mu.RUnlock()
+	if p == nil {
+		return StateChunk{}, fmt.Errorf("no route to %s", peer)
+	}
+	p.mu.Lock()
+	serve, closed := p.serve, p.closed
+	p.mu.Unlock()
+	if serve == nil || closed {
+		return StateChunk{}, fmt.Errorf("%s is not serving", peer)
+	}
+
+	decoded, err := decodeStateRequest(encodeStateRequest(req))
+	if err != nil {
+		return StateChunk{}, err
+	}
+	return decodeStateAnswer(encodeStateAnswer(serve(decoded)))
+}
+
+func (t *memoryTransport) ServeState(serve func(StateRequest) (StateChunk, error)) {
+	t.mu.Lock()
+	t.serve = serve
+	t.mu.Unlock()
+}
+
+// chainFrames returns frames 1..n of shardID, frame i filling page 1 of a
+// one-page database with byte i.
+func chainFrames(shardID string, n int) []Frame {
+	frames := make([]Frame, n)
+	for i := range frames {
+		seq := uint64(i + 1)
+		frames[i] = newFrame(shardID, seq, seq-1, pagePayload(1, map[uint32]byte{1: byte(seq)}))
+	}
+	return frames
+}
+
+func TestStateWireRoundTrip(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	req := StateRequest{ShardID: "org/1", From: 7, Snapshot: 9, Offset: 4096, Key: pub, Sig: []byte("sig")}
+	gotReq, err := decodeStateRequest(encodeStateRequest(req))
+	if err != nil || gotReq.ShardID != req.ShardID || gotReq.From != req.From || gotReq.Snapshot != req.Snapshot ||
+		gotReq.Offset != req.Offset || !pub.Equal(gotReq.Key) || string(gotReq.Sig) != "sig" {
+		t.Fatalf("request: %+v, %v", gotReq, err)
+	}
+
+	chunk := StateChunk{
+		ShardID:  "org/1",
+		Seq:      9,
+		Tail:     chainFrames("org/1", 2),
+		Snapshot: true,
+		Size:     8192,
+		PageSize: minPageSize,
+		Digest:   [32]byte{1, 2, 3},
+		Offset:   4096,
+		Data:     []byte("pages"),
+		Key:      pub,
+		Sig:      []byte("sig"),
+	}
+	got, err := decodeStateAnswer(encodeStateAnswer(chunk, nil))
+	if err != nil {
+		t.Fatalf("answer: %v", err)
+	}
+	if got.ShardID != chunk.ShardID || got.Seq != chunk.Seq || !got.Snapshot || got.Size != chunk.Size ||
+		got.PageSize != chunk.PageSize || got.Digest != chunk.Digest || got.Offset != chunk.Offset || !bytes.Equal(got.Data, chunk.Data) ||
+		!pub.Equal(got.Key) || string(got.Sig) != "sig" {
+		t.Fatalf("answer: %+v", got)
+	}
+	if len(got.Tail) != 2 || got.Tail[1].Seq != 2 || got.Tail[1].Valid() != nil {
+		t.Fatalf("tail: %+v", got.Tail)
+	}
+
+	if _, err := decodeStateAnswer(encodeStateAnswer(StateChunk{}, errors.New("no replica"))); err == nil || !strings.Contains(err.Error(), "no replica") {
+		t.Fatalf("refusal decoded as %v", err)
+	}
+
+	enc := encodeStateAnswer(chunk, nil)
+	for _, n := range []int{0, 1, 10, len(enc) - 1} {
+		if _, err := decodeStateAnswer(enc[:n]); err == nil {
+			t.Fatalf("answer cut to %d bytes decoded", n)
+		}
+	}
+	if _, err := decodeStateRequest(append(encodeStateRequest(req), 0)); err == nil {
+		t.Fatal("request with trailing bytes decoded")
+	}
+}
+
+func TestReplicaServesTailAndSnapshot(t *testing.T) {
+	src, err := openReplica(t.TempDir(), "s", NewMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = src.close() })
+	for _, f := range chainFrames("s", 5) {
+		if err := src.apply(f); err != nil {
+			t.Fatalf("apply %d: %v", f.Seq, err)
+		}
+	}
+
+	frames, seq, ok := src.framesAfter(2, tailBytes)
+	if !ok || seq != 5 || len(frames) != 3 || frames[0].Seq != 3 {
+		t.Fatalf("frames after 2: %d frames, seq %d, %v", len(frames), seq, ok)
+	}
+	if frames, _, ok := src.framesAfter(0, 1); !ok || len(frames) != 1 {
+		t.Fatalf("a budget below one frame still sends one: %d frames, %v", len(frames), ok)
+	}
+
+	// recent frames gone: only a snapshot will do
+	src.mu.Lock()
+	src.recent, src.recentBytes = src.recent[3:], 0
+	src.mu.Unlock()
+	if _, _, ok := src.framesAfter(2, tailBytes); ok {
+		t.Fatal("framesAfter claimed frames it no longer has")
+	}
+
+	snap, err := src.snapshot(2)
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snap.seq != 5 || snap.size != minPageSize {
+		t.Fatalf("snapshot: seq %d, %d bytes", snap.seq, snap.size)
+	}
+	if again, _ := src.snapshot(2); again != snap {
+		t.Fatal("a fresh snapshot was copied again")
+	}
+
+	var data []byte
+	for off := int64(0); off < snap.size; {
+		_, b, err := src.readSnapshot(snap.seq, off, 1000)
+		if err != nil {
+			t.Fatalf("read at %d: %v", off, err)
+		}
+		data = append(data, b...)
+		off += int64(len(b))
+	}
+	if _, _, err := src.readSnapshot(4, 0, 10); err == nil {
+		t.Fatal("read a snapshot as of a seq never taken")
+	}
+
+	dst, err := openReplica(t.TempDir(), "s", NewMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = dst.close() })
+	incoming := dst.path + ".incoming"
+	if err := os.WriteFile(incoming, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.install(incoming, snap.seq, snap.pageSize); err != nil {
+		t.Fatalf("install: %v", err)
+	}
+	if dst.Seq() != 5 {
+		t.Fatalf("installed seq = %d, want 5", dst.Seq())
+	}
+	if err := dst.apply(newFrame("s", 6, 5, pagePayload(1, map[uint32]byte{1: 6}))); err != nil {
+		t.Fatalf("apply after install: %v", err)
+	}
+	if err := dst.install(incoming, 3, minPageSize); err == nil {
+		t.Fatal("installed a snapshot behind the replica")
+	}
+}
+
+// catchUpPair starts member a, holding shard "s" up to seq 5 in its replica,
+// and member b, which has never seen the shard.
+func catchUpPair(t *testing.T, dropTail bool) (a, b *node) {
+	t.Helper()
+	hub := newMemoryHub()
+	start := func(id, peer string) *node {
+		cfg := Config{
+			Enabled:     true,
+			ShardKey:    "user_id",
+			Replication: 2,
+			Peers:       []string{peer},
+			NodeID:      id,
+			Role:        RoleValidator,
+			Archive:     "off",
+			ReplicaDir:  t.TempDir(),
+			ListenHTTP:  ":0",
+			ListenP2P:   ":0",
+		}
+		n, err := newNodeWithTransport(cfg, hub.connect(NodeID(id)))
+		if err != nil {
+			t.Fatalf("node %s: %v", id, err)
+		}
+		if err := n.Start(context.Background()); err != nil {
+			t.Fatalf("node %s start: %v", id, err)
+		}
+		t.Cleanup(func() { _ = n.Stop(context.Background()) })
+		return n
+	}
+	a = start("a", "b")
+	b = start("b", "a")
+
+	if _, err := a.shard("s"); err != nil {
+		t.Fatal(err)
+	}
+	rep := a.replicaOf("s")
+	for _, f := range chainFrames("s", 5) {
+		if err := rep.apply(f); err != nil {
+			t.Fatalf("apply %d: %v", f.Seq, err)
+		}
+	}
+	if dropTail {
+		rep.mu.Lock()
+		rep.recent, rep.recentBytes = nil, 0
+		rep.mu.Unlock()
+	}
+	return a, b
+}
+
+// waitCaughtUp waits for n's replica of "s" to reach seq and its catch-up to
+// end, and returns how that catch-up went.
+func waitCaughtUp(t *testing.T, n *node, seq uint64) CatchUpProgress {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		applied, _ := n.Metrics().AppliedSeq("s")
+		p, _ := n.Metrics().CatchUp("s")
+		if applied >= seq && (p.Phase == CatchUpDone || p.Phase == CatchUpFailed) {
+			return p
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout: applied seq %d, want %d; catch-up %+v", applied, seq, p)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNodeCatchUp(t *testing.T) {
+	scenarios := []struct {
+		name      string
+		dropTail  bool
+		wantBytes bool
+	}{
+		{"tail", false, false},
+		{"snapshot", true, true},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			a, b := catchUpPair(t, s.dropTail)
+
+			// the next commit on a reaches b, which sees seq 6 on a shard
+			// it has only just opened
+			f6 := newFrame("s", 6, 5, pagePayload(1, map[uint32]byte{1: 6}))
+			if err := a.transport.Publish(Envelope{ShardID: "s", Frame: f6}); err != nil {
+				t.Fatal(err)
+			}
+
+			p := waitCaughtUp(t, b, 6)
+			if p.Phase != CatchUpDone || p.Source != "a" || p.FromSeq != 0 || p.TargetSeq != 5 {
+				t.Fatalf("catch-up: %+v", p)
+			}
+			if got := b.Metrics().CatchUpBytes.Get() > 0; got != s.wantBytes {
+				t.Fatalf("snapshot bytes received = %v, want %v", b.Metrics().CatchUpBytes.Get(), s.wantBytes)
+			}
+			if got := b.Metrics().CatchUpsStarted.Get(); got != 1 {
+				t.Fatalf("catch-ups started = %v, want 1", got)
+			}
+			if got := b.Metrics().CatchUpsActive.Get(); got != 0 {
+				t.Fatalf("catch-ups active = %v, want 0", got)
+			}
+
+			sb, _ := b.shard("s")
+			if sb.CatchingUp() || sb.LocalSeq() != 6 {
+				t.Fatalf("shard after catch-up: catching up %v, seq %d", sb.CatchingUp(), sb.LocalSeq())
+			}
+			got, _ := os.ReadFile(filepath.Join(b.cfg.ReplicaDir, "s.db"))
+			if !bytes.Equal(got, bytes.Repeat([]byte{6}, minPageSize)) {
+				t.Fatalf("b's replica is not page 6 (%d bytes)", len(got))
+			}
+		})
+	}
+}
+
+// With no member able to serve, the archive fills the replica.
+func TestNodeCatchUpFromArchive(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	up := newMemUploader()
+	archiveFrames(t, up, priv, chainFrames("s", 5)...)
+	reader := newArchiveWriter(up, "svc", ArchiveConfig{SigningKey: priv}, nil)
+
+	cfg := Config{
+		Enabled:     true,
+		ShardKey:    "user_id",
+		Replication: 2,
+		Peers:       []string{"gone"},
+		NodeID:      "b",
+		Role:        RoleValidator,
+		Archive:     "off",
+		ReplicaDir:  t.TempDir(),
+		ListenHTTP:  ":0",
+		ListenP2P:   ":0",
+	}
+	b, err := newNodeWithTransport(cfg, newMemoryHub().connect("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetArchive(b, reader)
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Stop(context.Background()) })
+
+	b.onPeerFrame(Envelope{ShardID: "s", Frame: newFrame("s", 6, 5, pagePayload(1, map[uint32]byte{1: 6}))})
+
+	p := waitCaughtUp(t, b, 6)
+	if p.Phase != CatchUpDone || p.Source != "archive" || p.AppliedSeq != 5 {
+		t.Fatalf("catch-up: %+v", p)
+	}
+	if got := b.Metrics().CatchUpFrames.Get(); got != 5 {
+		t.Fatalf("frames caught up = %v, want 5", got)
+	}
+}
+
+// A member that can reach no source still votes again afterwards, and says
+// why it is behind.
+func TestNodeCatchUpFails(t *testing.T) {
+	cfg := Config{
+		Enabled:     true,
+		ShardKey:    "user_id",
+		Replication: 2,
+		Peers:       []string{"gone"},
+		NodeID:      "b",
+		Role:        RoleValidator,
+		Archive:     "off",
+		ReplicaDir:  t.TempDir(),
+		ListenHTTP:  ":0",
+		ListenP2P:   ":0",
+	}
+	b, err := newNodeWithTransport(cfg, newMemoryHub().connect("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Stop(context.Background()) })
+
+	b.onPeerFrame(Envelope{ShardID: "s", Frame: newFrame("s", 6, 5, nil)})
+
+	p := waitCaughtUp(t, b, 0)
+	if p.Phase != CatchUpFailed || !strings.Contains(p.Error, "no route to gone") {
+		t.Fatalf("catch-up: %+v", p)
+	}
+	if got := b.Metrics().CatchUpFailures.Get(); got != 1 {
+		t.Fatalf("catch-up failures = %v, want 1", got)
+	}
+	sb, _ := b.shard("s")
+	if sb.CatchingUp() {
+		t.Fatal("shard still catching up after the catch-up failed")
+	}
+
+	// the next frame does not start another straight away
+	b.onPeerFrame(Envelope{ShardID: "s", Frame: newFrame("s", 7, 6, nil)})
+	if got := b.Metrics().CatchUpsStarted.Get(); got != 1 {
+		t.Fatalf("catch-ups started = %v, want 1", got)
+	}
+}
+
+// A frame the replica failed to take is tried again, and a replica left
+// missing one catches up rather than refusing every frame after it.
+func TestNodeRecoversFromFailedApply(t *testing.T) {
+	t.Run("retry", func(t *testing.T) {
+		_, b := catchUpPair(t, false)
+		if _, err := b.shard("s"); err != nil {
+			t.Fatal(err)
+		}
+		rep := b.replicaOf("s")
+		apply := b.onLocalApply("s", rep)
+
+		// the watermark cannot be written until the directory in its way goes
+		tmp := rep.path + ".seq.tmp"
+		if err := os.Mkdir(tmp, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(replicaApplyRetry/2, func() { _ = os.Remove(tmp) })
+
+		if err := apply(chainFrames("s", 1)[0]); err != nil {
+			t.Fatalf("apply: %v", err)
+		}
+		if rep.Seq() != 1 {
+			t.Fatalf("replica seq = %d, want 1", rep.Seq())
+		}
+		if got := b.Metrics().CatchUpsStarted.Get(); got != 0 {
+			t.Fatalf("catch-ups started = %v, want 0", got)
+		}
+	})
+
+	t.Run("catch-up", func(t *testing.T) {
+		_, b := catchUpPair(t, false)
+		if _, err := b.shard("s"); err != nil {
+			t.Fatal(err)
+		}
+		apply := b.onLocalApply("s", b.replicaOf("s"))
+
+		// frames 1 and 2 never landed
+		if err := apply(chainFrames("s", 3)[2]); !errors.Is(err, errReplicaBehind) {
+			t.Fatalf("apply of frame 3 = %v, want errReplicaBehind", err)
+		}
+
+		p := waitCaughtUp(t, b, 5)
+		if p.Phase != CatchUpDone || p.Source != "a" || p.TargetSeq != 5 {
+			t.Fatalf("catch-up: %+v", p)
+		}
+		if seq, _, err := readWatermark(filepath.Join(b.cfg.ReplicaDir, "s.db.seq")); err != nil || seq != 5 {
+			t.Fatalf("persisted watermark = %d (%v), want 5", seq, err)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package network
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"os"
 	"strconv"
@@ -27,11 +28,24 @@ type Config struct {
 	// emitted by the operator; in compose they are static service names.
 	// host:port form, p2p port not HTTP port.
 	//
-	// It is also the trust set. The transport establishes no identity of its
-	// own, so membership of this list is what a peer has, and every entry may
-	// submit frames for any shard this node owns.
+	// Without PeerKeys it is also the trust set. The transport establishes
+	// no identity of its own, so membership of this list is what a peer
+	// has, and every entry may submit frames for any shard this node owns.
 	Peers []string
 
+	// NodeKey is this member's Ed25519 identity key, which signs every
+	// envelope it publishes (BASE_NODE_KEY, hex or base64, the 32-byte
+	// seed or the 64-byte private key). See identity.go.
+	NodeKey ed25519.PrivateKey
+
+	// PeerKeys are the Ed25519 public keys whose envelopes this member
+	// accepts (BASE_PEER_KEYS, comma-separated, hex or base64). When set,
+	// an envelope without a signature by one of them — or by NodeKey — is
+	// dropped, and reaching the p2p port stops being enough to submit
+	// frames. A key being rotated in and the key it replaces both belong
+	// here while members move over. Requires NodeKey.
+	PeerKeys []ed25519.PublicKey
+
 	// NodeID is the local member identity. Defaults to $HOSTNAME; overridable
 	// via BASE_NODE_ID for tests and compose.
 	NodeID string
@@ -40,10 +54,23 @@ type Config struct {
 	// they subscribe to finalized frames and append to cold storage.
 	Role NodeRole
 
-	// Archive is the cold-storage URL or "off". s3://bucket/prefix is
-	// the only scheme; see NewArchive in archive.go.
+	// Archive is the cold-storage URL or "off": s3://bucket/prefix, or
+	// file:///path for a local directory; see NewArchive in archive.go.
 	Archive string
 
+	// ArchiveTrustedKeys are the Ed25519 public keys whose archive segments
+	// a restore accepts (BASE_ARCHIVE_TRUSTED_KEYS, comma-separated, hex or
+	// base64). The writer's current key and any it has rotated away from
+	// both belong here.
+	ArchiveTrustedKeys []ed25519.PublicKey
+
+	// ReplicaDir is where this member materialises each shard it holds:
+	// <ReplicaDir>/<shard>.db and its applied-seq watermark
+	// (BASE_REPLICA_DIR). Empty keeps finalised frames in consensus only,
+	// which is what the in-process tests want; base/core fills it in under
+	// the app's data dir when the env leaves it unset.
+	ReplicaDir string
+
 	// ListenHTTP is the Base HTTP listen address. Used only for the
 	// /-/base/members endpoint by the Gateway; main HTTP comes from core.
 	ListenHTTP string
@@ -82,10 +109,11 @@ var tlsNames = []string{
 }
 
 // ConfigFromEnv reads BASE_NETWORK, BASE_SHARD_KEY, BASE_REPLICATION,
-// BASE_PEERS, BASE_NODE_ROLE, BASE_ARCHIVE, BASE_LISTEN_HTTP, BASE_LISTEN_P2P,
-// and BASE_SHARD_BACKLOG_MAX / BASE_SHARD_BACKLOG_SEGMENTS (R6 per-shard
-// backlog caps — the archive config is built separately from these by
-// base/core's startup path).
+// BASE_PEERS, BASE_NODE_KEY, BASE_PEER_KEYS, BASE_NODE_ROLE, BASE_ARCHIVE,
+// BASE_ARCHIVE_TRUSTED_KEYS,
+// BASE_REPLICA_DIR, BASE_LISTEN_HTTP, BASE_LISTEN_P2P, and BASE_SHARD_BACKLOG_MAX /
+// BASE_SHARD_BACKLOG_SEGMENTS (R6 per-shard backlog caps — the archive config
+// is built separately from these by base/core's startup path).
 // Standalone defaults are safe: no error, Enabled==false.
 func ConfigFromEnv() (Config, error) {
 	mode := strings.ToLower(strings.TrimSpace(os.Getenv("BASE_NETWORK")))
@@ -95,6 +123,7 @@ func ConfigFromEnv() (Config, error) {
 		NodeID:     envOr("BASE_NODE_ID", os.Getenv("HOSTNAME")),
 		Role:       NodeRole(envOr("BASE_NODE_ROLE", string(RoleValidator))),
 		Archive:    envOr("BASE_ARCHIVE", "off"),
+		ReplicaDir: os.Getenv("BASE_REPLICA_DIR"),
 		ListenHTTP: envOr("BASE_LISTEN_HTTP", ":8090"),
 		ListenP2P:  envOr("BASE_LISTEN_P2P", ":9999"),
 	}
@@ -118,6 +147,30 @@ func ConfigFromEnv() (Config, error) {
 		}
 	}
 
+	if v := strings.TrimSpace(os.Getenv("BASE_NODE_KEY")); v != "" {
+		key, err := ParseNodeKey(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("BASE_NODE_KEY: %w", err)
+		}
+		cfg.NodeKey = key
+	}
+
+	if v := strings.TrimSpace(os.Getenv("BASE_PEER_KEYS")); v != "" {
+		keys, err := parsePublicKeys(v, "peer key")
+		if err != nil {
+			return Config{}, fmt.Errorf("BASE_PEER_KEYS: %w", err)
+		}
+		cfg.PeerKeys = keys
+	}
+
+	if v := strings.TrimSpace(os.Getenv("BASE_ARCHIVE_TRUSTED_KEYS")); v != "" {
+		keys, err := ParseSegmentKeys(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("BASE_ARCHIVE_TRUSTED_KEYS: %w", err)
+		}
+		cfg.ArchiveTrustedKeys = keys
+	}
+
 	if mode != "" && mode != "quasar" && mode != "standalone" {
 		return Config{}, fmt.Errorf("BASE_NETWORK=%q: must be 'quasar' or 'standalone'", mode)
 	}
@@ -138,7 +191,7 @@ func ConfigFromEnv() (Config, error) {
 	// peer plane, and the only honest answers are to meet it or to say so.
 	for _, k := range tlsNames {
 		if v := strings.TrimSpace(os.Getenv(k)); v != "" {
-			return Config{}, fmt.Errorf("%s=%q: not a setting. Peers authenticate by reachability, so BASE_PEERS is the whole trust set: every host in it may submit frames for any shard this node owns. Keep it to peers of the same service in the same namespace, and decide what reaches BASE_LISTEN_P2P with a NetworkPolicy", k, v)
+			return Config{}, fmt.Errorf("%s=%q: not a setting. The peer transport presents no certificate. Peers authenticate envelopes with BASE_NODE_KEY and BASE_PEER_KEYS; without those, BASE_PEERS is the whole trust set and every host in it may submit frames for any shard this node owns. Either way, decide what reaches BASE_LISTEN_P2P with a NetworkPolicy", k, v)
 		}
 	}
 
@@ -166,6 +219,9 @@ func (c Config) validate() error {
 	if strings.TrimSpace(c.NodeID) == "" {
 		return fmt.Errorf("BASE_NODE_ID or $HOSTNAME must be set when BASE_NETWORK=quasar")
 	}
+	if len(c.PeerKeys) > 0 && c.NodeKey == nil {
+		return fmt.Errorf("BASE_PEER_KEYS requires BASE_NODE_KEY: every member holding the set would reject the unsigned frames this one sends")
+	}
 	return nil
 }
 
@@ -0,0 +1,258 @@
+package network
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Peer identity: who may put a frame into this member's shards.
+//
+// A peer is whatever answers at an address in BASE_PEERS, and the NodeID it
+// states in the transport handshake is its own word. With an identity key
+// (BASE_NODE_KEY) a member signs every envelope it publishes, and with a peer
+// key set (BASE_PEER_KEYS) it accepts only envelopes signed by one of those
+// keys — so reaching the p2p port is no longer enough to submit frames. The
+// signature covers the routed shard and the whole encoded frame, under a
+// domain tag of its own, so it can be neither moved to another shard nor
+// replayed as some other signed thing.
+//
+// A member's own key is always trusted. Without a peer key set a member
+// verifies nothing and BASE_PEERS stays the trust set, as it was; unsigned
+// envelopes are accepted then, and signed ones are too, whoever signed them.
+//
+// Keys rotate without a flag day, the way archive segment keys do:
+//
+//  1. add the new public key to BASE_PEER_KEYS on every member;
+//  2. move the member to the new BASE_NODE_KEY;
+//  3. drop the old public key from BASE_PEER_KEYS.
+//
+// Each step is a rolling restart, or a RotateIdentity call where the keys
+// come from somewhere that can change under a running process.
+//
+// Catch-up (catchup.go) is signed the same way: a request names the member
+// asking, and a member with a peer key set serves no state to a key outside
+// it — a snapshot is the whole shard — and takes none from one. Each kind of
+// message has its own domain tag.
+
+// Signature domains keep a signature over one kind of message from standing
+// for another.
+const (
+	envelopeSigDomain     = "base-network/envelope/v1"
+	stateRequestSigDomain = "base-network/state-request/v1"
+	stateAnswerSigDomain  = "base-network/state-answer/v1"
+)
+
+var (
+	errUnsigned  = errors.New("unsigned")
+	errUntrusted = errors.New("signed by a key not in the peer key set")
+	errSignature = errors.New("signature does not verify")
+)
+
+// identity is a member's signing key and the keys it accepts messages from.
+type identity struct {
+	key ed25519.PrivateKey
+	// trusted is nil when no peer key set is configured, and then nothing
+	// is verified.
+	trusted map[[ed25519.PublicKeySize]byte]struct{}
+}
+
+// newIdentity checks key and trusted and builds the identity from them. Either
+// may be empty; a peer key set without a key to sign with is refused, since
+// every member holding that set would refuse what this one sends.
+func newIdentity(key ed25519.PrivateKey, trusted []ed25519.PublicKey) (*identity, error) {
+	if key != nil && len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("identity key: want %d bytes, got %d", ed25519.PrivateKeySize, len(key))
+	}
+	if len(trusted) > 0 && key == nil {
+		return nil, errors.New("a peer key set without an identity key: peers holding the set would reject every frame this member sends")
+	}
+
+	id := &identity{key: key}
+	if len(trusted) > 0 {
+		id.trusted = make(map[[ed25519.PublicKeySize]byte]struct{}, len(trusted)+1)
+		for _, pub := range trusted {
+			if len(pub) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("peer key: want %d bytes, got %d", ed25519.PublicKeySize, len(pub))
+			}
+			id.trusted[[ed25519.PublicKeySize]byte(pub)] = struct{}{}
+		}
+		id.trusted[[ed25519.PublicKeySize]byte(key.Public().(ed25519.PublicKey))] = struct{}{}
+	}
+	return id, nil
+}
+
+// sign signs body under domain, returning the key and signature to send with
+// it. Without an identity key both are nil and the message goes unsigned.
+func (id *identity) sign(domain string, body []byte) (ed25519.PublicKey, []byte) {
+	if id == nil || id.key == nil {
+		return nil, nil
+	}
+	return id.key.Public().(ed25519.PublicKey), ed25519.Sign(id.key, signedMessage(domain, body))
+}
+
+// check verifies key and sig over body against the peer key set. Without a
+// set, anything passes.
+func (id *identity) check(domain string, body []byte, key ed25519.PublicKey, sig []byte) error {
+	if id == nil || id.trusted == nil {
+		return nil
+	}
+	if len(key) == 0 && len(sig) == 0 {
+		return errUnsigned
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return errUntrusted
+	}
+	if _, ok := id.trusted[[ed25519.PublicKeySize]byte(key)]; !ok {
+		return errUntrusted
+	}
+	if !ed25519.Verify(key, signedMessage(domain, body), sig) {
+		return errSignature
+	}
+	return nil
+}
+
+func signedMessage(domain string, body []byte) []byte {
+	b := make([]byte, 0, len(domain)+len(body))
+	b = append(b, domain...)
+	return append(b, body...)
+}
+
+// seal signs env with the identity key.
+func (id *identity) seal(env Envelope) Envelope {
+	env.Key, env.Sig = id.sign(envelopeSigDomain, envelopeBody(env))
+	return env
+}
+
+// verify checks env against the peer key set.
+func (id *identity) verify(env Envelope) error {
+	return id.check(envelopeSigDomain, envelopeBody(env), env.Key, env.Sig)
+}
+
+// envelopeBody is what an envelope's signature covers:
+//
+//	[shardIDLen:2][shardID][frame]
+//
+// where frame is Frame.encode's output.
+func envelopeBody(env Envelope) []byte {
+	frame := env.Frame.encode()
+	b := make([]byte, 0, 2+len(env.ShardID)+len(frame))
+	b = appendU16(b, uint16(len(env.ShardID)))
+	b = append(b, env.ShardID...)
+	return append(b, frame...)
+}
+
+// RotateIdentity replaces a running member's identity key and peer key set,
+// for keys held somewhere that can change under the process. Envelopes in
+// flight are verified against whichever set is current when they arrive, so
+// a rotation keeps the outgoing key in the set until every member signs with
+// the new one (see the steps above). A no-op on a disabled Network.
+func RotateIdentity(n Network, key ed25519.PrivateKey, trusted []ed25519.PublicKey) error {
+	nn, ok := n.(*node)
+	if !ok {
+		return nil
+	}
+	id, err := newIdentity(key, trusted)
+	if err != nil {
+		return fmt.Errorf("network: %w", err)
+	}
+	nn.identity.Store(id)
+	return nil
+}
+
+// ParseNodeKey reads an Ed25519 private key, hex or standard base64: the
+// 32-byte seed, or the 64-byte seed-and-public-key form.
+func ParseNodeKey(s string) (ed25519.PrivateKey, error) {
+	s = strings.TrimSpace(s)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		b, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil {
+		return nil, errors.New("node key: want an Ed25519 private key, hex or base64")
+	}
+	switch len(b) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(b), nil
+	case ed25519.PrivateKeySize:
+		key := ed25519.PrivateKey(b)
+		if !ed25519.NewKeyFromSeed(b[:ed25519.SeedSize]).Equal(key) {
+			return nil, errors.New("node key: the public half does not match the seed")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("node key: want a %d-byte seed or a %d-byte private key, got %d bytes", ed25519.SeedSize, ed25519.PrivateKeySize, len(b))
+	}
+}
+
+// Envelopes travel between processes as
+//
+//	[ver:1=2][frameLen:4][frame][keyLen:1][key][sigLen:1][sig]
+//
+// An envelope that starts with 1 is a bare frame — Frame.encode's own version
+// byte — which is what members sent before envelopes were signed. It decodes
+// as an unsigned envelope, so a mixed cluster mid-upgrade keeps replicating
+// until a peer key set makes signatures required.
+const envelopeWireVersion = 2
+
+func encodeEnvelope(env Envelope) []byte {
+	frame := env.Frame.encode()
+	b := make([]byte, 0, 1+4+len(frame)+1+len(env.Key)+1+len(env.Sig))
+	b = append(b, envelopeWireVersion)
+	b = appendU32(b, uint32(len(frame)))
+	b = append(b, frame...)
+	b = append(b, byte(len(env.Key)))
+	b = append(b, env.Key...)
+	b = append(b, byte(len(env.Sig)))
+	return append(b, env.Sig...)
+}
+
+func decodeEnvelope(b []byte) (Envelope, error) {
+	if len(b) == 0 {
+		return Envelope{}, errors.New("envelope: empty")
+	}
+	if b[0] == 1 {
+		f, err := decodeFrame(b)
+		if err != nil {
+			return Envelope{}, err
+		}
+		return Envelope{ShardID: f.ShardID, Frame: f}, nil
+	}
+	if b[0] != envelopeWireVersion {
+		return Envelope{}, fmt.Errorf("envelope: unknown version %d", b[0])
+	}
+
+	b = b[1:]
+	if len(b) < 4 {
+		return Envelope{}, errors.New("envelope: truncated")
+	}
+	n := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	if uint64(n) > uint64(len(b)) {
+		return Envelope{}, errors.New("envelope: frame out of bounds")
+	}
+	f, err := decodeFrame(b[:n])
+	if err != nil {
+		return Envelope{}, err
+	}
+	b = b[n:]
+
+	env := Envelope{ShardID: f.ShardID, Frame: f}
+	for _, field := range []*[]byte{(*[]byte)(&env.Key), &env.Sig} {
+		if len(b) < 1 || int(b[0]) > len(b)-1 {
+			return Envelope{}, errors.New("envelope: signature out of bounds")
+		}
+		if n := int(b[0]); n > 0 {
+			*field = append([]byte(nil), b[1:1+n]...)
+		}
+		b = b[1+int(b[0]):]
+	}
+	if len(b) > 0 {
+		return Envelope{}, errors.New("envelope: trailing bytes")
+	}
+	return env, nil
+}
@@ -0,0 +1,332 @@
+package network
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv
+}
+
+func pubOf(key ed25519.PrivateKey) ed25519.PublicKey {
+	return key.Public().(ed25519.PublicKey)
+}
+
+func TestIdentitySealVerify(t *testing.T) {
+	a, b, outsider := newKey(t), newKey(t), newKey(t)
+	signer, err := newIdentity(a, []ed25519.PublicKey{pubOf(b)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := newIdentity(b, []ed25519.PublicKey{pubOf(a)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stranger, _ := newIdentity(outsider, nil)
+
+	env := Envelope{ShardID: "s", Frame: newFrame("s", 1, 0, []byte("page"))}
+	sealed := signer.seal(env)
+	if err := verifier.verify(sealed); err != nil {
+		t.Fatalf("signed by a trusted key: %v", err)
+	}
+	if err := signer.verify(sealed); err != nil {
+		t.Fatalf("a member's own key is trusted: %v", err)
+	}
+
+	moved := sealed
+	moved.ShardID = "t"
+	tampered := sealed
+	tampered.Frame = newFrame("s", 1, 0, []byte("pagf"))
+	cases := []struct {
+		name string
+		env  Envelope
+		want error
+	}{
+		{"unsigned", env, errUnsigned},
+		{"untrusted key", stranger.seal(env), errUntrusted},
+		{"moved to another shard", moved, errSignature},
+		{"tampered frame", tampered, errSignature},
+		{"short key", Envelope{ShardID: "s", Frame: env.Frame, Key: sealed.Key[:8], Sig: sealed.Sig}, errUntrusted},
+	}
+	for _, c := range cases {
+		if err := verifier.verify(c.env); !errors.Is(err, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// An envelope signature is not a catch-up request signature.
+	if err := verifier.check(stateRequestSigDomain, envelopeBody(sealed), sealed.Key, sealed.Sig); !errors.Is(err, errSignature) {
+		t.Fatalf("envelope signature checked as a request: %v", err)
+	}
+
+	// Without a peer key set nothing is checked, and without a key nothing
+	// is signed.
+	if err := stranger.verify(env); err != nil {
+		t.Fatalf("no peer key set: %v", err)
+	}
+	var none *identity
+	if got := none.seal(env); got.Key != nil || got.Sig != nil {
+		t.Fatal("sealed without a key")
+	}
+}
+
+func TestNewIdentityRefuses(t *testing.T) {
+	if _, err := newIdentity(nil, []ed25519.PublicKey{pubOf(newKey(t))}); err == nil {
+		t.Fatal("peer key set without an identity key accepted")
+	}
+	if _, err := newIdentity(ed25519.PrivateKey(make([]byte, 10)), nil); err == nil {
+		t.Fatal("short identity key accepted")
+	}
+	if _, err := newIdentity(newKey(t), []ed25519.PublicKey{make([]byte, 10)}); err == nil {
+		t.Fatal("short peer key accepted")
+	}
+}
+
+func TestEnvelopeWire(t *testing.T) {
+	id, _ := newIdentity(newKey(t), nil)
+	env := id.seal(Envelope{ShardID: "s", Frame: newFrame("s", 3, 2, []byte("page"))})
+
+	got, err := decodeEnvelope(encodeEnvelope(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ShardID != "s" || got.Frame.Seq != 3 || !env.Key.Equal(got.Key) || string(got.Sig) != string(env.Sig) {
+		t.Fatalf("round trip: %+v", got)
+	}
+	if err := got.Frame.Valid(); err != nil {
+		t.Fatalf("frame after round trip: %v", err)
+	}
+
+	legacy, err := decodeEnvelope(env.Frame.encode())
+	if err != nil || legacy.Frame.Seq != 3 || legacy.Key != nil || legacy.Sig != nil {
+		t.Fatalf("bare frame: %+v, %v", legacy, err)
+	}
+
+	enc := encodeEnvelope(env)
+	for _, n := range []int{0, 1, 5, len(enc) - 1} {
+		if _, err := decodeEnvelope(enc[:n]); err == nil {
+			t.Fatalf("envelope cut to %d bytes decoded", n)
+		}
+	}
+	if _, err := decodeEnvelope(append(enc, 0)); err == nil {
+		t.Fatal("envelope with trailing bytes decoded")
+	}
+	if _, err := decodeEnvelope([]byte{9, 0, 0}); err == nil {
+		t.Fatal("unknown version decoded")
+	}
+}
+
+func TestParseNodeKey(t *testing.T) {
+	key := newKey(t)
+	for name, s := range map[string]string{
+		"hex seed":      hex.EncodeToString(key.Seed()),
+		"base64 seed":   base64.StdEncoding.EncodeToString(key.Seed()),
+		"hex key":       hex.EncodeToString(key),
+		"padded base64": " " + base64.StdEncoding.EncodeToString(key) + "\n",
+	} {
+		got, err := ParseNodeKey(s)
+		if err != nil || !got.Equal(key) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	mismatched := append(append([]byte(nil), key.Seed()...), pubOf(newKey(t))...)
+	for name, s := range map[string]string{
+		"not a key":      "not a key",
+		"wrong length":   hex.EncodeToString(make([]byte, 16)),
+		"foreign public": hex.EncodeToString(mismatched),
+	} {
+		if _, err := ParseNodeKey(s); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestConfigIdentityFromEnv(t *testing.T) {
+	key, peer := newKey(t), newKey(t)
+	t.Setenv("BASE_NETWORK", "quasar")
+	t.Setenv("BASE_SHARD_KEY", "user_id")
+	t.Setenv("BASE_PEERS", "b:9999")
+	t.Setenv("HOSTNAME", "a")
+	t.Setenv("BASE_NODE_KEY", hex.EncodeToString(key.Seed()))
+	t.Setenv("BASE_PEER_KEYS", hex.EncodeToString(pubOf(peer))+", "+base64.StdEncoding.EncodeToString(pubOf(key)))
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.NodeKey.Equal(key) || len(cfg.PeerKeys) != 2 || !cfg.PeerKeys[0].Equal(pubOf(peer)) {
+		t.Fatalf("keys: %d peer keys", len(cfg.PeerKeys))
+	}
+
+	t.Setenv("BASE_NODE_KEY", "")
+	if _, err := ConfigFromEnv(); err == nil || !strings.Contains(err.Error(), "BASE_NODE_KEY") {
+		t.Fatalf("peer keys without a node key: %v", err)
+	}
+	t.Setenv("BASE_NODE_KEY", "zz")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("bad node key accepted")
+	}
+}
+
+// keyedPair starts members a and b on one hub, each signing with its key and
+// trusting the other's.
+func keyedPair(t *testing.T, keyA, keyB ed25519.PrivateKey) (a, b *node) {
+	t.Helper()
+	hub := newMemoryHub()
+	start := func(id, peer string, key ed25519.PrivateKey, trusted ed25519.PublicKey) *node {
+		cfg := Config{
+			Enabled:     true,
+			ShardKey:    "user_id",
+			Replication: 2,
+			Peers:       []string{peer},
+			NodeID:      id,
+			NodeKey:     key,
+			PeerKeys:    []ed25519.PublicKey{trusted},
+			Role:        RoleValidator,
+			Archive:     "off",
+			ReplicaDir:  t.TempDir(),
+			ListenHTTP:  ":0",
+			ListenP2P:   ":0",
+		}
+		n, err := newNodeWithTransport(cfg, hub.connect(NodeID(id)))
+		if err != nil {
+			t.Fatalf("node %s: %v", id, err)
+		}
+		if err := n.Start(context.Background()); err != nil {
+			t.Fatalf("node %s start: %v", id, err)
+		}
+		t.Cleanup(func() { _ = n.Stop(context.Background()) })
+		return n
+	}
+	a = start("a", "b", keyA, pubOf(keyB))
+	b = start("b", "a", keyB, pubOf(keyA))
+	return a, b
+}
+
+func waitSeq(t *testing.T, n *node, shardID string, seq uint64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s, err := n.shard(shardID)
+		if err == nil && s.LocalSeq() >= seq {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout: %s has not applied seq %d of %q", n.id, seq, shardID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNodeRejectsUntrustedEnvelopes(t *testing.T) {
+	a, b := keyedPair(t, newKey(t), newKey(t))
+	outsider, _ := newIdentity(newKey(t), nil)
+
+	f1 := newFrame("s", 1, 0, pagePayload(1, map[uint32]byte{1: 1}))
+	b.onPeerFrame(Envelope{ShardID: "s", Frame: f1})
+	b.onPeerFrame(outsider.seal(Envelope{ShardID: "s", Frame: f1}))
+	if got := b.Metrics().FramesRejectedUnsigned.Get(); got != 1 {
+		t.Fatalf("unsigned rejections = %v, want 1", got)
+	}
+	if got := b.Metrics().FramesRejectedSignature.Get(); got != 1 {
+		t.Fatalf("signature rejections = %v, want 1", got)
+	}
+	if got := b.Metrics().FramesIngested.Get(); got != 0 {
+		t.Fatalf("rejected envelopes ingested: %v", got)
+	}
+
+	if err := a.publish(Envelope{ShardID: "s", Frame: f1}); err != nil {
+		t.Fatal(err)
+	}
+	waitSeq(t, b, "s", 1)
+}
+
+// Catch-up requests and answers are signed too: a trusted member is served,
+// an outsider is not.
+func TestStateRequestsSigned(t *testing.T) {
+	a, b := keyedPair(t, newKey(t), newKey(t))
+	if _, err := a.shard("s"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range chainFrames("s", 3) {
+		if err := a.replicaOf("s").apply(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st := b.transport.(StateTransport)
+	chunk, err := b.requestState(context.Background(), st, "a", StateRequest{ShardID: "s"})
+	if err != nil || chunk.Seq != 3 || len(chunk.Sig) == 0 {
+		t.Fatalf("signed request: seq %d, %v", chunk.Seq, err)
+	}
+
+	if _, err := a.serveState(StateRequest{ShardID: "s"}); !errors.Is(err, errUnsigned) {
+		t.Fatalf("unsigned request: %v", err)
+	}
+	if err := RotateIdentity(b, newKey(t), []ed25519.PublicKey{pubOf(a.identity.Load().key)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.requestState(context.Background(), st, "a", StateRequest{ShardID: "s"}); err == nil || !strings.Contains(err.Error(), "not in the peer key set") {
+		t.Fatalf("request by a key a does not trust: %v", err)
+	}
+	if got := a.Metrics().StateRejectedSignature.Get(); got != 2 {
+		t.Fatalf("state rejections = %v, want 2", got)
+	}
+}
+
+// Rotation in the three steps identity.go describes never drops a frame.
+func TestRotateIdentity(t *testing.T) {
+	oldA, keyB, newA := newKey(t), newKey(t), newKey(t)
+	a, b := keyedPair(t, oldA, keyB)
+	frame := func(seq uint64) Envelope {
+		return Envelope{ShardID: "s", Frame: newFrame("s", seq, seq-1, pagePayload(1, map[uint32]byte{1: byte(seq)}))}
+	}
+
+	// 1. b trusts the new key alongside the old.
+	if err := RotateIdentity(b, keyB, []ed25519.PublicKey{pubOf(oldA), pubOf(newA)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.publish(frame(1)); err != nil {
+		t.Fatal(err)
+	}
+	waitSeq(t, b, "s", 1)
+
+	// 2. a moves to the new key.
+	if err := RotateIdentity(a, newA, []ed25519.PublicKey{pubOf(keyB)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.publish(frame(2)); err != nil {
+		t.Fatal(err)
+	}
+	waitSeq(t, b, "s", 2)
+
+	// 3. b drops the old key, and what it signs is refused from then on.
+	if err := RotateIdentity(b, keyB, []ed25519.PublicKey{pubOf(newA)}); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := newIdentity(oldA, nil)
+	b.onPeerFrame(old.seal(frame(3)))
+	if got := b.Metrics().FramesRejectedSignature.Get(); got != 1 {
+		t.Fatalf("frame signed by the retired key: %v rejections, want 1", got)
+	}
+
+	if err := RotateIdentity(b, nil, []ed25519.PublicKey{pubOf(newA)}); err == nil {
+		t.Fatal("rotated to a peer key set without a key")
+	}
+	if err := RotateIdentity(noop{}, newA, nil); err != nil {
+		t.Fatalf("disabled network: %v", err)
+	}
+}
@@ -38,6 +38,7 @@ type memoryTransport struct {
 
 	mu     sync.Mutex
 	recv   func(Envelope)
+	serve  func(StateRequest) (StateChunk, error)
 	closed bool
 }
 
@@ -1,6 +1,10 @@
 package network
 
-import metric "github.com/luxfi/metric"
+import (
+	"sync"
+
+	metric "github.com/luxfi/metric"
+)
 
 // Metrics owns every collector the network package exposes. Callers wire
 // it into their own registry; we never touch metric.DefaultRegisterer.
@@ -21,9 +25,23 @@ import metric "github.com/luxfi/metric"
 //	base_network_frames_finalized_total
 //	base_network_frames_duplicate_total
 //	base_network_frames_invalid_total
+//	base_network_frames_rejected_unsigned_total
+//	base_network_frames_rejected_signature_total
 //	base_network_apply_errors_total
 //	base_network_wal_hook_errors_total
 //	base_network_wal_bytes_total
+//	base_network_frames_applied_total
+//	base_network_pages_applied_total
+//	base_network_catchups_total
+//	base_network_catchup_failures_total
+//	base_network_catchups_active
+//	base_network_catchup_bytes_total
+//	base_network_catchup_frames_total
+//	base_network_state_rejected_signature_total
+//
+// The per-shard applied-seq watermark and catch-up progress are read with
+// AppliedSeq and CatchUp rather than exported as labelled series: shards are
+// tenants, and a label per shard is a series per tenant.
 type Metrics struct {
 	Shards           metric.Counter
 	ActiveShards     metric.Gauge
@@ -53,11 +71,50 @@ type Metrics struct {
 	// FramesRejectedSeqGap counts frames whose height != prevHeight+1
 	// (R2). The apply path never bumps localSeq from these.
 	FramesRejectedSeqGap metric.Counter
+	// FramesRejectedUnsigned and FramesRejectedSignature count peer
+	// envelopes dropped under a peer key set: carrying no signature, and
+	// carrying one by a key outside the set or that does not verify. A
+	// rise in the first during a rollout is a member not yet given
+	// BASE_NODE_KEY; in the second, a key rotated out too early — or a
+	// sender that was never a member.
+	FramesRejectedUnsigned  metric.Counter
+	FramesRejectedSignature metric.Counter
 
 	ApplyErrors   metric.Counter
 	WALHookErrors metric.Counter
 	WALBytes      metric.Counter
 
+	// FramesApplied counts finalised frames written into this member's
+	// replica files. It trails FramesFinalized by the frames a replica
+	// refused; see ApplyErrors.
+	FramesApplied metric.Counter
+	// PagesApplied counts database pages written into replica files.
+	PagesApplied metric.Counter
+
+	// CatchUpsStarted counts catch-ups started: a shard that found itself
+	// behind its members and stopped voting to fill its replica from one
+	// of them or from the archive (see catchup.go). CatchUpFailures
+	// counts those that ended with the replica still behind.
+	CatchUpsStarted metric.Counter
+	CatchUpFailures metric.Counter
+	// CatchUpsActive is the number of shards catching up now. A shard
+	// catching up does not vote, so a value that stays up is a member
+	// not pulling its weight in quorum.
+	CatchUpsActive metric.Gauge
+	// CatchUpBytes counts snapshot bytes received; CatchUpFrames counts
+	// frames applied from a tail or the archive while catching up.
+	CatchUpBytes  metric.Counter
+	CatchUpFrames metric.Counter
+	// StateRejectedSignature counts catch-up requests refused, and answers
+	// discarded, under a peer key set for a missing or untrusted signature.
+	StateRejectedSignature metric.Counter
+
+	// applied is the per-shard applied-seq watermark, shardID → uint64.
+	applied sync.Map
+	// catchUps is the per-shard progress of the last catch-up,
+	// shardID → CatchUpProgress.
+	catchUps sync.Map
+
 	// MembershipSize is the live member count as reported by the
 	// Membership watcher. Dashboards alert on unexpected drops
 	// (scale-down events show up here before the transport notices).
@@ -130,6 +187,14 @@ func NewMetrics() *Metrics {
 			Name: "base_network_frames_rejected_seq_gap_total",
 			Help: "Finalised frames skipped because Height != prevHeight+1 (R2).",
 		}),
+		FramesRejectedUnsigned: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_frames_rejected_unsigned_total",
+			Help: "Peer envelopes dropped for carrying no signature while a peer key set is configured.",
+		}),
+		FramesRejectedSignature: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_frames_rejected_signature_total",
+			Help: "Peer envelopes dropped for a signature by an untrusted key or one that does not verify.",
+		}),
 		ApplyErrors: metric.NewCounter(metric.CounterOpts{
 			Name: "base_network_apply_errors_total",
 			Help: "Errors from the per-shard apply callback.",
@@ -142,6 +207,38 @@ func NewMetrics() *Metrics {
 			Name: "base_network_wal_bytes_total",
 			Help: "Total WAL payload bytes captured by the commit hook.",
 		}),
+		FramesApplied: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_frames_applied_total",
+			Help: "Finalised frames written into local shard replicas.",
+		}),
+		PagesApplied: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_pages_applied_total",
+			Help: "Database pages written into local shard replicas.",
+		}),
+		CatchUpsStarted: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_catchups_total",
+			Help: "Catch-ups started by shards found behind their members.",
+		}),
+		CatchUpFailures: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_catchup_failures_total",
+			Help: "Catch-ups that ended with the shard's replica still behind.",
+		}),
+		CatchUpsActive: metric.NewGauge(metric.GaugeOpts{
+			Name: "base_network_catchups_active",
+			Help: "Shards catching up, and so not voting, on this member.",
+		}),
+		CatchUpBytes: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_catchup_bytes_total",
+			Help: "Snapshot bytes received while catching up.",
+		}),
+		CatchUpFrames: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_catchup_frames_total",
+			Help: "Frames applied from a peer's tail or the archive while catching up.",
+		}),
+		StateRejectedSignature: metric.NewCounter(metric.CounterOpts{
+			Name: "base_network_state_rejected_signature_total",
+			Help: "Catch-up requests and answers dropped for a missing, untrusted or bad signature.",
+		}),
 		MembershipSize: metric.NewGauge(metric.GaugeOpts{
 			Name: "base_network_membership_size",
 			Help: "Live member count reported by the Membership watcher.",
@@ -163,7 +260,11 @@ func (m *Metrics) Register(r metric.Registerer) error {
 		m.FramesSubmitted, m.FramesIngested, m.FramesFinalized,
 		m.FramesDuplicate, m.FramesInvalid,
 		m.FramesRejectedShardMismatch, m.FramesRejectedSeqGap,
+		m.FramesRejectedUnsigned, m.FramesRejectedSignature,
 		m.ApplyErrors, m.WALHookErrors, m.WALBytes,
+		m.FramesApplied, m.PagesApplied,
+		m.CatchUpsStarted, m.CatchUpFailures, m.CatchUpsActive,
+		m.CatchUpBytes, m.CatchUpFrames, m.StateRejectedSignature,
 		m.MembershipSize,
 	}
 	for _, c := range collectors {
@@ -173,3 +274,67 @@ func (m *Metrics) Register(r metric.Registerer) error {
 	}
 	return nil
 }
+
+// AppliedSeq returns the seq of the last finalised frame written into this
+// member's replica of shardID — the watermark persisted next to it — and
+// whether this member holds a replica of it. A shard whose value stops while
+// its writer's keeps climbing has a replica that can no longer take frames.
+func (m *Metrics) AppliedSeq(shardID string) (uint64, bool) {
+	if m == nil {
+		return 0, false
+	}
+	v, ok := m.applied.Load(shardID)
+	if !ok {
+		return 0, false
+	}
+	return v.(uint64), true
+}
+
+// AppliedSeqs returns the applied-seq watermark of every shard this member
+// holds a replica of.
+func (m *Metrics) AppliedSeqs() map[string]uint64 {
+	out := map[string]uint64{}
+	if m == nil {
+		return out
+	}
+	m.applied.Range(func(k, v any) bool {
+		out[k.(string)] = v.(uint64)
+		return true
+	})
+	return out
+}
+
+func (m *Metrics) setAppliedSeq(shardID string, seq uint64) {
+	m.applied.Store(shardID, seq)
+}
+
+// CatchUp returns the progress of shardID's last catch-up on this member, and
+// whether it has had one since the process started.
+func (m *Metrics) CatchUp(shardID string) (CatchUpProgress, bool) {
+	if m == nil {
+		return CatchUpProgress{}, false
+	}
+	v, ok := m.catchUps.Load(shardID)
+	if !ok {
+		return CatchUpProgress{}, false
+	}
+	return v.(CatchUpProgress), true
+}
+
+// CatchUps returns the progress of the last catch-up of every shard that has
+// had one since the process started.
+func (m *Metrics) CatchUps() map[string]CatchUpProgress {
+	out := map[string]CatchUpProgress{}
+	if m == nil {
+		return out
+	}
+	m.catchUps.Range(func(k, v any) bool {
+		out[k.(string)] = v.(CatchUpProgress)
+		return true
+	})
+	return out
+}
+
+func (m *Metrics) setCatchUp(p CatchUpProgress) {
+	m.catchUps.Store(p.Shard, p)
+}
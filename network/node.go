@@ -2,8 +2,11 @@ package network
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // node is the live network member. It owns the per-shard Quasar engines,
@@ -29,6 +32,19 @@ type node struct {
 	walSrc walSource
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// replicas holds the materialised database of every shard opened
+	// while cfg.ReplicaDir is set, keyed like shards and guarded by mu.
+	replicas map[string]*replica
+
+	// identity signs the envelopes this member publishes and verifies the
+	// ones it receives. Swapped whole by RotateIdentity.
+	identity atomic.Pointer[identity]
+
+	// archive is where a catch-up turns when no member can serve it. Set
+	// by SetArchive, closed by Stop, guarded by mu; nil leaves catch-up to
+	// the members.
+	archive Archive
 }
 
 // newNode constructs the live node with the production ZAP transport and
@@ -66,15 +82,23 @@ func newNodeWithTransport(cfg Config, t Transport) (*node, error) {
 		t = &nopTransport{}
 	}
 
-	return &node{
+	id, err := newIdentity(cfg.NodeKey, cfg.PeerKeys)
+	if err != nil {
+		return nil, fmt.Errorf("network: %w", err)
+	}
+
+	n := &node{
 		cfg:       cfg,
 		id:        NodeID(cfg.NodeID),
 		router:    newRouter(members, cfg.Replication),
 		metrics:   NewMetrics(),
 		transport: t,
 		shards:    make(map[string]*Shard),
+		replicas:  make(map[string]*replica),
 		walSrc:    nopSource{},
-	}, nil
+	}
+	n.identity.Store(id)
+	return n, nil
 }
 
 // SetMembership injects a Membership source. The node subscribes on
@@ -113,6 +137,12 @@ func (n *node) Start(ctx context.Context) error {
 	membership := n.membership
 	n.mu.Unlock()
 
+	// Members catching up ask this one for frames and snapshots of the
+	// shards it holds (see catchup.go).
+	if st, ok := n.transport.(StateTransport); ok {
+		st.ServeState(n.serveState)
+	}
+
 	// Transport fan-in: peer frames arrive here and are submitted to the
 	// local shard engine so every member converges on the same DAG.
 	if err := n.transport.Start(ourCtx, n.onPeerFrame); err != nil {
@@ -155,7 +185,11 @@ func (n *node) Stop(ctx context.Context) error {
 	n.mu.Lock()
 	cancel := n.cancel
 	shards := n.shards
+	replicas := n.replicas
+	archive := n.archive
 	n.shards = map[string]*Shard{}
+	n.replicas = map[string]*replica{}
+	n.archive = nil
 	n.ctx, n.cancel = nil, nil
 	n.mu.Unlock()
 
@@ -165,6 +199,15 @@ func (n *node) Stop(ctx context.Context) error {
 	for _, s := range shards {
 		s.close()
 	}
+	// The shard apply loops exit on cancel; a frame caught mid-apply
+	// fails on the closed file and is replayed from the watermark on the
+	// next start.
+	for _, r := range replicas {
+		_ = r.close()
+	}
+	if archive != nil {
+		_ = archive.Close()
+	}
 	return n.transport.Stop(ctx)
 }
 
@@ -187,31 +230,54 @@ func (n *node) Metrics() *Metrics { return n.metrics }
 // shard returns the per-shard state, creating it (and its Quasar engine) on
 // first use.
 func (n *node) shard(shardID string) (*Shard, error) {
+	s, _, err := n.openShard(shardID)
+	return s, err
+}
+
+// openShard is shard, also reporting whether this call created the shard.
+func (n *node) openShard(shardID string) (*Shard, bool, error) {
 	n.mu.RLock()
 	s, ok := n.shards[shardID]
 	ctx := n.ctx
 	n.mu.RUnlock()
 	if ok {
-		return s, nil
+		return s, false, nil
 	}
 	if ctx == nil {
-		return nil, fmt.Errorf("network: not started")
+		return nil, false, fmt.Errorf("network: not started")
 	}
 
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	if s, ok = n.shards[shardID]; ok {
-		return s, nil
+		return s, false, nil
+	}
+
+	// The replica's watermark is where the shard resumes: frames at or
+	// below it are already in the file, so the apply loop treats them as
+	// stale, and the next one it takes is the one the file needs.
+	var start uint64
+	rep := n.replicas[shardID]
+	if n.cfg.ReplicaDir != "" && rep == nil {
+		var err error
+		rep, err = openReplica(n.cfg.ReplicaDir, shardID, n.metrics)
+		if err != nil {
+			return nil, false, fmt.Errorf("network: %w", err)
+		}
+		n.replicas[shardID] = rep
+	}
+	if rep != nil {
+		start = rep.Seq()
 	}
 
 	members := n.router.membersFor(shardID)
-	s, err := newShard(ctx, shardID, members, n.cfg.Replication, n.metrics, n.onLocalApply(shardID))
+	s, err := newShard(ctx, shardID, members, n.cfg.Replication, start, n.metrics, n.onLocalApply(shardID, rep))
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	n.shards[shardID] = s
 	n.metrics.ActiveShards.Inc()
-	return s, nil
+	return s, true, nil
 }
 
 // onPeerFrame is the transport callback: a remote member submitted a frame,
@@ -223,28 +289,104 @@ func (n *node) shard(shardID string) (*Shard, error) {
 // about to submit into). If the two disagree the envelope is malformed or
 // hostile; drop it, bump the rejection metric, and return. This closes the
 // cross-shard state-injection probe.
+//
+// Before any of that, the envelope must verify against the peer key set
+// when one is configured (see identity.go): a sender without a trusted key
+// does not get as far as naming a shard.
+//
+// A valid frame that shows the shard behind — see lagging — starts a
+// catch-up, and while one runs frames are held for it rather than ingested.
 func (n *node) onPeerFrame(env Envelope) {
+	if err := n.identity.Load().verify(env); err != nil {
+		if err == errUnsigned {
+			n.metrics.FramesRejectedUnsigned.Inc()
+		} else {
+			n.metrics.FramesRejectedSignature.Inc()
+		}
+		return
+	}
 	if env.Frame.ShardID != env.ShardID {
 		n.metrics.FramesRejectedShardMismatch.Inc()
 		return
 	}
-	s, err := n.shard(env.ShardID)
+	s, opened, err := n.openShard(env.ShardID)
 	if err != nil {
 		n.metrics.ApplyErrors.Inc()
 		return
 	}
+	if rep := n.replicaOf(env.ShardID); rep != nil {
+		if err := env.Frame.Valid(); err != nil {
+			n.metrics.FramesInvalid.Inc()
+			return
+		}
+		if lagging(s, env.Frame.Seq, opened) {
+			n.startCatchUp(s, rep)
+		}
+		if s.hold(env.Frame) {
+			return
+		}
+	}
 	if err := s.ingestRemote(env.Frame); err != nil {
 		n.metrics.ApplyErrors.Inc()
 	}
 }
 
+// publish signs env with this member's identity, if it has one, and fans it
+// out to peers.
+func (n *node) publish(env Envelope) error {
+	return n.transport.Publish(n.identity.Load().seal(env))
+}
+
+func (n *node) replicaOf(shardID string) *replica {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.replicas[shardID]
+}
+
 // onLocalApply is the callback plumbed into each shard's Quasar finalize
-// loop. Apply is per-(shard,salt,cksm) idempotent so a pod replaying its
-// WAL on restart is a no-op.
-func (n *node) onLocalApply(shardID string) ApplyFunc {
+// loop. With a replica it writes each frame's pages into the shard's local
+// file and moves the persisted watermark (see replica.go); without one
+// (ReplicaDir unset) finalised frames live in consensus only. Either way
+// apply is per-(shard,salt,cksm) idempotent so a pod replaying its WAL on
+// restart is a no-op.
+//
+// The apply loop does not retry, so this does: a frame that fails to apply is
+// tried replicaApplyAttempts times, and one that still fails — or that shows
+// the replica missing an earlier frame — starts a catch-up, which fills the
+// replica from the shard's members and resumes the shard from its watermark.
+func (n *node) onLocalApply(shardID string, rep *replica) ApplyFunc {
+	if rep == nil {
+		return func(Frame) error { return nil }
+	}
 	return func(f Frame) error {
-		// v0 default apply: record into shard state. SQLite write-back is
-		// wired by InstallWALHook when a concrete conn is present.
-		return nil
+		if f.ShardID != shardID {
+			return fmt.Errorf("network: frame for shard %q applied to %q", f.ShardID, shardID)
+		}
+
+		n.mu.RLock()
+		ctx := n.ctx
+		n.mu.RUnlock()
+
+		err := rep.apply(f)
+		for attempt := 1; err != nil && !errors.Is(err, errReplicaBehind) && rep.Seq() < f.Seq && attempt < replicaApplyAttempts; attempt++ {
+			if ctx == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(replicaApplyRetry):
+			}
+			err = rep.apply(f)
+		}
+		if err != nil && rep.Seq() < f.Seq {
+			n.mu.RLock()
+			s := n.shards[shardID]
+			n.mu.RUnlock()
+			if s != nil {
+				n.startCatchUp(s, rep)
+			}
+		}
+		return err
 	}
 }
@@ -0,0 +1,430 @@
+package network
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Replica apply: a member materialises every finalised frame of a shard into a
+// SQLite file of its own, so that a follower holds the database it would need
+// to serve reads or take over as writer.
+//
+// The file is <ReplicaDir>/<shard>.db and is written the way Restore writes
+// one — a frame's payload is the pages its transaction left changed — so the
+// file after frame N is the database as of txseq N. Next to it,
+// <shard>.db.seq records N: the applied-seq watermark. It is written after the
+// pages are synced, so a crash between the two leaves the watermark one frame
+// behind a file that already has that frame's pages. Replaying the frame then
+// writes the same pages again; a payload carries whole pages, never deltas,
+// which is what makes that safe.
+//
+// A replica only ever moves by one frame. The shard's apply loop already hands
+// frames over in seq order, but it has advanced its own seq before apply runs
+// and does not retry, so after a failed apply it goes on handing over frames
+// the file cannot take. Each of those fails here too, and the watermark stays
+// at the last frame that landed rather than papering over the hole. The node
+// owns the recovery (onLocalApply): it retries a failed frame a few times, and
+// a replica still missing one is filled by a catch-up from the shard's members.
+
+// Frames with an empty payload — all a writer without a page capture sends —
+// still move the watermark, so the replica keeps the shard's numbering, but
+// leave the file empty. Such a replica has no database to hand over, and
+// refuses to snapshot one.
+
+// A replica also serves the members catching up on its shard (catchup.go):
+// the last frames it applied, kept in memory up to tailBytes, and failing
+// that a snapshot — a copy of the file taken between two frames, so it is the
+// database as of one seq.
+
+// tailBytes bounds the payload bytes of the recent frames a replica keeps for
+// catching members up without a snapshot.
+const tailBytes = 4 << 20
+
+// snapshotMaxAge is how long a snapshot is served before a request for a new
+// one copies the file again. Reusing it lets several members catch up from one
+// copy; the frames since it was taken come as a tail.
+const snapshotMaxAge = 2 * time.Minute
+
+// replicaApplyAttempts is how many times a finalised frame is applied to the
+// replica before the node falls back to a catch-up, and replicaApplyRetry
+// the wait between two attempts.
+const (
+	replicaApplyAttempts = 3
+	replicaApplyRetry    = 50 * time.Millisecond
+)
+
+// errReplicaBehind is apply's error for a frame past the one the replica
+// needs next: a retry cannot help, only the frames in between can.
+var errReplicaBehind = errors.New("the replica is behind")
+
+// watermarkLen is the size of a <shard>.db.seq file:
+//
+//	seq        uint64  big-endian, the last frame applied
+//	page_size  uint32  big-endian, 0 until a frame has named one
+const watermarkLen = 12
+
+// replica is one shard's materialised database on this member.
+type replica struct {
+	shardID string
+	path    string
+	metrics *Metrics
+
+	mu    sync.Mutex
+	file  *os.File
+	pages *pageFile
+	seq   uint64
+
+	// recent are the last frames applied, oldest first, and recentBytes
+	// their payload size.
+	recent      []Frame
+	recentBytes int
+
+	snap *snapshot
+}
+
+// snapshot is a copy of a replica's file as of seq.
+type snapshot struct {
+	seq      uint64
+	pageSize uint32
+	size     int64
+	digest   [32]byte
+	path     string
+	taken    time.Time
+}
+
+// openReplica opens, creating if need be, shardID's replica in dir and reads
+// back its watermark.
+func openReplica(dir, shardID string, m *Metrics) (*replica, error) {
+	if shardID == "" {
+		return nil, errors.New("replica: empty shard id")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("replica %s: %w", shardID, err)
+	}
+
+	// the shard id is whatever BASE_SHARD_KEY resolved to, so it is escaped
+	// before it names a file
+	path := filepath.Join(dir, url.PathEscape(shardID)+".db")
+
+	seq, pageSize, err := readWatermark(path + ".seq")
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: %w", shardID, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: %w", shardID, err)
+	}
+
+	r := &replica{
+		shardID: shardID,
+		path:    path,
+		metrics: m,
+		file:    file,
+		pages:   &pageFile{f: file, pageSize: pageSize},
+		seq:     seq,
+	}
+	m.setAppliedSeq(shardID, seq)
+	return r, nil
+}
+
+// apply writes f into the replica and moves the watermark to it. f must be the
+// frame after the watermark and must carry a valid checksum.
+func (r *replica) apply(f Frame) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return fmt.Errorf("replica %s: closed", r.shardID)
+	}
+	if f.ShardID != r.shardID {
+		return fmt.Errorf("replica %s: frame %d is for shard %q", r.shardID, f.Seq, f.ShardID)
+	}
+	if err := f.Valid(); err != nil {
+		r.metrics.FramesInvalid.Inc()
+		return fmt.Errorf("replica %s: frame %d: %w", r.shardID, f.Seq, err)
+	}
+	if f.Seq > r.seq+1 {
+		return fmt.Errorf("replica %s: frame %d does not follow the applied seq %d: %w", r.shardID, f.Seq, r.seq, errReplicaBehind)
+	}
+	if f.Seq != r.seq+1 || f.PrevSeq != r.seq {
+		return fmt.Errorf("replica %s: frame %d does not follow the applied seq %d", r.shardID, f.Seq, r.seq)
+	}
+
+	n, err := r.pages.apply(f.Payload)
+	if err != nil {
+		return fmt.Errorf("replica %s: frame %d: %w", r.shardID, f.Seq, err)
+	}
+	if err := r.file.Sync(); err != nil {
+		return fmt.Errorf("replica %s: %w", r.shardID, err)
+	}
+	if err := writeWatermark(r.path+".seq", f.Seq, r.pages.pageSize); err != nil {
+		return fmt.Errorf("replica %s: %w", r.shardID, err)
+	}
+
+	r.seq = f.Seq
+	r.remember(f)
+	r.metrics.setAppliedSeq(r.shardID, f.Seq)
+	r.metrics.FramesApplied.Inc()
+	r.metrics.PagesApplied.Add(float64(n))
+	return nil
+}
+
+// Seq returns the applied-seq watermark.
+func (r *replica) Seq() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.seq
+}
+
+// remember keeps f among the recent frames, dropping the oldest past
+// tailBytes. Called with mu held.
+func (r *replica) remember(f Frame) {
+	r.recent = append(r.recent, f)
+	r.recentBytes += len(f.Payload)
+	for len(r.recent) > 1 && r.recentBytes > tailBytes {
+		r.recentBytes -= len(r.recent[0].Payload)
+		r.recent[0] = Frame{}
+		r.recent = r.recent[1:]
+	}
+}
+
+// framesAfter returns the frames after from, up to budget payload bytes but at
+// least one, and the replica's seq. ok is false when the recent frames no
+// longer reach back to from+1, and a snapshot is the way to catch up.
+func (r *replica) framesAfter(from uint64, budget int) (frames []Frame, seq uint64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if from >= r.seq {
+		return nil, r.seq, true
+	}
+	if len(r.recent) == 0 || r.recent[0].Seq > from+1 {
+		return nil, r.seq, false
+	}
+
+	size := 0
+	for _, f := range r.recent {
+		if f.Seq <= from {
+			continue
+		}
+		if len(frames) > 0 && size+len(f.Payload) > budget {
+			break
+		}
+		frames = append(frames, f)
+		size += len(f.Payload)
+	}
+	return frames, r.seq, true
+}
+
+// snapshot returns a snapshot of the replica ahead of seq after, copying the
+// file unless the last copy is still fresh and ahead. The copy is taken under
+// mu, so no frame is half in it; applying waits for it.
+func (r *replica) snapshot(after uint64) (*snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil, fmt.Errorf("replica %s: closed", r.shardID)
+	}
+	if r.snap != nil && r.snap.seq > after && time.Since(r.snap.taken) < snapshotMaxAge {
+		return r.snap, nil
+	}
+	if r.seq == 0 {
+		return nil, fmt.Errorf("replica %s: nothing applied to snapshot", r.shardID)
+	}
+	// frames from a writer without a page capture move the watermark but
+	// write nothing, and an empty file shipped as the database as of seq
+	// would be installed over whatever the member catching up holds
+	if r.pages.pageSize == 0 {
+		return nil, fmt.Errorf("replica %s: no page applied to snapshot; the shard's frames carry none", r.shardID)
+	}
+
+	// each copy is named by its seq, so a member reading the one this
+	// replaces is told by the seq that it is gone rather than handed bytes
+	// of the new one
+	path := r.path + ".snap-" + strconv.FormatUint(r.seq, 10)
+	out, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: %w", r.shardID, err)
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), io.NewSectionReader(r.file, 0, math.MaxInt64))
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: snapshot: %w", r.shardID, err)
+	}
+	if err := out.Sync(); err != nil {
+		return nil, fmt.Errorf("replica %s: snapshot: %w", r.shardID, err)
+	}
+
+	if r.snap != nil && r.snap.path != path {
+		_ = os.Remove(r.snap.path)
+	}
+	r.snap = &snapshot{
+		seq:      r.seq,
+		pageSize: r.pages.pageSize,
+		size:     size,
+		path:     path,
+		taken:    time.Now(),
+	}
+	copy(r.snap.digest[:], h.Sum(nil))
+	return r.snap, nil
+}
+
+// readSnapshot reads up to n bytes at off of the snapshot as of seq.
+func (r *replica) readSnapshot(seq uint64, off int64, n int) (*snapshot, []byte, error) {
+	r.mu.Lock()
+	snap := r.snap
+	r.mu.Unlock()
+
+	if snap == nil || snap.seq != seq {
+		return nil, nil, fmt.Errorf("replica %s: no snapshot as of seq %d", r.shardID, seq)
+	}
+	if off < 0 || off > snap.size {
+		return nil, nil, fmt.Errorf("replica %s: snapshot offset %d outside %d bytes", r.shardID, off, snap.size)
+	}
+
+	// a newer copy may have removed this one since the check
+	f, err := os.Open(snap.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("replica %s: snapshot as of seq %d: %w", r.shardID, seq, err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, min(int64(n), snap.size-off))
+	if _, err := f.ReadAt(buf, off); err != nil {
+		return nil, nil, fmt.Errorf("replica %s: snapshot as of seq %d: %w", r.shardID, seq, err)
+	}
+	return snap, buf, nil
+}
+
+// install replaces the replica's file with the verified snapshot at path, as
+// of seq. The file is renamed into place before the watermark moves: a crash
+// between the two leaves a file ahead of its watermark, which the frames
+// after the watermark bring back to a consistent seq as they would after a
+// crash in apply.
+func (r *replica) install(path string, seq uint64, pageSize uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return fmt.Errorf("replica %s: closed", r.shardID)
+	}
+	if seq <= r.seq {
+		return fmt.Errorf("replica %s: snapshot as of seq %d is not ahead of %d", r.shardID, seq, r.seq)
+	}
+
+	if err := r.file.Close(); err != nil {
+		return fmt.Errorf("replica %s: %w", r.shardID, err)
+	}
+	r.file = nil
+
+	renameErr := os.Rename(path, r.path)
+
+	// reopened either way, so a failed install leaves the replica as it was
+	file, err := os.OpenFile(r.path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("replica %s: %w", r.shardID, err)
+	}
+	r.file = file
+	if renameErr != nil {
+		r.pages.f = file
+		return fmt.Errorf("replica %s: %w", r.shardID, renameErr)
+	}
+	r.pages = &pageFile{f: file, pageSize: pageSize}
+
+	if err := writeWatermark(r.path+".seq", seq, pageSize); err != nil {
+		return fmt.Errorf("replica %s: %w", r.shardID, err)
+	}
+
+	r.seq = seq
+	r.recent, r.recentBytes = nil, 0
+	r.metrics.setAppliedSeq(r.shardID, seq)
+	return nil
+}
+
+// close releases the file and any snapshot. Safe to call more than once.
+func (r *replica) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	if r.snap != nil {
+		_ = os.Remove(r.snap.path)
+		r.snap = nil
+	}
+	return err
+}
+
+// readWatermark reads a watermark file; a missing one is a replica nothing has
+// been applied to.
+func readWatermark(path string) (seq uint64, pageSize uint32, err error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(b) != watermarkLen {
+		return 0, 0, fmt.Errorf("watermark %s: %d bytes, want %d", path, len(b), watermarkLen)
+	}
+	return binary.BigEndian.Uint64(b), binary.BigEndian.Uint32(b[8:]), nil
+}
+
+// writeWatermark replaces a watermark file through a synced temporary file and
+// a rename, so a crash leaves either the old watermark or the new one. The
+// directory is synced after the rename, or a crash could still lose it.
+func writeWatermark(path string, seq uint64, pageSize uint32) error {
+	b := binary.BigEndian.AppendUint64(make([]byte, 0, watermarkLen), seq)
+	b = binary.BigEndian.AppendUint32(b, pageSize)
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir fsyncs the directory at path, making the renames in it durable.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
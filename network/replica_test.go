@@ -0,0 +1,246 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplicaApplyAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	m := NewMetrics()
+
+	r, err := openReplica(dir, "org/1", m)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	frames := []Frame{
+		newFrame("org/1", 1, 0, pagePayload(2, map[uint32]byte{1: 'a', 2: 'b'})),
+		newFrame("org/1", 2, 1, nil), // a commit that changed no page
+		newFrame("org/1", 3, 2, pagePayload(3, map[uint32]byte{2: 'c', 3: 'd'})),
+	}
+	for _, f := range frames {
+		if err := r.apply(f); err != nil {
+			t.Fatalf("apply %d: %v", f.Seq, err)
+		}
+	}
+	if err := r.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shard id is escaped, never a path
+	path := filepath.Join(dir, "org%2F1.db")
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append(bytes.Repeat([]byte{'a'}, minPageSize), bytes.Repeat([]byte{'c'}, minPageSize)...), bytes.Repeat([]byte{'d'}, minPageSize)...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("replica after seq 3 is not pages a, c, d (%d bytes)", len(got))
+	}
+	if seq, ok := m.AppliedSeq("org/1"); !ok || seq != 3 {
+		t.Fatalf("applied seq = %d, %v, want 3", seq, ok)
+	}
+	if v := m.FramesApplied.Get(); v != 3 {
+		t.Fatalf("frames applied = %v, want 3", v)
+	}
+	if v := m.PagesApplied.Get(); v != 4 {
+		t.Fatalf("pages applied = %v, want 4", v)
+	}
+
+	// the watermark and the page size outlive the process
+	m2 := NewMetrics()
+	r, err = openReplica(dir, "org/1", m2)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	t.Cleanup(func() { _ = r.close() })
+	if r.Seq() != 3 {
+		t.Fatalf("reopened seq = %d, want 3", r.Seq())
+	}
+	if seq, ok := m2.AppliedSeq("org/1"); !ok || seq != 3 {
+		t.Fatalf("reopened applied seq = %d, %v, want 3", seq, ok)
+	}
+	if r.pages.pageSize != minPageSize {
+		t.Fatalf("reopened page size = %d, want %d", r.pages.pageSize, minPageSize)
+	}
+	if err := r.apply(newFrame("org/1", 4, 3, pagePayload(1, map[uint32]byte{1: 'e'}))); err != nil {
+		t.Fatalf("apply 4 after reopen: %v", err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, bytes.Repeat([]byte{'e'}, minPageSize)) {
+		t.Fatalf("replica after seq 4 is not page e (%d bytes)", len(got))
+	}
+}
+
+func TestReplicaRejects(t *testing.T) {
+	m := NewMetrics()
+	r, err := openReplica(t.TempDir(), "s", m)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = r.close() })
+
+	if err := r.apply(newFrame("s", 1, 0, pagePayload(1, map[uint32]byte{1: 'a'}))); err != nil {
+		t.Fatalf("apply 1: %v", err)
+	}
+
+	tampered := newFrame("s", 2, 1, pagePayload(1, map[uint32]byte{1: 'b'}))
+	tampered.Payload[len(tampered.Payload)-1] = 'x'
+
+	badPage := newFrame("s", 2, 1, pagePayload(1, map[uint32]byte{2: 'b'})) // page 2 of a 1-page database
+
+	otherSize := append([]byte{0, 0, 4, 0, 0, 0, 0, 1, 0, 0, 0, 1}, bytes.Repeat([]byte{'b'}, 1024)...)
+
+	scenarios := []struct {
+		name  string
+		frame Frame
+	}{
+		{"checksum mismatch", tampered},
+		{"gap", newFrame("s", 3, 2, nil)},
+		{"replay", newFrame("s", 1, 0, nil)},
+		{"wrong prev", newFrame("s", 2, 0, nil)},
+		{"other shard", newFrame("t", 2, 1, nil)},
+		{"page outside the database", badPage},
+		{"page size change", newFrame("s", 2, 1, otherSize)},
+	}
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if err := r.apply(s.frame); err == nil {
+				t.Fatal("expected an error")
+			}
+			if r.Seq() != 1 {
+				t.Fatalf("watermark moved to %d", r.Seq())
+			}
+		})
+	}
+	if v := m.FramesInvalid.Get(); v != 1 {
+		t.Fatalf("invalid frames = %v, want 1", v)
+	}
+
+	if err := r.apply(newFrame("s", 2, 1, nil)); err != nil {
+		t.Fatalf("apply 2 after the rejections: %v", err)
+	}
+}
+
+// Frames from a writer without a page capture keep the shard's numbering, but
+// the replica they leave holds no database to hand a member catching up.
+func TestReplicaWithoutPagesRefusesSnapshot(t *testing.T) {
+	r, err := openReplica(t.TempDir(), "s", NewMetrics())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = r.close() })
+
+	for seq := uint64(1); seq <= 2; seq++ {
+		if err := r.apply(newFrame("s", seq, seq-1, nil)); err != nil {
+			t.Fatalf("apply %d: %v", seq, err)
+		}
+	}
+	if r.Seq() != 2 {
+		t.Fatalf("watermark = %d, want 2", r.Seq())
+	}
+	if _, err := r.snapshot(0); err == nil {
+		t.Fatal("expected no snapshot of a replica without pages")
+	}
+
+	if err := r.apply(newFrame("s", 3, 2, pagePayload(1, map[uint32]byte{1: 'a'}))); err != nil {
+		t.Fatalf("apply 3: %v", err)
+	}
+	if snap, err := r.snapshot(0); err != nil || snap.seq != 3 {
+		t.Fatalf("snapshot after a page landed: %+v %v", snap, err)
+	}
+}
+
+// pageSource captures one single-page commit per call, each filling page 1
+// with the next letter.
+type pageSource struct {
+	mu   sync.Mutex
+	next byte
+}
+
+func (p *pageSource) CapturePayload(string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next++
+	return pagePayload(1, map[uint32]byte{1: 'a' + p.next - 1}), nil
+}
+
+// TestNodeAppliesFinalizedFrames drives commits through the WAL hook of a
+// single-member node and checks they land in the replica, and that a node
+// started again over the same directory carries on from the watermark.
+func TestNodeAppliesFinalizedFrames(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		Enabled:     true,
+		ShardKey:    "user_id",
+		Replication: 1,
+		NodeID:      "a",
+		Role:        RoleValidator,
+		Archive:     "off",
+		ReplicaDir:  dir,
+		ListenHTTP:  ":0",
+		ListenP2P:   ":0",
+	}
+	src := &pageSource{}
+
+	run := func(commits int, wantSeq uint64) {
+		t.Helper()
+		n, err := newNodeWithTransport(cfg, nil)
+		if err != nil {
+			t.Fatalf("node: %v", err)
+		}
+		n.walSrc = src
+		if err := n.Start(context.Background()); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		defer n.Stop(context.Background())
+
+		h := &fakeHook{}
+		if err := n.InstallWALHook(h, "shard-a"); err != nil {
+			t.Fatalf("InstallWALHook: %v", err)
+		}
+		for i := 0; i < commits; i++ {
+			if rc := h.cb(); rc != 0 {
+				t.Fatalf("commit hook returned %d", rc)
+			}
+		}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			seq, _ := n.Metrics().AppliedSeq("shard-a")
+			if seq >= wantSeq {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timeout: applied seq %d, want %d (apply errors %v)", seq, wantSeq, n.Metrics().ApplyErrors.Get())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	run(3, 3)
+
+	got, err := os.ReadFile(filepath.Join(dir, "shard-a.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte{'c'}, minPageSize)) {
+		t.Fatalf("replica after 3 commits is not page c (%d bytes)", len(got))
+	}
+
+	// a restarted member resumes numbering at the watermark rather than
+	// emitting seq 1 again, which the shard would drop as stale
+	run(2, 5)
+
+	got, _ = os.ReadFile(filepath.Join(dir, "shard-a.db"))
+	if !bytes.Equal(got, bytes.Repeat([]byte{'e'}, minPageSize)) {
+		t.Fatalf("replica after 5 commits is not page e (%d bytes)", len(got))
+	}
+	if seq, _, err := readWatermark(filepath.Join(dir, "shard-a.db.seq")); err != nil || seq != 5 {
+		t.Fatalf("persisted watermark = %d (%v), want 5", seq, err)
+	}
+}
@@ -0,0 +1,293 @@
+package network
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Point-in-time restore: replay a shard's archived frames from seq 1 into a
+// fresh SQLite file, stopping at a seq or a time.
+//
+// A frame's payload is the pages its transaction left changed, so replaying
+// every frame up to N in order leaves the file each page had after commit N —
+// the database at that txseq. That only holds for an unbroken prefix. Range
+// skips a segment it cannot verify rather than halting on it (R3), so a replay
+// checks for itself that every seq from 1 arrived, and refuses to hand back a
+// database with a hole in it.
+//
+// A replay also has to have written pages. A writer with no page capture
+// installed (see SetWALSource) archives frames with empty payloads, which number
+// and order the commits but carry none of their data; replaying those yields an
+// empty file that SQLite opens happily. Restore refuses one rather than hand it
+// back as the database.
+//
+// This file replays and nothing else. Swapping the result in for a live
+// database is the app's business, and so is checking that SQLite can open it.
+
+// ErrNoPages is returned by Restore when the frames it replayed carry no pages:
+// the shard was archived without a page capture, so there is no database in
+// its archive to restore.
+var ErrNoPages = errors.New("restore: the archived frames carry no pages; the shard was archived without a page capture")
+
+// RestorePoint is where a restore stops: at a frame's seq, or at the last frame
+// committed at or before a time. The zero value is the end of the archive.
+type RestorePoint struct {
+	Seq  uint64
+	Time time.Time
+}
+
+// ParseRestorePoint reads a restore point the way an operator writes one: a
+// bare integer is a seq, anything else an RFC 3339 timestamp. Empty is the end
+// of the archive.
+func ParseRestorePoint(s string) (RestorePoint, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return RestorePoint{}, nil
+	}
+	if seq, err := strconv.ParseUint(s, 10, 64); err == nil {
+		if seq == 0 {
+			return RestorePoint{}, errors.New("restore: seq starts at 1")
+		}
+		return RestorePoint{Seq: seq}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return RestorePoint{}, fmt.Errorf("restore: %q is neither a seq nor an RFC 3339 time", s)
+	}
+	return RestorePoint{Time: t}, nil
+}
+
+// RestoreResult is where a replay stopped.
+type RestoreResult struct {
+	Shard string `json:"shard"`
+	// Seq is the last frame applied; the database is as of its commit.
+	Seq uint64 `json:"seq"`
+	// Timestamp is when that frame was committed.
+	Timestamp time.Time `json:"timestamp"`
+	Frames    int       `json:"frames"`
+	Pages     int       `json:"pages"`
+}
+
+// Restore replays shardID's archived frames into a new SQLite file at out,
+// through the frame at is at. out must not exist; on error it is removed.
+//
+// Segments are verified against the archive's trusted keys by Range, and each
+// frame's checksum here. A seq that does not arrive — because its segment was
+// skipped as unverifiable, or was never written — fails the restore at that
+// seq, as does an archive that ends before at.Seq. A replay that wrote no page
+// fails with ErrNoPages.
+func Restore(ctx context.Context, a Archive, shardID string, at RestorePoint, out string) (_ *RestoreResult, err error) {
+	if a == nil {
+		return nil, errors.New("restore: archive is off")
+	}
+
+	upper := at.Seq
+	if upper == 0 {
+		upper = math.MaxUint64
+	}
+	it, err := a.Range(ctx, shardID, 1, upper)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+
+	file, err := os.OpenFile(out, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("restore: %w", cerr)
+		}
+		if err != nil {
+			_ = os.Remove(out)
+		}
+	}()
+
+	res := &RestoreResult{Shard: shardID}
+	pf := &pageFile{f: file}
+	for f, ferr := range it {
+		if ferr != nil {
+			return nil, fmt.Errorf("restore: %w", ferr)
+		}
+		if f.ShardID != shardID {
+			return nil, fmt.Errorf("restore: frame %d is for shard %q", f.Seq, f.ShardID)
+		}
+		if err := f.Valid(); err != nil {
+			return nil, fmt.Errorf("restore: frame %d: %w", f.Seq, err)
+		}
+		if f.Seq != res.Seq+1 || f.PrevSeq != res.Seq {
+			return nil, fmt.Errorf("restore: archive has no verifiable frame %d (next is %d); a replay cannot cross the gap", res.Seq+1, f.Seq)
+		}
+		if !at.Time.IsZero() && f.Timestamp > at.Time.UnixNano() {
+			break
+		}
+		n, err := pf.apply(f.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("restore: frame %d: %w", f.Seq, err)
+		}
+		res.Seq = f.Seq
+		res.Timestamp = time.Unix(0, f.Timestamp).UTC()
+		res.Frames++
+		res.Pages += n
+	}
+
+	if res.Frames == 0 {
+		return nil, fmt.Errorf("restore: archive holds no frames for shard %q at that point", shardID)
+	}
+	if at.Seq > 0 && res.Seq < at.Seq {
+		return nil, fmt.Errorf("restore: archive for shard %q ends at seq %d, before %d", shardID, res.Seq, at.Seq)
+	}
+	if res.Pages == 0 || pf.pageSize == 0 {
+		return nil, fmt.Errorf("%w (shard %q, through seq %d)", ErrNoPages, shardID, res.Seq)
+	}
+
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("restore: %w", err)
+	}
+	return res, nil
+}
+
+// Page payload — what a frame carries for one committed transaction:
+//
+//	page_size  uint32  big-endian, a power of two in [512, 65536]
+//	db_pages   uint32  big-endian, the database's size in pages after commit
+//	repeat:
+//	  pgno     uint32  big-endian, 1-based
+//	  page     [page_size]byte
+//
+// An empty payload changes no page; the standalone capture sends those.
+const (
+	pagePayloadHeaderLen = 8
+	minPageSize          = 512
+	maxPageSize          = 65536
+)
+
+// pageFile is a database file being rebuilt page by page. Its page size is
+// fixed by the first payload that names one.
+type pageFile struct {
+	f        *os.File
+	pageSize uint32
+}
+
+// apply writes a payload's pages and sizes the file to the commit's page
+// count. It returns the number of pages written.
+func (p *pageFile) apply(payload []byte) (int, error) {
+	if len(payload) == 0 {
+		return 0, nil
+	}
+	if len(payload) < pagePayloadHeaderLen {
+		return 0, errors.New("page payload: header truncated")
+	}
+	size := binary.BigEndian.Uint32(payload[0:])
+	dbPages := binary.BigEndian.Uint32(payload[4:])
+	if size < minPageSize || size > maxPageSize || size&(size-1) != 0 {
+		return 0, fmt.Errorf("page payload: invalid page size %d", size)
+	}
+	if p.pageSize != 0 && size != p.pageSize {
+		return 0, fmt.Errorf("page payload: page size %d, file has %d", size, p.pageSize)
+	}
+	body := payload[pagePayloadHeaderLen:]
+	rec := 4 + int(size)
+	if len(body)%rec != 0 {
+		return 0, errors.New("page payload: truncated page")
+	}
+	p.pageSize = size
+
+	n := 0
+	for off := 0; off < len(body); off += rec {
+		pgno := binary.BigEndian.Uint32(body[off:])
+		if pgno == 0 || pgno > dbPages {
+			return n, fmt.Errorf("page payload: page %d outside a %d-page database", pgno, dbPages)
+		}
+		if _, err := p.f.WriteAt(body[off+4:off+rec], int64(pgno-1)*int64(size)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, p.f.Truncate(int64(dbPages) * int64(size))
+}
+
+// SplitArchiveURL splits an archive URL as BASE_ARCHIVE spells it —
+// scheme://bucket[/prefix...]/svc, or file:///path/svc — into the URL
+// NewArchive takes and the service name, which is the last path segment.
+func SplitArchiveURL(raw string) (bucketURL, svc string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("archive: parse %q: %w", raw, err)
+	}
+	if u.Scheme == "" || (u.Host == "" && u.Path == "") {
+		return "", "", fmt.Errorf("archive: url %q has no scheme, or no bucket or path", raw)
+	}
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return "", "", fmt.Errorf("archive: url %q names no service", raw)
+	}
+	prefix, svc := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		prefix, svc = path[:i], path[i+1:]
+	}
+	u.Path = ""
+	if prefix != "" {
+		u.Path = "/" + prefix
+	}
+	return u.String(), svc, nil
+}
+
+// OpenRestoreArchive opens the archive at rawURL for replay, trusting segments
+// signed by any of trusted.
+//
+// A reader always trusts its own signing key, and a process that restores has
+// none configured, so it would trust only a key it generated a moment ago and
+// skip every segment. An empty trusted set is refused for that reason rather
+// than left to fail as a gap at seq 1.
+func OpenRestoreArchive(ctx context.Context, rawURL string, trusted []ed25519.PublicKey) (Archive, error) {
+	if rawURL == "" || strings.EqualFold(rawURL, "off") {
+		return nil, errors.New("archive: BASE_ARCHIVE is off, so there is nothing to restore from")
+	}
+	if len(trusted) == 0 {
+		return nil, errors.New("archive: no trusted segment keys (BASE_ARCHIVE_TRUSTED_KEYS), so no segment would verify")
+	}
+	bucketURL, svc, err := SplitArchiveURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewArchive(ctx, ArchiveConfig{URL: bucketURL, TrustedSegmentKeys: trusted}, svc, nil)
+}
+
+// ParseSegmentKeys reads a comma-separated list of Ed25519 public keys, each
+// hex or standard base64.
+func ParseSegmentKeys(s string) ([]ed25519.PublicKey, error) {
+	return parsePublicKeys(s, "segment key")
+}
+
+// parsePublicKeys is ParseSegmentKeys for any set of keys, named by what in
+// its errors.
+func parsePublicKeys(s, what string) ([]ed25519.PublicKey, error) {
+	var keys []ed25519.PublicKey
+	for _, raw := range strings.Split(s, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		b, err := hex.DecodeString(raw)
+		if err != nil {
+			b, err = base64.StdEncoding.DecodeString(raw)
+		}
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%s %q: want a %d-byte Ed25519 public key, hex or base64", what, raw, ed25519.PublicKeySize)
+		}
+		keys = append(keys, ed25519.PublicKey(b))
+	}
+	return keys, nil
+}
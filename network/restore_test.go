@@ -0,0 +1,217 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagePayload builds a payload that leaves a dbPages-page database with each
+// named page filled with its byte.
+func pagePayload(dbPages uint32, pages map[uint32]byte) []byte {
+	const size = minPageSize
+	b := binary.BigEndian.AppendUint32(nil, size)
+	b = binary.BigEndian.AppendUint32(b, dbPages)
+	for pgno, fill := range pages {
+		b = binary.BigEndian.AppendUint32(b, pgno)
+		b = append(b, bytes.Repeat([]byte{fill}, size)...)
+	}
+	return b
+}
+
+// archiveFrames writes frames to up through a writer signing with priv, as
+// one or more segments of their own.
+func archiveFrames(t *testing.T, up *memUploader, priv ed25519.PrivateKey, frames ...Frame) {
+	t.Helper()
+	w := newArchiveWriter(up, "svc", ArchiveConfig{SigningKey: priv, FlushInterval: time.Hour}, nil)
+	for _, f := range frames {
+		if err := w.Append(context.Background(), f.ShardID, f.Seq, f.encode()); err != nil {
+			t.Fatalf("append %d: %v", f.Seq, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestRestoreStopsAtSeq(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	up := newMemUploader()
+	archiveFrames(t, up, priv,
+		newFrame("s", 1, 0, pagePayload(2, map[uint32]byte{1: 'a', 2: 'b'})),
+		newFrame("s", 2, 1, pagePayload(3, map[uint32]byte{2: 'c', 3: 'd'})),
+		newFrame("s", 3, 2, pagePayload(1, map[uint32]byte{1: 'e'})),
+	)
+	reader := newArchiveWriter(up, "svc", ArchiveConfig{SigningKey: priv}, nil)
+	t.Cleanup(func() { _ = reader.Close() })
+
+	out := filepath.Join(t.TempDir(), "data.db")
+	res, err := Restore(context.Background(), reader, "s", RestorePoint{Seq: 2}, out)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if res.Seq != 2 || res.Frames != 2 || res.Pages != 4 {
+		t.Fatalf("result: %+v", res)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append(bytes.Repeat([]byte{'a'}, minPageSize), bytes.Repeat([]byte{'c'}, minPageSize)...), bytes.Repeat([]byte{'d'}, minPageSize)...)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("file after seq 2 is not pages a, c, d (%d bytes)", len(got))
+	}
+
+	// the whole archive: seq 3 shrinks the database to one page
+	all := filepath.Join(t.TempDir(), "all.db")
+	if _, err := Restore(context.Background(), reader, "s", RestorePoint{}, all); err != nil {
+		t.Fatalf("restore all: %v", err)
+	}
+	if got, _ := os.ReadFile(all); !bytes.Equal(got, bytes.Repeat([]byte{'e'}, minPageSize)) {
+		t.Fatalf("file after seq 3 is not page e (%d bytes)", len(got))
+	}
+
+	// past the end of the archive is not the end of the archive
+	if _, err := Restore(context.Background(), reader, "s", RestorePoint{Seq: 9}, filepath.Join(t.TempDir(), "x.db")); err == nil {
+		t.Fatal("expected a restore past the archive's end to fail")
+	}
+}
+
+// A segment signed by a key the reader does not trust is skipped by Range. The
+// frames it held are a hole, and a database replayed across one is wrong, so
+// the restore stops there and leaves no file behind.
+func TestRestoreRefusesAGap(t *testing.T) {
+	_, trusted, _ := ed25519.GenerateKey(nil)
+	_, foreign, _ := ed25519.GenerateKey(nil)
+	up := newMemUploader()
+	archiveFrames(t, up, trusted, newFrame("s", 1, 0, pagePayload(1, map[uint32]byte{1: 'a'})))
+	archiveFrames(t, up, foreign, newFrame("s", 2, 1, pagePayload(1, map[uint32]byte{1: 'b'})))
+	archiveFrames(t, up, trusted, newFrame("s", 3, 2, pagePayload(1, map[uint32]byte{1: 'c'})))
+
+	reader := newArchiveWriter(up, "svc", ArchiveConfig{SigningKey: trusted}, nil)
+	t.Cleanup(func() { _ = reader.Close() })
+
+	out := filepath.Join(t.TempDir(), "data.db")
+	_, err := Restore(context.Background(), reader, "s", RestorePoint{}, out)
+	if err == nil || !strings.Contains(err.Error(), "frame 2") {
+		t.Fatalf("expected the gap at frame 2, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("expected no file after a failed restore, got %v", err)
+	}
+
+	// up to the gap is a prefix, and a prefix restores
+	if _, err := Restore(context.Background(), reader, "s", RestorePoint{Seq: 1}, out); err != nil {
+		t.Fatalf("restore to seq 1: %v", err)
+	}
+}
+
+func TestRestoreStopsAtTime(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	f1 := newFrame("s", 1, 0, pagePayload(1, map[uint32]byte{1: 'a'}))
+	f2 := newFrame("s", 2, 1, pagePayload(2, map[uint32]byte{1: 'b', 2: 'c'}))
+	f2.Timestamp = f1.Timestamp + int64(time.Hour)
+	f2.Cksm = f2.computeCksm()
+
+	up := newMemUploader()
+	archiveFrames(t, up, priv, f1, f2)
+	reader := newArchiveWriter(up, "svc", ArchiveConfig{SigningKey: priv}, nil)
+	t.Cleanup(func() { _ = reader.Close() })
+
+	out := filepath.Join(t.TempDir(), "data.db")
+	at := RestorePoint{Time: time.Unix(0, f1.Timestamp).Add(time.Minute)}
+	res, err := Restore(context.Background(), reader, "s", at, out)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if res.Seq != 1 || res.Pages != 1 {
+		t.Fatalf("want seq 1, the last frame before the time, got %+v", res)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, bytes.Repeat([]byte{'a'}, minPageSize)) {
+		t.Fatalf("file as of seq 1 is not page a (%d bytes)", len(got))
+	}
+}
+
+// Frames archived without a page capture number the commits but hold none of
+// their data. Replaying them builds an empty file, which is not the database.
+func TestRestoreRefusesNoPages(t *testing.T) {
+	_, priv, _ := ed25519.GenerateKey(nil)
+	up := newMemUploader()
+	archiveFrames(t, up, priv, newFrame("s", 1, 0, nil), newFrame("s", 2, 1, nil))
+	reader := newArchiveWriter(up, "svc", ArchiveConfig{SigningKey: priv}, nil)
+	t.Cleanup(func() { _ = reader.Close() })
+
+	out := filepath.Join(t.TempDir(), "data.db")
+	_, err := Restore(context.Background(), reader, "s", RestorePoint{}, out)
+	if !errors.Is(err, ErrNoPages) {
+		t.Fatalf("expected ErrNoPages, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("expected no file after a refused restore, got %v", err)
+	}
+}
+
+func TestPageFileRejectsForeignPages(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	pf := &pageFile{f: f}
+
+	cases := map[string][]byte{
+		"truncated header": {0, 0, 2},
+		"odd page size":    binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, 1000), 1),
+		"page zero":        pagePayload(1, map[uint32]byte{0: 'x'}),
+		"page past end":    pagePayload(1, map[uint32]byte{2: 'x'}),
+	}
+	for name, payload := range cases {
+		if _, err := pf.apply(payload); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseRestorePoint(t *testing.T) {
+	if p, err := ParseRestorePoint("42"); err != nil || p.Seq != 42 {
+		t.Fatalf("seq: %+v %v", p, err)
+	}
+	if p, err := ParseRestorePoint("2026-01-02T03:04:05Z"); err != nil || p.Time.IsZero() {
+		t.Fatalf("time: %+v %v", p, err)
+	}
+	if p, err := ParseRestorePoint(""); err != nil || p != (RestorePoint{}) {
+		t.Fatalf("empty: %+v %v", p, err)
+	}
+	for _, bad := range []string{"0", "yesterday"} {
+		if _, err := ParseRestorePoint(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestSplitArchiveURL(t *testing.T) {
+	cases := []struct{ in, bucket, svc string }{
+		{"s3://b/svc", "s3://b", "svc"},
+		{"s3://b/pre/fix/svc/", "s3://b/pre/fix", "svc"},
+		{"file:///var/archive/svc", "file:///var/archive", "svc"},
+	}
+	for _, c := range cases {
+		bucket, svc, err := SplitArchiveURL(c.in)
+		if err != nil || bucket != c.bucket || svc != c.svc {
+			t.Errorf("%s: got %q %q %v", c.in, bucket, svc, err)
+		}
+	}
+	for _, bad := range []string{"s3://b", "b/svc", "file://"} {
+		if _, _, err := SplitArchiveURL(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
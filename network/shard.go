@@ -1,9 +1,12 @@
 package network
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
 	"sync"
+	"time"
 )
 
 // NodeID is a stable member identity — in k8s the pod DNS name, in compose
@@ -41,13 +44,23 @@ type Shard struct {
 	pending    map[uint64]Frame
 	pendingCap int
 
+	// catchingUp is set while the shard's replica is filled from a member
+	// or the archive (see catchup.go). The shard does not vote meanwhile:
+	// peer frames wait in held instead of reaching the engine, and local
+	// commits are refused. held is capped at pendingCap like pending.
+	catchingUp  bool
+	held        map[uint64]Frame
+	lastCatchUp time.Time
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 // newShard starts the Quasar engine and the apply goroutine. apply is the
-// node-level callback invoked for every finalised frame.
-func newShard(parent context.Context, id string, members []NodeID, replication int, m *Metrics, apply ApplyFunc) (*Shard, error) {
+// node-level callback invoked for every finalised frame; start is the seq
+// already applied (the replica's watermark), so the first frame applied is
+// start+1.
+func newShard(parent context.Context, id string, members []NodeID, replication int, start uint64, m *Metrics, apply ApplyFunc) (*Shard, error) {
 	ctx, cancel := context.WithCancel(parent)
 
 	threshold := quorum(replication)
@@ -66,7 +79,9 @@ func newShard(parent context.Context, id string, members []NodeID, replication i
 		engine:     eng,
 		metric:     m,
 		applied:    make(map[ApplyKey]struct{}),
+		localSeq:   start,
 		pending:    make(map[uint64]Frame),
+		held:       make(map[uint64]Frame),
 		pendingCap: 1024, // bounded per-shard buffer for out-of-order frames
 		ctx:        ctx,
 		cancel:     cancel,
@@ -266,6 +281,83 @@ func (s *Shard) LocalSeq() uint64 {
 	return s.localSeq
 }
 
+// CatchingUp reports whether the shard is catching up, and so neither votes
+// nor takes local commits.
+func (s *Shard) CatchingUp() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.catchingUp
+}
+
+// beginCatchUp marks the shard catching up. It returns false when the shard
+// already is, or started its last catch-up less than catchUpRetry ago — a
+// catch-up that found no source is not tried again on every frame.
+func (s *Shard) beginCatchUp() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.catchingUp || time.Since(s.lastCatchUp) < catchUpRetry {
+		return false
+	}
+	s.catchingUp = true
+	s.lastCatchUp = time.Now()
+	return true
+}
+
+// hold keeps a peer frame back while the shard catches up and reports whether
+// it did. When held is full the furthest frame goes, as in applyLoop.
+func (s *Shard) hold(f Frame) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.catchingUp {
+		return false
+	}
+	if len(s.held) >= s.pendingCap {
+		var maxSeq uint64
+		for seq := range s.held {
+			maxSeq = max(maxSeq, seq)
+		}
+		if f.Seq >= maxSeq {
+			s.metric.FramesRejectedSeqGap.Inc()
+			return true
+		}
+		delete(s.held, maxSeq)
+		s.metric.FramesRejectedSeqGap.Inc()
+	}
+	s.held[f.Seq] = f
+	return true
+}
+
+// endCatchUp resumes voting from seq, the replica's watermark, and returns the
+// frames held meanwhile that follow it, in seq order, for the caller to
+// submit.
+//
+// This is the one place localSeq moves other than by +1. It moves to what
+// the replica verified and holds — possibly down, after applies failed and
+// left localSeq ahead of the file, which lets the frames the file is missing
+// in again — never to a seq a frame header claimed.
+func (s *Shard) endCatchUp(seq uint64) []Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.catchingUp = false
+	s.localSeq = seq
+	for p := range s.pending {
+		if p <= seq {
+			delete(s.pending, p)
+		}
+	}
+
+	held := make([]Frame, 0, len(s.held))
+	for _, f := range s.held {
+		if f.Seq > seq {
+			held = append(held, f)
+		}
+	}
+	clear(s.held)
+	slices.SortFunc(held, func(a, b Frame) int { return cmp.Compare(a.Seq, b.Seq) })
+	return held
+}
+
 // ApplyFunc is called once per finalised frame per shard. Errors are
 // counted on the metrics and do not retry — Quasar has already finalised
 // the frame, so the caller owns recovery.
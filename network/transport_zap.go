@@ -8,10 +8,12 @@
 // :9999), explicit peer dial to every entry in BASE_PEERS (no mDNS in K8s),
 // and a single registered handler for envelope delivery.
 //
-// The envelope payload is the output of `Frame.encode()` — the shardID is
-// already embedded in the frame, so the wire carries the frame bytes and
-// nothing else. Decode is the inverse. One Envelope in, one ZAP message
-// out (no fan-out inside the transport; the Quasar shard engine dedupes).
+// The envelope payload is encodeEnvelope's output (identity.go): the
+// `Frame.encode()` bytes — the shardID is already embedded in the frame —
+// and the sender's key and signature. Decode is the inverse, and still reads
+// a bare frame from a member that predates signing. One Envelope in, one ZAP
+// message out (no fan-out inside the transport; the Quasar shard engine
+// dedupes).
 //
 // Scale 1 → N:
 //   - N=1 (singleton): cfg.Peers is just self. Broadcast is a no-op (no peers
@@ -44,6 +46,10 @@ import (
 // field — so the effective space is uint8. 0xBE = "Base Envelope".
 const zapEnvelopeMsgType uint8 = 0xBE
 
+// zapStateMsgType is the handler key for catch-up requests (see catchup.go),
+// which unlike envelopes are answered. 0xBF = "Base Fetch".
+const zapStateMsgType uint8 = 0xBF
+
 // zapServiceType is the mDNS service identifier. mDNS is disabled on the
 // production Node (K8s pods rely on BASE_PEERS, not link-local), but the
 // type string is still required by luxfi/zap's NodeConfig.
@@ -67,6 +73,7 @@ type zapTransport struct {
 	logger luxlog.Logger
 
 	recv   atomic.Value // func(Envelope) — set once by Start, read by handler
+	serve  atomic.Value // func(StateRequest) (StateChunk, error) — set by ServeState
 	ctx    context.Context
 	cancel context.CancelFunc
 
@@ -74,6 +81,11 @@ type zapTransport struct {
 	// called and then Stop and then Start again on the same transport
 	// instance (defensive — base/network today constructs + starts once).
 	reconnectOnce sync.Once
+
+	// ids maps a BASE_PEERS address, which is what the router names
+	// members by, to the NodeID its handshake announced, which is what
+	// zap keys connections by. Filled as peers are dialled.
+	ids sync.Map // string → string
 }
 
 // newZapTransport builds a zapTransport from a validated Config. It does
@@ -114,6 +126,7 @@ func (z *zapTransport) Start(ctx context.Context, recv func(Envelope)) error {
 	z.recv.Store(recv)
 
 	z.node.Handle(uint16(zapEnvelopeMsgType), z.handle)
+	z.node.Handle(uint16(zapStateMsgType), z.handleState)
 
 	if err := z.node.Start(); err != nil {
 		return fmt.Errorf("zap-transport: start node: %w", err)
@@ -138,8 +151,7 @@ func (z *zapTransport) Start(ctx context.Context, recv func(Envelope)) error {
 // that aren't yet connected are skipped silently — the reconnect loop will
 // catch them up, and Quasar's DAG sync replays missed frames on reconnect.
 func (z *zapTransport) Publish(env Envelope) error {
-	payload := env.Frame.encode()
-	msg, err := buildZapEnvelopeMessage(payload)
+	msg, err := buildZapMessage(zapEnvelopeMsgType, encodeEnvelope(env))
 	if err != nil {
 		return fmt.Errorf("zap-transport: build message: %w", err)
 	}
@@ -175,27 +187,101 @@ func (z *zapTransport) Stop(ctx context.Context) error {
 }
 
 // handle is registered with zap.Node. It decodes the envelope bytes and
-// delivers the frame to the shard engine via the recv callback.
+// delivers the envelope, signature and all, to the node via the recv
+// callback; verifying it is the node's job.
 func (z *zapTransport) handle(_ context.Context, from string, msg *zap.Message) (*zap.Message, error) {
 	payload := extractZapEnvelopePayload(msg)
 	if len(payload) == 0 {
 		return nil, errors.New("zap-transport: empty envelope payload")
 	}
-	frame, err := decodeFrame(payload)
+	env, err := decodeEnvelope(payload)
 	if err != nil {
 		z.logger.Debug("decode failed", "peer", from, "err", err)
 		return nil, nil // don't propagate decode errors to the peer
 	}
-	if err := frame.Valid(); err != nil {
+	if err := env.Frame.Valid(); err != nil {
 		z.logger.Debug("invalid frame dropped", "peer", from, "err", err)
 		return nil, nil
 	}
 	if cb, ok := z.recv.Load().(func(Envelope)); ok && cb != nil {
-		cb(Envelope{ShardID: frame.ShardID, Frame: frame})
+		cb(env)
 	}
 	return nil, nil
 }
 
+// ServeState implements StateTransport.
+func (z *zapTransport) ServeState(serve func(StateRequest) (StateChunk, error)) {
+	z.serve.Store(serve)
+}
+
+// Request implements StateTransport: one zap Call to the peer, which answers
+// from handleState.
+func (z *zapTransport) Request(ctx context.Context, peer NodeID, req StateRequest) (StateChunk, error) {
+	if z.ctx == nil {
+		return StateChunk{}, errors.New("zap-transport: not started")
+	}
+	id, err := z.peerID(string(peer))
+	if err != nil {
+		return StateChunk{}, err
+	}
+	msg, err := buildZapMessage(zapStateMsgType, encodeStateRequest(req))
+	if err != nil {
+		return StateChunk{}, fmt.Errorf("zap-transport: build message: %w", err)
+	}
+	resp, err := z.node.Call(ctx, id, msg)
+	if err != nil {
+		return StateChunk{}, fmt.Errorf("zap-transport: %s: %w", peer, err)
+	}
+	return decodeStateAnswer(extractZapEnvelopePayload(resp))
+}
+
+// handleState answers a peer's catch-up request with the installed
+// ServeState handler. Failures travel in the answer, not as a transport
+// error, so the peer can tell a refusal from a lost connection.
+func (z *zapTransport) handleState(_ context.Context, from string, msg *zap.Message) (*zap.Message, error) {
+	var chunk StateChunk
+	req, err := decodeStateRequest(extractZapEnvelopePayload(msg))
+	if err == nil {
+		serve, _ := z.serve.Load().(func(StateRequest) (StateChunk, error))
+		if serve == nil {
+			err = errors.New("not serving state")
+		} else {
+			chunk, err = serve(req)
+		}
+	}
+	if err != nil {
+		z.logger.Debug("state request refused", "peer", from, "err", err)
+	}
+	return buildZapMessage(zapStateMsgType, encodeStateAnswer(chunk, err))
+}
+
+// peerID returns the zap NodeID behind a BASE_PEERS address, dialling it when
+// it has not been yet.
+func (z *zapTransport) peerID(addr string) (string, error) {
+	if id, ok := z.ids.Load(addr); ok {
+		return id.(string), nil
+	}
+	id, err := z.connect(addr)
+	if err == nil && id == "" {
+		err = fmt.Errorf("zap-transport: %s announced no node id", addr)
+	}
+	return id, err
+}
+
+// connect dials addr, or finds the connection it already has, and records
+// the NodeID behind it.
+func (z *zapTransport) connect(addr string) (string, error) {
+	id, err := z.node.ConnectDirectID(addr)
+	if err != nil {
+		return "", err
+	}
+	// the QUIC path does not report the id it learned
+	if id != "" {
+		z.ids.Store(addr, id)
+	}
+	return id, nil
+}
+
 // isSelfPeer returns true when the BASE_PEERS entry refers to this pod.
 //
 // Operator-emitted BASE_PEERS carries per-ordinal DNS names such as
@@ -228,7 +314,7 @@ func (z *zapTransport) dialAllOnce() {
 		if z.isSelfPeer(p) {
 			continue
 		}
-		if err := z.node.ConnectDirect(p); err != nil {
+		if _, err := z.connect(p); err != nil {
 			z.logger.Debug("initial peer dial failed (will retry)", "peer", p, "err", err)
 		}
 	}
@@ -256,7 +342,7 @@ func (z *zapTransport) reconnectLoop() {
 				if _, ok := connected[p]; ok {
 					continue
 				}
-				if err := z.node.ConnectDirect(p); err != nil {
+				if _, err := z.connect(p); err != nil {
 					z.logger.Debug("reconnect dial failed", "peer", p, "err", err)
 				}
 			}
@@ -280,17 +366,17 @@ func portFromListen(listen string) int {
 	return port
 }
 
-// buildZapEnvelopeMessage wraps the raw frame bytes in a ZAP message with
-// Flags = msgType << 8 so the receiving Node dispatches to the envelope
-// handler. The body is a single ZAP object with one `bytes` field at
+// buildZapMessage wraps payload — frame bytes, or a catch-up request or
+// answer — in a ZAP message with Flags = msgType << 8 so the receiving Node
+// dispatches to the matching handler. The body is a single ZAP object with one `bytes` field at
 // offset 0; this is the smallest valid ZAP message that carries a byte
 // slice without borrowing a full struct schema.
-func buildZapEnvelopeMessage(payload []byte) (*zap.Message, error) {
+func buildZapMessage(msgType uint8, payload []byte) (*zap.Message, error) {
 	b := zap.NewBuilder(len(payload) + 64)
 	obj := b.StartObject(8) // one bytes field = 4 bytes offset + 4 bytes length
 	obj.SetBytes(0, payload)
 	obj.FinishAsRoot()
-	raw := b.FinishWithFlags(uint16(zapEnvelopeMsgType) << 8)
+	raw := b.FinishWithFlags(uint16(msgType) << 8)
 	msg, err := zap.Parse(raw)
 	if err != nil {
 		return nil, fmt.Errorf("parse self-built message: %w", err)
@@ -311,8 +397,12 @@ func extractZapEnvelopePayload(msg *zap.Message) []byte {
 	return root.Bytes(0)
 }
 
-// Compile-time assertion: zapTransport satisfies Transport.
-var _ Transport = (*zapTransport)(nil)
+// Compile-time assertion: zapTransport satisfies Transport and
+// StateTransport.
+var (
+	_ Transport      = (*zapTransport)(nil)
+	_ StateTransport = (*zapTransport)(nil)
+)
 
 // Unused but imported — keep binary.LittleEndian reachable for future
 // frame-header extensions without re-adding the import.
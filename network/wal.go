@@ -240,8 +240,24 @@ func (n *node) InstallWALHook(rawConn any, shardID string) error {
 		return err
 	}
 
+	// A writer restarted over a replica picks up its numbering where the
+	// watermark left it; starting again at 1 would emit frames the shard
+	// drops as stale.
 	w := &shardWriter{shardID: shardID, src: n.walSrc}
+	w.seq.Store(s.LocalSeq())
+	w.prevSeq.Store(s.LocalSeq())
 	hook.RegisterCommitHook(func() int32 {
+		// A shard catching up does not vote, so a commit now would be a
+		// frame nobody finalises. Once it is level, numbering carries on
+		// from the seq it caught up to.
+		if s.CatchingUp() {
+			n.metrics.WALHookErrors.Inc()
+			return 1
+		}
+		if local := s.LocalSeq(); local > w.seq.Load() {
+			w.seq.Store(local)
+			w.prevSeq.Store(local)
+		}
 		f, err := w.buildFrame()
 		if err != nil {
 			n.metrics.WALHookErrors.Inc()
@@ -253,7 +269,7 @@ func (n *node) InstallWALHook(rawConn any, shardID string) error {
 		}
 		// Fan out to peers via transport. Best-effort — Quasar tolerates
 		// duplicate submissions and will converge once peers see it.
-		_ = n.transport.Publish(Envelope{ShardID: shardID, Frame: f})
+		_ = n.publish(Envelope{ShardID: shardID, Frame: f})
 		n.metrics.WALBytes.Add(float64(len(f.Payload)))
 		return 0
 	})
@@ -273,6 +289,19 @@ func SetWALSource(n Network, src walSource) {
 	nn.mu.Unlock()
 }
 
+// SetArchive installs the archive a catch-up reads when no member can serve
+// it (see catchup.go). The Network closes it on Stop. A no-op on a disabled
+// Network.
+func SetArchive(n Network, a Archive) {
+	nn, ok := n.(*node)
+	if !ok {
+		return
+	}
+	nn.mu.Lock()
+	nn.archive = a
+	nn.mu.Unlock()
+}
+
 // nopSource is the standalone capture — an empty payload. Still safe: the
 // frame carries shardID+seq+salt+cksm for routing and idempotency.
 type nopSource struct{}
@@ -0,0 +1,335 @@
+package messaging
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/mailer"
+	"github.com/hanzoai/base/tools/security"
+	"github.com/hanzoai/dbx"
+)
+
+// connectAccountBody is the body of POST /v1/messaging/accounts.
+type connectAccountBody struct {
+	Handle                    string     `json:"handle"`
+	HandleAliases             []string   `json:"handleAliases"`
+	Password                  string     `json:"password"`
+	IMAP                      IMAPParams `json:"imap"`
+	SMTP                      SMTPParams `json:"smtp"`
+	ContactAutoCreationPolicy string     `json:"contactAutoCreationPolicy"`
+}
+
+// handleConnectAccount connects an IMAP/SMTP account of the caller:
+//
+//	POST /v1/messaging/accounts {handle, password, imap, smtp, contactAutoCreationPolicy}
+//
+// It logs in once to check the password, stores it encrypted, and creates the
+// account's message channel, or, for an account connected before, replaces its
+// password and lets its channel sync again.
+func (p *plugin) handleConnectAccount(e *core.RequestEvent) error {
+	body := connectAccountBody{}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Failed to read the request body.", err)
+	}
+
+	address, err := mail.ParseAddress(body.Handle)
+	if err != nil || body.Password == "" || body.IMAP.Host == "" {
+		return e.BadRequestError("A handle, a password and an IMAP host are required.", nil)
+	}
+	handle := strings.ToLower(address.Address)
+
+	switch body.ContactAutoCreationPolicy {
+	case "":
+		body.ContactAutoCreationPolicy = "sent"
+	case "none", "sent", "sent_and_received":
+	default:
+		return e.BadRequestError("Invalid contactAutoCreationPolicy.", nil)
+	}
+
+	params := connectionParameters{IMAP: body.IMAP, SMTP: body.SMTP}
+
+	if params.SMTP.Host != "" {
+		if err := p.hosts.check(params.SMTP.Host, smtpPort(params.SMTP), smtpPorts); err != nil {
+			return e.BadRequestError("The SMTP server is not allowed.", nil)
+		}
+	}
+
+	// the password is checked before it is kept
+	username := params.IMAP.Username
+	if username == "" {
+		username = handle
+	}
+	client, err := p.dialIMAP(params.IMAP)
+	if errors.Is(err, errMailHostNotAllowed) {
+		return e.BadRequestError("The IMAP server is not allowed.", nil)
+	}
+	if err != nil {
+		return e.BadRequestError("Failed to connect to the IMAP server over TLS.", nil)
+	}
+	err = client.Login(username, body.Password)
+	client.Logout()
+	if err != nil {
+		return e.BadRequestError("The IMAP server refused the login.", nil)
+	}
+
+	owner := e.Auth.Id
+
+	tokenEnc, err := p.tokens.Encrypt(owner, body.Password)
+	if err != nil {
+		return e.InternalServerError("Failed to encrypt the account password.", err)
+	}
+
+	var account, channel *core.Record
+
+	err = e.App.RunInTransaction(func(txApp core.App) error {
+		account, err = txApp.FindFirstRecordByFilter(
+			"connectedAccount",
+			"owner = {:owner} && provider = {:provider} && handle = {:handle}",
+			dbx.Params{"owner": owner, "provider": providerIMAP, "handle": handle},
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			accounts, err := txApp.FindCachedCollectionByNameOrId("connectedAccount")
+			if err != nil {
+				return err
+			}
+			account = core.NewRecord(accounts)
+			account.Set("owner", owner)
+			account.Set("provider", providerIMAP)
+			account.Set("handle", handle)
+		} else if err != nil {
+			return err
+		}
+
+		aliases := make([]string, 0, len(body.HandleAliases))
+		for _, alias := range body.HandleAliases {
+			aliases = append(aliases, strings.ToLower(strings.TrimSpace(alias)))
+		}
+		account.Set("handleAliases", aliases)
+		account.Set("connectionParameters", params)
+		account.Set("accessTokenEnc", tokenEnc)
+		account.Set("authFailedAt", "")
+		if err := txApp.Save(account); err != nil {
+			return err
+		}
+
+		channel, err = txApp.FindFirstRecordByFilter(
+			"messageChannel",
+			"owner = {:owner} && connectedAccount = {:account}",
+			dbx.Params{"owner": owner, "account": account.Id},
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			channels, err := txApp.FindCachedCollectionByNameOrId("messageChannel")
+			if err != nil {
+				return err
+			}
+			channel = core.NewRecord(channels)
+			channel.Set("owner", owner)
+			channel.Set("connectedAccount", account.Id)
+			channel.Set("visibility", "share_everything")
+			channel.Set("isSyncEnabled", true)
+		} else if err != nil {
+			return err
+		}
+
+		channel.Set("contactAutoCreationPolicy", body.ContactAutoCreationPolicy)
+		channel.Set("syncStatus", "not_synced")
+		channel.Set("syncStage", stagePending)
+		channel.Set("throttleFailureCount", 0)
+		channel.Set("throttleRetryAfter", "")
+
+		return txApp.Save(channel)
+	})
+	if err != nil {
+		return e.BadRequestError("Failed to connect the account.", err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"account": account.Id,
+		"channel": channel.Id,
+	})
+}
+
+// sendBody is the body of POST /v1/messaging/channels/{id}/send.
+type sendBody struct {
+	To        []string `json:"to"`
+	Cc        []string `json:"cc"`
+	Bcc       []string `json:"bcc"`
+	Subject   string   `json:"subject"`
+	Text      string   `json:"text"`
+	HTML      string   `json:"html"`
+	InReplyTo string   `json:"inReplyTo"` // the headerMessageId replied to
+}
+
+// handleSend sends a message from a channel of the caller:
+//
+//	POST /v1/messaging/channels/{id}/send {to, cc, bcc, subject, text, html, inReplyTo}
+//
+// through the SMTP server of the channel's account, and records it as an
+// outgoing message, in the thread of the message it replies to if any.
+func (p *plugin) handleSend(e *core.RequestEvent) error {
+	channel, err := e.App.FindRecordById("messageChannel", e.Request.PathValue("id"))
+	if err != nil || channel.GetString("owner") != e.Auth.Id {
+		return e.NotFoundError("", nil)
+	}
+
+	account, err := e.App.FindRecordById("connectedAccount", channel.GetString("connectedAccount"))
+	if err != nil || account.GetString("owner") != e.Auth.Id || account.GetString("provider") != providerIMAP {
+		return e.NotFoundError("", nil)
+	}
+	if !account.GetDateTime("authFailedAt").IsZero() {
+		return e.BadRequestError("The account must be connected again.", nil)
+	}
+
+	body := sendBody{}
+	if err := e.BindBody(&body); err != nil {
+		return e.BadRequestError("Failed to read the request body.", err)
+	}
+
+	to, toErr := parseAddresses(body.To)
+	cc, ccErr := parseAddresses(body.Cc)
+	bcc, bccErr := parseAddresses(body.Bcc)
+	if err := errors.Join(toErr, ccErr, bccErr); err != nil || len(to)+len(cc)+len(bcc) == 0 {
+		return e.BadRequestError("At least one valid recipient is required.", nil)
+	}
+
+	if strings.ContainsAny(body.Subject, "\r\n") {
+		return e.BadRequestError("The subject must be a single line.", nil)
+	}
+
+	params, err := accountParameters(account)
+	if err != nil || params.SMTP.Host == "" {
+		return e.BadRequestError("The account has no SMTP server.", nil)
+	}
+
+	if p.config.NewMailer == nil {
+		err := p.hosts.check(params.SMTP.Host, smtpPort(params.SMTP), smtpPorts)
+		if err == nil {
+			err = p.hosts.resolve(e.Request.Context(), params.SMTP.Host)
+		}
+		if err != nil {
+			return e.BadRequestError("The account's SMTP server is not allowed.", nil)
+		}
+	}
+
+	params.SMTP.Password, err = p.tokens.Decrypt(account.GetString("owner"), account.GetString("accessTokenEnc"))
+	if err != nil {
+		return e.InternalServerError("Failed to decrypt the account password.", err)
+	}
+
+	handle := account.GetString("handle")
+	_, domain, _ := strings.Cut(handle, "@")
+
+	parsed := &parsedMessage{
+		MessageId: "<" + security.RandomString(24) + "@" + domain + ">",
+		Subject:   body.Subject,
+		Text:      body.Text,
+		Date:      time.Now().UTC(),
+	}
+	if parsed.Text == "" && body.HTML != "" {
+		parsed.Text, _ = mailer.HTMLToText(body.HTML)
+	}
+
+	headers := map[string]string{"Message-ID": parsed.MessageId}
+
+	if body.InReplyTo != "" {
+		replied, err := e.App.FindFirstRecordByFilter(
+			"message",
+			"owner = {:owner} && headerMessageId = {:id}",
+			dbx.Params{"owner": e.Auth.Id, "id": body.InReplyTo},
+		)
+		if err != nil {
+			return e.BadRequestError("The message replied to is missing.", nil)
+		}
+
+		parsed.InReplyTo = replied.GetString("headerMessageId")
+		if thread, err := e.App.FindRecordById("messageThread", replied.GetString("messageThread")); err == nil {
+			if root := thread.GetString("threadExternalId"); root != "" && root != parsed.InReplyTo {
+				parsed.References = append(parsed.References, root)
+			}
+		}
+		parsed.References = append(parsed.References, parsed.InReplyTo)
+
+		headers["In-Reply-To"] = parsed.InReplyTo
+		headers["References"] = strings.Join(parsed.References, " ")
+	}
+
+	parsed.Participants = append(parsed.Participants, participant{Handle: strings.ToLower(handle), Role: "from"})
+	for i, addresses := range [][]mail.Address{to, cc, bcc} {
+		for _, a := range addresses {
+			parsed.Participants = append(parsed.Participants, participant{
+				Handle:      strings.ToLower(a.Address),
+				DisplayName: a.Name,
+				Role:        []string{"to", "cc", "bcc"}[i],
+			})
+		}
+	}
+
+	err = p.mailer(account, params.SMTP).Send(&mailer.Message{
+		From:    mail.Address{Address: handle},
+		To:      to,
+		Cc:      cc,
+		Bcc:     bcc,
+		Subject: body.Subject,
+		Text:    body.Text,
+		HTML:    body.HTML,
+		Headers: headers,
+	})
+	if err != nil {
+		return e.BadRequestError("Failed to send the message.", err)
+	}
+
+	message, err := p.importMessage(channel, account, parsed, "", "")
+	if err != nil {
+		return e.InternalServerError("The message was sent but could not be recorded.", err)
+	}
+
+	return e.JSON(http.StatusOK, map[string]any{
+		"message":         message.Id,
+		"headerMessageId": parsed.MessageId,
+		"messageThread":   message.GetString("messageThread"),
+	})
+}
+
+// mailer returns the mailer the account sends with.
+func (p *plugin) mailer(account *core.Record, params SMTPParams) mailer.Mailer {
+	if p.config.NewMailer != nil {
+		return p.config.NewMailer(account, params)
+	}
+
+	return &mailer.SMTPClient{
+		Host:     params.Host,
+		Port:     smtpPort(params),
+		TLS:      params.TLS,
+		Username: params.Username,
+		Password: params.Password,
+	}
+}
+
+// smtpPort is the port of the account's SMTP server, by default the
+// submission port for its security.
+func smtpPort(params SMTPParams) int {
+	if params.Port != 0 {
+		return params.Port
+	}
+	if params.TLS {
+		return 465
+	}
+	return 587
+}
+
+func parseAddresses(values []string) ([]mail.Address, error) {
+	addresses := make([]mail.Address, 0, len(values))
+	for _, v := range values {
+		a, err := mail.ParseAddress(v)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+	return addresses, nil
+}
@@ -0,0 +1,186 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// The mail servers an account names are whatever its owner typed, and the
+// connect route dials them straight away. Left alone, that is a way for any
+// signed in user to make the server open connections into its own network —
+// the metadata endpoint, a database on loopback, a scan of the private range
+// told apart by which ports answer. So an account reaches public addresses on
+// the standard mail ports only, unless the deployment allow-lists a server.
+//
+// The address is checked when the connection is made, on the IP the dialer is
+// about to connect to, so a name that resolves to a public address when it is
+// checked and a private one when it is dialed gets nowhere. SMTP is sent by a
+// client that dials on its own; its server's addresses are resolved and
+// checked just before the send instead.
+
+var (
+	// imapPorts are the ports an IMAP server off the allow-list may listen on.
+	imapPorts = []int{143, 993}
+
+	// smtpPorts are the ports an SMTP server off the allow-list may listen on.
+	smtpPorts = []int{25, 465, 587}
+
+	// nonPublicPrefixes are the ranges beyond the private, loopback and
+	// link-local ones the netip predicates already name.
+	nonPublicPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+		netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+		netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+		netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+		netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which maps onto the above
+	}
+)
+
+// errMailHostNotAllowed is a mail server an account may not reach.
+var errMailHostNotAllowed = errors.New("the mail server is not allowed")
+
+// mailHosts is the allow-list of the mail servers an account may name beyond
+// the public ones on the standard ports.
+type mailHosts struct {
+	names    []string
+	prefixes []netip.Prefix
+}
+
+// newMailHosts parses an allow-list of host names, IPs and CIDR ranges.
+func newMailHosts(allowed []string) (*mailHosts, error) {
+	h := &mailHosts{}
+
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+		case strings.Contains(entry, "/"):
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed mail host %q: %w", entry, err)
+			}
+			h.prefixes = append(h.prefixes, prefix.Masked())
+		default:
+			if addr, err := netip.ParseAddr(entry); err == nil {
+				h.prefixes = append(h.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+				continue
+			}
+			h.names = append(h.names, entry)
+		}
+	}
+
+	return h, nil
+}
+
+// listed reports whether host is on the allow-list, by name or as an IP in an
+// allowed range.
+func (h *mailHosts) listed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if slices.Contains(h.names, host) {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(host)
+
+	return err == nil && h.allowsAddr(addr)
+}
+
+// allowsAddr reports whether an account may connect to addr.
+func (h *mailHosts) allowsAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range h.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return isPublicAddr(addr)
+}
+
+// check refuses a server before anything is dialed: one off the allow-list on
+// a port other than ports, or named by an IP an account may not reach.
+func (h *mailHosts) check(host string, port int, ports []int) error {
+	if h.listed(host) {
+		return nil
+	}
+
+	if !slices.Contains(ports, port) {
+		return fmt.Errorf("%w: port %d", errMailHostNotAllowed, port)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil && !h.allowsAddr(addr) {
+		return fmt.Errorf("%w: %s", errMailHostNotAllowed, host)
+	}
+
+	return nil
+}
+
+// dialer returns a dialer to host that refuses, at connect time, any address
+// an account may not reach. A host on the allow-list by name may resolve to
+// any address.
+func (h *mailHosts) dialer(host string, timeout time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if h.listed(host) {
+		return dialer
+	}
+
+	dialer.Control = func(network, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return err
+		}
+		if !h.allowsAddr(addrPort.Addr()) {
+			return fmt.Errorf("%w: %s resolves to %s", errMailHostNotAllowed, host, addrPort.Addr())
+		}
+		return nil
+	}
+
+	return dialer
+}
+
+// resolve checks every address host resolves to, for a client that dials on
+// its own.
+func (h *mailHosts) resolve(ctx context.Context, host string) error {
+	if h.listed(host) {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if !h.allowsAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", errMailHostNotAllowed, host, addr)
+		}
+	}
+
+	return nil
+}
+
+// isPublicAddr reports whether addr is a unicast address on the internet
+// rather than in a private, loopback, link-local or otherwise reserved range.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,226 @@
+// Package messaging is the mailbox sync engine behind the messaging collections
+// of migration 1780500000_connect_messaging_calendar.go. Those collections are
+// written by the sync plugins only; this is the one for an imap_smtp_caldav
+// account, which has no provider API and is reached over plain IMAP and SMTP.
+//
+// A scheduled job walks the enabled message channels and, for each, logs in to
+// the account's IMAP server with the password decrypted from accessTokenEnc and
+// imports what arrived since its cursor. The cursor is per folder, the folder's
+// UIDVALIDITY and UIDNEXT: while UIDVALIDITY holds, the messages from UIDNEXT
+// on are the new ones, and when it changes the server has renumbered the folder,
+// so it is walked again from its start and the messages already imported are
+// recognised by their Message-Id. The cursor is saved after every batch, so a
+// sync that stops part way resumes where it stopped rather than from the start.
+//
+// A message is imported once per owner, keyed on its Message-Id, and linked to
+// each channel and folder it was seen in by a messageAssociation. It joins the
+// thread of any message it replies to, or else the thread named by the root of
+// its References, which a reply that arrives before its parent shares with it.
+// Its participants are matched to the owner's people by address and, as the
+// channel's contactAutoCreationPolicy allows, the missing ones are created and
+// linked to the company whose domain they write from.
+//
+// Mail is sent through the account's SMTP server with the same password, and
+// the sent message is recorded as an outgoing one in its thread straight away,
+// rather than when the Sent folder next syncs.
+//
+// The password only travels encrypted: IMAP over TLS, or upgraded with
+// STARTTLS before LOGIN, and a server that offers neither is refused. The
+// servers an account may name are limited as well (see hosts.go).
+//
+// The routes mount under /v1/messaging:
+//
+//	POST /v1/messaging/accounts             connect an IMAP/SMTP account (auth)
+//	POST /v1/messaging/channels/{id}/send   send from a channel (its owner)
+package messaging
+
+import (
+	"crypto/tls"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hanzoai/base/apis"
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/hook"
+	"github.com/hanzoai/base/tools/mailer"
+	"github.com/hanzoai/base/tools/router"
+)
+
+const (
+	// syncJob is the id of the scheduled job that syncs the channels.
+	syncJob = "__hzMessagingSync__"
+
+	// providerIMAP is the provider of the accounts this plugin syncs.
+	providerIMAP = "imap_smtp_caldav"
+)
+
+// Config controls the plugin. The sync is opt-in.
+type Config struct {
+	Enabled bool
+
+	// TokenKey is the 32 byte master key the per-owner token keys are derived
+	// from. It is ignored when Tokens is set.
+	TokenKey string
+
+	// Tokens, when set, encrypts and decrypts the account passwords instead of
+	// the keys derived from TokenKey, for a deployment that keeps them in KMS.
+	Tokens TokenCipher
+
+	// SyncInterval is how often the channels are synced, as a cron expression
+	// or a duration (default "5m").
+	SyncInterval string
+
+	// BatchSize is how many messages are fetched per round trip, and so how
+	// many are imported between two saves of the cursor (default 50).
+	BatchSize int
+
+	// Matching names the people and companies participants are matched to.
+	Matching Matching
+
+	// NewMailer, when set, returns the mailer a channel sends with instead of
+	// an SMTP client for its account.
+	NewMailer func(account *core.Record, smtp SMTPParams) mailer.Mailer
+
+	// AllowedHosts are the mail servers an account may name beyond public
+	// ones on the standard ports: host names, IPs or CIDR ranges. A server on
+	// it may listen on any port and resolve to any address, including the
+	// private, loopback and link-local ones otherwise refused (see hosts.go).
+	AllowedHosts []string
+
+	// TLSConfig, when set, is the config mail servers are verified with, for
+	// a deployment with a private CA. Its ServerName is set per server.
+	TLSConfig *tls.Config
+}
+
+// Matching names the collections and fields participants are matched to. A
+// Base without the collections matches nobody.
+type Matching struct {
+	People        string // default "person"
+	PeopleEmail   string // default "email"
+	PeopleName    string // default "name"
+	PeopleCompany string // default "company"
+	Companies     string // default "company"
+	CompanyDomain string // default "domainName"
+}
+
+// ConfigFromEnv reads MESSAGING_ENABLED, MESSAGING_TOKEN_KEY,
+// MESSAGING_SYNC_INTERVAL, MESSAGING_BATCH_SIZE and MESSAGING_ALLOWED_HOSTS
+// (comma separated).
+func ConfigFromEnv() Config {
+	batch, _ := strconv.Atoi(os.Getenv("MESSAGING_BATCH_SIZE"))
+
+	var allowed []string
+	if raw := os.Getenv("MESSAGING_ALLOWED_HOSTS"); raw != "" {
+		allowed = strings.Split(raw, ",")
+	}
+
+	return Config{
+		Enabled:      os.Getenv("MESSAGING_ENABLED") == "true",
+		TokenKey:     os.Getenv("MESSAGING_TOKEN_KEY"),
+		SyncInterval: os.Getenv("MESSAGING_SYNC_INTERVAL"),
+		BatchSize:    batch,
+		AllowedHosts: allowed,
+	}
+}
+
+type plugin struct {
+	app     core.App
+	config  Config
+	tokens  TokenCipher
+	hosts   *mailHosts
+	syncing atomic.Bool // a sync run is going
+}
+
+// MustRegister registers the messaging plugin and panics on error.
+func MustRegister(app core.App, config Config) {
+	if err := Register(app, config); err != nil {
+		panic(err)
+	}
+}
+
+// Register schedules the mailbox sync and mounts the messaging API on the app
+// when enabled.
+func Register(app core.App, config Config) error {
+	if !config.Enabled {
+		return nil
+	}
+
+	p, err := newPlugin(app, config)
+	if err != nil {
+		return err
+	}
+
+	if err := app.Cron().Add(syncJob, p.config.SyncInterval, func() {
+		p.syncChannels()
+	}); err != nil {
+		return err
+	}
+
+	app.OnServe().Bind(&hook.Handler[*core.ServeEvent]{
+		Id: "messaging",
+		Func: func(e *core.ServeEvent) error {
+			p.registerRoutes(e.Router)
+			return e.Next()
+		},
+	})
+
+	return nil
+}
+
+func newPlugin(app core.App, config Config) (*plugin, error) {
+	if config.SyncInterval == "" {
+		config.SyncInterval = "5m"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 50
+	}
+	config.Matching = config.Matching.withDefaults()
+
+	tokens := config.Tokens
+	if tokens == nil {
+		derived, err := NewDerivedTokenCipher(config.TokenKey)
+		if err != nil {
+			return nil, err
+		}
+		tokens = derived
+	}
+
+	hosts, err := newMailHosts(config.AllowedHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plugin{app: app, config: config, tokens: tokens, hosts: hosts}, nil
+}
+
+func (m Matching) withDefaults() Matching {
+	if m.People == "" {
+		m.People = "person"
+	}
+	if m.PeopleEmail == "" {
+		m.PeopleEmail = "email"
+	}
+	if m.PeopleName == "" {
+		m.PeopleName = "name"
+	}
+	if m.PeopleCompany == "" {
+		m.PeopleCompany = "company"
+	}
+	if m.Companies == "" {
+		m.Companies = "company"
+	}
+	if m.CompanyDomain == "" {
+		m.CompanyDomain = "domainName"
+	}
+	return m
+}
+
+// registerRoutes mounts the messaging API under /v1/messaging.
+func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
+	g := r.Group("/v1/messaging")
+	g.Bind(apis.RequireAuth())
+	g.POST("/accounts", p.handleConnectAccount)
+	g.POST("/channels/{id}/send", p.handleSend)
+}
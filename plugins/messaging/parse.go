@@ -0,0 +1,262 @@
+package messaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/base/tools/mailer"
+)
+
+// maxTextSize bounds the text kept of a message; the rest of a long message is
+// on the server.
+const maxTextSize = 256 << 10
+
+// maxPartDepth bounds how deep multipart bodies are walked.
+const maxPartDepth = 8
+
+// participant is one address of a message in one role.
+type participant struct {
+	Handle      string // lowercased
+	DisplayName string
+	Role        string // from, to, cc or bcc
+}
+
+// parsedMessage is what the sync keeps of a message.
+type parsedMessage struct {
+	MessageId    string
+	InReplyTo    string
+	References   []string
+	Subject      string
+	Text         string
+	Date         time.Time
+	Participants []participant
+}
+
+// from returns the sender's address, if any.
+func (m *parsedMessage) from() string {
+	for _, p := range m.Participants {
+		if p.Role == "from" {
+			return p.Handle
+		}
+	}
+	return ""
+}
+
+// threadRoot is the Message-Id a thread is named by: the first of the
+// References, which every reply in the thread carries, else the message it
+// replies to, else its own.
+func (m *parsedMessage) threadRoot() string {
+	if len(m.References) > 0 {
+		return m.References[0]
+	}
+	if m.InReplyTo != "" {
+		return m.InReplyTo
+	}
+	return m.MessageId
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// parseMessage parses a raw RFC 5322 message.
+func parseMessage(raw []byte) (*parsedMessage, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := &parsedMessage{
+		MessageId:  firstMessageId(msg.Header.Get("Message-Id")),
+		InReplyTo:  firstMessageId(msg.Header.Get("In-Reply-To")),
+		References: messageIds(msg.Header.Get("References")),
+		Subject:    decodeHeader(msg.Header.Get("Subject")),
+	}
+
+	// a message without a Message-Id is keyed on its content, so that it is
+	// still imported once however many times it is seen
+	if parsed.MessageId == "" {
+		sum := sha256.Sum256(raw)
+		parsed.MessageId = "<" + hex.EncodeToString(sum[:16]) + "@message-id.invalid>"
+	}
+
+	if date, err := msg.Header.Date(); err == nil {
+		parsed.Date = date.UTC()
+	}
+
+	for _, role := range []string{"from", "to", "cc", "bcc"} {
+		addresses, err := (&mail.AddressParser{WordDecoder: wordDecoder}).ParseList(msg.Header.Get(role))
+		if err != nil {
+			continue
+		}
+		for _, a := range addresses {
+			parsed.Participants = append(parsed.Participants, participant{
+				Handle:      strings.ToLower(a.Address),
+				DisplayName: a.Name,
+				Role:        role,
+			})
+		}
+	}
+
+	plain, html := bodyText(msg.Header, msg.Body, 0)
+	switch {
+	case plain != "":
+		parsed.Text = plain
+	case html != "":
+		parsed.Text, _ = mailer.HTMLToText(html)
+	}
+	if len(parsed.Text) > maxTextSize {
+		parsed.Text = strings.ToValidUTF8(parsed.Text[:maxTextSize], "")
+	}
+
+	return parsed, nil
+}
+
+// header is the part of a message or part header bodyText reads.
+type header interface {
+	Get(key string) string
+}
+
+// bodyText returns the first text/plain and the first text/html part of a
+// body, decoded.
+func bodyText(h header, body io.Reader, depth int) (plain, html string) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxPartDepth || params["boundary"] == "" {
+			return "", ""
+		}
+
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err != nil {
+				break
+			}
+			if strings.HasPrefix(part.Header.Get("Content-Disposition"), "attachment") {
+				continue
+			}
+
+			partPlain, partHTML := bodyText(part.Header, part, depth+1)
+			if plain == "" {
+				plain = partPlain
+			}
+			if html == "" {
+				html = partHTML
+			}
+		}
+
+		return plain, html
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", ""
+	}
+
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &lineSkipper{r: body})
+	}
+
+	content, err := io.ReadAll(io.LimitReader(body, 4*maxTextSize))
+	if err != nil && len(content) == 0 {
+		return "", ""
+	}
+
+	text := decodeCharset(params["charset"], content)
+	if mediaType == "text/html" {
+		return "", text
+	}
+
+	return strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n")), ""
+}
+
+// lineSkipper drops the line breaks of a base64 body, which the standard
+// decoder does not expect.
+type lineSkipper struct {
+	r io.Reader
+}
+
+func (l *lineSkipper) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+
+	kept := 0
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+
+	return kept, err
+}
+
+// decodeCharset converts Latin-1, the one charset other than UTF-8 that needs
+// no table; anything else is read as UTF-8.
+func decodeCharset(charset string, content []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	default:
+		return strings.ToValidUTF8(string(content), "�")
+	}
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		content, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(decodeCharset(charset, content)), nil
+	}
+	return nil, fmt.Errorf("unsupported charset %q", charset)
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+var messageIdRegex = regexp.MustCompile(`<[^<>\s]+>`)
+
+// messageIds returns the Message-Ids of a References header, in order.
+func messageIds(value string) []string {
+	return messageIdRegex.FindAllString(value, -1)
+}
+
+func firstMessageId(value string) string {
+	if id := messageIdRegex.FindString(value); id != "" {
+		return id
+	}
+	return strings.TrimSpace(value)
+}
+
+var subjectPrefixRegex = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|sv)\s*(\[\d+\])?\s*:\s*)+`)
+
+// threadSubject is a subject without its reply and forward prefixes.
+func threadSubject(subject string) string {
+	return strings.TrimSpace(subjectPrefixRegex.ReplaceAllString(subject, ""))
+}
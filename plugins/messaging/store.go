@@ -0,0 +1,354 @@
+package messaging
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/dbx"
+)
+
+// maxThreadReferences bounds how many of a message's References are looked up
+// to find its thread; the nearest ones are at the end.
+const maxThreadReferences = 20
+
+const (
+	directionIncoming = "incoming"
+	directionOutgoing = "outgoing"
+)
+
+// importMessage stores a message of a channel, once per owner, and links it to
+// the channel and folder it was seen in. folder is empty for a message the
+// channel sent. It returns the message record.
+func (p *plugin) importMessage(channel, account *core.Record, parsed *parsedMessage, externalId string, folder string) (*core.Record, error) {
+	owner := channel.GetString("owner")
+	handles := ownHandles(account)
+
+	direction := directionIncoming
+	if slices.Contains(handles, parsed.from()) {
+		direction = directionOutgoing
+	}
+
+	var message *core.Record
+
+	err := p.app.RunInTransaction(func(txApp core.App) error {
+		var thread *core.Record
+		var err error
+
+		message, err = txApp.FindFirstRecordByFilter(
+			"message",
+			"owner = {:owner} && headerMessageId = {:id}",
+			dbx.Params{"owner": owner, "id": parsed.MessageId},
+		)
+		switch {
+		case err == nil:
+			thread, _ = txApp.FindRecordById("messageThread", message.GetString("messageThread"))
+		case errors.Is(err, sql.ErrNoRows):
+			thread, err = p.findOrCreateThread(txApp, owner, parsed)
+			if err != nil {
+				return err
+			}
+
+			message, err = p.createMessage(txApp, channel, owner, thread, parsed, direction, handles)
+			if err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return p.associate(txApp, channel, message, thread, externalId, folder, direction)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+func (p *plugin) createMessage(
+	txApp core.App,
+	channel *core.Record,
+	owner string,
+	thread *core.Record,
+	parsed *parsedMessage,
+	direction string,
+	handles []string,
+) (*core.Record, error) {
+	messages, err := txApp.FindCachedCollectionByNameOrId("message")
+	if err != nil {
+		return nil, err
+	}
+
+	message := core.NewRecord(messages)
+	message.Set("owner", owner)
+	message.Set("headerMessageId", parsed.MessageId)
+	message.Set("subject", parsed.Subject)
+	message.Set("text", parsed.Text)
+	message.Set("receivedAt", parsed.Date)
+	message.Set("messageThread", thread.Id)
+	if err := txApp.Save(message); err != nil {
+		return nil, err
+	}
+
+	participants, err := txApp.FindCachedCollectionByNameOrId("messageParticipant")
+	if err != nil {
+		return nil, err
+	}
+
+	policy := channel.GetString("contactAutoCreationPolicy")
+	autoCreate := policy == "sent_and_received" || (policy == "sent" && direction == directionOutgoing)
+
+	for _, part := range parsed.Participants {
+		if part.Handle == "" {
+			continue
+		}
+
+		record := core.NewRecord(participants)
+		record.Set("owner", owner)
+		record.Set("handle", part.Handle)
+		record.Set("role", part.Role)
+		record.Set("displayName", part.DisplayName)
+		record.Set("message", message.Id)
+
+		if slices.Contains(handles, part.Handle) {
+			record.Set("userId", owner)
+		} else {
+			personId, err := p.matchPerson(txApp, owner, part, autoCreate)
+			if err != nil {
+				return nil, err
+			}
+			record.Set("personId", personId)
+		}
+
+		if err := txApp.Save(record); err != nil {
+			return nil, err
+		}
+	}
+
+	return message, nil
+}
+
+// findOrCreateThread returns the thread of the nearest message parsed replies
+// to that is already stored, else the thread named by its root, created if
+// need be.
+func (p *plugin) findOrCreateThread(txApp core.App, owner string, parsed *parsedMessage) (*core.Record, error) {
+	references := parsed.References
+	if parsed.InReplyTo != "" {
+		references = append(slices.Clone(references), parsed.InReplyTo)
+	}
+	if len(references) > maxThreadReferences {
+		references = references[len(references)-maxThreadReferences:]
+	}
+
+	if len(references) > 0 {
+		ids := make([]any, len(references))
+		for i, id := range references {
+			ids[i] = id
+		}
+
+		replied, err := txApp.FindAllRecords(
+			"message",
+			dbx.HashExp{"owner": owner},
+			dbx.In("headerMessageId", ids...),
+			dbx.NewExp("[[messageThread]] != ''"),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		// the nearest, which is the last referenced
+		slices.SortFunc(replied, func(a, b *core.Record) int {
+			return slices.Index(references, b.GetString("headerMessageId")) - slices.Index(references, a.GetString("headerMessageId"))
+		})
+		for _, m := range replied {
+			thread, err := txApp.FindRecordById("messageThread", m.GetString("messageThread"))
+			if err == nil && thread.GetString("owner") == owner {
+				return thread, nil
+			}
+		}
+	}
+
+	root := parsed.threadRoot()
+
+	thread, err := txApp.FindFirstRecordByFilter(
+		"messageThread",
+		"owner = {:owner} && threadExternalId = {:root}",
+		dbx.Params{"owner": owner, "root": root},
+	)
+	if err == nil {
+		return thread, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	threads, err := txApp.FindCachedCollectionByNameOrId("messageThread")
+	if err != nil {
+		return nil, err
+	}
+
+	thread = core.NewRecord(threads)
+	thread.Set("owner", owner)
+	thread.Set("subject", threadSubject(parsed.Subject))
+	thread.Set("threadExternalId", root)
+
+	return thread, txApp.Save(thread)
+}
+
+// associate links a message to a channel, or, when the link exists, adds
+// folder to the folders the message was seen in and updates its provider id.
+func (p *plugin) associate(
+	txApp core.App,
+	channel *core.Record,
+	message *core.Record,
+	thread *core.Record,
+	externalId string,
+	folder string,
+	direction string,
+) error {
+	association, err := txApp.FindFirstRecordByFilter(
+		"messageAssociation",
+		"message = {:message} && messageChannel = {:channel}",
+		dbx.Params{"message": message.Id, "channel": channel.Id},
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if association == nil {
+		associations, err := txApp.FindCachedCollectionByNameOrId("messageAssociation")
+		if err != nil {
+			return err
+		}
+
+		association = core.NewRecord(associations)
+		association.Set("owner", channel.GetString("owner"))
+		association.Set("messageChannel", channel.Id)
+		association.Set("message", message.Id)
+		association.Set("direction", direction)
+		if thread != nil {
+			association.Set("messageThreadExternalId", thread.GetString("threadExternalId"))
+		}
+	}
+
+	var folders []string
+	_ = json.Unmarshal([]byte(association.GetString("folderIds")), &folders)
+
+	changed := association.IsNew()
+	if folder != "" && !slices.Contains(folders, folder) {
+		folders = append(folders, folder)
+		changed = true
+	}
+
+	// a message the channel sent has no provider id until it is synced, and a
+	// renumbered folder gives the message a new one
+	if externalId != "" && association.GetString("messageExternalId") != externalId {
+		association.Set("messageExternalId", externalId)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if folders == nil {
+		folders = []string{}
+	}
+	association.Set("folderIds", folders)
+
+	return txApp.Save(association)
+}
+
+// matchPerson returns the id of the owner's person with a participant's
+// address, creating one when create is set and there is none. A Base without
+// the people collection matches nobody.
+func (p *plugin) matchPerson(txApp core.App, owner string, part participant, create bool) (string, error) {
+	m := p.config.Matching
+
+	people, err := txApp.FindCachedCollectionByNameOrId(m.People)
+	if err != nil || people.Fields.GetByName(m.PeopleEmail) == nil {
+		return "", nil
+	}
+	scoped := people.Fields.GetByName("owner") != nil
+
+	query := txApp.RecordQuery(people).
+		AndWhere(dbx.NewExp("LOWER([["+m.PeopleEmail+"]]) = {:email}", dbx.Params{"email": part.Handle}))
+	if scoped {
+		query.AndWhere(dbx.HashExp{"owner": owner})
+	}
+
+	person := &core.Record{}
+	err = query.Limit(1).One(person)
+	if err == nil {
+		return person.Id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	if !create {
+		return "", nil
+	}
+
+	person = core.NewRecord(people)
+	person.Set(m.PeopleEmail, part.Handle)
+	if scoped {
+		person.Set("owner", owner)
+	}
+	if people.Fields.GetByName(m.PeopleName) != nil {
+		name := part.DisplayName
+		if name == "" {
+			name, _, _ = strings.Cut(part.Handle, "@")
+		}
+		person.Set(m.PeopleName, name)
+	}
+	if people.Fields.GetByName(m.PeopleCompany) != nil {
+		companyId, err := p.matchCompany(txApp, owner, part.Handle)
+		if err != nil {
+			return "", err
+		}
+		person.Set(m.PeopleCompany, companyId)
+	}
+
+	if err := txApp.Save(person); err != nil {
+		return "", err
+	}
+
+	return person.Id, nil
+}
+
+// matchCompany returns the id of the owner's company whose domain an address
+// is at, if any.
+func (p *plugin) matchCompany(txApp core.App, owner string, handle string) (string, error) {
+	m := p.config.Matching
+
+	_, domain, ok := strings.Cut(handle, "@")
+	if !ok || domain == "" {
+		return "", nil
+	}
+
+	companies, err := txApp.FindCachedCollectionByNameOrId(m.Companies)
+	if err != nil || companies.Fields.GetByName(m.CompanyDomain) == nil {
+		return "", nil
+	}
+
+	query := txApp.RecordQuery(companies).
+		AndWhere(dbx.NewExp("LOWER([["+m.CompanyDomain+"]]) = {:domain}", dbx.Params{"domain": domain}))
+	if companies.Fields.GetByName("owner") != nil {
+		query.AndWhere(dbx.HashExp{"owner": owner})
+	}
+
+	company := &core.Record{}
+	err = query.Limit(1).One(company)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return company.Id, nil
+}
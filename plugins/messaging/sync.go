@@ -0,0 +1,409 @@
+package messaging
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/imap"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+const (
+	// syncTimeout bounds every IMAP round trip of a sync.
+	syncTimeout = 2 * time.Minute
+
+	// syncRetryBase is the delay after the first failed sync of a channel; it
+	// doubles with every failure after that, up to syncRetryMax.
+	syncRetryBase = time.Minute
+	syncRetryMax  = 6 * time.Hour
+)
+
+// The channel states the sync moves through, of the syncStatus and syncStage
+// fields of the messageChannel collection.
+const (
+	statusImporting         = "importing"
+	statusSynced            = "synced"
+	statusFailedUnknown     = "failed_unknown"
+	statusFailedPermissions = "failed_insufficient_permissions"
+
+	stagePending   = "pending"
+	stageScheduled = "scheduled"
+	stageListFetch = "list_fetch"
+	stageImport    = "import"
+	stageDone      = "done"
+)
+
+// connectionParameters is the connectionParameters field of an
+// imap_smtp_caldav account.
+type connectionParameters struct {
+	IMAP IMAPParams `json:"imap"`
+	SMTP SMTPParams `json:"smtp"`
+}
+
+// IMAPParams is where an account's mail is read from.
+type IMAPParams struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	TLS      bool     `json:"tls"`
+	Username string   `json:"username,omitempty"` // default the account handle
+	Folders  []string `json:"folders,omitempty"`  // default ["INBOX"]
+}
+
+// SMTPParams is where an account's mail is sent through.
+type SMTPParams struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	TLS      bool   `json:"tls"`
+	Username string `json:"username,omitempty"` // default the account handle
+
+	// Password is the decrypted account token; it is never stored.
+	Password string `json:"-"`
+}
+
+func accountParameters(account *core.Record) (*connectionParameters, error) {
+	params := &connectionParameters{}
+	if raw := account.GetString("connectionParameters"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), params); err != nil {
+			return nil, fmt.Errorf("invalid connectionParameters: %w", err)
+		}
+	}
+
+	handle := account.GetString("handle")
+	if params.IMAP.Username == "" {
+		params.IMAP.Username = handle
+	}
+	if params.SMTP.Username == "" {
+		params.SMTP.Username = handle
+	}
+	if len(params.IMAP.Folders) == 0 {
+		params.IMAP.Folders = []string{"INBOX"}
+	}
+
+	return params, nil
+}
+
+// folderCursor is where the sync of one folder stopped.
+type folderCursor struct {
+	UIDValidity uint32 `json:"uidValidity"`
+	UIDNext     uint32 `json:"uidNext"`
+}
+
+// syncCursor is the syncCursor field of a channel, by folder name.
+type syncCursor map[string]folderCursor
+
+func parseSyncCursor(raw string) syncCursor {
+	cursor := syncCursor{}
+	if raw != "" {
+		// an unreadable cursor is a full sync, which the dedup makes safe
+		_ = json.Unmarshal([]byte(raw), &cursor)
+	}
+	return cursor
+}
+
+// authError is a login the server refused, which no retry will fix.
+type authError struct {
+	err error
+}
+
+func (e *authError) Error() string {
+	return e.err.Error()
+}
+
+func (e *authError) Unwrap() error {
+	return e.err
+}
+
+// syncChannels syncs every enabled channel that is not waiting out a failure.
+// A run that finds the last one still going does nothing.
+func (p *plugin) syncChannels() {
+	if !p.syncing.CompareAndSwap(false, true) {
+		return
+	}
+	defer p.syncing.Store(false)
+
+	if _, err := p.app.FindCachedCollectionByNameOrId("messageChannel"); err != nil {
+		return // not migrated
+	}
+
+	channels, err := p.app.FindRecordsByFilter(
+		"messageChannel",
+		"isSyncEnabled = true && (throttleRetryAfter = '' || throttleRetryAfter <= {:now})",
+		"syncedAt",
+		0,
+		0,
+		dbx.Params{"now": types.NowDateTime()},
+	)
+	if err != nil {
+		p.app.Logger().Warn("Failed to load the message channels to sync", "error", err.Error())
+		return
+	}
+
+	for _, channel := range channels {
+		if err := p.syncChannel(channel); err != nil {
+			p.app.Logger().Warn("Failed to sync a message channel", "channel", channel.Id, "error", err.Error())
+		}
+	}
+}
+
+// syncChannel imports what arrived in a channel's folders since its cursor and
+// records how it went on the channel.
+func (p *plugin) syncChannel(channel *core.Record) error {
+	account, err := p.app.FindRecordById("connectedAccount", channel.GetString("connectedAccount"))
+	if err != nil || account.GetString("owner") != channel.GetString("owner") {
+		return nil // not an account of the channel's owner
+	}
+
+	// the other providers have their own sync, and an account whose login was
+	// refused waits for its owner to connect it again
+	if account.GetString("provider") != providerIMAP || !account.GetDateTime("authFailedAt").IsZero() {
+		return nil
+	}
+
+	channel.Set("syncStatus", statusImporting)
+	p.setStage(channel, stageListFetch)
+	if err := p.app.Save(channel); err != nil {
+		return err
+	}
+
+	err = p.importChannel(channel, account)
+	if err != nil {
+		return errors.Join(err, p.syncFailed(channel, account, err))
+	}
+
+	channel.Set("syncStatus", statusSynced)
+	p.setStage(channel, stageDone)
+	channel.Set("syncedAt", types.NowDateTime())
+	channel.Set("throttleFailureCount", 0)
+	channel.Set("throttleRetryAfter", "")
+
+	return p.app.Save(channel)
+}
+
+func (p *plugin) setStage(channel *core.Record, stage string) {
+	channel.Set("syncStage", stage)
+	channel.Set("syncStageStartedAt", types.NowDateTime())
+}
+
+// syncFailed records a failed sync: a refused login on the account, for its
+// owner to reconnect, and anything else as a retry after a backoff.
+func (p *plugin) syncFailed(channel, account *core.Record, syncErr error) error {
+	var authErr *authError
+	if errors.As(syncErr, &authErr) {
+		account.Set("authFailedAt", types.NowDateTime())
+		if err := p.app.Save(account); err != nil {
+			return err
+		}
+
+		channel.Set("syncStatus", statusFailedPermissions)
+		p.setStage(channel, stagePending)
+
+		return p.app.Save(channel)
+	}
+
+	failures := channel.GetInt("throttleFailureCount") + 1
+	delay := syncRetryMax
+	if failures < 16 {
+		delay = min(syncRetryBase<<(failures-1), syncRetryMax)
+	}
+
+	channel.Set("syncStatus", statusFailedUnknown)
+	p.setStage(channel, stageScheduled)
+	channel.Set("throttleFailureCount", failures)
+	channel.Set("throttleRetryAfter", types.NowDateTime().Add(delay))
+
+	return p.app.Save(channel)
+}
+
+// importChannel logs in to the channel's account and imports its folders,
+// saving the cursor after every batch.
+func (p *plugin) importChannel(channel, account *core.Record) error {
+	params, err := accountParameters(account)
+	if err != nil {
+		return err
+	}
+
+	password, err := p.tokens.Decrypt(account.GetString("owner"), account.GetString("accessTokenEnc"))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the account token: %w", err)
+	}
+
+	client, err := p.dialIMAP(params.IMAP)
+	if err != nil {
+		return err
+	}
+	defer client.Logout()
+
+	if err := client.Login(params.IMAP.Username, password); err != nil {
+		var statusErr *imap.StatusError
+		if errors.As(err, &statusErr) && statusErr.Status == "NO" {
+			return &authError{err}
+		}
+		return err
+	}
+
+	cursor := parseSyncCursor(channel.GetString("syncCursor"))
+	for _, folder := range params.IMAP.Folders {
+		if err := p.importFolder(client, channel, account, folder, cursor); err != nil {
+			return fmt.Errorf("folder %q: %w", folder, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *plugin) importFolder(client *imap.Client, channel, account *core.Record, folder string, cursor syncCursor) error {
+	mailbox, err := client.Select(folder, true)
+	if err != nil {
+		return err
+	}
+
+	folderCursor := cursor[folder]
+	if folderCursor.UIDValidity != mailbox.UIDValidity {
+		// a new folder, or one the server renumbered
+		folderCursor.UIDValidity = mailbox.UIDValidity
+		folderCursor.UIDNext = 1
+	}
+	if mailbox.UIDNext > 0 && folderCursor.UIDNext >= mailbox.UIDNext {
+		return p.saveCursor(channel, cursor, folder, folderCursor)
+	}
+
+	found, err := client.UIDSearch("UID " + strconv.FormatUint(uint64(folderCursor.UIDNext), 10) + ":*")
+	if err != nil {
+		return err
+	}
+
+	// "n:*" names the last message even when its UID is below n
+	uids := make([]uint32, 0, len(found))
+	for _, uid := range found {
+		if uid >= folderCursor.UIDNext {
+			uids = append(uids, uid)
+		}
+	}
+	slices.Sort(uids)
+
+	if len(uids) > 0 {
+		p.setStage(channel, stageImport)
+	}
+
+	for batch := range slices.Chunk(uids, p.config.BatchSize) {
+		messages, err := client.UIDFetch(batch)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			parsed, err := parseMessage(m.Body)
+			if err != nil {
+				// a message that cannot be read is skipped rather than
+				// holding up every message after it
+				p.app.Logger().Warn("Skipped an unreadable message", "channel", channel.Id, "folder", folder, "uid", m.UID, "error", err.Error())
+				continue
+			}
+			if parsed.Date.IsZero() {
+				parsed.Date = m.InternalDate.UTC()
+			}
+
+			externalId := folder + ":" + strconv.FormatUint(uint64(mailbox.UIDValidity), 10) + ":" + strconv.FormatUint(uint64(m.UID), 10)
+			if _, err := p.importMessage(channel, account, parsed, externalId, folder); err != nil {
+				return err
+			}
+		}
+
+		folderCursor.UIDNext = batch[len(batch)-1] + 1
+		if err := p.saveCursor(channel, cursor, folder, folderCursor); err != nil {
+			return err
+		}
+	}
+
+	folderCursor.UIDNext = max(folderCursor.UIDNext, mailbox.UIDNext)
+
+	return p.saveCursor(channel, cursor, folder, folderCursor)
+}
+
+func (p *plugin) saveCursor(channel *core.Record, cursor syncCursor, folder string, folderCursor folderCursor) error {
+	cursor[folder] = folderCursor
+
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+
+	channel.Set("syncCursor", string(raw))
+
+	return p.app.Save(channel)
+}
+
+// dialIMAP connects to the account's IMAP server, over TLS from the start or
+// upgraded with STARTTLS, so that the login that follows is never sent in the
+// clear.
+func (p *plugin) dialIMAP(params IMAPParams) (*imap.Client, error) {
+	if params.Host == "" {
+		return nil, errors.New("no IMAP host")
+	}
+
+	port := params.Port
+	if port == 0 {
+		port = 143
+		if params.TLS {
+			port = 993
+		}
+	}
+
+	if err := p.hosts.check(params.Host, port, imapPorts); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{ServerName: params.Host, MinVersion: tls.VersionTLS12}
+	if p.config.TLSConfig != nil {
+		tlsConfig = p.config.TLSConfig.Clone()
+		tlsConfig.ServerName = params.Host
+	}
+
+	dialer := p.hosts.dialer(params.Host, 30*time.Second)
+	addr := net.JoinHostPort(params.Host, strconv.Itoa(port))
+
+	if params.TLS {
+		client, err := imap.DialWithDialer(dialer, addr, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		client.Timeout = syncTimeout
+		return client, nil
+	}
+
+	client, err := imap.DialWithDialer(dialer, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = syncTimeout
+
+	if err := client.StartTLS(tlsConfig); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// ownHandles returns the lowercased addresses of an account: its handle and
+// its aliases.
+func ownHandles(account *core.Record) []string {
+	handles := []string{strings.ToLower(account.GetString("handle"))}
+
+	var aliases []string
+	_ = json.Unmarshal([]byte(account.GetString("handleAliases")), &aliases)
+	for _, alias := range aliases {
+		handles = append(handles, strings.ToLower(alias))
+	}
+
+	return handles
+}
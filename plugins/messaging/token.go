@@ -0,0 +1,75 @@
+package messaging
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/hanzoai/base/tools/security"
+)
+
+// tokenHKDFSalt domain-separates the token key derivation from every other
+// HKDF use in the platform. Never reuse across domains.
+const tokenHKDFSalt = "hanzo-base.messaging.token.v1"
+
+// TokenCipher encrypts the secrets of a connected account for its owner. The
+// token fields hold its ciphertext only.
+type TokenCipher interface {
+	Encrypt(owner string, token string) (string, error)
+	Decrypt(owner string, cipherText string) (string, error)
+}
+
+// DerivedTokenCipher encrypts with AES-256-GCM under a key derived per owner
+// from a master key, so that the tokens of one owner do not decrypt under the
+// key of another.
+type DerivedTokenCipher struct {
+	masterKey []byte
+}
+
+// NewDerivedTokenCipher returns a cipher over masterKey, which must be 32
+// bytes.
+func NewDerivedTokenCipher(masterKey string) (*DerivedTokenCipher, error) {
+	if len(masterKey) != 32 {
+		return nil, errors.New("messaging: the token key must be 32 bytes")
+	}
+
+	return &DerivedTokenCipher{masterKey: []byte(masterKey)}, nil
+}
+
+// Encrypt implements [TokenCipher] interface.
+func (c *DerivedTokenCipher) Encrypt(owner string, token string) (string, error) {
+	key, err := c.ownerKey(owner)
+	if err != nil {
+		return "", err
+	}
+
+	return security.Encrypt([]byte(token), key)
+}
+
+// Decrypt implements [TokenCipher] interface.
+func (c *DerivedTokenCipher) Decrypt(owner string, cipherText string) (string, error) {
+	key, err := c.ownerKey(owner)
+	if err != nil {
+		return "", err
+	}
+
+	token, err := security.Decrypt(cipherText, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(token), nil
+}
+
+func (c *DerivedTokenCipher) ownerKey(owner string) (string, error) {
+	if owner == "" {
+		return "", errors.New("messaging: a token needs an owner")
+	}
+
+	key, err := hkdf.Key(sha256.New, c.masterKey, []byte(tokenHKDFSalt), owner, 32)
+	if err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
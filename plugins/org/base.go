@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/hanzoai/authz"
+	"github.com/hanzoai/base/apis"
 	"github.com/hanzoai/base/core"
 	"github.com/hanzoai/dbx"
 	"github.com/hanzoai/sqlite"
@@ -172,6 +173,8 @@ func (b *bases) fill(org string, e *entry) {
 		IsDev:         b.p.app.IsDev(),
 		DBConnect:     connect,
 	})
+	app.Store().Set(apis.StoreKeyBaseOrg, org)
+	app.Store().Set(apis.StoreKeyDeployment, b.p.app)
 	if err := app.Bootstrap(); err != nil {
 		e.err = fmt.Errorf("open the Base for %q: %w", org, err)
 		return
@@ -36,7 +36,7 @@ func TestATenantsBaseMaintainsItself(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	for _, id := range []string{"__hzDBOptimize__", "__hzLogsCleanup__"} {
+	for _, id := range []string{"__hzDBOptimize__", "__hzLogsCleanup__", "__hzTrashPurge__"} {
 		if !tenant.Cron().HasJob(id) {
 			t.Fatalf("an org's Base does not run %s, so nothing maintains it", id)
 		}
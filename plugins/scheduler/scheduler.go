@@ -15,6 +15,10 @@
 //   - createdAt (autodate)
 //   - completedAt (date)
 //
+// The poller also publishes the record drafts of the "drafts" collections
+// whose publishAt has come (see [core.PublishDueRecordDrafts]), so scheduled
+// content goes live with the scheduler running.
+//
 // Example:
 //
 //	scheduler.MustRegister(app, scheduler.Config{
@@ -243,6 +247,7 @@ func (p *plugin) pollLoop() {
 			return
 		case <-ticker.C:
 			p.processDueFunctions()
+			p.publishDueDrafts()
 		}
 	}
 }
@@ -276,6 +281,16 @@ func (p *plugin) processDueFunctions() {
 	}
 }
 
+// publishDueDrafts publishes the record drafts scheduled to be published by now.
+func (p *plugin) publishDueDrafts() {
+	if err := core.PublishDueRecordDrafts(p.app, time.Now()); err != nil {
+		p.app.Logger().Error(
+			"scheduler: failed to publish due drafts",
+			"error", err.Error(),
+		)
+	}
+}
+
 // findDueFunctions queries for pending functions whose scheduledAt <= now.
 func (p *plugin) findDueFunctions(now types.DateTime) ([]*core.Record, error) {
 	records := []*core.Record{}
@@ -5,13 +5,16 @@ package vault
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
+	"fmt"
 	"sync"
 	"time"
 )
 
 // AuditEntry records a single vault operation.
 type AuditEntry struct {
+	Seq       uint64    `json:"seq"` // position in the chain, from 1
 	Timestamp time.Time `json:"timestamp"`
 	VaultID   string    `json:"vaultId"`  // org:user
 	Actor     string    `json:"actor"`    // DID of who performed the action
@@ -21,11 +24,75 @@ type AuditEntry struct {
 	PrevHash  string    `json:"prevHash"` // hash of previous entry (chain link)
 }
 
+// computeHash returns the hash an entry should carry: SHA-256 over every other
+// field, each length-prefixed, so that no two entries hash alike by moving
+// bytes from one field to the next, and none can have its time or place in the
+// chain changed without its hash changing.
+func (e *AuditEntry) computeHash() string {
+	h := sha256.New()
+	h.Write(binary.BigEndian.AppendUint64(nil, e.Seq))
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(e.Timestamp.UnixMilli())))
+	for _, field := range []string{e.VaultID, e.Actor, e.Action, e.Resource, e.PrevHash} {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+		h.Write([]byte(field))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// AuditQuery narrows the entries GetAuditLog and AuditStore.Query return. The
+// zero value of a field does not narrow.
+type AuditQuery struct {
+	VaultID string
+	Actor   string
+	Since   time.Time // inclusive
+	Until   time.Time // exclusive
+	Limit   int       // 0 means no limit
+}
+
+func (q AuditQuery) matches(e *AuditEntry) bool {
+	if q.VaultID != "" && e.VaultID != q.VaultID {
+		return false
+	}
+	if q.Actor != "" && e.Actor != q.Actor {
+		return false
+	}
+	if !q.Since.IsZero() && e.Timestamp.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.Timestamp.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditStore is where an AuditLog keeps its chain when it has to outlive the
+// process. Entries are appended in chain order and read back in it.
+type AuditStore interface {
+	// Append stores the next entry of the chain.
+	Append(entry AuditEntry) error
+
+	// Last returns the head of the chain, or nil when it is empty.
+	Last() (*AuditEntry, error)
+
+	// Query returns the entries q matches, in chain order.
+	Query(q AuditQuery) ([]AuditEntry, error)
+
+	// Scan calls fn with every entry, in chain order, stopping at the first
+	// error fn returns.
+	Scan(fn func(AuditEntry) error) error
+}
+
 // AuditLog is an append-only log of vault operations.
 // Entries are hash-chained: each entry's PrevHash points to the previous entry's Hash.
 // The last hash is the audit merkle root, suitable for chain anchoring.
+//
+// A log with a store (NewStoredAuditLog) keeps only the head of the chain in
+// memory; queries and Verify read the store, so they answer for the whole
+// history rather than for this process.
 type AuditLog struct {
 	entries []AuditEntry
+	store   AuditStore
+	head    *AuditEntry // last entry, for a stored log
 	mu      sync.RWMutex
 }
 
@@ -34,54 +101,104 @@ func NewAuditLog() *AuditLog {
 	return &AuditLog{}
 }
 
+// NewStoredAuditLog creates an audit log that appends to store, continuing the
+// chain already in it.
+func NewStoredAuditLog(store AuditStore) (*AuditLog, error) {
+	head, err := store.Last()
+	if err != nil {
+		return nil, fmt.Errorf("vault/audit: load chain head: %w", err)
+	}
+	return &AuditLog{store: store, head: head}, nil
+}
+
+// auditAppendAttempts is how many times Record tries to append to a store that
+// other logs append to as well before it gives up.
+const auditAppendAttempts = 5
+
 // Record appends an entry to the audit log.
 // The entry is hash-chained to the previous entry automatically.
-func (al *AuditLog) Record(vaultID, actor, action, resource string) {
+//
+// A stored log may share its store with other logs, in other processes. Their
+// entries take the seq after the head this log knows, and the store refuses
+// the second of two entries with the same seq, so an append that fails while
+// the store's head has moved to or past that seq lost the race rather than
+// failed: the head is reloaded and the entry chained to it instead.
+func (al *AuditLog) Record(vaultID, actor, action, resource string) error {
 	al.mu.Lock()
 	defer al.mu.Unlock()
 
-	prevHash := ""
-	if len(al.entries) > 0 {
-		prevHash = al.entries[len(al.entries)-1].Hash
+	if al.store == nil {
+		var prev *AuditEntry
+		if len(al.entries) > 0 {
+			prev = &al.entries[len(al.entries)-1]
+		}
+		al.entries = append(al.entries, newAuditEntry(prev, vaultID, actor, action, resource))
+		return nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		entry := newAuditEntry(al.head, vaultID, actor, action, resource)
+
+		err := al.store.Append(entry)
+		if err == nil {
+			al.head = &entry
+			return nil
+		}
+
+		head, lastErr := al.store.Last()
+		if lastErr != nil || head == nil || head.Seq < entry.Seq || attempt == auditAppendAttempts {
+			return fmt.Errorf("vault/audit: append: %w", err)
+		}
+		al.head = head
 	}
+}
 
+// newAuditEntry returns the entry that follows prev, or the first entry of a
+// chain when prev is nil.
+func newAuditEntry(prev *AuditEntry, vaultID, actor, action, resource string) AuditEntry {
 	entry := AuditEntry{
-		Timestamp: time.Now(),
+		Seq:       1,
+		Timestamp: time.Now().UTC().Truncate(time.Millisecond), // what a stored timestamp keeps
 		VaultID:   vaultID,
 		Actor:     actor,
 		Action:    action,
 		Resource:  resource,
-		PrevHash:  prevHash,
 	}
+	if prev != nil {
+		entry.Seq = prev.Seq + 1
+		entry.PrevHash = prev.Hash
+	}
+	entry.Hash = entry.computeHash()
 
-	h := sha256.New()
-	h.Write([]byte(entry.VaultID))
-	h.Write([]byte(entry.Actor))
-	h.Write([]byte(entry.Action))
-	h.Write([]byte(entry.Resource))
-	h.Write([]byte(entry.PrevHash))
-	entry.Hash = hex.EncodeToString(h.Sum(nil))
-
-	al.entries = append(al.entries, entry)
+	return entry
 }
 
 // GetAuditLog returns entries for a vaultID since a given time.
 // Pass time.Time{} (zero) to get all entries.
 func (al *AuditLog) GetAuditLog(vaultID string, since time.Time) []AuditEntry {
+	result, _ := al.Query(AuditQuery{VaultID: vaultID, Since: since})
+	return result
+}
+
+// Query returns the entries q matches, in chain order.
+func (al *AuditLog) Query(q AuditQuery) ([]AuditEntry, error) {
 	al.mu.RLock()
 	defer al.mu.RUnlock()
 
+	if al.store != nil {
+		return al.store.Query(q)
+	}
+
 	var result []AuditEntry
-	for _, e := range al.entries {
-		if e.VaultID != vaultID {
-			continue
+	for i := range al.entries {
+		if q.Limit > 0 && len(result) >= q.Limit {
+			break
 		}
-		if !since.IsZero() && e.Timestamp.Before(since) {
-			continue
+		if q.matches(&al.entries[i]) {
+			result = append(result, al.entries[i])
 		}
-		result = append(result, e)
 	}
-	return result
+	return result, nil
 }
 
 // MerkleRoot returns the hash of the last entry, which is the root of the
@@ -91,6 +208,13 @@ func (al *AuditLog) MerkleRoot() string {
 	al.mu.RLock()
 	defer al.mu.RUnlock()
 
+	if al.store != nil {
+		if al.head == nil {
+			return ""
+		}
+		return al.head.Hash
+	}
+
 	if len(al.entries) == 0 {
 		return ""
 	}
@@ -101,34 +225,66 @@ func (al *AuditLog) MerkleRoot() string {
 func (al *AuditLog) Len() int {
 	al.mu.RLock()
 	defer al.mu.RUnlock()
+
+	if al.store != nil {
+		if al.head == nil {
+			return 0
+		}
+		return int(al.head.Seq)
+	}
+
 	return len(al.entries)
 }
 
 // Verify checks that the hash chain is consistent.
-// Returns true if every entry's PrevHash matches the previous entry's Hash.
+// Returns true if every entry's hash is that of its content, and every
+// entry's PrevHash and Seq follow the previous entry's. For a stored log the
+// whole chain is read back from the store, and it has to reach the head this
+// log last wrote — so a tail cut off the store does not verify either. It may
+// go on past it, with the entries of the other logs of the store.
 func (al *AuditLog) Verify() bool {
 	al.mu.RLock()
 	defer al.mu.RUnlock()
 
-	for i, e := range al.entries {
-		// Recompute hash
-		h := sha256.New()
-		h.Write([]byte(e.VaultID))
-		h.Write([]byte(e.Actor))
-		h.Write([]byte(e.Action))
-		h.Write([]byte(e.Resource))
-		h.Write([]byte(e.PrevHash))
-		computed := hex.EncodeToString(h.Sum(nil))
-
-		if computed != e.Hash {
-			return false
+	var prev *AuditEntry
+	check := func(e AuditEntry) error {
+		if e.computeHash() != e.Hash {
+			return errBrokenChain
 		}
-		if i > 0 && e.PrevHash != al.entries[i-1].Hash {
-			return false
+		if prev == nil {
+			if e.PrevHash != "" || e.Seq != 1 {
+				return errBrokenChain
+			}
+		} else if e.PrevHash != prev.Hash || e.Seq != prev.Seq+1 {
+			return errBrokenChain
 		}
-		if i == 0 && e.PrevHash != "" {
-			return false
+		prev = &e
+		return nil
+	}
+
+	if al.store == nil {
+		for _, e := range al.entries {
+			if check(e) != nil {
+				return false
+			}
 		}
+		return true
 	}
-	return true
+
+	reached := al.head == nil
+	err := al.store.Scan(func(e AuditEntry) error {
+		if err := check(e); err != nil {
+			return err
+		}
+		if al.head != nil && e.Seq == al.head.Seq {
+			if e.Hash != al.head.Hash {
+				return errBrokenChain
+			}
+			reached = true
+		}
+		return nil
+	})
+	return err == nil && reached
 }
+
+var errBrokenChain = fmt.Errorf("vault/audit: broken chain")
@@ -0,0 +1,122 @@
+// Copyright (C) 2020-2026, Hanzo AI Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vault
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditBundleFormat identifies an exported audit bundle.
+const AuditBundleFormat = "vault-audit-v1"
+
+// AuditBundle is a signed export of audit entries, for handing history to
+// someone who should not have to trust the Base it came from: an auditor, a
+// regulator, the user whose vault it is.
+//
+// The signature covers the whole bundle. Each entry still carries its own
+// hash and its predecessor's, so the entries can be checked against each other
+// as well, and against Root wherever that was anchored.
+type AuditBundle struct {
+	Format     string       `json:"format"`
+	OrgID      string       `json:"orgId"`
+	ExportedAt time.Time    `json:"exportedAt"`
+	VaultID    string       `json:"vaultId,omitempty"` // the filter the entries were selected by
+	Actor      string       `json:"actor,omitempty"`
+	Since      time.Time    `json:"since,omitzero"`
+	Until      time.Time    `json:"until,omitzero"`
+	Entries    []AuditEntry `json:"entries"`
+	Root       string       `json:"root"`       // head of the whole chain at export time
+	ChainValid bool         `json:"chainValid"` // whether the whole chain verified at export time
+	PublicKey  string       `json:"publicKey"`  // base64 ed25519 key the bundle is signed with
+	Signature  string       `json:"signature"`  // base64 ed25519 over the bundle with this field empty
+}
+
+// auditSigningKey derives the org's audit signing key from the master key.
+// The public half is stable for as long as the master key is, so it can be
+// published once and every bundle checked against it.
+func auditSigningKey(master []byte, orgID string) (ed25519.PrivateKey, error) {
+	seed, err := vaultKey(master, orgID, "audit", "vault-audit")
+	if err != nil {
+		return nil, err
+	}
+	defer clear(seed)
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// SignAuditBundle sets bundle's PublicKey and Signature.
+func SignAuditBundle(bundle *AuditBundle, key ed25519.PrivateKey) error {
+	bundle.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	payload, err := auditBundlePayload(bundle)
+	if err != nil {
+		return err
+	}
+	bundle.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+// VerifyAuditBundle checks a bundle's signature against publicKey, that every
+// entry's hash is that of its content, and that entries adjacent in the chain
+// link up. Pass nil to check against the key the bundle names — which only
+// shows the bundle is intact, not who signed it.
+func VerifyAuditBundle(bundle *AuditBundle, publicKey ed25519.PublicKey) error {
+	if bundle.Format != AuditBundleFormat {
+		return fmt.Errorf("vault/audit: unknown bundle format %q", bundle.Format)
+	}
+
+	named, err := base64.StdEncoding.DecodeString(bundle.PublicKey)
+	if err != nil || len(named) != ed25519.PublicKeySize {
+		return fmt.Errorf("vault/audit: bad bundle public key")
+	}
+	if publicKey == nil {
+		publicKey = named
+	} else if !publicKey.Equal(ed25519.PublicKey(named)) {
+		return fmt.Errorf("vault/audit: bundle signed by another key")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(bundle.Signature)
+	if err != nil {
+		return fmt.Errorf("vault/audit: bad bundle signature: %w", err)
+	}
+	payload, err := auditBundlePayload(bundle)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return fmt.Errorf("vault/audit: bundle signature does not verify")
+	}
+
+	for i, e := range bundle.Entries {
+		if e.computeHash() != e.Hash {
+			return fmt.Errorf("vault/audit: entry %d hash mismatch", e.Seq)
+		}
+		if i > 0 {
+			prev := bundle.Entries[i-1]
+			if e.Seq <= prev.Seq {
+				return fmt.Errorf("vault/audit: entry %d out of order", e.Seq)
+			}
+			if e.Seq == prev.Seq+1 && e.PrevHash != prev.Hash {
+				return fmt.Errorf("vault/audit: entry %d does not link to %d", e.Seq, prev.Seq)
+			}
+		}
+	}
+
+	return nil
+}
+
+// auditBundlePayload is what a bundle's signature is over: its JSON encoding
+// with the signature left out.
+func auditBundlePayload(bundle *AuditBundle) ([]byte, error) {
+	unsigned := *bundle
+	unsigned.Signature = ""
+	payload, err := json.Marshal(&unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("vault/audit: encode bundle: %w", err)
+	}
+	return payload, nil
+}
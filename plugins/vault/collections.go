@@ -0,0 +1,398 @@
+// Copyright (C) 2020-2026, Hanzo AI Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vault
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/hanzoai/base/core"
+	"github.com/hanzoai/base/tools/types"
+	"github.com/hanzoai/dbx"
+)
+
+// The audit log, the capabilities and the usage counters live in system
+// collections of the Base that owns the vault, not in the user shards: they
+// are about the shards, an operator reads them across every user, and a user
+// must not be able to rewrite the record of what was done to their vault.
+const (
+	collectionAudit        = "_vaultAudit"
+	collectionCapabilities = "_vaultCapabilities"
+	collectionUsage        = "_vaultUsage"
+)
+
+// auditScanBatch is how many entries Scan reads from the collection at once.
+const auditScanBatch = 500
+
+func (p *plugin) ensureAuditCollection() error {
+	_, err := p.app.FindCollectionByNameOrId(collectionAudit)
+	if err == nil {
+		return nil
+	}
+
+	c := core.NewBaseCollection(collectionAudit)
+	c.System = true
+	c.Fields.Add(
+		&core.NumberField{Name: "seq", Required: true, OnlyInt: true},
+		&core.DateField{Name: "timestamp", Required: true},
+		&core.TextField{Name: "vaultId"},
+		&core.TextField{Name: "actor"},
+		&core.TextField{Name: "action", Required: true},
+		&core.TextField{Name: "resource"},
+		&core.TextField{Name: "hash", Required: true},
+		&core.TextField{Name: "prevHash"},
+	)
+
+	// seq is unique so that two writers racing on one chain head cannot both
+	// append to it: the second insert fails instead of forking the chain.
+	c.AddIndex("idx_vault_audit_seq", true, "seq", "")
+	c.AddIndex("idx_vault_audit_vault", false, "vaultId, seq", "")
+	c.AddIndex("idx_vault_audit_actor", false, "actor, seq", "")
+	c.AddIndex("idx_vault_audit_timestamp", false, "timestamp", "")
+
+	p.app.Logger().Info("creating vault system collection", "name", collectionAudit)
+	return p.app.Save(c)
+}
+
+func (p *plugin) ensureCapabilitiesCollection() error {
+	_, err := p.app.FindCollectionByNameOrId(collectionCapabilities)
+	if err == nil {
+		return nil
+	}
+
+	c := core.NewBaseCollection(collectionCapabilities)
+	c.System = true
+	c.Fields.Add(
+		&core.TextField{Name: "capId", Required: true},
+		&core.TextField{Name: "issuer", Required: true},
+		&core.TextField{Name: "subject", Required: true},
+		&core.TextField{Name: "resource", Required: true},
+		&core.JSONField{Name: "actions", MaxSize: 65536},
+		&core.DateField{Name: "expires"},
+		&core.TextField{Name: "signature"}, // base64
+		&core.BoolField{Name: "revoked"},
+		&core.AutodateField{Name: "created", OnCreate: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+
+	c.AddIndex("idx_vault_capabilities_cap_id", true, "capId", "")
+	c.AddIndex("idx_vault_capabilities_subject", false, "subject", "")
+
+	p.app.Logger().Info("creating vault system collection", "name", collectionCapabilities)
+	return p.app.Save(c)
+}
+
+func (p *plugin) ensureUsageCollection() error {
+	_, err := p.app.FindCollectionByNameOrId(collectionUsage)
+	if err == nil {
+		return nil
+	}
+
+	c := core.NewBaseCollection(collectionUsage)
+	c.System = true
+	c.Fields.Add(
+		&core.TextField{Name: "vaultId", Required: true},
+		&core.NumberField{Name: "puts", OnlyInt: true},
+		&core.NumberField{Name: "gets", OnlyInt: true},
+		&core.NumberField{Name: "syncs", OnlyInt: true},
+		&core.NumberField{Name: "anchors", OnlyInt: true},
+		&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+	)
+
+	c.AddIndex("idx_vault_usage_vault_id", true, "vaultId", "")
+
+	p.app.Logger().Info("creating vault system collection", "name", collectionUsage)
+	return p.app.Save(c)
+}
+
+// ─── Audit ───────────────────────────────────────────────────────────────────
+
+// recordAuditStore is the AuditStore of the _vaultAudit collection.
+type recordAuditStore struct {
+	app core.App
+}
+
+func (s *recordAuditStore) Append(entry AuditEntry) error {
+	col, err := s.app.FindCachedCollectionByNameOrId(collectionAudit)
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(col)
+	record.Set("seq", entry.Seq)
+	record.Set("timestamp", entry.Timestamp)
+	record.Set("vaultId", entry.VaultID)
+	record.Set("actor", entry.Actor)
+	record.Set("action", entry.Action)
+	record.Set("resource", entry.Resource)
+	record.Set("hash", entry.Hash)
+	record.Set("prevHash", entry.PrevHash)
+
+	return s.app.Save(record)
+}
+
+func (s *recordAuditStore) Last() (*AuditEntry, error) {
+	var records []*core.Record
+	err := s.app.RecordQuery(collectionAudit).
+		OrderBy("seq DESC").
+		Limit(1).
+		All(&records)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	entry := recordToAuditEntry(records[0])
+	return &entry, nil
+}
+
+func (s *recordAuditStore) Query(q AuditQuery) ([]AuditEntry, error) {
+	query := s.app.RecordQuery(collectionAudit).OrderBy("seq ASC")
+
+	if q.VaultID != "" {
+		query = query.AndWhere(dbx.HashExp{"vaultId": q.VaultID})
+	}
+	if q.Actor != "" {
+		query = query.AndWhere(dbx.HashExp{"actor": q.Actor})
+	}
+	if !q.Since.IsZero() {
+		query = query.AndWhere(dbx.NewExp("[[timestamp]] >= {:since}", dbx.Params{"since": formatDate(q.Since)}))
+	}
+	if !q.Until.IsZero() {
+		query = query.AndWhere(dbx.NewExp("[[timestamp]] < {:until}", dbx.Params{"until": formatDate(q.Until)}))
+	}
+	if q.Limit > 0 {
+		query = query.Limit(int64(q.Limit))
+	}
+
+	var records []*core.Record
+	if err := query.All(&records); err != nil {
+		return nil, err
+	}
+
+	result := make([]AuditEntry, 0, len(records))
+	for _, r := range records {
+		result = append(result, recordToAuditEntry(r))
+	}
+	return result, nil
+}
+
+// Scan reads the chain in batches keyed on seq, so that it holds one batch in
+// memory however long the history is.
+func (s *recordAuditStore) Scan(fn func(AuditEntry) error) error {
+	var after int64
+	for {
+		var records []*core.Record
+		err := s.app.RecordQuery(collectionAudit).
+			AndWhere(dbx.NewExp("[[seq]] > {:after}", dbx.Params{"after": after})).
+			OrderBy("seq ASC").
+			Limit(auditScanBatch).
+			All(&records)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			entry := recordToAuditEntry(r)
+			if err := fn(entry); err != nil {
+				return err
+			}
+			after = int64(entry.Seq)
+		}
+
+		if len(records) < auditScanBatch {
+			return nil
+		}
+	}
+}
+
+func recordToAuditEntry(r *core.Record) AuditEntry {
+	return AuditEntry{
+		Seq:       uint64(r.GetInt("seq")),
+		Timestamp: r.GetDateTime("timestamp").Time(),
+		VaultID:   r.GetString("vaultId"),
+		Actor:     r.GetString("actor"),
+		Action:    r.GetString("action"),
+		Resource:  r.GetString("resource"),
+		Hash:      r.GetString("hash"),
+		PrevHash:  r.GetString("prevHash"),
+	}
+}
+
+// formatDate formats t the way a DateField stores it, so that the two compare
+// as strings.
+func formatDate(t time.Time) string {
+	return t.UTC().Format(types.DefaultDateLayout)
+}
+
+// ─── Capabilities ────────────────────────────────────────────────────────────
+
+// recordCapabilityStore is the CapabilityStore of the _vaultCapabilities
+// collection.
+type recordCapabilityStore struct {
+	app core.App
+}
+
+func (s *recordCapabilityStore) LoadCapabilities() ([]*Capability, error) {
+	records, err := s.app.FindAllRecords(collectionCapabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := make([]*Capability, 0, len(records))
+	for _, r := range records {
+		var actions []string
+		if err := r.UnmarshalJSONField("actions", &actions); err != nil {
+			return nil, err
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(r.GetString("signature"))
+		if err != nil {
+			return nil, err
+		}
+
+		caps = append(caps, &Capability{
+			ID:        r.GetString("capId"),
+			Issuer:    r.GetString("issuer"),
+			Subject:   r.GetString("subject"),
+			Resource:  r.GetString("resource"),
+			Actions:   actions,
+			Expires:   r.GetDateTime("expires").Time(),
+			Signature: signature,
+			Revoked:   r.GetBool("revoked"),
+		})
+	}
+	return caps, nil
+}
+
+func (s *recordCapabilityStore) SaveCapability(cap *Capability) error {
+	record, err := s.app.FindFirstRecordByData(collectionCapabilities, "capId", cap.ID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		col, err := s.app.FindCachedCollectionByNameOrId(collectionCapabilities)
+		if err != nil {
+			return err
+		}
+		record = core.NewRecord(col)
+		record.Set("capId", cap.ID)
+	}
+
+	record.Set("issuer", cap.Issuer)
+	record.Set("subject", cap.Subject)
+	record.Set("resource", cap.Resource)
+	record.Set("actions", cap.Actions)
+	record.Set("signature", base64.StdEncoding.EncodeToString(cap.Signature))
+	record.Set("revoked", cap.Revoked)
+	if cap.Expires.IsZero() {
+		record.Set("expires", "")
+	} else {
+		record.Set("expires", cap.Expires)
+	}
+
+	return s.app.Save(record)
+}
+
+// ─── Usage ───────────────────────────────────────────────────────────────────
+
+// recordUsageStore is the UsageStore of the _vaultUsage collection.
+type recordUsageStore struct {
+	app core.App
+}
+
+func (s *recordUsageStore) LoadUsage(vaultID string) (*UsageReport, error) {
+	record, err := s.app.FindFirstRecordByData(collectionUsage, "vaultId", vaultID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &UsageReport{
+		VaultID: vaultID,
+		Puts:    int64(record.GetInt("puts")),
+		Gets:    int64(record.GetInt("gets")),
+		Syncs:   int64(record.GetInt("syncs")),
+		Anchors: int64(record.GetInt("anchors")),
+	}, nil
+}
+
+// AddUsage increments the counters in SQL rather than saving a total read
+// back from the record, which would lose the adds of whoever else wrote in
+// between. The first add for a vault creates its record; when two race to do
+// that, the unique index turns the loser's insert into an error and it adds to
+// the winner's record instead.
+func (s *recordUsageStore) AddUsage(delta UsageReport) error {
+	added, err := s.increment(delta)
+	if err != nil || added {
+		return err
+	}
+
+	col, err := s.app.FindCachedCollectionByNameOrId(collectionUsage)
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(col)
+	record.Set("vaultId", delta.VaultID)
+	record.Set("puts", delta.Puts)
+	record.Set("gets", delta.Gets)
+	record.Set("syncs", delta.Syncs)
+	record.Set("anchors", delta.Anchors)
+	if saveErr := s.app.Save(record); saveErr != nil {
+		added, err := s.increment(delta)
+		if err != nil {
+			return err
+		}
+		if !added {
+			return saveErr
+		}
+	}
+
+	return nil
+}
+
+// increment adds delta to an existing record, reporting whether there was one.
+func (s *recordUsageStore) increment(delta UsageReport) (bool, error) {
+	result, err := s.app.NonconcurrentDB().NewQuery(
+		"UPDATE {{" + collectionUsage + "}} SET " +
+			"[[puts]] = [[puts]] + {:puts}, " +
+			"[[gets]] = [[gets]] + {:gets}, " +
+			"[[syncs]] = [[syncs]] + {:syncs}, " +
+			"[[anchors]] = [[anchors]] + {:anchors}, " +
+			"[[updated]] = {:updated} " +
+			"WHERE [[vaultId]] = {:vaultId}",
+	).Bind(dbx.Params{
+		"puts":    delta.Puts,
+		"gets":    delta.Gets,
+		"syncs":   delta.Syncs,
+		"anchors": delta.Anchors,
+		"updated": types.NowDateTime().String(),
+		"vaultId": delta.VaultID,
+	}).Execute()
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows > 0, nil
+}
+
+func (s *recordUsageStore) ResetUsage(vaultID string) error {
+	_, err := s.app.NonconcurrentDB().Update(collectionUsage,
+		dbx.Params{"puts": 0, "gets": 0, "syncs": 0, "anchors": 0, "updated": types.NowDateTime().String()},
+		dbx.HashExp{"vaultId": vaultID},
+	).Execute()
+	return err
+}
@@ -4,6 +4,8 @@
 package vault
 
 import (
+	"crypto/ed25519"
+	"errors"
 	"testing"
 	"time"
 )
@@ -349,3 +351,319 @@ func TestAuditLog_MerkleRoot(t *testing.T) {
 		t.Fatalf("merkle root %q != last hash %q", al.MerkleRoot(), lastHash)
 	}
 }
+
+// memAuditStore is an AuditStore over a slice, standing in for _vaultAudit.
+// Like its unique seq index, it refuses a second entry with a seq.
+type memAuditStore struct {
+	entries []AuditEntry
+}
+
+func (s *memAuditStore) Append(entry AuditEntry) error {
+	for _, e := range s.entries {
+		if e.Seq == entry.Seq {
+			return errors.New("seq is taken")
+		}
+	}
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memAuditStore) Last() (*AuditEntry, error) {
+	if len(s.entries) == 0 {
+		return nil, nil
+	}
+	last := s.entries[len(s.entries)-1]
+	return &last, nil
+}
+
+func (s *memAuditStore) Query(q AuditQuery) ([]AuditEntry, error) {
+	var result []AuditEntry
+	for i := range s.entries {
+		if q.Limit > 0 && len(result) >= q.Limit {
+			break
+		}
+		if q.matches(&s.entries[i]) {
+			result = append(result, s.entries[i])
+		}
+	}
+	return result, nil
+}
+
+func (s *memAuditStore) Scan(fn func(AuditEntry) error) error {
+	for _, e := range s.entries {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuditLog_StoredChainSurvivesRestart(t *testing.T) {
+	store := &memAuditStore{}
+
+	al, err := NewStoredAuditLog(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	al.Record("org:alice", "alice", "put", "key:a")
+	al.Record("org:bob", "bob", "put", "key:b")
+
+	// A new process picks the chain up where the last one left it.
+	al, err = NewStoredAuditLog(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if al.Len() != 2 {
+		t.Fatalf("len = %d, want 2", al.Len())
+	}
+	if err := al.Record("org:alice", "alice", "get", "key:a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !al.Verify() {
+		t.Fatal("stored chain should verify")
+	}
+
+	entries := al.GetAuditLog("org:alice", time.Time{})
+	if len(entries) != 2 {
+		t.Fatalf("alice entries = %d, want 2", len(entries))
+	}
+	if entries[1].Seq != 3 || entries[1].PrevHash != store.entries[1].Hash {
+		t.Fatalf("entry after restart does not continue the chain: %+v", entries[1])
+	}
+	if al.MerkleRoot() != store.entries[2].Hash {
+		t.Fatal("merkle root should be the stored head")
+	}
+}
+
+func TestAuditLog_SharedStore(t *testing.T) {
+	store := &memAuditStore{}
+
+	// two processes on one store, both starting at its empty head
+	al1, err := NewStoredAuditLog(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	al2, err := NewStoredAuditLog(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := al1.Record("org:alice", "alice", "put", "key:a"); err != nil {
+		t.Fatal(err)
+	}
+	// al2 still takes seq 1, loses it to al1 and chains to al1's entry instead
+	if err := al2.Record("org:bob", "bob", "put", "key:b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := al1.Record("org:alice", "alice", "get", "key:a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(store.entries) != 3 {
+		t.Fatalf("store has %d entries, want 3", len(store.entries))
+	}
+	for i, e := range store.entries {
+		if e.Seq != uint64(i+1) {
+			t.Fatalf("entry %d has seq %d", i, e.Seq)
+		}
+		if i > 0 && e.PrevHash != store.entries[i-1].Hash {
+			t.Fatalf("entry %d does not chain to the one before it", i)
+		}
+	}
+
+	if !al1.Verify() || !al2.Verify() {
+		t.Fatal("the shared chain should verify from both logs")
+	}
+	if al1.MerkleRoot() != store.entries[2].Hash {
+		t.Fatal("merkle root should be the stored head")
+	}
+}
+
+func TestAuditLog_VerifyDetectsTampering(t *testing.T) {
+	newLog := func() (*AuditLog, *memAuditStore) {
+		store := &memAuditStore{}
+		al, err := NewStoredAuditLog(store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		al.Record("org:alice", "alice", "put", "key:a")
+		al.Record("org:alice", "alice", "put", "key:b")
+		al.Record("org:alice", "alice", "get", "key:b")
+		return al, store
+	}
+
+	tamper := map[string]func(s *memAuditStore){
+		"edited resource": func(s *memAuditStore) { s.entries[1].Resource = "key:c" },
+		"edited time":     func(s *memAuditStore) { s.entries[1].Timestamp = s.entries[1].Timestamp.Add(-time.Hour) },
+		"removed entry":   func(s *memAuditStore) { s.entries = append(s.entries[:1], s.entries[2:]...) },
+		"cut tail":        func(s *memAuditStore) { s.entries = s.entries[:2] },
+		"moved fields": func(s *memAuditStore) {
+			e := &s.entries[0]
+			e.Actor, e.Action = "alicep", "ut" // same bytes, different split
+		},
+	}
+
+	for name, fn := range tamper {
+		t.Run(name, func(t *testing.T) {
+			al, store := newLog()
+			if !al.Verify() {
+				t.Fatal("untouched chain should verify")
+			}
+			fn(store)
+			if al.Verify() {
+				t.Fatal("tampered chain should not verify")
+			}
+		})
+	}
+}
+
+func TestAuditLog_Query(t *testing.T) {
+	al := NewAuditLog()
+	al.Record("org:alice", "alice", "put", "key:a")
+	al.Record("org:alice", "admin", "get", "key:a")
+	al.Record("org:bob", "admin", "get", "key:b")
+
+	byActor, _ := al.Query(AuditQuery{Actor: "admin"})
+	if len(byActor) != 2 {
+		t.Fatalf("admin entries = %d, want 2", len(byActor))
+	}
+
+	limited, _ := al.Query(AuditQuery{Actor: "admin", Limit: 1})
+	if len(limited) != 1 || limited[0].VaultID != "org:alice" {
+		t.Fatalf("limited = %+v", limited)
+	}
+
+	future, _ := al.Query(AuditQuery{Since: time.Now().Add(time.Hour)})
+	if len(future) != 0 {
+		t.Fatalf("entries since an hour from now = %d, want 0", len(future))
+	}
+
+	past, _ := al.Query(AuditQuery{Until: time.Now().Add(-time.Hour)})
+	if len(past) != 0 {
+		t.Fatalf("entries until an hour ago = %d, want 0", len(past))
+	}
+}
+
+func TestAuditBundle_SignVerify(t *testing.T) {
+	al := NewAuditLog()
+	al.Record("org:alice", "alice", "put", "key:a")
+	al.Record("org:alice", "alice", "get", "key:a")
+
+	master := testMasterKey()
+	key, err := auditSigningKey(master, "test-org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := al.Query(AuditQuery{})
+
+	bundle := &AuditBundle{
+		Format:     AuditBundleFormat,
+		OrgID:      "test-org",
+		ExportedAt: time.Now().UTC(),
+		Entries:    entries,
+		Root:       al.MerkleRoot(),
+		ChainValid: al.Verify(),
+	}
+	if err := SignAuditBundle(bundle, key); err != nil {
+		t.Fatal(err)
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+	if err := VerifyAuditBundle(bundle, public); err != nil {
+		t.Fatalf("signed bundle should verify: %v", err)
+	}
+
+	other, _ := auditSigningKey(master, "other-org")
+	if err := VerifyAuditBundle(bundle, other.Public().(ed25519.PublicKey)); err == nil {
+		t.Fatal("bundle should not verify against another org's key")
+	}
+
+	bundle.Entries[1].Resource = "key:b"
+	if err := VerifyAuditBundle(bundle, public); err == nil {
+		t.Fatal("edited bundle should not verify")
+	}
+}
+
+// ─── Persistent Capabilities ────────────────────────────────────────────────
+
+// memCapabilityStore is a CapabilityStore over a map, standing in for
+// _vaultCapabilities.
+type memCapabilityStore struct {
+	caps map[string]Capability
+	fail bool
+}
+
+func (s *memCapabilityStore) LoadCapabilities() ([]*Capability, error) {
+	var result []*Capability
+	for _, cap := range s.caps {
+		cap := cap
+		result = append(result, &cap)
+	}
+	return result, nil
+}
+
+func (s *memCapabilityStore) SaveCapability(cap *Capability) error {
+	if s.fail {
+		return errors.New("store down")
+	}
+	s.caps[cap.ID] = *cap
+	return nil
+}
+
+func TestPolicyEngine_StoredSurvivesRestart(t *testing.T) {
+	store := &memCapabilityStore{caps: map[string]Capability{}}
+
+	pe, err := NewStoredPolicyEngine(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := &Capability{Issuer: "did:lux:org:acme", Subject: "bob", Resource: "vault:acme:*", Actions: []string{"read"}}
+	write := &Capability{Issuer: "did:lux:org:acme", Subject: "bob", Resource: "vault:acme:*", Actions: []string{"write"}}
+	if err := pe.Grant(read); err != nil {
+		t.Fatal(err)
+	}
+	if err := pe.Grant(write); err != nil {
+		t.Fatal(err)
+	}
+	if err := pe.Revoke(write.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	pe, err = NewStoredPolicyEngine(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pe.Check("bob", "vault:acme:docs", "read") {
+		t.Fatal("granted capability should survive a restart")
+	}
+	if pe.Check("bob", "vault:acme:docs", "write") {
+		t.Fatal("revocation should survive a restart")
+	}
+}
+
+func TestPolicyEngine_StoreFailureLeavesMemoryUnchanged(t *testing.T) {
+	store := &memCapabilityStore{caps: map[string]Capability{}}
+	pe, _ := NewStoredPolicyEngine(store)
+
+	cap := &Capability{Issuer: "did:lux:org:acme", Subject: "bob", Resource: "vault:acme:*", Actions: []string{"read"}}
+	if err := pe.Grant(cap); err != nil {
+		t.Fatal(err)
+	}
+
+	store.fail = true
+	if err := pe.Revoke(cap.ID); err == nil {
+		t.Fatal("revoke should fail when the store does")
+	}
+	if !pe.Check("bob", "vault:acme:docs", "read") {
+		t.Fatal("a revocation that was not stored should not apply")
+	}
+
+	other := &Capability{Issuer: "did:lux:org:acme", Subject: "carol", Resource: "vault:acme:*", Actions: []string{"read"}}
+	if err := pe.Grant(other); err == nil {
+		t.Fatal("grant should fail when the store does")
+	}
+	if pe.Check("carol", "vault:acme:docs", "read") {
+		t.Fatal("a grant that was not stored should not apply")
+	}
+}
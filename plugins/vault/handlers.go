@@ -4,15 +4,22 @@
 package vault
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/hanzoai/base/apis"
 	"github.com/hanzoai/base/core"
 	"github.com/hanzoai/base/tools/router"
 )
 
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
 // registerRoutes adds vault API routes.
 // All routes require authentication — the user ID comes from the auth context.
 func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
@@ -41,10 +48,10 @@ func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
 		})
 	})
 
-	// POST /vault/put — store encrypted key-value
+	// POST /vault/put — store encrypted key-value in the user's shard + CRDT log
 	api.POST("/put", func(e *core.RequestEvent) error {
 		userID := e.Auth.Id
-		shard, err := p.GetShard(userID)
+		session, err := p.vault.OpenUser(userID)
 		if err != nil {
 			return e.InternalServerError("", err)
 		}
@@ -53,29 +60,26 @@ func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
 			Key   string `json:"key"`
 			Value string `json:"value"`
 		}
-		if err := e.BindBody(&req); err != nil {
+		if err := e.BindBody(&req); err != nil || req.Key == "" {
 			return e.BadRequestError("", nil)
 		}
 
-		encrypted, err := shard.Encrypt([]byte(req.Value))
-		if err != nil {
-			return e.InternalServerError("encrypt failed", err)
+		if err := session.Put(req.Key, []byte(req.Value)); err != nil {
+			return e.InternalServerError("store failed", err)
 		}
-
-		// In full implementation: write to user's SQLite shard + CRDT log
-		_ = encrypted
+		p.track(e, "put", "key:"+req.Key)
 
 		return e.JSON(200, map[string]string{
 			"status": "stored",
 			"key":    req.Key,
-			"shard":  shard.UserID,
+			"shard":  userID,
 		})
 	})
 
-	// POST /vault/get — retrieve and decrypt
+	// POST /vault/get — read from the user's shard and decrypt
 	api.POST("/get", func(e *core.RequestEvent) error {
 		userID := e.Auth.Id
-		_, err := p.GetShard(userID)
+		session, err := p.vault.OpenUser(userID)
 		if err != nil {
 			return e.InternalServerError("", err)
 		}
@@ -87,9 +91,15 @@ func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
 			return e.BadRequestError("", nil)
 		}
 
-		// In full implementation: read from SQLite shard, decrypt with DEK
+		value, err := session.Get(req.Key)
+		if err != nil {
+			return e.NotFoundError("", nil)
+		}
+		p.track(e, "get", "key:"+req.Key)
+
 		return e.JSON(200, map[string]string{
 			"key":    req.Key,
+			"value":  string(value),
 			"status": "decrypted",
 		})
 	})
@@ -97,17 +107,21 @@ func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
 	// GET /vault/anchor — get current merkle root for chain anchoring
 	api.GET("/anchor", func(e *core.RequestEvent) error {
 		userID := e.Auth.Id
-		shard, err := p.GetShard(userID)
+		session, err := p.vault.OpenUser(userID)
 		if err != nil {
 			return e.InternalServerError("", err)
 		}
 
 		// Compute merkle root of the shard state
-		hash := sha256.Sum256([]byte(shard.Path + ":" + shard.UserID))
+		receipt, err := session.Anchor()
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+		p.track(e, "anchor", "root:"+receipt.MerkleRoot)
 
 		return e.JSON(200, map[string]string{
 			"user_id":     userID,
-			"merkle_root": hex.EncodeToString(hash[:]),
+			"merkle_root": receipt.MerkleRoot,
 			"chain":       p.config.ChainRPC,
 			"status":      "ready_to_anchor",
 		})
@@ -132,25 +146,183 @@ func (p *plugin) registerRoutes(r *router.Router[*core.RequestEvent]) {
 		if !p.config.SyncEnabled {
 			return e.JSON(200, map[string]string{"status": "sync_disabled"})
 		}
+		p.track(e, "sync", "")
 		return e.JSON(200, map[string]string{"status": "sync_triggered"})
 	})
 
-	// POST /vault/export — export encrypted shard for backup/migration
+	// POST /vault/export — export the shard as a bundle for backup/migration.
+	// Values are AES-256-GCM ciphertext under the user DEK — safe to store anywhere.
 	api.POST("/export", func(e *core.RequestEvent) error {
 		userID := e.Auth.Id
-		shard, err := p.GetShard(userID)
+		session, err := p.vault.OpenUser(userID)
 		if err != nil {
 			return e.InternalServerError("", err)
 		}
 
-		// In full implementation: read SQLite file, it's already encrypted
-		return e.JSON(200, map[string]interface{}{
-			"user_id": userID,
-			"path":    shard.Path,
-			"format":  "encrypted-sqlite",
-			"note":    "file is AES-256-GCM encrypted with user DEK — safe to store anywhere",
+		bundle, err := ExportVault(session)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+		p.track(e, "export", "")
+
+		return e.Blob(200, "application/json", bundle)
+	})
+
+	p.registerAuditRoutes(api)
+}
+
+// registerAuditRoutes adds the superuser routes over the audit log of every
+// vault of the org to the /vault group.
+func (p *plugin) registerAuditRoutes(api *router.RouterGroup[*core.RequestEvent]) {
+	audit := api.Group("/audit")
+	audit.Bind(apis.RequireSuperuserAuth())
+
+	// GET /vault/audit?vaultId=&actor=&since=&until=&limit= — entries in chain
+	// order; since and until are RFC 3339 times.
+	audit.GET("", func(e *core.RequestEvent) error {
+		if p.audit == nil {
+			return e.NotFoundError("audit log not available", nil)
+		}
+
+		q, err := parseAuditQuery(e.Request.URL.Query())
+		if err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+		if q.Limit <= 0 {
+			q.Limit = defaultAuditLimit
+		}
+		q.Limit = min(q.Limit, maxAuditLimit)
+
+		entries, err := p.audit.Query(q)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+
+		return e.JSON(200, map[string]any{
+			"entries": entries,
+			"root":    p.audit.MerkleRoot(),
 		})
 	})
+
+	// GET /vault/audit/verify — re-check the whole stored hash chain
+	audit.GET("/verify", func(e *core.RequestEvent) error {
+		if p.audit == nil {
+			return e.NotFoundError("audit log not available", nil)
+		}
+
+		return e.JSON(200, map[string]any{
+			"valid":  p.audit.Verify(),
+			"length": p.audit.Len(),
+			"root":   p.audit.MerkleRoot(),
+		})
+	})
+
+	// GET /vault/audit/export?vaultId=&actor=&since=&until= — every matching
+	// entry in a bundle signed with the org's audit key (see AuditBundle).
+	audit.GET("/export", func(e *core.RequestEvent) error {
+		if p.audit == nil {
+			return e.NotFoundError("audit log not available", nil)
+		}
+
+		q, err := parseAuditQuery(e.Request.URL.Query())
+		if err != nil {
+			return e.BadRequestError(err.Error(), nil)
+		}
+
+		// Root before the entries, so that the entries reach at least as far
+		// as the root the bundle names.
+		root := p.audit.MerkleRoot()
+		entries, err := p.audit.Query(q)
+		if err != nil {
+			return e.InternalServerError("", err)
+		}
+		if entries == nil {
+			entries = []AuditEntry{}
+		}
+
+		bundle := &AuditBundle{
+			Format:     AuditBundleFormat,
+			OrgID:      p.config.OrgID,
+			ExportedAt: time.Now().UTC(),
+			VaultID:    q.VaultID,
+			Actor:      q.Actor,
+			Since:      q.Since,
+			Until:      q.Until,
+			Entries:    entries,
+			Root:       root,
+			ChainValid: p.audit.Verify(),
+		}
+		if err := SignAuditBundle(bundle, p.signer); err != nil {
+			return e.InternalServerError("", err)
+		}
+
+		return e.JSON(200, bundle)
+	})
+}
+
+// parseAuditQuery reads the audit filter from query parameters.
+func parseAuditQuery(values url.Values) (AuditQuery, error) {
+	q := AuditQuery{
+		VaultID: values.Get("vaultId"),
+		Actor:   values.Get("actor"),
+	}
+
+	for name, dst := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		raw := values.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return q, fmt.Errorf("%s must be an RFC 3339 time", name)
+		}
+		*dst = t.UTC()
+	}
+
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			return q, fmt.Errorf("limit must be a non-negative integer")
+		}
+		q.Limit = limit
+	}
+
+	return q, nil
+}
+
+// track records an operation of the authenticated user on their own vault in
+// the audit log and, for the metered ones, the usage meter. The operation has
+// already happened by then, so a failure to record it is logged rather than
+// turned into a failed request.
+func (p *plugin) track(e *core.RequestEvent, action, resource string) {
+	if p.audit == nil || p.meter == nil {
+		return
+	}
+
+	userID := e.Auth.Id
+	vaultID := p.config.OrgID + ":" + userID
+
+	if err := p.audit.Record(vaultID, userID, action, resource); err != nil {
+		p.logger.Error("vault audit record failed", "vault", vaultID, "action", action, "error", err)
+	}
+
+	var err error
+	switch action {
+	case "put":
+		err = p.meter.RecordPut(vaultID)
+	case "get":
+		err = p.meter.RecordGet(vaultID)
+	case "sync":
+		err = p.meter.RecordSync(vaultID)
+	case "anchor":
+		err = p.meter.RecordAnchor(vaultID)
+	}
+	if err != nil {
+		p.logger.Error("vault usage record failed", "vault", vaultID, "action", action, "error", err)
+	}
 }
 
 func writeJSON(w interface{ Write([]byte) (int, error) }, v interface{}) {
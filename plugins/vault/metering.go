@@ -4,6 +4,7 @@
 package vault
 
 import (
+	"fmt"
 	"sync"
 	"sync/atomic"
 )
@@ -17,11 +18,31 @@ type UsageReport struct {
 	Anchors int64  `json:"anchors"`
 }
 
+// UsageStore is where a Meter keeps its counters when they have to outlive the
+// process.
+type UsageStore interface {
+	// LoadUsage returns the stored counters of a vault, or nil when it has none.
+	LoadUsage(vaultID string) (*UsageReport, error)
+
+	// AddUsage adds delta's counters to those stored for delta.VaultID. It must
+	// be an increment on the store's side, not a write of a total, so that
+	// concurrent adds from one or several processes all count.
+	AddUsage(delta UsageReport) error
+
+	// ResetUsage zeroes the stored counters of a vault.
+	ResetUsage(vaultID string) error
+}
+
 // Meter tracks per-vault operation counts.
 // Designed for pay-per-use billing but works locally too.
+//
+// A meter with a store (NewStoredMeter) loads a vault's counters from it the
+// first time the vault is seen and adds every operation to it as well as to
+// memory, so the counts carry on across restarts.
 type Meter struct {
 	mu     sync.RWMutex
 	vaults map[string]*vaultCounters
+	store  UsageStore
 }
 
 type vaultCounters struct {
@@ -38,62 +59,126 @@ func NewMeter() *Meter {
 	}
 }
 
-func (m *Meter) counters(vaultID string) *vaultCounters {
+// NewStoredMeter creates a usage meter that keeps its counters in store.
+func NewStoredMeter(store UsageStore) *Meter {
+	return &Meter{
+		vaults: make(map[string]*vaultCounters),
+		store:  store,
+	}
+}
+
+func (m *Meter) counters(vaultID string) (*vaultCounters, error) {
 	m.mu.RLock()
 	c, ok := m.vaults[vaultID]
 	m.mu.RUnlock()
 	if ok {
-		return c
+		return c, nil
 	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	// Double-check after write lock.
 	if c, ok := m.vaults[vaultID]; ok {
-		return c
+		return c, nil
 	}
 	c = &vaultCounters{}
+	if m.store != nil {
+		stored, err := m.store.LoadUsage(vaultID)
+		if err != nil {
+			return nil, fmt.Errorf("vault/meter: load usage of %q: %w", vaultID, err)
+		}
+		if stored != nil {
+			c.puts.Store(stored.Puts)
+			c.gets.Store(stored.Gets)
+			c.syncs.Store(stored.Syncs)
+			c.anchors.Store(stored.Anchors)
+		}
+	}
 	m.vaults[vaultID] = c
-	return c
+	return c, nil
+}
+
+// record adds delta to a vault's counters, in the store first when there is one.
+func (m *Meter) record(delta UsageReport) error {
+	c, err := m.counters(delta.VaultID)
+	if err != nil {
+		return err
+	}
+
+	if m.store != nil {
+		if err := m.store.AddUsage(delta); err != nil {
+			return fmt.Errorf("vault/meter: add usage of %q: %w", delta.VaultID, err)
+		}
+	}
+
+	c.puts.Add(delta.Puts)
+	c.gets.Add(delta.Gets)
+	c.syncs.Add(delta.Syncs)
+	c.anchors.Add(delta.Anchors)
+	return nil
 }
 
 // RecordPut increments the put counter for a vault.
-func (m *Meter) RecordPut(vaultID string) {
-	m.counters(vaultID).puts.Add(1)
+func (m *Meter) RecordPut(vaultID string) error {
+	return m.record(UsageReport{VaultID: vaultID, Puts: 1})
 }
 
 // RecordGet increments the get counter for a vault.
-func (m *Meter) RecordGet(vaultID string) {
-	m.counters(vaultID).gets.Add(1)
+func (m *Meter) RecordGet(vaultID string) error {
+	return m.record(UsageReport{VaultID: vaultID, Gets: 1})
 }
 
 // RecordSync increments the sync counter for a vault.
-func (m *Meter) RecordSync(vaultID string) {
-	m.counters(vaultID).syncs.Add(1)
+func (m *Meter) RecordSync(vaultID string) error {
+	return m.record(UsageReport{VaultID: vaultID, Syncs: 1})
 }
 
 // RecordAnchor increments the anchor counter for a vault.
-func (m *Meter) RecordAnchor(vaultID string) {
-	m.counters(vaultID).anchors.Add(1)
+func (m *Meter) RecordAnchor(vaultID string) error {
+	return m.record(UsageReport{VaultID: vaultID, Anchors: 1})
 }
 
-// GetUsage returns the usage report for a vault.
+// GetUsage returns the usage report for a vault. A vault whose stored counters
+// could not be loaded reports zeroes; Usage returns the error instead.
 func (m *Meter) GetUsage(vaultID string) *UsageReport {
-	c := m.counters(vaultID)
+	u, err := m.Usage(vaultID)
+	if err != nil {
+		return &UsageReport{VaultID: vaultID}
+	}
+	return u
+}
+
+// Usage returns the usage report for a vault.
+func (m *Meter) Usage(vaultID string) (*UsageReport, error) {
+	c, err := m.counters(vaultID)
+	if err != nil {
+		return nil, err
+	}
 	return &UsageReport{
 		VaultID: vaultID,
 		Puts:    c.puts.Load(),
 		Gets:    c.gets.Load(),
 		Syncs:   c.syncs.Load(),
 		Anchors: c.anchors.Load(),
-	}
+	}, nil
 }
 
 // Reset zeroes all counters for a vault.
-func (m *Meter) Reset(vaultID string) {
-	c := m.counters(vaultID)
+func (m *Meter) Reset(vaultID string) error {
+	c, err := m.counters(vaultID)
+	if err != nil {
+		return err
+	}
+
+	if m.store != nil {
+		if err := m.store.ResetUsage(vaultID); err != nil {
+			return fmt.Errorf("vault/meter: reset usage of %q: %w", vaultID, err)
+		}
+	}
+
 	c.puts.Store(0)
 	c.gets.Store(0)
 	c.syncs.Store(0)
 	c.anchors.Store(0)
+	return nil
 }
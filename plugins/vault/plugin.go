@@ -31,6 +31,7 @@ package vault
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ed25519"
 	"crypto/rand"
 	"fmt"
 	"io"
@@ -45,6 +46,15 @@ import (
 	luxlog "github.com/luxfi/log"
 )
 
+const (
+	// AuditKey is the app.Store() key where the vault audit log is registered.
+	AuditKey = "vault.audit"
+	// PolicyKey is the app.Store() key where the vault policy engine is registered.
+	PolicyKey = "vault.policy"
+	// MeterKey is the app.Store() key where the vault usage meter is registered.
+	MeterKey = "vault.meter"
+)
+
 // Config configures the vault plugin.
 type Config struct {
 	Enabled     bool   `json:"enabled"`
@@ -88,16 +98,42 @@ func Register(app core.App, config Config) error {
 		config.ZAPPort = 9999
 	}
 
+	if err := os.MkdirAll(config.DataDir, 0700); err != nil {
+		return fmt.Errorf("vault: create data dir: %w", err)
+	}
+
+	v, err := Open(SDKConfig{
+		DataDir:   config.DataDir,
+		MasterKEK: config.MasterKey,
+		OrgID:     config.OrgID,
+		ChainRPC:  config.ChainRPC,
+	})
+	if err != nil {
+		return err
+	}
+
+	signer, err := auditSigningKey(config.MasterKey, config.OrgID)
+	if err != nil {
+		return err
+	}
+
 	p := &plugin{
 		app:    app,
 		config: config,
+		vault:  v,
+		signer: signer,
 		shards: make(map[string]*UserShard),
 		logger: luxlog.New("component", "vault"),
 	}
 
-	if err := os.MkdirAll(config.DataDir, 0700); err != nil {
-		return fmt.Errorf("vault: create data dir: %w", err)
-	}
+	// Load the audit chain, capabilities and usage counters once the app's
+	// database is up.
+	app.OnBootstrap().BindFunc(func(e *core.BootstrapEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		return p.bootstrap()
+	})
 
 	// Register routes on serve.
 	app.OnServe().Bind(&hook.Handler[*core.ServeEvent]{
@@ -123,11 +159,68 @@ func Register(app core.App, config Config) error {
 type plugin struct {
 	app    core.App
 	config Config
+	vault  *Vault // the sessions the routes read and write, one shard per user
+	audit  *AuditLog
+	policy *PolicyEngine
+	meter  *Meter
+	signer ed25519.PrivateKey // signs exported audit bundles
 	shards map[string]*UserShard
 	mu     sync.RWMutex
 	logger luxlog.Logger
 }
 
+// bootstrap creates the vault's system collections and opens the audit log,
+// policy engine and meter on them.
+func (p *plugin) bootstrap() error {
+	if err := p.ensureAuditCollection(); err != nil {
+		return fmt.Errorf("vault: failed to create %s collection: %w", collectionAudit, err)
+	}
+	if err := p.ensureCapabilitiesCollection(); err != nil {
+		return fmt.Errorf("vault: failed to create %s collection: %w", collectionCapabilities, err)
+	}
+	if err := p.ensureUsageCollection(); err != nil {
+		return fmt.Errorf("vault: failed to create %s collection: %w", collectionUsage, err)
+	}
+
+	audit, err := NewStoredAuditLog(&recordAuditStore{app: p.app})
+	if err != nil {
+		return err
+	}
+	policy, err := NewStoredPolicyEngine(&recordCapabilityStore{app: p.app})
+	if err != nil {
+		return err
+	}
+
+	p.audit = audit
+	p.policy = policy
+	p.meter = NewStoredMeter(&recordUsageStore{app: p.app})
+
+	p.app.Store().Set(AuditKey, p.audit)
+	p.app.Store().Set(PolicyKey, p.policy)
+	p.app.Store().Set(MeterKey, p.meter)
+
+	return nil
+}
+
+// GetAudit retrieves the registered vault audit log from the app, or nil.
+func GetAudit(app core.App) *AuditLog {
+	audit, _ := app.Store().Get(AuditKey).(*AuditLog)
+	return audit
+}
+
+// GetPolicy retrieves the registered vault policy engine from the app, or nil.
+// Capabilities granted or revoked through it are persisted.
+func GetPolicy(app core.App) *PolicyEngine {
+	policy, _ := app.Store().Get(PolicyKey).(*PolicyEngine)
+	return policy
+}
+
+// GetMeter retrieves the registered vault usage meter from the app, or nil.
+func GetMeter(app core.App) *Meter {
+	meter, _ := app.Store().Get(MeterKey).(*Meter)
+	return meter
+}
+
 // UserShard is an encrypted per-user SQLite database.
 type UserShard struct {
 	UserID string
@@ -156,7 +249,7 @@ func (p *plugin) GetShard(userID string) (*UserShard, error) {
 	if err != nil {
 		return nil, err
 	}
-	dbPath := filepath.Join(p.config.DataDir, p.config.OrgID, userID+".db")
+	dbPath := shardPath(p.config.DataDir, p.config.OrgID, userID)
 
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
 		return nil, fmt.Errorf("vault: create user dir: %w", err)
@@ -180,6 +273,7 @@ func (p *plugin) closeAll() {
 		clear(shard.DEK)
 		delete(p.shards, id)
 	}
+	p.vault.Close()
 	p.logger.Info("all vault shards closed")
 }
 
@@ -46,12 +46,24 @@ func capID(issuer, subject, resource string, actions []string) string {
 	return hex.EncodeToString(h.Sum(nil))[:16]
 }
 
+// CapabilityStore is where a PolicyEngine keeps its capabilities when they
+// have to outlive the process.
+type CapabilityStore interface {
+	// LoadCapabilities returns every stored capability, revoked ones included.
+	LoadCapabilities() ([]*Capability, error)
+
+	// SaveCapability stores cap, replacing the one with the same ID.
+	SaveCapability(cap *Capability) error
+}
+
 // PolicyEngine manages capability-based access control for vaults.
-// Thread-safe. All capabilities are held in memory (persisted to vault shard
-// in production via Put/Get).
+// Thread-safe. All capabilities are held in memory; an engine with a store
+// (NewStoredPolicyEngine) loads them from it once and writes every grant and
+// revocation through to it before applying it.
 type PolicyEngine struct {
-	caps map[string]*Capability // capID → capability
-	mu   sync.RWMutex
+	caps  map[string]*Capability // capID → capability
+	store CapabilityStore
+	mu    sync.RWMutex
 }
 
 // NewPolicyEngine creates an empty policy engine.
@@ -61,6 +73,24 @@ func NewPolicyEngine() *PolicyEngine {
 	}
 }
 
+// NewStoredPolicyEngine creates a policy engine holding the capabilities in
+// store and persisting the ones granted or revoked from now on.
+func NewStoredPolicyEngine(store CapabilityStore) (*PolicyEngine, error) {
+	caps, err := store.LoadCapabilities()
+	if err != nil {
+		return nil, fmt.Errorf("vault/policy: load capabilities: %w", err)
+	}
+
+	pe := &PolicyEngine{
+		caps:  make(map[string]*Capability, len(caps)),
+		store: store,
+	}
+	for _, cap := range caps {
+		pe.caps[cap.ID] = cap
+	}
+	return pe, nil
+}
+
 // Grant issues a capability. The capability ID is computed deterministically.
 // Returns an error if required fields are missing.
 func (pe *PolicyEngine) Grant(cap *Capability) error {
@@ -81,9 +111,15 @@ func (pe *PolicyEngine) Grant(cap *Capability) error {
 	cap.Revoked = false
 
 	pe.mu.Lock()
-	pe.caps[cap.ID] = cap
-	pe.mu.Unlock()
+	defer pe.mu.Unlock()
 
+	if pe.store != nil {
+		if err := pe.store.SaveCapability(cap); err != nil {
+			return fmt.Errorf("vault/policy: save capability %q: %w", cap.ID, err)
+		}
+	}
+
+	pe.caps[cap.ID] = cap
 	return nil
 }
 
@@ -125,6 +161,15 @@ func (pe *PolicyEngine) Revoke(capID string) error {
 	if !ok {
 		return fmt.Errorf("vault/policy: capability %q not found", capID)
 	}
+
+	if pe.store != nil {
+		revoked := *cap
+		revoked.Revoked = true
+		if err := pe.store.SaveCapability(&revoked); err != nil {
+			return fmt.Errorf("vault/policy: save capability %q: %w", capID, err)
+		}
+	}
+
 	cap.Revoked = true
 	return nil
 }
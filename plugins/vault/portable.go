@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/hanzoai/dbx"
 )
 
 // Bundle is a portable vault export: JSON envelope with encrypted data + oplog + metadata.
@@ -30,6 +32,9 @@ type BundleMetadata struct {
 // ExportVault exports the session's encrypted state as a portable JSON bundle.
 // The bundle contains ciphertext only — the DEK is NOT included.
 // The caller must supply the DEK separately to import.
+//
+// A session with a shard is exported from the shard file, so the bundle is
+// what a restart would load rather than what this process holds.
 func ExportVault(session *Session) ([]byte, error) {
 	session.mu.RLock()
 	defer session.mu.RUnlock()
@@ -38,20 +43,30 @@ func ExportVault(session *Session) ([]byte, error) {
 		return nil, fmt.Errorf("vault: session is closed")
 	}
 
-	// Serialize the encrypted store as a map of key → hex-encoded ciphertext.
-	snapshot := make(map[string][]byte, len(session.store))
-	for k, v := range session.store {
-		snapshot[k] = v
+	var snapshot map[string][]byte
+	var oplog []Op
+	if session.db != nil {
+		state, err := loadShard(session.db)
+		if err != nil {
+			return nil, err
+		}
+		snapshot, oplog = state.store, state.oplog
+	} else {
+		snapshot = make(map[string][]byte, len(session.store))
+		for k, v := range session.store {
+			snapshot[k] = v
+		}
+
+		oplog = make([]Op, len(session.oplog))
+		copy(oplog, session.oplog)
 	}
 
+	// Serialize the encrypted store as a map of key → base64-encoded ciphertext.
 	snapshotJSON, err := json.Marshal(snapshot)
 	if err != nil {
 		return nil, fmt.Errorf("vault: marshal snapshot: %w", err)
 	}
 
-	oplog := make([]Op, len(session.oplog))
-	copy(oplog, session.oplog)
-
 	bundle := Bundle{
 		Version:   3,
 		UserID:    session.userID,
@@ -73,26 +88,89 @@ func ExportVault(session *Session) ([]byte, error) {
 	return data, nil
 }
 
-// ImportVault imports a vault from a portable bundle.
-// The caller must provide the correct DEK to decrypt values.
+// ImportVault imports a vault from a portable bundle into a session that
+// lives in memory. The caller must provide the correct DEK to decrypt values.
+// Vault.ImportUser imports into the user's shard instead.
 func ImportVault(data []byte, dek []byte) (*Session, error) {
 	if len(dek) != 32 {
 		return nil, fmt.Errorf("vault: DEK must be 32 bytes")
 	}
 
+	bundle, state, err := decodeBundle(data)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		userID:  bundle.UserID,
+		orgID:   bundle.OrgID,
+		dek:     make([]byte, 32),
+		store:   state.store,
+		oplog:   state.oplog,
+		version: state.version,
+	}
+	copy(session.dek, dek)
+
+	return session, nil
+}
+
+// ImportUser replaces the content of userID's shard with a bundle ExportVault
+// made of that user, in one transaction, and returns the user's session.
+//
+// The bundle's values are sealed with the DEK of the user and org it came
+// from, so a bundle of anyone else is refused rather than stored unreadable.
+func (v *Vault) ImportUser(userID string, data []byte) (*Session, error) {
+	bundle, state, err := decodeBundle(data)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.UserID != userID || bundle.OrgID != v.config.OrgID {
+		return nil, fmt.Errorf("vault: bundle of %s/%s cannot be imported as %s/%s",
+			bundle.OrgID, bundle.UserID, v.config.OrgID, userID)
+	}
+
+	session, err := v.OpenUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	err = session.persist(func(tx dbx.Builder) error {
+		return replaceShard(tx, state)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session.store = state.store
+	session.oplog = state.oplog
+	session.version = state.version
+	session.sent = map[string]map[string]uint64{}
+
+	return session, nil
+}
+
+// decodeBundle parses a bundle and the shard content it carries. The state
+// vector is rebuilt from the oplog.
+func decodeBundle(data []byte) (*Bundle, *shardState, error) {
 	var bundle Bundle
 	if err := json.Unmarshal(data, &bundle); err != nil {
-		return nil, fmt.Errorf("vault: unmarshal bundle: %w", err)
+		return nil, nil, fmt.Errorf("vault: unmarshal bundle: %w", err)
 	}
 
 	if bundle.Version != 3 {
-		return nil, fmt.Errorf("vault: unsupported bundle version %d", bundle.Version)
+		return nil, nil, fmt.Errorf("vault: unsupported bundle version %d", bundle.Version)
 	}
 
 	// Deserialize the encrypted store.
 	var snapshot map[string][]byte
 	if err := json.Unmarshal(bundle.Snapshot, &snapshot); err != nil {
-		return nil, fmt.Errorf("vault: unmarshal snapshot: %w", err)
+		return nil, nil, fmt.Errorf("vault: unmarshal snapshot: %w", err)
+	}
+	if snapshot == nil {
+		snapshot = make(map[string][]byte)
 	}
 
 	// Rebuild version map from oplog.
@@ -103,15 +181,10 @@ func ImportVault(data []byte, dek []byte) (*Session, error) {
 		}
 	}
 
-	session := &Session{
-		userID:  bundle.UserID,
-		orgID:   bundle.OrgID,
-		dek:     make([]byte, 32),
-		store:   snapshot,
-		oplog:   bundle.Oplog,
-		version: version,
+	oplog := bundle.Oplog
+	if oplog == nil {
+		oplog = make([]Op, 0)
 	}
-	copy(session.dek, dek)
 
-	return session, nil
+	return &bundle, &shardState{store: snapshot, oplog: oplog, version: version}, nil
 }
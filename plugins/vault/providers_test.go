@@ -6,6 +6,7 @@ package vault
 import (
 	"bytes"
 	"crypto/rand"
+	"encoding/json"
 	"path/filepath"
 	"sync"
 	"testing"
@@ -301,6 +302,55 @@ func TestExportImport_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestImportUser_RoundTripOnDisk(t *testing.T) {
+	key := testMasterKey()
+	v, _ := Open(SDKConfig{DataDir: t.TempDir(), MasterKEK: key, OrgID: "test-org"})
+	defer v.Close()
+
+	session, _ := v.OpenUser("alice")
+	session.Put("profile", []byte(`{"name":"Alice"}`))
+	session.Put("settings", []byte(`{"theme":"dark"}`))
+
+	bundle, err := ExportVault(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another machine, same master key
+	dir := t.TempDir()
+	v2, _ := Open(SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org"})
+
+	if _, err := v2.ImportUser("bob", bundle); err == nil {
+		t.Fatal("expected alice's bundle not to import as bob")
+	}
+
+	imported, err := v2.ImportUser("alice", bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := imported.Get("profile"); string(got) != `{"name":"Alice"}` {
+		t.Fatalf("profile = %q", got)
+	}
+	v2.Close()
+
+	// it is on disk: a reopened shard exports the same bundle content
+	v3, _ := Open(SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org"})
+	defer v3.Close()
+	reopened, _ := v3.OpenUser("alice")
+
+	again, err := ExportVault(reopened)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after Bundle
+	json.Unmarshal(bundle, &before)
+	json.Unmarshal(again, &after)
+	if !bytes.Equal(before.Snapshot, after.Snapshot) || len(after.Oplog) != 2 {
+		t.Fatalf("bundle after reopen differs: %d ops", len(after.Oplog))
+	}
+}
+
 func TestExportImport_WrongDEKFails(t *testing.T) {
 	key := testMasterKey()
 	v, _ := Open(SDKConfig{
@@ -438,6 +488,70 @@ func TestUsageMetering_Concurrent(t *testing.T) {
 	}
 }
 
+// memUsageStore is a UsageStore over a map, standing in for _vaultUsage.
+type memUsageStore struct {
+	mu    sync.Mutex
+	usage map[string]UsageReport
+}
+
+func (s *memUsageStore) LoadUsage(vaultID string) (*UsageReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.usage[vaultID]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (s *memUsageStore) AddUsage(delta UsageReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.usage[delta.VaultID]
+	u.VaultID = delta.VaultID
+	u.Puts += delta.Puts
+	u.Gets += delta.Gets
+	u.Syncs += delta.Syncs
+	u.Anchors += delta.Anchors
+	s.usage[delta.VaultID] = u
+	return nil
+}
+
+func (s *memUsageStore) ResetUsage(vaultID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.usage, vaultID)
+	return nil
+}
+
+func TestUsageMetering_StoredSurvivesRestart(t *testing.T) {
+	store := &memUsageStore{usage: map[string]UsageReport{}}
+
+	m := NewStoredMeter(store)
+	m.RecordPut("v1")
+	m.RecordPut("v1")
+	m.RecordAnchor("v1")
+	m.RecordGet("v2")
+
+	m = NewStoredMeter(store)
+	m.RecordPut("v1")
+
+	u := m.GetUsage("v1")
+	if u.Puts != 3 || u.Anchors != 1 {
+		t.Fatalf("v1 after restart: puts=%d anchors=%d, want 3 and 1", u.Puts, u.Anchors)
+	}
+	if m.GetUsage("v2").Gets != 1 {
+		t.Fatal("v2 gets should survive a restart")
+	}
+
+	if err := m.Reset("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if u := NewStoredMeter(store).GetUsage("v1"); u.Puts != 0 {
+		t.Fatalf("reset should be stored, puts = %d", u.Puts)
+	}
+}
+
 // ─── Provider Registry ──────────────────────────────────────────────────────
 
 func TestProviderRegistry_Register(t *testing.T) {
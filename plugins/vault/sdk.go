@@ -34,6 +34,8 @@ import (
 	"io"
 	"sync"
 	"time"
+
+	"github.com/hanzoai/dbx"
 )
 
 // SDKConfig configures a Vault instance (standalone, no Base app required).
@@ -46,7 +48,8 @@ type SDKConfig struct {
 	ChainRPC string // I-Chain RPC for merkle root commits
 
 	// Optional: sync
-	SyncPeers []string // ZAP peer addresses for CRDT sync
+	SyncPeers []string                            // ZAP peer addresses for CRDT sync
+	DialPeer  func(addr string) (SyncPeer, error) // connects to a SyncPeers address
 }
 
 // Vault is the top-level SDK handle. One per app process.
@@ -70,7 +73,7 @@ func Open(cfg SDKConfig) (*Vault, error) {
 	}, nil
 }
 
-// Close releases all resources and zeroes key material.
+// Close closes every open shard and zeroes key material.
 func (v *Vault) Close() {
 	v.mu.Lock()
 	defer v.mu.Unlock()
@@ -83,11 +86,16 @@ func (v *Vault) Close() {
 // ─── 1. Identity ─────────────────────────────────────────────────────────────
 
 // OpenUser opens (or creates) a session for a user.
-// Derives the per-user DEK and opens the encrypted SQLite shard.
+// Derives the per-user DEK, opens the encrypted SQLite shard and loads what
+// earlier sessions stored in it: entries, oplog and state vector.
 func (v *Vault) OpenUser(userID string) (*Session, error) {
 	v.mu.Lock()
 	defer v.mu.Unlock()
 
+	if v.users == nil {
+		return nil, fmt.Errorf("vault: closed")
+	}
+
 	if s, ok := v.users[userID]; ok {
 		return s, nil
 	}
@@ -96,15 +104,33 @@ func (v *Vault) OpenUser(userID string) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	db, err := openShardDB(shardPath(v.config.DataDir, v.config.OrgID, userID), dek)
+	if err != nil {
+		clear(dek)
+		return nil, err
+	}
+
+	state, err := loadShard(db)
+	if err != nil {
+		db.Close()
+		clear(dek)
+		return nil, err
+	}
+
 	s := &Session{
 		userID:   userID,
 		orgID:    v.config.OrgID,
 		dek:      dek,
 		dataDir:  v.config.DataDir,
 		chainRPC: v.config.ChainRPC,
-		store:    make(map[string][]byte), // in-memory for v1; SQLite in v2
-		oplog:    make([]Op, 0),
-		version:  make(map[string]uint64),
+		db:       db,
+		store:    state.store,
+		oplog:    state.oplog,
+		version:  state.version,
+		sent:     state.sent,
+		peers:    v.config.SyncPeers,
+		dialPeer: v.config.DialPeer,
 	}
 
 	v.users[userID] = s
@@ -122,16 +148,39 @@ type Session struct {
 	dataDir  string
 	chainRPC string
 
-	// v1: in-memory KV (replaced by encrypted SQLite in v2)
+	// db is the session's shard (see storage.go), or nil for a session that
+	// lives in memory only. store, oplog and version mirror its tables.
+	db *dbx.DB
+
 	store map[string][]byte
 
 	// CRDT operation log
 	oplog   []Op
 	version map[string]uint64 // state vector: nodeID → seq
 
+	// sent is, per peer, the state vector that peer has been sent up to.
+	sent map[string]map[string]uint64
+
+	peers    []string
+	dialPeer func(addr string) (SyncPeer, error)
+
 	mu sync.RWMutex
 }
 
+// SyncPeer is the other end of a Sync: another device, or a replica, holding
+// the same user's ops. It only ever sees ops, which carry ciphertext.
+type SyncPeer interface {
+	// ID names the peer. What it has been sent is remembered under it.
+	ID() string
+
+	// Pull returns the ops of userID the peer holds that a node whose state
+	// vector is version has not seen.
+	Pull(userID string, version map[string]uint64) ([]Op, error)
+
+	// Push hands the peer ops of userID it has not been sent before.
+	Push(userID string, ops []Op) error
+}
+
 // Op is a CRDT operation in the oplog.
 type Op struct {
 	Seq    uint64 `json:"seq"`
@@ -165,18 +214,31 @@ func (s *Session) Put(key string, value []byte) error {
 		return fmt.Errorf("vault: encrypt: %w", err)
 	}
 
-	s.store[key] = encrypted
-
 	// Append to CRDT oplog
-	seq := s.version[s.userID] + 1
-	s.version[s.userID] = seq
-	s.oplog = append(s.oplog, Op{
-		Seq:    seq,
+	op := Op{
+		Seq:    s.version[s.userID] + 1,
 		NodeID: s.userID,
 		Key:    key,
 		Value:  encrypted, // ops carry ciphertext, not plaintext
 		Time:   time.Now().UnixMilli(),
+	}
+
+	err = s.persist(func(tx dbx.Builder) error {
+		if err := putEntry(tx, key, encrypted); err != nil {
+			return err
+		}
+		if err := appendOp(tx, op); err != nil {
+			return err
+		}
+		return setVersion(tx, op.NodeID, op.Seq)
 	})
+	if err != nil {
+		return err
+	}
+
+	s.store[key] = encrypted
+	s.version[op.NodeID] = op.Seq
+	s.oplog = append(s.oplog, op)
 
 	return nil
 }
@@ -196,20 +258,39 @@ func (s *Session) Get(key string) ([]byte, error) {
 }
 
 // Delete removes a key.
-func (s *Session) Delete(key string) {
+//
+// Delete returns an error since the tombstone is persisted to the shard; it
+// used to return nothing, so callers must now check it.
+func (s *Session) Delete(key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.store, key)
 
-	seq := s.version[s.userID] + 1
-	s.version[s.userID] = seq
-	s.oplog = append(s.oplog, Op{
-		Seq:    seq,
+	op := Op{
+		Seq:    s.version[s.userID] + 1,
 		NodeID: s.userID,
 		Key:    key,
 		Value:  nil, // tombstone
 		Time:   time.Now().UnixMilli(),
+	}
+
+	err := s.persist(func(tx dbx.Builder) error {
+		if err := deleteEntry(tx, key); err != nil {
+			return err
+		}
+		if err := appendOp(tx, op); err != nil {
+			return err
+		}
+		return setVersion(tx, op.NodeID, op.Seq)
 	})
+	if err != nil {
+		return err
+	}
+
+	delete(s.store, key)
+	s.version[op.NodeID] = op.Seq
+	s.oplog = append(s.oplog, op)
+
+	return nil
 }
 
 // ─── 4. Sync ─────────────────────────────────────────────────────────────────
@@ -218,28 +299,189 @@ func (s *Session) Delete(key string) {
 // CRDT merge is conflict-free — concurrent writes to the same key
 // resolve by last-writer-wins (Lamport timestamp + nodeID).
 // Ops carry ciphertext — peers relay opaque bytes without decrypting.
+//
+// It syncs with each of the configured SyncPeers, dialed with DialPeer. A
+// session with no peers has nobody to sync with and returns nil.
 func (s *Session) Sync() error {
+	if len(s.peers) == 0 {
+		return nil
+	}
+	if s.dialPeer == nil {
+		return fmt.Errorf("vault: sync peers configured without a DialPeer")
+	}
+
+	peers := make([]SyncPeer, 0, len(s.peers))
+	for _, addr := range s.peers {
+		peer, err := s.dialPeer(addr)
+		if err != nil {
+			return fmt.Errorf("vault: dial sync peer %s: %w", addr, err)
+		}
+		peers = append(peers, peer)
+	}
+
+	return s.SyncWith(peers...)
+}
+
+// SyncWith syncs with each of peers in turn: it pulls what the peer has that
+// this session has not seen, then pushes what the peer has not been sent.
+//
+// Both halves resume from the shard. The pull asks for what is newer than the
+// stored state vector, and what a peer was sent is stored per peer, so a
+// session reopened after a restart neither pulls nor pushes an op twice. The
+// peer's vector only moves once its Push succeeds; an op pushed to a peer that
+// failed to answer is sent again next time, which its Merge skips.
+func (s *Session) SyncWith(peers ...SyncPeer) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// v1: no-op (single device)
-	// push s.oplog to ZAP peers, pull their ops, merge
+	for _, peer := range peers {
+		remote, err := peer.Pull(s.userID, s.copyVersion())
+		if err != nil {
+			return fmt.Errorf("vault: pull from %s: %w", peer.ID(), err)
+		}
+		if err := s.merge(remote); err != nil {
+			return err
+		}
+
+		if s.sent == nil {
+			s.sent = map[string]map[string]uint64{}
+		}
+
+		// what came from the peer is not sent back to it
+		sent := make(map[string]uint64, len(s.sent[peer.ID()]))
+		for node, seq := range s.sent[peer.ID()] {
+			sent[node] = seq
+		}
+		for _, op := range remote {
+			sent[op.NodeID] = max(sent[op.NodeID], op.Seq)
+		}
+
+		ops := s.opsSince(sent)
+		if len(ops) == 0 {
+			continue
+		}
+		if err := peer.Push(s.userID, ops); err != nil {
+			return fmt.Errorf("vault: push to %s: %w", peer.ID(), err)
+		}
+
+		next := s.copyVersion()
+		err = s.persist(func(tx dbx.Builder) error {
+			for node, seq := range next {
+				if seq != sent[node] {
+					if err := setPeerVersion(tx, peer.ID(), node, seq); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		s.sent[peer.ID()] = next
+	}
+
 	return nil
 }
 
+// copyVersion returns a copy of the state vector. It is called with s.mu held.
+func (s *Session) copyVersion() map[string]uint64 {
+	version := make(map[string]uint64, len(s.version))
+	for node, seq := range s.version {
+		version[node] = seq
+	}
+	return version
+}
+
+// Version returns a copy of the session's state vector: for each node, the
+// highest seq applied from it. A peer sends it to be sent OpsSince it.
+func (s *Session) Version() map[string]uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.copyVersion()
+}
+
+// OpsSince returns the ops a peer whose state vector is version has not seen,
+// in the order they were applied here.
+func (s *Session) OpsSince(version map[string]uint64) []Op {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.opsSince(version)
+}
+
+// opsSince is OpsSince with s.mu held.
+func (s *Session) opsSince(version map[string]uint64) []Op {
+	var ops []Op
+	for _, op := range s.oplog {
+		if op.Seq > version[op.NodeID] {
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
 // Merge applies remote ops into local state.
 // Each op carries encrypted values — merge does not require DEK.
-func (s *Session) Merge(remoteOps []Op) {
+//
+// The ops it takes are committed to the shard together, with the state vector
+// they advance, so a session reopened after a restart skips the ops it had
+// already merged rather than applying them twice. Like Delete, Merge returns
+// the error of that commit; it used to return nothing.
+func (s *Session) Merge(remoteOps []Op) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.merge(remoteOps)
+}
+
+// merge is Merge with s.mu held.
+func (s *Session) merge(remoteOps []Op) error {
+	version := s.copyVersion()
+
+	accepted := make([]Op, 0, len(remoteOps))
 	for _, op := range remoteOps {
 		// Skip already-seen ops
-		if op.Seq <= s.version[op.NodeID] {
+		if op.Seq <= version[op.NodeID] {
 			continue
 		}
-		s.version[op.NodeID] = op.Seq
+		version[op.NodeID] = op.Seq
+		accepted = append(accepted, op)
+	}
+	if len(accepted) == 0 {
+		return nil
+	}
 
+	err := s.persist(func(tx dbx.Builder) error {
+		for _, op := range accepted {
+			var err error
+			if op.Value == nil {
+				err = deleteEntry(tx, op.Key)
+			} else {
+				err = putEntry(tx, op.Key, op.Value)
+			}
+			if err != nil {
+				return err
+			}
+			if err := appendOp(tx, op); err != nil {
+				return err
+			}
+		}
+		for node, seq := range version {
+			if seq != s.version[node] {
+				if err := setVersion(tx, node, seq); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, op := range accepted {
 		if op.Value == nil {
 			delete(s.store, op.Key)
 		} else {
@@ -248,6 +490,9 @@ func (s *Session) Merge(remoteOps []Op) {
 		}
 		s.oplog = append(s.oplog, op)
 	}
+	s.version = version
+
+	return nil
 }
 
 // ─── 5. Anchor ───────────────────────────────────────────────────────────────
@@ -283,6 +528,10 @@ func (s *Session) Anchor() (*AnchorReceipt, error) {
 func (s *Session) close() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
 	clear(s.dek)
 	s.store = nil
 	s.oplog = nil
@@ -292,7 +541,8 @@ func (s *Session) close() {
 
 // SharedSession is a multi-member vault, keyed by its own vaultID rather than
 // by any one member. The members list controls who can access it; each member
-// decrypts with the shared DEK.
+// decrypts with the shared DEK. It lives in memory: it has no shard of its
+// own, since no one member's file is the place for it.
 type SharedSession struct {
 	Session
 	vaultID string
@@ -449,6 +699,13 @@ func (s *Session) PutCollection(collection, key string, value []byte) error {
 	}
 
 	storeKey := collection + ":" + key
+	err = s.persist(func(tx dbx.Builder) error {
+		return putEntry(tx, storeKey, encrypted)
+	})
+	if err != nil {
+		return err
+	}
+
 	s.store[storeKey] = encrypted
 	return nil
 }
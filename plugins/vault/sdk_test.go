@@ -1,7 +1,9 @@
 package vault
 
 import (
+	"bytes"
 	"crypto/rand"
+	"os"
 	"testing"
 )
 
@@ -241,6 +243,206 @@ func TestMergeSkipsDuplicateOps(t *testing.T) {
 	}
 }
 
+func TestSessionPersistsAcrossOpen(t *testing.T) {
+	dir := t.TempDir()
+	key := testMasterKey()
+
+	v, _ := Open(SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org"})
+	s, _ := v.OpenUser("alice")
+
+	if err := s.Put("prefs", []byte(`{"theme":"dark"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("draft", []byte("to be deleted")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("draft"); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	// a new process: same data dir, same master key
+	v2, _ := Open(SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org"})
+	defer v2.Close()
+
+	s2, err := v2.OpenUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s2.Get("prefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"theme":"dark"}` {
+		t.Fatalf("prefs = %q", got)
+	}
+	if _, err := s2.Get("draft"); err == nil {
+		t.Fatal("expected the deleted key to stay deleted")
+	}
+
+	s2.mu.RLock()
+	opCount, seq := len(s2.oplog), s2.version["alice"]
+	s2.mu.RUnlock()
+	if opCount != 3 || seq != 3 {
+		t.Fatalf("oplog = %d ops, seq = %d, want 3 and 3", opCount, seq)
+	}
+
+	// the next local op continues the sequence rather than restarting it
+	if err := s2.Put("prefs", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if got := s2.Version()["alice"]; got != 4 {
+		t.Fatalf("seq after reopen = %d, want 4", got)
+	}
+}
+
+func TestMergeResumesFromStoredVersion(t *testing.T) {
+	dir := t.TempDir()
+	key := testMasterKey()
+
+	v, _ := Open(SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org"})
+	s, _ := v.OpenUser("alice")
+
+	shard := &UserShard{DEK: s.dek}
+	enc1, _ := shard.Encrypt([]byte("first"))
+	enc2, _ := shard.Encrypt([]byte("second"))
+
+	if err := s.Merge([]Op{{Seq: 1, NodeID: "d2", Key: "k", Value: enc1}}); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	v2, _ := Open(SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org"})
+	defer v2.Close()
+	s2, _ := v2.OpenUser("alice")
+
+	// a peer resending what was merged before the restart changes nothing
+	if err := s2.Merge([]Op{{Seq: 1, NodeID: "d2", Key: "k", Value: enc2}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s2.Get("k"); string(got) != "first" {
+		t.Fatalf("got %q, want first (already merged before the restart)", got)
+	}
+
+	// and what the peer is owed is only what it has not seen
+	if err := s2.Put("mine", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	ops := s2.OpsSince(map[string]uint64{"d2": 1})
+	if len(ops) != 1 || ops[0].NodeID != "alice" || ops[0].Key != "mine" {
+		t.Fatalf("ops since = %+v", ops)
+	}
+}
+
+// sessionPeer is a SyncPeer backed by another session, recording what it was
+// asked for and sent.
+type sessionPeer struct {
+	id      string
+	session *Session
+	pulls   []map[string]uint64
+	pushed  []Op
+}
+
+func (p *sessionPeer) ID() string { return p.id }
+
+func (p *sessionPeer) Pull(userID string, version map[string]uint64) ([]Op, error) {
+	p.pulls = append(p.pulls, version)
+	return p.session.OpsSince(version), nil
+}
+
+func (p *sessionPeer) Push(userID string, ops []Op) error {
+	p.pushed = append(p.pushed, ops...)
+	return p.session.Merge(ops)
+}
+
+func TestSyncResumesFromStoredVersions(t *testing.T) {
+	dir := t.TempDir()
+	key := testMasterKey()
+
+	phoneVault, _ := Open(SDKConfig{DataDir: t.TempDir(), MasterKEK: key, OrgID: "test-org"})
+	defer phoneVault.Close()
+	phone, _ := phoneVault.OpenUser("alice-phone")
+	peer := &sessionPeer{id: "phone", session: phone}
+
+	dial := func(addr string) (SyncPeer, error) { return peer, nil }
+	cfg := SDKConfig{DataDir: dir, MasterKEK: key, OrgID: "test-org", SyncPeers: []string{"phone"}, DialPeer: dial}
+
+	v, _ := Open(cfg)
+	s, _ := v.OpenUser("alice")
+	if err := s.Put("a", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := phone.Put("p", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if len(peer.pushed) != 1 || peer.pushed[0].Key != "a" {
+		t.Fatalf("pushed %+v, want only a", peer.pushed)
+	}
+	v.Close()
+
+	v2, _ := Open(cfg)
+	defer v2.Close()
+	s2, _ := v2.OpenUser("alice")
+
+	if err := s2.Put("b", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if err := phone.Put("q", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	peer.pushed = nil
+	if err := s2.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pull asked from the state vector stored before the restart, so it
+	// got only q
+	if last := peer.pulls[len(peer.pulls)-1]; last["alice-phone"] != 1 || last["alice"] != 2 {
+		t.Fatalf("pulled from %v, want the vector stored before the restart", last)
+	}
+	// and the push sent only b: not a, sent before the restart, nor p and q,
+	// which came from the phone
+	if len(peer.pushed) != 1 || peer.pushed[0].Key != "b" {
+		t.Fatalf("pushed %+v, want only b", peer.pushed)
+	}
+	if v := s2.Version(); v["alice-phone"] != 2 || v["alice"] != 2 {
+		t.Fatalf("version = %v after the sync", v)
+	}
+	if v := phone.Version(); v["alice"] != 2 {
+		t.Fatalf("phone version = %v after the sync", v)
+	}
+}
+
+func TestShardFileIsEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	v, _ := Open(SDKConfig{DataDir: dir, MasterKEK: testMasterKey(), OrgID: "test-org"})
+
+	s, _ := v.OpenUser("alice")
+	if err := s.Put("very-private-key-name", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	raw, err := os.ReadFile(shardPath(dir, "test-org", "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("very-private-key-name")) {
+		t.Fatal("the shard file holds the key name in the clear")
+	}
+
+	// another master key opens nothing
+	other, _ := Open(SDKConfig{DataDir: dir, MasterKEK: testMasterKey(), OrgID: "test-org"})
+	defer other.Close()
+	if _, err := other.OpenUser("alice"); err == nil {
+		t.Fatal("expected the shard not to open under another key")
+	}
+}
+
 func TestOrgIsolation(t *testing.T) {
 	key := testMasterKey()
 
@@ -0,0 +1,291 @@
+// Copyright (C) 2020-2026, Hanzo AI Inc. All rights reserved.
+// See the file LICENSE for licensing terms.
+
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hanzoai/dbx"
+	"github.com/hanzoai/sqlite"
+)
+
+// A session's shard on disk is one SQLite file, {DataDir}/{orgID}/{userID}.db,
+// the path GetShard names, holding four tables:
+//
+//	entries      key → ciphertext, the current state (what Get reads)
+//	oplog        every op in the order it was applied, tombstones included
+//	state_vector nodeID → highest seq applied from that node
+//	peer_vector  peer, nodeID → highest seq that peer has been sent
+//
+// Values are sealed with the DEK before they get here, as they always were, so
+// a row is ciphertext on its own. The file is encrypted as a whole as well,
+// with a key derived from the DEK, because the key names and the shape of the
+// oplog are worth hiding too. sqlite.OpenDB is the same mechanism the org
+// plugin opens its Bases with: SQLCipher under cgo, the byte-compatible codec
+// envelope otherwise.
+//
+// The session keeps the tables in memory as it did before and writes through:
+// each change is committed to the file first and applied to memory only once
+// the commit succeeds, so memory is never ahead of what a restart would load.
+const shardSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	key   TEXT PRIMARY KEY NOT NULL,
+	value BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS oplog (
+	id    INTEGER PRIMARY KEY AUTOINCREMENT,
+	node  TEXT NOT NULL,
+	seq   INTEGER NOT NULL,
+	key   TEXT NOT NULL,
+	value BLOB,
+	time  INTEGER NOT NULL,
+	UNIQUE (node, seq)
+);
+CREATE TABLE IF NOT EXISTS state_vector (
+	node TEXT PRIMARY KEY NOT NULL,
+	seq  INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS peer_vector (
+	peer TEXT NOT NULL,
+	node TEXT NOT NULL,
+	seq  INTEGER NOT NULL,
+	PRIMARY KEY (peer, node)
+);
+`
+
+// shardPath is where a member's shard lives under dataDir.
+func shardPath(dataDir, orgID, userID string) string {
+	return filepath.Join(dataDir, orgID, userID+".db")
+}
+
+// shardFileKey is the key the shard file is encrypted with:
+// HMAC-SHA256(DEK, "shard-file"), so that the key sealing the values is not
+// also the one the page codec uses.
+func shardFileKey(dek []byte) []byte {
+	mac := hmac.New(sha256.New, dek)
+	mac.Write([]byte("shard-file"))
+	return mac.Sum(nil)
+}
+
+// openShardDB opens (creating if needed) the encrypted shard file at path.
+func openShardDB(path string, dek []byte) (*dbx.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("vault: create user dir: %w", err)
+	}
+
+	key := shardFileKey(dek)
+	defer clear(key)
+
+	sqlDB, err := sqlite.OpenDB(path, key)
+	if err != nil {
+		return nil, fmt.Errorf("vault: open shard: %w", err)
+	}
+	db := dbx.NewFromDB(sqlDB, "sqlite")
+
+	if _, err := db.NewQuery(shardSchema).Execute(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("vault: shard schema (wrong key?): %w", err)
+	}
+
+	return db, nil
+}
+
+type entryRow struct {
+	Key   string `db:"key"`
+	Value []byte `db:"value"`
+}
+
+type opRow struct {
+	Node  string `db:"node"`
+	Seq   int64  `db:"seq"`
+	Key   string `db:"key"`
+	Value []byte `db:"value"`
+	Time  int64  `db:"time"`
+}
+
+type versionRow struct {
+	Node string `db:"node"`
+	Seq  int64  `db:"seq"`
+}
+
+type peerVersionRow struct {
+	Peer string `db:"peer"`
+	Node string `db:"node"`
+	Seq  int64  `db:"seq"`
+}
+
+// shardState is the whole content of a shard.
+type shardState struct {
+	store   map[string][]byte
+	oplog   []Op
+	version map[string]uint64
+
+	// sent is, per peer, the state vector it has been sent up to. It is the
+	// shard's own bookkeeping and is not part of what a bundle carries.
+	sent map[string]map[string]uint64
+}
+
+// loadShard reads the whole content of a shard.
+func loadShard(db dbx.Builder) (*shardState, error) {
+	var entries []entryRow
+	if err := db.NewQuery("SELECT key, value FROM entries").All(&entries); err != nil {
+		return nil, fmt.Errorf("vault: load entries: %w", err)
+	}
+
+	var ops []opRow
+	if err := db.NewQuery("SELECT node, seq, key, value, time FROM oplog ORDER BY id").All(&ops); err != nil {
+		return nil, fmt.Errorf("vault: load oplog: %w", err)
+	}
+
+	var versions []versionRow
+	if err := db.NewQuery("SELECT node, seq FROM state_vector").All(&versions); err != nil {
+		return nil, fmt.Errorf("vault: load state vector: %w", err)
+	}
+
+	var peerVersions []peerVersionRow
+	if err := db.NewQuery("SELECT peer, node, seq FROM peer_vector").All(&peerVersions); err != nil {
+		return nil, fmt.Errorf("vault: load peer vectors: %w", err)
+	}
+
+	state := &shardState{
+		store:   make(map[string][]byte, len(entries)),
+		oplog:   make([]Op, 0, len(ops)),
+		version: make(map[string]uint64, len(versions)),
+		sent:    map[string]map[string]uint64{},
+	}
+	for _, e := range entries {
+		state.store[e.Key] = e.Value
+	}
+	for _, o := range ops {
+		state.oplog = append(state.oplog, Op{
+			Seq:    uint64(o.Seq),
+			NodeID: o.Node,
+			Key:    o.Key,
+			Value:  o.Value,
+			Time:   o.Time,
+		})
+	}
+	for _, v := range versions {
+		state.version[v.Node] = uint64(v.Seq)
+	}
+	for _, v := range peerVersions {
+		if state.sent[v.Peer] == nil {
+			state.sent[v.Peer] = map[string]uint64{}
+		}
+		state.sent[v.Peer][v.Node] = uint64(v.Seq)
+	}
+
+	return state, nil
+}
+
+// replaceShard empties a shard and writes state into it. What the peers were
+// sent is forgotten along with what it was sent from, so the next Sync sends
+// them everything again, which merging skips what they already have of.
+func replaceShard(db dbx.Builder, state *shardState) error {
+	for _, table := range []string{"entries", "oplog", "state_vector", "peer_vector"} {
+		if _, err := db.NewQuery("DELETE FROM " + table).Execute(); err != nil {
+			return fmt.Errorf("vault: clear %s: %w", table, err)
+		}
+	}
+
+	for key, value := range state.store {
+		if err := putEntry(db, key, value); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range state.oplog {
+		if err := appendOp(db, op); err != nil {
+			return err
+		}
+	}
+
+	for node, seq := range state.version {
+		if err := setVersion(db, node, seq); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func putEntry(db dbx.Builder, key string, value []byte) error {
+	_, err := db.NewQuery(
+		"INSERT INTO entries (key, value) VALUES ({:key}, {:value}) " +
+			"ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+	).Bind(dbx.Params{"key": key, "value": value}).Execute()
+	if err != nil {
+		return fmt.Errorf("vault: write %s: %w", key, err)
+	}
+	return nil
+}
+
+func deleteEntry(db dbx.Builder, key string) error {
+	_, err := db.NewQuery("DELETE FROM entries WHERE key = {:key}").Bind(dbx.Params{"key": key}).Execute()
+	if err != nil {
+		return fmt.Errorf("vault: delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func appendOp(db dbx.Builder, op Op) error {
+	var value any
+	if op.Value != nil {
+		value = op.Value // a nil Value stays NULL: it is a tombstone, not an empty value
+	}
+
+	_, err := db.NewQuery(
+		"INSERT INTO oplog (node, seq, key, value, time) VALUES ({:node}, {:seq}, {:key}, {:value}, {:time})",
+	).Bind(dbx.Params{
+		"node":  op.NodeID,
+		"seq":   int64(op.Seq),
+		"key":   op.Key,
+		"value": value,
+		"time":  op.Time,
+	}).Execute()
+	if err != nil {
+		return fmt.Errorf("vault: append op %s/%d: %w", op.NodeID, op.Seq, err)
+	}
+	return nil
+}
+
+func setVersion(db dbx.Builder, node string, seq uint64) error {
+	_, err := db.NewQuery(
+		"INSERT INTO state_vector (node, seq) VALUES ({:node}, {:seq}) " +
+			"ON CONFLICT (node) DO UPDATE SET seq = excluded.seq",
+	).Bind(dbx.Params{"node": node, "seq": int64(seq)}).Execute()
+	if err != nil {
+		return fmt.Errorf("vault: write state vector: %w", err)
+	}
+	return nil
+}
+
+func setPeerVersion(db dbx.Builder, peer string, node string, seq uint64) error {
+	_, err := db.NewQuery(
+		"INSERT INTO peer_vector (peer, node, seq) VALUES ({:peer}, {:node}, {:seq}) " +
+			"ON CONFLICT (peer, node) DO UPDATE SET seq = excluded.seq",
+	).Bind(dbx.Params{"peer": peer, "node": node, "seq": int64(seq)}).Execute()
+	if err != nil {
+		return fmt.Errorf("vault: write the vector of peer %s: %w", peer, err)
+	}
+	return nil
+}
+
+// persist runs fn in a transaction on the session's shard. A session without
+// one (a shared vault, an imported bundle) lives in memory and has nothing to
+// persist.
+//
+// It is called with s.mu held.
+func (s *Session) persist(fn func(tx dbx.Builder) error) error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Transactional(func(tx *dbx.Tx) error {
+		return fn(tx)
+	})
+}
@@ -0,0 +1,555 @@
+package base
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRecordNotFound is returned by Find when the record does not exist or is
+// not visible to the caller; Base answers both with the same 404.
+var ErrRecordNotFound = errors.New("base: record not found")
+
+// Config configures NewClient.
+type Config struct {
+	// URL is the origin of the Base instance, e.g. "https://base.hanzo.ai".
+	URL string
+
+	// Prefix is the path the API is mounted under. Empty reads
+	// BASE_API_PREFIX, the same variable the server is configured with, and
+	// falls back to "/v1".
+	Prefix string
+
+	// Token is the initial auth token; AuthAs replaces it.
+	Token string
+
+	// IAM is the origin of the identity service Authenticate exchanges
+	// passwords with. Empty means URL, which proxies /v1/iam.
+	IAM string
+
+	// ClientID and ClientSecret identify the application to IAM for the
+	// password grant.
+	ClientID     string
+	ClientSecret string
+
+	// HTTPClient sends every request. It must not set a Timeout: the
+	// realtime stream is one long response. Deadlines belong on the ctx
+	// passed to each call. Empty means http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Error is a non-2xx answer from Base.
+type Error struct {
+	Status  int
+	Message string
+	Data    map[string]any
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("base: HTTP %d", e.Status)
+	}
+	return fmt.Sprintf("base: HTTP %d: %s", e.Status, e.Message)
+}
+
+// client is the HTTP implementation of Client.
+type client struct {
+	url    string
+	prefix string
+	iam    string
+	id     string
+	secret string
+	http   *http.Client
+
+	mu    sync.RWMutex
+	token string
+}
+
+// NewClient returns a Client speaking to the Base instance at cfg.URL.
+func NewClient(cfg Config) Client {
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = os.Getenv("BASE_API_PREFIX")
+	}
+	if prefix == "" {
+		prefix = "/v1"
+	}
+	// same normalisation as the server: one leading slash, no trailing one
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+
+	iam := cfg.IAM
+	if iam == "" {
+		iam = cfg.URL
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &client{
+		url:    strings.TrimRight(cfg.URL, "/"),
+		prefix: prefix,
+		iam:    strings.TrimRight(iam, "/"),
+		id:     cfg.ClientID,
+		secret: cfg.ClientSecret,
+		http:   httpClient,
+		token:  cfg.Token,
+	}
+}
+
+func (c *client) Kind() string {
+	return "hanzo-base"
+}
+
+func (c *client) AuthAs(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = token
+}
+
+func (c *client) authToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.token
+}
+
+// Authenticate exchanges email and password for an IAM token with the OAuth2
+// password grant and authenticates the client with it.
+//
+// Base keeps no credentials of its own, so there is nothing on Base to post a
+// password to: the exchange is IAM's, and the token it issues is what Base
+// validates. The interactive PKCE flow needs a browser to come back to and is
+// not something a service client can run, so an empty password is refused
+// rather than guessed at.
+func (c *client) Authenticate(ctx context.Context, email, password string) (*Session, error) {
+	if password == "" {
+		return nil, errors.New("base: the PKCE flow needs a browser; authenticate the user there and pass the token to AuthAs")
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "password")
+	form.Set("username", email)
+	form.Set("password", password)
+	form.Set("client_id", c.id)
+	if c.secret != "" {
+		form.Set("client_secret", c.secret)
+	}
+	form.Set("scope", "openid profile email")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.iam+"/v1/iam/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := c.send(req, &result); err != nil {
+		return nil, err
+	}
+	if result.AccessToken == "" {
+		return nil, &Error{Status: http.StatusUnauthorized, Message: cmp.Or(result.Description, result.Error)}
+	}
+
+	session := &Session{Token: result.AccessToken}
+	if result.ExpiresIn > 0 {
+		session.ExpiresAt = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+
+	// The claims are read for the caller's convenience only; Base verifies
+	// the signature on every request, so nothing here is trusted.
+	if claims := tokenClaims(result.AccessToken); claims != nil {
+		session.UserID, _ = claims["sub"].(string)
+		if session.UserID == "" {
+			session.UserID, _ = claims["id"].(string)
+		}
+		session.Email, _ = claims["email"].(string)
+		if session.ExpiresAt.IsZero() {
+			if exp, ok := claims["exp"].(float64); ok {
+				session.ExpiresAt = time.Unix(int64(exp), 0)
+			}
+		}
+	}
+	if session.Email == "" {
+		session.Email = email
+	}
+
+	c.AuthAs(session.Token)
+
+	return session, nil
+}
+
+// tokenClaims decodes the payload of a JWT without verifying it.
+func tokenClaims(token string) map[string]any {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	claims := map[string]any{}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return nil
+	}
+
+	return claims
+}
+
+func (c *client) Find(ctx context.Context, collection, id string) (*Record, error) {
+	var raw map[string]any
+	err := c.call(ctx, http.MethodGet, recordPath(collection, id), nil, &raw)
+	if err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return newRecord(raw), nil
+}
+
+func (c *client) List(ctx context.Context, collection, filter string, opts ListOpts) (*Page, error) {
+	query := url.Values{}
+	if opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PerPage > 0 {
+		query.Set("perPage", strconv.Itoa(opts.PerPage))
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	if filter != "" {
+		query.Set("filter", filter)
+	}
+	if len(opts.Expand) > 0 {
+		query.Set("expand", strings.Join(opts.Expand, ","))
+	}
+
+	path := recordsPath(collection)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result struct {
+		Items      []map[string]any `json:"items"`
+		Page       int              `json:"page"`
+		PerPage    int              `json:"perPage"`
+		TotalItems int              `json:"totalItems"`
+		TotalPages int              `json:"totalPages"`
+	}
+	if err := c.call(ctx, http.MethodGet, path, nil, &result); err != nil {
+		return nil, err
+	}
+
+	page := &Page{
+		Items:      make([]Record, len(result.Items)),
+		Page:       result.Page,
+		PerPage:    result.PerPage,
+		TotalItems: result.TotalItems,
+		TotalPages: result.TotalPages,
+	}
+	for i, raw := range result.Items {
+		page.Items[i] = *newRecord(raw)
+	}
+
+	return page, nil
+}
+
+func (c *client) Create(ctx context.Context, collection string, data map[string]any) (*Record, error) {
+	body := make(map[string]any, len(data))
+	for k, v := range data {
+		if k != "id" {
+			body[k] = v
+		}
+	}
+
+	var raw map[string]any
+	if err := c.call(ctx, http.MethodPost, recordsPath(collection), body, &raw); err != nil {
+		return nil, err
+	}
+
+	return newRecord(raw), nil
+}
+
+func (c *client) Update(ctx context.Context, collection, id string, patch map[string]any) (*Record, error) {
+	var raw map[string]any
+	if err := c.call(ctx, http.MethodPatch, recordPath(collection, id), patch, &raw); err != nil {
+		return nil, err
+	}
+
+	return newRecord(raw), nil
+}
+
+func (c *client) Delete(ctx context.Context, collection, id string) error {
+	err := c.call(ctx, http.MethodDelete, recordPath(collection, id), nil, nil)
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// standardFieldKeys are the keys every field exports; whatever else a field
+// exports is its type-specific config.
+var standardFieldKeys = map[string]bool{
+	"id":          true,
+	"name":        true,
+	"type":        true,
+	"system":      true,
+	"hidden":      true,
+	"presentable": true,
+	"required":    true,
+}
+
+func (c *client) Schema(ctx context.Context, collection string) (*CollectionSchema, error) {
+	var result struct {
+		Name    string           `json:"name"`
+		Type    string           `json:"type"`
+		System  bool             `json:"system"`
+		Fields  []map[string]any `json:"fields"`
+		Indexes []string         `json:"indexes"`
+	}
+	err := c.call(ctx, http.MethodGet, "/collections/"+url.PathEscape(collection), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &CollectionSchema{
+		Name:    result.Name,
+		Type:    result.Type,
+		System:  result.System,
+		Fields:  make([]FieldSchema, len(result.Fields)),
+		Indexes: result.Indexes,
+	}
+	for i, raw := range result.Fields {
+		field := FieldSchema{Options: map[string]any{}}
+		field.Name, _ = raw["name"].(string)
+		field.Type, _ = raw["type"].(string)
+		field.Required, _ = raw["required"].(bool)
+		field.System, _ = raw["system"].(bool)
+		for k, v := range raw {
+			if !standardFieldKeys[k] {
+				field.Options[k] = v
+			}
+		}
+		schema.Fields[i] = field
+	}
+
+	return schema, nil
+}
+
+// UploadFile appends a file to the record's file field.
+//
+// The upload goes to the field's "+" modifier, which appends to a multiple
+// field and replaces the file of a single one, so it never drops the files
+// already on the record. Base renames what it stores, so the storage key is
+// read back from the saved record: it is the last file of the field.
+func (c *client) UploadFile(ctx context.Context, collection, recordID, field string, name string, body []byte) (string, error) {
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+
+	part, err := mw.CreateFormFile(field+"+", name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(body); err != nil {
+		return "", err
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := c.request(ctx, http.MethodPatch, recordPath(collection, recordID), buf)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var raw map[string]any
+	if err := c.send(req, &raw); err != nil {
+		return "", err
+	}
+
+	switch v := raw[field].(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case []any:
+		if len(v) > 0 {
+			if key, ok := v[len(v)-1].(string); ok {
+				return key, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("base: the saved record has no file in %q", field)
+}
+
+func recordsPath(collection string) string {
+	return "/collections/" + url.PathEscape(collection) + "/records"
+}
+
+func recordPath(collection, id string) string {
+	return recordsPath(collection) + "/" + url.PathEscape(id)
+}
+
+// request builds a request to path under the API prefix, authenticated as the
+// client currently is.
+func (c *client) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url+c.prefix+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if token := c.authToken(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req, nil
+}
+
+// call sends a JSON body, when there is one, to path and decodes the answer
+// into result, when there is one.
+func (c *client) call(ctx context.Context, method, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := c.request(ctx, method, path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.send(req, result)
+}
+
+// send does req and decodes a 2xx answer into result, or turns any other into
+// an *Error.
+func (c *client) send(req *http.Request, result any) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 400 {
+		return newError(resp.StatusCode, raw)
+	}
+
+	if result == nil || len(raw) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(raw, result)
+}
+
+func newError(status int, raw []byte) *Error {
+	apiErr := &Error{Status: status}
+
+	// Base answers with message and data, IAM with the OAuth2 error pair.
+	var body struct {
+		Message     string         `json:"message"`
+		Data        map[string]any `json:"data"`
+		Error       string         `json:"error"`
+		Description string         `json:"error_description"`
+	}
+	if json.Unmarshal(raw, &body) == nil {
+		apiErr.Message = cmp.Or(body.Message, body.Description, body.Error)
+		apiErr.Data = body.Data
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(raw))
+	}
+
+	return apiErr
+}
+
+// recordTimeLayouts are the forms a datetime is exported in, the
+// space-separated one Base writes first.
+var recordTimeLayouts = []string{
+	"2006-01-02 15:04:05.000Z",
+	"2006-01-02 15:04:05Z07:00",
+	time.RFC3339Nano,
+}
+
+func parseRecordTime(v any) time.Time {
+	s, _ := v.(string)
+	for _, layout := range recordTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// newRecord lifts the keys every record exports out of raw and keeps the
+// rest, expand included, as its fields.
+func newRecord(raw map[string]any) *Record {
+	record := &Record{Fields: map[string]any{}}
+
+	for k, v := range raw {
+		switch k {
+		case "id":
+			record.ID, _ = v.(string)
+		case "collectionName":
+			record.Collection, _ = v.(string)
+		case "collectionId":
+		case "created":
+			record.Created = parseRecordTime(v)
+		case "updated":
+			record.Updated = parseRecordTime(v)
+		default:
+			record.Fields[k] = v
+		}
+	}
+
+	return record
+}
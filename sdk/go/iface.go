@@ -19,9 +19,9 @@ type Client interface {
 	Kind() string
 
 	// Authenticate exchanges a user identity for a session token. Empty
-	// password selects the OAuth2/PKCE flow (the impl handles the
-	// redirect-callback dance via the http.Handler returned by
-	// AuthHandler).
+	// password selects the OAuth2/PKCE flow, which needs a browser to
+	// redirect back to; the HTTP client refuses it and expects the
+	// token from that flow to be passed to AuthAs.
 	Authenticate(ctx context.Context, email, password string) (*Session, error)
 
 	// AuthAs sets the auth context for subsequent calls. Passing an
@@ -49,7 +49,7 @@ type Client interface {
 
 	// Subscribe opens a realtime stream of changes on a collection. The
 	// returned channel emits Events until ctx is cancelled or the
-	// connection breaks.
+	// connection breaks for good; a dropped connection is reopened.
 	Subscribe(ctx context.Context, collection, filter string) (<-chan Event, error)
 
 	// Schema returns the field definitions for a collection.
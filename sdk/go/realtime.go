@@ -0,0 +1,258 @@
+package base
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The delays between attempts to reopen a broken stream.
+const (
+	minReconnectDelay = 250 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Subscribe streams the changes to the records of collection that match
+// filter and that the client may read.
+//
+// A stream is opened with a grant rather than with the token itself: the token
+// is presented in a header to mint a single-use grant, and only the grant
+// travels in the stream's URL. A grant is spent by the one connection it opens,
+// so every reconnect mints a fresh one and subscribes again under the new
+// connection's id; the server forgets a client's subscriptions with its
+// connection. The server also closes idle streams, so a reconnect is ordinary
+// and is not reported.
+//
+// Failing to open the first stream is returned. After that the channel stays
+// open until ctx is done, or until reopening is refused outright (the token
+// was revoked, say), which no amount of retrying would fix.
+func (c *client) Subscribe(ctx context.Context, collection, filter string) (<-chan Event, error) {
+	topic := collection + "/*"
+	if filter != "" {
+		options, err := json.Marshal(map[string]any{
+			"query": map[string]string{"filter": filter},
+		})
+		if err != nil {
+			return nil, err
+		}
+		topic += "?" + url.Values{"options": {string(options)}}.Encode()
+	}
+
+	stream, err := c.connect(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+
+	go c.follow(ctx, stream, topic, events)
+
+	return events, nil
+}
+
+// follow relays the events of stream, reopening it whenever it breaks, and
+// closes events when it gives up.
+func (c *client) follow(ctx context.Context, stream *sseStream, topic string, events chan<- Event) {
+	defer close(events)
+
+	delay := minReconnectDelay
+
+	for {
+		err := stream.relay(ctx, topic, events)
+		stream.Close()
+		if ctx.Err() != nil {
+			return
+		}
+
+		for {
+			if err != nil && !retryable(err) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			stream, err = c.connect(ctx, topic)
+			if err == nil {
+				delay = minReconnectDelay
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+
+			delay = min(delay*2, maxReconnectDelay)
+		}
+	}
+}
+
+// retryable reports whether reopening a stream after err could succeed.
+func retryable(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		// the network, which comes back
+		return true
+	}
+
+	return apiErr.Status >= 500 || apiErr.Status == http.StatusTooManyRequests
+}
+
+// connect mints a grant, opens a stream with it and subscribes the stream to
+// topic.
+func (c *client) connect(ctx context.Context, topic string) (*sseStream, error) {
+	query := url.Values{}
+
+	// An anonymous caller has nothing to mint a grant with and opens the
+	// stream as the anonymous subscriber it is.
+	if c.authToken() != "" {
+		var grant struct {
+			Token string `json:"token"`
+		}
+		if err := c.call(ctx, http.MethodPost, "/realtime/token", nil, &grant); err != nil {
+			return nil, err
+		}
+		query.Set("token", grant.Token)
+	}
+
+	path := "/realtime"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	req, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	// the grant is the stream's credential; the header would be a second one
+	req.Header.Del("Authorization")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		return nil, newError(resp.StatusCode, raw)
+	}
+
+	stream := &sseStream{body: resp.Body, r: bufio.NewReader(resp.Body)}
+
+	name, data, err := stream.next()
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+	if name != "CONNECT" {
+		stream.Close()
+		return nil, fmt.Errorf("base: the stream opened with %q instead of CONNECT", name)
+	}
+
+	var connect struct {
+		ClientID string `json:"clientId"`
+	}
+	if err := json.Unmarshal(data, &connect); err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	err = c.call(ctx, http.MethodPost, "/realtime", map[string]any{
+		"clientId":      connect.ClientID,
+		"subscriptions": []string{topic},
+	}, nil)
+	if err != nil {
+		stream.Close()
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// sseStream reads the server-sent events of one stream.
+type sseStream struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+}
+
+func (s *sseStream) Close() error {
+	return s.body.Close()
+}
+
+// next reads the name and data of the next event.
+func (s *sseStream) next() (string, []byte, error) {
+	var name string
+	var data []string
+
+	for {
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return "", nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if name == "" && data == nil {
+				continue
+			}
+			return name, []byte(strings.Join(data, "\n")), nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			name = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+}
+
+// relay sends the record events of topic on events until the stream ends.
+func (s *sseStream) relay(ctx context.Context, topic string, events chan<- Event) error {
+	for {
+		name, data, err := s.next()
+		if err != nil {
+			return err
+		}
+		if name != topic {
+			continue
+		}
+
+		var msg struct {
+			Action string         `json:"action"`
+			Record map[string]any `json:"record"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		record := newRecord(msg.Record)
+
+		// The message carries no time of its own. A write stamps the record,
+		// which is the closest thing to the time of the change; a delete
+		// leaves nothing to stamp and is as recent as its arrival.
+		at := record.Updated
+		if msg.Action == "delete" || at.IsZero() {
+			at = time.Now()
+		}
+
+		select {
+		case events <- Event{Action: msg.Action, Collection: record.Collection, Record: record, At: at}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
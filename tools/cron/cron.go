@@ -2,15 +2,14 @@
 // backward compatibility. New code should call app.Tasks() directly.
 //
 // Scheduled jobs registered through this package are delegated to a
-// *tasks.Client — durable when TASKS_URL is set, local goroutine tickers
-// otherwise. The Schedule / NewSchedule helpers remain for cron-expression
-// validation (used by settings validators).
+// *tasks.Client — durable when TASKS_URL is set, local goroutines otherwise.
+// Schedule / NewSchedule validate cron expressions (used by settings
+// validators) and are the parser the client's local fallback fires by.
 package cron
 
 import (
 	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/hanzoai/base/tools/tasks"
@@ -19,43 +18,50 @@ import (
 // Cron is a crontab-like scheduler. Since the v2 refactor it is a shim
 // that delegates to a *tasks.Client.
 type Cron struct {
-	mu       sync.RWMutex
-	client   *tasks.Client
-	timezone *time.Location
+	client *tasks.Client
 }
 
 // New creates a Cron backed by a new local-only tasks.Client.
 // Use NewFromTasks to share an existing client with the rest of the app.
 func New() *Cron {
-	return &Cron{
-		client:   tasks.New("", "", nil),
-		timezone: time.UTC,
-	}
+	return NewFromTasks(tasks.New("", "", nil))
 }
 
 // NewFromTasks wraps an existing tasks.Client.
+//
+// It sets the client's CronParser to NewSchedule, so that cron expressions
+// the client runs locally — added here or on the client directly — fire at
+// their wall-clock moments rather than on an approximated interval.
 func NewFromTasks(c *tasks.Client) *Cron {
+	c.SetCronParser(parseTimetable)
+
 	return &Cron{
-		client:   c,
-		timezone: time.UTC,
+		client: c,
+	}
+}
+
+// parseTimetable is NewSchedule as a tasks.CronParser.
+func parseTimetable(expr string) (tasks.Timetable, error) {
+	schedule, err := NewSchedule(expr)
+	if err != nil {
+		return nil, err
 	}
+	return schedule, nil
 }
 
 // SetInterval is retained for API compatibility. No-op: the tick cadence is
 // dictated by each schedule's expression, not a global interval.
 func (c *Cron) SetInterval(time.Duration) {}
 
-// SetTimezone updates the timezone used for cron-expression evaluation.
-// Kept for API compatibility; the underlying tasks.Client does not currently
-// take a per-client timezone — server-side schedules run in UTC.
-func (c *Cron) SetTimezone(l *time.Location) {
-	if l == nil {
-		return
-	}
-	c.mu.Lock()
-	c.timezone = l
-	c.mu.Unlock()
-}
+// SetTimezone sets the timezone cron expressions are read in (UTC by
+// default): that of the local schedules, including those already running,
+// and of the durable schedules added afterwards. A nil location is ignored.
+func (c *Cron) SetTimezone(l *time.Location) { c.client.SetLocation(l) }
+
+// SetCatchUp sets what local schedules do about the moments they were due
+// while paused by Stop, the host was asleep or their previous run was still
+// going. The default, tasks.CatchUpSkip, waits for the next moment.
+func (c *Cron) SetCatchUp(policy tasks.CatchUp) { c.client.SetCatchUp(policy) }
 
 // MustAdd is Add that panics on error.
 func (c *Cron) MustAdd(jobId string, cronExpr string, fn func()) {
@@ -35,18 +35,36 @@ func TestCronSetInterval(t *testing.T) {
 	c.SetInterval(2 * time.Minute) // must not panic
 }
 
-// TestCronSetTimezone verifies SetTimezone accepts a zone without erroring.
+// TestCronSetTimezone verifies SetTimezone reaches the tasks.Client the local
+// schedules are read by, and that a nil zone leaves it as it was.
 func TestCronSetTimezone(t *testing.T) {
 	t.Parallel()
 
-	c := New()
-	defer c.Stop()
+	tc := tasks.New("", "", nil)
+	defer tc.Stop()
+
+	c := NewFromTasks(tc)
+	if err := c.Add("tz", "0 3 * * *", func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tc.Location() != time.UTC {
+		t.Fatalf("expected UTC by default, got %v", tc.Location())
+	}
+
 	tz, err := time.LoadLocation("Asia/Tokyo")
 	if err != nil {
 		t.Fatal(err)
 	}
-	c.SetTimezone(tz)  // must not panic
+	c.SetTimezone(tz)
 	c.SetTimezone(nil) // must not panic
+
+	if tc.Location() != tz {
+		t.Fatalf("expected %v, got %v", tz, tc.Location())
+	}
+	if !c.HasStarted() {
+		t.Fatal("expected the running schedule to keep running in the new zone")
+	}
 }
 
 func TestCronAddAndRemove(t *testing.T) {
@@ -64,6 +64,63 @@ func (s *Schedule) IsDue(m *Moment) bool {
 	return true
 }
 
+// nextSearchYears bounds how far ahead Next looks for a due moment. The rarest
+// schedule that is ever due ("0 0 29 2 1", a leap day on a Monday) comes
+// round within 28 years.
+const nextSearchYears = 30
+
+// Next returns the first moment strictly after t at which the Schedule is due,
+// read in t's location, or the zero time if it is never due (e.g. "0 0 30 2 *").
+//
+// Next and IsDue agree minute for minute. A wall-clock minute skipped by a
+// daylight saving change is never due, and one repeated by it is due each time
+// it comes round.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// the start of the next minute
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+
+	limit := t.AddDate(nextSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if _, ok := s.Months[int(t.Month())]; !ok {
+			t = forward(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+			continue
+		}
+
+		_, dayOk := s.Days[t.Day()]
+		_, weekdayOk := s.DaysOfWeek[int(t.Weekday())]
+		if !dayOk || !weekdayOk {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+			continue
+		}
+
+		if _, ok := s.Hours[t.Hour()]; !ok {
+			t = forward(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc))
+			continue
+		}
+
+		if _, ok := s.Minutes[t.Minute()]; !ok {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// forward returns next, unless a daylight saving change has normalized it to
+// a moment that is not after t, in which case it steps t one minute instead.
+func forward(t, next time.Time) time.Time {
+	if next.After(t) {
+		return next
+	}
+	return t.Add(time.Minute)
+}
+
 var macros = map[string]string{
 	"@yearly":   "0 0 1 1 *",
 	"@annually": "0 0 1 1 *",
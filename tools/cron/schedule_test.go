@@ -407,3 +407,92 @@ func TestScheduleIsDue(t *testing.T) {
 		})
 	}
 }
+
+func TestScheduleNext(t *testing.T) {
+	t.Parallel()
+
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		cronExpr string
+		after    time.Time
+		expected time.Time
+	}{
+		{
+			"0 3 * * *",
+			time.Date(2026, 3, 10, 14, 7, 30, 0, time.UTC),
+			time.Date(2026, 3, 11, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			// strictly after
+			"0 3 * * *",
+			time.Date(2026, 3, 11, 3, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 12, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			// weekdays, Friday evening -> Monday morning
+			"15 9 * * 1-5",
+			time.Date(2026, 3, 13, 18, 0, 0, 0, time.UTC),
+			time.Date(2026, 3, 16, 9, 15, 0, 0, time.UTC),
+		},
+		{
+			"*/20 * * * *",
+			time.Date(2026, 3, 10, 23, 59, 0, 0, time.UTC),
+			time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"@monthly",
+			time.Date(2026, 12, 5, 0, 0, 0, 0, time.UTC),
+			time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			// read in the location of the time asked about
+			"0 3 * * *",
+			time.Date(2026, 3, 10, 17, 0, 0, 0, time.UTC).In(tokyo),
+			time.Date(2026, 3, 11, 3, 0, 0, 0, tokyo),
+		},
+		{
+			// 02:30 does not exist on the spring forward day
+			"30 2 * * *",
+			time.Date(2026, 3, 8, 0, 0, 0, 0, newYork),
+			time.Date(2026, 3, 9, 2, 30, 0, 0, newYork),
+		},
+		{
+			"0 0 29 2 1",
+			time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2044, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			"0 0 30 2 *",
+			time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			time.Time{},
+		},
+	}
+
+	for i, s := range scenarios {
+		t.Run(fmt.Sprintf("%d-%s", i, s.cronExpr), func(t *testing.T) {
+			schedule, err := cron.NewSchedule(s.cronExpr)
+			if err != nil {
+				t.Fatalf("Unexpected cron error: %v", err)
+			}
+
+			result := schedule.Next(s.after)
+
+			if !result.Equal(s.expected) {
+				t.Fatalf("Expected %v, got %v", s.expected, result)
+			}
+
+			if !result.IsZero() && !schedule.IsDue(cron.NewMoment(result)) {
+				t.Fatalf("Expected %v to be due", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,447 @@
+// Package imap implements the small subset of an IMAP4rev1 client (RFC 3501)
+// that an incremental mailbox sync needs: log in, select a folder, list the
+// UIDs past a cursor and fetch whole messages by UID.
+//
+// A password is only ever sent over TLS, either from the first byte (port 993)
+// or after STARTTLS (port 143).
+//
+// It speaks one command at a time and is not safe for concurrent use.
+package imap
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateTimeLayout is the layout of an INTERNALDATE.
+const dateTimeLayout = "_2-Jan-2006 15:04:05 -0700"
+
+// StatusError is a NO or BAD completion of a command.
+type StatusError struct {
+	Command string
+	Status  string
+	Text    string
+}
+
+// Error implements [error.Error] interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("imap: %s: %s %s", e.Command, e.Status, e.Text)
+}
+
+// Mailbox is the state of a selected folder.
+type Mailbox struct {
+	Name        string
+	UIDValidity uint32
+	UIDNext     uint32
+	Exists      uint32
+}
+
+// Message is a fetched message.
+type Message struct {
+	UID          uint32
+	InternalDate time.Time
+
+	// Body is the whole RFC 5322 message.
+	Body []byte
+}
+
+// ErrInsecureLogin is returned by [Client.Login] on a connection that is not
+// encrypted, where the password would cross the network in the clear.
+var ErrInsecureLogin = errors.New("imap: refusing to log in over an unencrypted connection")
+
+// Client is a connection to an IMAP server.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+
+	// encrypted is whether conn is TLS, and caps the server's capabilities
+	// as last asked for (nil until then, and again after STARTTLS, since a
+	// server may announce different ones once encrypted).
+	encrypted bool
+	caps      []string
+
+	// Timeout, when set, bounds every command round trip.
+	Timeout time.Duration
+}
+
+// Dial connects to addr, over TLS when tlsConfig is not nil, and reads the
+// server greeting.
+func Dial(addr string, tlsConfig *tls.Config) (*Client, error) {
+	return DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, addr, tlsConfig)
+}
+
+// DialWithDialer is [Dial] through dialer, for a caller that needs a say in
+// where the connection goes (see [net.Dialer.Control]).
+func DialWithDialer(dialer *net.Dialer, addr string, tlsConfig *tls.Config) (*Client, error) {
+	var conn net.Conn
+	var err error
+
+	if tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewClient wraps an established connection and reads the server greeting.
+func NewClient(conn net.Conn) (*Client, error) {
+	_, encrypted := conn.(*tls.Conn)
+	c := &Client{conn: conn, r: bufio.NewReader(conn), encrypted: encrypted}
+
+	greeting, err := readResponse(c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(string(greeting), "* OK"), strings.HasPrefix(string(greeting), "* PREAUTH"):
+		return c, nil
+	default:
+		return nil, fmt.Errorf("imap: unexpected greeting %q", greeting)
+	}
+}
+
+// Close closes the connection without logging out.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Logout ends the session and closes the connection.
+func (c *Client) Logout() error {
+	_, err := c.execute("LOGOUT")
+
+	closeErr := c.conn.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
+
+// Capabilities returns the capabilities the server announces, upper-cased.
+func (c *Client) Capabilities() ([]string, error) {
+	if c.caps != nil {
+		return c.caps, nil
+	}
+
+	untagged, err := c.execute("CAPABILITY")
+	if err != nil {
+		return nil, err
+	}
+
+	caps := []string{}
+	for _, line := range untagged {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "CAPABILITY") {
+			continue
+		}
+		for _, f := range fields[1:] {
+			caps = append(caps, strings.ToUpper(f))
+		}
+	}
+	c.caps = caps
+
+	return caps, nil
+}
+
+// HasCapability reports whether the server announces name.
+func (c *Client) HasCapability(name string) (bool, error) {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(caps, strings.ToUpper(name)), nil
+}
+
+// StartTLS upgrades the connection to TLS (RFC 3501 6.2.1). The server must
+// announce STARTTLS; a server that does not is refused rather than talked to
+// in the clear.
+func (c *Client) StartTLS(tlsConfig *tls.Config) error {
+	if c.encrypted {
+		return errors.New("imap: the connection is already encrypted")
+	}
+
+	ok, err := c.HasCapability("STARTTLS")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("imap: the server does not offer STARTTLS")
+	}
+
+	if _, err := c.execute("STARTTLS"); err != nil {
+		return err
+	}
+
+	// anything the server sent after its OK was sent in the clear, where
+	// someone in the middle could have put it to be read as a TLS response
+	if c.r.Buffered() > 0 {
+		return errors.New("imap: unexpected data after the STARTTLS response")
+	}
+
+	conn := tls.Client(c.conn, tlsConfig)
+	if c.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(c.Timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.r = bufio.NewReader(conn)
+	c.encrypted = true
+	c.caps = nil
+
+	return nil
+}
+
+// Login authenticates with a plain user name and password (or app password).
+//
+// It refuses with [ErrInsecureLogin] unless the connection is encrypted, and
+// when the server announces LOGINDISABLED.
+func (c *Client) Login(username, password string) error {
+	if !c.encrypted {
+		return ErrInsecureLogin
+	}
+
+	disabled, err := c.HasCapability("LOGINDISABLED")
+	if err != nil {
+		return err
+	}
+	if disabled {
+		return errors.New("imap: the server does not accept LOGIN")
+	}
+
+	u, err := quote(username)
+	if err != nil {
+		return err
+	}
+	p, err := quote(password)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.execute("LOGIN " + u + " " + p)
+
+	return err
+}
+
+// Select opens name read-write, or read-only with EXAMINE when readOnly.
+func (c *Client) Select(name string, readOnly bool) (*Mailbox, error) {
+	n, err := quote(name)
+	if err != nil {
+		return nil, err
+	}
+
+	command := "SELECT "
+	if readOnly {
+		command = "EXAMINE "
+	}
+
+	untagged, err := c.execute(command + n)
+	if err != nil {
+		return nil, err
+	}
+
+	mailbox := &Mailbox{Name: name}
+	for _, line := range untagged {
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) >= 2 && strings.EqualFold(fields[1], "EXISTS"):
+			mailbox.Exists = parseUint32(fields[0])
+		case len(fields) >= 3 && fields[0] == "OK":
+			code := strings.TrimPrefix(fields[1], "[")
+			value := strings.TrimSuffix(fields[2], "]")
+
+			switch strings.ToUpper(code) {
+			case "UIDVALIDITY":
+				mailbox.UIDValidity = parseUint32(value)
+			case "UIDNEXT":
+				mailbox.UIDNext = parseUint32(value)
+			}
+		}
+	}
+
+	return mailbox, nil
+}
+
+// UIDSearch returns the UIDs matching the search criteria, for example
+// "UID 42:*", in ascending order.
+//
+// Note that the criteria are sent as is.
+func (c *Client) UIDSearch(criteria string) ([]uint32, error) {
+	if strings.ContainsAny(criteria, "\r\n") {
+		return nil, errors.New("imap: the search criteria must be a single line")
+	}
+
+	untagged, err := c.execute("UID SEARCH " + criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, line := range untagged {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "SEARCH") {
+			continue
+		}
+		for _, f := range fields[1:] {
+			if uid := parseUint32(f); uid > 0 {
+				uids = append(uids, uid)
+			}
+		}
+	}
+
+	return uids, nil
+}
+
+// UIDFetch fetches the whole messages of uids, without marking them seen.
+func (c *Client) UIDFetch(uids []uint32) ([]*Message, error) {
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+
+	untagged, err := c.execute("UID FETCH " + strings.Join(set, ",") + " (UID INTERNALDATE BODY.PEEK[])")
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]*Message, 0, len(untagged))
+	for _, line := range untagged {
+		values, err := parseList([]byte(line))
+		if err != nil {
+			return nil, err
+		}
+		if len(values) < 3 {
+			continue
+		}
+		if name, _ := values[1].(string); !strings.EqualFold(name, "FETCH") {
+			continue
+		}
+		items, _ := values[2].([]any)
+
+		message := &Message{}
+		for i := 0; i+1 < len(items); i += 2 {
+			name, _ := items[i].(string)
+
+			switch strings.ToUpper(name) {
+			case "UID":
+				s, _ := items[i+1].(string)
+				message.UID = parseUint32(s)
+			case "INTERNALDATE":
+				s, _ := items[i+1].(quoted)
+				message.InternalDate, _ = time.Parse(dateTimeLayout, string(s))
+			case "BODY[]":
+				switch body := items[i+1].(type) {
+				case []byte:
+					message.Body = append([]byte(nil), body...)
+				case quoted:
+					message.Body = []byte(body)
+				}
+			}
+		}
+
+		// a FETCH without a UID is an unsolicited flag update
+		if message.UID > 0 {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// Noop keeps the session alive.
+func (c *Client) Noop() error {
+	_, err := c.execute("NOOP")
+	return err
+}
+
+// execute sends one tagged command and collects the untagged responses up to
+// its completion, without their "* " prefix.
+func (c *Client) execute(command string) ([]string, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+
+	if c.Timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.Timeout))
+		defer c.conn.SetDeadline(time.Time{})
+	}
+
+	if _, err := io.WriteString(c.conn, tag+" "+command+"\r\n"); err != nil {
+		return nil, err
+	}
+
+	name, _, _ := strings.Cut(command, " ")
+	if name == "UID" {
+		name = command[:strings.IndexByte(command[4:], ' ')+4]
+	}
+
+	var untagged []string
+	for {
+		line, err := readResponse(c.r)
+		if err != nil {
+			return nil, err
+		}
+
+		s := string(line)
+		switch {
+		case strings.HasPrefix(s, "* "):
+			untagged = append(untagged, s[2:])
+		case strings.HasPrefix(s, tag+" "):
+			status, text, _ := strings.Cut(s[len(tag)+1:], " ")
+			if strings.EqualFold(status, "OK") {
+				return untagged, nil
+			}
+			return nil, &StatusError{Command: name, Status: strings.ToUpper(status), Text: text}
+		}
+		// continuation requests and other tags are not expected and ignored
+	}
+}
+
+// quote returns s as an IMAP quoted string.
+func quote(s string) (string, error) {
+	if strings.ContainsAny(s, "\r\n\x00") {
+		return "", errors.New("imap: an argument must not contain line breaks")
+	}
+
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	return `"` + s + `"`, nil
+}
+
+func parseUint32(s string) uint32 {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(n)
+}
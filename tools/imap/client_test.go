@@ -0,0 +1,148 @@
+package imap_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hanzoai/base/tools/imap"
+	"github.com/hanzoai/base/tools/imap/imaptest"
+)
+
+func TestClientSync(t *testing.T) {
+	t.Parallel()
+
+	server := imaptest.NewTLSServer()
+	defer server.Close()
+
+	server.AddUser("test@example.com", `pa"ss\word`)
+
+	date := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	server.Append("test@example.com", "INBOX", date, "Subject: one\r\n\r\nfirst body\r\n")
+	server.Append("test@example.com", "INBOX", date, "Subject: two\r\n\r\nsecond (body)\r\n")
+
+	c, err := imap.Dial(server.Addr, server.ClientTLSConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Login("test@example.com", `pa"ss\word`); err != nil {
+		t.Fatal(err)
+	}
+
+	mailbox, err := c.Select("INBOX", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mailbox.UIDValidity == 0 || mailbox.UIDNext != 3 || mailbox.Exists != 2 {
+		t.Fatalf("Unexpected mailbox %+v", mailbox)
+	}
+
+	uids, err := c.UIDSearch("UID 1:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uids) != 2 || uids[0] != 1 || uids[1] != 2 {
+		t.Fatalf("Expected UIDs [1 2], got %v", uids)
+	}
+
+	messages, err := c.UIDFetch(uids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(messages))
+	}
+	if messages[1].UID != 2 || !messages[1].InternalDate.Equal(date) {
+		t.Fatalf("Unexpected message %+v", messages[1])
+	}
+	if body := string(messages[1].Body); body != "Subject: two\r\n\r\nsecond (body)\r\n" {
+		t.Fatalf("Unexpected body %q", body)
+	}
+
+	if err := c.Noop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+
+	server := imaptest.NewServer()
+	defer server.Close()
+
+	server.AddUser("test@example.com", "secret")
+
+	c, err := imap.Dial(server.Addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// no password in the clear, even to a server that would take it
+	if err := c.Login("test@example.com", "secret"); !errors.Is(err, imap.ErrInsecureLogin) {
+		t.Fatalf("Expected a login in the clear to be refused, got %v", err)
+	}
+	if server.Logins() != 0 {
+		t.Fatalf("Expected no LOGIN to reach the server, got %d", server.Logins())
+	}
+
+	if err := c.StartTLS(server.ClientTLSConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StartTLS(server.ClientTLSConfig()); err == nil {
+		t.Fatal("Expected a second STARTTLS to be rejected")
+	}
+
+	err = c.Login("test@example.com", "wrong")
+	var statusErr *imap.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != "NO" || statusErr.Command != "LOGIN" {
+		t.Fatalf("Expected a LOGIN NO, got %v", err)
+	}
+
+	if err := c.Login("test@example.com", "line\r\nbreak"); err == nil {
+		t.Fatal("Expected an argument with a line break to be rejected")
+	}
+
+	if err := c.Login("test@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Select("Missing", false)
+	if !errors.As(err, &statusErr) || statusErr.Command != "SELECT" {
+		t.Fatalf("Expected a SELECT NO, got %v", err)
+	}
+
+	_, err = c.UIDSearch("UID 1:*")
+	if !errors.As(err, &statusErr) || statusErr.Command != "UID SEARCH" || statusErr.Status != "BAD" {
+		t.Fatalf("Expected a UID SEARCH BAD, got %v", err)
+	}
+
+	if _, err := c.UIDSearch("ALL\r\na2 LOGOUT"); err == nil || !strings.Contains(err.Error(), "single line") {
+		t.Fatalf("Expected multi line criteria to be rejected, got %v", err)
+	}
+}
+
+func TestClientStartTLSVerifiesTheServer(t *testing.T) {
+	t.Parallel()
+
+	server := imaptest.NewServer()
+	defer server.Close()
+
+	c, err := imap.Dial(server.Addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// a certificate nobody vouches for is no better than no TLS
+	if err := c.StartTLS(&tls.Config{ServerName: "127.0.0.1"}); err == nil {
+		t.Fatal("Expected an untrusted certificate to be rejected")
+	}
+}
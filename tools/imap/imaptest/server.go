@@ -0,0 +1,500 @@
+// Package imaptest provides an in-process IMAP server for tests, the way
+// net/http/httptest provides an HTTP one.
+//
+// It keeps its mailboxes in memory and answers only what the [imap.Client]
+// asks: CAPABILITY, STARTTLS, LOGIN, SELECT, EXAMINE, UID SEARCH UID, UID
+// FETCH, NOOP and LOGOUT. Like a real server it refuses LOGIN, and announces
+// LOGINDISABLED, until the connection is encrypted, with a certificate of its
+// own that [Server.ClientTLSConfig] trusts.
+package imaptest
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a running test IMAP server.
+type Server struct {
+	// Addr is the "host:port" the server listens on.
+	Addr string
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+	cert      *x509.Certificate
+	wg        sync.WaitGroup
+
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+	users     map[string]*user
+	logins    int
+	nextValid uint32
+}
+
+type user struct {
+	password  string
+	mailboxes map[string]*mailbox
+}
+
+type mailbox struct {
+	uidValidity uint32
+	uidNext     uint32
+	messages    []*message
+}
+
+type message struct {
+	uid  uint32
+	date time.Time
+	body []byte
+}
+
+// NewServer starts a server on a loopback port that offers STARTTLS. Close it
+// when done.
+func NewServer() *Server {
+	return newServer(false)
+}
+
+// NewTLSServer starts a server on a loopback port that speaks TLS from the
+// first byte, as on port 993. Close it when done.
+func NewTLSServer() *Server {
+	return newServer(true)
+}
+
+func newServer(implicitTLS bool) *Server {
+	tlsConfig, cert := newCertificate()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("imaptest: failed to listen: %v", err))
+	}
+	if implicitTLS {
+		l = tls.NewListener(l, tlsConfig)
+	}
+
+	s := &Server{
+		Addr:      l.Addr().String(),
+		listener:  l,
+		tlsConfig: tlsConfig,
+		cert:      cert,
+		conns:     map[net.Conn]struct{}{},
+		users:     map[string]*user{},
+		nextValid: 1,
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s
+}
+
+// ClientTLSConfig returns a client config that trusts the server's
+// certificate, which is valid for 127.0.0.1 and localhost.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.cert)
+
+	return &tls.Config{RootCAs: pool, ServerName: "127.0.0.1", MinVersion: tls.VersionTLS12}
+}
+
+// newCertificate returns a server config with a fresh self-signed certificate
+// for the loopback address, and the certificate.
+func newCertificate() (*tls.Config, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("imaptest: failed to generate a key: %v", err))
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"imaptest"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:              []string{"localhost"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		panic(fmt.Sprintf("imaptest: failed to create a certificate: %v", err))
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(fmt.Sprintf("imaptest: failed to parse the certificate: %v", err))
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	return config, cert
+}
+
+// Close stops the server, drops its open connections and waits for them to
+// end.
+func (s *Server) Close() {
+	s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+}
+
+// AddUser adds an account with an empty INBOX.
+func (s *Server) AddUser(username, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[username] = &user{password: password, mailboxes: map[string]*mailbox{}}
+	s.mailboxLocked(username, "INBOX")
+}
+
+// Append adds a message to a user's mailbox, creating the mailbox if needed,
+// and returns its UID.
+func (s *Server) Append(username, mailboxName string, date time.Time, body string) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mb := s.mailboxLocked(username, mailboxName)
+	uid := mb.uidNext
+	mb.uidNext++
+	mb.messages = append(mb.messages, &message{uid: uid, date: date, body: []byte(body)})
+
+	return uid
+}
+
+// ResetUIDValidity renumbers a mailbox under a new UIDVALIDITY, as a server
+// does when it rebuilds its index, which invalidates every client cursor.
+func (s *Server) ResetUIDValidity(username, mailboxName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mb := s.mailboxLocked(username, mailboxName)
+	mb.uidValidity = s.nextValid
+	s.nextValid++
+	mb.uidNext = 1
+	for _, m := range mb.messages {
+		m.uid = mb.uidNext
+		mb.uidNext++
+	}
+}
+
+// Logins returns the number of LOGIN commands so far, refused or not.
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.logins
+}
+
+func (s *Server) mailboxLocked(username, name string) *mailbox {
+	u := s.users[username]
+	if u == nil {
+		u = &user{mailboxes: map[string]*mailbox{}}
+		s.users[username] = u
+	}
+
+	mb := u.mailboxes[name]
+	if mb == nil {
+		mb = &mailbox{uidValidity: s.nextValid, uidNext: 1}
+		s.nextValid++
+		u.mailboxes[name] = mb
+	}
+
+	return mb
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+type session struct {
+	encrypted bool
+	username  string
+	selected  string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	reply := func(format string, args ...any) {
+		fmt.Fprintf(w, format+"\r\n", args...)
+	}
+
+	reply("* OK imaptest ready")
+	w.Flush()
+
+	_, encrypted := conn.(*tls.Conn)
+	sess := &session{encrypted: encrypted}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		args := splitArgs(strings.TrimRight(line, "\r\n"))
+		if len(args) < 2 {
+			reply("* BAD missing command")
+			w.Flush()
+			continue
+		}
+
+		tag, command := args[0], strings.ToUpper(args[1])
+		if command == "UID" && len(args) > 2 {
+			command += " " + strings.ToUpper(args[2])
+			args = args[1:]
+		}
+		args = args[2:]
+
+		// the upgrade swaps the connection under the reader and writer, so
+		// it is handled here rather than in execute
+		if command == "STARTTLS" {
+			if sess.encrypted {
+				reply("%s BAD already encrypted", tag)
+				w.Flush()
+				continue
+			}
+			reply("%s OK begin TLS negotiation now", tag)
+			w.Flush()
+
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			r = bufio.NewReader(tlsConn)
+			w = bufio.NewWriter(tlsConn)
+			sess.encrypted = true
+			continue
+		}
+
+		logout := s.execute(sess, tag, command, args, reply)
+		w.Flush()
+		if logout {
+			return
+		}
+	}
+}
+
+func (s *Server) execute(sess *session, tag, command string, args []string, reply func(string, ...any)) (logout bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if command != "CAPABILITY" && command != "LOGIN" && command != "NOOP" && command != "LOGOUT" && sess.username == "" {
+		reply("%s NO not authenticated", tag)
+		return false
+	}
+
+	switch command {
+	case "CAPABILITY":
+		if sess.encrypted {
+			reply("* CAPABILITY IMAP4rev1 AUTH=PLAIN")
+		} else {
+			reply("* CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED")
+		}
+		reply("%s OK CAPABILITY completed", tag)
+	case "NOOP":
+		reply("%s OK NOOP completed", tag)
+	case "LOGOUT":
+		reply("* BYE imaptest logging out")
+		reply("%s OK LOGOUT completed", tag)
+		return true
+	case "LOGIN":
+		if !sess.encrypted {
+			reply("%s BAD [PRIVACYREQUIRED] LOGIN needs TLS", tag)
+			return false
+		}
+		s.logins++
+		u := s.users[arg(args, 0)]
+		if len(args) != 2 || u == nil || u.password != args[1] {
+			reply("%s NO [AUTHENTICATIONFAILED] invalid credentials", tag)
+			return false
+		}
+		sess.username = args[0]
+		reply("%s OK LOGIN completed", tag)
+	case "SELECT", "EXAMINE":
+		mb := s.users[sess.username].mailboxes[arg(args, 0)]
+		if mb == nil {
+			reply("%s NO no such mailbox", tag)
+			return false
+		}
+		sess.selected = args[0]
+		reply("* %d EXISTS", len(mb.messages))
+		reply("* OK [UIDVALIDITY %d] UIDs valid", mb.uidValidity)
+		reply("* OK [UIDNEXT %d] predicted next UID", mb.uidNext)
+		reply("%s OK [READ-WRITE] %s completed", tag, command)
+	case "UID SEARCH":
+		mb := s.users[sess.username].mailboxes[sess.selected]
+		if mb == nil {
+			reply("%s BAD no mailbox selected", tag)
+			return false
+		}
+		if len(args) != 2 || !strings.EqualFold(args[0], "UID") {
+			reply("%s BAD only UID ranges are supported", tag)
+			return false
+		}
+		from, to, ok := parseRange(args[1], mb.uidNext)
+		if !ok {
+			reply("%s BAD invalid range", tag)
+			return false
+		}
+		var uids []string
+		for _, m := range mb.messages {
+			if m.uid >= from && m.uid <= to {
+				uids = append(uids, strconv.FormatUint(uint64(m.uid), 10))
+			}
+		}
+		reply("* SEARCH %s", strings.Join(uids, " "))
+		reply("%s OK SEARCH completed", tag)
+	case "UID FETCH":
+		mb := s.users[sess.username].mailboxes[sess.selected]
+		if mb == nil {
+			reply("%s BAD no mailbox selected", tag)
+			return false
+		}
+		var wanted []uint32
+		for _, part := range strings.Split(arg(args, 0), ",") {
+			from, to, ok := parseRange(part, mb.uidNext)
+			if !ok {
+				reply("%s BAD invalid sequence set", tag)
+				return false
+			}
+			for _, m := range mb.messages {
+				if m.uid >= from && m.uid <= to && !slices.Contains(wanted, m.uid) {
+					wanted = append(wanted, m.uid)
+				}
+			}
+		}
+		for i, m := range mb.messages {
+			if !slices.Contains(wanted, m.uid) {
+				continue
+			}
+			reply("* %d FETCH (UID %d INTERNALDATE \"%s\" BODY[] {%d}\r\n%s)",
+				i+1, m.uid, m.date.Format("02-Jan-2006 15:04:05 -0700"), len(m.body), m.body)
+		}
+		reply("%s OK FETCH completed", tag)
+	default:
+		reply("%s BAD unknown command", tag)
+	}
+
+	return false
+}
+
+// parseRange parses "n", "n:m" or "n:*" where "*" is the last UID.
+func parseRange(s string, uidNext uint32) (from, to uint32, ok bool) {
+	parse := func(v string) (uint32, bool) {
+		if v == "*" {
+			return max(uidNext, 2) - 1, true
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		return uint32(n), err == nil
+	}
+
+	a, b, isRange := strings.Cut(s, ":")
+	if from, ok = parse(a); !ok {
+		return 0, 0, false
+	}
+	if !isRange {
+		return from, from, true
+	}
+	if to, ok = parse(b); !ok {
+		return 0, 0, false
+	}
+
+	// "n:m" is the same set as "m:n"
+	return min(from, to), max(from, to), true
+}
+
+// splitArgs splits a command line on spaces, unquoting quoted strings and
+// keeping parenthesized lists whole.
+func splitArgs(line string) []string {
+	var args []string
+	var buf strings.Builder
+	var inQuote bool
+	var depth int
+
+	flush := func() {
+		if buf.Len() > 0 {
+			args = append(args, buf.String())
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(line):
+			i++
+			buf.WriteByte(line[i])
+		case c == '"':
+			inQuote = !inQuote
+			if !inQuote {
+				args = append(args, buf.String())
+				buf.Reset()
+			}
+		case !inQuote && c == '(':
+			depth++
+			buf.WriteByte(c)
+		case !inQuote && c == ')':
+			depth--
+			buf.WriteByte(c)
+		case !inQuote && depth == 0 && c == ' ':
+			flush()
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	flush()
+
+	return args
+}
+
+func arg(args []string, i int) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return ""
+}
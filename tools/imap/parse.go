@@ -0,0 +1,199 @@
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxLiteral bounds a single literal a server may send, so that a broken or
+// hostile server cannot make the client allocate without limit.
+const maxLiteral = 64 << 20
+
+// quoted is a quoted string of a response, told apart from an atom.
+type quoted string
+
+// readResponse reads one whole response line, with the literals it announces
+// inlined after their "{n}\r\n" marker.
+func readResponse(r *bufio.Reader) ([]byte, error) {
+	var out []byte
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, line...)
+
+		n, ok := literalSize(line)
+		if !ok {
+			return bytes.TrimRight(out, "\r\n"), nil
+		}
+		if n > maxLiteral {
+			return nil, fmt.Errorf("imap: a literal of %d bytes is too large", n)
+		}
+
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(r, literal); err != nil {
+			return nil, err
+		}
+		out = append(out, literal...)
+	}
+}
+
+// literalSize reports the size of the literal line announces at its end.
+func literalSize(line []byte) (int, bool) {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) < 3 || line[len(line)-1] != '}' {
+		return 0, false
+	}
+
+	open := bytes.LastIndexByte(line, '{')
+	if open < 0 {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(string(line[open+1 : len(line)-1]))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+
+	return n, true
+}
+
+// parseList parses the values of a response from its start: atoms as string,
+// quoted strings as [quoted], literals as []byte and parenthesized lists as
+// []any.
+func parseList(b []byte) ([]any, error) {
+	p := &parser{b: b}
+
+	values, err := p.values(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.b) {
+		return nil, errors.New("imap: unbalanced parentheses")
+	}
+
+	return values, nil
+}
+
+type parser struct {
+	b []byte
+	i int
+}
+
+func (p *parser) values(depth int) ([]any, error) {
+	values := []any{}
+
+	for p.i < len(p.b) {
+		switch c := p.b[p.i]; c {
+		case ' ', '\r', '\n':
+			p.i++
+		case '(':
+			p.i++
+			list, err := p.values(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, list)
+		case ')':
+			if depth == 0 {
+				return values, nil
+			}
+			p.i++
+			return values, nil
+		case '"':
+			s, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		case '{':
+			literal, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, literal)
+		default:
+			values = append(values, p.atom())
+		}
+	}
+
+	if depth > 0 {
+		return nil, errors.New("imap: unterminated list")
+	}
+
+	return values, nil
+}
+
+func (p *parser) quoted() (quoted, error) {
+	var buf []byte
+
+	for p.i++; p.i < len(p.b); p.i++ {
+		switch c := p.b[p.i]; c {
+		case '\\':
+			p.i++
+			if p.i < len(p.b) {
+				buf = append(buf, p.b[p.i])
+			}
+		case '"':
+			p.i++
+			return quoted(buf), nil
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return "", errors.New("imap: unterminated quoted string")
+}
+
+func (p *parser) literal() ([]byte, error) {
+	end := bytes.IndexByte(p.b[p.i:], '}')
+	if end < 0 {
+		return nil, errors.New("imap: malformed literal")
+	}
+
+	n, err := strconv.Atoi(string(p.b[p.i+1 : p.i+end]))
+	if err != nil || n < 0 {
+		return nil, errors.New("imap: malformed literal size")
+	}
+
+	p.i += end + 1
+	if bytes.HasPrefix(p.b[p.i:], []byte("\r\n")) {
+		p.i += 2
+	}
+	if p.i+n > len(p.b) {
+		return nil, errors.New("imap: short literal")
+	}
+
+	literal := p.b[p.i : p.i+n]
+	p.i += n
+
+	return literal, nil
+}
+
+// atom reads up to the next space or parenthesis, keeping a bracketed section
+// such as "BODY[HEADER.FIELDS (DATE)]" whole.
+func (p *parser) atom() string {
+	start := p.i
+	brackets := 0
+
+	for ; p.i < len(p.b); p.i++ {
+		switch p.b[p.i] {
+		case '[':
+			brackets++
+		case ']':
+			brackets--
+		case ' ', '(', ')', '\r', '\n':
+			if brackets <= 0 {
+				return string(p.b[start:p.i])
+			}
+		}
+	}
+
+	return string(p.b[start:p.i])
+}
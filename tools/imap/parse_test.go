@@ -0,0 +1,61 @@
+package imap
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadResponse(t *testing.T) {
+	t.Parallel()
+
+	r := bufio.NewReader(strings.NewReader("* 1 FETCH (BODY[] {5}\r\nab\r\nc)\r\na1 OK done\r\n"))
+
+	first, err := readResponse(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != "* 1 FETCH (BODY[] {5}\r\nab\r\nc)" {
+		t.Fatalf("Unexpected first response %q", first)
+	}
+
+	second, err := readResponse(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(second) != "a1 OK done" {
+		t.Fatalf("Unexpected second response %q", second)
+	}
+}
+
+func TestParseList(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		input    string
+		expected []any
+		hasErr   bool
+	}{
+		{"", []any{}, false},
+		{"1 FETCH (UID 7)", []any{"1", "FETCH", []any{"UID", "7"}}, false},
+		{`a "b \"c\" \\d" (e (f))`, []any{"a", quoted(`b "c" \d`), []any{"e", []any{"f"}}}, false},
+		{"BODY[HEADER.FIELDS (DATE)] {3}\r\nx)y", []any{"BODY[HEADER.FIELDS (DATE)]", []byte("x)y")}, false},
+		{"(a", nil, true},
+		{`"a`, nil, true},
+		{"{9}\r\nshort", nil, true},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.input, func(t *testing.T) {
+			values, err := parseList([]byte(s.input))
+
+			if hasErr := err != nil; hasErr != s.hasErr {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.hasErr, hasErr, err)
+			}
+			if !s.hasErr && !reflect.DeepEqual(values, s.expected) {
+				t.Fatalf("Expected %#v, got %#v", s.expected, values)
+			}
+		})
+	}
+}
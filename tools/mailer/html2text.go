@@ -20,6 +20,12 @@ var inlineTags = []string{
 	"sub", "sup", "em", "b", "u", "i",
 }
 
+// HTMLToText converts an HTML mail body into the plain text the mailer sends
+// as its text alternative, with the same caveats as html2Text.
+func HTMLToText(htmlDocument string) (string, error) {
+	return html2Text(htmlDocument)
+}
+
 // Very rudimentary auto HTML to Text mail body converter.
 //
 // Caveats:
@@ -31,32 +31,15 @@ type FilterData string
 // (initialized with some preallocated empty data map)
 var parsedFilterData = store.New(make(map[string][]fexpr.ExprGroup, 50))
 
-// BuildExpr parses the current filter data and returns a new db WHERE expression.
-//
-// The filter string can also contain dbx placeholder parameters (eg. "title = {:name}"),
-// that will be safely replaced and properly quoted inplace with the placeholderReplacements values.
-//
-// The parsed expressions are limited up to DefaultFilterExprLimit.
-// Use [FilterData.BuildExprWithLimit] if you want to set a custom limit.
-func (f FilterData) BuildExpr(
-	fieldResolver FieldResolver,
-	placeholderReplacements ...query.Params,
-) (query.Expression, error) {
-	return f.BuildExprWithLimit(fieldResolver, DefaultFilterExprLimit, placeholderReplacements...)
-}
-
-// BuildExpr parses the current filter data and returns a new db WHERE expression.
+// Bind returns the filter with its dbx placeholder parameters (eg. "title = {:name}")
+// replaced inplace with the safely quoted placeholderReplacements values,
+// the way [FilterData.BuildExpr] replaces them.
 //
-// The filter string can also contain dbx placeholder parameters (eg. "title = {:name}"),
-// that will be safely replaced and properly quoted inplace with the placeholderReplacements values.
-func (f FilterData) BuildExprWithLimit(
-	fieldResolver FieldResolver,
-	maxExpressions int,
-	placeholderReplacements ...query.Params,
-) (query.Expression, error) {
+// It is for a filter that has to travel as a string (eg. as a ?filter= query
+// parameter) rather than be built right away.
+func (f FilterData) Bind(placeholderReplacements ...query.Params) FilterData {
 	raw := string(f)
 
-	// replace the placeholder params in the raw string filter
 	for _, p := range placeholderReplacements {
 		for key, value := range p {
 			var replacement string
@@ -80,6 +63,34 @@ func (f FilterData) BuildExprWithLimit(
 		}
 	}
 
+	return FilterData(raw)
+}
+
+// BuildExpr parses the current filter data and returns a new db WHERE expression.
+//
+// The filter string can also contain dbx placeholder parameters (eg. "title = {:name}"),
+// that will be safely replaced and properly quoted inplace with the placeholderReplacements values.
+//
+// The parsed expressions are limited up to DefaultFilterExprLimit.
+// Use [FilterData.BuildExprWithLimit] if you want to set a custom limit.
+func (f FilterData) BuildExpr(
+	fieldResolver FieldResolver,
+	placeholderReplacements ...query.Params,
+) (query.Expression, error) {
+	return f.BuildExprWithLimit(fieldResolver, DefaultFilterExprLimit, placeholderReplacements...)
+}
+
+// BuildExpr parses the current filter data and returns a new db WHERE expression.
+//
+// The filter string can also contain dbx placeholder parameters (eg. "title = {:name}"),
+// that will be safely replaced and properly quoted inplace with the placeholderReplacements values.
+func (f FilterData) BuildExprWithLimit(
+	fieldResolver FieldResolver,
+	maxExpressions int,
+	placeholderReplacements ...query.Params,
+) (query.Expression, error) {
+	raw := string(f.Bind(placeholderReplacements...))
+
 	cacheKey := raw + "/" + strconv.Itoa(maxExpressions)
 
 	if data, ok := parsedFilterData.GetOk(cacheKey); ok {
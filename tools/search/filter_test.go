@@ -322,6 +322,18 @@ func TestFilterDataBuildExprWithParams(t *testing.T) {
 	}
 }
 
+func TestFilterDataBind(t *testing.T) {
+	filter := search.FilterData(`a = {:a} && b = {:b} && c = {:c} && d != {:d}`).Bind(
+		query.Params{"a": "x\"y", "b": 12.5},
+		query.Params{"c": nil, "d": true},
+	)
+
+	expected := `a = "x\"y" && b = 12.5 && c = null && d != true`
+	if string(filter) != expected {
+		t.Fatalf("Expected \n%s, \ngot \n%s", expected, filter)
+	}
+}
+
 func TestFilterDataBuildExprWithLimit(t *testing.T) {
 	resolver := search.NewSimpleFieldResolver(dialect.For("sqlite"), `^\w+$`)
 
@@ -69,6 +69,7 @@ type Provider struct {
 	filter             []FilterData
 	page               int
 	perPage            int
+	offset             int
 	skipTotal          bool
 	maxFilterExprLimit int
 	maxSortExprLimit   int
@@ -149,6 +150,17 @@ func (s *Provider) PerPage(perPage int) *Provider {
 	return s
 }
 
+// Offset sets an explicit number of items to skip, overriding the
+// one derived from `page` (0 falls back to the page).
+//
+// It is meant for callers that address a window by its start rather than by
+// page and so may start it off a page boundary. The reported result page is
+// the one the window starts in.
+func (s *Provider) Offset(offset int) *Provider {
+	s.offset = offset
+	return s
+}
+
 // Sort sets the `sort` field of the current search provider.
 func (s *Provider) Sort(sort []SortField) *Provider {
 	s.sort = sort
@@ -290,6 +302,12 @@ func (s *Provider) Exec(items any) (*Result, error) {
 		s.perPage = MaxPerPage
 	}
 
+	offset := s.perPage * (s.page - 1)
+	if s.offset > 0 {
+		offset = s.offset
+		s.page = s.offset/s.perPage + 1
+	}
+
 	// negative value to differentiate from the zero default
 	totalCount := -1
 	totalPages := -1
@@ -328,7 +346,7 @@ func (s *Provider) Exec(items any) (*Result, error) {
 	// apply pagination to the original query and fetch the models
 	modelsExec := func() error {
 		modelsQuery.Limit(int64(s.perPage))
-		modelsQuery.Offset(int64(s.perPage * (s.page - 1)))
+		modelsQuery.Offset(int64(offset))
 
 		return modelsQuery.All(items)
 	}
@@ -132,6 +132,43 @@ func TestProviderPerPage(t *testing.T) {
 	}
 }
 
+func TestProviderOffset(t *testing.T) {
+	testDB, err := createTestDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer testDB.Close()
+
+	p := NewProvider(&testFieldResolver{}).
+		Query(testDB.Select("*").From("test").OrderBy("test1 ASC")).
+		Page(5).
+		PerPage(1).
+		Offset(1).
+		SkipTotal(true)
+
+	if p.offset != 1 {
+		t.Fatalf("Expected offset %v, got %v", 1, p.offset)
+	}
+
+	testDB.CalledQueries = []string{} // reset
+
+	result, err := p.Exec(&[]testTableStruct{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, _ := json.Marshal(result)
+	expectedResult := `{"items":[{"test1":2,"test2":"test2.2","test3":""}],"page":2,"perPage":1,"totalItems":-1,"totalPages":-1}`
+	if string(encoded) != expectedResult {
+		t.Fatalf("Expected result %v, got \n%v", expectedResult, string(encoded))
+	}
+
+	expectedQuery := "SELECT * FROM `test` ORDER BY `test1` ASC LIMIT 1 OFFSET 1"
+	if len(testDB.CalledQueries) != 1 || testDB.CalledQueries[0] != expectedQuery {
+		t.Fatalf("Expected query %q, got %v", expectedQuery, testDB.CalledQueries)
+	}
+}
+
 func TestProviderSort(t *testing.T) {
 	initialSort := []SortField{{"test1", SortAsc}, {"test2", SortAsc}}
 	r := &testFieldResolver{}
@@ -52,6 +52,18 @@ type ResolverResult struct {
 	// It is called with the built comparison and never with nil, so an
 	// implementation that wraps its argument may rely on having one.
 	AfterBuild func(expr query.Expression) query.Expression
+
+	// FullText is set when the identifier is a field indexed for full-text
+	// search, and resolves the fts() function for it: called with the
+	// resolved search query, it returns a boolean expression that is true for
+	// the rows whose field matches the query.
+	FullText func(query *ResolverResult) (*ResolverResult, error)
+
+	// VectorDistance is set when the identifier is a vector field, and
+	// resolves the vectorDistance() function for it: called with the
+	// resolved query vector, it returns a numeric expression of how far
+	// a row's field value is from it.
+	VectorDistance func(query *ResolverResult) (*ResolverResult, error)
 }
 
 // FieldResolver defines an interface for managing search fields.
@@ -3,11 +3,14 @@ package search
 import (
 	"fmt"
 	"strings"
+
+	"github.com/ganigeorgiev/fexpr"
 )
 
 const (
 	randomSortKey string = "@random"
 	rowidSortKey  string = "@rowid"
+	rankSortKey   string = "@rank"
 )
 
 // sort field directions
@@ -16,6 +19,16 @@ const (
 	SortDesc string = "DESC"
 )
 
+// Ranker is implemented by the field resolvers that could order
+// the full-text search results by relevance (see the "@rank" sort).
+type Ranker interface {
+	// Rank returns an expression of how relevant a row is to the
+	// full-text searches of the resolved filter, higher being more relevant.
+	//
+	// It returns an error if the filter has no full-text search.
+	Rank() (string, error)
+}
+
 // SortField defines a single search sort field.
 type SortField struct {
 	Name      string `json:"name"`
@@ -36,6 +49,35 @@ func (s *SortField) BuildExpr(fieldResolver FieldResolver) (string, error) {
 		}
 	}
 
+	// special case for the full-text search relevance
+	if s.Name == rankSortKey {
+		ranker, ok := fieldResolver.(Ranker)
+		if !ok {
+			return "", fmt.Errorf("invalid sort field %q", s.Name)
+		}
+
+		rank, err := ranker.Rank()
+		if err != nil {
+			return "", fmt.Errorf("invalid sort field %q - %w", s.Name, err)
+		}
+
+		return fmt.Sprintf("%s %s", rank, s.Direction), nil
+	}
+
+	// special case for the filter functions, eg. vectorDistance(embedding, @request.query.q)
+	if token, ok := functionToken(s.Name); ok {
+		result, err := resolveToken(token, fieldResolver)
+		if err != nil {
+			return "", fmt.Errorf("invalid sort field %q - %w", s.Name, err)
+		}
+
+		if len(result.Params) > 0 || result.Identifier == "" {
+			return "", fmt.Errorf("invalid sort field %q - the function result must not depend on bound values", s.Name)
+		}
+
+		return fmt.Sprintf("%s %s", result.Identifier, s.Direction), nil
+	}
+
 	result, err := fieldResolver.Resolve(s.Name)
 
 	// invalidate empty fields and non-column identifiers
@@ -53,7 +95,7 @@ func (s *SortField) BuildExpr(fieldResolver FieldResolver) (string, error) {
 //
 //	fields := search.ParseSortFromString("-name,+created")
 func ParseSortFromString(str string) (fields []SortField) {
-	data := strings.Split(str, ",")
+	data := splitSortExpr(str)
 
 	for _, field := range data {
 		// trim whitespaces
@@ -67,3 +109,60 @@ func ParseSortFromString(str string) (fields []SortField) {
 
 	return
 }
+
+// functionToken returns the function call token of a sort field name
+// (ok is false if the name is anything else than a single function call).
+func functionToken(name string) (token fexpr.Token, ok bool) {
+	if !strings.Contains(name, "(") {
+		return token, false
+	}
+
+	scanner := fexpr.NewScanner([]byte(name))
+
+	token, err := scanner.Scan()
+	if err != nil || token.Type != fexpr.TokenFunction {
+		return token, false
+	}
+
+	next, err := scanner.Scan()
+	if err != nil || next.Type != fexpr.TokenEOF {
+		return token, false
+	}
+
+	return token, true
+}
+
+// splitSortExpr splits a sort string on the commas that aren't
+// part of a function call arguments or a quoted string.
+func splitSortExpr(str string) []string {
+	var result []string
+
+	var start, depth int
+	var quote rune
+	var escaped bool
+	for i, ch := range str {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if ch == '\\' {
+				escaped = true
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+		case ch == ',' && depth == 0:
+			result = append(result, str[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(result, str[start:])
+}
@@ -2,6 +2,7 @@ package search_test
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/hanzoai/orm/dialect"
 	"testing"
@@ -33,6 +34,20 @@ func TestSortFieldBuildExpr(t *testing.T) {
 		{search.SortField{"@random", search.SortDesc}, false, "RANDOM()"},
 		// special _rowid_ field
 		{search.SortField{"@rowid", search.SortDesc}, false, "[[_rowid_]] DESC"},
+		// special @rank field (the resolver is not a search.Ranker)
+		{search.SortField{"@rank", search.SortDesc}, true, ""},
+		// unknown function
+		{search.SortField{"unknown(test1)", search.SortAsc}, true, ""},
+		// function with bound values
+		{search.SortField{"strftime('%Y', test1)", search.SortAsc}, true, ""},
+		// function followed by something else
+		{search.SortField{"geoDistance(test1, test2, test3, test1) test1", search.SortAsc}, true, ""},
+		// function
+		{
+			search.SortField{"geoDistance(test1, test2, test3, test1)", search.SortDesc},
+			false,
+			"(6371 * acos(cos(radians([[test2]])) * cos(radians([[test1]])) * cos(radians([[test3]]) - radians([[test1]])) + sin(radians([[test2]])) * sin(radians([[test1]])))) DESC",
+		},
 	}
 
 	for _, s := range scenarios {
@@ -51,6 +66,51 @@ func TestSortFieldBuildExpr(t *testing.T) {
 	}
 }
 
+type testRanker struct {
+	*search.SimpleFieldResolver
+	rank string
+}
+
+func (r *testRanker) Rank() (string, error) {
+	if r.rank == "" {
+		return "", errors.New("no rank")
+	}
+	return r.rank, nil
+}
+
+func TestSortFieldBuildExprRank(t *testing.T) {
+	scenarios := []struct {
+		name             string
+		rank             string
+		direction        string
+		expectError      bool
+		expectExpression string
+	}{
+		{"no rank", "", search.SortDesc, true, ""},
+		{"desc", "[[r.rank]]", search.SortDesc, false, "[[r.rank]] DESC"},
+		{"asc", "[[r.rank]]", search.SortAsc, false, "[[r.rank]] ASC"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			resolver := &testRanker{search.NewSimpleFieldResolver(dialect.For("sqlite"), "test1"), s.rank}
+
+			sortField := search.SortField{Name: "@rank", Direction: s.direction}
+
+			result, err := sortField.BuildExpr(resolver)
+
+			hasErr := err != nil
+			if hasErr != s.expectError {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if result != s.expectExpression {
+				t.Fatalf("Expected expression %v, got %v", s.expectExpression, result)
+			}
+		})
+	}
+}
+
 func TestParseSortFromString(t *testing.T) {
 	scenarios := []struct {
 		value    string
@@ -63,6 +123,10 @@ func TestParseSortFromString(t *testing.T) {
 		{"test1,-test2,+test3", `[{"name":"test1","direction":"ASC"},{"name":"test2","direction":"DESC"},{"name":"test3","direction":"ASC"}]`},
 		{"@random,-test", `[{"name":"@random","direction":"ASC"},{"name":"test","direction":"DESC"}]`},
 		{"-@rowid,-test", `[{"name":"@rowid","direction":"DESC"},{"name":"test","direction":"DESC"}]`},
+		{"-@rank,test", `[{"name":"@rank","direction":"DESC"},{"name":"test","direction":"ASC"}]`},
+		{"-fn(a, 'b,)'),test", `[{"name":"fn(a, 'b,)')","direction":"DESC"},{"name":"test","direction":"ASC"}]`},
+		{"fn(a, g(b, c)), -test", `[{"name":"fn(a, g(b, c))","direction":"ASC"},{"name":"test","direction":"DESC"}]`},
+		{`fn("a\",b"),test`, `[{"name":"fn(\"a\\\",b\")","direction":"ASC"},{"name":"test","direction":"ASC"}]`},
 	}
 
 	for _, s := range scenarios {
@@ -62,6 +62,98 @@ var TokenFunctions = map[string]func(
 		}, nil
 	},
 
+	// fts(field, query) checks whether the field matches a full-text search
+	// query, eg. `fts(title, 'quick fox') = true`.
+	//
+	// The field must be an identifier the resolver indexes for full-text search
+	// (it is an error otherwise) and the query must be a string literal or an
+	// identifier that resolves to one (eg. `@request.query.q`).
+	//
+	// The query is plain text and every word of it has to be found in the field,
+	// in any order and case. How the text is split into words is left to the
+	// engine's full-text index, so punctuation and stemming may differ between dialects.
+	//
+	// The matching rows could be ordered by relevance with the "@rank" sort.
+	"fts": func(d dialect.Dialect, argTokenResolverFunc func(fexpr.Token) (*ResolverResult, error), args ...fexpr.Token) (*ResolverResult, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("[fts] expected 2 arguments, got %d", len(args))
+		}
+
+		if args[0].Type != fexpr.TokenIdentifier {
+			return nil, errors.New("[fts] expects the first argument to be a field identifier")
+		}
+
+		if args[1].Type != fexpr.TokenText && args[1].Type != fexpr.TokenIdentifier {
+			return nil, errors.New("[fts] expects the second argument to be a string or an identifier")
+		}
+
+		field, err := argTokenResolverFunc(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("[fts] failed to resolve field argument: %w", err)
+		}
+
+		if field.FullText == nil {
+			return nil, fmt.Errorf("[fts] %q is not indexed for full-text search", args[0].Literal)
+		}
+
+		query, err := argTokenResolverFunc(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("[fts] failed to resolve query argument: %w", err)
+		}
+
+		result, err := field.FullText(query)
+		if err != nil {
+			return nil, fmt.Errorf("[fts] %w", err)
+		}
+
+		return result, nil
+	},
+
+	// vectorDistance(field, query) returns the distance between a vector
+	// field and a query vector, the smaller the nearer, eg. the sort
+	// `vectorDistance(embedding, @request.query.q)` with `q=[0.1,0.2,...]`.
+	//
+	// The field must be an identifier the resolver has vector distances for
+	// (it is an error otherwise) and the query must be a string literal or an
+	// identifier that resolves to one, holding a json array of numbers.
+	//
+	// How the distance is measured (and how many of the nearest rows have one)
+	// is up to the resolver; the rows it has no distance for are the farthest.
+	"vectorDistance": func(d dialect.Dialect, argTokenResolverFunc func(fexpr.Token) (*ResolverResult, error), args ...fexpr.Token) (*ResolverResult, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("[vectorDistance] expected 2 arguments, got %d", len(args))
+		}
+
+		if args[0].Type != fexpr.TokenIdentifier {
+			return nil, errors.New("[vectorDistance] expects the first argument to be a field identifier")
+		}
+
+		if args[1].Type != fexpr.TokenText && args[1].Type != fexpr.TokenIdentifier {
+			return nil, errors.New("[vectorDistance] expects the second argument to be a string or an identifier")
+		}
+
+		field, err := argTokenResolverFunc(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("[vectorDistance] failed to resolve field argument: %w", err)
+		}
+
+		if field.VectorDistance == nil {
+			return nil, fmt.Errorf("[vectorDistance] %q is not a vector field", args[0].Literal)
+		}
+
+		query, err := argTokenResolverFunc(args[1])
+		if err != nil {
+			return nil, fmt.Errorf("[vectorDistance] failed to resolve query argument: %w", err)
+		}
+
+		result, err := field.VectorDistance(query)
+		if err != nil {
+			return nil, fmt.Errorf("[vectorDistance] %w", err)
+		}
+
+		return result, nil
+	},
+
 	// strftime(format, [timeValue, modifier1, modifier2, ...]) returns
 	// a date string formatted according to the specified format argument.
 	//
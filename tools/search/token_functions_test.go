@@ -211,6 +211,286 @@ func TestTokenFunctionsGeoDistanceExec(t *testing.T) {
 	}
 }
 
+func TestTokenFunctionsFts(t *testing.T) {
+	t.Parallel()
+
+	fn, ok := TokenFunctions["fts"]
+	if !ok {
+		t.Fatal("Expected fts token function to be registered.")
+	}
+
+	var matched *ResolverResult
+
+	resolver := func(t fexpr.Token) (*ResolverResult, error) {
+		switch t.Literal {
+		case "indexed":
+			return &ResolverResult{
+				Identifier: "[[indexed]]",
+				FullText: func(query *ResolverResult) (*ResolverResult, error) {
+					matched = query
+					return &ResolverResult{Identifier: "MATCHED", NullFallback: NullFallbackDisabled}, nil
+				},
+			}, nil
+		case "failing":
+			return &ResolverResult{
+				Identifier: "[[failing]]",
+				FullText: func(query *ResolverResult) (*ResolverResult, error) {
+					return nil, errors.New("test")
+				},
+			}, nil
+		case "missing":
+			return nil, errors.New("missing")
+		}
+
+		placeholder := "t" + security.PseudorandomString(5)
+		return &ResolverResult{Identifier: "{:" + placeholder + "}", Params: map[string]any{placeholder: t.Literal}}, nil
+	}
+
+	scenarios := []struct {
+		name      string
+		args      []fexpr.Token
+		result    *ResolverResult
+		expectErr bool
+	}{
+		{
+			"no args",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"> 2 args",
+			[]fexpr.Token{
+				{Literal: "indexed", Type: fexpr.TokenIdentifier},
+				{Literal: "a", Type: fexpr.TokenText},
+				{Literal: "b", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"non-identifier field",
+			[]fexpr.Token{
+				{Literal: "indexed", Type: fexpr.TokenText},
+				{Literal: "a", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"number query",
+			[]fexpr.Token{
+				{Literal: "indexed", Type: fexpr.TokenIdentifier},
+				{Literal: "1", Type: fexpr.TokenNumber},
+			},
+			nil,
+			true,
+		},
+		{
+			"unresolvable field",
+			[]fexpr.Token{
+				{Literal: "missing", Type: fexpr.TokenIdentifier},
+				{Literal: "a", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"non-indexed field",
+			[]fexpr.Token{
+				{Literal: "other", Type: fexpr.TokenIdentifier},
+				{Literal: "a", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"failing match",
+			[]fexpr.Token{
+				{Literal: "failing", Type: fexpr.TokenIdentifier},
+				{Literal: "a", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"indexed field",
+			[]fexpr.Token{
+				{Literal: "indexed", Type: fexpr.TokenIdentifier},
+				{Literal: "quick fox", Type: fexpr.TokenText},
+			},
+			&ResolverResult{Identifier: "MATCHED", NullFallback: NullFallbackDisabled},
+			false,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			matched = nil
+
+			result, err := fn(dialect.For("sqlite"), resolver, s.args...)
+
+			hasErr := err != nil
+			if hasErr != s.expectErr {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectErr, hasErr, err)
+			}
+
+			testCompareResults(t, s.result, result)
+
+			if !hasErr {
+				if matched == nil || len(matched.Params) != 1 {
+					t.Fatalf("Expected the query to be resolved and passed to FullText, got %v", matched)
+				}
+				for _, v := range matched.Params {
+					if v != "quick fox" {
+						t.Fatalf("Expected the query param %q, got %v", "quick fox", v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTokenFunctionsVectorDistance(t *testing.T) {
+	t.Parallel()
+
+	fn, ok := TokenFunctions["vectorDistance"]
+	if !ok {
+		t.Fatal("Expected vectorDistance token function to be registered.")
+	}
+
+	var queried *ResolverResult
+
+	resolver := func(t fexpr.Token) (*ResolverResult, error) {
+		switch t.Literal {
+		case "embedding":
+			return &ResolverResult{
+				Identifier: "[[embedding]]",
+				VectorDistance: func(query *ResolverResult) (*ResolverResult, error) {
+					queried = query
+					return &ResolverResult{Identifier: "DISTANCE", NullFallback: NullFallbackDisabled}, nil
+				},
+			}, nil
+		case "failing":
+			return &ResolverResult{
+				Identifier: "[[failing]]",
+				VectorDistance: func(query *ResolverResult) (*ResolverResult, error) {
+					return nil, errors.New("test")
+				},
+			}, nil
+		case "missing":
+			return nil, errors.New("missing")
+		}
+
+		placeholder := "t" + security.PseudorandomString(5)
+		return &ResolverResult{Identifier: "{:" + placeholder + "}", Params: map[string]any{placeholder: t.Literal}}, nil
+	}
+
+	scenarios := []struct {
+		name      string
+		args      []fexpr.Token
+		result    *ResolverResult
+		expectErr bool
+	}{
+		{
+			"no args",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"> 2 args",
+			[]fexpr.Token{
+				{Literal: "embedding", Type: fexpr.TokenIdentifier},
+				{Literal: "[1]", Type: fexpr.TokenText},
+				{Literal: "[2]", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"non-identifier field",
+			[]fexpr.Token{
+				{Literal: "embedding", Type: fexpr.TokenText},
+				{Literal: "[1]", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"number query",
+			[]fexpr.Token{
+				{Literal: "embedding", Type: fexpr.TokenIdentifier},
+				{Literal: "1", Type: fexpr.TokenNumber},
+			},
+			nil,
+			true,
+		},
+		{
+			"unresolvable field",
+			[]fexpr.Token{
+				{Literal: "missing", Type: fexpr.TokenIdentifier},
+				{Literal: "[1]", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"non-vector field",
+			[]fexpr.Token{
+				{Literal: "other", Type: fexpr.TokenIdentifier},
+				{Literal: "[1]", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"failing distance",
+			[]fexpr.Token{
+				{Literal: "failing", Type: fexpr.TokenIdentifier},
+				{Literal: "[1]", Type: fexpr.TokenText},
+			},
+			nil,
+			true,
+		},
+		{
+			"vector field",
+			[]fexpr.Token{
+				{Literal: "embedding", Type: fexpr.TokenIdentifier},
+				{Literal: "[1,2]", Type: fexpr.TokenText},
+			},
+			&ResolverResult{Identifier: "DISTANCE", NullFallback: NullFallbackDisabled},
+			false,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			queried = nil
+
+			result, err := fn(dialect.For("sqlite"), resolver, s.args...)
+
+			hasErr := err != nil
+			if hasErr != s.expectErr {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectErr, hasErr, err)
+			}
+
+			testCompareResults(t, s.result, result)
+
+			if !hasErr {
+				if queried == nil || len(queried.Params) != 1 {
+					t.Fatalf("Expected the query to be resolved and passed to VectorDistance, got %v", queried)
+				}
+				for _, v := range queried.Params {
+					if v != "[1,2]" {
+						t.Fatalf("Expected the query param %q, got %v", "[1,2]", v)
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestTokenFunctionsStrftime(t *testing.T) {
 	t.Parallel()
 
@@ -17,7 +17,9 @@
 //
 // If TASKS_URL is set, schedules run as durable Hanzo Tasks workflows
 // (retries, dead letter, audit trail). If not, runs locally via goroutine
-// timer (dev mode, same behavior as cron but no persistence).
+// timer (dev mode, no persistence). Locally, a cron expression fires at its
+// wall-clock moments in the client's Location when a CronParser is set (the
+// cron package sets its own), and on an approximated interval otherwise.
 //
 // If zapAddr is set, ZAP binary transport is preferred over HTTP for
 // submitting tasks (lower latency, same semantics). HTTP is fallback.
@@ -71,7 +73,9 @@ type Schedule struct {
 // scheduleEntry is the internal state tracked per Add().
 type scheduleEntry struct {
 	expression string             // original "30s" or "*/5 * * * *"
-	interval   time.Duration      // resolved tick interval (local mode)
+	interval   time.Duration      // resolved tick interval (local mode, no timetable)
+	timetable  Timetable          // wall-clock moments of a cron expression (local mode)
+	last       time.Time          // moments up to here are accounted for (timetable only)
 	fn         func()             // user-supplied callback (may be nil for remote-only)
 	cancel     context.CancelFunc // local ticker canceller (nil when not ticking)
 	remote     bool               // true when ticking happens server-side
@@ -86,6 +90,10 @@ type Client struct {
 	logger     luxlog.Logger
 	mu         sync.RWMutex
 	schedules  map[string]*scheduleEntry
+	cronParser CronParser
+	location   *time.Location
+	catchUp    CatchUp
+	lastRuns   LastRuns
 
 	zapOnce sync.Once
 	zapNode *zap.Node
@@ -106,6 +114,7 @@ func New(tasksURL, zapAddr string, handler Handler) *Client {
 		handler:   handler,
 		logger:    luxlog.New("component", "tasks"),
 		schedules: make(map[string]*scheduleEntry),
+		location:  time.UTC,
 	}
 }
 
@@ -114,7 +123,7 @@ func New(tasksURL, zapAddr string, handler Handler) *Client {
 // Detection is automatic via time.ParseDuration.
 //
 //	app.Tasks().Add("settlement", "30s", fn)            // every 30 seconds
-//	app.Tasks().Add("daily-cleanup", "0 3 * * *", fn)   // daily at 3am UTC
+//	app.Tasks().Add("daily-cleanup", "0 3 * * *", fn)   // daily at 3am (see SetLocation)
 //	app.Tasks().Add("weekly-report", "0 0 * * 1", fn)   // mondays at midnight
 //
 // Re-adding with the same name replaces the previous schedule.
@@ -458,13 +467,15 @@ func (c *Client) scheduleZAP(name string, interval time.Duration) error {
 	return nil
 }
 
-// createCronSchedule creates a durable cron-based schedule on Hanzo Tasks.
+// createCronSchedule creates a durable cron-based schedule on Hanzo Tasks,
+// read in the client's Location.
 func (c *Client) createCronSchedule(name, cronExpr string) error {
 	schedule := map[string]any{
 		"schedule_id": name,
 		"schedule": map[string]any{
 			"spec": map[string]any{
-				"cron_string": []string{cronExpr},
+				"cron_string":   []string{cronExpr},
+				"timezone_name": c.Location().String(),
 			},
 			"action": map[string]any{
 				"start_workflow": map[string]any{
@@ -501,8 +512,10 @@ func (c *Client) createCronSchedule(name, cronExpr string) error {
 	return fmt.Errorf("status %d", resp.StatusCode)
 }
 
-// approximateCron converts a cron expression to a rough duration for local dev fallback.
-// Production uses Hanzo Tasks's real cron scheduler; this is only for dev mode tickers.
+// approximateCron converts a cron expression to a rough duration, for the ZAP
+// schedule (which takes an interval) and for a local schedule without a
+// CronParser. Hanzo Tasks's HTTP schedules and a parsed Timetable run the
+// expression itself.
 func approximateCron(expr string) time.Duration {
 	fields := strings.Fields(expr)
 	switch len(fields) {
@@ -549,14 +562,31 @@ func approximateCron(expr string) time.Duration {
 	}
 }
 
-// addLocal runs fn on a ticker (dev fallback, no persistence).
+// addLocal runs fn locally (dev fallback): at the moments of expression's
+// Timetable when it has one, picking up from where LastRuns says it got to,
+// on a ticker otherwise.
 // expression is the raw "30s" / "*/5 * * * *" string as passed to Add().
 // interval is the resolved tick duration.
 func (c *Client) addLocal(name, expression string, interval time.Duration, fn func()) {
+	timetable := c.timetable(name, expression)
+
+	var last time.Time
+	if timetable != nil {
+		c.mu.RLock()
+		lastRuns := c.lastRuns
+		c.mu.RUnlock()
+
+		if lastRuns != nil {
+			last = lastRuns.Load(name)
+		}
+	}
+
 	c.mu.Lock()
 	entry := &scheduleEntry{
 		expression: expression,
 		interval:   interval,
+		timetable:  timetable,
+		last:       last,
 		fn:         fn,
 	}
 	c.schedules[name] = entry
@@ -565,7 +595,8 @@ func (c *Client) addLocal(name, expression string, interval time.Duration, fn fu
 	c.startEntryTicker(name, entry)
 }
 
-// startEntryTicker spins up the goroutine that fires entry.fn on its interval.
+// startEntryTicker spins up the goroutine that fires entry.fn on its interval,
+// or at the moments of its timetable.
 // Must be called with the entry already stored in c.schedules.
 func (c *Client) startEntryTicker(name string, entry *scheduleEntry) {
 	if entry.fn == nil {
@@ -581,6 +612,12 @@ func (c *Client) startEntryTicker(name string, entry *scheduleEntry) {
 	entry.cancel = cancel
 	c.mu.Unlock()
 
+	if entry.timetable != nil {
+		c.logger.Info("taskqueue: local schedule started", "name", name, "cron", entry.expression, "location", c.Location())
+		go c.runTimetable(ctx, name, entry)
+		return
+	}
+
 	c.logger.Info("taskqueue: local schedule started", "name", name, "interval", entry.interval)
 
 	go func(fn func(), interval time.Duration) {
@@ -591,14 +628,7 @@ func (c *Client) startEntryTicker(name string, entry *scheduleEntry) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				func() {
-					defer func() {
-						if r := recover(); r != nil {
-							c.logger.Error("taskqueue: schedule panic", "name", name, "panic", r)
-						}
-					}()
-					fn()
-				}()
+				c.runEntry(name, fn)
 			}
 		}
 	}(entry.fn, entry.interval)
@@ -0,0 +1,270 @@
+package tasks
+
+import (
+	"context"
+	"time"
+)
+
+// Timetable is the wall-clock schedule of a cron expression.
+type Timetable interface {
+	// Next returns the first moment strictly after t at which the schedule
+	// is due, read in t's location, or the zero time if it never is.
+	Next(t time.Time) time.Time
+}
+
+// CronParser reads a cron expression into its Timetable.
+type CronParser func(expr string) (Timetable, error)
+
+// CatchUp is what a local cron schedule does about the moments it was due
+// while it could not run: paused (cron.Cron.Stop), the host asleep, or its
+// previous run still going.
+//
+// Moments that pass while the process is down are seen only when the client
+// has LastRuns to remember, across processes, how far each schedule got;
+// without them a new process starts counting from when it starts.
+type CatchUp int
+
+const (
+	// CatchUpSkip drops the missed moments and waits for the next one.
+	CatchUpSkip CatchUp = iota
+
+	// CatchUpOnce runs once for any number of missed moments.
+	CatchUpOnce
+
+	// CatchUpAll runs once per missed moment, up to MaxCatchUpRuns.
+	CatchUpAll
+)
+
+// MaxCatchUpRuns caps the runs CatchUpAll makes up for at once, so a job on a
+// one-minute schedule paused for a day does not run a thousand times in a row.
+const MaxCatchUpRuns = 100
+
+// LastRuns keeps, for each local cron schedule by name, the time up to which
+// its moments have been accounted for — run or skipped — so that a schedule
+// added by a new process catches up on the moments the old one never saw.
+//
+// Save is called from the schedules' own goroutines, as each of them moves
+// on; an implementation that can't store the time should log it rather than
+// hold the schedule up.
+type LastRuns interface {
+	// Load returns the time stored for the named schedule, or the zero time.
+	Load(name string) time.Time
+
+	// Save stores t for the named schedule.
+	Save(name string, t time.Time)
+}
+
+// SetLastRuns sets where local cron schedules keep how far they got. The
+// schedules already added pick up the times stored for them, and those that
+// are running go over the moments they missed as the CatchUp policy says.
+func (c *Client) SetLastRuns(lastRuns LastRuns) {
+	c.mu.Lock()
+	c.lastRuns = lastRuns
+	names := make([]string, 0, len(c.schedules))
+	for name, entry := range c.schedules {
+		if entry.timetable != nil {
+			names = append(names, name)
+		}
+	}
+	c.mu.Unlock()
+
+	if lastRuns == nil {
+		return
+	}
+
+	stored := make(map[string]time.Time, len(names))
+	for _, name := range names {
+		stored[name] = lastRuns.Load(name)
+	}
+
+	c.mu.Lock()
+	running := make(map[string]*scheduleEntry, len(stored))
+	for name, last := range stored {
+		entry := c.schedules[name]
+		if entry == nil || entry.timetable == nil {
+			continue // removed or replaced meanwhile
+		}
+		// only ever further back: what this process has seen it has seen
+		if !last.IsZero() && (entry.last.IsZero() || last.Before(entry.last)) {
+			entry.last = last
+		}
+		if entry.cancel != nil {
+			running[name] = entry
+		}
+	}
+	c.mu.Unlock()
+
+	for name, entry := range running {
+		c.startEntryTicker(name, entry)
+	}
+}
+
+// SetCronParser sets how the local fallback reads cron expressions. Without
+// one, each expression is approximated by a fixed interval from the time it
+// is added.
+//
+// It applies to the schedules added after it; set it before the first Add.
+func (c *Client) SetCronParser(parser CronParser) {
+	c.mu.Lock()
+	c.cronParser = parser
+	c.mu.Unlock()
+}
+
+// SetLocation sets the location local cron schedules are read in (UTC by
+// default), and with it the timezone of the durable cron schedules created
+// afterwards. Local schedules already running wait for their next moment in
+// the new location.
+func (c *Client) SetLocation(loc *time.Location) {
+	if loc == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.location = loc
+	running := make(map[string]*scheduleEntry, len(c.schedules))
+	for name, entry := range c.schedules {
+		if entry.timetable != nil && entry.cancel != nil {
+			running[name] = entry
+		}
+	}
+	c.mu.Unlock()
+
+	for name, entry := range running {
+		c.startEntryTicker(name, entry)
+	}
+}
+
+// Location returns the location local cron schedules are read in.
+func (c *Client) Location() *time.Location {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.location
+}
+
+// SetCatchUp sets what local cron schedules do about the moments they missed
+// (CatchUpSkip by default). Duration schedules ("30s") have no moments to
+// miss and are unaffected.
+func (c *Client) SetCatchUp(policy CatchUp) {
+	c.mu.Lock()
+	c.catchUp = policy
+	c.mu.Unlock()
+}
+
+// timetable reads expression with the client's cron parser, or returns nil
+// when it is a duration, there is no parser, or the parser refuses it — all of
+// which leave the entry on its approximated interval.
+func (c *Client) timetable(name, expression string) Timetable {
+	if _, err := time.ParseDuration(expression); err == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	parser := c.cronParser
+	c.mu.RUnlock()
+
+	if parser == nil {
+		return nil
+	}
+
+	timetable, err := parser(expression)
+	if err != nil {
+		c.logger.Warn("taskqueue: cron expression not understood, approximating it",
+			"name", name, "expression", expression, "error", err)
+		return nil
+	}
+
+	return timetable
+}
+
+// runTimetable fires entry.fn at the moments of its timetable until ctx is
+// done. entry.last, kept across pauses (and across processes, with LastRuns),
+// is the wall-clock time up to which the moments have been accounted for —
+// run or skipped.
+//
+// The wait is a timer on the monotonic clock, which stops while the host
+// sleeps, so every wakeup re-reads the wall clock and counts the moments
+// passed since entry.last rather than trusting that it woke on one.
+func (c *Client) runTimetable(ctx context.Context, name string, entry *scheduleEntry) {
+	for {
+		c.mu.Lock()
+		now := time.Now().Round(0)
+		loc := c.location
+		runs := 0
+		if !entry.last.IsZero() {
+			runs = dueRuns(entry.timetable, loc, c.catchUp, entry.last, now)
+		}
+		var save LastRuns
+		if now.After(entry.last) {
+			entry.last = now
+			save = c.lastRuns
+		}
+		c.mu.Unlock()
+
+		if save != nil {
+			save.Save(name, now)
+		}
+
+		for i := 0; i < runs; i++ {
+			if ctx.Err() != nil {
+				return
+			}
+			c.runEntry(name, entry.fn)
+		}
+
+		next := entry.timetable.Next(time.Now().In(loc))
+		if next.IsZero() {
+			c.logger.Warn("taskqueue: cron schedule is never due", "name", name, "expression", entry.expression)
+			<-ctx.Done()
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// dueRuns returns how many times a schedule runs now, given that its moments
+// up to last have been accounted for.
+//
+// The moment of the current minute, if there is one, is on time and always
+// runs. The moments between last and the current minute were missed and run
+// as policy says.
+func dueRuns(timetable Timetable, loc *time.Location, policy CatchUp, last, now time.Time) int {
+	current := now.Truncate(time.Minute)
+
+	runs := 0
+	if current.After(last) && timetable.Next(current.Add(-time.Nanosecond).In(loc)).Equal(current) {
+		runs = 1
+	}
+
+	if policy == CatchUpSkip {
+		return runs
+	}
+
+	missed := 0
+	for at := timetable.Next(last.In(loc)); !at.IsZero() && at.Before(current) && missed < MaxCatchUpRuns; at = timetable.Next(at) {
+		missed++
+	}
+
+	if policy == CatchUpOnce {
+		return min(runs+missed, 1)
+	}
+
+	return runs + missed
+}
+
+// runEntry calls fn, logging rather than propagating a panic so that one bad
+// run does not stop the schedule.
+func (c *Client) runEntry(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Error("taskqueue: schedule panic", "name", name, "panic", r)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,136 @@
+package tasks
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// hourly is due at the top of every hour of the location it is read in.
+type hourly struct{}
+
+func (hourly) Next(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+}
+
+func TestDueRuns(t *testing.T) {
+	t.Parallel()
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	scenarios := []struct {
+		name     string
+		policy   CatchUp
+		last     time.Time
+		now      time.Time
+		expected int
+	}{
+		{"on time", CatchUpSkip, at(2, 59), at(3, 0).Add(time.Millisecond), 1},
+		{"on time, later in the minute", CatchUpSkip, at(2, 59), at(3, 0).Add(40 * time.Second), 1},
+		{"already run this minute", CatchUpSkip, at(3, 0).Add(time.Millisecond), at(3, 0).Add(time.Second), 0},
+		{"between moments", CatchUpAll, at(3, 0).Add(time.Millisecond), at(3, 30), 0},
+		{"skip missed, none on time", CatchUpSkip, at(1, 30), at(3, 30), 0},
+		{"skip missed, one on time", CatchUpSkip, at(1, 30), at(4, 0), 1},
+		{"once for missed", CatchUpOnce, at(1, 30), at(3, 30), 1},
+		{"once for missed and on time", CatchUpOnce, at(1, 30), at(4, 0), 1},
+		{"all missed", CatchUpAll, at(1, 30), at(3, 30), 2},
+		{"all missed and on time", CatchUpAll, at(1, 30), at(4, 0), 3},
+		{"all, capped", CatchUpAll, at(1, 30), at(1, 30).AddDate(0, 1, 0), MaxCatchUpRuns},
+		{"clock moved back", CatchUpAll, at(4, 0), at(3, 0), 0},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			result := dueRuns(hourly{}, time.UTC, s.policy, s.last, s.now)
+			if result != s.expected {
+				t.Fatalf("Expected %d runs, got %d", s.expected, result)
+			}
+		})
+	}
+}
+
+// TestDueRunsLocation checks that moments are read in the location given,
+// not in that of the times compared: an India hour starts at :30 UTC.
+func TestDueRunsLocation(t *testing.T) {
+	t.Parallel()
+
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	last := time.Date(2026, 3, 10, 2, 45, 0, 0, time.UTC)
+
+	if runs := dueRuns(hourly{}, kolkata, CatchUpSkip, last, time.Date(2026, 3, 10, 3, 0, 0, 0, time.UTC)); runs != 0 {
+		t.Fatalf("Expected no run at 03:00 UTC, got %d", runs)
+	}
+
+	if runs := dueRuns(hourly{}, kolkata, CatchUpSkip, last, time.Date(2026, 3, 10, 3, 30, 0, 0, time.UTC)); runs != 1 {
+		t.Fatalf("Expected a run at 03:30 UTC, got %d", runs)
+	}
+}
+
+// memoryLastRuns is LastRuns in a map.
+type memoryLastRuns struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+func (m *memoryLastRuns) Load(name string) time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.times[name]
+}
+
+func (m *memoryLastRuns) Save(name string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.times[name] = t
+}
+
+// TestLastRunsCatchUp checks that a schedule added by a new process picks up
+// from the time stored for it, runs for the moments it missed and stores how
+// far it got; and that one with nothing stored waits for its next moment.
+func TestLastRunsCatchUp(t *testing.T) {
+	t.Parallel()
+
+	lastRuns := &memoryLastRuns{times: map[string]time.Time{
+		"missed": time.Now().Add(-3 * time.Hour),
+	}}
+
+	c := New("", "", nil)
+	c.SetCronParser(func(string) (Timetable, error) { return hourly{}, nil })
+	c.SetCatchUp(CatchUpOnce)
+	c.SetLastRuns(lastRuns)
+	defer c.RemoveAll()
+
+	ran := make(chan string, 10)
+	for _, name := range []string{"missed", "new"} {
+		if err := c.Add(name, "0 * * * *", func() { ran <- name }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case name := <-ran:
+		if name != "missed" {
+			t.Fatalf("Expected the schedule with a stored time to run, got %q", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the missed moments to be caught up on")
+	}
+
+	select {
+	case name := <-ran:
+		t.Fatalf("Expected a single run, got another of %q", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for _, name := range []string{"missed", "new"} {
+		if last := lastRuns.Load(name); time.Since(last) > time.Minute {
+			t.Fatalf("Expected %q to store the time it got to, got %v", name, last)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package types
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Vector defines a list of float32 components (e.g. an embedding), stored
+// as a blob of little-endian float32 values and serialized as a json array.
+//
+// The blob is 4 bytes per component and, unlike a json array of numbers,
+// doesn't lose or round anything on its way to and from the database.
+type Vector []float32
+
+// String returns the json array representation of the current Vector instance.
+func (v Vector) String() string {
+	raw, _ := v.MarshalJSON()
+	return string(raw)
+}
+
+// MarshalJSON implements the [json.Marshaler] interface.
+//
+// A nil Vector is serialized as an empty array.
+func (v Vector) MarshalJSON() ([]byte, error) {
+	if v == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal([]float32(v))
+}
+
+// Bytes returns the blob encoding of the current Vector instance
+// (4 little-endian bytes per component).
+func (v Vector) Bytes() []byte {
+	result := make([]byte, 0, 4*len(v))
+	for _, c := range v {
+		result = binary.LittleEndian.AppendUint32(result, math.Float32bits(c))
+	}
+	return result
+}
+
+// Value implements the [driver.Valuer] interface.
+//
+// An empty Vector is stored as NULL.
+func (v Vector) Value() (driver.Value, error) {
+	if len(v) == 0 {
+		return nil, nil
+	}
+
+	return v.Bytes(), nil
+}
+
+// Scan implements [sql.Scanner] interface to scan the provided value
+// into the current Vector instance.
+//
+// The value argument could be nil (no-op), another Vector instance,
+// a float slice, a blob as returned by [Vector.Bytes] or a serialized json array.
+//
+// Note that a []byte value is always read as a blob and not as json
+// since this is how the database returns it.
+func (v *Vector) Scan(value any) error {
+	var err error
+
+	switch val := value.(type) {
+	case nil:
+		*v = nil
+	case Vector:
+		*v = append(Vector(nil), val...)
+	case *Vector:
+		if val != nil {
+			*v = append(Vector(nil), (*val)...)
+		}
+	case []float32:
+		*v = append(Vector(nil), val...)
+	case []float64:
+		result := make(Vector, len(val))
+		for i, c := range val {
+			result[i] = float32(c)
+		}
+		*v = result
+	case []byte:
+		if len(val)%4 != 0 {
+			err = fmt.Errorf("invalid blob length %d", len(val))
+			break
+		}
+		result := make(Vector, len(val)/4)
+		for i := range result {
+			result[i] = math.Float32frombits(binary.LittleEndian.Uint32(val[4*i:]))
+		}
+		if len(result) == 0 {
+			result = nil
+		}
+		*v = result
+	case JSONRaw:
+		err = v.unmarshalJSON(val)
+	case string:
+		err = v.unmarshalJSON([]byte(val))
+	default:
+		var raw []byte
+		raw, err = json.Marshal(val)
+		if err != nil {
+			err = fmt.Errorf("unable to marshalize value for scanning: %w", err)
+		} else {
+			err = v.unmarshalJSON(raw)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("[Vector] unable to scan value %v: %w", value, err)
+	}
+
+	return nil
+}
+
+func (v *Vector) unmarshalJSON(raw []byte) error {
+	if len(raw) == 0 {
+		*v = nil
+		return nil
+	}
+
+	var result []float32
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return err
+	}
+
+	if len(result) == 0 {
+		result = nil
+	}
+
+	*v = result
+
+	return nil
+}
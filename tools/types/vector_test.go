@@ -0,0 +1,92 @@
+package types_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hanzoai/base/tools/types"
+)
+
+func TestVectorStringAndValue(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		name          string
+		vector        types.Vector
+		expectedStr   string
+		expectedValue any
+	}{
+		{"nil", nil, `[]`, nil},
+		{"empty", types.Vector{}, `[]`, nil},
+		{"non-empty", types.Vector{1, -0.5}, `[1,-0.5]`, []byte{0, 0, 0x80, 0x3f, 0, 0, 0, 0xbf}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.name, func(t *testing.T) {
+			if str := s.vector.String(); str != s.expectedStr {
+				t.Fatalf("Expected string %s, got %s", s.expectedStr, str)
+			}
+
+			val, err := s.vector.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.expectedValue == nil {
+				if val != nil {
+					t.Fatalf("Expected nil value, got %v", val)
+				}
+				return
+			}
+
+			if !bytes.Equal(val.([]byte), s.expectedValue.([]byte)) {
+				t.Fatalf("Expected value %v, got %v", s.expectedValue, val)
+			}
+		})
+	}
+}
+
+func TestVectorScan(t *testing.T) {
+	t.Parallel()
+
+	scenarios := []struct {
+		value       any
+		expectError bool
+		expected    string
+	}{
+		{nil, false, "[]"},
+		{"", false, "[]"},
+		{"[]", false, "[]"},
+		{"null", false, "[]"},
+		{"invalid", true, "[]"},
+		{"[1,\"a\"]", true, "[]"},
+		{`[1, 2.5, -3]`, false, "[1,2.5,-3]"},
+		{types.JSONRaw(`[1,2]`), false, "[1,2]"},
+		{[]byte{}, false, "[]"},
+		{[]byte{1, 2, 3}, true, "[]"},
+		{types.Vector{1, -0.5}.Bytes(), false, "[1,-0.5]"},
+		{types.Vector{1, 2}, false, "[1,2]"},
+		{&types.Vector{1, 2}, false, "[1,2]"},
+		{[]float32{1, 2}, false, "[1,2]"},
+		{[]float64{1, 0.25}, false, "[1,0.25]"},
+		{[]any{1, 0.5}, false, "[1,0.5]"},
+		{map[string]any{"a": 1}, true, "[]"},
+	}
+
+	for i, s := range scenarios {
+		t.Run(fmt.Sprintf("%d_%#v", i, s.value), func(t *testing.T) {
+			v := types.Vector{}
+			err := v.Scan(s.value)
+
+			hasErr := err != nil
+			if hasErr != s.expectError {
+				t.Fatalf("Expected hasErr %v, got %v (%v)", s.expectError, hasErr, err)
+			}
+
+			if str := v.String(); str != s.expected {
+				t.Fatalf("Expected %s, got %s", s.expected, str)
+			}
+		})
+	}
+}